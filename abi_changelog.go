@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ABI changelog between builds.
+//
+// DiffContractABI compares the interface of a previous artifact with a new
+// build and classifies every change as breaking or not. Removed or renamed
+// methods, changed parameter or return types and changed event signatures
+// break existing callers; added methods and events, renamed parameters and
+// relaxed method flags do not. When a baseline artifact is configured,
+// Compile attaches the changelog to the result and, with --fail-on-abi-break,
+// fails the build if breaking changes ship without a contract version bump.
+
+const (
+	abiBaselineFlag     = "--abi-baseline"
+	failOnABIBreakFlag  = "--fail-on-abi-break"
+	contractVersionFlag = "--contract-version"
+)
+
+// ABIChangeKind classifies a change to the contract interface
+type ABIChangeKind string
+
+const (
+	ABIMethodAdded           ABIChangeKind = "method-added"
+	ABIMethodRemoved         ABIChangeKind = "method-removed"
+	ABIMethodRenamed         ABIChangeKind = "method-renamed"
+	ABIParametersChanged     ABIChangeKind = "parameters-changed"
+	ABIParameterNamesChanged ABIChangeKind = "parameter-names-changed"
+	ABIReturnsChanged        ABIChangeKind = "returns-changed"
+	ABISafetyChanged         ABIChangeKind = "safety-changed"
+	ABIPayabilityChanged     ABIChangeKind = "payability-changed"
+	ABIEventAdded            ABIChangeKind = "event-added"
+	ABIEventRemoved          ABIChangeKind = "event-removed"
+	ABIEventSignatureChanged ABIChangeKind = "event-signature-changed"
+)
+
+// ABIChange is one entry of an ABI changelog
+type ABIChange struct {
+	Kind     ABIChangeKind `json:"kind"`
+	Name     string        `json:"name"`
+	Detail   string        `json:"detail"`
+	Breaking bool          `json:"breaking"`
+}
+
+// ABIChangelog lists the interface changes between two builds
+type ABIChangelog struct {
+	OldVersion string      `json:"old_version"`
+	NewVersion string      `json:"new_version"`
+	Changes    []ABIChange `json:"changes"`
+}
+
+// Breaking returns the breaking changes
+func (c *ABIChangelog) Breaking() []ABIChange {
+	var breaking []ABIChange
+	for _, change := range c.Changes {
+		if change.Breaking {
+			breaking = append(breaking, change)
+		}
+	}
+	return breaking
+}
+
+// HasBreaking reports whether any change breaks existing callers
+func (c *ABIChangelog) HasBreaking() bool {
+	return len(c.Breaking()) > 0
+}
+
+// String renders the changelog with breaking changes first
+func (c *ABIChangelog) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "ABI changes %s -> %s\n", c.OldVersion, c.NewVersion)
+	if len(c.Changes) == 0 {
+		builder.WriteString("  no interface changes\n")
+		return builder.String()
+	}
+	for _, breaking := range []bool{true, false} {
+		for _, change := range c.Changes {
+			if change.Breaking != breaking {
+				continue
+			}
+			label := "compatible"
+			if breaking {
+				label = "BREAKING"
+			}
+			fmt.Fprintf(&builder, "  [%s] %s %s: %s\n", label, change.Kind, change.Name, change.Detail)
+		}
+	}
+	return builder.String()
+}
+
+// DiffContractABI compares the methods and events of two builds. Methods are
+// matched by name and parameter count, events by name.
+func DiffContractABI(previous, current *NeoContract) *ABIChangelog {
+	changelog := &ABIChangelog{OldVersion: previous.Version, NewVersion: current.Version}
+	add := func(kind ABIChangeKind, name, detail string, breaking bool) {
+		changelog.Changes = append(changelog.Changes, ABIChange{kind, name, detail, breaking})
+	}
+
+	newMethods := make(map[string]*ContractMethod)
+	for _, method := range current.Methods {
+		newMethods[methodKey(method)] = method
+	}
+	oldMethods := make(map[string]bool)
+
+	var removed []*ContractMethod
+	for _, before := range previous.Methods {
+		oldMethods[methodKey(before)] = true
+		after, ok := newMethods[methodKey(before)]
+		if !ok {
+			removed = append(removed, before)
+			continue
+		}
+
+		name := methodKey(before)
+		if oldTypes, newTypes := methodParameterTypes(before.Parameters), methodParameterTypes(after.Parameters); oldTypes != newTypes {
+			add(ABIParametersChanged, name, fmt.Sprintf("(%s) -> (%s)", oldTypes, newTypes), true)
+		} else if methodParameterNames(before.Parameters) != methodParameterNames(after.Parameters) {
+			add(ABIParameterNamesChanged, name, fmt.Sprintf("(%s) -> (%s)",
+				methodParameterNames(before.Parameters), methodParameterNames(after.Parameters)), false)
+		}
+		if oldTypes, newTypes := methodParameterTypes(before.Returns), methodParameterTypes(after.Returns); oldTypes != newTypes {
+			add(ABIReturnsChanged, name, fmt.Sprintf("(%s) -> (%s)", oldTypes, newTypes), true)
+		}
+		// Callers in read-only contexts break when a safe method becomes unsafe
+		if before.Safe != after.Safe {
+			add(ABISafetyChanged, name, fmt.Sprintf("safe %t -> %t", before.Safe, after.Safe), before.Safe)
+		}
+		if before.Payable != after.Payable {
+			add(ABIPayabilityChanged, name, fmt.Sprintf("payable %t -> %t", before.Payable, after.Payable), before.Payable)
+		}
+	}
+
+	var added []*ContractMethod
+	for _, method := range current.Methods {
+		if !oldMethods[methodKey(method)] {
+			added = append(added, method)
+		}
+	}
+
+	// A removed method whose signature matches exactly one added method was
+	// most likely renamed
+	renamed := make(map[*ContractMethod]bool)
+	for _, before := range removed {
+		var match *ContractMethod
+		matches := 0
+		for _, after := range added {
+			if !renamed[after] && methodSignatureTypes(before) == methodSignatureTypes(after) {
+				match = after
+				matches++
+			}
+		}
+		if matches == 1 {
+			renamed[match] = true
+			add(ABIMethodRenamed, methodKey(before), "renamed to "+methodKey(match), true)
+			continue
+		}
+		add(ABIMethodRemoved, methodKey(before), "("+methodParameterTypes(before.Parameters)+")", true)
+	}
+	for _, after := range added {
+		if !renamed[after] {
+			add(ABIMethodAdded, methodKey(after), "("+methodParameterTypes(after.Parameters)+")", false)
+		}
+	}
+
+	newEvents := make(map[string]*ContractEvent)
+	for _, event := range current.Events {
+		newEvents[event.Name] = event
+	}
+	oldEvents := make(map[string]bool)
+	for _, before := range previous.Events {
+		oldEvents[before.Name] = true
+		after, ok := newEvents[before.Name]
+		if !ok {
+			add(ABIEventRemoved, before.Name, eventSignature(before), true)
+			continue
+		}
+		if eventSignature(before) != eventSignature(after) {
+			add(ABIEventSignatureChanged, before.Name, eventSignature(before)+" -> "+eventSignature(after), true)
+		}
+	}
+	for _, event := range current.Events {
+		if !oldEvents[event.Name] {
+			add(ABIEventAdded, event.Name, eventSignature(event), false)
+		}
+	}
+
+	return changelog
+}
+
+// methodKey identifies a method; Neo overloads methods by parameter count
+func methodKey(method *ContractMethod) string {
+	return fmt.Sprintf("%s/%d", method.Name, len(method.Parameters))
+}
+
+func methodParameterTypes(params []MethodParameter) string {
+	types := make([]string, len(params))
+	for i, param := range params {
+		types[i] = param.Type
+	}
+	return strings.Join(types, ",")
+}
+
+func methodParameterNames(params []MethodParameter) string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func methodSignatureTypes(method *ContractMethod) string {
+	return "(" + methodParameterTypes(method.Parameters) + ")->(" + methodParameterTypes(method.Returns) + ")"
+}
+
+// eventSignature is what listeners decode: parameter types and which are indexed
+func eventSignature(event *ContractEvent) string {
+	if event.Signature != "" {
+		return event.Signature
+	}
+	types := make([]string, len(event.Parameters))
+	for i, param := range event.Parameters {
+		types[i] = param.Type
+		if param.Indexed {
+			types[i] += " indexed"
+		}
+	}
+	return event.Name + "(" + strings.Join(types, ",") + ")"
+}
+
+// ABIVersionError reports breaking changes shipped without a version bump
+type ABIVersionError struct {
+	Changelog *ABIChangelog
+	Problem   string
+}
+
+func (e *ABIVersionError) Error() string {
+	breaking := e.Changelog.Breaking()
+	names := make([]string, len(breaking))
+	for i, change := range breaking {
+		names[i] = string(change.Kind) + " " + change.Name
+	}
+	return fmt.Sprintf("%d breaking ABI change(s) (%s): %s", len(breaking), strings.Join(names, ", "), e.Problem)
+}
+
+// CheckABIVersionBump fails when the changelog has breaking changes but the
+// contract version was not bumped accordingly: a new major version, or a new
+// minor version while the major version is 0
+func CheckABIVersionBump(changelog *ABIChangelog) error {
+	if !changelog.HasBreaking() {
+		return nil
+	}
+
+	oldVersion, err := ParseSemanticVersion(changelog.OldVersion)
+	if err != nil {
+		return &ABIVersionError{changelog, "baseline " + err.Error()}
+	}
+	newVersion, err := ParseSemanticVersion(changelog.NewVersion)
+	if err != nil {
+		return &ABIVersionError{changelog, err.Error()}
+	}
+
+	if oldVersion.Major == 0 && newVersion.Major == 0 {
+		if newVersion.Minor > oldVersion.Minor {
+			return nil
+		}
+		return &ABIVersionError{changelog, fmt.Sprintf("bump the contract version to 0.%d.0", oldVersion.Minor+1)}
+	}
+	if newVersion.Major > oldVersion.Major {
+		return nil
+	}
+	return &ABIVersionError{changelog, fmt.Sprintf("bump the contract version to %d.0.0", oldVersion.Major+1)}
+}
+
+// abiArtifact is the part of a contract artifact the ABI diff reads
+type abiArtifact struct {
+	Name    string            `json:"name"`
+	Version string            `json:"version"`
+	Methods []*ContractMethod `json:"methods"`
+	Events  []*ContractEvent  `json:"events"`
+}
+
+// LoadABIBaseline reads the interface of a previously built contract
+// artifact, the name.json the compiler writes. JSON listing no methods is
+// not an artifact: a contract always has main.
+func LoadABIBaseline(path string) (*NeoContract, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading ABI baseline: %w", err)
+	}
+	var artifact abiArtifact
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		return nil, fmt.Errorf("invalid ABI baseline %s: %w", path, err)
+	}
+	if len(artifact.Methods) == 0 {
+		return nil, fmt.Errorf("invalid ABI baseline %s: not a contract artifact, it lists no methods", path)
+	}
+	for i, method := range artifact.Methods {
+		if method == nil || method.Name == "" {
+			return nil, fmt.Errorf("invalid ABI baseline %s: method %d has no name", path, i)
+		}
+	}
+	return &NeoContract{
+		Name:    artifact.Name,
+		Version: artifact.Version,
+		Methods: artifact.Methods,
+		Events:  artifact.Events,
+	}, nil
+}
+
+// ABICheckOptions is the ABI check configuration
+type ABICheckOptions struct {
+	Baseline    string // Path of the previous artifact, "" to skip the check
+	FailOnBreak bool   // Fail the build on breaking changes without a version bump
+}
+
+// ABICheckFromConfig reads the ABI check settings, letting flags override
+// the config fields
+func ABICheckFromConfig(config CompilerConfig) ABICheckOptions {
+	return ABICheckOptions{
+		Baseline:    flagValue(config.CompilerFlags, abiBaselineFlag, config.ABIBaseline),
+		FailOnBreak: config.FailOnABIBreak || flagSet(config.CompilerFlags, failOnABIBreakFlag),
+	}
+}
+
+// ContractVersionFromConfig returns the contract version from the project
+// configuration, "" when unset. The version must be a semantic version.
+func ContractVersionFromConfig(config CompilerConfig) (string, error) {
+	version := flagValue(config.CompilerFlags, contractVersionFlag, config.ContractVersion)
+	if version == "" {
+		return "", nil
+	}
+	if _, err := ParseSemanticVersion(version); err != nil {
+		return "", fmt.Errorf("contract version: %w", err)
+	}
+	return version, nil
+}
+
+// checkABI diffs the compiled contract against the configured baseline,
+// recording the changelog in result
+func (c *YulToNeoCompiler) checkABI(contract *NeoContract, result *CompilationResult) error {
+	options := ABICheckFromConfig(c.Config)
+	if options.Baseline == "" {
+		return nil
+	}
+
+	baseline, err := LoadABIBaseline(options.Baseline)
+	if err != nil && options.FailOnBreak {
+		result.Errors = append(result.Errors, CompilerError{Phase: "ABI Check", Message: err.Error(), Severity: "error"})
+		return err
+	}
+	if err != nil {
+		result.Warnings = append(result.Warnings, CompilerWarning{Phase: "ABI Check", Message: err.Error()})
+		return nil
+	}
+
+	result.ABIChangelog = DiffContractABI(baseline, contract)
+	err = CheckABIVersionBump(result.ABIChangelog)
+	if err == nil {
+		return nil
+	}
+	if options.FailOnBreak {
+		result.Errors = append(result.Errors, CompilerError{Phase: "ABI Check", Message: err.Error(), Severity: "error"})
+		return err
+	}
+	result.Warnings = append(result.Warnings, CompilerWarning{Phase: "ABI Check", Message: err.Error()})
+	return nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Address translation.
+//
+// Yul code handles accounts and contracts as address words, Neo as 20-byte
+// script hashes. Every conversion between the two goes through the
+// contract's address translation, so caller(), address(), origin(),
+// balance(a), the call and create built-ins, libraries and token methods
+// agree on the address of each account:
+//
+//	identity  the word is the script hash read as a little-endian
+//	          integer, printing as the hash Neo displays (the default)
+//	registry  configured EVM addresses stand for the script hashes they
+//	          are registered with; other accounts keep identity words
+//	checksum  identity words, but conversions are checked instead of
+//	          truncated: hashes must have 20 bytes and words 160 bits
+//
+// Conversions other than identity ones go through the address_word and
+// address_script_hash routines. Other routines call them too, so they are
+// marked directly rather than through useRoutine, and emitted last.
+
+// Address translation strategies
+const (
+	AddressIdentity = "identity"
+	AddressRegistry = "registry"
+	AddressChecksum = "checksum"
+)
+
+// Compiler flag overriding the configured address strategy
+const addressStrategyFlag = "--address-strategy"
+
+// Address routines
+const (
+	addressWordRoutine       = "address_word"
+	addressScriptHashRoutine = "address_script_hash"
+)
+
+// AddressMapping registers the EVM address of a Neo account
+type AddressMapping struct {
+	Address *big.Int // EVM address
+	Hash    string   // Script hash as displayed
+}
+
+// AddressTranslation maps address words onto script hashes
+type AddressTranslation struct {
+	strategy string
+	registry []AddressMapping
+}
+
+// NewAddressTranslation creates a translation with strategy, mapping the
+// registered addresses for the registry strategy
+func NewAddressTranslation(strategy string, registry []AddressMapping) (*AddressTranslation, error) {
+	switch strategy {
+	case AddressIdentity, AddressChecksum:
+		if len(registry) > 0 {
+			return nil, fmt.Errorf("address strategy %s takes no registry", strategy)
+		}
+	case AddressRegistry:
+		addresses, hashes := make(map[string]bool), make(map[string]bool)
+		for _, mapping := range registry {
+			address := mapping.Address.Text(16)
+			if addresses[address] || hashes[mapping.Hash] {
+				return nil, fmt.Errorf("address 0x%s or script hash %s is registered twice", address, mapping.Hash)
+			}
+			addresses[address], hashes[mapping.Hash] = true, true
+		}
+	default:
+		return nil, fmt.Errorf("unknown address strategy %q (want identity, registry or checksum)", strategy)
+	}
+	return &AddressTranslation{strategy: strategy, registry: registry}, nil
+}
+
+// DefaultAddressTranslation returns the identity translation
+func DefaultAddressTranslation() *AddressTranslation {
+	return &AddressTranslation{strategy: AddressIdentity}
+}
+
+// ParseAddressMapping parses a registered address, "address=hash" with the
+// EVM address and the script hash in hex
+func ParseAddressMapping(value string) (AddressMapping, error) {
+	address, hash, ok := strings.Cut(strings.TrimSpace(value), "=")
+	if !ok {
+		return AddressMapping{}, fmt.Errorf("address mapping %q is not address=hash", value)
+	}
+	word, ok := new(big.Int).SetString(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(address)), "0x"), 16)
+	if !ok || word.Sign() < 0 || word.Cmp(addressModulus) >= 0 {
+		return AddressMapping{}, fmt.Errorf("%q is not an EVM address", strings.TrimSpace(address))
+	}
+	parsed, ok := parseScriptHash(hash)
+	if !ok {
+		return AddressMapping{}, fmt.Errorf("%q is not a script hash", strings.TrimSpace(hash))
+	}
+	return AddressMapping{Address: word, Hash: parsed}, nil
+}
+
+// AddressTranslationFromConfig returns the address translation of a
+// configuration. An --address-strategy flag in CompilerFlags takes
+// precedence over AddressStrategy.
+func AddressTranslationFromConfig(config CompilerConfig) (*AddressTranslation, error) {
+	strategy := flagValue(config.CompilerFlags, addressStrategyFlag, config.AddressStrategy)
+	strategy = strings.ToLower(strings.TrimSpace(strategy))
+	if strategy == "" {
+		strategy = AddressIdentity
+	}
+	var registry []AddressMapping
+	for _, value := range config.AddressRegistry {
+		mapping, err := ParseAddressMapping(value)
+		if err != nil {
+			return nil, err
+		}
+		registry = append(registry, mapping)
+	}
+	return NewAddressTranslation(strategy, registry)
+}
+
+// Strategy returns the name of the strategy
+func (t *AddressTranslation) Strategy() string {
+	return t.strategy
+}
+
+// Word returns the address word of a displayed script hash
+func (t *AddressTranslation) Word(hash string) *big.Int {
+	for _, mapping := range t.registry {
+		if mapping.Hash == hash {
+			return new(big.Int).Set(mapping.Address)
+		}
+	}
+	word, _ := new(big.Int).SetString(hash[2:], 16)
+	return word
+}
+
+// ScriptHash returns the displayed script hash of an address word
+func (t *AddressTranslation) ScriptHash(word *big.Int) (string, error) {
+	for _, mapping := range t.registry {
+		if mapping.Address.Cmp(word) == 0 {
+			return mapping.Hash, nil
+		}
+	}
+	if t.strategy == AddressChecksum && (word.Sign() < 0 || word.Cmp(addressModulus) >= 0) {
+		return "", fmt.Errorf("word %#x is not an address", word)
+	}
+	return fmt.Sprintf("0x%040x", new(big.Int).And(toWord(word), new(big.Int).Sub(addressModulus, big.NewInt(1)))), nil
+}
+
+// addressTranslation returns the address translation of the contract
+func (g *CodeGenerator) addressTranslation() *AddressTranslation {
+	if g.context != nil && g.context.AddressTranslation != nil {
+		return g.context.AddressTranslation
+	}
+	return DefaultAddressTranslation()
+}
+
+// addressWord replaces the script hash on top of the stack with its
+// address word
+func (c memoryCode) addressWord() {
+	if c.g.addressTranslation().strategy == AddressIdentity {
+		c.littleEndianWord()
+		return
+	}
+	c.g.memory.routines[addressWordRoutine] = true
+	c.call(addressWordRoutine, 1, 1)
+}
+
+// addressScriptHash replaces the address word on top of the stack with its
+// script hash
+func (c memoryCode) addressScriptHash() {
+	if c.g.addressTranslation().strategy == AddressIdentity {
+		c.scriptHash()
+		return
+	}
+	c.g.memory.routines[addressScriptHashRoutine] = true
+	c.call(addressScriptHashRoutine, 1, 1)
+}
+
+// emitAddressWord returns the address word of a script hash. Argument: the
+// hash.
+func (g *CodeGenerator) emitAddressWord(location SourcePosition) {
+	c := memoryCode{g, location}
+	translation := g.addressTranslation()
+	if translation.strategy == AddressChecksum {
+		g.emitAddressCheck("script hash", func() {
+			c.arg(0)
+			c.arithmetic(SIZE)
+			c.push(20)
+			c.arithmetic(NUMEQUAL)
+		}, location)
+	}
+	for _, mapping := range translation.registry {
+		next := g.createUniqueLabel("address_word_next")
+		c.arg(0)
+		c.op(NewPushInstruction(CreateNeoVMByteString(scriptHashBytes(mapping.Hash))))
+		c.arithmetic(EQUAL)
+		c.jump(JMPIFNOT, next)
+		c.push(mapping.Address)
+		c.op(NewControlFlowInstruction(RET, 0))
+		g.markLabel(next)
+	}
+	c.arg(0)
+	c.littleEndianWord()
+}
+
+// emitAddressScriptHash returns the script hash of an address word.
+// Argument: the word.
+func (g *CodeGenerator) emitAddressScriptHash(location SourcePosition) {
+	c := memoryCode{g, location}
+	translation := g.addressTranslation()
+	if translation.strategy == AddressChecksum {
+		g.emitAddressCheck("address", func() {
+			c.arg(0)
+			c.push(0)
+			c.push(addressModulus)
+			c.arithmetic(WITHIN)
+		}, location)
+	}
+	for _, mapping := range translation.registry {
+		next := g.createUniqueLabel("address_script_hash_next")
+		c.arg(0)
+		c.push(mapping.Address)
+		c.arithmetic(NUMEQUAL)
+		c.jump(JMPIFNOT, next)
+		c.op(NewPushInstruction(CreateNeoVMByteString(scriptHashBytes(mapping.Hash))))
+		c.op(NewControlFlowInstruction(RET, 0))
+		g.markLabel(next)
+	}
+	c.arg(0)
+	c.scriptHash()
+}
+
+// emitAddressCheck throws "invalid name" unless the condition valid pushes
+// holds
+func (g *CodeGenerator) emitAddressCheck(name string, valid func(), location SourcePosition) {
+	c := memoryCode{g, location}
+	checked := g.createUniqueLabel("address_checked")
+	valid()
+	c.jump(JMPIF, checked)
+	c.op(NewPushInstruction(CreateNeoVMByteString("invalid " + name)))
+	c.op(NewControlFlowInstruction(THROW, 0))
+	g.markLabel(checked)
+}
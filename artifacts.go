@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Contract artifacts.
+//
+// Compiling a file into an output directory writes, next to the source's
+// relative path:
+//
+//	name.nef            the NEF file to deploy
+//	name.manifest.json  the contract manifest to deploy with it
+//	name.debug.json     NEP-19 debug information, when enabled
+//	name.srcmap         the compressed solc source map, when enabled
+//	name.asm            the disassembled script
+//	name.json           the whole contract, for tools reading this compiler's output
+
+// Artifact file suffixes
+const (
+	ArtifactNEF      = ".nef"
+	ArtifactManifest = ".manifest.json"
+	ArtifactDebug    = ".debug.json"
+	ArtifactSrcMap   = ".srcmap"
+	ArtifactAsm      = ".asm"
+	ArtifactContract = ".json"
+)
+
+// artifactBase returns the path under dir, without suffix, of the artifacts
+// of source. Sources outside the working directory keep their base name.
+func artifactBase(dir, source string) string {
+	name := strings.TrimSuffix(source, filepath.Ext(source))
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "..") {
+		name = filepath.Base(name)
+	}
+	return filepath.Join(dir, name)
+}
+
+// WriteArtifacts writes the artifacts of a compilation of source under dir
+// and returns their paths
+func WriteArtifacts(dir, source string, result *CompilationResult) ([]string, error) {
+	contract := result.Contract
+	if contract == nil {
+		return nil, fmt.Errorf("no contract to write")
+	}
+	base := artifactBase(dir, source)
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return nil, err
+	}
+
+	nef, err := EncodeNEF(contract)
+	if err != nil {
+		return nil, fmt.Errorf("encoding NEF: %w", err)
+	}
+	var asm bytes.Buffer
+	WriteDisassembly(&asm, contract)
+
+	var written []string
+	write := func(suffix string, data []byte) error {
+		path := base + suffix
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+		written = append(written, path)
+		return nil
+	}
+	writeJSON := func(suffix string, value interface{}) error {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding %s: %w", base+suffix, err)
+		}
+		return write(suffix, data)
+	}
+
+	if err := write(ArtifactNEF, nef); err != nil {
+		return written, err
+	}
+	if contract.Manifest != nil {
+		if err := writeJSON(ArtifactManifest, contract.Manifest); err != nil {
+			return written, err
+		}
+	}
+	if debug := result.DebugInfo; debug != nil {
+		// Sources compiled as strings are documents of the source path
+		if debug.Neo != nil {
+			if err := writeJSON(ArtifactDebug, debug.Neo.WithDocuments(map[string]string{InlineSource: source})); err != nil {
+				return written, err
+			}
+		}
+		if err := write(ArtifactSrcMap, []byte(debug.SrcMap)); err != nil {
+			return written, err
+		}
+	}
+	if err := write(ArtifactAsm, asm.Bytes()); err != nil {
+		return written, err
+	}
+	return written, writeJSON(ArtifactContract, contract)
+}
+
+// WriteDisassembly prints the runtime of contract with the byte offset and
+// source line of each instruction, under the name of each method it starts
+func WriteDisassembly(w io.Writer, contract *NeoContract) {
+	methods := make(map[int][]string)
+	for _, method := range contract.Methods {
+		methods[method.Offset] = append(methods[method.Offset], method.Name)
+	}
+	fmt.Fprintf(w, "; %s %s\n", contract.Name, contract.Version)
+	offset := 0
+	for _, instr := range contract.Runtime {
+		for _, name := range methods[offset] {
+			fmt.Fprintf(w, "\n%s:\n", name)
+		}
+		line := fmt.Sprintf("%04X  %s", offset, OpcodeMnemonic(instr.Opcode))
+		if instr.Opcode == SYSCALL {
+			line += " " + string(instr.Operand)
+		} else if len(instr.Operand) > 0 {
+			line += fmt.Sprintf(" %x", instr.Operand)
+		}
+		if instr.SourceRef != nil && instr.SourceRef.Line > 0 {
+			line = fmt.Sprintf("%-40s ; line %d", line, instr.SourceRef.Line)
+		}
+		fmt.Fprintln(w, line)
+		offset += instr.Size
+	}
+}
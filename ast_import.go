@@ -0,0 +1,602 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSON AST import for third-party frontends.
+//
+// The accepted format is the Yul AST emitted by solc: every node carries a
+// nodeType ("YulBlock", "YulFunctionCall", ...; the "Yul" prefix is
+// optional) and camelCase fields, as described by YulASTJSONSchema. Input is
+// checked completely before any AST is built, so one import reports every
+// malformed node with its JSON Pointer path instead of failing deep in code
+// generation. Optional fields get defaults: locations come from "src" when
+// present, untyped names are u256 and literals take the type of their kind.
+
+// YulASTJSONSchema is the published JSON Schema for imported ASTs
+const YulASTJSONSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "https://github.com/r3e-network/neo-solidity/schemas/yul-ast.json",
+  "title": "Yul AST",
+  "oneOf": [
+    {"type": "object", "required": ["objects"], "properties": {
+      "objects": {"type": "array", "items": {"$ref": "#/$defs/object"}},
+      "functions": {"type": "array", "items": {"$ref": "#/$defs/functionDefinition"}}}},
+    {"$ref": "#/$defs/object"},
+    {"$ref": "#/$defs/block"}
+  ],
+  "$defs": {
+    "src": {"type": "string", "pattern": "^-?[0-9]+:-?[0-9]+(:-?[0-9]+)?$"},
+    "nodeType": {"type": "string"},
+    "object": {"type": "object", "required": ["nodeType", "name", "code"], "properties": {
+      "nodeType": {"enum": ["YulObject", "Object"]},
+      "name": {"type": "string"},
+      "code": {"$ref": "#/$defs/block"},
+      "objects": {"type": "array", "items": {"$ref": "#/$defs/object"}},
+      "data": {"type": "object", "additionalProperties": {"type": "string"}}}},
+    "block": {"type": "object", "required": ["nodeType", "statements"], "properties": {
+      "nodeType": {"enum": ["YulBlock", "Block"]},
+      "src": {"$ref": "#/$defs/src"},
+      "statements": {"type": "array", "items": {"$ref": "#/$defs/statement"}}}},
+    "statement": {"type": "object", "required": ["nodeType"], "properties": {
+      "nodeType": {"enum": ["YulBlock", "YulExpressionStatement", "YulVariableDeclaration", "YulAssignment",
+        "YulIf", "YulSwitch", "YulForLoop", "YulFunctionDefinition", "YulBreak", "YulContinue", "YulLeave",
+        "Block", "ExpressionStatement", "VariableDeclaration", "Assignment",
+        "If", "Switch", "ForLoop", "For", "FunctionDefinition", "Break", "Continue", "Leave"]},
+      "src": {"$ref": "#/$defs/src"},
+      "statements": {"type": "array"},
+      "expression": {"$ref": "#/$defs/expression"},
+      "variables": {"type": "array", "items": {"$ref": "#/$defs/typedName"}},
+      "variableNames": {"type": "array", "items": {"$ref": "#/$defs/identifier"}},
+      "value": {"$ref": "#/$defs/expression"},
+      "condition": {"$ref": "#/$defs/expression"},
+      "body": {"$ref": "#/$defs/block"},
+      "cases": {"type": "array", "items": {"$ref": "#/$defs/case"}},
+      "pre": {"$ref": "#/$defs/block"},
+      "post": {"$ref": "#/$defs/block"},
+      "name": {"type": "string"},
+      "parameters": {"type": "array", "items": {"$ref": "#/$defs/typedName"}},
+      "returnVariables": {"type": "array", "items": {"$ref": "#/$defs/typedName"}}}},
+    "case": {"type": "object", "required": ["value", "body"], "properties": {
+      "nodeType": {"enum": ["YulCase", "Case"]},
+      "value": {"oneOf": [{"const": "default"}, {"$ref": "#/$defs/literal"}]},
+      "body": {"$ref": "#/$defs/block"}}},
+    "expression": {"oneOf": [
+      {"$ref": "#/$defs/functionCall"}, {"$ref": "#/$defs/identifier"}, {"$ref": "#/$defs/literal"}]},
+    "functionCall": {"type": "object", "required": ["nodeType", "functionName", "arguments"], "properties": {
+      "nodeType": {"enum": ["YulFunctionCall", "FunctionCall"]},
+      "functionName": {"$ref": "#/$defs/identifier"},
+      "arguments": {"type": "array", "items": {"$ref": "#/$defs/expression"}}}},
+    "identifier": {"type": "object", "required": ["nodeType", "name"], "properties": {
+      "nodeType": {"enum": ["YulIdentifier", "Identifier"]},
+      "name": {"type": "string", "minLength": 1}}},
+    "literal": {"type": "object", "required": ["nodeType", "kind", "value"], "properties": {
+      "nodeType": {"enum": ["YulLiteral", "Literal"]},
+      "kind": {"enum": ["number", "string", "bool", "hex"]},
+      "value": {"type": "string"},
+      "type": {"type": "string"}}},
+    "typedName": {"type": "object", "required": ["name"], "properties": {
+      "nodeType": {"enum": ["YulTypedName", "TypedName"]},
+      "name": {"type": "string", "minLength": 1},
+      "type": {"type": "string"}}},
+    "functionDefinition": {"type": "object", "required": ["nodeType", "name", "body"], "properties": {
+      "nodeType": {"enum": ["YulFunctionDefinition", "FunctionDefinition"]}}}
+  }
+}`
+
+// maxImportDepth bounds nesting so hostile input cannot exhaust the stack
+const maxImportDepth = 512
+
+// ASTImportIssue is a problem with one node of an imported AST
+type ASTImportIssue struct {
+	Path    string // JSON Pointer to the offending node
+	Message string
+}
+
+func (i ASTImportIssue) String() string {
+	path := i.Path
+	if path == "" {
+		path = "/"
+	}
+	return path + ": " + i.Message
+}
+
+// ASTImportError lists every problem found in an imported AST
+type ASTImportError struct {
+	Issues []ASTImportIssue
+}
+
+func (e *ASTImportError) Error() string {
+	messages := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		messages[i] = issue.String()
+	}
+	return fmt.Sprintf("invalid AST JSON (%d problems): %s", len(e.Issues), strings.Join(messages, "; "))
+}
+
+// ImportYulAST decodes and validates a JSON AST. The document may hold a list
+// of objects, a single object or a bare code block.
+func ImportYulAST(data []byte) (*YulAST, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, &ASTImportError{[]ASTImportIssue{{"", "malformed JSON: " + err.Error()}}}
+	}
+
+	d := &astImporter{}
+	ast := &YulAST{
+		Metadata: &YulMetadata{
+			SourceFile:   "imported",
+			CompilerInfo: &CompilerInfo{Version: CompilerVersion, Target: "NeoVM"},
+		},
+	}
+
+	root, ok := d.node("", document)
+	if ok {
+		switch {
+		case root["objects"] != nil && root["nodeType"] == nil:
+			for i, item := range d.array("", root, "objects", true) {
+				if obj := d.object(fmt.Sprintf("/objects/%d", i), item, 0); obj != nil {
+					ast.Objects = append(ast.Objects, obj)
+				}
+			}
+			for i, item := range d.array("", root, "functions", false) {
+				path := fmt.Sprintf("/functions/%d", i)
+				if stmt := d.statement(path, item, 0); stmt != nil {
+					if fn, isFunction := stmt.(*YulFunctionDef); isFunction {
+						ast.Functions = append(ast.Functions, fn)
+					} else {
+						d.issue(path, "expected a function definition")
+					}
+				}
+			}
+		case d.kind(root) == "Object":
+			if obj := d.object("", root, 0); obj != nil {
+				ast.Objects = append(ast.Objects, obj)
+			}
+		case d.kind(root) == "Block":
+			code := d.block("", root, 0)
+			ast.Objects = append(ast.Objects, &YulObject{Name: "Imported", Type: ObjectTypeContract, Code: code})
+		default:
+			d.issue("", "expected a list of objects, an object or a block")
+		}
+	}
+
+	if len(d.issues) > 0 {
+		return nil, &ASTImportError{d.issues}
+	}
+	return ast, nil
+}
+
+// ImportAST is the Parse stage for JSON ASTs produced by other frontends
+func (c *YulToNeoCompiler) ImportAST(data []byte) (*YulAST, error) {
+	ast, err := ImportYulAST(data)
+	if err != nil {
+		return nil, &StageError{"Parsing", "Import error", err}
+	}
+	return ast, nil
+}
+
+// astImporter collects issues while converting decoded JSON to AST nodes
+type astImporter struct {
+	issues []ASTImportIssue
+}
+
+func (d *astImporter) issue(path, format string, args ...interface{}) {
+	d.issues = append(d.issues, ASTImportIssue{path, fmt.Sprintf(format, args...)})
+}
+
+// node asserts that value is a JSON object
+func (d *astImporter) node(path string, value interface{}) (map[string]interface{}, bool) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		d.issue(path, "expected an object, got %s", jsonKind(value))
+	}
+	return m, ok
+}
+
+// kind returns the node type without the "Yul" prefix
+func (d *astImporter) kind(m map[string]interface{}) string {
+	nodeType, _ := m["nodeType"].(string)
+	nodeType = strings.TrimPrefix(nodeType, "Yul")
+	if nodeType == "ForLoop" {
+		return string(NodeTypeFor)
+	}
+	return nodeType
+}
+
+func (d *astImporter) str(path string, m map[string]interface{}, key string, required bool) string {
+	value, present := m[key]
+	if !present {
+		if required {
+			d.issue(path, "missing field %q", key)
+		}
+		return ""
+	}
+	s, ok := value.(string)
+	if !ok {
+		d.issue(path+"/"+key, "expected a string, got %s", jsonKind(value))
+	}
+	return s
+}
+
+func (d *astImporter) array(path string, m map[string]interface{}, key string, required bool) []interface{} {
+	value, present := m[key]
+	if !present || value == nil {
+		if required {
+			d.issue(path, "missing field %q", key)
+		}
+		return nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		d.issue(path+"/"+key, "expected an array, got %s", jsonKind(value))
+	}
+	return items
+}
+
+// location reads the solc "start:length:file" source range
+func (d *astImporter) location(path string, m map[string]interface{}) SourcePosition {
+	src := d.str(path, m, "src", false)
+	if src == "" {
+		return SourcePosition{}
+	}
+	parts := strings.Split(src, ":")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || len(parts) < 2 || len(parts) > 3 {
+			d.issue(path+"/src", "invalid source range %q", src)
+			return SourcePosition{}
+		}
+		numbers[i] = n
+	}
+	position := SourcePosition{Offset: numbers[0], Length: numbers[1]}
+	if len(numbers) == 3 && numbers[2] >= 0 {
+		position.File = strconv.Itoa(numbers[2])
+	}
+	return position
+}
+
+func (d *astImporter) object(path string, value interface{}, depth int) *YulObject {
+	m, ok := d.node(path, value)
+	if !ok {
+		return nil
+	}
+	if kind := d.kind(m); kind != "Object" {
+		d.issue(path, "expected an object node, got %q", kind)
+		return nil
+	}
+	obj := &YulObject{
+		Name:    d.str(path, m, "name", true),
+		Type:    ObjectTypeContract,
+		Objects: NewOrderedMap[*YulObject](),
+	}
+	if code, present := m["code"]; present {
+		obj.Code = d.block(path+"/code", code, depth+1)
+	} else {
+		d.issue(path, "missing field %q", "code")
+	}
+	for i, item := range d.array(path, m, "objects", false) {
+		if nested := d.object(fmt.Sprintf("%s/objects/%d", path, i), item, depth+1); nested != nil {
+			nested.Type = ObjectTypeRuntime
+			obj.Objects.Set(nested.Name, nested)
+		}
+	}
+	return obj
+}
+
+func (d *astImporter) block(path string, value interface{}, depth int) *YulBlock {
+	m, ok := d.node(path, value)
+	if !ok {
+		return nil
+	}
+	if depth > maxImportDepth {
+		d.issue(path, "nesting deeper than %d levels", maxImportDepth)
+		return nil
+	}
+	if kind := d.kind(m); kind != "Block" {
+		d.issue(path, "expected a block, got %q", kind)
+		return nil
+	}
+	block := &YulBlock{Location: d.location(path, m), Statements: []YulStatement{}}
+	for i, item := range d.array(path, m, "statements", true) {
+		if stmt := d.statement(fmt.Sprintf("%s/statements/%d", path, i), item, depth+1); stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+	}
+	return block
+}
+
+// optionalBlock reads an optional block field, defaulting to an empty block
+func (d *astImporter) optionalBlock(path string, m map[string]interface{}, key string, depth int) *YulBlock {
+	value, present := m[key]
+	if !present || value == nil {
+		return &YulBlock{Statements: []YulStatement{}}
+	}
+	return d.block(path+"/"+key, value, depth)
+}
+
+func (d *astImporter) requiredBlock(path string, m map[string]interface{}, key string, depth int) *YulBlock {
+	value, present := m[key]
+	if !present {
+		d.issue(path, "missing field %q", key)
+		return nil
+	}
+	return d.block(path+"/"+key, value, depth)
+}
+
+func (d *astImporter) statement(path string, value interface{}, depth int) YulStatement {
+	m, ok := d.node(path, value)
+	if !ok {
+		return nil
+	}
+	if depth > maxImportDepth {
+		d.issue(path, "nesting deeper than %d levels", maxImportDepth)
+		return nil
+	}
+	location := d.location(path, m)
+
+	switch kind := d.kind(m); YulNodeType(kind) {
+	case NodeTypeBlock:
+		return d.block(path, m, depth)
+	case NodeTypeExpressionStatement:
+		return &YulExpressionStatement{Expression: d.requiredExpression(path, m, "expression", depth), Location: location}
+	case NodeTypeVariableDeclaration:
+		decl := &YulVariableDeclaration{Location: location}
+		for i, item := range d.array(path, m, "variables", true) {
+			if name := d.typedName(fmt.Sprintf("%s/variables/%d", path, i), item); name != nil {
+				decl.Variables = append(decl.Variables, name)
+			}
+		}
+		if len(decl.Variables) == 0 {
+			d.issue(path, "declaration without variables")
+		}
+		if v, present := m["value"]; present && v != nil {
+			decl.Value = d.expression(path+"/value", v, depth+1)
+		}
+		return decl
+	case NodeTypeAssignment:
+		assign := &YulAssignment{Location: location, Value: d.requiredExpression(path, m, "value", depth)}
+		for i, item := range d.array(path, m, "variableNames", true) {
+			itemPath := fmt.Sprintf("%s/variableNames/%d", path, i)
+			if name, isString := item.(string); isString {
+				assign.VariableNames = append(assign.VariableNames, name)
+			} else if id := d.identifier(itemPath, item); id != nil {
+				assign.VariableNames = append(assign.VariableNames, id.Name)
+			}
+		}
+		if len(assign.VariableNames) == 0 {
+			d.issue(path, "assignment without variables")
+		}
+		return assign
+	case NodeTypeIf:
+		return &YulIf{
+			Condition: d.requiredExpression(path, m, "condition", depth),
+			Body:      d.requiredBlock(path, m, "body", depth+1),
+			Location:  location,
+		}
+	case NodeTypeSwitch:
+		sw := &YulSwitch{Expression: d.requiredExpression(path, m, "expression", depth), Location: location}
+		for i, item := range d.array(path, m, "cases", true) {
+			d.switchCase(fmt.Sprintf("%s/cases/%d", path, i), item, sw, depth+1)
+		}
+		return sw
+	case NodeTypeFor:
+		return &YulFor{
+			Init:      d.optionalBlock(path, m, "pre", depth+1),
+			Condition: d.requiredExpression(path, m, "condition", depth),
+			Post:      d.optionalBlock(path, m, "post", depth+1),
+			Body:      d.requiredBlock(path, m, "body", depth+1),
+			Location:  location,
+		}
+	case NodeTypeFunctionDef:
+		fn := &YulFunctionDef{
+			Name:     d.str(path, m, "name", true),
+			Body:     d.requiredBlock(path, m, "body", depth+1),
+			Location: location,
+		}
+		for i, item := range d.array(path, m, "parameters", false) {
+			if name := d.typedName(fmt.Sprintf("%s/parameters/%d", path, i), item); name != nil {
+				fn.Parameters = append(fn.Parameters, name)
+			}
+		}
+		for i, item := range d.array(path, m, "returnVariables", false) {
+			if name := d.typedName(fmt.Sprintf("%s/returnVariables/%d", path, i), item); name != nil {
+				fn.Returns = append(fn.Returns, name)
+			}
+		}
+		return fn
+	case NodeTypeBreak:
+		return &YulBreak{Location: location}
+	case NodeTypeContinue:
+		return &YulContinue{Location: location}
+	case NodeTypeLeave:
+		return &YulLeave{Location: location}
+	case "":
+		d.issue(path, "missing field %q", "nodeType")
+	default:
+		d.issue(path+"/nodeType", "unknown statement type %q", m["nodeType"])
+	}
+	return nil
+}
+
+func (d *astImporter) switchCase(path string, value interface{}, sw *YulSwitch, depth int) {
+	m, ok := d.node(path, value)
+	if !ok {
+		return
+	}
+	body := d.requiredBlock(path, m, "body", depth+1)
+	caseValue, present := m["value"]
+	if !present {
+		d.issue(path, "missing field %q", "value")
+		return
+	}
+	if caseValue == "default" {
+		if sw.Default != nil {
+			d.issue(path, "duplicate default case")
+		}
+		sw.Default = body
+		return
+	}
+	expr := d.expression(path+"/value", caseValue, depth+1)
+	lit, isLiteral := expr.(*YulLiteral)
+	if expr != nil && !isLiteral {
+		d.issue(path+"/value", "case value must be a literal")
+		return
+	}
+	if lit != nil {
+		sw.Cases = append(sw.Cases, &YulCase{Value: *lit, Body: body, Location: d.location(path, m)})
+	}
+}
+
+func (d *astImporter) requiredExpression(path string, m map[string]interface{}, key string, depth int) YulExpression {
+	value, present := m[key]
+	if !present || value == nil {
+		d.issue(path, "missing field %q", key)
+		return nil
+	}
+	return d.expression(path+"/"+key, value, depth+1)
+}
+
+func (d *astImporter) expression(path string, value interface{}, depth int) YulExpression {
+	m, ok := d.node(path, value)
+	if !ok {
+		return nil
+	}
+	if depth > maxImportDepth {
+		d.issue(path, "nesting deeper than %d levels", maxImportDepth)
+		return nil
+	}
+
+	switch kind := d.kind(m); YulNodeType(kind) {
+	case NodeTypeFunctionCall:
+		call := &YulFunctionCall{Location: d.location(path, m), ResultType: DataTypeUint256}
+		if name, present := m["functionName"]; present {
+			if id := d.identifier(path+"/functionName", name); id != nil {
+				call.FunctionName = *id
+			}
+		} else {
+			d.issue(path, "missing field %q", "functionName")
+		}
+		for i, item := range d.array(path, m, "arguments", true) {
+			if arg := d.expression(fmt.Sprintf("%s/arguments/%d", path, i), item, depth+1); arg != nil {
+				call.Arguments = append(call.Arguments, arg)
+			}
+		}
+		return call
+	case NodeTypeIdentifier:
+		if id := d.identifier(path, m); id != nil {
+			return id
+		}
+	case NodeTypeLiteral:
+		return d.literal(path, m)
+	case "":
+		d.issue(path, "missing field %q", "nodeType")
+	default:
+		d.issue(path+"/nodeType", "unknown expression type %q", m["nodeType"])
+	}
+	return nil
+}
+
+func (d *astImporter) identifier(path string, value interface{}) *YulIdentifier {
+	m, ok := d.node(path, value)
+	if !ok {
+		return nil
+	}
+	name := d.str(path, m, "name", true)
+	if name == "" {
+		if _, present := m["name"]; present {
+			d.issue(path+"/name", "identifier is empty")
+		}
+		return nil
+	}
+	return &YulIdentifier{Name: name, Location: d.location(path, m)}
+}
+
+// literalTypes are the default types of literals by kind
+var literalTypes = map[YulLiteralKind]YulDataType{
+	LiteralKindNumber: DataTypeUint256,
+	LiteralKindString: DataTypeString,
+	LiteralKindBool:   DataTypeBool,
+	LiteralKindHex:    DataTypeBytes32,
+}
+
+func (d *astImporter) literal(path string, m map[string]interface{}) *YulLiteral {
+	lit := &YulLiteral{
+		Kind:     YulLiteralKind(d.str(path, m, "kind", true)),
+		Value:    d.str(path, m, "value", true),
+		Location: d.location(path, m),
+	}
+	defaultType, known := literalTypes[lit.Kind]
+	if !known {
+		if lit.Kind != "" {
+			d.issue(path+"/kind", "unknown literal kind %q", lit.Kind)
+		}
+		return nil
+	}
+	lit.Type = defaultType
+	if typeName := d.str(path, m, "type", false); typeName != "" {
+		dataType, err := ParseYulType(typeName)
+		if err != nil {
+			d.issue(path+"/type", "%v", err)
+		}
+		lit.Type = dataType
+	}
+
+	switch lit.Kind {
+	case LiteralKindNumber, LiteralKindHex:
+		if _, err := ParseYulLiteralValue(lit); err != nil {
+			d.issue(path+"/value", "%v", err)
+		}
+	case LiteralKindBool:
+		if lit.Value != "true" && lit.Value != "false" {
+			d.issue(path+"/value", "bool literal must be true or false, got %q", lit.Value)
+		}
+	}
+	return lit
+}
+
+func (d *astImporter) typedName(path string, value interface{}) *YulTypedName {
+	m, ok := d.node(path, value)
+	if !ok {
+		return nil
+	}
+	name := &YulTypedName{Name: d.str(path, m, "name", true), Type: DataTypeUint256, Location: d.location(path, m)}
+	if name.Name == "" {
+		return nil
+	}
+	if typeName := d.str(path, m, "type", false); typeName != "" {
+		dataType, err := ParseYulType(typeName)
+		if err != nil {
+			d.issue(path+"/type", "%v", err)
+		}
+		name.Type = dataType
+	}
+	return name
+}
+
+// jsonKind names the JSON type of a decoded value for error messages
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// JSON round trip for the Yul AST.
+//
+// Statements and expressions are stored behind interfaces, so every node is
+// encoded with a "node_type" tag naming its YulNodeType. Decoding reads the
+// tag to pick the concrete type. This is the compiler's own format, written by
+// SaveYulAST and read by LoadYulAST; ASTs from other frontends go through
+// ImportYulAST instead.
+
+// nodeTypeKey is the tag field added to every statement and expression
+const nodeTypeKey = "node_type"
+
+// SaveYulAST writes ast as JSON
+func SaveYulAST(w io.Writer, ast *YulAST) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(ast)
+}
+
+// LoadYulAST reads an AST written by SaveYulAST
+func LoadYulAST(r io.Reader) (*YulAST, error) {
+	var ast YulAST
+	if err := json.NewDecoder(r).Decode(&ast); err != nil {
+		return nil, fmt.Errorf("loading AST: %w", err)
+	}
+	return &ast, nil
+}
+
+// marshalTagged encodes node, which must encode as a JSON object, with its
+// node_type as the first member
+func marshalTagged(nodeType YulNodeType, node interface{}) ([]byte, error) {
+	fields, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := json.Marshal(nodeType)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"` + nodeTypeKey + `":`)
+	buf.Write(tag)
+	if len(fields) > 2 {
+		buf.WriteByte(',')
+	}
+	buf.Write(fields[1:])
+	return buf.Bytes(), nil
+}
+
+// Marshalling. Each method converts to a method-less copy of its type so
+// encoding does not recurse.
+
+func (b YulBlock) MarshalJSON() ([]byte, error) {
+	type plain YulBlock
+	return marshalTagged(NodeTypeBlock, (*plain)(&b))
+}
+
+func (s YulExpressionStatement) MarshalJSON() ([]byte, error) {
+	type plain YulExpressionStatement
+	return marshalTagged(NodeTypeExpressionStatement, (*plain)(&s))
+}
+
+func (s YulVariableDeclaration) MarshalJSON() ([]byte, error) {
+	type plain YulVariableDeclaration
+	return marshalTagged(NodeTypeVariableDeclaration, (*plain)(&s))
+}
+
+func (s YulAssignment) MarshalJSON() ([]byte, error) {
+	type plain YulAssignment
+	return marshalTagged(NodeTypeAssignment, (*plain)(&s))
+}
+
+func (s YulIf) MarshalJSON() ([]byte, error) {
+	type plain YulIf
+	return marshalTagged(NodeTypeIf, (*plain)(&s))
+}
+
+func (s YulSwitch) MarshalJSON() ([]byte, error) {
+	type plain YulSwitch
+	return marshalTagged(NodeTypeSwitch, (*plain)(&s))
+}
+
+func (s YulFor) MarshalJSON() ([]byte, error) {
+	type plain YulFor
+	return marshalTagged(NodeTypeFor, (*plain)(&s))
+}
+
+func (s YulFunctionDef) MarshalJSON() ([]byte, error) {
+	type plain YulFunctionDef
+	return marshalTagged(NodeTypeFunctionDef, (*plain)(&s))
+}
+
+func (s YulBreak) MarshalJSON() ([]byte, error) {
+	type plain YulBreak
+	return marshalTagged(NodeTypeBreak, (*plain)(&s))
+}
+
+func (s YulContinue) MarshalJSON() ([]byte, error) {
+	type plain YulContinue
+	return marshalTagged(NodeTypeContinue, (*plain)(&s))
+}
+
+func (s YulLeave) MarshalJSON() ([]byte, error) {
+	type plain YulLeave
+	return marshalTagged(NodeTypeLeave, (*plain)(&s))
+}
+
+func (e YulFunctionCall) MarshalJSON() ([]byte, error) {
+	type plain YulFunctionCall
+	return marshalTagged(NodeTypeFunctionCall, (*plain)(&e))
+}
+
+func (e YulIdentifier) MarshalJSON() ([]byte, error) {
+	type plain YulIdentifier
+	return marshalTagged(NodeTypeIdentifier, (*plain)(&e))
+}
+
+func (e YulLiteral) MarshalJSON() ([]byte, error) {
+	type plain YulLiteral
+	return marshalTagged(NodeTypeLiteral, (*plain)(&e))
+}
+
+// Unmarshalling. Interface-typed fields are shadowed by raw messages and
+// decoded by tag afterwards.
+
+// nodeTypeOf reads the node_type tag of an encoded node
+func nodeTypeOf(data json.RawMessage) (YulNodeType, error) {
+	var tag struct {
+		NodeType YulNodeType `json:"node_type"`
+	}
+	if err := json.Unmarshal(data, &tag); err != nil {
+		return "", err
+	}
+	if tag.NodeType == "" {
+		return "", fmt.Errorf("node without %s", nodeTypeKey)
+	}
+	return tag.NodeType, nil
+}
+
+// isNull reports whether data is absent or JSON null
+func isNull(data json.RawMessage) bool {
+	return len(data) == 0 || string(data) == "null"
+}
+
+func unmarshalStatement(data json.RawMessage) (YulStatement, error) {
+	nodeType, err := nodeTypeOf(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var stmt YulStatement
+	switch nodeType {
+	case NodeTypeBlock:
+		stmt = &YulBlock{}
+	case NodeTypeExpressionStatement:
+		stmt = &YulExpressionStatement{}
+	case NodeTypeVariableDeclaration:
+		stmt = &YulVariableDeclaration{}
+	case NodeTypeAssignment:
+		stmt = &YulAssignment{}
+	case NodeTypeIf:
+		stmt = &YulIf{}
+	case NodeTypeSwitch:
+		stmt = &YulSwitch{}
+	case NodeTypeFor:
+		stmt = &YulFor{}
+	case NodeTypeFunctionDef:
+		stmt = &YulFunctionDef{}
+	case NodeTypeBreak:
+		stmt = &YulBreak{}
+	case NodeTypeContinue:
+		stmt = &YulContinue{}
+	case NodeTypeLeave:
+		stmt = &YulLeave{}
+	default:
+		return nil, fmt.Errorf("unknown statement type %q", nodeType)
+	}
+	if err := json.Unmarshal(data, stmt); err != nil {
+		return nil, fmt.Errorf("%s: %w", nodeType, err)
+	}
+	return stmt, nil
+}
+
+// unmarshalExpression decodes an expression; null decodes to nil
+func unmarshalExpression(data json.RawMessage) (YulExpression, error) {
+	if isNull(data) {
+		return nil, nil
+	}
+	nodeType, err := nodeTypeOf(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var expr YulExpression
+	switch nodeType {
+	case NodeTypeFunctionCall:
+		expr = &YulFunctionCall{}
+	case NodeTypeIdentifier:
+		expr = &YulIdentifier{}
+	case NodeTypeLiteral:
+		expr = &YulLiteral{}
+	default:
+		return nil, fmt.Errorf("unknown expression type %q", nodeType)
+	}
+	if err := json.Unmarshal(data, expr); err != nil {
+		return nil, fmt.Errorf("%s: %w", nodeType, err)
+	}
+	return expr, nil
+}
+
+func (b *YulBlock) UnmarshalJSON(data []byte) error {
+	type plain YulBlock
+	raw := struct {
+		*plain
+		Statements []json.RawMessage `json:"statements"`
+	}{plain: (*plain)(b)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	b.Statements = make([]YulStatement, len(raw.Statements))
+	for i, item := range raw.Statements {
+		stmt, err := unmarshalStatement(item)
+		if err != nil {
+			return fmt.Errorf("statement %d: %w", i, err)
+		}
+		b.Statements[i] = stmt
+	}
+	return nil
+}
+
+func (s *YulExpressionStatement) UnmarshalJSON(data []byte) error {
+	type plain YulExpressionStatement
+	raw := struct {
+		*plain
+		Expression json.RawMessage `json:"expression"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var err error
+	s.Expression, err = unmarshalExpression(raw.Expression)
+	return err
+}
+
+func (s *YulVariableDeclaration) UnmarshalJSON(data []byte) error {
+	type plain YulVariableDeclaration
+	raw := struct {
+		*plain
+		Value json.RawMessage `json:"value"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var err error
+	s.Value, err = unmarshalExpression(raw.Value)
+	return err
+}
+
+func (s *YulAssignment) UnmarshalJSON(data []byte) error {
+	type plain YulAssignment
+	raw := struct {
+		*plain
+		Value json.RawMessage `json:"value"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var err error
+	s.Value, err = unmarshalExpression(raw.Value)
+	return err
+}
+
+func (s *YulIf) UnmarshalJSON(data []byte) error {
+	type plain YulIf
+	raw := struct {
+		*plain
+		Condition json.RawMessage `json:"condition"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var err error
+	s.Condition, err = unmarshalExpression(raw.Condition)
+	return err
+}
+
+func (s *YulSwitch) UnmarshalJSON(data []byte) error {
+	type plain YulSwitch
+	raw := struct {
+		*plain
+		Expression json.RawMessage `json:"expression"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var err error
+	s.Expression, err = unmarshalExpression(raw.Expression)
+	return err
+}
+
+func (s *YulFor) UnmarshalJSON(data []byte) error {
+	type plain YulFor
+	raw := struct {
+		*plain
+		Condition json.RawMessage `json:"condition"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var err error
+	s.Condition, err = unmarshalExpression(raw.Condition)
+	return err
+}
+
+func (e *YulFunctionCall) UnmarshalJSON(data []byte) error {
+	type plain YulFunctionCall
+	raw := struct {
+		*plain
+		Arguments []json.RawMessage `json:"arguments"`
+	}{plain: (*plain)(e)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	e.Arguments = nil
+	if raw.Arguments != nil {
+		e.Arguments = make([]YulExpression, len(raw.Arguments))
+	}
+	for i, item := range raw.Arguments {
+		arg, err := unmarshalExpression(item)
+		if err != nil {
+			return fmt.Errorf("argument %d: %w", i, err)
+		}
+		if arg == nil {
+			return fmt.Errorf("argument %d: missing expression", i)
+		}
+		e.Arguments[i] = arg
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package main
+
+// AST traversal helpers shared by the optimization and analysis passes
+
+// forEachBlock calls fn for every block in the AST, outermost first
+func forEachBlock(ast *YulAST, fn func(*YulBlock)) {
+	for _, obj := range ast.Objects {
+		forEachObjectBlock(obj, fn)
+	}
+	for _, def := range ast.Functions {
+		walkBlock(def.Body, fn)
+	}
+}
+
+func forEachObjectBlock(obj *YulObject, fn func(*YulBlock)) {
+	if obj.Code != nil {
+		walkBlock(obj.Code, fn)
+	}
+	for _, nested := range obj.Objects.Values() {
+		forEachObjectBlock(nested, fn)
+	}
+}
+
+// walkBlock calls fn for block and every block nested inside it
+func walkBlock(block *YulBlock, fn func(*YulBlock)) {
+	if block == nil {
+		return
+	}
+	fn(block)
+	for _, stmt := range block.Statements {
+		for _, nested := range statementBlocks(stmt) {
+			walkBlock(nested, fn)
+		}
+	}
+}
+
+// statementBlocks returns the blocks directly nested in stmt
+func statementBlocks(stmt YulStatement) []*YulBlock {
+	switch s := stmt.(type) {
+	case *YulBlock:
+		return []*YulBlock{s}
+	case *YulIf:
+		return []*YulBlock{s.Body}
+	case *YulSwitch:
+		blocks := make([]*YulBlock, 0, len(s.Cases)+1)
+		for _, c := range s.Cases {
+			blocks = append(blocks, c.Body)
+		}
+		if s.Default != nil {
+			blocks = append(blocks, s.Default)
+		}
+		return blocks
+	case *YulFor:
+		return []*YulBlock{s.Init, s.Body, s.Post}
+	case *YulFunctionDef:
+		return []*YulBlock{s.Body}
+	}
+	return nil
+}
+
+// forEachFunctionDef calls fn for every function definition in the AST
+func forEachFunctionDef(ast *YulAST, fn func(*YulFunctionDef)) {
+	for _, def := range ast.Functions {
+		fn(def)
+	}
+	forEachBlock(ast, func(block *YulBlock) {
+		for _, stmt := range block.Statements {
+			if def, ok := stmt.(*YulFunctionDef); ok {
+				fn(def)
+			}
+		}
+	})
+}
+
+// removeFunctionDefs deletes every nested function definition for which
+// remove returns true
+func removeFunctionDefs(ast *YulAST, remove func(*YulFunctionDef) bool) {
+	kept := ast.Functions[:0]
+	for _, def := range ast.Functions {
+		if !remove(def) {
+			kept = append(kept, def)
+		}
+	}
+	ast.Functions = kept
+
+	forEachBlock(ast, func(block *YulBlock) {
+		statements := block.Statements[:0]
+		for _, stmt := range block.Statements {
+			if def, ok := stmt.(*YulFunctionDef); ok && remove(def) {
+				continue
+			}
+			statements = append(statements, stmt)
+		}
+		block.Statements = statements
+	})
+}
+
+// statementExpressions returns pointers to the root expressions held by stmt
+// so callers can both read and replace them
+func statementExpressions(stmt YulStatement) []*YulExpression {
+	switch s := stmt.(type) {
+	case *YulExpressionStatement:
+		if s.Expression != nil {
+			return []*YulExpression{&s.Expression}
+		}
+	case *YulVariableDeclaration:
+		if s.Value != nil {
+			return []*YulExpression{&s.Value}
+		}
+	case *YulAssignment:
+		return []*YulExpression{&s.Value}
+	case *YulIf:
+		return []*YulExpression{&s.Condition}
+	case *YulSwitch:
+		return []*YulExpression{&s.Expression}
+	case *YulFor:
+		return []*YulExpression{&s.Condition}
+	}
+	return nil
+}
+
+// forEachExpression rewrites every expression in the AST bottom-up: fn sees
+// each node after its arguments have been rewritten and returns the node
+// that should take its place.
+func forEachExpression(ast *YulAST, fn func(YulExpression) YulExpression) {
+	forEachBlock(ast, func(block *YulBlock) {
+		for _, stmt := range block.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				*slot = rewriteExpression(*slot, fn)
+			}
+		}
+	})
+}
+
+// rewriteExpression applies fn to expr and its sub-expressions bottom-up
+func rewriteExpression(expr YulExpression, fn func(YulExpression) YulExpression) YulExpression {
+	if call, ok := expr.(*YulFunctionCall); ok {
+		for i, arg := range call.Arguments {
+			call.Arguments[i] = rewriteExpression(arg, fn)
+		}
+	}
+	return fn(expr)
+}
+
+// walkExpression calls fn for expr and each of its sub-expressions, parents first
+func walkExpression(expr YulExpression, fn func(YulExpression)) {
+	if expr == nil {
+		return
+	}
+	fn(expr)
+	if call, ok := expr.(*YulFunctionCall); ok {
+		for _, arg := range call.Arguments {
+			walkExpression(arg, fn)
+		}
+	}
+}
+
+// cloneExpression returns a deep copy of expr
+func cloneExpression(expr YulExpression) YulExpression {
+	switch e := expr.(type) {
+	case *YulIdentifier:
+		copied := *e
+		return &copied
+	case *YulLiteral:
+		copied := *e
+		return &copied
+	case *YulFunctionCall:
+		copied := *e
+		copied.Arguments = make([]YulExpression, len(e.Arguments))
+		for i, arg := range e.Arguments {
+			copied.Arguments[i] = cloneExpression(arg)
+		}
+		return &copied
+	default:
+		return expr
+	}
+}
+
+// cloneBlock returns a deep copy of block
+func cloneBlock(block *YulBlock) *YulBlock {
+	if block == nil {
+		return nil
+	}
+	copied := &YulBlock{Location: block.Location, Statements: make([]YulStatement, len(block.Statements))}
+	for i, stmt := range block.Statements {
+		copied.Statements[i] = cloneStatement(stmt)
+	}
+	return copied
+}
+
+// cloneStatement returns a deep copy of stmt
+func cloneStatement(stmt YulStatement) YulStatement {
+	switch s := stmt.(type) {
+	case *YulBlock:
+		return cloneBlock(s)
+	case *YulExpressionStatement:
+		copied := *s
+		copied.Expression = cloneExpression(s.Expression)
+		return &copied
+	case *YulVariableDeclaration:
+		copied := *s
+		copied.Variables = cloneTypedNames(s.Variables)
+		if s.Value != nil {
+			copied.Value = cloneExpression(s.Value)
+		}
+		return &copied
+	case *YulAssignment:
+		copied := *s
+		copied.VariableNames = append([]string(nil), s.VariableNames...)
+		copied.Value = cloneExpression(s.Value)
+		return &copied
+	case *YulIf:
+		copied := *s
+		copied.Condition = cloneExpression(s.Condition)
+		copied.Body = cloneBlock(s.Body)
+		return &copied
+	case *YulSwitch:
+		copied := *s
+		copied.Expression = cloneExpression(s.Expression)
+		copied.Cases = make([]*YulCase, len(s.Cases))
+		for i, c := range s.Cases {
+			copiedCase := *c
+			copiedCase.Body = cloneBlock(c.Body)
+			copied.Cases[i] = &copiedCase
+		}
+		copied.Default = cloneBlock(s.Default)
+		return &copied
+	case *YulFor:
+		copied := *s
+		copied.Init = cloneBlock(s.Init)
+		copied.Condition = cloneExpression(s.Condition)
+		copied.Post = cloneBlock(s.Post)
+		copied.Body = cloneBlock(s.Body)
+		return &copied
+	case *YulFunctionDef:
+		copied := *s
+		copied.Parameters = cloneTypedNames(s.Parameters)
+		copied.Returns = cloneTypedNames(s.Returns)
+		copied.Body = cloneBlock(s.Body)
+		return &copied
+	case *YulBreak:
+		copied := *s
+		return &copied
+	case *YulContinue:
+		copied := *s
+		return &copied
+	case *YulLeave:
+		copied := *s
+		return &copied
+	default:
+		return stmt
+	}
+}
+
+func cloneTypedNames(names []*YulTypedName) []*YulTypedName {
+	copied := make([]*YulTypedName, len(names))
+	for i, name := range names {
+		n := *name
+		copied[i] = &n
+	}
+	return copied
+}
@@ -0,0 +1,150 @@
+package main
+
+// Calldata emulation.
+//
+// A Neo contract is invoked with typed arguments, not with the flat byte
+// array the EVM passes. Code that reads calldata is therefore invoked with
+// two arguments, a 4-byte method selector and an array of call arguments,
+// and rebuilds the EVM calldata from them on entry: the selector followed by
+// one ABI-encoded 32-byte word per argument. Integers and booleans encode as
+// their two's complement word, byte strings as the little-endian integer
+// NeoVM converts them to. Dynamic ABI types are not reconstructed.
+//
+// The calldata is kept in a Buffer in a static field after the memory
+// field, so selector dispatch on shr(224, calldataload(0)) and argument
+// reads at 4, 36, ... work unmodified. Reads past the end of calldata yield
+// zero bytes, as in the EVM.
+
+// calldataBuiltins are the built-ins that read calldata
+var calldataBuiltins = map[string]bool{
+	"calldataload": true, "calldatasize": true, "calldatacopy": true,
+}
+
+// Calldata routines, emitted after the memory routines
+const (
+	calldataInit = "calldata_init"
+	calldataLoad = "calldata_load"
+)
+
+// usesCalldata reports whether block, including its functions, calls a
+// calldata built-in
+func usesCalldata(block *YulBlock) bool {
+	used := false
+	walkBlock(block, func(b *YulBlock) {
+		for _, stmt := range b.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(expr YulExpression) {
+					if call, ok := expr.(*YulFunctionCall); ok && calldataBuiltins[call.FunctionName.Name] {
+						used = true
+					}
+				})
+			}
+		}
+	})
+	return used
+}
+
+// emitCalldataInit builds the calldata from the selector and the argument
+// array the script is invoked with
+func (g *CodeGenerator) emitCalldataInit(location SourcePosition) {
+	// The invocation arguments are on the stack at entry
+	g.stackTracker.currentDepth += 2
+	g.emitMemoryCall(calldataInit, 2, 0, location)
+}
+
+// generateCalldataBuiltin emits a calldata built-in with its arguments on
+// the stack, first on top, and reports whether name is one
+func (g *CodeGenerator) generateCalldataBuiltin(name string, location SourcePosition) bool {
+	switch name {
+	case "calldataload":
+		g.emitMemoryCall(calldataLoad, 1, 1, location)
+	case "calldatasize":
+		g.emitInstruction(NewSlotInstruction(LDSFLD, g.memory.calldata), location)
+		g.emitInstruction(NewArithmeticInstruction(SIZE), location)
+	case "calldatacopy":
+		g.emitInstruction(NewSlotInstruction(LDSFLD, g.memory.calldata), location)
+		g.emitInstruction(NewStackInstruction(SWAP), location)
+		g.emitMemoryCall(memoryCopyIn, 4, 0, location)
+	default:
+		return false
+	}
+	return true
+}
+
+// emitCalldataInitRoutine stores selector ++ word(arg) for every argument.
+// Arguments: selector, argument array; local: argument index.
+func (g *CodeGenerator) emitCalldataInitRoutine(location SourcePosition) {
+	c := memoryCode{g, location}
+	loop := g.createUniqueLabel("calldata_init_loop")
+	done := g.createUniqueLabel("calldata_init_done")
+
+	c.arg(0)
+	c.op(NewConvertInstruction(BufferType))
+	c.op(NewSlotInstruction(STSFLD, g.memory.calldata))
+	c.push(0)
+	c.op(NewSlotInstruction(STLOC, 0))
+
+	g.markLabel(loop)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.arg(1)
+	c.arithmetic(SIZE, LT)
+	c.jump(JMPIFNOT, done)
+
+	c.op(NewSlotInstruction(LDSFLD, g.memory.calldata))
+	c.arg(1)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.arithmetic(PICKITEM)
+	c.op(NewConvertInstruction(IntegerType))
+
+	// Encode as in memory_store
+	c.wordBytes()
+	c.arithmetic(CAT)
+	c.op(NewSlotInstruction(STSFLD, g.memory.calldata))
+
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.push(1)
+	c.arithmetic(ADD)
+	c.op(NewSlotInstruction(STLOC, 0))
+	c.jump(JMP, loop)
+	g.markLabel(done)
+}
+
+// emitCalldataLoad reads the word at offset, zero-padded past the end of
+// calldata. Argument: offset; local: number of calldata bytes read.
+func (g *CodeGenerator) emitCalldataLoad(location SourcePosition) {
+	c := memoryCode{g, location}
+	zero := g.createUniqueLabel("calldata_load_zero")
+	done := g.createUniqueLabel("calldata_load_done")
+
+	// available = max(0, min(32, size(calldata) - offset))
+	c.op(NewSlotInstruction(LDSFLD, g.memory.calldata))
+	c.arithmetic(SIZE)
+	c.arg(0)
+	c.arithmetic(SUB)
+	c.push(32)
+	c.arithmetic(MIN)
+	c.push(0)
+	c.arithmetic(MAX)
+	c.op(NewSlotInstruction(STLOC, 0))
+
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.jump(JMPIFNOT, zero)
+	c.op(NewSlotInstruction(LDSFLD, g.memory.calldata))
+	c.arg(0)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.arithmetic(SUBSTR)
+	c.push(32)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.arithmetic(SUB, NEWBUFFER, CAT)
+
+	// Big-endian bytes to an integer, as in memory_load
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(REVERSEITEMS)
+	c.op(NewConvertInstruction(IntegerType))
+	c.jump(JMP, done)
+
+	g.markLabel(zero)
+	g.stackTracker.currentDepth--
+	c.push(0)
+	g.markLabel(done)
+}
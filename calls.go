@@ -0,0 +1,327 @@
+package main
+
+import "fmt"
+
+// External calls.
+//
+// call, staticcall and delegatecall become System.Contract.Call. The input
+// memory range is marshalled the way calldata is unmarshalled on entry: its
+// first 4 bytes are the selector and every following 32 bytes, zero-padded,
+// one integer argument, and the callee's ExternalCallMethod is invoked with
+// the selector and the argument array. The address is the low 160 bits of
+// the target word, taken as the little-endian script hash.
+//
+// The result is kept as the return data: byte strings as they are, other
+// values as a 32-byte word and no result as no data. Up to outSize bytes of
+// it are copied to memory at outOff. A call that faults yields 0 instead of
+// aborting the caller, as in the EVM, with the revert data of the callee,
+// if any, as the return data.
+//
+// NeoVM has neither per-call gas nor attached value, so the gas argument is
+// ignored and a value argument other than 0 draws a warning. delegatecall
+// cannot run the callee in the caller's storage context; it is lowered as
+// call and draws a warning too. Calls to configured libraries go through
+// method tokens.
+
+// ExternalCallMethod is the method external calls invoke
+const ExternalCallMethod = "main"
+
+// Call flags passed to System.Contract.Call
+const (
+	callFlagsAll      = 0x0F
+	callFlagsReadOnly = 0x05 // ReadStates | AllowCall
+)
+
+// Return data routines, emitted after the memory routines
+const (
+	contractCall   = "contract_call"
+	returnDataCopy = "returndata_copy"
+)
+
+// externalCallArguments returns the number of arguments of a call
+// built-in, or -1 when name is not one
+func externalCallArguments(name string) int {
+	switch name {
+	case "call":
+		return 7
+	case "staticcall", "delegatecall":
+		return 6
+	}
+	return -1
+}
+
+// usesReturnData reports whether block, including its functions, makes an
+// external call or reads return data
+func usesReturnData(block *YulBlock) bool {
+	used := false
+	walkBlock(block, func(b *YulBlock) {
+		for _, stmt := range b.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(expr YulExpression) {
+					call, ok := expr.(*YulFunctionCall)
+					if !ok {
+						return
+					}
+					name := call.FunctionName.Name
+					if externalCallArguments(name) >= 0 || name == "returndatasize" || name == "returndatacopy" {
+						used = true
+					}
+				})
+			}
+		}
+	})
+	return used
+}
+
+// emitReturnDataInit starts with empty return data
+func (g *CodeGenerator) emitReturnDataInit(location SourcePosition) {
+	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(0)), location)
+	g.emitInstruction(NewArithmeticInstruction(NEWBUFFER), location)
+	g.emitInstruction(NewSlotInstruction(STSFLD, g.memory.returnData), location)
+}
+
+// generateExternalCall emits a call built-in with its arguments on the
+// stack, first on top
+func (g *CodeGenerator) generateExternalCall(call *YulFunctionCall) error {
+	name := call.FunctionName.Name
+	want := externalCallArguments(name)
+	if len(call.Arguments) != want {
+		return fmt.Errorf("%s expects %d arguments, got %d at line %d", name, want, len(call.Arguments), call.Location.Line)
+	}
+	location := call.Location
+
+	// Drop the gas, and the value of call
+	g.emitInstruction(NewStackInstruction(DROP), location)
+	flags := callFlagsAll
+	switch name {
+	case "call":
+		if !isZeroLiteral(call.Arguments[2]) {
+			g.warn(fmt.Sprintf("call value is not transferred at line %d", location.Line), location)
+		}
+		g.emitInstruction(NewStackInstruction(NIP), location)
+	case "staticcall":
+		flags = callFlagsReadOnly
+	case "delegatecall":
+		g.warn(fmt.Sprintf("delegatecall runs in the callee's storage context at line %d", location.Line), location)
+	}
+
+	if library, ok := g.staticLibrary(call.Arguments[1]); ok {
+		g.addCallToken(library, flags)
+	}
+	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(flags)), location)
+	g.emitMemoryCall(contractCall, 6, 1, location)
+	return nil
+}
+
+// isZeroLiteral reports whether expr is a literal 0
+func isZeroLiteral(expr YulExpression) bool {
+	lit, ok := expr.(*YulLiteral)
+	if !ok {
+		return false
+	}
+	value, err := ParseYulLiteralValue(lit)
+	return err == nil && value.Sign() == 0
+}
+
+// warn records a code generation warning
+func (g *CodeGenerator) warn(message string, location SourcePosition) {
+	if g.context == nil || g.context.ErrorCollector == nil {
+		return
+	}
+	g.context.ErrorCollector.AddWarning("Code Generation", message, location.Line, location.Column)
+}
+
+// generateReturnDataBuiltin emits a return data built-in with its
+// arguments on the stack, first on top, and reports whether name is one
+func (g *CodeGenerator) generateReturnDataBuiltin(name string, location SourcePosition) bool {
+	switch name {
+	case "returndatasize":
+		g.emitInstruction(NewSlotInstruction(LDSFLD, g.memory.returnData), location)
+		g.emitInstruction(NewArithmeticInstruction(SIZE), location)
+	case "returndatacopy":
+		g.emitMemoryCall(returnDataCopy, 3, 0, location)
+	default:
+		return false
+	}
+	return true
+}
+
+// emitContractCall calls the contract and returns the success flag.
+// Arguments: flags, address, inOff, inSize, outOff, outSize; locals: input,
+// argument array, input offset, success flag.
+func (g *CodeGenerator) emitContractCall(location SourcePosition) {
+	c := memoryCode{g, location}
+	ld := func(i int) { c.op(NewSlotInstruction(LDLOC, i)) }
+	st := func(i int) { c.op(NewSlotInstruction(STLOC, i)) }
+	loop := g.createUniqueLabel("contract_call_args")
+	packed := g.createUniqueLabel("contract_call_packed")
+	empty := g.createUniqueLabel("contract_call_empty")
+	bytes := g.createUniqueLabel("contract_call_bytes")
+	store := g.createUniqueLabel("contract_call_store")
+	caught := g.createUniqueLabel("contract_call_caught")
+	copied := g.createUniqueLabel("contract_call_copied")
+	thrown := g.createUniqueLabel("contract_call_thrown")
+	reason := g.createUniqueLabel("contract_call_reason")
+	called := g.createUniqueLabel("contract_call_called")
+	g.permit("*", ExternalCallMethod)
+	done := g.createUniqueLabel("contract_call_done")
+
+	g.emitTry(caught, copied, location)
+
+	c.arg(3)
+	c.arg(2)
+	c.call(memorySlice, 2, 1)
+	st(0)
+	c.push(0)
+	c.arithmetic(NEWARRAY)
+	st(1)
+	c.push(4)
+	st(2)
+
+	// One integer per 32 bytes after the selector, as in calldata_load
+	g.markLabel(loop)
+	ld(2)
+	ld(0)
+	c.arithmetic(SIZE, LT)
+	c.jump(JMPIFNOT, packed)
+	ld(1)
+	ld(0)
+	ld(2)
+	ld(0)
+	c.arithmetic(SIZE)
+	ld(2)
+	c.arithmetic(SUB)
+	c.push(32)
+	c.arithmetic(MIN, SUBSTR)
+	c.push(32)
+	ld(0)
+	c.arithmetic(SIZE)
+	ld(2)
+	c.arithmetic(SUB)
+	c.push(32)
+	c.arithmetic(MIN, SUB, NEWBUFFER, CAT)
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(REVERSEITEMS)
+	c.op(NewConvertInstruction(IntegerType))
+	c.arithmetic(APPEND)
+	ld(2)
+	c.push(32)
+	c.arithmetic(ADD)
+	st(2)
+	c.jump(JMP, loop)
+
+	// [selector, arguments]
+	g.markLabel(packed)
+	ld(1)
+	ld(0)
+	ld(0)
+	c.arithmetic(SIZE)
+	c.push(4)
+	c.arithmetic(MIN, LEFT)
+	c.push(2)
+	pack := NewArithmeticInstruction(PACK)
+	pack.StackPop, pack.StackPush = 3, 1
+	c.op(pack)
+
+	g.emitTokenCalls(called, location)
+	c.arg(0)
+	c.op(NewPushInstruction(CreateNeoVMByteString(ExternalCallMethod)))
+	c.arg(1)
+	c.addressScriptHash()
+	c.op(NewSyscallInstruction("System.Contract.Call"))
+	g.markLabel(called)
+
+	// The result as return data
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(ISNULL)
+	c.jump(JMPIF, empty)
+	c.op(NewStackInstruction(DUP))
+	c.op(NewIsTypeInstruction(ByteStringType))
+	c.jump(JMPIF, bytes)
+	c.op(NewStackInstruction(DUP))
+	c.op(NewIsTypeInstruction(BufferType))
+	c.jump(JMPIF, bytes)
+	c.op(NewConvertInstruction(IntegerType))
+	c.wordBytes()
+	c.jump(JMP, store)
+	g.markLabel(empty)
+	c.op(NewStackInstruction(DROP))
+	c.push(0)
+	c.arithmetic(NEWBUFFER)
+	c.jump(JMP, store)
+	g.markLabel(bytes)
+	c.op(NewConvertInstruction(BufferType))
+	g.markLabel(store)
+	c.op(NewSlotInstruction(STSFLD, g.memory.returnData))
+	c.push(1)
+	st(3)
+	c.jump(ENDTRY, copied)
+
+	// Revert data thrown by the callee is the return data
+	g.markLabel(caught)
+	g.stackTracker.currentDepth++ // The exception
+	c.op(NewStackInstruction(DUP))
+	c.op(NewIsTypeInstruction(ArrayType))
+	c.jump(JMPIFNOT, thrown)
+	c.push(1)
+	c.arithmetic(PICKITEM)
+	g.markLabel(thrown)
+	c.op(NewStackInstruction(DUP))
+	c.op(NewIsTypeInstruction(ByteStringType))
+	c.jump(JMPIF, reason)
+	c.op(NewStackInstruction(DUP))
+	c.op(NewIsTypeInstruction(BufferType))
+	c.jump(JMPIF, reason)
+	c.op(NewStackInstruction(DROP))
+	c.push(0)
+	c.arithmetic(NEWBUFFER)
+	g.markLabel(reason)
+	c.op(NewConvertInstruction(BufferType))
+	c.op(NewSlotInstruction(STSFLD, g.memory.returnData))
+	c.push(0)
+	st(3)
+	c.jump(ENDTRY, copied)
+
+	// Memory grows to the whole output range, which receives at most the
+	// return data
+	g.markLabel(copied)
+	c.arg(5)
+	c.jump(JMPIFNOT, done)
+	c.arg(4)
+	c.arg(5)
+	c.arithmetic(ADD)
+	c.expand()
+	c.arg(5)
+	c.op(NewSlotInstruction(LDSFLD, g.memory.returnData))
+	c.arithmetic(SIZE, MIN)
+	c.push(0)
+	c.op(NewSlotInstruction(LDSFLD, g.memory.returnData))
+	c.arg(4)
+	c.call(memoryCopyIn, 4, 0)
+	c.jump(JMP, done)
+
+	g.markLabel(done)
+	ld(3)
+}
+
+// emitReturnDataCopy copies return data to memory, aborting when the range
+// reaches past its end as in the EVM. Arguments: dst, offset, length.
+func (g *CodeGenerator) emitReturnDataCopy(location SourcePosition) {
+	c := memoryCode{g, location}
+	inBounds := g.createUniqueLabel("returndata_in_bounds")
+
+	c.arg(1)
+	c.arg(2)
+	c.arithmetic(ADD)
+	c.op(NewSlotInstruction(LDSFLD, g.memory.returnData))
+	c.arithmetic(SIZE, GT)
+	c.jump(JMPIFNOT, inBounds)
+	c.op(NeoInstruction{Opcode: ABORT, Size: 1})
+	g.markLabel(inBounds)
+
+	c.arg(2)
+	c.arg(1)
+	c.op(NewSlotInstruction(LDSFLD, g.memory.returnData))
+	c.arg(0)
+	c.call(memoryCopyIn, 4, 0)
+}
@@ -0,0 +1,114 @@
+package main
+
+// Call value.
+//
+// Neo attaches no value to a call; a contract is paid by a NEP-17 transfer,
+// which invokes its onNEP17Payment(from, amount, data) method. Scripts that
+// read callvalue() get that method as a second entry point, a shim that
+// runs the top-level code with the amount as the call value when the
+// calling token is GAS, and 0 for any other token. The data of the transfer
+// carries what the script is otherwise invoked with: the array [selector,
+// arguments] when the script reads calldata, and no data for empty
+// calldata. Invoked directly, the script sees a call value of 0.
+//
+// The call value is kept in a static field, stored right after INITSSLOT.
+// ZeroCallValue compiles callvalue() to 0 and drops the shim, for
+// deployments that do not model payments.
+
+// zeroCallValueFlag compiles callvalue to 0
+const zeroCallValueFlag = "--zero-callvalue"
+
+// PaymentMethod is the method NEP-17 transfers invoke on the recipient
+const PaymentMethod = "onNEP17Payment"
+
+// ZeroCallValueRequested reports whether callvalue compiles to 0, through
+// ZeroCallValue or the --zero-callvalue flag
+func ZeroCallValueRequested(config CompilerConfig) bool {
+	return config.ZeroCallValue || flagSet(config.CompilerFlags, zeroCallValueFlag)
+}
+
+// usesCallValue reports whether block, including its functions, reads the
+// call value of a payment
+func (g *CodeGenerator) usesCallValue(block *YulBlock) bool {
+	if g.context != nil && g.context.ZeroCallValue {
+		return false
+	}
+	used := false
+	walkBlock(block, func(b *YulBlock) {
+		for _, stmt := range b.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(expr YulExpression) {
+					if call, ok := expr.(*YulFunctionCall); ok && call.FunctionName.Name == "callvalue" {
+						used = true
+					}
+				})
+			}
+		}
+	})
+	return used
+}
+
+// generateCallValue pushes the call value
+func (g *CodeGenerator) generateCallValue(location SourcePosition) {
+	if g.memory == nil || g.memory.callValue < 0 {
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(0)), location)
+		return
+	}
+	g.emitInstruction(NewSlotInstruction(LDSFLD, g.memory.callValue), location)
+}
+
+// emitPaymentShim emits the onNEP17Payment entry point, which continues at
+// entry with the invocation arguments and the call value on top
+func (g *CodeGenerator) emitPaymentShim(entry string, calldata bool, location SourcePosition) {
+	c := memoryCode{g, location}
+	paid := g.createUniqueLabel("payment_gas")
+	unpack := g.createUniqueLabel("payment_unpack")
+	enter := g.createUniqueLabel("payment_enter")
+
+	g.emitReturnGuard(location)
+	depth := g.stackTracker.currentDepth
+	defer func() { g.stackTracker.currentDepth = depth }()
+
+	// from, amount, data
+	g.stackTracker.currentDepth = 3
+	g.markLabel(PaymentMethod)
+	c.op(NewStackInstruction(DROP))
+	c.syscall("System.Runtime.GetCallingScriptHash")
+	c.op(NewPushInstruction(CreateNeoVMByteString(scriptHashBytes(GASTokenHash))))
+	c.arithmetic(EQUAL)
+	c.jump(JMPIF, paid)
+	c.op(NewStackInstruction(DROP))
+	c.push(0)
+	g.markLabel(paid)
+
+	if !calldata {
+		c.op(NewStackInstruction(NIP))
+		c.jump(JMP, entry)
+		return
+	}
+
+	// data is [selector, arguments], or null for empty calldata
+	c.op(NewStackInstruction(SWAP))
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(ISNULL)
+	c.jump(JMPIFNOT, unpack)
+	c.op(NewStackInstruction(DROP))
+	c.push(0)
+	c.arithmetic(NEWARRAY)
+	c.op(NewPushInstruction(CreateNeoVMByteString("")))
+	c.jump(JMP, enter)
+
+	g.markLabel(unpack)
+	g.stackTracker.currentDepth = 2
+	c.op(NewStackInstruction(DUP))
+	c.push(1)
+	c.arithmetic(PICKITEM)
+	c.op(NewStackInstruction(SWAP))
+	c.push(0)
+	c.arithmetic(PICKITEM)
+
+	// value, arguments, selector to arguments, selector, value
+	g.markLabel(enter)
+	c.op(NewStackInstruction(ROT))
+	c.jump(JMP, entry)
+}
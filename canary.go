@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// Canary mode instruments every sstore in staging builds so that the state
+// changes of a transaction can be read back over RPC and diffed black-box
+// against an expected run. Each write is mirrored to
+//
+//	CanaryStoragePrefix || sha256(txhash || key)  ->  value
+//
+// The hash keeps the entry within NeoVM's 64-byte keys whatever the prefix
+// of the slot key, and CanaryHeadKey is updated to the hash of the last transaction that wrote
+// storage, giving RPC clients a pointer to the most recent changelog. Release
+// builds never contain the instrumentation.
+
+// BuildMode distinguishes pre-production builds from deployable ones
+type BuildMode string
+
+const (
+	BuildRelease BuildMode = "release"
+	BuildStaging BuildMode = "staging"
+)
+
+// Compiler flags controlling canary instrumentation
+const (
+	buildModeFlag = "--build-mode"
+	canaryFlag    = "--canary"
+)
+
+// CanaryStoragePrefix is the reserved key prefix for changelog entries. The
+// leading 0xff byte keeps it out of the range of slot keys, whose storage
+// prefixes never start with it.
+var CanaryStoragePrefix = []byte("\xffcanary/")
+
+// CanaryHeadKey holds the hash of the last transaction with a changelog
+var CanaryHeadKey = append(append([]byte{}, CanaryStoragePrefix...), "head"...)
+
+// ParseBuildMode parses the value of --build-mode
+func ParseBuildMode(value string) (BuildMode, error) {
+	switch BuildMode(strings.ToLower(strings.TrimSpace(value))) {
+	case BuildRelease, "":
+		return BuildRelease, nil
+	case BuildStaging:
+		return BuildStaging, nil
+	default:
+		return "", fmt.Errorf("invalid build mode %q (expected release or staging)", value)
+	}
+}
+
+// BuildModeFromConfig returns the build mode of a configuration. A
+// --build-mode flag in CompilerFlags takes precedence over BuildMode.
+func BuildModeFromConfig(config CompilerConfig) (BuildMode, error) {
+	return ParseBuildMode(flagValue(config.CompilerFlags, buildModeFlag, config.BuildMode))
+}
+
+// CanaryRequested reports whether the configuration asks for canary mode,
+// through CanaryMode or the --canary flag
+func CanaryRequested(config CompilerConfig) bool {
+	return config.CanaryMode || flagSet(config.CompilerFlags, canaryFlag)
+}
+
+// CanaryChangelogKey returns the storage key under which a write to key in
+// the transaction txHash is recorded
+func CanaryChangelogKey(txHash, key []byte) []byte {
+	digest := sha256.Sum256(append(append([]byte{}, txHash...), key...))
+	result := make([]byte, 0, len(CanaryStoragePrefix)+len(digest))
+	result = append(result, CanaryStoragePrefix...)
+	return append(result, digest[:]...)
+}
+
+// emitCanaryRecord records a pending write in the changelog. It expects the
+// value and the storage key of the write on top of the stack, key topmost.
+func (g *CodeGenerator) emitCanaryRecord(location SourcePosition) {
+	// key -> prefix || sha256(txhash || key)
+	g.emitTransactionHash(location)
+	g.emitInstruction(NewStackInstruction(SWAP), location)
+	g.emitInstruction(NewArithmeticInstruction(CAT), location)
+	memoryCode{g, location}.callNative(CryptoLibHash, "sha256", 1, 0)
+	g.emitInstruction(NewPushInstruction(CreateNeoVMByteString(CanaryStoragePrefix)), location)
+	g.emitInstruction(NewStackInstruction(SWAP), location)
+	g.emitInstruction(NewArithmeticInstruction(CAT), location)
+	g.emitStorageContext(location)
+	g.emitInstruction(NewSyscallInstruction("System.Storage.Put"), location)
+
+	// Point the head key at this transaction
+	g.emitTransactionHash(location)
+	g.emitInstruction(NewPushInstruction(CreateNeoVMByteString(CanaryHeadKey)), location)
+	g.emitStorageContext(location)
+	g.emitInstruction(NewSyscallInstruction("System.Storage.Put"), location)
+}
+
+// emitTransactionHash pushes the hash of the executing transaction
+func (g *CodeGenerator) emitTransactionHash(location SourcePosition) {
+	g.emitInstruction(NewSyscallInstruction("System.Runtime.GetScriptContainer"), location)
+	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(0)), location)
+	g.emitInstruction(NewArithmeticInstruction(PICKITEM), location)
+}
+
+// canaryEnabled reports whether sstore instrumentation is active for this build
+func (g *CodeGenerator) canaryEnabled() bool {
+	return g.context != nil && g.context.CanaryTracking
+}
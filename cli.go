@@ -0,0 +1,587 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Bulk compilation from the command line:
+//
+//	compile [flags] ./contracts/**/*.yul
+//	neo-yulc [flags] ./contracts/**/*.yul
+//
+// Patterns may use "**" to match any number of directories; a directory
+// argument compiles every .yul file below it. Files are compiled by a pool
+// of workers sharing one cache, so identical sources compile once. A status
+// table is printed and the exit code is non-zero only when a file ends with
+// one of the severities given to -fail-on. --gas-report adds the execution
+// fees of every function and switch case of each file. With -o, the NEF,
+// manifest, debug information and disassembly of every contract are
+// written to the output directory. -format json or sarif prints the
+// diagnostics of every file, see Diagnostic, instead of the table.
+// -warn-as-error and -diagnostic code=level set what becomes of warnings,
+// see DiagnosticLevel. Flags set the fields of CompilerConfig; -flag
+// passes compiler flags for the fields that have one.
+// --standard-json switches to the solc standard JSON interface instead.
+// Solidity files named explicitly are compiled through solc, see
+// SolidityFrontend.
+
+// File statuses, from best to worst
+const (
+	BulkStatusOK      = "ok"
+	BulkStatusWarning = "warning"
+	BulkStatusError   = "error"
+)
+
+// Exit codes of the compile command
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+// BulkCompileOptions configures a bulk compilation
+type BulkCompileOptions struct {
+	Config    CompilerConfig
+	Workers   int    // Parallel compilations, runtime.NumCPU() when zero
+	OutputDir string // Directory for contract artifacts, none when empty
+	Solc      string // solc executable for .sol files, DefaultSolc when empty
+}
+
+// BulkFileResult is the outcome of compiling one file
+type BulkFileResult struct {
+	Path        string
+	Status      string
+	Warnings    int
+	Errors      int
+	Size        int  // Runtime script size in bytes
+	Cached      bool // Result reused from an identical source
+	Duration    time.Duration
+	Message     string       // First error, if any
+	Gas         *GasReport   // Execution fees, nil when compilation failed
+	Diagnostics []Diagnostic // Errors and warnings, located in the file
+}
+
+// BulkReport collects the results of a bulk compilation in input order
+type BulkReport struct {
+	Files []BulkFileResult
+}
+
+// compileCache shares compilation results between workers, keyed by source
+// hash. The first worker to see a source compiles it; others wait for it.
+type compileCache struct {
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*cacheEntry
+}
+
+type cacheEntry struct {
+	once   sync.Once
+	result *CompilationResult
+	err    error
+}
+
+func newCompileCache() *compileCache {
+	return &compileCache{entries: make(map[[sha256.Size]byte]*cacheEntry)}
+}
+
+// get returns the result for source, compiling it at most once. cached is
+// true when another call produced the result.
+func (c *compileCache) get(source []byte, compile func() (*CompilationResult, error)) (result *CompilationResult, cached bool, err error) {
+	key := sha256.Sum256(source)
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cacheEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	cached = true
+	entry.once.Do(func() {
+		cached = false
+		entry.result, entry.err = compile()
+	})
+	return entry.result, cached, entry.err
+}
+
+// ExpandPatterns resolves file arguments to a sorted list of files without
+// duplicates. Patterns match with filepath.Match per path segment, plus "**"
+// for any number of directories.
+func ExpandPatterns(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := expandPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func expandPattern(pattern string) ([]string, error) {
+	pattern = filepath.Clean(pattern)
+	if !hasGlobMeta(pattern) {
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return []string{pattern}, nil
+		}
+		pattern = filepath.Join(pattern, "**", "*.yul")
+	}
+
+	segments := strings.Split(pattern, string(filepath.Separator))
+	for _, segment := range segments {
+		if _, err := filepath.Match(segment, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+	}
+
+	// Walk from the longest prefix without wildcards
+	fixed := 0
+	for fixed < len(segments) && !hasGlobMeta(segments[fixed]) {
+		fixed++
+	}
+	root := strings.Join(segments[:fixed], string(filepath.Separator))
+	if root == "" {
+		root = "."
+		if filepath.IsAbs(pattern) {
+			root = string(filepath.Separator)
+		}
+	}
+
+	var matches []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if matchSegments(segments, strings.Split(path, string(filepath.Separator))) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return matches, err
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// matchSegments matches path segments against pattern segments, where "**"
+// matches zero or more segments
+func matchSegments(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		return matchSegments(pattern[1:], path) || (len(path) > 0 && matchSegments(pattern, path[1:]))
+	}
+	if len(path) == 0 {
+		return false
+	}
+	ok, _ := filepath.Match(pattern[0], path[0])
+	return ok && matchSegments(pattern[1:], path[1:])
+}
+
+// BulkCompile compiles files in parallel. Every file gets its own compiler,
+// so results do not depend on the order the workers pick files up.
+func BulkCompile(files []string, options BulkCompileOptions) *BulkReport {
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	report := &BulkReport{Files: make([]BulkFileResult, len(files))}
+	cache := newCompileCache()
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				report.Files[i] = compileFile(files[i], options, cache)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return report
+}
+
+func compileFile(path string, options BulkCompileOptions, cache *compileCache) BulkFileResult {
+	if filepath.Ext(path) == ".sol" {
+		return compileSolidityFile(path, options)
+	}
+	start := time.Now()
+	file := BulkFileResult{Path: path}
+	fail := func(err error) BulkFileResult {
+		file.Status = BulkStatusError
+		if !file.hasErrorDiagnostic() {
+			file.addDiagnostic(Diagnostic{Code: CodeUnknown, Severity: SeverityError, Message: err.Error()})
+		}
+		file.Errors++
+		file.Message = err.Error()
+		file.Duration = time.Since(start)
+		return file
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return fail(err)
+	}
+	result, cached, err := cache.get(source, func() (result *CompilationResult, err error) {
+		// One bad file must not take down the rest of the batch
+		defer func() {
+			if r := recover(); r != nil {
+				result, err = nil, fmt.Errorf("compiler panic: %v", r)
+			}
+		}()
+		return NewYulToNeoCompiler(options.Config).Compile(string(source))
+	})
+	file.Cached = cached
+	if result != nil {
+		file.Warnings = len(result.Warnings)
+		file.Errors = len(result.Errors)
+		if len(result.Errors) > 0 {
+			file.Message = result.Errors[0].Message
+		}
+		for _, d := range result.Diagnostics() {
+			file.addDiagnostic(d)
+		}
+	}
+	if err != nil {
+		file.Errors = 0
+		return fail(err)
+	}
+	file.Gas = result.GasReport
+	if result.Contract != nil {
+		for _, instr := range result.Contract.Runtime {
+			file.Size += instr.Size
+		}
+	}
+	if options.OutputDir != "" && result.Contract != nil {
+		if _, err := WriteArtifacts(options.OutputDir, path, result); err != nil {
+			return fail(err)
+		}
+	}
+
+	return file.finish(start)
+}
+
+// compileSolidityFile compiles the contracts of a Solidity file through
+// solc. Their artifacts are named after the contracts.
+func compileSolidityFile(path string, options BulkCompileOptions) BulkFileResult {
+	start := time.Now()
+	file := BulkFileResult{Path: path}
+	frontend := &SolidityFrontend{Solc: options.Solc, Config: options.Config}
+	result, err := frontend.CompileFiles([]string{path})
+	if err != nil {
+		file.Errors++
+		file.Message = err.Error()
+		file.addDiagnostic(Diagnostic{Code: CodeUnknown, Severity: SeverityError, Message: err.Error()})
+		return file.finish(start)
+	}
+	for _, diagnostic := range result.Diagnostics {
+		file.addDiagnostic(diagnostic.Diagnostic())
+		switch diagnostic.Severity {
+		case "error":
+			if file.Errors == 0 {
+				file.Message = diagnostic.FormattedMessage
+			}
+			file.Errors++
+		case "warning":
+			file.Warnings++
+		}
+	}
+	for _, contract := range result.Contracts {
+		if contract.Result == nil || contract.Result.Contract == nil {
+			continue
+		}
+		for _, instr := range contract.Result.Contract.Runtime {
+			file.Size += instr.Size
+		}
+		if len(result.Contracts) == 1 {
+			file.Gas = contract.Result.GasReport
+		}
+		if options.OutputDir != "" {
+			name := filepath.Join(filepath.Dir(path), contract.Name+".sol")
+			if _, err := WriteArtifacts(options.OutputDir, name, contract.Result); err != nil {
+				file.Errors++
+				file.Message = err.Error()
+				file.addDiagnostic(Diagnostic{Code: CodeUnknown, Severity: SeverityError, Message: err.Error()})
+			}
+		}
+	}
+	return file.finish(start)
+}
+
+// addDiagnostic records d, located in the file unless it names another
+func (file *BulkFileResult) addDiagnostic(d Diagnostic) {
+	if d.Range.File == "" {
+		d.Range.File = file.Path
+	}
+	// Results are shared by the files of identical sources
+	d.Related = append([]DiagnosticNote(nil), d.Related...)
+	for i := range d.Related {
+		if d.Related[i].Range.File == "" {
+			d.Related[i].Range.File = file.Path
+		}
+	}
+	file.Diagnostics = append(file.Diagnostics, d)
+}
+
+// hasErrorDiagnostic reports whether an error of the file is recorded
+func (file *BulkFileResult) hasErrorDiagnostic() bool {
+	for _, d := range file.Diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// finish sets the status of a file from its counts, and its duration
+func (file BulkFileResult) finish(start time.Time) BulkFileResult {
+	file.Status = BulkStatusOK
+	if file.Errors > 0 {
+		file.Status = BulkStatusError
+	} else if file.Warnings > 0 {
+		file.Status = BulkStatusWarning
+	}
+	file.Duration = time.Since(start)
+	return file
+}
+
+// Count returns the number of files with the given status
+func (r *BulkReport) Count(status string) int {
+	count := 0
+	for _, file := range r.Files {
+		if file.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// ExitCode is non-zero when any file ended with one of the failOn statuses
+func (r *BulkReport) ExitCode(failOn []string) int {
+	for _, status := range failOn {
+		if r.Count(status) > 0 {
+			return exitFailed
+		}
+	}
+	return exitOK
+}
+
+// WriteTable prints the per-file status table and a summary line
+func (r *BulkReport) WriteTable(w io.Writer) {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "FILE\tSTATUS\tWARNINGS\tERRORS\tSIZE\tTIME\tMESSAGE")
+	for _, file := range r.Files {
+		elapsed := file.Duration.Round(time.Millisecond).String()
+		if file.Cached {
+			elapsed = "cached"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			file.Path, file.Status, file.Warnings, file.Errors, file.Size, elapsed, file.Message)
+	}
+	table.Flush()
+	fmt.Fprintf(w, "\n%d files: %d ok, %d with warnings, %d failed\n",
+		len(r.Files), r.Count(BulkStatusOK), r.Count(BulkStatusWarning), r.Count(BulkStatusError))
+}
+
+// Diagnostics returns the diagnostics of every file, in input order
+func (r *BulkReport) Diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, file := range r.Files {
+		diagnostics = append(diagnostics, file.Diagnostics...)
+	}
+	return diagnostics
+}
+
+// WriteGasReports prints the gas report of every compiled file, in
+// datoshi
+func (r *BulkReport) WriteGasReports(w io.Writer) {
+	for _, file := range r.Files {
+		if file.Gas == nil {
+			continue
+		}
+		fmt.Fprintf(w, "\nGas report for %s (datoshi)\n", file.Path)
+		file.Gas.WriteTable(w)
+	}
+}
+
+// ParseFailOn parses the -fail-on list; "none" never fails
+func ParseFailOn(value string) ([]string, error) {
+	var statuses []string
+	for _, item := range strings.Split(value, ",") {
+		switch item = strings.ToLower(strings.TrimSpace(item)); item {
+		case "none", "":
+		case BulkStatusError, BulkStatusWarning:
+			statuses = append(statuses, item)
+		default:
+			return nil, fmt.Errorf("invalid severity %q (expected error, warning or none)", item)
+		}
+	}
+	return statuses, nil
+}
+
+// RunCompileCommand runs "compile" with the given arguments and returns the
+// process exit code
+func RunCompileCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("compile", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	level := flags.Int("O", 2, "optimization level (0-3)")
+	workers := flags.Int("j", runtime.NumCPU(), "number of parallel workers")
+	outputDir := flags.String("o", "", "write contract artifacts to this directory")
+	failOn := flags.String("fail-on", BulkStatusError, "comma-separated severities that fail the run: error, warning or none")
+	verbose := flags.Bool("v", false, "show compiler progress logs")
+	gasReport := flags.Bool("gas-report", false, "print the execution fees of every function and switch case")
+	solc := flags.String("solc", DefaultSolc, "solc executable that compiles .sol files to Yul")
+	standardJSON := flags.Bool("standard-json", false, "read solc standard JSON input from stdin, or the file argument, and write standard JSON output")
+	target := flags.String("target", "", "NeoVM version to target, e.g. 3.6")
+	debug := flags.Bool("debug", false, "generate debug information")
+	boundsChecking := flags.Bool("bounds-checking", false, "insert runtime bounds checks")
+	maxStackDepth := flags.Int("max-stack-depth", 0, "maximum stack depth, 0 for the NeoVM limit")
+	memoryLimit := flags.Int64("memory-limit", 0, "memory usage limit in bytes")
+	dialect := flags.String("dialect", DefaultDialect, "Yul dialect: an EVM version such as shanghai or cancun, or neo")
+	format := flags.String("format", "table", "output: a status table, or the diagnostics as json or sarif")
+	warnAsError := flags.Bool("warn-as-error", false, "treat warnings as errors")
+	list := func(name, usage string) *[]string {
+		var values []string
+		flags.Func(name, usage+" (repeatable)", func(value string) error {
+			values = append(values, value)
+			return nil
+		})
+		return &values
+	}
+	compilerFlags := list("flag", "compiler flag such as --optimize-for=size")
+	exports := list("export", "Yul function exposed as a contract method")
+	views := list("view", "Yul function that must not change state")
+	permissions := list("permission", "call permitted beyond those the script makes, contract[:method,...] or *")
+	trusts := list("trust", "contract or group trusted to call with all flags, or *")
+	standards := list("supported-standard", "standard declared in the manifest, e.g. NEP-17")
+	libraries := list("library", "deployed contract called through CALLT, name=hash")
+	registry := list("address-registry", "EVM address of a Neo account for the registry strategy, address=hash")
+	levels := list("diagnostic", "level of a diagnostic code or name, code=off, code=warning or code=error")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: compile [flags] <file|dir|pattern>...")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if !*verbose {
+		defer log.SetOutput(log.Writer())
+		log.SetOutput(io.Discard)
+	}
+	if *standardJSON {
+		if flags.NArg() == 0 {
+			return RunStandardJSON(os.Stdin, stdout)
+		}
+		input, err := os.Open(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+		defer input.Close()
+		return RunStandardJSON(input, stdout)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	failStatuses, err := ParseFailOn(*failOn)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	switch *format {
+	case "table", "json", "sarif":
+	default:
+		fmt.Fprintf(stderr, "invalid format %q (expected table, json or sarif)\n", *format)
+		return exitUsage
+	}
+	files, err := ExpandPatterns(flags.Args())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	report := BulkCompile(files, BulkCompileOptions{
+		Config: CompilerConfig{
+			OptimizationLevel:    *level,
+			TargetNeoVMVersion:   *target,
+			EnableBoundsChecking: *boundsChecking,
+			EnableDebugInfo:      *debug,
+			MaxStackDepth:        *maxStackDepth,
+			MemoryLimit:          *memoryLimit,
+			Dialect:              *dialect,
+			ExportFunctions:      *exports,
+			ViewFunctions:        *views,
+			Permissions:          *permissions,
+			Trusts:               *trusts,
+			SupportedStandards:   *standards,
+			Libraries:            *libraries,
+			AddressRegistry:      *registry,
+			WarningsAsErrors:     *warnAsError,
+			DiagnosticLevels:     *levels,
+			CompilerFlags:        *compilerFlags,
+		},
+		Workers:   *workers,
+		OutputDir: *outputDir,
+		Solc:      *solc,
+	})
+	switch *format {
+	case "json":
+		err = WriteDiagnosticsJSON(stdout, report.Diagnostics())
+	case "sarif":
+		err = WriteSARIF(stdout, report.Diagnostics())
+	default:
+		report.WriteTable(stdout)
+		if *gasReport {
+			report.WriteGasReports(stdout)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailed
+	}
+	return report.ExitCode(failStatuses)
+}
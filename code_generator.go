@@ -3,26 +3,56 @@ package main
 import (
 	"fmt"
 	"math/big"
-	"strings"
 )
 
 // CodeGenerator translates normalized Yul IR into NeoVM bytecode
 type CodeGenerator struct {
 	context          *CompilerContext
 	instructions     []NeoInstruction
-	labelMap         map[string]int
+	labelMap         *OrderedMap[int]
 	pendingLabels    []PendingLabel
 	stackTracker     *StackTracker
 	functionTable    map[string]*FunctionInfo
 	currentFunction  string
-	exceptionHandlers []ExceptionHandler
+	exceptionHandlers []ExceptionHandler // Handler frames of the runtime, resolved by Generate
+	tries            []handlerFrame // Handler frames emitted so far
+	symbols          *SymbolTable   // Variables in scope, one scope per block
+	slots            *slotFrame     // Slot allocation of the current function or top-level code
+	signatures       map[string]*YulFunctionDef // Functions callable from the code being generated
+	functionHooks    map[string][]FunctionHook
+	frame            *functionFrame // Function being generated, nil at top level
+	loops            []loopFrame    // Enclosing loops, innermost last
+	stackItems       int            // Switch values held on the stack by enclosing statements
+	dataSegments     *OrderedMap[[]byte] // Data sections of every object, nil when there are none
+	objectCode       *OrderedMap[objectRange] // Runtime objects placed in the contract script
+	memory           *memoryState   // Memory of the script being generated
+	events           []*ContractEvent // Events emitted by log built-ins, in order
+	entry            *entryPoint    // Top-level code of the contract script
+	permissions      []ContractPermission // Contract methods called so far
+	tokens           *MethodTokenTable // Method tokens of the contract script, nil for the constructor
+	labelCounter     int            // Unique label counter without a compiler context
+	stateChanges     map[string]*stateChange // State change of each function of the contract script
+	deploying        bool           // Generating the constructor code of _deploy
+	halts            bool           // Functions of the code being generated halt the invocation
+	constructing     bool           // Generating the code of a deployable object
+	immutables       *ImmutableTable // Immutables set and loaded by the code
+	peephole         *OptimizationEngine // Peephole patterns applied to the instructions, nil for none
+	optimized        int            // Leading instructions already optimized, whose size is final
+	checked          map[*YulFunctionCall]bool // Arithmetic checked for overflow
+	switchCases      []switchCase   // Case labels of the switches generated, for the gas report
+}
+
+// objectRange locates the code of a nested object in the contract script
+type objectRange struct {
+	Offset int
+	Size   int
 }
 
 // PendingLabel represents a label that needs to be resolved later
 type PendingLabel struct {
 	Name             string
 	InstructionIndex int
-	Offset           int
+	Offset           int // Offset from the jump to the label, once resolved
 }
 
 // StackTracker maintains stack depth analysis during code generation
@@ -45,10 +75,14 @@ type FunctionInfo struct {
 
 // NewCodeGenerator creates a new code generator instance
 func NewCodeGenerator(context *CompilerContext) *CodeGenerator {
+	symbols := NewSymbolTable()
+	if context != nil && context.SymbolTable != nil {
+		symbols = context.SymbolTable
+	}
 	return &CodeGenerator{
 		context:       context,
 		instructions:  []NeoInstruction{},
-		labelMap:      make(map[string]int),
+		labelMap:      NewOrderedMap[int](),
 		pendingLabels: []PendingLabel{},
 		stackTracker: &StackTracker{
 			currentDepth: 0,
@@ -57,6 +91,11 @@ func NewCodeGenerator(context *CompilerContext) *CodeGenerator {
 		},
 		functionTable:     make(map[string]*FunctionInfo),
 		exceptionHandlers: []ExceptionHandler{},
+		symbols:           symbols,
+		slots:             &slotFrame{storage: StorageStatic},
+		objectCode:        NewOrderedMap[objectRange](),
+		tokens:            NewMethodTokenTable(),
+		immutables:        NewImmutableTable(),
 	}
 }
 
@@ -67,16 +106,25 @@ func (g *CodeGenerator) Generate(ast *YulAST) (*NeoContract, error) {
 		Version:     "1.0.0",
 		Methods:     []*ContractMethod{},
 		Events:      []*ContractEvent{},
-		EntryPoints: make(map[string]int),
-		Constants:   make(map[string]NeoVMStackItem),
+		EntryPoints: NewOrderedMap[int](),
+		Constants:   NewOrderedMap[NeoVMStackItem](),
 		SourceMap:   make(map[int]SourcePosition),
 		Metadata: &ContractMetadata{
 			Compiler: CompilerInfo{
-				Version: "1.0.0",
+				Version: CompilerVersion,
 				Target:  "NeoVM",
 			},
 		},
 	}
+	if g.context != nil && g.context.ContractVersion != "" {
+		contract.Version = g.context.ContractVersion
+	}
+
+	if err := g.collectDataSegments(ast.Objects); err != nil {
+		return nil, err
+	}
+	contract.DataSegments = g.dataSegments
+	g.checked = g.checkedArithmetic(ast)
 
 	// Process all objects in the AST
 	for _, obj := range ast.Objects {
@@ -91,25 +139,65 @@ func (g *CodeGenerator) Generate(ast *YulAST) (*NeoContract, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error resolving labels: %w", err)
 	}
+	g.optimizeCode(g.optimized)
 
 	// Set final instruction sequences
 	contract.Runtime = g.instructions
 	contract.EntryPoints = g.labelMap
+	contract.Events = append(contract.Events, g.events...)
+	g.exceptionHandlers = g.resolveHandlers()
+	contract.ExceptionHandlers = g.exceptionHandlers
+	g.describeMethods(contract)
+	if err := g.verifyStack(contract.Methods); err != nil {
+		return nil, fmt.Errorf("stack verification: %w", err)
+	}
+	contract.Permissions = g.permissions
+	contract.MethodTokens = g.tokens.Tokens()
+	if g.immutables.Len() > 0 {
+		contract.Immutables = g.immutables
+	}
 
 	return contract, nil
 }
 
+// collectDataSegments gathers the data sections of objects and their nested
+// objects. Segments share one namespace since the data area is flat.
+func (g *CodeGenerator) collectDataSegments(objects []*YulObject) error {
+	for _, obj := range objects {
+		for _, data := range obj.Data.Values() {
+			payload, err := data.Bytes()
+			if err != nil {
+				return fmt.Errorf("data segment %q: %w", data.Name, err)
+			}
+			if g.dataSegments == nil {
+				g.dataSegments = NewOrderedMap[[]byte]()
+			}
+			if _, exists := g.dataSegments.Get(data.Name); exists {
+				return fmt.Errorf("duplicate data segment %q in object %s", data.Name, obj.Name)
+			}
+			g.dataSegments.Set(data.Name, payload)
+		}
+		if err := g.collectDataSegments(obj.Objects.Values()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // generateObject processes a Yul object (contract or code block)
 func (g *CodeGenerator) generateObject(obj *YulObject, contract *NeoContract) error {
 	switch obj.Type {
-	case ObjectTypeContract, ObjectTypeRuntime:
+	case ObjectTypeContract, ObjectTypeRuntime, ObjectTypeCode:
+		if runtime := runtimeObject(obj); obj.Code != nil && runtime != nil {
+			return g.generateDeployable(obj, runtime, contract)
+		}
 		if obj.Code != nil {
-			return g.generateBlock(obj.Code)
+			return g.generateEntryBlock(obj.Code)
 		}
 	}
 
 	// Process nested objects
-	for _, nestedObj := range obj.Objects {
+	for _, nestedObj := range obj.Objects.Values() {
 		err := g.generateObject(nestedObj, contract)
 		if err != nil {
 			return err
@@ -119,8 +207,94 @@ func (g *CodeGenerator) generateObject(obj *YulObject, contract *NeoContract) er
 	return nil
 }
 
+// runtimeObject returns the first nested object with code, which solc emits
+// as the deployed part of a contract
+func runtimeObject(obj *YulObject) *YulObject {
+	for _, nested := range obj.Objects.Values() {
+		if nested.Code != nil {
+			return nested
+		}
+	}
+	return nil
+}
+
+// generateDeployable splits a contract into its runtime object, which
+// becomes the contract script, and its own code, which becomes the
+// constructor and, for the contract script, the body of _deploy. The
+// runtime is generated first so the constructor can refer to its size and
+// offset.
+func (g *CodeGenerator) generateDeployable(obj, runtime *YulObject, contract *NeoContract) error {
+	primary := g.entry == nil
+	start := len(g.instructions)
+	if err := g.generateObject(runtime, contract); err != nil {
+		return fmt.Errorf("runtime object %s: %w", runtime.Name, err)
+	}
+	// Jumps out of the runtime code stay long, so its size is final
+	g.optimizeCode(start)
+	g.relaxJumps()
+	g.optimized = len(g.instructions)
+	offset := g.byteOffset(start)
+	g.objectCode.Set(runtime.Name, objectRange{Offset: offset, Size: g.byteOffset(len(g.instructions)) - offset})
+
+	g.constructing = true
+	defer func() { g.constructing = false }()
+	constructor, err := g.generateSeparately(obj.Code, func() error {
+		if err := g.resolveLabels(); err != nil {
+			return err
+		}
+		g.optimizeCode(0)
+		return g.verifyStack(nil)
+	})
+	if err != nil {
+		return fmt.Errorf("constructor: %w", err)
+	}
+	contract.Constructor = append(contract.Constructor, constructor...)
+	if primary {
+		if err := g.emitDeploy(obj.Code); err != nil {
+			return fmt.Errorf("%s: %w", DeployMethod, err)
+		}
+	}
+	return nil
+}
+
+// generateSeparately generates block as its own script with its own labels,
+// functions and stack tracking, leaving the main instruction stream as is.
+// finish runs on the generated script before the state is restored.
+func (g *CodeGenerator) generateSeparately(block *YulBlock, finish func() error) ([]NeoInstruction, error) {
+	instructions, labels, pending := g.instructions, g.labelMap, g.pendingLabels
+	tracker, functions, tries, entry := g.stackTracker, g.functionTable, g.tries, g.entry
+	tokens := g.tokens
+	defer func() {
+		g.instructions, g.labelMap, g.pendingLabels = instructions, labels, pending
+		g.stackTracker, g.functionTable, g.tries, g.entry = tracker, functions, tries, entry
+		g.tokens = tokens
+	}()
+
+	// Only the contract script has entry points of its own
+	g.instructions, g.labelMap, g.pendingLabels = []NeoInstruction{}, NewOrderedMap[int](), []PendingLabel{}
+	g.tries = nil
+	g.entry = &entryPoint{}
+	g.tokens = nil // Method tokens belong to the NEF of the contract script
+	g.stackTracker = &StackTracker{stackMap: make(map[int]int)}
+	g.functionTable = make(map[string]*FunctionInfo)
+	if err := g.generateEntryBlock(block); err != nil {
+		return nil, err
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return g.instructions, nil
+}
+
 // generateBlock processes a Yul block of statements
 func (g *CodeGenerator) generateBlock(block *YulBlock) error {
+	g.symbols.PushScope()
+	defer g.symbols.PopScope()
+	return g.generateStatements(block)
+}
+
+// generateStatements generates the statements of block in the current scope
+func (g *CodeGenerator) generateStatements(block *YulBlock) error {
 	for _, stmt := range block.Statements {
 		err := g.generateStatement(stmt)
 		if err != nil {
@@ -133,6 +307,8 @@ func (g *CodeGenerator) generateBlock(block *YulBlock) error {
 // generateStatement dispatches statement generation based on type
 func (g *CodeGenerator) generateStatement(stmt YulStatement) error {
 	switch s := stmt.(type) {
+	case *YulBlock:
+		return g.generateBlock(s)
 	case *YulExpressionStatement:
 		return g.generateExpressionStatement(s)
 	case *YulVariableDeclaration:
@@ -165,49 +341,80 @@ func (g *CodeGenerator) generateExpressionStatement(stmt *YulExpressionStatement
 		if err != nil {
 			return err
 		}
-		// Pop the result since it's not used
-		g.emitInstruction(NewStackInstruction(DROP, 0), stmt.Location)
+		// Pop the results since they are not used
+		results := 1
+		if call, ok := stmt.Expression.(*YulFunctionCall); ok {
+			results = g.returnCount(call)
+		}
+		for i := 0; i < results; i++ {
+			g.emitInstruction(NewStackInstruction(DROP), stmt.Location)
+		}
 	}
 	return nil
 }
 
-// generateVariableDeclaration processes variable declarations
+// generateVariableDeclaration processes variable declarations. The
+// variables come into scope after their initial value is computed.
 func (g *CodeGenerator) generateVariableDeclaration(stmt *YulVariableDeclaration) error {
-	// Generate initial value if provided
-	if stmt.Value != nil {
-		err := g.generateExpression(stmt.Value)
+	if stmt.Value == nil {
+		// Slots start out null, so store the zero value of each type
+		for _, variable := range stmt.Variables {
+			symbol, err := g.declareVariable(variable)
+			if err != nil {
+				return err
+			}
+			g.emitInstruction(NewPushInstruction(zeroValue(variable.Type)), stmt.Location)
+			g.emitStore(symbol, stmt.Location)
+		}
+		return nil
+	}
+
+	if err := g.checkValueCount(stmt.Value, len(stmt.Variables)); err != nil {
+		return err
+	}
+	err := g.generateExpression(stmt.Value)
+	if err != nil {
+		return err
+	}
+	if len(stmt.Variables) == 1 {
+		g.emitConversion(g.expressionType(stmt.Value), stmt.Variables[0].Type, stmt.Location)
+	}
+
+	// A call returning several values leaves the first one on top
+	for _, variable := range stmt.Variables {
+		symbol, err := g.declareVariable(variable)
 		if err != nil {
 			return err
 		}
-	} else {
-		// Push default zero value for each variable
-		for range stmt.Variables {
-			g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(0)), stmt.Location)
-		}
+		g.emitStore(symbol, stmt.Location)
 	}
-
-	// Variables are now on the stack
-	// In a more complete implementation, we would track variable locations
 	return nil
 }
 
 // generateAssignment processes variable assignments
 func (g *CodeGenerator) generateAssignment(stmt *YulAssignment) error {
-	// Generate the right-hand side value
+	targets := make([]*Symbol, len(stmt.VariableNames))
+	for i, name := range stmt.VariableNames {
+		symbol, err := g.lookupVariable(name, stmt.Location)
+		if err != nil {
+			return err
+		}
+		targets[i] = symbol
+	}
+
+	if err := g.checkValueCount(stmt.Value, len(targets)); err != nil {
+		return err
+	}
 	err := g.generateExpression(stmt.Value)
 	if err != nil {
 		return err
 	}
-
-	// For multiple assignment targets, duplicate the value
-	for i := range stmt.VariableNames {
-		if i < len(stmt.VariableNames)-1 {
-			g.emitInstruction(NewStackInstruction(DUP, 0), stmt.Location)
-		}
+	if len(targets) == 1 {
+		g.emitConversion(g.expressionType(stmt.Value), targets[0].Type, stmt.Location)
+	}
+	for _, symbol := range targets {
+		g.emitStore(symbol, stmt.Location)
 	}
-
-	// In a complete implementation, we would store to actual variable locations
-	// Maintain values on stack for efficient access
 	return nil
 }
 
@@ -243,37 +450,40 @@ func (g *CodeGenerator) generateSwitch(stmt *YulSwitch) error {
 		return err
 	}
 
+	// The switch value stays on the stack while a case body runs and is
+	// dropped once at the end label, which every path reaches
+	g.stackItems++
+	defer func() { g.stackItems-- }()
+
 	endLabel := g.createUniqueLabel("switch_end")
-	
-	// Generate case comparisons and jumps
-	for _, caseStmt := range stmt.Cases {
-		// Duplicate switch value for comparison
-		g.emitInstruction(NewStackInstruction(DUP, 0), stmt.Location)
-		
-		// Push case value
-		err = g.generateLiteral(&caseStmt.Value)
-		if err != nil {
-			return err
+
+	caseLabels := make([]string, len(stmt.Cases))
+	for i, caseStmt := range stmt.Cases {
+		caseLabels[i] = g.createUniqueLabel("case")
+		g.switchCases = append(g.switchCases, switchCase{
+			label:    caseLabels[i],
+			value:    NewYulPrinter("").PrintExpression(&caseStmt.Value),
+			function: g.currentFunction,
+			location: caseStmt.Location,
+		})
+	}
+	if cases := g.searchCases(stmt, caseLabels); cases != nil {
+		g.emitCaseSearch(cases, stmt.Location)
+	} else {
+		// Compare-and-jump chain: each matching case jumps to its body
+		for i, caseStmt := range stmt.Cases {
+			g.emitInstruction(NewStackInstruction(DUP), stmt.Location)
+			err = g.emitCaseComparison(&caseStmt.Value)
+			if err != nil {
+				return err
+			}
+			g.emitInstruction(NewControlFlowInstruction(JMPIF, 0), caseStmt.Location)
+			g.addPendingLabel(caseLabels[i], len(g.instructions)-1)
 		}
-		
-		// Compare
-		g.emitInstruction(NewArithmeticInstruction(EQUAL), stmt.Location)
-		
-		// Jump to case body if equal
-		caseLabel := g.createUniqueLabel("case_" + caseStmt.Value.Value)
-		g.emitInstruction(NewControlFlowInstruction(JMPIF, 0), stmt.Location)
-		g.addPendingLabel(caseLabel, len(g.instructions)-1)
-		
-		// Generate case body (will be placed later)
-		defer func(c *YulCase, label string) {
-			g.markLabel(label)
-			g.generateBlock(c.Body)
-			g.emitInstruction(NewControlFlowInstruction(JMP, 0), c.Location)
-			g.addPendingLabel(endLabel, len(g.instructions)-1)
-		}(caseStmt, caseLabel)
-	}
-
-	// Generate default case if present
+	}
+
+	// No case matched: run the default body, if any, right after the chain
+	depth := g.stackTracker.currentDepth
 	if stmt.Default != nil {
 		err = g.generateBlock(stmt.Default)
 		if err != nil {
@@ -281,18 +491,52 @@ func (g *CodeGenerator) generateSwitch(stmt *YulSwitch) error {
 		}
 	}
 
-	// Clean up switch value from stack
-	g.emitInstruction(NewStackInstruction(DROP, 0), stmt.Location)
+	// Case bodies follow in source order; the last one falls through to
+	// the end label
+	for i, caseStmt := range stmt.Cases {
+		g.emitInstruction(NewControlFlowInstruction(JMP, 0), caseStmt.Location)
+		g.addPendingLabel(endLabel, len(g.instructions)-1)
 
-	// Mark end label
+		g.stackTracker.currentDepth = depth
+		g.markLabel(caseLabels[i])
+		err = g.generateBlock(caseStmt.Body)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Clean up switch value from stack
 	g.markLabel(endLabel)
+	g.emitInstruction(NewStackInstruction(DROP), stmt.Location)
+	return nil
+}
+
+// emitCaseComparison compares the duplicated switch value with a case
+// literal. Numbers, hex numbers and bools are compared as integers, so a
+// selector such as 0x70a08231 matches the value computed by shr; strings
+// are compared byte for byte.
+func (g *CodeGenerator) emitCaseComparison(lit *YulLiteral) error {
+	if lit.Kind == LiteralKindString {
+		g.emitInstruction(NewPushInstruction(CreateNeoVMByteString(lit.Value)), lit.Location)
+		g.emitInstruction(NewArithmeticInstruction(EQUAL), lit.Location)
+		return nil
+	}
+
+	value, err := ParseYulLiteralValue(lit)
+	if err != nil {
+		return err
+	}
+	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(wordInteger(value))), lit.Location)
+	g.emitInstruction(NewArithmeticInstruction(NUMEQUAL), lit.Location)
 	return nil
 }
 
 // generateFor processes for loops
 func (g *CodeGenerator) generateFor(stmt *YulFor) error {
-	// Generate initialization
-	err := g.generateBlock(stmt.Init)
+	// Variables declared in the init block stay in scope for the whole loop
+	g.symbols.PushScope()
+	defer g.symbols.PopScope()
+	err := g.generateStatements(stmt.Init)
 	if err != nil {
 		return err
 	}
@@ -313,12 +557,16 @@ func (g *CodeGenerator) generateFor(stmt *YulFor) error {
 	g.addPendingLabel(loopEnd, len(g.instructions)-1)
 
 	// Generate body
+	loopContinue := g.createUniqueLabel("for_continue")
+	g.loops = append(g.loops, loopFrame{breakLabel: loopEnd, continueLabel: loopContinue, stackItems: g.stackItems})
 	err = g.generateBlock(stmt.Body)
+	g.loops = g.loops[:len(g.loops)-1]
 	if err != nil {
 		return err
 	}
 
 	// Generate post increment
+	g.markLabel(loopContinue)
 	err = g.generateBlock(stmt.Post)
 	if err != nil {
 		return err
@@ -335,6 +583,12 @@ func (g *CodeGenerator) generateFor(stmt *YulFor) error {
 
 // generateFunctionDef processes function definitions
 func (g *CodeGenerator) generateFunctionDef(stmt *YulFunctionDef) error {
+	// Straight-line code skips the body
+	skipLabel := g.createUniqueLabel("func_skip_" + stmt.Name)
+	g.emitInstruction(NewControlFlowInstruction(JMP, 0), stmt.Location)
+	g.addPendingLabel(skipLabel, len(g.instructions)-1)
+	defer g.markLabel(skipLabel)
+
 	// Mark function entry point
 	functionLabel := "func_" + stmt.Name
 	g.markLabel(functionLabel)
@@ -342,6 +596,13 @@ func (g *CodeGenerator) generateFunctionDef(stmt *YulFunctionDef) error {
 	startOffset := len(g.instructions)
 	g.currentFunction = stmt.Name
 
+	// Functions only see their own parameters and return variables
+	restoreSlots, err := g.enterFunctionSlots(stmt)
+	if err != nil {
+		return err
+	}
+	defer restoreSlots()
+
 	// Create function info
 	funcInfo := &FunctionInfo{
 		Name:        stmt.Name,
@@ -352,14 +613,14 @@ func (g *CodeGenerator) generateFunctionDef(stmt *YulFunctionDef) error {
 		MaxStack:    g.stackTracker.currentDepth,
 	}
 
-	// Generate function body
-	err := g.generateBlock(stmt.Body)
+	// Generate function body; every leave jumps to the single exit
+	restore := g.enterFunction(stmt)
+	defer restore()
+	err = g.generateBlock(stmt.Body)
 	if err != nil {
 		return err
 	}
-
-	// Generate return instruction
-	g.emitInstruction(NewControlFlowInstruction(RET, 0), stmt.Location)
+	g.emitFunctionExit(stmt)
 
 	funcInfo.EndOffset = len(g.instructions)
 	funcInfo.MaxStack = g.stackTracker.maxDepth
@@ -386,9 +647,40 @@ func (g *CodeGenerator) generateExpression(expr YulExpression) error {
 // generateFunctionCall processes function calls (built-ins and user-defined)
 func (g *CodeGenerator) generateFunctionCall(call *YulFunctionCall) error {
 	functionName := call.FunctionName.Name
+	if functionName == "datasize" || functionName == "dataoffset" {
+		return g.generateDataReference(call)
+	}
+	if functionName == "linkersymbol" {
+		return g.generateLinkerSymbol(call)
+	}
+	if (functionName == "datacopy" || functionName == "codecopy") && g.copiesObject(call) {
+		// The runtime object already is the contract script, which Neo
+		// deploys as is, so the constructor has nothing to copy
+		for i := len(call.Arguments) - 1; i >= 0; i-- {
+			if err := g.generateExpression(call.Arguments[i]); err != nil {
+				return err
+			}
+		}
+		for range call.Arguments {
+			g.emitInstruction(NewStackInstruction(DROP), call.Location)
+		}
+		return nil
+	}
+	if _, defined := g.signatures[functionName]; !defined && (functionName == "setimmutable" || functionName == "loadimmutable") {
+		return g.generateImmutable(call)
+	}
+	if _, defined := g.signatures[functionName]; !defined && isNeoBuiltin(functionName) {
+		return g.generateNeoBuiltin(call)
+	}
+	if _, defined := g.signatures[functionName]; !defined && isVerbatim(functionName) {
+		return g.generateVerbatim(call)
+	}
 
 	// Generate arguments (pushed in reverse order for stack convention)
 	for i := len(call.Arguments) - 1; i >= 0; i-- {
+		if err := g.checkValueCount(call.Arguments[i], 1); err != nil {
+			return err
+		}
 		err := g.generateExpression(call.Arguments[i])
 		if err != nil {
 			return err
@@ -396,113 +688,105 @@ func (g *CodeGenerator) generateFunctionCall(call *YulFunctionCall) error {
 	}
 
 	// Handle built-in functions
-	if g.isBuiltinFunction(functionName) {
+	if g.checked[call] {
+		g.emitCheckedArithmetic(functionName, call.Location)
+		return nil
+	}
+	if _, defined := g.signatures[functionName]; !defined && logTopics(functionName) >= 0 {
+		return g.generateLog(call)
+	}
+	if _, defined := g.signatures[functionName]; !defined && externalCallArguments(functionName) >= 0 {
+		return g.generateExternalCall(call)
+	}
+	if _, defined := g.signatures[functionName]; !defined && (functionName == "create" || functionName == "create2") {
+		return g.generateCreate(call)
+	}
+	if _, defined := g.signatures[functionName]; !defined && g.isBuiltinFunction(functionName) {
 		return g.generateBuiltinCall(functionName, len(call.Arguments), call.Location)
 	}
 
 	// Handle user-defined function calls
-	g.emitInstruction(NewControlFlowInstruction(CALL, 0), call.Location)
-	g.addPendingLabel("func_"+functionName, len(g.instructions)-1)
-
-	return nil
+	return g.generateUserCall(call)
 }
 
 // generateBuiltinCall generates code for built-in Yul functions
 func (g *CodeGenerator) generateBuiltinCall(name string, argCount int, location SourcePosition) error {
+	// Arithmetic and comparisons with EVM word semantics
+	if g.generateWordBuiltin(name, location) {
+		return nil
+	}
+	if g.generateCalldataBuiltin(name, location) {
+		return nil
+	}
+	if g.generateMemoryBuiltin(name, location) {
+		return nil
+	}
+	if g.generateReturnDataBuiltin(name, location) {
+		return nil
+	}
+	if g.generateEnvironmentBuiltin(name, location) {
+		return nil
+	}
+	if g.generateTransientBuiltin(name, location) {
+		return nil
+	}
+
 	switch name {
-	// Arithmetic operations
-	case "add":
-		g.emitInstruction(NewArithmeticInstruction(ADD), location)
-	case "sub":
-		g.emitInstruction(NewArithmeticInstruction(SUB), location)
-	case "mul":
-		g.emitInstruction(NewArithmeticInstruction(MUL), location)
-	case "div":
-		// Add division by zero check
-		g.emitDivisionByZeroCheck(location)
-		g.emitInstruction(NewArithmeticInstruction(DIV), location)
-	case "mod":
-		g.emitDivisionByZeroCheck(location)
-		g.emitInstruction(NewArithmeticInstruction(MOD), location)
-	case "lt":
-		g.emitInstruction(NewArithmeticInstruction(LT), location)
-	case "gt":
-		g.emitInstruction(NewArithmeticInstruction(GT), location)
+	// EQUAL tells a Boolean from the Integer of the same value
 	case "eq":
-		g.emitInstruction(NewArithmeticInstruction(EQUAL), location)
+		g.emitInstruction(NewArithmeticInstruction(NUMEQUAL), location)
 	case "iszero":
 		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(0)), location)
-		g.emitInstruction(NewArithmeticInstruction(EQUAL), location)
+		g.emitInstruction(NewArithmeticInstruction(NUMEQUAL), location)
 	case "and":
 		g.emitInstruction(NewArithmeticInstruction(AND), location)
 	case "or":
 		g.emitInstruction(NewArithmeticInstruction(OR), location)
 	case "xor":
 		g.emitInstruction(NewArithmeticInstruction(XOR), location)
-	case "not":
-		g.emitInstruction(NewArithmeticInstruction(NOT), location)
-	case "shl":
-		g.emitInstruction(NewArithmeticInstruction(SHL), location)
-	case "shr":
-		g.emitInstruction(NewArithmeticInstruction(SHR), location)
-
-	// Memory operations (mapped to NeoVM syscalls)
-	case "mload":
-		g.emitInstruction(NewSyscallInstruction("System.Storage.Get"), location)
-	case "mstore":
-		g.emitInstruction(NewSyscallInstruction("System.Storage.Put"), location)
-	case "mstore8":
-		// Store single byte - convert to full storage operation
-		g.emitInstruction(NewSyscallInstruction("System.Storage.Put"), location)
-	case "msize":
-		// Return current memory size - approximate with storage context
-		g.emitInstruction(NewSyscallInstruction("System.Storage.GetContext"), location)
-		g.emitInstruction(NewSyscallInstruction("System.Storage.GetReadOnlyContext"), location)
 
 	// Storage operations
 	case "sload":
-		g.emitInstruction(NewSyscallInstruction("System.Storage.Get"), location)
+		g.emitMemoryCall(storageLoad, 1, 1, location)
 	case "sstore":
-		g.emitInstruction(NewSyscallInstruction("System.Storage.Put"), location)
-
-	// Call data operations
-	case "calldataload":
-		g.emitInstruction(NewSyscallInstruction("System.Runtime.GetArgument"), location)
-	case "calldatasize":
-		g.emitInstruction(NewSyscallInstruction("System.Runtime.GetArgumentCount"), location)
-	case "calldatacopy":
-		// Approximate with multiple argument loads
-		g.emitInstruction(NewSyscallInstruction("System.Runtime.GetArgument"), location)
+		g.emitMemoryCall(storageStore, 2, 0, location)
 
 	// Environment operations
 	case "caller":
-		g.emitInstruction(NewSyscallInstruction("System.Runtime.GetCallingScriptHash"), location)
+		g.generateCaller(location)
 	case "callvalue":
-		g.emitInstruction(NewSyscallInstruction("System.Runtime.GetInvocationCounter"), location)
+		g.generateCallValue(location)
 	case "address":
-		g.emitInstruction(NewSyscallInstruction("System.Runtime.GetExecutingScriptHash"), location)
+		c := memoryCode{g, location}
+		c.syscall("System.Runtime.GetExecutingScriptHash")
+		c.addressWord()
 	case "balance":
-		g.emitInstruction(NewSyscallInstruction("System.Runtime.GetExecutingScriptHash"), location)
-		g.emitInstruction(NewSyscallInstruction("Neo.Native.GAS.balanceOf"), location)
+		c := memoryCode{g, location}
+		c.addressScriptHash()
+		c.callNative(GASTokenHash, "balanceOf", 1, callFlagsReadStates)
 
 	// Control flow operations
 	case "revert":
-		g.emitInstruction(NewControlFlowInstruction(ABORT, 0), location)
-	case "return":
-		// Return data from stack top with proper type conversion
-		g.emitInstruction(NewControlFlowInstruction(RET, 0), location)
-	case "stop":
-		g.emitInstruction(NewControlFlowInstruction(RET, 0), location)
+		g.generateRevert(location)
+	case "invalid":
+		g.generateInvalid(location)
+	case "return", "stop":
+		g.generateHalt(name, location)
+	case "selfdestruct":
+		g.generateSelfDestruct(location)
+
+	// Memory solc reserves for itself, which memory does not need
+	case "memoryguard":
 
-	// Logging operations
-	case "log0", "log1", "log2", "log3", "log4":
-		g.emitInstruction(NewSyscallInstruction("System.Runtime.Notify"), location)
+	// Stack operations
+	case "pop":
+		g.emitInstruction(NewStackInstruction(DROP), location)
 
 	// Hashing operations
 	case "keccak256":
-		g.emitInstruction(NewSyscallInstruction("Neo.Crypto.Keccak256"), location)
+		g.generateKeccak(location)
 	case "sha256":
-		g.emitInstruction(NewSyscallInstruction("Neo.Crypto.Sha256"), location)
+		memoryCode{g, location}.callNative(CryptoLibHash, "sha256", 1, 0)
 
 	default:
 		return fmt.Errorf("unsupported built-in function: %s", name)
@@ -512,10 +796,85 @@ func (g *CodeGenerator) generateBuiltinCall(name string, argCount int, location
 }
 
 // generateIdentifier processes variable references
+// generateDataReference pushes datasize or dataoffset of a data segment or
+// runtime object. Segment offsets are positions in the data area, where
+// segments follow each other in declaration order; object offsets are
+// positions in the contract script.
+func (g *CodeGenerator) generateDataReference(call *YulFunctionCall) error {
+	name := call.FunctionName.Name
+	if len(call.Arguments) != 1 {
+		return fmt.Errorf("%s expects one argument, got %d", name, len(call.Arguments))
+	}
+	lit, ok := call.Arguments[0].(*YulLiteral)
+	if !ok || lit.Kind != LiteralKindString {
+		return fmt.Errorf("%s expects a string literal naming a data segment", name)
+	}
+
+	offset := 0
+	var payload []byte
+	found := false
+	g.dataSegments.Range(func(segment string, data []byte) bool {
+		if segment == lit.Value {
+			payload, found = data, true
+			return false
+		}
+		offset += len(data)
+		return true
+	})
+	value := len(payload)
+	if name == "dataoffset" {
+		value = offset
+	}
+	if !found {
+		// Runtime objects live in the contract script rather than the data area
+		code, ok := g.objectCode.Get(lit.Value)
+		if !ok {
+			return fmt.Errorf("%s: unknown data segment or object %q", name, lit.Value)
+		}
+		value = code.Size
+		if name == "dataoffset" {
+			value = code.Offset
+		}
+	}
+	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(value)), call.Location)
+	return nil
+}
+
+// copiesObject reports whether a datacopy or codecopy reads from a runtime
+// object, i.e. its source offset is dataoffset of an object rather than a
+// data segment
+func (g *CodeGenerator) copiesObject(call *YulFunctionCall) bool {
+	if len(call.Arguments) != 3 {
+		return false
+	}
+	source, ok := call.Arguments[1].(*YulFunctionCall)
+	if !ok || source.FunctionName.Name != "dataoffset" || len(source.Arguments) != 1 {
+		return false
+	}
+	lit, ok := source.Arguments[0].(*YulLiteral)
+	if !ok {
+		return false
+	}
+	_, isObject := g.objectCode.Get(lit.Value)
+	_, isData := g.dataSegments.Get(lit.Value)
+	return isObject && !isData
+}
+
+// dataArea returns every data segment concatenated in declaration order
+func (g *CodeGenerator) dataArea() []byte {
+	var area []byte
+	for _, data := range g.dataSegments.Values() {
+		area = append(area, data...)
+	}
+	return area
+}
+
 func (g *CodeGenerator) generateIdentifier(ident *YulIdentifier) error {
-	// In a complete implementation, this would load from variable storage
-	// Variables managed on stack with spill to storage as needed
-	g.emitInstruction(NewStackInstruction(DUP, 0), ident.Location)
+	symbol, err := g.lookupVariable(ident.Name, ident.Location)
+	if err != nil {
+		return err
+	}
+	g.emitLoad(symbol, ident.Location)
 	return nil
 }
 
@@ -523,54 +882,100 @@ func (g *CodeGenerator) generateIdentifier(ident *YulIdentifier) error {
 func (g *CodeGenerator) generateLiteral(lit *YulLiteral) error {
 	switch lit.Kind {
 	case LiteralKindNumber:
-		value := CreateNeoVMInteger(lit.Value)
-		g.emitInstruction(NewPushInstruction(value), lit.Location)
+		if lit.Type == DataTypeBool {
+			value, err := ParseYulLiteralValue(lit)
+			if err != nil {
+				return err
+			}
+			g.emitInstruction(NewPushInstruction(CreateNeoVMBoolean(value.Sign() != 0)), lit.Location)
+			break
+		}
+		value, err := ParseYulLiteralValue(lit)
+		if err != nil {
+			return err
+		}
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(wordInteger(value))), lit.Location)
 	case LiteralKindString:
 		value := CreateNeoVMByteString(lit.Value)
 		g.emitInstruction(NewPushInstruction(value), lit.Location)
 	case LiteralKindBool:
+		if lit.Type.BitWidth() > 0 {
+			value := 0
+			if lit.Value == "true" {
+				value = 1
+			}
+			g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(value)), lit.Location)
+			break
+		}
 		value := CreateNeoVMBoolean(lit.Value == "true")
 		g.emitInstruction(NewPushInstruction(value), lit.Location)
 	case LiteralKindHex:
-		// Convert hex string to bytes
-		hexStr := strings.TrimPrefix(lit.Value, "0x")
-		if len(hexStr)%2 != 0 {
-			hexStr = "0" + hexStr
-		}
-		bytes := make([]byte, len(hexStr)/2)
-		for i := 0; i < len(hexStr); i += 2 {
-			var b byte
-			fmt.Sscanf(hexStr[i:i+2], "%02x", &b)
-			bytes[i/2] = b
-		}
-		value := CreateNeoVMByteString(bytes)
-		g.emitInstruction(NewPushInstruction(value), lit.Location)
+		// A hex number is an integer like any other number
+		value, err := ParseYulLiteralValue(lit)
+		if err != nil {
+			return err
+		}
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(wordInteger(value))), lit.Location)
 	default:
 		return fmt.Errorf("unsupported literal kind: %s", lit.Kind)
 	}
 	return nil
 }
 
-// Helper functions for control flow and optimization
+// variableType returns the declared type of a variable, u256 if unknown
+func (g *CodeGenerator) variableType(name string) YulDataType {
+	if symbol, ok := g.symbols.Lookup(name); ok && symbol.Kind == SymbolVariable {
+		return symbol.Type
+	}
+	return DataTypeUint256
+}
 
-func (g *CodeGenerator) generateBreak(stmt *YulBreak) error {
-	// Jump to loop end using tracked loop context from compilation state
-	g.emitInstruction(NewControlFlowInstruction(JMP, 0), stmt.Location)
-	return nil
+// expressionType returns the type of the value expr leaves on the stack
+func (g *CodeGenerator) expressionType(expr YulExpression) YulDataType {
+	switch e := expr.(type) {
+	case *YulIdentifier:
+		return g.variableType(e.Name)
+	case *YulLiteral:
+		if e.Type != "" {
+			return e.Type
+		}
+	case *YulFunctionCall:
+		if e.ResultType != "" {
+			return e.ResultType
+		}
+	}
+	return DataTypeUint256
 }
 
-func (g *CodeGenerator) generateContinue(stmt *YulContinue) error {
-	// Jump to loop continuation using tracked loop context from compilation state
-	g.emitInstruction(NewControlFlowInstruction(JMP, 0), stmt.Location)
-	return nil
+// emitConversion converts the value on top of the stack from one declared
+// type to another: booleans and integers are distinct NeoVM stack item
+// types, and narrowing to an unsigned type truncates the value
+func (g *CodeGenerator) emitConversion(from, to YulDataType, location SourcePosition) {
+	if from == to {
+		return
+	}
+	switch {
+	case to == DataTypeBool && from.BitWidth() > 0:
+		g.emitInstruction(NewConvertInstruction(BooleanType), location)
+	case from == DataTypeBool && to.BitWidth() > 0:
+		g.emitInstruction(NewConvertInstruction(IntegerType), location)
+	case to.BitWidth() > 0 && !to.Signed() && to.BitWidth() < from.BitWidth():
+		mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(to.BitWidth())), big.NewInt(1))
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(mask)), location)
+		g.emitInstruction(NewArithmeticInstruction(AND), location)
+	}
 }
 
-func (g *CodeGenerator) generateLeave(stmt *YulLeave) error {
-	// Early function return
-	g.emitInstruction(NewControlFlowInstruction(RET, 0), stmt.Location)
-	return nil
+// zeroValue is the default value of a variable of the given type
+func zeroValue(dataType YulDataType) NeoVMStackItem {
+	if dataType == DataTypeBool {
+		return CreateNeoVMBoolean(false)
+	}
+	return CreateNeoVMInteger(0)
 }
 
+// Helper functions for control flow and optimization
+
 // Utility functions
 
 func (g *CodeGenerator) emitInstruction(instr NeoInstruction, location SourcePosition) {
@@ -588,50 +993,113 @@ func (g *CodeGenerator) emitInstruction(instr NeoInstruction, location SourcePos
 }
 
 func (g *CodeGenerator) createUniqueLabel(prefix string) string {
-	g.context.LabelCounter++
-	return fmt.Sprintf("%s_%d", prefix, g.context.LabelCounter)
+	counter := &g.labelCounter
+	if g.context != nil {
+		counter = &g.context.LabelCounter
+	}
+	*counter++
+	return fmt.Sprintf("%s_%d", prefix, *counter)
 }
 
 func (g *CodeGenerator) markLabel(name string) {
-	g.labelMap[name] = len(g.instructions)
+	g.labelMap.Set(name, len(g.instructions))
+}
+
+// emitReturnGuard ends the code emitted so far with RET unless control
+// cannot reach past it
+func (g *CodeGenerator) emitReturnGuard(location SourcePosition) {
+	if g.reachable() {
+		g.emitInstruction(NewControlFlowInstruction(RET, 0), location)
+	}
+}
+
+// reachable reports whether control can reach past the code emitted so
+// far: the last instruction does not return, or a label marks the end
+func (g *CodeGenerator) reachable() bool {
+	end := len(g.instructions)
+	reachable := end == 0 || g.instructions[end-1].Opcode != RET
+	g.labelMap.Range(func(_ string, index int) bool {
+		reachable = reachable || index == end
+		return !reachable
+	})
+	return reachable
 }
 
 func (g *CodeGenerator) addPendingLabel(name string, instrIndex int) {
 	g.pendingLabels = append(g.pendingLabels, PendingLabel{
 		Name:             name,
 		InstructionIndex: instrIndex,
-		Offset:           4, // NeoVM uses 4-byte addresses
 	})
 }
 
+// byteOffset returns the script offset of the instruction at index
+func (g *CodeGenerator) byteOffset(index int) int {
+	offset := 0
+	for i := 0; i < index && i < len(g.instructions); i++ {
+		offset += g.instructions[i].Size
+	}
+	return offset
+}
+
+// profile returns the size/gas cost model for this compilation
+func (g *CodeGenerator) profile() *OptimizationProfile {
+	if g.context != nil && g.context.Profile != nil {
+		return g.context.Profile
+	}
+	return DefaultOptimizationProfile()
+}
+
+// resolveLabels relaxes the pending jumps and encodes the offsets of their
+// labels
 func (g *CodeGenerator) resolveLabels() error {
 	for _, pending := range g.pendingLabels {
-		if targetOffset, exists := g.labelMap[pending.Name]; exists {
-			// Update instruction operand with target address
-			instr := &g.instructions[pending.InstructionIndex]
-			if len(instr.Operand) >= 4 {
-				instr.Operand[0] = byte(targetOffset)
-				instr.Operand[1] = byte(targetOffset >> 8)
-				instr.Operand[2] = byte(targetOffset >> 16)
-				instr.Operand[3] = byte(targetOffset >> 24)
-			}
-		} else {
+		if _, exists := g.labelMap.Get(pending.Name); !exists {
 			return fmt.Errorf("undefined label: %s", pending.Name)
 		}
 	}
+	g.encodeJumps()
 	return nil
 }
 
+// encodeJumps relaxes the pending jumps and encodes the offsets of those
+// whose labels are marked. A label marking the end gets a RET to mark.
+func (g *CodeGenerator) encodeJumps() {
+	// Nodes reject scripts with jumps past the last instruction
+	end := false
+	g.labelMap.Range(func(_ string, index int) bool {
+		end = index == len(g.instructions)
+		return !end
+	})
+	if end {
+		g.emitInstruction(NewControlFlowInstruction(RET, 0), SourcePosition{})
+	}
+	g.relaxJumps()
+	offsets := g.byteOffsets()
+	for i := range g.pendingLabels {
+		pending := &g.pendingLabels[i]
+		target, ok := g.labelMap.Get(pending.Name)
+		if !ok {
+			continue
+		}
+		pending.Offset = offsets[target] - offsets[pending.InstructionIndex]
+		encodeJumpOffset(&g.instructions[pending.InstructionIndex], 0, pending.Offset)
+	}
+}
+
 func (g *CodeGenerator) isBuiltinFunction(name string) bool {
 	builtins := []string{
-		"add", "sub", "mul", "div", "mod", "exp",
-		"lt", "gt", "eq", "iszero", "and", "or", "xor", "not",
-		"shl", "shr", "sar", "byte", "sload", "sstore",
-		"mload", "mstore", "mstore8", "msize",
-		"calldataload", "calldatasize", "calldatacopy",
+		"add", "sub", "mul", "div", "sdiv", "mod", "smod", "exp", "addmod", "mulmod",
+		"lt", "gt", "slt", "sgt", "signextend", "eq", "iszero", "and", "or", "xor", "not",
+		"shl", "shr", "sar", "byte", "sload", "sstore", "tload", "tstore",
+		"mload", "mstore", "mstore8", "msize", "mcopy",
+		"calldataload", "calldatasize", "calldatacopy", "datacopy", "codecopy", "memoryguard",
 		"caller", "callvalue", "address", "balance",
-		"revert", "return", "stop", "keccak256", "sha256",
-		"log0", "log1", "log2", "log3", "log4",
+		"call", "staticcall", "delegatecall", "returndatasize", "returndatacopy",
+		"create", "create2", "gas", "gasprice", "gaslimit", "selfbalance",
+		"timestamp", "number", "blockhash", "chainid", "coinbase", "origin",
+		"extcodesize", "extcodehash", "prevrandao",
+		"revert", "invalid", "return", "stop", "keccak256", "sha256",
+		"log0", "log1", "log2", "log3", "log4", "pop", "selfdestruct",
 	}
 	
 	for _, builtin := range builtins {
@@ -642,36 +1110,35 @@ func (g *CodeGenerator) isBuiltinFunction(name string) bool {
 	return false
 }
 
-func (g *CodeGenerator) emitDivisionByZeroCheck(location SourcePosition) {
-	// Duplicate divisor for check
-	g.emitInstruction(NewStackInstruction(DUP, 0), location)
-	
-	// Check if zero
-	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(0)), location)
-	g.emitInstruction(NewArithmeticInstruction(EQUAL), location)
-	
-	// Jump to error if zero
-	errorLabel := g.createUniqueLabel("div_zero_error")
-	g.emitInstruction(NewControlFlowInstruction(JMPIF, 0), location)
-	g.addPendingLabel(errorLabel, len(g.instructions)-1)
-	
-	// Continue normally
-	continueLabel := g.createUniqueLabel("div_continue")
-	g.emitInstruction(NewControlFlowInstruction(JMP, 0), location)
-	g.addPendingLabel(continueLabel, len(g.instructions)-1)
-	
-	// Error handling
-	g.markLabel(errorLabel)
-	g.emitInstruction(NewControlFlowInstruction(ABORT, 0), location)
-	
-	// Continue point
-	g.markLabel(continueLabel)
+// Functions returns a copy of the function table built by Generate
+func (g *CodeGenerator) Functions() map[string]FunctionInfo {
+	functions := make(map[string]FunctionInfo, len(g.functionTable))
+	for name, info := range g.functionTable {
+		functions[name] = *info
+	}
+	return functions
+}
+
+// StackUsage summarizes the stack depth analysis of the generated code
+type StackUsage struct {
+	CurrentDepth        int // Depth at the end of the generated code
+	MaxDepth            int
+	TrackedInstructions int // Instructions with a recorded stack depth
+}
+
+// StackUsage returns the stack depth analysis of the generated code
+func (g *CodeGenerator) StackUsage() StackUsage {
+	return StackUsage{
+		CurrentDepth:        g.stackTracker.currentDepth,
+		MaxDepth:            g.stackTracker.maxDepth,
+		TrackedInstructions: len(g.stackTracker.stackMap),
+	}
 }
 
 // GetCompilationStats returns compilation statistics
 func (g *CodeGenerator) GetCompilationStats() CompilationStats {
 	return CompilationStats{
-		CompiledSizeBytes: len(g.instructions) * 4, // Approximate
+		CompiledSizeBytes: g.byteOffset(len(g.instructions)),
 		FunctionsCompiled: len(g.functionTable),
 	}
 }
\ No newline at end of file
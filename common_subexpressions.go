@@ -0,0 +1,275 @@
+package main
+
+// CommonSubexpressionPass replaces an expression bound by let with the
+// variable when the same expression is computed again on the same path,
+// e.g. the second keccak256 of a slot or sload of a key. Expressions of
+// pure built-ins are reused while none of their variables is assigned,
+// sload results until an sstore that may write the same key, and mload
+// and keccak256 results until memory is written. Calls to user functions
+// and to other contracts may do either.
+type CommonSubexpressionPass struct {
+	Eliminated int // Expressions replaced by the last Apply
+}
+
+// NewCommonSubexpressionPass creates the pass
+func NewCommonSubexpressionPass() *CommonSubexpressionPass {
+	return &CommonSubexpressionPass{}
+}
+
+func (p *CommonSubexpressionPass) Name() string       { return "common_subexpression_elimination" }
+func (p *CommonSubexpressionPass) RequiredLevel() int { return 2 }
+
+// State an expression reads
+const (
+	readsStorage = 1 << iota
+	readsMemory
+)
+
+// cseReaders are the built-ins besides the pure ones whose results may be
+// reused, with the state they read
+var cseReaders = map[string]int{
+	"sload": readsStorage, "mload": readsMemory, "keccak256": readsMemory,
+	"calldataload": 0, "calldatasize": 0, "caller": 0, "callvalue": 0, "address": 0, "origin": 0,
+}
+
+// cseMemoryWriters are the built-ins writing memory without changing
+// storage
+var cseMemoryWriters = map[string]bool{
+	"mstore": true, "mstore8": true, "mcopy": true,
+	"calldatacopy": true, "datacopy": true, "codecopy": true, "returndatacopy": true,
+}
+
+// cseClobbers are the built-ins that may write storage and memory
+var cseClobbers = map[string]bool{
+	"call": true, "callcode": true, "delegatecall": true, "staticcall": true,
+	"create": true, "create2": true,
+}
+
+// cseValue is an available expression
+type cseValue struct {
+	holder string          // Variable holding the value
+	vars   map[string]bool // Variables the expression reads
+	reads  int             // State the expression reads
+	keys   []YulExpression // Keys of its sloads
+}
+
+// cseEffects are the changes a statement makes
+type cseEffects struct {
+	assigned map[string]bool
+	storage  bool // Storage may change at any key
+	memory   bool
+	stores   []YulExpression // Keys of sstores
+}
+
+// Apply eliminates the repeated expressions of every object and function
+func (p *CommonSubexpressionPass) Apply(ast *YulAST) (*YulAST, error) {
+	p.Eliminated = 0
+	functions := make(map[string]bool)
+	forEachFunctionDef(ast, func(fn *YulFunctionDef) {
+		functions[fn.Name] = true
+	})
+
+	var eliminateObject func(obj *YulObject)
+	eliminateObject = func(obj *YulObject) {
+		p.eliminateBlock(obj.Code, nil, functions)
+		for _, nested := range obj.Objects.Values() {
+			eliminateObject(nested)
+		}
+	}
+	for _, obj := range ast.Objects {
+		eliminateObject(obj)
+	}
+	for _, def := range ast.Functions {
+		p.eliminateBlock(def.Body, nil, functions)
+	}
+	return ast, nil
+}
+
+// eliminateBlock rewrites the statements of block with the expressions
+// available at its start and returns those available at its end
+func (p *CommonSubexpressionPass) eliminateBlock(block *YulBlock, outer map[string]cseValue, functions map[string]bool) map[string]cseValue {
+	available := make(map[string]cseValue, len(outer))
+	for key, value := range outer {
+		available[key] = value
+	}
+	if block == nil {
+		return available
+	}
+
+	for _, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *YulFunctionDef:
+			p.eliminateBlock(s.Body, nil, functions)
+			continue
+		case *YulFor:
+			// Later iterations see the changes of the whole loop
+			effects := statementEffects(s, functions)
+			invalidate(available, effects)
+			loop := p.eliminateBlock(s.Init, available, functions)
+			invalidate(loop, effects)
+			s.Condition = p.replace(s.Condition, loop)
+			p.eliminateBlock(s.Body, loop, functions)
+			p.eliminateBlock(s.Post, loop, functions)
+			continue
+		}
+
+		// Calls in arguments run before the expressions they may replace
+		usable, arguments := available, cseEffects{}
+		for _, slot := range statementExpressions(stmt) {
+			if call, ok := (*slot).(*YulFunctionCall); ok {
+				for _, arg := range call.Arguments {
+					arguments.add(arg, functions)
+				}
+			}
+		}
+		if arguments.storage || arguments.memory || len(arguments.stores) > 0 {
+			usable = make(map[string]cseValue, len(available))
+			for key, value := range available {
+				usable[key] = value
+			}
+			invalidate(usable, arguments)
+		}
+		for _, slot := range statementExpressions(stmt) {
+			*slot = p.replace(*slot, usable)
+		}
+		for _, nested := range statementBlocks(stmt) {
+			p.eliminateBlock(nested, available, functions)
+		}
+		invalidate(available, statementEffects(stmt, functions))
+
+		let, ok := stmt.(*YulVariableDeclaration)
+		if !ok || len(let.Variables) != 1 {
+			continue
+		}
+		if value, ok := cseAvailable(let.Value); ok {
+			key := NewYulPrinter("").PrintExpression(let.Value)
+			if _, exists := available[key]; !exists {
+				value.holder = let.Variables[0].Name
+				available[key] = value
+			}
+		}
+	}
+	return available
+}
+
+// replace substitutes the variables holding available expressions in expr
+func (p *CommonSubexpressionPass) replace(expr YulExpression, available map[string]cseValue) YulExpression {
+	if expr == nil || len(available) == 0 {
+		return expr
+	}
+	printer := NewYulPrinter("")
+	return rewriteExpression(expr, func(e YulExpression) YulExpression {
+		call, ok := e.(*YulFunctionCall)
+		if !ok {
+			return e
+		}
+		if value, ok := available[printer.PrintExpression(call)]; ok {
+			p.Eliminated++
+			return &YulIdentifier{Name: value.holder, Location: call.Location}
+		}
+		return e
+	})
+}
+
+// cseAvailable describes expr when its result may be reused
+func cseAvailable(expr YulExpression) (cseValue, bool) {
+	value := cseValue{vars: make(map[string]bool)}
+	if _, ok := expr.(*YulFunctionCall); !ok {
+		return value, false
+	}
+	reusable := true
+	walkExpression(expr, func(e YulExpression) {
+		switch e := e.(type) {
+		case *YulIdentifier:
+			value.vars[e.Name] = true
+		case *YulFunctionCall:
+			name := e.FunctionName.Name
+			reads, reader := cseReaders[name]
+			if !reader && !isPureBuiltin(name) {
+				reusable = false
+			}
+			value.reads |= reads
+			if name == "sload" && len(e.Arguments) == 1 {
+				value.keys = append(value.keys, e.Arguments[0])
+			}
+		}
+	})
+	return value, reusable
+}
+
+// statementEffects collects the changes of stmt and its nested blocks,
+// without the functions defined in them
+func statementEffects(stmt YulStatement, functions map[string]bool) cseEffects {
+	effects := cseEffects{assigned: make(map[string]bool)}
+	collect := func(stmt YulStatement) {
+		if assignment, ok := stmt.(*YulAssignment); ok {
+			for _, name := range assignment.VariableNames {
+				effects.assigned[name] = true
+			}
+		}
+		for _, slot := range statementExpressions(stmt) {
+			effects.add(*slot, functions)
+		}
+	}
+	if _, ok := stmt.(*YulFunctionDef); ok {
+		return effects
+	}
+	collect(stmt)
+	for _, nested := range statementBlocks(stmt) {
+		functionBody(nested, collect)
+	}
+	return effects
+}
+
+// add collects the changes of the calls in expr
+func (effects *cseEffects) add(expr YulExpression, functions map[string]bool) {
+	walkExpression(expr, func(e YulExpression) {
+		call, ok := e.(*YulFunctionCall)
+		if !ok {
+			return
+		}
+		switch name := call.FunctionName.Name; {
+		case name == "sstore" && len(call.Arguments) == 2:
+			effects.stores = append(effects.stores, call.Arguments[0])
+		case cseMemoryWriters[name]:
+			effects.memory = true
+		case cseClobbers[name] || functions[name]:
+			effects.storage, effects.memory = true, true
+		}
+	})
+}
+
+// invalidate drops the available expressions the effects may change
+func invalidate(available map[string]cseValue, effects cseEffects) {
+	for key, value := range available {
+		drop := effects.assigned[value.holder] ||
+			value.reads&readsMemory != 0 && effects.memory ||
+			value.reads&readsStorage != 0 && (effects.storage || mayWrite(effects.stores, value.keys))
+		for name := range value.vars {
+			drop = drop || effects.assigned[name]
+		}
+		if drop {
+			delete(available, key)
+		}
+	}
+}
+
+// mayWrite reports whether an sstore to one of stores may write one of
+// keys. Only distinct literal keys are known to differ.
+func mayWrite(stores, keys []YulExpression) bool {
+	for _, store := range stores {
+		for _, key := range keys {
+			a, aok := store.(*YulLiteral)
+			b, bok := key.(*YulLiteral)
+			if !aok || !bok {
+				return true
+			}
+			x, xerr := ParseYulLiteralValue(a)
+			y, yerr := ParseYulLiteralValue(b)
+			if xerr != nil || yerr != nil || x.Cmp(y) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CompilerVersion is the semantic version embedded in every artifact. The
+// major version changes when artifacts stop being readable by older tools,
+// the minor version when new artifact features are added.
+const CompilerVersion = "1.0.0"
+
+// Artifact features recorded in CompilerInfo.Features. A tool must know every
+// feature an artifact uses before it links, diffs or deploys it.
+const (
+	FeatureOrderedContainers = "ordered-containers" // Entry points and constants in emission order
+	FeatureShortJumps        = "short-jumps"        // Jumps may use 1-byte offsets
+	FeatureCanaryStorage     = "canary-storage"     // sstore changelog instrumentation
+	FeatureProfileGuided     = "profile-guided"     // Built with execution profile feedback
+)
+
+// supportedFeatures lists the features this compiler understands
+var supportedFeatures = map[string]bool{
+	FeatureOrderedContainers: true,
+	FeatureShortJumps:        true,
+	FeatureCanaryStorage:     true,
+	FeatureProfileGuided:     true,
+}
+
+// ArtifactUse is what a tool intends to do with an artifact
+type ArtifactUse string
+
+const (
+	UseLink   ArtifactUse = "link"
+	UseDiff   ArtifactUse = "diff"
+	UseDeploy ArtifactUse = "deploy"
+)
+
+// SemanticVersion is a parsed MAJOR.MINOR.PATCH version
+type SemanticVersion struct {
+	Major, Minor, Patch int
+}
+
+// ParseSemanticVersion parses a version such as "1.2.3" or "v1.2"
+func ParseSemanticVersion(value string) (SemanticVersion, error) {
+	var version SemanticVersion
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(value), "v"), ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return version, fmt.Errorf("invalid version %q", value)
+	}
+
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		// Ignore pre-release and build suffixes such as 1.2.3-rc1
+		if i == len(parts)-1 {
+			part = strings.SplitN(strings.SplitN(part, "-", 2)[0], "+", 2)[0]
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return version, fmt.Errorf("invalid version %q", value)
+		}
+		numbers[i] = n
+	}
+	return SemanticVersion{numbers[0], numbers[1], numbers[2]}, nil
+}
+
+func (v SemanticVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether v precedes other
+func (v SemanticVersion) Less(other SemanticVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// CompatibilityError explains why an artifact cannot be used and what to do
+// about it
+type CompatibilityError struct {
+	Artifact string
+	Problem  string
+	Remedy   string
+}
+
+func (e *CompatibilityError) Error() string {
+	return fmt.Sprintf("%s: %s; %s", e.Artifact, e.Problem, e.Remedy)
+}
+
+// artifactFeatures returns the features a compilation with this context
+// embeds in its artifact, sorted
+func artifactFeatures(context *CompilerContext) []string {
+	features := []string{FeatureOrderedContainers}
+	if context.Profile != nil {
+		if context.Profile.Goal == OptimizeForSize {
+			features = append(features, FeatureShortJumps)
+		}
+		if context.Profile.Feedback != nil {
+			features = append(features, FeatureProfileGuided)
+		}
+	}
+	if context.CanaryTracking {
+		features = append(features, FeatureCanaryStorage)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// NewArtifactCompilerInfo describes the compiler and profile producing an artifact
+func NewArtifactCompilerInfo(context *CompilerContext) CompilerInfo {
+	info := CompilerInfo{
+		Version:   CompilerVersion,
+		Target:    "NeoVM",
+		BuildMode: string(context.BuildMode),
+		Features:  artifactFeatures(context),
+	}
+	if context.Profile != nil {
+		info.Profile = string(context.Profile.Goal)
+	}
+	return info
+}
+
+// CheckArtifactCompatibility reports whether this compiler's tools can use
+// an artifact for the given purpose
+func CheckArtifactCompatibility(contract *NeoContract, use ArtifactUse) error {
+	name := contract.Name
+	if contract.Metadata == nil || contract.Metadata.Compiler.Version == "" {
+		return &CompatibilityError{name, "artifact carries no compiler version",
+			"rebuild it with compiler " + CompilerVersion + " or later"}
+	}
+	info := contract.Metadata.Compiler
+
+	produced, err := ParseSemanticVersion(info.Version)
+	if err != nil {
+		return &CompatibilityError{name, err.Error(), "rebuild it with compiler " + CompilerVersion}
+	}
+	current, _ := ParseSemanticVersion(CompilerVersion)
+
+	if produced.Major != current.Major {
+		return &CompatibilityError{name,
+			fmt.Sprintf("built by compiler %s, incompatible with %s", produced, current),
+			fmt.Sprintf("rebuild it with a %d.x compiler", current.Major)}
+	}
+	if produced.Minor > current.Minor {
+		return &CompatibilityError{name,
+			fmt.Sprintf("built by newer compiler %s", produced),
+			fmt.Sprintf("upgrade tools to %d.%d or later", produced.Major, produced.Minor)}
+	}
+
+	for _, feature := range info.Features {
+		if !supportedFeatures[feature] {
+			return &CompatibilityError{name,
+				fmt.Sprintf("uses unknown artifact feature %q", feature),
+				"upgrade tools to the compiler version that produced it (" + info.Version + ")"}
+		}
+	}
+
+	if use == UseDeploy {
+		for _, feature := range info.Features {
+			if feature == FeatureCanaryStorage {
+				return &CompatibilityError{name,
+					"staging build with canary storage instrumentation",
+					"rebuild with --build-mode=release before deploying"}
+			}
+		}
+	}
+	return nil
+}
+
+// CheckArtifactsCompatible reports whether two artifacts can be linked or
+// diffed together
+func CheckArtifactsCompatible(a, b *NeoContract, use ArtifactUse) error {
+	if err := CheckArtifactCompatibility(a, use); err != nil {
+		return err
+	}
+	if err := CheckArtifactCompatibility(b, use); err != nil {
+		return err
+	}
+
+	infoA, infoB := a.Metadata.Compiler, b.Metadata.Compiler
+	versionA, _ := ParseSemanticVersion(infoA.Version)
+	versionB, _ := ParseSemanticVersion(infoB.Version)
+	pair := a.Name + " and " + b.Name
+
+	switch use {
+	case UseLink:
+		if versionA.Major != versionB.Major || versionA.Minor != versionB.Minor {
+			return &CompatibilityError{pair,
+				fmt.Sprintf("built by compilers %s and %s", versionA, versionB),
+				"rebuild both with the same compiler minor version before linking"}
+		}
+		if infoA.BuildMode != infoB.BuildMode {
+			return &CompatibilityError{pair,
+				fmt.Sprintf("mix %s and %s builds", buildModeName(infoA.BuildMode), buildModeName(infoB.BuildMode)),
+				"rebuild both with the same --build-mode"}
+		}
+	case UseDiff:
+		if infoA.Profile != infoB.Profile {
+			return &CompatibilityError{pair,
+				fmt.Sprintf("optimized for %s and %s", infoA.Profile, infoB.Profile),
+				"rebuild both with the same --optimize-for for a meaningful diff"}
+		}
+	}
+	return nil
+}
+
+func buildModeName(mode string) string {
+	if mode == "" {
+		return string(BuildRelease)
+	}
+	return mode
+}
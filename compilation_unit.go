@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Compilation units.
+//
+// A compilation unit is a set of Yul files compiled into one contract.
+// Yul has no import statement: an object refers to another with
+// dataoffset, datasize and datacopy, and when the name is neither one of
+// its own objects nor a data segment, linking looks it up among the
+// top-level objects of every file and nests it in the referring object.
+// The deployer and runtime of a contract, or a factory and the contracts
+// it creates, can so live in files of their own.
+//
+// Files are parsed and linked in name order, so the result does not depend
+// on the order they were added in. Top-level objects nobody refers to are
+// the roots of the unit, in that order. Positions carry their file name.
+
+// LinkError is an object or function that cannot be linked
+type LinkError struct {
+	Position SourcePosition
+	Message  string
+	Related  SourcePosition // Earlier definition of the name, if any
+}
+
+func (e *LinkError) Error() string {
+	return fmt.Sprintf("%s in %s at line %d, column %d", e.Message, e.Position.File, e.Position.Line, e.Position.Column)
+}
+
+// CompilationUnit is a set of Yul files compiled together
+type CompilationUnit struct {
+	sources map[string]string
+}
+
+// NewCompilationUnit creates an empty compilation unit
+func NewCompilationUnit() *CompilationUnit {
+	return &CompilationUnit{sources: make(map[string]string)}
+}
+
+// AddFile adds a source under a file name
+func (u *CompilationUnit) AddFile(name, source string) error {
+	if _, exists := u.sources[name]; exists {
+		return fmt.Errorf("file %s added twice", name)
+	}
+	u.sources[name] = source
+	return nil
+}
+
+// AddFiles reads the files at paths into the unit
+func (u *CompilationUnit) AddFiles(paths ...string) error {
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := u.AddFile(path, string(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Files returns the file names in link order
+func (u *CompilationUnit) Files() []string {
+	files := make([]string, 0, len(u.sources))
+	for name := range u.sources {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// objectReference is a dataoffset, datasize or datacopy naming an object
+// the referring object does not hold
+type objectReference struct {
+	from     *YulObject
+	name     string
+	location SourcePosition
+}
+
+// Link parses the files of the unit with parser and links their objects
+// into one AST
+func (u *CompilationUnit) Link(parser *YulParser) (*YulAST, error) {
+	files := u.Files()
+	if len(files) == 0 {
+		return nil, fmt.Errorf("compilation unit has no files")
+	}
+
+	linked := &YulAST{Objects: []*YulObject{}, Functions: []*YulFunctionDef{}}
+	objects := make(map[string]*YulObject)
+	functions := make(map[string]*YulFunctionDef)
+	segments := make(map[string]bool)
+	for _, file := range files {
+		ast, err := parser.ParseFile(file, u.sources[file])
+		if err != nil {
+			return nil, err
+		}
+		if linked.Metadata == nil {
+			linked.Metadata = ast.Metadata
+		}
+		linked.Suppressions = append(linked.Suppressions, ast.Suppressions...)
+		for _, obj := range ast.Objects {
+			if other, exists := objects[obj.Name]; exists {
+				return nil, &LinkError{obj.Location, fmt.Sprintf("object %s is already defined in %s at line %d", obj.Name, other.Location.File, other.Location.Line), other.Location}
+			}
+			objects[obj.Name] = obj
+			linked.Objects = append(linked.Objects, obj)
+			collectSegments(obj, segments)
+		}
+		for _, fn := range ast.Functions {
+			if other, exists := functions[fn.Name]; exists {
+				return nil, &LinkError{fn.Location, fmt.Sprintf("function %s is already defined in %s at line %d", fn.Name, other.Location.File, other.Location.Line), other.Location}
+			}
+			functions[fn.Name] = fn
+			linked.Functions = append(linked.Functions, fn)
+		}
+	}
+
+	// References are collected before any object is nested, so each
+	// object is searched once
+	var references []objectReference
+	for _, obj := range linked.Objects {
+		references = append(references, unresolvedReferences(obj, segments)...)
+	}
+	roots := make(map[*YulObject]*YulObject) // Object to its top-level object
+	for _, obj := range linked.Objects {
+		markRoot(obj, obj, roots)
+	}
+	uses := make(map[*YulObject][]*YulObject) // Top-level object to those it nests
+	nested := make(map[*YulObject]bool)
+	for _, ref := range references {
+		target, ok := objects[ref.name]
+		if !ok {
+			continue // Reported by code generation
+		}
+		if _, exists := ref.from.Objects.Get(ref.name); !exists {
+			ref.from.Objects.Set(ref.name, target)
+			uses[roots[ref.from]] = append(uses[roots[ref.from]], target)
+		}
+		nested[target] = true
+	}
+	if cycle := findObjectCycle(linked.Objects, uses); cycle != nil {
+		return nil, &LinkError{cycle.Location, fmt.Sprintf("object %s refers to itself through other files", cycle.Name), SourcePosition{}}
+	}
+
+	top := linked.Objects[:0]
+	for _, obj := range linked.Objects {
+		if !nested[obj] {
+			top = append(top, obj)
+		}
+	}
+	linked.Objects = top
+	return linked, nil
+}
+
+// collectSegments records the data segments of obj and its nested objects,
+// which share one namespace
+func collectSegments(obj *YulObject, segments map[string]bool) {
+	if obj.Data != nil {
+		for _, name := range obj.Data.Keys() {
+			segments[name] = true
+		}
+	}
+	if obj.Objects == nil {
+		obj.Objects = NewOrderedMap[*YulObject]()
+	}
+	for _, nested := range obj.Objects.Values() {
+		collectSegments(nested, segments)
+	}
+}
+
+// markRoot maps obj and its nested objects to root
+func markRoot(obj, root *YulObject, roots map[*YulObject]*YulObject) {
+	roots[obj] = root
+	for _, nested := range obj.Objects.Values() {
+		markRoot(nested, root, roots)
+	}
+}
+
+// unresolvedReferences lists the names obj and its nested objects refer to
+// that are neither their own objects nor data segments
+func unresolvedReferences(obj *YulObject, segments map[string]bool) []objectReference {
+	var references []objectReference
+	if obj.Code != nil {
+		walkBlock(obj.Code, func(block *YulBlock) {
+			for _, stmt := range block.Statements {
+				for _, slot := range statementExpressions(stmt) {
+					walkExpression(*slot, func(e YulExpression) {
+						call, ok := e.(*YulFunctionCall)
+						if !ok || (call.FunctionName.Name != "dataoffset" && call.FunctionName.Name != "datasize") || len(call.Arguments) != 1 {
+							return
+						}
+						lit, ok := call.Arguments[0].(*YulLiteral)
+						if !ok || lit.Kind != LiteralKindString || lit.Value == obj.Name || segments[lit.Value] {
+							return
+						}
+						if _, own := obj.Objects.Get(lit.Value); !own {
+							references = append(references, objectReference{from: obj, name: lit.Value, location: call.Location})
+						}
+					})
+				}
+			}
+		})
+	}
+	for _, nested := range obj.Objects.Values() {
+		references = append(references, unresolvedReferences(nested, segments)...)
+	}
+	return references
+}
+
+// findObjectCycle returns a top-level object that ends up nested in
+// itself, or nil
+func findObjectCycle(objects []*YulObject, uses map[*YulObject][]*YulObject) *YulObject {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[*YulObject]int)
+	var visit func(obj *YulObject) *YulObject
+	visit = func(obj *YulObject) *YulObject {
+		state[obj] = visiting
+		for _, next := range uses[obj] {
+			switch state[next] {
+			case visiting:
+				return next
+			case 0:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		state[obj] = visited
+		return nil
+	}
+	for _, obj := range objects {
+		if state[obj] == 0 {
+			if cycle := visit(obj); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// CompileUnit links the files of unit and compiles them into one contract
+func (c *YulToNeoCompiler) CompileUnit(unit *CompilationUnit) (*CompilationResult, error) {
+	return c.compile(func() (*YulAST, error) {
+		ast, err := unit.Link(c.Parser)
+		if _, ok := err.(*LinkError); ok {
+			return nil, &StageError{"Linking", "Link error", err}
+		}
+		if err != nil {
+			return nil, &StageError{"Parsing", "Parse error", err}
+		}
+		return ast, nil
+	})
+}
+
+// diagnosticFile is the file a diagnostic at position names, empty for an
+// inline source
+func diagnosticFile(position SourcePosition) string {
+	if position.File == InlineSource {
+		return ""
+	}
+	return position.File
+}
@@ -0,0 +1,152 @@
+package main
+
+import "math/big"
+
+// CompileTimeEvaluationPass folds calls to small pure user functions whose
+// arguments are all literals, e.g. safeAdd(1, 2) becomes 3. Each call is run
+// in a restricted interpreter with a step budget so non-terminating or
+// expensive functions are simply left alone.
+type CompileTimeEvaluationPass struct {
+	StepBudget    int // Evaluation steps allowed per folded call
+	MaxStatements int // Largest function body, in statements, considered small
+	Folded        int // Number of calls folded by the last Apply
+}
+
+// Default limits for compile-time evaluation
+const (
+	defaultEvaluationStepBudget    = 10000
+	defaultEvaluationMaxStatements = 32
+)
+
+// NewCompileTimeEvaluationPass creates the pass with default limits
+func NewCompileTimeEvaluationPass() *CompileTimeEvaluationPass {
+	return &CompileTimeEvaluationPass{
+		StepBudget:    defaultEvaluationStepBudget,
+		MaxStatements: defaultEvaluationMaxStatements,
+	}
+}
+
+func (p *CompileTimeEvaluationPass) Name() string       { return "compile_time_evaluation" }
+func (p *CompileTimeEvaluationPass) RequiredLevel() int { return 2 }
+
+// Apply replaces foldable calls with their computed value
+func (p *CompileTimeEvaluationPass) Apply(ast *YulAST) (*YulAST, error) {
+	p.Folded = 0
+
+	definitions := make(map[string][]*YulFunctionDef)
+	forEachFunctionDef(ast, func(fn *YulFunctionDef) {
+		definitions[fn.Name] = append(definitions[fn.Name], fn)
+	})
+
+	pure := pureUserFunctions(definitions)
+	if len(pure) == 0 {
+		return ast, nil
+	}
+
+	functions := make([]*YulFunctionDef, 0, len(pure))
+	for _, fn := range pure {
+		functions = append(functions, fn)
+	}
+
+	forEachExpression(ast, func(expr YulExpression) YulExpression {
+		call, ok := expr.(*YulFunctionCall)
+		if !ok {
+			return expr
+		}
+		fn, ok := pure[call.FunctionName.Name]
+		if !ok || len(fn.Returns) != 1 || countStatements(fn.Body) > p.MaxStatements {
+			return expr
+		}
+
+		args, ok := literalArguments(call)
+		if !ok {
+			return expr
+		}
+
+		interp := NewRestrictedYulInterpreter(functions, p.StepBudget)
+		results, err := interp.CallFunction(fn.Name, args)
+		if err != nil {
+			// Budget exhaustion or code the interpreter rejects: keep the call
+			return expr
+		}
+
+		p.Folded++
+		return NewWordLiteral(results[0], call.Location)
+	})
+
+	return ast, nil
+}
+
+// pureUserFunctions returns the uniquely named user functions that only call
+// pure built-ins and other pure user functions
+func pureUserFunctions(definitions map[string][]*YulFunctionDef) map[string]*YulFunctionDef {
+	candidates := make(map[string]*YulFunctionDef)
+	for name, defs := range definitions {
+		if len(defs) == 1 {
+			candidates[name] = defs[0]
+		}
+	}
+
+	// Drop functions with impure calls until nothing changes
+	for changed := true; changed; {
+		changed = false
+		for name, fn := range candidates {
+			if !callsOnlyPure(fn.Body, candidates) {
+				delete(candidates, name)
+				changed = true
+			}
+		}
+	}
+	return candidates
+}
+
+func callsOnlyPure(body *YulBlock, pure map[string]*YulFunctionDef) bool {
+	ok := true
+	walkBlock(body, func(block *YulBlock) {
+		for _, stmt := range block.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(expr YulExpression) {
+					call, isCall := expr.(*YulFunctionCall)
+					if !isCall {
+						return
+					}
+					name := call.FunctionName.Name
+					if isPureBuiltin(name) {
+						return
+					}
+					if _, user := pure[name]; !user {
+						ok = false
+					}
+				})
+			}
+		}
+	})
+	return ok
+}
+
+// countStatements returns the number of statements in block and its nested blocks
+func countStatements(block *YulBlock) int {
+	count := 0
+	walkBlock(block, func(b *YulBlock) {
+		count += len(b.Statements)
+	})
+	return count
+}
+
+// literalArguments returns the word values of call's arguments if all of them
+// are literals
+func literalArguments(call *YulFunctionCall) ([]*big.Int, bool) {
+	args := make([]*big.Int, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		lit, ok := arg.(*YulLiteral)
+		if !ok {
+			return nil, false
+		}
+		value, err := ParseYulLiteralValue(lit)
+		if err != nil {
+			return nil, false
+		}
+		args[i] = value
+	}
+	return args, true
+}
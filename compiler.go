@@ -1,9 +1,10 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -17,6 +18,7 @@ type YulToNeoCompiler struct {
 	Optimizer       *OptimizationEngine
 	CodeGenerator   *CodeGenerator
 	RuntimeManager  *RuntimeManager
+	context         *CompilerContext
 }
 
 // CompilerConfig holds configuration options for the compilation process
@@ -27,6 +29,32 @@ type CompilerConfig struct {
 	EnableDebugInfo     bool         // Generate debug information
 	MaxStackDepth       int          // Maximum allowed stack depth
 	MemoryLimit         int64        // Memory usage limit in bytes
+	OptimizeFor         string       // "gas" (default) or "size"; overridden by --optimize-for
+	BuildMode           string       // "release" (default) or "staging"; overridden by --build-mode
+	CanaryMode          bool         // Record storage writes in staging builds; also set by --canary
+	ProfileFeedback     string       // Execution profile for profile-guided optimization; overridden by --profile-feedback
+	RenameManifestNames bool         // Rename methods and events not valid in a Neo manifest; also set by --rename-manifest-names
+	ContractVersion     string       // Contract version from the project manifest; overridden by --contract-version
+	ABIBaseline         string       // Previous artifact to diff the ABI against; overridden by --abi-baseline
+	FailOnABIBreak      bool         // Fail on breaking ABI changes without a version bump; also set by --fail-on-abi-break
+	PricingFile         string       // Opcode, syscall and storage prices of the target network; overridden by --pricing
+	StubGasBuiltins     bool         // Compile gas, gasprice, gaslimit and selfbalance to constants; also set by --stub-gas-builtins
+	ZeroCallValue       bool         // Compile callvalue to 0 when payments are not modeled; also set by --zero-callvalue
+	ExportFunctions     []string     // Yul functions exposed as contract methods
+	ViewFunctions       []string     // Yul functions that must not change state
+	Permissions         []string     // Calls permitted beyond those the script makes, "contract[:method,...]"; "*" for any
+	Trusts              []string     // Contracts and groups trusted to call with all flags; "*" for any
+	SupportedStandards  []string     // Standards declared in the manifest, e.g. "NEP-17"
+	Standard            string       // Token standard to comply with, "nep17", "nep11", "nep11-divisible" or ""; overridden by --standard
+	Libraries           []string     // Deployed contracts called through CALLT, "name=hash"
+	StoragePrefix       string       // Hex prefix of storage slot keys; overridden by --storage-prefix
+	UpdateOwner         string       // Account allowed to call a generated update method, a script hash or "slot:N"; overridden by --update-owner
+	AddressStrategy     string       // Mapping of EVM addresses onto script hashes, "identity" (default), "registry" or "checksum"; overridden by --address-strategy
+	AddressRegistry     []string     // EVM addresses of Neo accounts for the registry strategy, "address=hash"
+	SwitchSearchThreshold int        // Cases from which a switch of numbers dispatches by binary search, 0 for 10, negative for never; overridden by --switch-search-threshold
+	Dialect             string       // Yul dialect, an EVM version such as "cancun" or "neo" (default); overridden by --dialect
+	WarningsAsErrors    bool         // Fail on warnings not turned off; also set by --warn-as-error
+	DiagnosticLevels    []string     // Levels of diagnostic codes, "code=level" with level off, warning or error; extended by --diagnostic
 	CompilerFlags       []string     // Additional compiler flags
 }
 
@@ -38,6 +66,27 @@ type CompilerContext struct {
 	LabelCounter    int                // Unique label counter
 	ErrorCollector  *ErrorCollector    // Compilation error collection
 	Metadata        *CompilationMetadata
+	Profile         *OptimizationProfile // Size/gas cost model shared by all passes
+	CanaryTracking  bool               // Instrument sstore with a changelog (staging only)
+	BoundsChecking  bool               // Emit runtime bounds checks
+	BuildMode       BuildMode          // Release or staging
+	RenameManifestNames bool           // Rewrite names the manifest cannot represent
+	ContractVersion string             // Version recorded in the contract, "" for the default
+	TargetVersion   SemanticVersion    // Target NeoVM version, zero for the latest
+	StubGasBuiltins bool               // Gas built-ins are constants
+	ZeroCallValue   bool               // callvalue is 0 and there is no payment shim
+	ExportFunctions []string           // Yul functions with methods of their own
+	ViewFunctions   []string           // Yul functions verified not to change state
+	Manifest        ManifestSettings   // Configured permissions, trusts and standards
+	Standard        string             // Token standard the contract complies with, "" for none
+	Libraries       []Library          // Contracts known at compile time
+	StorageLayout   *StorageLayoutManager // Storage keys of slots, nil for the default layout
+	UpdateOwner     *UpdateOwner       // Account checked by the update method, nil for none
+	AddressTranslation *AddressTranslation // Mapping of address words onto script hashes, nil for identity
+	MaxStackDepth   int                // Stack depth the verifier allows, 0 for the NeoVM limit
+	SwitchSearchThreshold int          // Cases from which a switch dispatches by binary search, 0 for never
+	DiagnosticLevels map[string]DiagnosticLevel // Configured levels of diagnostic codes
+	WarningsAsErrors bool              // Warnings at the default level are errors
 }
 
 // CompilationResult contains the output of the compilation process
@@ -47,6 +96,8 @@ type CompilationResult struct {
 	Errors          []CompilerError    // Fatal errors
 	Statistics      CompilationStats   // Performance statistics
 	DebugInfo       *DebugInformation  // Debug symbols and source maps
+	ABIChangelog    *ABIChangelog      // Interface changes since the ABI baseline, if configured
+	GasReport       *GasReport         // Execution fees of the functions and switch cases
 }
 
 // NewYulToNeoCompiler creates a new compiler instance with the given configuration
@@ -60,125 +111,206 @@ func NewYulToNeoCompiler(config CompilerConfig) *YulToNeoCompiler {
 		Metadata:       NewCompilationMetadata(),
 	}
 
+	for _, err := range CompilerFlagErrors(config) {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+	}
+	profile, err := OptimizationProfileFromConfig(config)
+	if err != nil {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+		profile = DefaultOptimizationProfile()
+	}
+	feedback, err := ExecutionProfileFromConfig(config)
+	if err != nil {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+	}
+	profile.Feedback = feedback
+	prices, err := PriceTableFromConfig(config)
+	if err != nil {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+		prices = DefaultPriceTable()
+	}
+	profile.Prices = prices
+	context.Profile = profile
+
+	mode, err := BuildModeFromConfig(config)
+	if err != nil {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+		mode = BuildRelease
+	}
+	context.BuildMode = mode
+	context.RenameManifestNames = RenameManifestNamesRequested(config)
+	context.BoundsChecking = config.EnableBoundsChecking
+	context.MaxStackDepth = config.MaxStackDepth
+	version, err := ContractVersionFromConfig(config)
+	if err != nil {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+	}
+	context.ContractVersion = version
+	target, err := TargetVersionFromConfig(config)
+	if err != nil {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+	}
+	context.TargetVersion = target
+	context.StubGasBuiltins = StubGasBuiltinsRequested(config)
+	context.ZeroCallValue = ZeroCallValueRequested(config)
+	context.ExportFunctions = config.ExportFunctions
+	context.ViewFunctions = config.ViewFunctions
+	manifest, errs := ManifestSettingsFromConfig(config)
+	for _, err := range errs {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+	}
+	context.Manifest = manifest
+	standard, err := StandardFromConfig(config)
+	if err != nil {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+	}
+	context.Standard = standard
+	libraries, errs := LibrariesFromConfig(config)
+	for _, err := range errs {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+	}
+	context.Libraries = libraries
+	layout, err := StorageLayoutFromConfig(config)
+	if err != nil {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+		layout = DefaultStorageLayout()
+	}
+	context.StorageLayout = layout
+	owner, err := UpdateOwnerFromConfig(config)
+	if err != nil {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+	}
+	context.UpdateOwner = owner
+	translation, err := AddressTranslationFromConfig(config)
+	if err != nil {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+		translation = DefaultAddressTranslation()
+	}
+	context.AddressTranslation = translation
+	threshold, err := SwitchSearchThresholdFromConfig(config)
+	if err != nil {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+	}
+	context.SwitchSearchThreshold = threshold
+	levels, errs := DiagnosticLevelsFromConfig(config)
+	for _, err := range errs {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+	}
+	context.DiagnosticLevels = levels
+	context.WarningsAsErrors = WarningsAsErrorsRequested(config)
+	if standard != "" {
+		context.Manifest.Standards = declareStandard(context.Manifest.Standards, StandardName(standard))
+	}
+	if CanaryRequested(config) {
+		if mode == BuildStaging {
+			context.CanaryTracking = true
+		} else {
+			context.ErrorCollector.AddWarning("Configuration", "canary mode is only available in staging builds; storage tracking stripped", 0, 0)
+		}
+	}
+
+	dialect, err := DialectFromConfig(config)
+	if err != nil {
+		context.ErrorCollector.AddError("Configuration", err.Error(), 0, 0)
+		dialect, _ = DialectByName(DefaultDialect)
+	}
+	parser := NewYulParser()
+	parser.SetDialect(dialect)
+
+	optimizer := NewOptimizationEngine(config.OptimizationLevel)
+	optimizer.SetProfile(profile)
+
 	return &YulToNeoCompiler{
 		Config:         config,
-		Parser:         NewYulParser(),
+		Parser:         parser,
 		Normalizer:     NewIRNormalizer(context),
 		StaticAnalyzer: NewStaticAnalyzer(context),
-		Optimizer:      NewOptimizationEngine(config.OptimizationLevel),
+		Optimizer:      optimizer,
 		CodeGenerator:  NewCodeGenerator(context),
 		RuntimeManager: NewRuntimeManager(context),
+		context:        context,
 	}
 }
 
 // Compile performs the complete compilation process from Yul source to NeoVM bytecode
 func (c *YulToNeoCompiler) Compile(yulSource string) (*CompilationResult, error) {
+	return c.compile(func() (*YulAST, error) { return c.Parse(yulSource) })
+}
+
+// compile runs the compilation process on the AST parse returns
+func (c *YulToNeoCompiler) compile(parse func() (*YulAST, error)) (*CompilationResult, error) {
 	log.Printf("Starting Yul to NeoVM compilation process")
 	
 	result := &CompilationResult{
 		Statistics: CompilationStats{},
 	}
-
-	// Phase 1: Parse Yul source into AST
-	log.Printf("Phase 1: Parsing Yul source")
-	ast, err := c.Parser.Parse(yulSource)
-	if err != nil {
-		result.Errors = append(result.Errors, CompilerError{
-			Phase: "Parsing",
-			Message: fmt.Sprintf("Parse error: %v", err),
-		})
-		return result, err
-	}
-
-	// Phase 2: Normalize IR to canonical form
-	log.Printf("Phase 2: Normalizing IR")
-	normalizedAST, err := c.Normalizer.Normalize(ast)
-	if err != nil {
-		result.Errors = append(result.Errors, CompilerError{
-			Phase: "Normalization",
-			Message: fmt.Sprintf("Normalization error: %v", err),
-		})
-		return result, err
-	}
-
-	// Phase 3: Static analysis and validation
-	log.Printf("Phase 3: Static analysis")
-	analysisResult, err := c.StaticAnalyzer.Analyze(normalizedAST)
-	if err != nil {
-		result.Errors = append(result.Errors, CompilerError{
-			Phase: "Static Analysis",
-			Message: fmt.Sprintf("Analysis error: %v", err),
-		})
+	result.Warnings = append(result.Warnings, c.context.ErrorCollector.GetWarnings()...)
+	if err := c.configurationError(result); err != nil {
 		return result, err
 	}
-	result.Warnings = append(result.Warnings, analysisResult.Warnings...)
 
-	// Phase 4: Optimization passes
-	log.Printf("Phase 4: Optimization")
-	optimizedAST, err := c.Optimizer.Optimize(normalizedAST)
+	ast, finalContract, err := c.runStages(parse, result)
 	if err != nil {
-		result.Errors = append(result.Errors, CompilerError{
-			Phase: "Optimization",
-			Message: fmt.Sprintf("Optimization error: %v", err),
-		})
+		c.applyDiagnosticLevels(result)
 		return result, err
 	}
 
-	// Phase 5: Code generation
-	log.Printf("Phase 5: Code generation")
-	contract, err := c.CodeGenerator.Generate(optimizedAST)
-	if err != nil {
-		result.Errors = append(result.Errors, CompilerError{
-			Phase: "Code Generation",
-			Message: fmt.Sprintf("Code generation error: %v", err),
-		})
-		return result, err
-	}
-
-	// Phase 6: Runtime integration and finalization
-	log.Printf("Phase 6: Runtime integration")
-	finalContract, err := c.RuntimeManager.Finalize(contract)
-	if err != nil {
-		result.Errors = append(result.Errors, CompilerError{
-			Phase: "Runtime Integration",
-			Message: fmt.Sprintf("Runtime error: %v", err),
-		})
+	result.Contract = finalContract
+	result.GasReport = c.CodeGenerator.GasReport(c.context.Profile.Prices)
+	if err := c.checkABI(finalContract, result); err != nil {
+		c.applyDiagnosticLevels(result)
 		return result, err
 	}
-
-	result.Contract = finalContract
 	
 	// Generate debug information if requested
 	if c.Config.EnableDebugInfo {
 		result.DebugInfo = c.generateDebugInfo(ast, finalContract)
 	}
+	if err := c.applyDiagnosticLevels(result); err != nil {
+		return result, err
+	}
 
 	log.Printf("Compilation completed successfully")
 	return result, nil
 }
 
-// CompileFromFile compiles Yul source from a file
-func (c *YulToNeoCompiler) CompileFromFile(filename string) (*CompilationResult, error) {
-	// Implementation would read file and call Compile()
-	return nil, errors.New("file compilation not implemented yet")
+// configurationError returns the error of a configuration compilation
+// cannot honor, recording its problems in result
+func (c *YulToNeoCompiler) configurationError(result *CompilationResult) error {
+	problems := c.context.ErrorCollector.GetErrors()
+	if len(problems) == 0 {
+		return nil
+	}
+	result.Errors = append(result.Errors, problems...)
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.Message
+	}
+	return fmt.Errorf("invalid configuration: %s", strings.Join(messages, "; "))
 }
 
-// Validate performs validation without full compilation
-func (c *YulToNeoCompiler) Validate(yulSource string) (*ValidationResult, error) {
-	ast, err := c.Parser.Parse(yulSource)
-	if err != nil {
+// CompileFromFile compiles Yul source from a file, whose name positions
+// carry
+func (c *YulToNeoCompiler) CompileFromFile(filename string) (*CompilationResult, error) {
+	unit := NewCompilationUnit()
+	if err := unit.AddFiles(filename); err != nil {
 		return nil, err
 	}
+	return c.CompileUnit(unit)
+}
 
-	normalizedAST, err := c.Normalizer.Normalize(ast)
+// Validate performs validation without full compilation
+func (c *YulToNeoCompiler) Validate(yulSource string) (*ValidationResult, error) {
+	ast, err := c.Parse(yulSource)
 	if err != nil {
 		return nil, err
 	}
 
-	analysisResult, err := c.StaticAnalyzer.Analyze(normalizedAST)
+	annotated, err := c.Analyze(ast)
 	if err != nil {
 		return nil, err
 	}
+	analysisResult := annotated.Analysis
 
 	return &ValidationResult{
 		IsValid:  len(analysisResult.Errors) == 0,
@@ -189,22 +321,57 @@ func (c *YulToNeoCompiler) Validate(yulSource string) (*ValidationResult, error)
 
 // generateDebugInfo creates debug information for the compiled contract
 func (c *YulToNeoCompiler) generateDebugInfo(ast *YulAST, contract *NeoContract) *DebugInformation {
-	return &DebugInformation{
-		SourceMap:        c.buildSourceMap(ast),
+	info := &DebugInformation{
+		SourceMap:        c.buildSourceMap(contract),
 		FunctionMap:      c.buildFunctionMap(ast, contract),
 		VariableMap:      c.buildVariableMap(ast, contract),
 		InstructionMap:   c.buildInstructionMap(ast, contract),
+		Documents:        sourceDocuments(contract.Runtime),
+	}
+	info.SrcMap = CompressedSourceMap(contract.Runtime, info.Documents)
+	var functions []*YulFunctionDef
+	forEachFunctionDef(ast, func(def *YulFunctionDef) { functions = append(functions, def) })
+	if neo, err := NewNeoDebugInfo(contract, functions); err == nil {
+		info.Neo = neo
 	}
+	return info
 }
 
-func (c *YulToNeoCompiler) buildSourceMap(ast *YulAST) map[int]SourceLocation {
-	// Build mapping from bytecode offset to source location
-	return make(map[int]SourceLocation)
+// buildSourceMap maps the byte offset of each runtime instruction with a
+// source reference to its location
+func (c *YulToNeoCompiler) buildSourceMap(contract *NeoContract) map[int]SourceLocation {
+	sourceMap := make(map[int]SourceLocation)
+	offset := 0
+	for _, instr := range contract.Runtime {
+		if ref := instr.SourceRef; ref != nil && ref.Line > 0 {
+			sourceMap[offset] = SourceLocation{File: ref.File, Line: ref.Line, Column: ref.Column, Length: ref.Length}
+		}
+		offset += instr.Size
+	}
+	return sourceMap
 }
 
-func (c *YulToNeoCompiler) buildFunctionMap(ast *YulAST, contract *NeoContract) map[string]FunctionInfo {
-	// Build mapping from function names to bytecode locations
-	return make(map[string]FunctionInfo)
+// buildFunctionMap locates each function compiled into the script by the
+// byte offsets of its code
+func (c *YulToNeoCompiler) buildFunctionMap(ast *YulAST, contract *NeoContract) map[string]FunctionDebugInfo {
+	offsets := make([]int, len(contract.Runtime)+1) // Byte offset by instruction index
+	for i, instr := range contract.Runtime {
+		offsets[i+1] = offsets[i] + instr.Size
+	}
+	functionMap := make(map[string]FunctionDebugInfo)
+	for name, info := range c.CodeGenerator.Functions() {
+		if info.StartOffset > len(contract.Runtime) || info.EndOffset > len(contract.Runtime) {
+			continue
+		}
+		functionMap[name] = FunctionDebugInfo{
+			Name:           name,
+			StartOffset:    offsets[info.StartOffset],
+			EndOffset:      offsets[info.EndOffset],
+			ParameterCount: info.Parameters,
+			ReturnCount:    info.Returns,
+		}
+	}
+	return functionMap
 }
 
 func (c *YulToNeoCompiler) buildVariableMap(ast *YulAST, contract *NeoContract) map[string]VariableInfo {
@@ -222,16 +389,26 @@ func (c *YulToNeoCompiler) buildInstructionMap(ast *YulAST, contract *NeoContrac
 type CompilerError struct {
 	Phase    string `json:"phase"`
 	Message  string `json:"message"`
+	File     string `json:"file,omitempty"` // Source file of a compilation unit
 	Line     int    `json:"line,omitempty"`
 	Column   int    `json:"column,omitempty"`
+	Length   int    `json:"length,omitempty"` // Of the offending source on its line
 	Severity string `json:"severity"`
+	Code     string `json:"code,omitempty"` // Diagnostic code, that of the phase when empty
+	Related  []DiagnosticNote `json:"related,omitempty"`
+	Fix      string `json:"fix,omitempty"`
 }
 
 type CompilerWarning struct {
 	Phase   string `json:"phase"`
 	Message string `json:"message"`
+	File    string `json:"file,omitempty"` // Source file of a compilation unit
 	Line    int    `json:"line,omitempty"`
 	Column  int    `json:"column,omitempty"`
+	Length  int    `json:"length,omitempty"` // Of the offending source on its line
+	Code    string `json:"code,omitempty"` // Diagnostic code, that of the phase when empty
+	Related []DiagnosticNote `json:"related,omitempty"`
+	Fix     string `json:"fix,omitempty"`
 }
 
 type CompilationStats struct {
@@ -240,6 +417,7 @@ type CompilationStats struct {
 	CompiledSizeBytes   int   `json:"compiled_size_bytes"`
 	OptimizationsPassed int   `json:"optimizations_passed"`
 	FunctionsCompiled   int   `json:"functions_compiled"`
+	EstimatedCost       CostEstimate `json:"estimated_cost"` // Fees at the configured network prices
 }
 
 type ValidationResult struct {
@@ -250,9 +428,12 @@ type ValidationResult struct {
 
 type DebugInformation struct {
 	SourceMap      map[int]SourceLocation    `json:"source_map"`
-	FunctionMap    map[string]FunctionInfo   `json:"function_map"`
+	FunctionMap    map[string]FunctionDebugInfo `json:"function_map"`
 	VariableMap    map[string]VariableInfo   `json:"variable_map"`
 	InstructionMap map[int]InstructionInfo   `json:"instruction_map"`
+	Documents      []string                  `json:"documents"` // Source files SrcMap and Neo index
+	SrcMap         string                    `json:"srcmap"`    // Compressed solc source map of the script
+	Neo            *NeoDebugInfo             `json:"neo,omitempty"` // NEP-19 debug information
 }
 
 type SourceLocation struct {
@@ -262,7 +443,9 @@ type SourceLocation struct {
 	Length int    `json:"length"`
 }
 
-type FunctionInfo struct {
+// FunctionDebugInfo locates a function in the script; its code spans the
+// bytes [StartOffset, EndOffset)
+type FunctionDebugInfo struct {
 	Name           string `json:"name"`
 	StartOffset    int    `json:"start_offset"`
 	EndOffset      int    `json:"end_offset"`
@@ -297,7 +480,7 @@ type CompilationMetadata struct {
 
 func NewCompilationMetadata() *CompilationMetadata {
 	return &CompilationMetadata{
-		CompilerVersion: "1.0.0",
+		CompilerVersion: CompilerVersion,
 		Statistics:      CompilationStats{},
 	}
 }
@@ -368,8 +551,9 @@ func ExampleCompilation() {
 	}
 
 	log.Printf("Compilation successful!")
-	log.Printf("Contract size: %d bytes", len(result.Contract.Runtime))
+	log.Printf("Contract size: %d bytes", result.Statistics.CompiledSizeBytes)
 	log.Printf("Functions compiled: %d", result.Statistics.FunctionsCompiled)
+	log.Printf("Estimated cost: %d datoshi", result.Statistics.EstimatedCost.Total())
 	log.Printf("Compilation time: %dms", result.Statistics.CompilationTimeMs)
 
 	if len(result.Warnings) > 0 {
@@ -381,6 +565,41 @@ func ExampleCompilation() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "compile" {
+		os.Exit(RunCompileCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "disasm" {
+		os.Exit(RunDisasmCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "decompile" {
+		os.Exit(RunDecompileCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "debug" {
+		os.Exit(RunDebugCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lsp" {
+		os.Exit(RunLSPCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(RunFmtCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "deploy" {
+		os.Exit(RunDeployCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "invoke" {
+		os.Exit(RunInvokeCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(RunVerifyCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "abi" {
+		os.Exit(RunABICommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	// Installed as neo-yulc, the binary is the compile command
+	if strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe") == "neo-yulc" {
+		os.Exit(RunCompileCommand(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	fmt.Println("Yul to NeoVM Compiler v1.0.0")
 	fmt.Println("============================")
 	ExampleCompilation()
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Compiler flags.
+//
+// CompilerConfig.CompilerFlags holds command-line style flags, which take
+// precedence over the fields of the configuration. A valued flag is written
+// "--name=value" or "--name value", and a later occurrence overrides an
+// earlier one; a boolean flag is just "--name". Compilation fails on an
+// unknown flag, a valued flag without a value or a boolean flag with one.
+
+// maxOptimizationLevel is the highest optimization level, at which every
+// pass runs
+const maxOptimizationLevel = 3
+
+// valuedFlags are the compiler flags taking a value
+var valuedFlags = map[string]bool{
+	abiBaselineFlag: true, contractVersionFlag: true, addressStrategyFlag: true, buildModeFlag: true,
+	diagnosticFlag: true, dialectFlag: true, standardFlag: true, optimizeForFlag: true,
+	profileFeedbackFlag: true, pricingFlag: true, storagePrefixFlag: true, switchSearchFlag: true,
+	updateOwnerFlag: true,
+}
+
+// booleanFlags are the compiler flags taking no value
+var booleanFlags = map[string]bool{
+	failOnABIBreakFlag: true, zeroCallValueFlag: true, canaryFlag: true, warnAsErrorFlag: true,
+	stubGasBuiltinsFlag: true, renameManifestNamesFlag: true,
+}
+
+// CompilerFlagErrors returns the problems of the compiler flags and the
+// optimization level of config
+func CompilerFlagErrors(config CompilerConfig) []error {
+	var errs []error
+	if config.OptimizationLevel < 0 || config.OptimizationLevel > maxOptimizationLevel {
+		errs = append(errs, fmt.Errorf("invalid optimization level %d (expected 0 to %d)", config.OptimizationLevel, maxOptimizationLevel))
+	}
+	flags := config.CompilerFlags
+	for i := 0; i < len(flags); i++ {
+		name, _, valued := strings.Cut(flags[i], "=")
+		switch {
+		case valuedFlags[name] && !valued && i+1 == len(flags):
+			errs = append(errs, fmt.Errorf("compiler flag %s needs a value", name))
+		case valuedFlags[name] && !valued:
+			i++
+		case booleanFlags[name] && valued:
+			errs = append(errs, fmt.Errorf("compiler flag %s takes no value", name))
+		case !valuedFlags[name] && !booleanFlags[name]:
+			errs = append(errs, fmt.Errorf("unknown compiler flag %q", flags[i]))
+		}
+	}
+	return errs
+}
+
+// flagValues returns the values flags give the valued flag name, in order
+func flagValues(flags []string, name string) []string {
+	var values []string
+	for i := 0; i < len(flags); i++ {
+		switch {
+		case strings.HasPrefix(flags[i], name+"="):
+			values = append(values, strings.TrimPrefix(flags[i], name+"="))
+		case flags[i] == name && i+1 < len(flags):
+			values = append(values, flags[i+1])
+			i++
+		}
+	}
+	return values
+}
+
+// flagValue returns the value the last occurrence of the valued flag name
+// gives in flags, or value when there is none
+func flagValue(flags []string, name, value string) string {
+	if values := flagValues(flags, name); len(values) > 0 {
+		return values[len(values)-1]
+	}
+	return value
+}
+
+// flagSet reports whether flags hold the boolean flag name
+func flagSet(flags []string, name string) bool {
+	for _, flag := range flags {
+		if flag == name {
+			return true
+		}
+	}
+	return false
+}
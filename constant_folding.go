@@ -0,0 +1,181 @@
+package main
+
+import "math/big"
+
+// ConstantFoldingPass evaluates pure built-ins whose arguments are
+// literals, e.g. add(1, 2) becomes 3, drops the identity operand of
+// arithmetic, e.g. mul(x, 1) becomes x, and propagates literals bound by let
+// to the uses of variables that are never assigned.
+type ConstantFoldingPass struct {
+	Folded int // Expressions replaced by the last Apply
+}
+
+// NewConstantFoldingPass creates the pass
+func NewConstantFoldingPass() *ConstantFoldingPass {
+	return &ConstantFoldingPass{}
+}
+
+func (p *ConstantFoldingPass) Name() string       { return "constant_folding" }
+func (p *ConstantFoldingPass) RequiredLevel() int { return 1 }
+
+// Apply folds every object and function of the AST
+func (p *ConstantFoldingPass) Apply(ast *YulAST) (*YulAST, error) {
+	p.Folded = 0
+	var foldObject func(obj *YulObject)
+	foldObject = func(obj *YulObject) {
+		if obj.Code != nil {
+			p.foldScope(obj.Code)
+		}
+		for _, nested := range obj.Objects.Values() {
+			foldObject(nested)
+		}
+	}
+	for _, obj := range ast.Objects {
+		foldObject(obj)
+	}
+	for _, def := range ast.Functions {
+		p.foldScope(def.Body)
+	}
+	return ast, nil
+}
+
+// foldScope folds the code of an object or a function body, which sees no
+// variables of the code around it
+func (p *ConstantFoldingPass) foldScope(body *YulBlock) {
+	// A variable assigned anywhere in the scope is not constant
+	assigned := make(map[string]bool)
+	walkBlock(body, func(block *YulBlock) {
+		for _, stmt := range block.Statements {
+			if assignment, ok := stmt.(*YulAssignment); ok {
+				for _, name := range assignment.VariableNames {
+					assigned[name] = true
+				}
+			}
+		}
+	})
+	p.foldBlock(body, nil, assigned)
+}
+
+// foldBlock folds the statements of block with the constants of the
+// enclosing blocks and returns the constants visible at its end
+func (p *ConstantFoldingPass) foldBlock(block *YulBlock, outer map[string]*big.Int, assigned map[string]bool) map[string]*big.Int {
+	constants := make(map[string]*big.Int, len(outer))
+	for name, value := range outer {
+		constants[name] = value
+	}
+	if block == nil {
+		return constants
+	}
+
+	for _, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *YulFunctionDef:
+			p.foldScope(s.Body)
+			continue
+		case *YulFor:
+			// Variables of the init block are visible in the rest of the loop
+			loop := p.foldBlock(s.Init, constants, assigned)
+			s.Condition = p.fold(s.Condition, loop)
+			p.foldBlock(s.Body, loop, assigned)
+			p.foldBlock(s.Post, loop, assigned)
+			continue
+		}
+		for _, slot := range statementExpressions(stmt) {
+			*slot = p.fold(*slot, constants)
+		}
+		for _, nested := range statementBlocks(stmt) {
+			p.foldBlock(nested, constants, assigned)
+		}
+
+		let, ok := stmt.(*YulVariableDeclaration)
+		if !ok || len(let.Variables) != 1 || assigned[let.Variables[0].Name] {
+			continue
+		}
+		if lit, ok := let.Value.(*YulLiteral); ok {
+			if value, err := ParseYulLiteralValue(lit); err == nil {
+				constants[let.Variables[0].Name] = value
+			}
+		}
+	}
+	return constants
+}
+
+// fold rewrites expr bottom-up with the given constants
+func (p *ConstantFoldingPass) fold(expr YulExpression, constants map[string]*big.Int) YulExpression {
+	if expr == nil {
+		return nil
+	}
+	return rewriteExpression(expr, func(e YulExpression) YulExpression {
+		switch e := e.(type) {
+		case *YulIdentifier:
+			if value, ok := constants[e.Name]; ok {
+				p.Folded++
+				return NewWordLiteral(value, e.Location)
+			}
+		case *YulFunctionCall:
+			if folded := p.foldCall(e); folded != nil {
+				p.Folded++
+				return folded
+			}
+		}
+		return e
+	})
+}
+
+// foldCall returns the simplified form of call, nil when there is none
+func (p *ConstantFoldingPass) foldCall(call *YulFunctionCall) YulExpression {
+	name := call.FunctionName.Name
+	if !isPureBuiltin(name) {
+		return nil
+	}
+	if args, ok := literalArguments(call); ok {
+		value, err := EvaluatePureBuiltin(name, args)
+		if err != nil {
+			return nil
+		}
+		return NewWordLiteral(value, call.Location)
+	}
+	if len(call.Arguments) != 2 {
+		return nil
+	}
+
+	// Identities keep the other operand, so its side effects stay
+	literal := func(i int, want int64) bool {
+		lit, ok := call.Arguments[i].(*YulLiteral)
+		if !ok {
+			return false
+		}
+		value, err := ParseYulLiteralValue(lit)
+		return err == nil && value.Cmp(big.NewInt(want)) == 0
+	}
+	switch name {
+	case "add", "or", "xor":
+		if literal(1, 0) {
+			return call.Arguments[0]
+		}
+		if literal(0, 0) {
+			return call.Arguments[1]
+		}
+	case "mul":
+		if literal(1, 1) {
+			return call.Arguments[0]
+		}
+		if literal(0, 1) {
+			return call.Arguments[1]
+		}
+	case "sub":
+		if literal(1, 0) {
+			return call.Arguments[0]
+		}
+	case "div", "sdiv":
+		if literal(1, 1) {
+			return call.Arguments[0]
+		}
+	case "shl", "shr", "sar":
+		// The shift amount comes first
+		if literal(0, 0) {
+			return call.Arguments[1]
+		}
+	}
+	return nil
+}
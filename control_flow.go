@@ -0,0 +1,145 @@
+package main
+
+import "fmt"
+
+// Structured exits for leave, break and continue.
+//
+// Every function has a single exit: leave jumps to the exit label, where the
+// function's exit hooks run before the only RET. break and continue jump to
+// the labels of the innermost loop. Switch values still on the stack at the
+// point of the jump are dropped first, so every path reaches its target with
+// the stack the target expects.
+
+// FunctionHook injects code around a function body. Enter runs at function
+// entry, Exit on every path that returns, including leave from nested loops
+// and switches. Either may be nil.
+type FunctionHook struct {
+	Name  string
+	Enter func(g *CodeGenerator, location SourcePosition)
+	Exit  func(g *CodeGenerator, location SourcePosition)
+}
+
+// functionFrame is the function being generated
+type functionFrame struct {
+	name      string
+	exitLabel string
+}
+
+// loopFrame is an enclosing for loop
+type loopFrame struct {
+	breakLabel    string
+	continueLabel string
+	stackItems    int // Switch values on the stack when the loop was entered
+}
+
+// AddFunctionHook registers a hook for the named function. Exit hooks run in
+// reverse registration order, like deferred calls.
+func (g *CodeGenerator) AddFunctionHook(function string, hook FunctionHook) {
+	if g.functionHooks == nil {
+		g.functionHooks = make(map[string][]FunctionHook)
+	}
+	g.functionHooks[function] = append(g.functionHooks[function], hook)
+}
+
+// NewReentrancyGuard returns a hook that aborts when the function is entered
+// while already running and releases the lock on every exit
+func NewReentrancyGuard(key string) FunctionHook {
+	return FunctionHook{
+		Name: "reentrancy_guard",
+		Enter: func(g *CodeGenerator, location SourcePosition) {
+			unlocked := g.createUniqueLabel("guard_unlocked")
+			g.emitInstruction(NewPushInstruction(CreateNeoVMByteString(key)), location)
+			g.emitStorageContext(location)
+			g.emitInstruction(NewSyscallInstruction("System.Storage.Get"), location)
+			g.emitInstruction(NewControlFlowInstruction(JMPIFNOT, 0), location)
+			g.addPendingLabel(unlocked, len(g.instructions)-1)
+			g.emitInstruction(NeoInstruction{Opcode: ABORT, Size: 1}, location)
+			g.markLabel(unlocked)
+
+			g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(1)), location)
+			g.emitInstruction(NewPushInstruction(CreateNeoVMByteString(key)), location)
+			g.emitStorageContext(location)
+			g.emitInstruction(NewSyscallInstruction("System.Storage.Put"), location)
+		},
+		Exit: func(g *CodeGenerator, location SourcePosition) {
+			g.emitInstruction(NewPushInstruction(CreateNeoVMByteString(key)), location)
+			g.emitStorageContext(location)
+			g.emitInstruction(NewSyscallInstruction("System.Storage.Delete"), location)
+		},
+	}
+}
+
+// enterFunction starts a function frame and emits its entry hooks. The
+// returned function restores the enclosing state.
+func (g *CodeGenerator) enterFunction(def *YulFunctionDef) func() {
+	outerFrame, outerLoops, outerItems := g.frame, g.loops, g.stackItems
+	g.frame = &functionFrame{name: def.Name, exitLabel: g.createUniqueLabel("func_exit_" + def.Name)}
+	g.loops, g.stackItems = nil, 0
+
+	for _, hook := range g.functionHooks[def.Name] {
+		if hook.Enter != nil {
+			hook.Enter(g, def.Location)
+		}
+	}
+	return func() {
+		g.frame, g.loops, g.stackItems = outerFrame, outerLoops, outerItems
+	}
+}
+
+// emitFunctionExit emits the single exit of the current function: exit
+// hooks, then the return values, last first so the first one ends up on
+// top, then RET
+func (g *CodeGenerator) emitFunctionExit(def *YulFunctionDef) {
+	g.markLabel(g.frame.exitLabel)
+	hooks := g.functionHooks[def.Name]
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if hooks[i].Exit != nil {
+			hooks[i].Exit(g, def.Location)
+		}
+	}
+	for i := len(def.Returns) - 1; i >= 0; i-- {
+		if symbol, ok := g.symbols.Lookup(def.Returns[i].Name); ok {
+			g.emitLoad(symbol, def.Location)
+		}
+	}
+	g.emitInstruction(NewControlFlowInstruction(RET, 0), def.Location)
+}
+
+// emitExitJump drops the values held by enclosing switches down to
+// stackItems and jumps to label. The stack depth tracked for the code that
+// follows is left unchanged, since the jump does not fall through.
+func (g *CodeGenerator) emitExitJump(label string, stackItems int, location SourcePosition) {
+	depth := g.stackTracker.currentDepth
+	for i := stackItems; i < g.stackItems; i++ {
+		g.emitInstruction(NewStackInstruction(DROP), location)
+	}
+	g.emitInstruction(NewControlFlowInstruction(JMP, 0), location)
+	g.addPendingLabel(label, len(g.instructions)-1)
+	g.stackTracker.currentDepth = depth
+}
+
+func (g *CodeGenerator) generateBreak(stmt *YulBreak) error {
+	if len(g.loops) == 0 {
+		return fmt.Errorf("break outside of a for loop at line %d", stmt.Location.Line)
+	}
+	loop := g.loops[len(g.loops)-1]
+	g.emitExitJump(loop.breakLabel, loop.stackItems, stmt.Location)
+	return nil
+}
+
+func (g *CodeGenerator) generateContinue(stmt *YulContinue) error {
+	if len(g.loops) == 0 {
+		return fmt.Errorf("continue outside of a for loop at line %d", stmt.Location.Line)
+	}
+	loop := g.loops[len(g.loops)-1]
+	g.emitExitJump(loop.continueLabel, loop.stackItems, stmt.Location)
+	return nil
+}
+
+func (g *CodeGenerator) generateLeave(stmt *YulLeave) error {
+	if g.frame == nil {
+		return fmt.Errorf("leave outside of a function at line %d", stmt.Location.Line)
+	}
+	g.emitExitJump(g.frame.exitLabel, 0, stmt.Location)
+	return nil
+}
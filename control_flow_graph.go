@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Control flow graphs.
+//
+// The static analyzer builds one graph over the code of every object and
+// the body of every function, each with an entry and an exit node of its
+// own. A statement is a node; if, switch and for are nodes for their
+// condition, with the bodies as successors. An edge taken on a condition
+// carries it: the if condition or iszero of it, eq of the switch value and
+// a case, the loop condition or iszero of it. The edge of a switch without
+// a matching case carries none. break, continue and leave jump to the end
+// of the loop, its post block and the function exit; revert, return, stop,
+// invalid and selfdestruct end at the exit. Functions defined in a block
+// are not nodes of it.
+
+// terminatingBuiltins are the built-ins that end execution
+var terminatingBuiltins = map[string]bool{
+	"revert": true, "return": true, "stop": true, "invalid": true, "selfdestruct": true,
+}
+
+// cfgEdge is an edge whose target is not known yet
+type cfgEdge struct {
+	from      *CFGNode
+	condition YulExpression
+}
+
+// cfgLoop collects the break and continue edges of a loop
+type cfgLoop struct {
+	breaks    []cfgEdge
+	continues []cfgEdge
+}
+
+// cfgBuilder adds the nodes of one body to a graph
+type cfgBuilder struct {
+	graph   *ControlFlowGraph
+	exit    *CFGNode
+	loops   []*cfgLoop
+	printer *YulPrinter
+}
+
+// cfgBody is the code of an object or the body of a function
+type cfgBody struct {
+	name     string
+	block    *YulBlock
+	function *YulFunctionDef // nil for object code
+}
+
+// controlFlowBodies lists the code of every object, then every function
+// body, in the order of the graph's entries
+func controlFlowBodies(ast *YulAST) []cfgBody {
+	var bodies []cfgBody
+	var addObject func(obj *YulObject)
+	addObject = func(obj *YulObject) {
+		bodies = append(bodies, cfgBody{name: "object " + obj.Name, block: obj.Code})
+		for _, nested := range obj.Objects.Values() {
+			addObject(nested)
+		}
+	}
+	for _, obj := range ast.Objects {
+		addObject(obj)
+	}
+	forEachFunctionDef(ast, func(fn *YulFunctionDef) {
+		bodies = append(bodies, cfgBody{name: "function " + fn.Name, block: fn.Body, function: fn})
+	})
+	return bodies
+}
+
+// buildControlFlowGraph builds the graph of every object's code and
+// function body
+func (sa *StaticAnalyzer) buildControlFlowGraph(ast *YulAST) (*ControlFlowGraph, error) {
+	return newControlFlowGraph(ast), nil
+}
+
+func newControlFlowGraph(ast *YulAST) *ControlFlowGraph {
+	cfg := &ControlFlowGraph{
+		Nodes:     []*CFGNode{},
+		Edges:     []*CFGEdge{},
+		ExitNodes: []*CFGNode{},
+	}
+	for _, body := range controlFlowBodies(ast) {
+		cfg.addBody(body.name, body.block)
+	}
+	if len(cfg.Entries) > 0 {
+		cfg.EntryNode = cfg.Entries[0]
+	}
+	return cfg
+}
+
+// addBody adds the entry, the statements and the exit of a body
+func (cfg *ControlFlowGraph) addBody(name string, body *YulBlock) {
+	b := &cfgBuilder{graph: cfg, printer: NewYulPrinter("")}
+	entry := b.node(CFGNodeEntry, nil, "entry "+name)
+	b.exit = &CFGNode{Type: CFGNodeExit, Label: "exit " + name}
+	out := b.block(body, []cfgEdge{{from: entry}})
+	b.exit.ID = len(cfg.Nodes)
+	cfg.Nodes = append(cfg.Nodes, b.exit)
+	b.connect(out, b.exit)
+	cfg.Entries = append(cfg.Entries, entry)
+	cfg.ExitNodes = append(cfg.ExitNodes, b.exit)
+}
+
+func (b *cfgBuilder) node(kind CFGNodeType, stmt YulStatement, label string) *CFGNode {
+	node := &CFGNode{ID: len(b.graph.Nodes), Type: kind, Statement: stmt, Label: label}
+	b.graph.Nodes = append(b.graph.Nodes, node)
+	return node
+}
+
+// connect adds the pending edges to target
+func (b *cfgBuilder) connect(edges []cfgEdge, target *CFGNode) {
+	for _, e := range edges {
+		b.graph.Edges = append(b.graph.Edges, &CFGEdge{From: e.from, To: target, Condition: e.condition})
+		e.from.Successors = append(e.from.Successors, target)
+		target.Predecessors = append(target.Predecessors, e.from)
+	}
+}
+
+// block adds the statements of block entered by edges and returns the
+// edges leaving it at its end
+func (b *cfgBuilder) block(block *YulBlock, edges []cfgEdge) []cfgEdge {
+	if block == nil {
+		return edges
+	}
+	for _, stmt := range block.Statements {
+		edges = b.statement(stmt, edges)
+	}
+	return edges
+}
+
+func (b *cfgBuilder) statement(stmt YulStatement, edges []cfgEdge) []cfgEdge {
+	switch s := stmt.(type) {
+	case *YulFunctionDef:
+		return edges
+	case *YulBlock:
+		return b.block(s, edges)
+	case *YulIf:
+		node := b.node(CFGNodeCondition, s, "if "+b.printer.PrintExpression(s.Condition))
+		b.connect(edges, node)
+		out := b.block(s.Body, []cfgEdge{{node, s.Condition}})
+		return append(out, cfgEdge{node, builtinCall("iszero", s.Location, s.Condition)})
+	case *YulSwitch:
+		node := b.node(CFGNodeCondition, s, "switch "+b.printer.PrintExpression(s.Expression))
+		b.connect(edges, node)
+		var out []cfgEdge
+		for _, c := range s.Cases {
+			value := c.Value
+			out = append(out, b.block(c.Body, []cfgEdge{{node, builtinCall("eq", c.Location, s.Expression, &value)}})...)
+		}
+		return append(out, b.block(s.Default, []cfgEdge{{from: node}})...)
+	case *YulFor:
+		edges = b.block(s.Init, edges)
+		node := b.node(CFGNodeLoop, s, "for "+b.printer.PrintExpression(s.Condition))
+		b.connect(edges, node)
+		loop := &cfgLoop{}
+		b.loops = append(b.loops, loop)
+		body := b.block(s.Body, []cfgEdge{{node, s.Condition}})
+		b.loops = b.loops[:len(b.loops)-1]
+		b.connect(b.block(s.Post, append(body, loop.continues...)), node)
+		return append(loop.breaks, cfgEdge{node, builtinCall("iszero", s.Location, s.Condition)})
+	}
+
+	node := b.node(CFGNodeStatement, stmt, b.statementLabel(stmt))
+	b.connect(edges, node)
+	switch s := stmt.(type) {
+	case *YulBreak:
+		if len(b.loops) > 0 {
+			loop := b.loops[len(b.loops)-1]
+			loop.breaks = append(loop.breaks, cfgEdge{from: node})
+		}
+		return nil
+	case *YulContinue:
+		if len(b.loops) > 0 {
+			loop := b.loops[len(b.loops)-1]
+			loop.continues = append(loop.continues, cfgEdge{from: node})
+		}
+		return nil
+	case *YulLeave:
+		b.connect([]cfgEdge{{from: node}}, b.exit)
+		return nil
+	case *YulExpressionStatement:
+		if call, ok := s.Expression.(*YulFunctionCall); ok && terminatingBuiltins[call.FunctionName.Name] {
+			b.connect([]cfgEdge{{from: node}}, b.exit)
+			return nil
+		}
+	}
+	return []cfgEdge{{from: node}}
+}
+
+// statementLabel prints a statement without nested blocks on one line
+func (b *cfgBuilder) statementLabel(stmt YulStatement) string {
+	text := b.printer.PrintBlock(&YulBlock{Statements: []YulStatement{stmt}})
+	text = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(text), "{"), "}"))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// builtinCall builds a call of a built-in for edge conditions
+func builtinCall(name string, location SourcePosition, args ...YulExpression) *YulFunctionCall {
+	return &YulFunctionCall{
+		FunctionName: YulIdentifier{Name: name, Location: location},
+		Arguments:    args,
+		Location:     location,
+	}
+}
+
+// DOT renders the graph in the Graphviz DOT language, e.g. for
+// dot -Tsvg. Conditional edges are labeled with their condition.
+func (cfg *ControlFlowGraph) DOT() string {
+	var sb strings.Builder
+	printer := NewYulPrinter("")
+	sb.WriteString("digraph cfg {\n\tnode [shape=box];\n")
+	for _, node := range cfg.Nodes {
+		shape := ""
+		switch node.Type {
+		case CFGNodeEntry, CFGNodeExit:
+			shape = ", shape=oval"
+		case CFGNodeCondition, CFGNodeLoop:
+			shape = ", shape=diamond"
+		}
+		fmt.Fprintf(&sb, "\tn%d [label=%s%s];\n", node.ID, strconv.Quote(node.Label), shape)
+	}
+	for _, edge := range cfg.Edges {
+		if edge.Condition != nil {
+			fmt.Fprintf(&sb, "\tn%d -> n%d [label=%s];\n", edge.From.ID, edge.To.ID, strconv.Quote(printer.PrintExpression(edge.Condition)))
+		} else {
+			fmt.Fprintf(&sb, "\tn%d -> n%d;\n", edge.From.ID, edge.To.ID)
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// Contract creation.
+//
+// create(v, p, n) and create2(v, p, n, s) deploy a contract through
+// ContractManagement.deploy and return the address word of its script
+// hash, which external calls map back to the same hash. The memory range [p, p+n) holds the deployment payload
+// instead of EVM init code: the binary serialization (StdLib.serialize) of
+// the array [nef, manifest], with the NEF file and manifest JSON as byte
+// strings.
+//
+// Neo derives the hash from the transaction sender, the NEF checksum and
+// the manifest name, not from the creating contract. create2 maps the salt
+// onto the name: the child is deployed with "_" and the salt in hex
+// (StdLib.itoa(s, 16)) appended to its manifest name, so each salt yields
+// its own address and reusing one fails, as in the EVM. A create whose
+// deployment faults returns 0. Values cannot be attached; a value other than
+// 0 draws a warning.
+
+// Script hashes of the native contracts, as displayed
+const (
+	ContractManagementHash = "0xfffdc93764dbaddd97c48f252a53ea4643faa3fd"
+	StdLibHash             = "0xacce6fd80d44e1796aa0c2c625e9e4e0ce39efc0"
+	CryptoLibHash          = "0x726cb6e0cd8628a1350a611384688911ab75f51b"
+)
+
+// contractCreate is the routine deploying contracts
+const contractCreate = "contract_create"
+
+// Flags for ContractManagement.deploy, update and destroy, States |
+// AllowNotify
+const callFlagsDeploy = 0x0B
+
+// scriptHashBytes returns the little-endian bytes of a displayed script hash
+func scriptHashBytes(hash string) []byte {
+	bytes, err := hex.DecodeString(hash[2:])
+	if err != nil {
+		panic(fmt.Sprintf("invalid script hash %s", hash))
+	}
+	for i, j := 0, len(bytes)-1; i < j; i, j = i+1, j-1 {
+		bytes[i], bytes[j] = bytes[j], bytes[i]
+	}
+	return bytes
+}
+
+// generateCreate emits create or create2 with its arguments on the stack,
+// first on top
+func (g *CodeGenerator) generateCreate(call *YulFunctionCall) error {
+	name := call.FunctionName.Name
+	want := 3
+	if name == "create2" {
+		want = 4
+	}
+	if len(call.Arguments) != want {
+		return fmt.Errorf("%s expects %d arguments, got %d at line %d", name, want, len(call.Arguments), call.Location.Line)
+	}
+	location := call.Location
+	if !isZeroLiteral(call.Arguments[0]) {
+		g.warn(fmt.Sprintf("%s value is not transferred at line %d", name, location.Line), location)
+	}
+
+	// salted, salt, offset, length
+	g.emitInstruction(NewStackInstruction(DROP), location)
+	if name == "create2" {
+		g.emitInstruction(NewStackInstruction(ROT), location)
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(1)), location)
+	} else {
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(0)), location)
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(0)), location)
+	}
+	g.emitMemoryCall(contractCreate, 4, 1, location)
+	return nil
+}
+
+// callNative calls a native contract method with its count arguments on
+// the stack, first on top
+func (c memoryCode) callNative(hash, method string, count, flags int) {
+	c.g.permit(hash, method)
+	c.push(count)
+	pack := NewArithmeticInstruction(PACK)
+	pack.StackPop, pack.StackPush = count+1, 1
+	c.op(pack)
+	c.push(flags)
+	c.op(NewPushInstruction(CreateNeoVMByteString(method)))
+	c.op(NewPushInstruction(CreateNeoVMByteString(scriptHashBytes(hash))))
+	c.op(NewSyscallInstruction("System.Contract.Call"))
+}
+
+// emitContractCreate deploys the payload and returns the address, or 0.
+// Arguments: salted, salt, offset, length; locals: payload, manifest.
+func (g *CodeGenerator) emitContractCreate(location SourcePosition) {
+	c := memoryCode{g, location}
+	ld := func(i int) { c.op(NewSlotInstruction(LDLOC, i)) }
+	st := func(i int) { c.op(NewSlotInstruction(STLOC, i)) }
+	deploy := g.createUniqueLabel("contract_create_deploy")
+	caught := g.createUniqueLabel("contract_create_caught")
+	failed := g.createUniqueLabel("contract_create_failed")
+	end := g.createUniqueLabel("contract_create_end")
+
+	g.emitTry(caught, failed, location)
+
+	c.arg(3)
+	c.arg(2)
+	c.call(memorySlice, 2, 1)
+	c.callNative(StdLibHash, "deserialize", 1, 0)
+	st(0)
+
+	// manifest.name += "_" + itoa(salt, 16)
+	c.arg(0)
+	c.jump(JMPIFNOT, deploy)
+	ld(0)
+	c.push(1)
+	c.arithmetic(PICKITEM)
+	c.callNative(StdLibHash, "jsonDeserialize", 1, 0)
+	st(1)
+	ld(1)
+	c.op(NewPushInstruction(CreateNeoVMByteString("name")))
+	ld(1)
+	c.op(NewPushInstruction(CreateNeoVMByteString("name")))
+	c.arithmetic(PICKITEM)
+	c.op(NewPushInstruction(CreateNeoVMByteString("_")))
+	c.arithmetic(CAT)
+	c.push(16)
+	c.arg(1)
+	c.callNative(StdLibHash, "itoa", 2, 0)
+	c.arithmetic(CAT)
+	c.op(NewConvertInstruction(ByteStringType))
+	c.arithmetic(SETITEM)
+	ld(0)
+	c.push(1)
+	ld(1)
+	c.callNative(StdLibHash, "jsonSerialize", 1, 0)
+	c.arithmetic(SETITEM)
+
+	g.markLabel(deploy)
+	ld(0)
+	c.push(1)
+	c.arithmetic(PICKITEM)
+	ld(0)
+	c.push(0)
+	c.arithmetic(PICKITEM)
+	c.callNative(ContractManagementHash, "deploy", 2, callFlagsDeploy)
+
+	// The hash is the third field of the contract state
+	c.push(2)
+	c.arithmetic(PICKITEM)
+	c.addressWord()
+	c.jump(ENDTRY, end)
+
+	g.markLabel(caught)
+	c.op(NewStackInstruction(DROP))
+	c.jump(ENDTRY, failed)
+
+	g.markLabel(failed)
+	c.push(0)
+	g.markLabel(end)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Data flow analysis.
+//
+// Variables are resolved through the scopes of each body: a parameter, a
+// return variable or a let declaration is a variable of its own, even when
+// a sibling block reuses the name. Definitions are the declarations,
+// assignments and parameters; a declaration without a value and a return
+// variable define the zero value. Uses are the identifiers read by a
+// statement, and the return variables at the exit of a function.
+// Reaching definitions over the control flow graph link each use to the
+// definitions it may read, which the diagnostics are derived from:
+//
+//   - a use reached by a zero definition may read the variable before it
+//     is assigned (the exit of a function returning zero is not reported)
+//   - a definition reaching no use assigns a value that is never read
+//   - a declaration of a name visible in an enclosing scope shadows it
+//
+// Unreachable code is not reported.
+
+// Data flow diagnostics
+const (
+	dataFlowPhase = "Static Analysis"
+)
+
+// dataFlowNames resolves the names of one body
+type dataFlowNames struct {
+	scope     string
+	scopes    []map[string]*Variable
+	declared  map[*YulTypedName]*Variable
+	read      map[*YulIdentifier]*Variable
+	assigned  map[*YulAssignment][]*Variable
+	lines     map[*Variable]SourcePosition
+	variables []*Variable // In declaration order
+	warnings  []CompilerWarning
+}
+
+// buildDataFlowGraph links the uses and definitions of the variables of
+// every body of cfg
+func (sa *StaticAnalyzer) buildDataFlowGraph(ast *YulAST, cfg *ControlFlowGraph) (*DataFlowGraph, []CompilerWarning) {
+	graph := &DataFlowGraph{Variables: []*Variable{}, Uses: []*VariableUse{}, Defs: []*VariableDef{}}
+	var warnings []CompilerWarning
+	for i, body := range controlFlowBodies(ast) {
+		names := &dataFlowNames{
+			scope:    body.name,
+			declared: make(map[*YulTypedName]*Variable),
+			read:     make(map[*YulIdentifier]*Variable),
+			assigned: make(map[*YulAssignment][]*Variable),
+			lines:    make(map[*Variable]SourcePosition),
+		}
+		names.push()
+		if fn := body.function; fn != nil {
+			for _, param := range append(append([]*YulTypedName(nil), fn.Parameters...), fn.Returns...) {
+				names.declare(param)
+			}
+		}
+		names.statements(body.block)
+		warnings = append(warnings, names.warnings...)
+		graph.Variables = append(graph.Variables, names.variables...)
+		warnings = append(warnings, graph.addBody(names, body, cfg.Entries[i], cfg.ExitNodes[i])...)
+	}
+	sort.SliceStable(warnings, func(i, j int) bool {
+		if warnings[i].Line != warnings[j].Line {
+			return warnings[i].Line < warnings[j].Line
+		}
+		return warnings[i].Column < warnings[j].Column
+	})
+	return graph, warnings
+}
+
+func (n *dataFlowNames) push() { n.scopes = append(n.scopes, make(map[string]*Variable)) }
+func (n *dataFlowNames) pop()  { n.scopes = n.scopes[:len(n.scopes)-1] }
+
+func (n *dataFlowNames) lookup(name string) *Variable {
+	for i := len(n.scopes) - 1; i >= 0; i-- {
+		if variable, ok := n.scopes[i][name]; ok {
+			return variable
+		}
+	}
+	return nil
+}
+
+// declare defines a variable in the innermost scope
+func (n *dataFlowNames) declare(name *YulTypedName) {
+	if outer := n.lookup(name.Name); outer != nil {
+		n.warnings = append(n.warnings, dataFlowWarning(CodeShadowing, name.Location,
+			"declaration of %s shadows the one at line %d", name.Name, n.lines[outer].Line))
+		shadowed := &n.warnings[len(n.warnings)-1]
+		shadowed.Related = append(shadowed.Related, relatedNote(n.lines[outer], "shadowed declaration"))
+	}
+	variable := &Variable{Name: name.Name, Type: name.Type, Scope: n.scope}
+	n.scopes[len(n.scopes)-1][name.Name] = variable
+	n.declared[name] = variable
+	n.lines[variable] = name.Location
+	n.variables = append(n.variables, variable)
+}
+
+// dataFlowWarning reports a finding of the analysis at location
+func dataFlowWarning(code string, location SourcePosition, format string, args ...interface{}) CompilerWarning {
+	return CompilerWarning{
+		Phase:   dataFlowPhase,
+		Message: fmt.Sprintf(format, args...),
+		File:    diagnosticFile(location),
+		Line:    location.Line,
+		Column:  location.Column,
+		Length:  location.Length,
+		Code:    code,
+	}
+}
+
+// expression resolves the identifiers expr reads
+func (n *dataFlowNames) expression(expr YulExpression) {
+	walkExpression(expr, func(e YulExpression) {
+		if id, ok := e.(*YulIdentifier); ok {
+			if variable := n.lookup(id.Name); variable != nil {
+				n.read[id] = variable
+			}
+		}
+	})
+}
+
+// block resolves the names of block in a scope of its own
+func (n *dataFlowNames) block(block *YulBlock) {
+	n.push()
+	n.statements(block)
+	n.pop()
+}
+
+func (n *dataFlowNames) statements(block *YulBlock) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *YulFunctionDef:
+			// Resolved as a body of its own
+		case *YulVariableDeclaration:
+			// The variables come into scope after their value
+			n.expression(s.Value)
+			for _, variable := range s.Variables {
+				n.declare(variable)
+			}
+		case *YulAssignment:
+			n.expression(s.Value)
+			for _, name := range s.VariableNames {
+				n.assigned[s] = append(n.assigned[s], n.lookup(name))
+			}
+		case *YulFor:
+			// Variables of the init block are visible in the rest of the loop
+			n.push()
+			n.statements(s.Init)
+			n.expression(s.Condition)
+			n.block(s.Body)
+			n.block(s.Post)
+			n.pop()
+		default:
+			for _, slot := range statementExpressions(stmt) {
+				n.expression(*slot)
+			}
+			for _, nested := range statementBlocks(stmt) {
+				n.block(nested)
+			}
+		}
+	}
+}
+
+// addBody adds the uses and definitions of a body, computes the
+// definitions reaching each use and returns the diagnostics
+func (graph *DataFlowGraph) addBody(names *dataFlowNames, body cfgBody, entry, exit *CFGNode) []CompilerWarning {
+	nodes := reachableFrom(entry)
+
+	defs := make(map[*CFGNode][]*VariableDef)
+	uses := make(map[*CFGNode][]*VariableUse)
+	define := func(node *CFGNode, variable *Variable, location SourcePosition, value YulExpression, zero bool) {
+		if variable == nil {
+			return
+		}
+		def := &VariableDef{Variable: variable, Location: location, Node: node, Value: value, Zero: zero}
+		defs[node] = append(defs[node], def)
+		graph.Defs = append(graph.Defs, def)
+	}
+	use := func(node *CFGNode, variable *Variable, location SourcePosition) {
+		u := &VariableUse{Variable: variable, Location: location, Node: node}
+		uses[node] = append(uses[node], u)
+		graph.Uses = append(graph.Uses, u)
+	}
+
+	for _, node := range nodes {
+		switch node.Type {
+		case CFGNodeEntry:
+			if fn := body.function; fn != nil {
+				for _, param := range fn.Parameters {
+					define(node, names.declared[param], param.Location, nil, false)
+				}
+				for _, ret := range fn.Returns {
+					define(node, names.declared[ret], ret.Location, nil, true)
+				}
+			}
+			continue
+		case CFGNodeExit:
+			if fn := body.function; fn != nil {
+				for _, ret := range fn.Returns {
+					use(node, names.declared[ret], fn.Location)
+				}
+			}
+			continue
+		}
+		for _, slot := range statementExpressions(node.Statement) {
+			walkExpression(*slot, func(e YulExpression) {
+				if id, ok := e.(*YulIdentifier); ok && names.read[id] != nil {
+					use(node, names.read[id], id.Location)
+				}
+			})
+		}
+		switch s := node.Statement.(type) {
+		case *YulVariableDeclaration:
+			for _, variable := range s.Variables {
+				define(node, names.declared[variable], variable.Location, s.Value, s.Value == nil)
+			}
+		case *YulAssignment:
+			for _, variable := range names.assigned[s] {
+				define(node, variable, s.Location, s.Value, false)
+			}
+		}
+	}
+
+	// Reaching definitions: a node's definitions replace those of the same
+	// variables
+	in := make(map[*CFGNode]map[*VariableDef]bool, len(nodes))
+	out := make(map[*CFGNode]map[*VariableDef]bool, len(nodes))
+	for changed := true; changed; {
+		changed = false
+		for _, node := range nodes {
+			reaching := make(map[*VariableDef]bool)
+			for _, pred := range node.Predecessors {
+				for def := range out[pred] {
+					reaching[def] = true
+				}
+			}
+			in[node] = reaching
+			leaving := make(map[*VariableDef]bool, len(reaching))
+			for def := range reaching {
+				killed := false
+				for _, own := range defs[node] {
+					killed = killed || own.Variable == def.Variable
+				}
+				if !killed {
+					leaving[def] = true
+				}
+			}
+			for _, def := range defs[node] {
+				leaving[def] = true
+			}
+			if len(leaving) != len(out[node]) {
+				changed = true
+			}
+			out[node] = leaving
+		}
+	}
+
+	var warnings []CompilerWarning
+	warn := func(code string, location SourcePosition, format string, args ...interface{}) {
+		warnings = append(warnings, dataFlowWarning(code, location, format, args...))
+	}
+	read := make(map[*Variable]bool)
+	for _, node := range nodes {
+		for _, u := range uses[node] {
+			zero := false
+			for def := range in[node] {
+				if def.Variable == u.Variable {
+					u.Defs = append(u.Defs, def)
+					def.Uses = append(def.Uses, u)
+					zero = zero || def.Zero
+				}
+			}
+			sort.Slice(u.Defs, func(i, j int) bool { return u.Defs[i].Node.ID < u.Defs[j].Node.ID })
+			if node.Type != CFGNodeExit {
+				read[u.Variable] = true
+				if zero {
+					warn(CodeUnassignedRead, u.Location, "variable %s may be read before it is assigned, reading zero", u.Variable.Name)
+				}
+			}
+		}
+	}
+	for _, node := range nodes {
+		for _, def := range defs[node] {
+			switch {
+			case len(def.Uses) > 0 || def.Node.Type == CFGNodeEntry:
+			case !read[def.Variable]:
+				// Reported once, at the declaration
+				if isDeclaration(def.Node.Statement) {
+					warn(CodeUnusedVariable, def.Location, "variable %s is never read", def.Variable.Name)
+				}
+			case !def.Zero:
+				warn(CodeUnusedAssignment, def.Location, "value assigned to %s is never read", def.Variable.Name)
+			}
+		}
+	}
+	return warnings
+}
+
+func isDeclaration(stmt YulStatement) bool {
+	_, ok := stmt.(*YulVariableDeclaration)
+	return ok
+}
@@ -0,0 +1,910 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Debug adapter.
+//
+// DebugSession steps a compiled contract through the execution engine by
+// Yul source line. The sequence points of its NEP-19 debug information are
+// where execution stops: a breakpoint is set on the line of a sequence
+// point, and stepping runs to the next sequence point on another line, of
+// the same routine or a caller when stepping over, of any routine when
+// stepping into, and of a caller when stepping out. A line is entered when
+// execution reaches one of its sequence points from another line or
+// routine, so a line with several sequence points stops once. Each stop
+// shows the invocation stack with the arguments and locals of every
+// routine, the evaluation stack, the static fields and contract storage.
+//
+// DebugAdapter serves a session over the Debug Adapter Protocol, for VS
+// Code and other editors. The debug command serves it on standard input
+// and output, or on a TCP address for an editor to attach to:
+//
+//	neo-yulc debug
+//	neo-yulc debug -listen 127.0.0.1:4711
+//
+// A launch request compiles the Yul file of "program" with debug
+// information, deploys it in a TestHost and invokes "method" with "args"
+// once the configuration is done:
+//
+//	{"program": "token.yul", "method": "transfer", "args": [1, "0x02", 100],
+//	 "exports": ["transfer"], "stopOnEntry": true}
+//
+// Arguments are JSON values; a string reading as a decimal or 0x number
+// is an integer, as Yul words are.
+
+// Reasons a resumed session stops
+const (
+	DebugStopEntry      = "entry"
+	DebugStopBreakpoint = "breakpoint"
+	DebugStopStep       = "step"
+	DebugStopException  = "exception" // The invocation FAULTed
+	DebugStopExit       = "exit"      // The invocation ended
+)
+
+// DebugStop is why a session stopped
+type DebugStop struct {
+	Reason string
+	Err    error // Fault of an invocation stopped by an exception
+}
+
+// DebugValue is a named item of a debugged invocation
+type DebugValue struct {
+	Name string
+	Item NeoVMStackItem
+}
+
+// DebugFrame is a routine of the invocation stack
+type DebugFrame struct {
+	Name      string
+	Offset    int
+	Source    SourcePosition // Of the last sequence point at or before Offset
+	Arguments []DebugValue
+	Locals    []DebugValue
+}
+
+// debugMethod is a method of the debug information with its byte range,
+// end inclusive
+type debugMethod struct {
+	name       string
+	start, end int
+	params     []string
+}
+
+// debugLine is a line of a routine being run
+type debugLine struct {
+	file  string
+	line  int
+	depth int
+}
+
+// DebugSession runs an invocation of a deployed contract under a debugger
+type DebugSession struct {
+	Host   *TestHost
+	Debug  *NeoDebugInfo
+	Method string
+	Fault  error // Fault the invocation ended with
+
+	points      []debugSequencePoint // By address
+	lines       map[string][]int     // Lines with sequence points by document
+	methods     []debugMethod        // Innermost first
+	breakpoints map[string]map[int]bool
+	notified    int // Notifications before the invocation
+	logged      int // Logs before the invocation
+}
+
+// NewDebugSession deploys contract in a test host for debugging it with
+// its NEP-19 debug information
+func NewDebugSession(contract *NeoContract, debug *NeoDebugInfo) (*DebugSession, error) {
+	s := &DebugSession{
+		Host:        NewTestHost(),
+		Debug:       debug,
+		lines:       make(map[string][]int),
+		breakpoints: make(map[string]map[int]bool),
+	}
+	for _, m := range debug.Methods {
+		method := debugMethod{name: m.Name}
+		if i := strings.IndexByte(m.Name, ','); i >= 0 {
+			method.name = m.Name[i+1:]
+		}
+		if _, err := fmt.Sscanf(m.Range, "%d-%d", &method.start, &method.end); err != nil {
+			return nil, fmt.Errorf("method %s: range %q: %w", m.ID, m.Range, err)
+		}
+		for _, param := range m.Params {
+			method.params = append(method.params, strings.SplitN(param, ",", 2)[0])
+		}
+		s.methods = append(s.methods, method)
+		for _, point := range m.SequencePoints {
+			p, err := parseSequencePoint(point, debug.Documents)
+			if err != nil {
+				return nil, fmt.Errorf("method %s: %w", m.ID, err)
+			}
+			s.points = append(s.points, p)
+			s.lines[p.ref.File] = append(s.lines[p.ref.File], p.ref.Line)
+		}
+	}
+	sort.SliceStable(s.methods, func(i, j int) bool {
+		return s.methods[i].end-s.methods[i].start < s.methods[j].end-s.methods[j].start
+	})
+	sort.Slice(s.points, func(i, j int) bool { return s.points[i].address < s.points[j].address })
+	for file, lines := range s.lines {
+		sort.Ints(lines)
+		s.lines[file] = lines
+	}
+	if err := s.Host.Deploy(contract); err != nil {
+		return nil, fmt.Errorf("deploying %s: %w", contract.Name, err)
+	}
+	return s, nil
+}
+
+// SetBreakpoints replaces the breakpoints of document with ones on lines.
+// A line without code gets the breakpoint of the next line with some; the
+// lines set are returned in the order of lines, 0 where none is.
+func (s *DebugSession) SetBreakpoints(document string, lines []int) []int {
+	set := make(map[int]bool)
+	resolved := make([]int, len(lines))
+	code := s.lines[document]
+	for i, line := range lines {
+		if n := sort.SearchInts(code, line); n < len(code) {
+			resolved[i] = code[n]
+			set[code[n]] = true
+		}
+	}
+	s.breakpoints[document] = set
+	return resolved
+}
+
+// Start invokes method with args, stopped before its first instruction
+func (s *DebugSession) Start(method string, args ...interface{}) error {
+	items := make([]NeoVMStackItem, len(args))
+	for i, arg := range args {
+		item, err := StackItemOf(arg)
+		if err != nil {
+			return fmt.Errorf("argument %d: %w", i, err)
+		}
+		items[i] = item
+	}
+	h, e := s.Host, s.Host.Engine
+	e.GasLimit, e.GasConsumed, e.Signers = h.GasLimit, 0, h.Signers
+	s.Method, s.Fault = method, nil
+	s.notified, s.logged = len(e.Notifications), len(e.Logs)
+	return e.LoadMethod(h.Contract, method, items...)
+}
+
+// Running reports whether the invocation can be resumed
+func (s *DebugSession) Running() bool {
+	return s.Host.Engine.State == VMStateNone
+}
+
+// AtBreakpoint reports whether the invocation is stopped on a breakpoint
+func (s *DebugSession) AtBreakpoint() bool {
+	point, ok := s.pointAt(s.offset())
+	return ok && point.address == s.offset() && s.breakpoints[point.ref.File][point.ref.Line]
+}
+
+// Continue runs to the next breakpoint
+func (s *DebugSession) Continue() DebugStop {
+	return s.resume(func(debugLine, debugLine) bool { return false })
+}
+
+// StepOver runs to the next line of the routine, or of a caller
+func (s *DebugSession) StepOver() DebugStop {
+	return s.resume(func(from, here debugLine) bool {
+		return here.depth < from.depth || (here.depth == from.depth && (here.file != from.file || here.line != from.line))
+	})
+}
+
+// StepIn runs to the next line of any routine
+func (s *DebugSession) StepIn() DebugStop {
+	return s.resume(func(debugLine, debugLine) bool { return true })
+}
+
+// StepOut runs to the next line of a caller
+func (s *DebugSession) StepOut() DebugStop {
+	return s.resume(func(from, here debugLine) bool { return here.depth < from.depth })
+}
+
+// resume steps the engine until it enters a line with a breakpoint or one
+// stop accepts
+func (s *DebugSession) resume(stop func(from, here debugLine) bool) DebugStop {
+	e := s.Host.Engine
+	if e.State != VMStateNone {
+		return DebugStop{Reason: DebugStopExit, Err: s.Fault}
+	}
+	from := s.line()
+	last := from
+	for {
+		if err := e.Step(); err != nil {
+			s.Fault = err
+			return DebugStop{Reason: DebugStopException, Err: err}
+		}
+		if e.State != VMStateNone {
+			return DebugStop{Reason: DebugStopExit}
+		}
+		point, ok := s.pointAt(s.offset())
+		if !ok || point.address != s.offset() {
+			continue
+		}
+		here := debugLine{point.ref.File, point.ref.Line, len(e.frames)}
+		if here == last {
+			continue
+		}
+		last = here
+		if s.breakpoints[here.file][here.line] {
+			return DebugStop{Reason: DebugStopBreakpoint}
+		}
+		if stop(from, here) {
+			return DebugStop{Reason: DebugStopStep}
+		}
+	}
+}
+
+// offset returns the offset of the next instruction
+func (s *DebugSession) offset() int {
+	return s.Host.Engine.InvocationStack()[0].Offset
+}
+
+// line returns the line the invocation is stopped on
+func (s *DebugSession) line() debugLine {
+	point, _ := s.pointAt(s.offset())
+	return debugLine{point.ref.File, point.ref.Line, len(s.Host.Engine.frames)}
+}
+
+// pointAt returns the last sequence point at or before offset
+func (s *DebugSession) pointAt(offset int) (debugSequencePoint, bool) {
+	n := sort.Search(len(s.points), func(i int) bool { return s.points[i].address > offset })
+	if n == 0 {
+		return debugSequencePoint{}, false
+	}
+	return s.points[n-1], true
+}
+
+// methodAt returns the innermost method holding offset
+func (s *DebugSession) methodAt(offset int) (debugMethod, bool) {
+	for _, m := range s.methods {
+		if offset >= m.start && offset <= m.end {
+			return m, true
+		}
+	}
+	return debugMethod{}, false
+}
+
+// Frames returns the invocation stack, innermost first
+func (s *DebugSession) Frames() []DebugFrame {
+	var frames []DebugFrame
+	for _, context := range s.Host.Engine.InvocationStack() {
+		frame := DebugFrame{Name: fmt.Sprintf("offset %d", context.Offset), Offset: context.Offset}
+		method, ok := s.methodAt(context.Offset)
+		if ok {
+			frame.Name = method.name
+		}
+		if point, ok := s.pointAt(context.Offset); ok {
+			frame.Source = point.ref
+		}
+		for i, item := range context.Arguments {
+			name := fmt.Sprintf("arg%d", i)
+			if i < len(method.params) {
+				name = method.params[i]
+			}
+			frame.Arguments = append(frame.Arguments, DebugValue{name, item})
+		}
+		for i, item := range context.Locals {
+			frame.Locals = append(frame.Locals, DebugValue{fmt.Sprintf("local%d", i), item})
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// Stack returns the evaluation stack, top first
+func (s *DebugSession) Stack() []DebugValue {
+	stack := s.Host.Engine.EvaluationStack
+	values := make([]DebugValue, len(stack))
+	for i := range stack {
+		values[i] = DebugValue{strconv.Itoa(i), stack[len(stack)-1-i]}
+	}
+	return values
+}
+
+// StaticFields returns the static fields by index
+func (s *DebugSession) StaticFields() []DebugValue {
+	var indices []int
+	for index := range s.Host.Engine.StaticFields {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	values := make([]DebugValue, len(indices))
+	for i, index := range indices {
+		values[i] = DebugValue{fmt.Sprintf("static%d", index), s.Host.Engine.StaticFields[index]}
+	}
+	return values
+}
+
+// Storage returns the storage of the contract, words of slots named by
+// slot and other entries by key
+func (s *DebugSession) Storage() []DebugValue {
+	storage := s.Host.Engine.Storage
+	keys := make([]string, 0, len(storage))
+	for key := range storage {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]DebugValue, len(keys))
+	for i, key := range keys {
+		if len(key) == 33 && key[0] == 0 {
+			slot := new(big.Int).SetBytes([]byte(key[1:]))
+			values[i] = DebugValue{"slot " + slot.String(), CreateNeoVMInteger(decodeInteger(storage[key]))}
+		} else {
+			values[i] = DebugValue{"0x" + hex.EncodeToString([]byte(key)), CreateNeoVMByteString(storage[key])}
+		}
+	}
+	return values
+}
+
+// Notifications returns the notifications the invocation raised
+func (s *DebugSession) Notifications() []NeoVMNotification {
+	return s.Host.Engine.Notifications[s.notified:]
+}
+
+// Logs returns the messages the invocation logged
+func (s *DebugSession) Logs() []string {
+	return s.Host.Engine.Logs[s.logged:]
+}
+
+// debugItemValue formats an item as the debugger shows it
+func debugItemValue(item NeoVMStackItem) string {
+	switch v := item.(type) {
+	case nil:
+		return "null"
+	case *NeoVMInteger:
+		return v.Value.String()
+	case *NeoVMBoolean:
+		return strconv.FormatBool(v.Value)
+	case *NeoVMByteString:
+		return "0x" + hex.EncodeToString(v.Value)
+	case *NeoVMBuffer:
+		return "0x" + hex.EncodeToString(v.Value)
+	case *NeoVMMap:
+		return fmt.Sprintf("Map[%d]", len(v.Keys))
+	}
+	if items, ok := itemsOf(item); ok {
+		return fmt.Sprintf("%s[%d]", typeName(item), len(items))
+	}
+	return item.String()
+}
+
+// Debug Adapter Protocol messages
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// debugLaunchArguments are the arguments of a launch request
+type debugLaunchArguments struct {
+	Program           string            `json:"program"` // Yul source file
+	Method            string            `json:"method"`
+	Args              []json.RawMessage `json:"args"`
+	Exports           []string          `json:"exports"` // Functions with methods of their own
+	OptimizationLevel int               `json:"optimizationLevel"`
+	StopOnEntry       bool              `json:"stopOnEntry"`
+	GasLimit          int64             `json:"gasLimit"` // Datoshi, unlimited when 0
+}
+
+// dapThreadID is the thread of the invocation, the only one
+const dapThreadID = 1
+
+// ReadDAPMessage reads the content of a message framed with a
+// Content-Length header
+func ReadDAPMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message without Content-Length")
+	}
+	content := make([]byte, length)
+	_, err := io.ReadFull(r, content)
+	return content, err
+}
+
+// WriteDAPMessage writes message as JSON framed with a Content-Length
+// header
+func WriteDAPMessage(w io.Writer, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// DebugAdapter serves a debug session over the Debug Adapter Protocol
+type DebugAdapter struct {
+	in      *bufio.Reader
+	out     io.Writer
+	seq     int
+	session *DebugSession
+	launch  debugLaunchArguments
+	args    []interface{}
+	refs    []func() []dapVariable // Variables by reference - 1, until the session resumes
+	done    bool
+}
+
+// NewDebugAdapter creates an adapter reading requests from in and writing
+// responses and events to out
+func NewDebugAdapter(in io.Reader, out io.Writer) *DebugAdapter {
+	return &DebugAdapter{in: bufio.NewReader(in), out: out}
+}
+
+// Serve handles requests until a disconnect request or the end of input
+func (a *DebugAdapter) Serve() error {
+	for !a.done {
+		content, err := ReadDAPMessage(a.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var request dapRequest
+		if err := json.Unmarshal(content, &request); err != nil {
+			return fmt.Errorf("invalid message: %w", err)
+		}
+		if request.Type != "request" {
+			continue
+		}
+		if err := a.handle(request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send writes a response or event with the next sequence number
+func (a *DebugAdapter) send(message interface{}) error {
+	a.seq++
+	switch m := message.(type) {
+	case *dapResponse:
+		m.Seq, m.Type = a.seq, "response"
+	case *dapEvent:
+		m.Seq, m.Type = a.seq, "event"
+	}
+	return WriteDAPMessage(a.out, message)
+}
+
+// event sends an event
+func (a *DebugAdapter) event(name string, body interface{}) error {
+	return a.send(&dapEvent{Event: name, Body: body})
+}
+
+// handle answers a request, and runs the invocation when it resumes it
+func (a *DebugAdapter) handle(request dapRequest) error {
+	response := &dapResponse{RequestSeq: request.Seq, Command: request.Command, Success: true}
+	body, after, err := a.dispatch(request)
+	if err != nil {
+		response.Success, response.Message = false, err.Error()
+	} else {
+		response.Body = body
+	}
+	if err := a.send(response); err != nil {
+		return err
+	}
+	if after != nil && err == nil {
+		return after()
+	}
+	return nil
+}
+
+// dispatch runs request and returns the body of its response and what to
+// do once the response is sent
+func (a *DebugAdapter) dispatch(request dapRequest) (interface{}, func() error, error) {
+	arguments := request.Arguments
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	switch request.Command {
+	case "initialize":
+		return map[string]interface{}{"supportsConfigurationDoneRequest": true}, nil, nil
+	case "launch":
+		if err := a.start(arguments); err != nil {
+			return nil, nil, err
+		}
+		return nil, func() error { return a.event("initialized", nil) }, nil
+	case "setBreakpoints":
+		var args struct {
+			Source      dapSource `json:"source"`
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil, nil, err
+		}
+		if a.session == nil {
+			return nil, nil, errors.New("no program is launched")
+		}
+		lines := make([]int, len(args.Breakpoints))
+		for i, breakpoint := range args.Breakpoints {
+			lines[i] = breakpoint.Line
+		}
+		path := debugDocument(args.Source.Path)
+		breakpoints := []map[string]interface{}{}
+		for i, line := range a.session.SetBreakpoints(path, lines) {
+			breakpoint := map[string]interface{}{"verified": line > 0, "line": lines[i]}
+			if line > 0 {
+				breakpoint["line"] = line
+			} else {
+				breakpoint["message"] = "no code on or after this line"
+			}
+			breakpoints = append(breakpoints, breakpoint)
+		}
+		return map[string]interface{}{"breakpoints": breakpoints}, nil, nil
+	case "setExceptionBreakpoints":
+		return nil, nil, nil
+	case "configurationDone":
+		if a.session == nil {
+			return nil, nil, errors.New("no program is launched")
+		}
+		if err := a.session.Start(a.launch.Method, a.args...); err != nil {
+			return nil, nil, err
+		}
+		return nil, func() error {
+			switch {
+			case a.launch.StopOnEntry:
+				return a.stopped(DebugStop{Reason: DebugStopEntry})
+			case a.session.AtBreakpoint():
+				return a.stopped(DebugStop{Reason: DebugStopBreakpoint})
+			}
+			return a.stopped(a.session.Continue())
+		}, nil
+	case "threads":
+		return map[string]interface{}{"threads": []map[string]interface{}{{"id": dapThreadID, "name": "main"}}}, nil, nil
+	case "stackTrace":
+		if a.session == nil {
+			return nil, nil, errors.New("no program is launched")
+		}
+		frames := []map[string]interface{}{}
+		for i, frame := range a.session.Frames() {
+			f := map[string]interface{}{"id": i + 1, "name": frame.Name, "line": frame.Source.Line, "column": frame.Source.Column}
+			if frame.Source.File != "" {
+				f["source"] = dapSource{Name: filepath.Base(frame.Source.File), Path: frame.Source.File}
+			}
+			frames = append(frames, f)
+		}
+		return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil, nil
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil, nil, err
+		}
+		if a.session == nil {
+			return nil, nil, errors.New("no program is launched")
+		}
+		frames := a.session.Frames()
+		if args.FrameID < 1 || args.FrameID > len(frames) {
+			return nil, nil, fmt.Errorf("no frame %d", args.FrameID)
+		}
+		frame := frames[args.FrameID-1]
+		scope := func(name string, values func() []DebugValue) map[string]interface{} {
+			ref := a.reference(func() []dapVariable { return a.variables(values()) })
+			return map[string]interface{}{"name": name, "variablesReference": ref, "expensive": false}
+		}
+		return map[string]interface{}{"scopes": []map[string]interface{}{
+			scope("Arguments", func() []DebugValue { return frame.Arguments }),
+			scope("Locals", func() []DebugValue { return frame.Locals }),
+			scope("Evaluation stack", a.session.Stack),
+			scope("Static fields", a.session.StaticFields),
+			scope("Storage", a.session.Storage),
+		}}, nil, nil
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil, nil, err
+		}
+		if args.VariablesReference < 1 || args.VariablesReference > len(a.refs) {
+			return nil, nil, fmt.Errorf("no variables %d", args.VariablesReference)
+		}
+		return map[string]interface{}{"variables": a.refs[args.VariablesReference-1]()}, nil, nil
+	case "continue", "next", "stepIn", "stepOut":
+		if a.session == nil {
+			return nil, nil, errors.New("no program is launched")
+		}
+		resume := map[string]func() DebugStop{
+			"continue": a.session.Continue,
+			"next":     a.session.StepOver,
+			"stepIn":   a.session.StepIn,
+			"stepOut":  a.session.StepOut,
+		}[request.Command]
+		var body interface{}
+		if request.Command == "continue" {
+			body = map[string]interface{}{"allThreadsContinued": true}
+		}
+		return body, func() error { return a.stopped(resume()) }, nil
+	case "disconnect", "terminate":
+		a.done = true
+		return nil, nil, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported request %s", request.Command)
+}
+
+// start compiles and deploys the program of a launch request
+func (a *DebugAdapter) start(arguments json.RawMessage) error {
+	var launch debugLaunchArguments
+	if err := json.Unmarshal(arguments, &launch); err != nil {
+		return err
+	}
+	if launch.Program == "" || launch.Method == "" {
+		return errors.New("launch needs a program and a method")
+	}
+	args, err := debugArguments(launch.Args)
+	if err != nil {
+		return err
+	}
+	path := debugDocument(launch.Program)
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config := CompilerConfig{OptimizationLevel: launch.OptimizationLevel, EnableDebugInfo: true, ExportFunctions: launch.Exports}
+	result, err := NewYulToNeoCompiler(config).Compile(string(source))
+	if err != nil {
+		return fmt.Errorf("%s: %w", launch.Program, err)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%s: %s", launch.Program, result.Errors[0].Message)
+	}
+	if result.DebugInfo == nil || result.DebugInfo.Neo == nil {
+		return fmt.Errorf("%s: no debug information", launch.Program)
+	}
+	session, err := NewDebugSession(result.Contract, result.DebugInfo.Neo.WithDocuments(map[string]string{InlineSource: path}))
+	if err != nil {
+		return err
+	}
+	session.Host.GasLimit = launch.GasLimit
+	a.session, a.launch, a.args = session, launch, args
+	return nil
+}
+
+// stopped reports where the session stopped, or how the invocation ended
+func (a *DebugAdapter) stopped(stop DebugStop) error {
+	a.refs = nil
+	switch stop.Reason {
+	case DebugStopExit:
+		return a.exited()
+	case DebugStopException:
+		return a.event("stopped", map[string]interface{}{
+			"reason": "exception", "threadId": dapThreadID, "allThreadsStopped": true,
+			"description": "FAULT", "text": stop.Err.Error(),
+		})
+	}
+	return a.event("stopped", map[string]interface{}{"reason": stop.Reason, "threadId": dapThreadID, "allThreadsStopped": true})
+}
+
+// exited prints the outcome of the invocation and ends the session
+func (a *DebugAdapter) exited() error {
+	s := a.session
+	var out strings.Builder
+	code := 0
+	for _, message := range s.Logs() {
+		fmt.Fprintf(&out, "log: %s\n", message)
+	}
+	for _, n := range s.Notifications() {
+		fmt.Fprintf(&out, "notification %s: %s\n", n.EventName, debugItemValue(n.State))
+	}
+	if s.Fault != nil {
+		code = 1
+		fmt.Fprintf(&out, "%s: %v\n", s.Method, s.Fault)
+	} else {
+		var results []string
+		for _, item := range s.Host.Engine.EvaluationStack {
+			results = append(results, debugItemValue(item))
+		}
+		fmt.Fprintf(&out, "%s: HALT [%s]\n", s.Method, strings.Join(results, ", "))
+	}
+	fmt.Fprintf(&out, "gas consumed: %d datoshi\n", s.Host.Engine.GasConsumed)
+	if err := a.event("output", map[string]interface{}{"category": "stdout", "output": out.String()}); err != nil {
+		return err
+	}
+	if err := a.event("exited", map[string]interface{}{"exitCode": code}); err != nil {
+		return err
+	}
+	return a.event("terminated", nil)
+}
+
+// reference returns the variables reference of a list of variables
+func (a *DebugAdapter) reference(variables func() []dapVariable) int {
+	a.refs = append(a.refs, variables)
+	return len(a.refs)
+}
+
+// variables returns the variables showing values, with references to the
+// items of arrays, structs and maps
+func (a *DebugAdapter) variables(values []DebugValue) []dapVariable {
+	variables := []dapVariable{}
+	for _, value := range values {
+		v := dapVariable{Name: value.Name, Value: debugItemValue(value.Item)}
+		if value.Item != nil {
+			v.Type = typeName(value.Item)
+		}
+		if m, ok := value.Item.(*NeoVMMap); ok {
+			entries := make([]DebugValue, len(m.Keys))
+			for i, key := range m.Keys {
+				item, _ := pickItem(m, key)
+				entries[i] = DebugValue{debugItemValue(key), item}
+			}
+			v.VariablesReference = a.reference(func() []dapVariable { return a.variables(entries) })
+		} else if items, ok := itemsOf(value.Item); ok {
+			elements := make([]DebugValue, len(items))
+			for i, item := range items {
+				elements[i] = DebugValue{strconv.Itoa(i), item}
+			}
+			v.VariablesReference = a.reference(func() []dapVariable { return a.variables(elements) })
+		}
+		variables = append(variables, v)
+	}
+	return variables
+}
+
+// debugDocument returns the document name of a source path
+func debugDocument(path string) string {
+	if absolute, err := filepath.Abs(path); err == nil {
+		return absolute
+	}
+	return filepath.Clean(path)
+}
+
+// debugArguments converts the JSON arguments of a launch request
+func debugArguments(raw []json.RawMessage) ([]interface{}, error) {
+	args := make([]interface{}, len(raw))
+	for i, data := range raw {
+		decoder := json.NewDecoder(strings.NewReader(string(data)))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		arg, err := debugArgument(value)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+// debugArgument converts a decoded JSON value to a StackItemOf value
+func debugArgument(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		n, ok := new(big.Int).SetString(v.String(), 10)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an integer", v)
+		}
+		return n, nil
+	case string:
+		if n, ok := new(big.Int).SetString(v, 0); ok {
+			return n, nil
+		}
+		return v, nil
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, element := range v {
+			item, err := debugArgument(element)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case map[string]interface{}:
+		return nil, errors.New("objects are not arguments")
+	}
+	return value, nil
+}
+
+// RunDebugCommand runs "debug" with the given arguments and returns the
+// process exit code
+func RunDebugCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	listen := flags.String("listen", "", "TCP address to serve sessions on, one at a time, instead of standard input and output")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: debug [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if *listen == "" {
+		if err := NewDebugAdapter(stdin, stdout).Serve(); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailed
+		}
+		return exitOK
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailed
+	}
+	defer listener.Close()
+	fmt.Fprintf(stderr, "debug adapter listening on %s\n", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailed
+		}
+		if err := NewDebugAdapter(conn, conn).Serve(); err != nil {
+			fmt.Fprintln(stderr, err)
+		}
+		conn.Close()
+	}
+}
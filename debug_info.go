@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Debug information.
+//
+// A contract compiled with debug information gets two maps of its script
+// back to the source, both indexing the same list of documents, the files
+// of the instructions' source references in the order they first appear.
+//
+// SrcMap is a solc source map, "s:l:f:j" per instruction separated by
+// semicolons, compressed the way solc compresses them: a field equal to
+// that of the previous entry is left empty, and trailing empty fields are
+// dropped. Instructions without a source map to -1.
+//
+// NeoDebugInfo is NEP-19 debug information, written as name.debug.json for
+// neo-debugger and other tools: the documents, the methods of the script
+// with the byte range of each, and per method the sequence points, the
+// addresses at which the source location changes. Methods are the contract
+// methods and the Yul functions with code of their own. A function lies
+// within the code of the routine defining it, so ranges nest; methods are
+// listed innermost first, and each instruction is a sequence point of the
+// first method whose range holds it.
+
+// NeoDebugInfo is the NEP-19 debug information of a script
+type NeoDebugInfo struct {
+	Hash            string           `json:"hash"` // Script hash
+	Documents       []string         `json:"documents"`
+	StaticVariables []string         `json:"static-variables"`
+	Methods         []NeoDebugMethod `json:"methods"`
+	Events          []NeoDebugEvent  `json:"events"`
+}
+
+// NeoDebugMethod is a method of NEP-19 debug information
+type NeoDebugMethod struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`  // "contract,method"
+	Range          string   `json:"range"` // "start-end", offsets of the first and last instruction
+	Params         []string `json:"params"`
+	Return         string   `json:"return"`
+	Variables      []string `json:"variables"`
+	SequencePoints []string `json:"sequence-points"` // "address[document]line:column-line:column"
+}
+
+// NeoDebugEvent is an event of NEP-19 debug information
+type NeoDebugEvent struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"` // "contract,event"
+	Params []string `json:"params"`
+}
+
+// sourceDocuments returns the files instructions refer to, in the order
+// they first appear
+func sourceDocuments(instructions []NeoInstruction) []string {
+	documents := []string{}
+	seen := make(map[string]bool)
+	for _, instr := range instructions {
+		if ref := instr.SourceRef; ref != nil && ref.Line > 0 && !seen[ref.File] {
+			seen[ref.File] = true
+			documents = append(documents, ref.File)
+		}
+	}
+	return documents
+}
+
+// documentIndex returns the index of file in documents, -1 when absent
+func documentIndex(documents []string, file string) int {
+	for i, document := range documents {
+		if document == file {
+			return i
+		}
+	}
+	return -1
+}
+
+// CompressedSourceMap returns the compressed solc source map of
+// instructions, with source indices into documents
+func CompressedSourceMap(instructions []NeoInstruction, documents []string) string {
+	entries := make([]string, len(instructions))
+	var previous [4]string
+	for i, instr := range instructions {
+		fields := [4]string{"-1", "-1", "-1", "-"}
+		if ref := instr.SourceRef; ref != nil && ref.Line > 0 {
+			fields[0], fields[1] = strconv.Itoa(ref.Offset), strconv.Itoa(ref.Length)
+			fields[2] = strconv.Itoa(documentIndex(documents, ref.File))
+		}
+		switch instr.Opcode {
+		case CALL, CALL_L, CALLA, CALLT:
+			fields[3] = "i"
+		case RET:
+			fields[3] = "o"
+		}
+		entry := fields
+		for j := range entry {
+			if i > 0 && entry[j] == previous[j] {
+				entry[j] = ""
+			}
+		}
+		entries[i] = strings.TrimRight(strings.Join(entry[:], ":"), ":")
+		previous = fields
+	}
+	return strings.Join(entries, ";")
+}
+
+// debugRoutine is a method of the script by instruction index, end
+// exclusive
+type debugRoutine struct {
+	method     NeoDebugMethod
+	start, end int
+}
+
+// NewNeoDebugInfo returns the NEP-19 debug information of contract, whose
+// Yul functions are functions
+func NewNeoDebugInfo(contract *NeoContract, functions []*YulFunctionDef) (*NeoDebugInfo, error) {
+	script, err := contract.Script()
+	if err != nil {
+		return nil, err
+	}
+	code := contract.Runtime
+	offsets := make([]int, len(code)+1) // Byte offset by instruction index
+	indices := make(map[int]int)        // Instruction index by byte offset
+	for i, instr := range code {
+		indices[offsets[i]] = i
+		offsets[i+1] = offsets[i] + instr.Size
+	}
+	info := &NeoDebugInfo{
+		Hash:            ScriptHash(script).String(),
+		Documents:       sourceDocuments(code),
+		StaticVariables: []string{},
+		Methods:         []NeoDebugMethod{},
+		Events:          []NeoDebugEvent{},
+	}
+
+	var routines []debugRoutine
+	params := func(parameters []MethodParameter) []string {
+		list := []string{}
+		for i, param := range parameters {
+			list = append(list, fmt.Sprintf("%s,%s,%d", param.Name, param.Type, i))
+		}
+		return list
+	}
+	var starts []int
+	for _, method := range contract.Methods {
+		starts = append(starts, indices[method.Offset])
+	}
+	sort.Ints(starts)
+	for _, method := range contract.Methods {
+		start := indices[method.Offset]
+		end := len(code)
+		if next := sort.SearchInts(starts, start+1); next < len(starts) {
+			end = starts[next]
+		}
+		returns := "Void"
+		if len(method.Returns) > 0 {
+			returns = method.Returns[0].Type
+		}
+		routines = append(routines, debugRoutine{NeoDebugMethod{
+			ID:     method.Name,
+			Name:   contract.Name + "," + method.Name,
+			Params: params(method.Parameters),
+			Return: returns,
+		}, start, end})
+	}
+	for _, def := range functions {
+		label := "func_" + def.Name
+		start, ok := contract.EntryPoints.Get(label)
+		if !ok {
+			continue
+		}
+		// The skip label follows the body
+		end := len(code)
+		contract.EntryPoints.Range(func(name string, index int) bool {
+			if strings.HasPrefix(name, "func_skip_"+def.Name+"_") && index > start && index < end {
+				end = index
+			}
+			return true
+		})
+		var parameters []MethodParameter
+		for _, param := range def.Parameters {
+			parameters = append(parameters, MethodParameter{Name: param.Name, Type: "Integer"})
+		}
+		returns := "Void"
+		if len(def.Returns) == 1 {
+			returns = "Integer"
+		} else if len(def.Returns) > 1 {
+			returns = "Any"
+		}
+		routines = append(routines, debugRoutine{NeoDebugMethod{
+			ID:     label,
+			Name:   contract.Name + "," + def.Name,
+			Params: params(parameters),
+			Return: returns,
+		}, start, end})
+	}
+	sort.SliceStable(routines, func(i, j int) bool {
+		return routines[i].end-routines[i].start < routines[j].end-routines[j].start
+	})
+
+	claimed := make([]bool, len(code))
+	for _, routine := range routines {
+		if routine.end <= routine.start {
+			continue
+		}
+		method := routine.method
+		method.Range = fmt.Sprintf("%d-%d", offsets[routine.start], offsets[routine.end-1])
+		method.Variables = []string{}
+		method.SequencePoints = []string{}
+		var last *SourcePosition
+		for i := routine.start; i < routine.end; i++ {
+			ref := code[i].SourceRef
+			if claimed[i] {
+				last = nil
+				continue
+			}
+			if ref == nil || ref.Line <= 0 {
+				continue
+			}
+			claimed[i] = true
+			if last != nil && *last == *ref {
+				continue
+			}
+			last = ref
+			method.SequencePoints = append(method.SequencePoints, fmt.Sprintf("%d[%d]%d:%d-%d:%d",
+				offsets[i], documentIndex(info.Documents, ref.File), ref.Line, ref.Column, ref.Line, ref.Column+ref.Length))
+		}
+		info.Methods = append(info.Methods, method)
+	}
+
+	for _, event := range contract.Events {
+		params := []string{}
+		for i, param := range event.Parameters {
+			params = append(params, fmt.Sprintf("%s,%s,%d", param.Name, param.Type, i))
+		}
+		info.Events = append(info.Events, NeoDebugEvent{ID: event.Name, Name: contract.Name + "," + event.Name, Params: params})
+	}
+	return info, nil
+}
+
+// WithDocuments returns a copy of the debug information with the documents
+// that are keys of names renamed to their values
+func (d *NeoDebugInfo) WithDocuments(names map[string]string) *NeoDebugInfo {
+	renamed := *d
+	renamed.Documents = make([]string, len(d.Documents))
+	for i, document := range d.Documents {
+		renamed.Documents[i] = document
+		if name, ok := names[document]; ok {
+			renamed.Documents[i] = name
+		}
+	}
+	return &renamed
+}
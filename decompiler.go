@@ -0,0 +1,1387 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Decompiler.
+//
+// Decompile lifts a script back into pseudo-Yul, for auditing deployed
+// contracts. Each routine, the code at offset 0, a method and each CALL or
+// PUSHA target, becomes a function named after its method, or fn_ and its
+// offset; its parameters, arg_N, and results, r_N, are inferred from its
+// INITSLOT and the items it takes from and leaves on the stack. Handlers of
+// TRY become functions catch_N and finally_N.
+//
+// Stack items become expressions. Instructions are calls of their lowercase
+// mnemonics with NeoVM semantics, NOT being iszero, taking their operands
+// in the order they were pushed; CALLs and SYSCALLs, the latter named after
+// the interop service, take them in the order they are popped, the first
+// parameter on top. Slots are the variables loc_N, arg_N and sfld_N, results
+// of calls and values used more than once the variables t_N, and values
+// the stack carries from one branch or loop iteration to the next the
+// variables s_N, one per stack position.
+//
+// Control flow is structured from the CFG. A jump back to an earlier
+// instruction makes a loop, lifted as a for loop with break and continue.
+// A conditional jump is an if, or a switch when both ways run code before
+// they reach the instruction post-dominating the jump. What cannot be
+// structured is left as goto(offset), and stack effects that cannot be
+// followed as opaque(offset). The decompile command prints the result:
+//
+//	neo-yulc decompile name.nef
+//	neo-yulc decompile script.hex
+//
+// A .nef file is decompiled with the method names of the manifest next to
+// it, when there is one.
+
+// DecompileOptions tells the decompiler what the script alone does not
+type DecompileOptions struct {
+	Methods map[int]string // Names of routines by offset, such as the manifest's methods
+	Tokens  []MethodToken  // Method tokens of the NEF, which CALLT refers to
+}
+
+// decompilePasses bounds the passes inferring the routines' signatures
+// from each other
+const decompilePasses = 8
+
+// decompileSteps bounds the instructions lifted per routine, which only
+// unstructured flow lifting code more than once can reach
+const decompileSteps = 1 << 16
+
+// Decompile lifts script into an object "decompiled" whose code defines a
+// function per routine
+func Decompile(script []byte, options DecompileOptions) (*YulAST, error) {
+	code, err := DisassembleScript(script)
+	if err != nil {
+		return nil, err
+	}
+	d := &decompiler{code: code, options: options, indices: make(map[int]int), routines: make(map[int]*decompiledRoutine)}
+	d.offsets = make([]int, len(code)+1)
+	for i, instr := range code {
+		d.indices[d.offsets[i]] = i
+		d.offsets[i+1] = d.offsets[i] + instr.Size
+	}
+	d.findRoutines()
+
+	var functions []*YulFunctionDef
+	for pass := 0; pass < decompilePasses; pass++ {
+		functions = functions[:0]
+		changed := false
+		for _, start := range d.order {
+			routine := d.routines[start]
+			l := newRoutineLifter(d, routine)
+			functions = append(functions, l.lift())
+			if l.inputs != routine.inputs || l.outputs != routine.outputs {
+				routine.inputs, routine.outputs = l.inputs, l.outputs
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	statements := make([]YulStatement, len(functions))
+	for i, fn := range functions {
+		statements[i] = fn
+	}
+	return &YulAST{
+		Objects:   []*YulObject{{Name: "decompiled", Type: ObjectTypeContract, Code: &YulBlock{Statements: statements}}},
+		Functions: []*YulFunctionDef{},
+	}, nil
+}
+
+// decompiler holds the instructions of a script and its routines
+type decompiler struct {
+	code     []NeoInstruction
+	offsets  []int       // Offset by instruction index, and the script size last
+	indices  map[int]int // Instruction index by offset
+	options  DecompileOptions
+	routines map[int]*decompiledRoutine // By the index of their first instruction
+	order    []int                      // Routine starts in script order
+	names    map[string]int             // Routine starts by name
+}
+
+// decompiledRoutine is a routine and its inferred signature
+type decompiledRoutine struct {
+	name            string
+	start           int
+	inputs, outputs int
+	exception       bool // A catch handler, started with the exception on the stack
+}
+
+// target returns the index of the instruction the jump at i targets, by
+// its offset operand at position n
+func (d *decompiler) target(i, n int) (int, bool) {
+	operand := d.code[i].Operand
+	width := len(operand) / jumpOffsets(d.code[i].Opcode)
+	if width == 0 {
+		return 0, false
+	}
+	relative := decodeJumpOffset(operand[n*width : (n+1)*width])
+	if relative == 0 && n > 0 {
+		return 0, false // TRY without this handler
+	}
+	index, ok := d.indices[d.offsets[i]+relative]
+	return index, ok
+}
+
+// findRoutines finds the routines of the script and names them
+func (d *decompiler) findRoutines() {
+	d.names = make(map[string]int)
+	add := func(index int, name string, exception bool) {
+		if _, ok := d.routines[index]; !ok {
+			d.routines[index] = &decompiledRoutine{name: name, start: index, exception: exception}
+			d.order = append(d.order, index)
+		}
+	}
+	if len(d.code) > 0 {
+		add(0, "fn_0", false)
+	}
+	for i, instr := range d.code {
+		switch instr.Opcode {
+		case CALL, CALL_L, PUSHA:
+			if t, ok := d.target(i, 0); ok {
+				add(t, fmt.Sprintf("fn_%d", d.offsets[t]), false)
+			}
+		case TRY, TRY_L:
+			if t, ok := d.target(i, 0); ok {
+				add(t, fmt.Sprintf("catch_%d", d.offsets[t]), true)
+			}
+			if t, ok := d.target(i, 1); ok {
+				add(t, fmt.Sprintf("finally_%d", d.offsets[t]), false)
+			}
+		}
+	}
+	offsets := make([]int, 0, len(d.options.Methods))
+	for offset := range d.options.Methods {
+		offsets = append(offsets, offset)
+	}
+	sort.Ints(offsets)
+	for _, offset := range offsets {
+		if index, ok := d.indices[offset]; ok {
+			add(index, "", false)
+			d.routines[index].name = d.options.Methods[offset]
+		}
+	}
+	sort.Ints(d.order)
+	for _, start := range d.order {
+		routine := d.routines[start]
+		if instr := d.code[start]; instr.Opcode == INITSLOT && len(instr.Operand) == 2 {
+			routine.inputs = int(instr.Operand[1])
+		}
+		d.names[routine.name] = start
+	}
+}
+
+// successors returns the instructions that can run after the one at i
+// within its routine
+func (d *decompiler) successors(i int) []int {
+	var next []int
+	switch op := d.code[i].Opcode; {
+	case op == RET || op == THROW || op == ABORT || op == ABORTMSG || op == ENDFINALLY:
+		return nil
+	case op == JMP || op == JMP_L || op == ENDTRY || op == ENDTRY_L:
+		if t, ok := d.target(i, 0); ok {
+			next = append(next, t)
+		}
+		return next
+	case conditionalJump(op):
+		if t, ok := d.target(i, 0); ok {
+			next = append(next, t)
+		}
+	}
+	if i+1 < len(d.code) {
+		next = append(next, i+1)
+	}
+	return next
+}
+
+// conditionalJump reports whether op jumps on a condition
+func conditionalJump(op NeoOpcode) bool {
+	switch op {
+	case JMP, JMP_L, CALL, CALL_L, TRY, TRY_L, ENDTRY, ENDTRY_L:
+		return false
+	}
+	return isJump(op)
+}
+
+// jumpConditions name the comparison of the conditional jumps taking two
+// operands
+var jumpConditions = map[NeoOpcode]string{
+	JMPEQ: "numequal", JMPEQ_L: "numequal",
+	JMPNE: "numnotequal", JMPNE_L: "numnotequal",
+	JMPGT: "gt", JMPGT_L: "gt",
+	JMPGE: "ge", JMPGE_L: "ge",
+	JMPLT: "lt", JMPLT_L: "lt",
+	JMPLE: "le", JMPLE_L: "le",
+}
+
+// stackItemTypeNames name the operands of CONVERT, ISTYPE and NEWARRAY_T
+var stackItemTypeNames = map[NeoVMType]string{
+	AnyType:        "Any",
+	PointerType:    "Pointer",
+	BooleanType:    "Boolean",
+	IntegerType:    "Integer",
+	ByteStringType: "ByteString",
+	BufferType:     "Buffer",
+	ArrayType:      "Array",
+	StructType:     "Struct",
+	MapType:        "Map",
+	InteropType:    "InteropInterface",
+}
+
+// liftStack is the symbolic stack of a path, the expressions it pushed in
+// order, and how many items below them it took from its caller
+type liftStack struct {
+	items []YulExpression
+	taken int
+}
+
+func (s *liftStack) clone() *liftStack {
+	return &liftStack{items: append([]YulExpression{}, s.items...), taken: s.taken}
+}
+
+// liftLoop is a loop being lifted: its first instruction, the first of its
+// post block and the one after its last, and the depth of the stack
+// breaking out of it
+type liftLoop struct {
+	header, post, exit int
+	exitDepth          int // -1 until a break
+	exitTaken          int
+}
+
+// routineLifter lifts a routine into a function
+type routineLifter struct {
+	d       *decompiler
+	routine *decompiledRoutine
+	args    int         // Arguments of its INITSLOT
+	loops   map[int]int // Last instruction jumping back, by loop header
+	ipdom   map[int]int // Immediate post-dominator, -1 for none
+	temps   int
+	spills  int // s_N variables used
+	steps   int
+	gotos   int // goto statements lifted
+	tails   int // Tails lifted where they are jumped to
+	inputs  int // Items taken from the caller
+	outputs int // Items returned
+}
+
+func newRoutineLifter(d *decompiler, routine *decompiledRoutine) *routineLifter {
+	l := &routineLifter{d: d, routine: routine, loops: make(map[int]int), ipdom: make(map[int]int)}
+	if instr := d.code[routine.start]; instr.Opcode == INITSLOT && len(instr.Operand) == 2 {
+		l.args = int(instr.Operand[1])
+	}
+	l.analyze()
+	return l
+}
+
+// analyze finds the loops and post-dominators of the routine
+func (l *routineLifter) analyze() {
+	// Instructions of the routine in depth-first order
+	reached := map[int]bool{l.routine.start: true}
+	order := []int{l.routine.start}
+	for n := 0; n < len(order); n++ {
+		for _, next := range l.d.successors(order[n]) {
+			if !reached[next] {
+				reached[next] = true
+				order = append(order, next)
+			}
+		}
+	}
+	predecessors := make(map[int][]int)
+	var exits []int
+	for _, i := range order {
+		next := l.d.successors(i)
+		if len(next) == 0 {
+			exits = append(exits, i)
+		}
+		for _, t := range next {
+			predecessors[t] = append(predecessors[t], i)
+			if t <= i && l.loops[t] < i {
+				l.loops[t] = i
+			}
+		}
+	}
+
+	// Post-dominators (Cooper, Harvey and Kennedy) over the reversed CFG,
+	// from a virtual exit, -1, that every RET and THROW leads to
+	const exit = -1
+	number := map[int]int{exit: 0} // Postorder number
+	var postorder []int
+	visited := map[int]bool{exit: true}
+	type frame struct {
+		node int
+		next []int
+	}
+	stack := []frame{{exit, exits}}
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if len(top.next) == 0 {
+			postorder = append(postorder, top.node)
+			number[top.node] = len(postorder) - 1
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		node := top.next[0]
+		top.next = top.next[1:]
+		if !visited[node] {
+			visited[node] = true
+			stack = append(stack, frame{node, predecessors[node]})
+		}
+	}
+	idom := map[int]int{exit: exit}
+	intersect := func(a, b int) int {
+		for a != b {
+			for number[a] < number[b] {
+				a = idom[a]
+			}
+			for number[b] < number[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for n := len(postorder) - 2; n >= 0; n-- {
+			node := postorder[n]
+			next := l.d.successors(node)
+			if len(next) == 0 {
+				next = []int{exit}
+			}
+			dom, found := 0, false
+			for _, s := range next {
+				if _, ok := idom[s]; !ok || !visited[s] {
+					continue
+				}
+				if !found {
+					dom, found = s, true
+				} else {
+					dom = intersect(s, dom)
+				}
+			}
+			if old, ok := idom[node]; found && (!ok || old != dom) {
+				idom[node] = dom
+				changed = true
+			}
+		}
+	}
+	for node, dom := range idom {
+		if node != exit {
+			l.ipdom[node] = dom
+		}
+	}
+}
+
+// lift returns the function of the routine
+func (l *routineLifter) lift() *YulFunctionDef {
+	stack := &liftStack{}
+	if l.routine.exception {
+		stack.items = append(stack.items, yulIdentifier("exception"))
+	}
+	body, _ := l.region(l.routine.start, -1, stack, nil, true)
+	if n := len(body); n > 0 {
+		if _, ok := body[n-1].(*YulLeave); ok {
+			body = body[:n-1]
+		}
+	}
+	if l.spills > 0 {
+		spills := &YulVariableDeclaration{}
+		for k := 0; k < l.spills; k++ {
+			spills.Variables = append(spills.Variables, &YulTypedName{Name: fmt.Sprintf("s_%d", k)})
+		}
+		body = append([]YulStatement{spills}, body...)
+	}
+
+	fn := &YulFunctionDef{Name: l.routine.name, Parameters: []*YulTypedName{}, Returns: []*YulTypedName{}, Body: &YulBlock{Statements: body}}
+	for k := 0; k < l.inputs; k++ {
+		fn.Parameters = append(fn.Parameters, &YulTypedName{Name: l.inputName(k)})
+	}
+	for k := 0; k < l.outputs; k++ {
+		fn.Returns = append(fn.Returns, &YulTypedName{Name: fmt.Sprintf("r_%d", k)})
+	}
+	return fn
+}
+
+// inputName names the item at depth k below the routine's stack
+func (l *routineLifter) inputName(k int) string {
+	if k < l.args {
+		return fmt.Sprintf("arg_%d", k)
+	}
+	return fmt.Sprintf("in_%d", k)
+}
+
+// reach makes stack hold at least n items, taking items from the caller
+func (l *routineLifter) reach(stack *liftStack, n int) {
+	for len(stack.items) < n {
+		stack.items = append([]YulExpression{yulIdentifier(l.inputName(stack.taken))}, stack.items...)
+		stack.taken++
+	}
+	if stack.taken > l.inputs {
+		l.inputs = stack.taken
+	}
+}
+
+// pop pops n items, in the order they were pushed
+func (l *routineLifter) pop(stack *liftStack, n int) []YulExpression {
+	l.reach(stack, n)
+	items := append([]YulExpression{}, stack.items[len(stack.items)-n:]...)
+	stack.items = stack.items[:len(stack.items)-n]
+	return items
+}
+
+// popped pops n items, in the order they are popped
+func (l *routineLifter) popped(stack *liftStack, n int) []YulExpression {
+	items := l.pop(stack, n)
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items
+}
+
+// count pops an item the instruction takes as a count, false when it is
+// not a constant
+func (l *routineLifter) count(stack *liftStack) (int, bool) {
+	lit, ok := l.pop(stack, 1)[0].(*YulLiteral)
+	if !ok || lit.Kind != LiteralKindNumber {
+		return 0, false
+	}
+	n, err := strconv.Atoi(lit.Value)
+	return n, err == nil && n >= 0 && n <= NeoVMMaxStackSize
+}
+
+// temp declares a variable holding value and returns its name
+func (l *routineLifter) temp(out []YulStatement, value YulExpression, n int) ([]YulStatement, []YulExpression) {
+	decl := &YulVariableDeclaration{Value: value}
+	var names []YulExpression
+	for k := 0; k < n; k++ {
+		name := fmt.Sprintf("t_%d", l.temps)
+		l.temps++
+		decl.Variables = append(decl.Variables, &YulTypedName{Name: name})
+		names = append(names, yulIdentifier(name))
+	}
+	return append(out, decl), names
+}
+
+// settle declares a variable for every item of stack that must not be
+// evaluated later, shared items once
+func (l *routineLifter) settle(out []YulStatement, stack *liftStack, unsettled func(k int, item YulExpression) bool) []YulStatement {
+	settled := make(map[YulExpression]YulExpression)
+	for k, item := range stack.items {
+		if name, ok := settled[item]; ok {
+			stack.items[k] = name
+			continue
+		}
+		if !unsettled(k, item) {
+			continue
+		}
+		var names []YulExpression
+		out, names = l.temp(out, item, 1)
+		settled[item] = names[0]
+		stack.items[k] = names[0]
+	}
+	return out
+}
+
+// stable reports whether item at position k of a stack keeps its value
+// across branches: literals, t_N and s_k
+func stable(k int, item YulExpression) bool {
+	switch e := item.(type) {
+	case *YulLiteral:
+		return true
+	case *YulIdentifier:
+		return strings.HasPrefix(e.Name, "t_") || e.Name == fmt.Sprintf("s_%d", k) || e.Name == "exception"
+	}
+	return false
+}
+
+// compound reports whether item is a call, whose value an effect can change
+func compound(_ int, item YulExpression) bool {
+	_, ok := item.(*YulFunctionCall)
+	return ok
+}
+
+// mentions reports whether expr reads a variable name
+func mentions(expr YulExpression, name string) bool {
+	switch e := expr.(type) {
+	case *YulIdentifier:
+		return e.Name == name
+	case *YulFunctionCall:
+		for _, arg := range e.Arguments {
+			if mentions(arg, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// store assigns value to a variable, first settling the items reading it
+func (l *routineLifter) store(out []YulStatement, stack *liftStack, name string, value YulExpression) []YulStatement {
+	out = l.settle(out, stack, func(_ int, item YulExpression) bool { return mentions(item, name) })
+	// A temporary used only here is assigned directly
+	if id, ok := value.(*YulIdentifier); ok && len(out) > 0 && !l.onStack(stack, id.Name) {
+		if decl, ok := out[len(out)-1].(*YulVariableDeclaration); ok && len(decl.Variables) == 1 && decl.Variables[0].Name == id.Name {
+			out[len(out)-1] = &YulAssignment{VariableNames: []string{name}, Value: decl.Value}
+			return out
+		}
+	}
+	return append(out, &YulAssignment{VariableNames: []string{name}, Value: value})
+}
+
+// discard drops item; a call held only by it becomes a statement
+func (l *routineLifter) discard(out []YulStatement, stack *liftStack, item YulExpression) []YulStatement {
+	if id, ok := item.(*YulIdentifier); ok && len(out) > 0 && !l.onStack(stack, id.Name) {
+		if decl, ok := out[len(out)-1].(*YulVariableDeclaration); ok && len(decl.Variables) == 1 && decl.Variables[0].Name == id.Name {
+			out[len(out)-1] = &YulExpressionStatement{Expression: decl.Value}
+		}
+	}
+	return out
+}
+
+// onStack reports whether an item of stack reads a variable name
+func (l *routineLifter) onStack(stack *liftStack, name string) bool {
+	for _, item := range stack.items {
+		if mentions(item, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// effect emits a statement changing state, first settling the items whose
+// value it can change: calls, and for a call of a routine static fields
+func (l *routineLifter) effect(out []YulStatement, stack *liftStack, call YulExpression, results int, routine bool) ([]YulStatement, []YulExpression) {
+	out = l.settle(out, stack, func(k int, item YulExpression) bool {
+		if id, ok := item.(*YulIdentifier); ok && routine {
+			return strings.HasPrefix(id.Name, "sfld_")
+		}
+		return compound(k, item)
+	})
+	if results == 0 {
+		return append(out, &YulExpressionStatement{Expression: call}), nil
+	}
+	return l.temp(out, call, results)
+}
+
+// spill assigns the items of stack to the s_N variables of their positions
+// where they differ from keep, and returns the statements
+func (l *routineLifter) spill(stack *liftStack, keep []bool) []YulStatement {
+	var out []YulStatement
+	var assignments []YulStatement
+	targets := make(map[string]bool)
+	for k, item := range stack.items {
+		name := fmt.Sprintf("s_%d", k)
+		if k < len(keep) && keep[k] || mentionsExactly(item, name) {
+			continue
+		}
+		targets[name] = true
+	}
+	for k, item := range stack.items {
+		name := fmt.Sprintf("s_%d", k)
+		if !targets[name] {
+			continue
+		}
+		// Read the others' old values before any is assigned
+		for other := range targets {
+			if other != name && mentions(item, other) {
+				var names []YulExpression
+				out, names = l.temp(out, item, 1)
+				item = names[0]
+				break
+			}
+		}
+		assignments = append(assignments, &YulAssignment{VariableNames: []string{name}, Value: item})
+		stack.items[k] = yulIdentifier(name)
+		if k+1 > l.spills {
+			l.spills = k + 1
+		}
+	}
+	return append(out, assignments...)
+}
+
+// mentionsExactly reports whether expr is the variable name
+func mentionsExactly(expr YulExpression, name string) bool {
+	id, ok := expr.(*YulIdentifier)
+	return ok && id.Name == name
+}
+
+// merge returns the stack where paths join, nil when none reaches it, and
+// the statements bringing each path's stack there. Items all paths agree on
+// are kept, the others spilled to s_N.
+func (l *routineLifter) merge(paths []*liftStack) (*liftStack, [][]YulStatement) {
+	spills := make([][]YulStatement, len(paths))
+	var first *liftStack
+	taken := 0
+	for _, path := range paths {
+		if path == nil {
+			continue
+		}
+		if first == nil {
+			first = path
+		}
+		if path.taken > taken {
+			taken = path.taken
+		}
+	}
+	if first == nil {
+		return nil, spills
+	}
+	keep := make([]bool, len(first.items))
+	for k, item := range first.items {
+		keep[k] = stable(k, item)
+		for _, path := range paths {
+			if path != nil && (k >= len(path.items) || yulExpressionText(path.items[k]) != yulExpressionText(item)) {
+				keep[k] = false
+			}
+		}
+	}
+	for n, path := range paths {
+		if path != nil {
+			spills[n] = l.spill(path, keep)
+		}
+	}
+	joined := &liftStack{items: append([]YulExpression{}, first.items...), taken: taken}
+	return joined, spills
+}
+
+// exitLoop leaves a loop by break or continue, spilling the stack
+func (l *routineLifter) exitLoop(stack *liftStack, loop *liftLoop, statement YulStatement) []YulStatement {
+	out := l.spill(stack, nil)
+	if _, ok := statement.(*YulBreak); ok && loop.exitDepth < 0 {
+		loop.exitDepth, loop.exitTaken = len(stack.items), stack.taken
+	}
+	return append(out, statement)
+}
+
+// region lifts the instructions from i until the path reaches stop,
+// reporting whether it does, with stack its stack there. Other paths end
+// in a return, a throw, a break, a continue or a goto.
+func (l *routineLifter) region(i, stop int, stack *liftStack, loop *liftLoop, first bool) ([]YulStatement, bool) {
+	var out []YulStatement
+	for ; ; first = false {
+		if i == stop {
+			return out, true
+		}
+		if i < 0 || i >= len(l.d.code) || l.steps >= decompileSteps {
+			return append(out, l.gotoStatement(i)), false
+		}
+		l.steps++
+
+		if last, ok := l.loops[i]; ok && !(first && loop != nil && loop.header == i) {
+			inner := &liftLoop{header: i, post: l.postStart(i, last), exit: last + 1, exitDepth: -1}
+			out = append(out, l.spill(stack, nil)...)
+			entry := stack.clone()
+			var post []YulStatement
+			if inner.post == i {
+				body, falls := l.region(i, inner.exit, entry, inner, true)
+				if falls {
+					body = append(body, l.exitLoop(entry, inner, &YulBreak{})...)
+				}
+				out = append(out, newLiftedLoop(body, nil))
+			} else {
+				body, _ := l.region(i, inner.post, entry.clone(), inner, true)
+				post, _ = l.region(inner.post, inner.exit, entry, inner, false)
+				out = append(out, newLiftedLoop(body, post))
+			}
+			if inner.exitDepth < 0 {
+				return out, false
+			}
+			stack.items = stack.items[:0]
+			for k := 0; k < inner.exitDepth; k++ {
+				stack.items = append(stack.items, yulIdentifier(fmt.Sprintf("s_%d", k)))
+			}
+			stack.taken = inner.exitTaken
+			if inner.exitDepth > l.spills {
+				l.spills = inner.exitDepth
+			}
+			i = inner.exit
+			continue
+		}
+
+		instr := l.d.code[i]
+		op := instr.Opcode
+		switch {
+		case op == JMP || op == JMP_L || op == ENDTRY || op == ENDTRY_L:
+			t, ok := l.d.target(i, 0)
+			switch {
+			case !ok:
+				return append(out, l.gotoStatement(-1)), false
+			case loop != nil && (t == loop.header || t == loop.post):
+				return append(out, l.exitLoop(stack, loop, &YulContinue{})...), false
+			case loop != nil && t == loop.exit:
+				return append(out, l.exitLoop(stack, loop, &YulBreak{})...), false
+			case t == stop:
+				return out, true
+			case l.within(i, t, stop, loop):
+				i = t
+				continue
+			case l.tail(t):
+				l.tails++
+				i = t
+				continue
+			}
+			return append(out, l.gotoStatement(t)), false
+
+		case conditionalJump(op):
+			var taken YulExpression
+			switch {
+			case op == JMPIF || op == JMPIF_L:
+				taken = l.pop(stack, 1)[0]
+			case op == JMPIFNOT || op == JMPIFNOT_L:
+				taken = negate(l.pop(stack, 1)[0])
+			default:
+				taken = builtinCall(jumpConditions[op], SourcePosition{}, l.pop(stack, 2)...)
+			}
+			out = l.settle(out, stack, func(k int, item YulExpression) bool { return !stable(k, item) })
+			t, ok := l.d.target(i, 0)
+			if !ok {
+				out = append(out, &YulIf{Condition: taken, Body: &YulBlock{Statements: []YulStatement{l.gotoStatement(-1)}}})
+				i++
+				continue
+			}
+			if loop != nil && (t == loop.header || t == loop.post || t == loop.exit) {
+				var exit YulStatement = &YulBreak{}
+				if t != loop.exit {
+					exit = &YulContinue{}
+				}
+				out = append(out, &YulIf{Condition: taken, Body: &YulBlock{Statements: l.exitLoop(stack.clone(), loop, exit)}})
+				i++
+				continue
+			}
+
+			join, ok := l.ipdom[i]
+			if !ok || !l.within(i, join, stop, loop) {
+				join = -1
+			}
+			if join < 0 {
+				// One way does not come back, such as a revert: it is the body
+				// of an if, the code up to the target or else the code at it,
+				// when that lifts without a goto or copying a tail
+				saved := l.save(loop)
+				clean := func() bool { return l.gotos == saved.gotos && l.tails == saved.tails }
+				if l.within(i, t, stop, loop) {
+					body := stack.clone()
+					statements, falls := l.region(i+1, t, body, loop, false)
+					if clean() {
+						out = l.liftedIf(out, stack, negate(taken), statements, body, falls)
+						i = t
+						continue
+					}
+					l.restore(saved, loop)
+				}
+				statements, falls := l.region(t, stop, stack.clone(), loop, false)
+				if !falls && clean() {
+					out = append(out, &YulIf{Condition: taken, Body: &YulBlock{Statements: statements}})
+					i++
+					continue
+				}
+				l.restore(saved, loop)
+				if !l.within(i, t, stop, loop) {
+					out = append(out, &YulIf{Condition: taken, Body: &YulBlock{Statements: []YulStatement{l.gotoStatement(t)}}})
+					i++
+					continue
+				}
+				join = t
+			}
+			if join == t {
+				// The code up to the target runs when the jump is not taken
+				body := stack.clone()
+				statements, falls := l.region(i+1, t, body, loop, false)
+				out = l.liftedIf(out, stack, negate(taken), statements, body, falls)
+				i = t
+				continue
+			}
+
+			// switch: both ways run code before they join
+			jumped, fell := stack.clone(), stack.clone()
+			jumpedBody, jumpedFalls := l.region(t, join, jumped, loop, false)
+			fellBody, fellFalls := l.region(i+1, join, fell, loop, false)
+			if !jumpedFalls {
+				jumped = nil
+			}
+			if !fellFalls {
+				fell = nil
+			}
+			joined, spills := l.merge([]*liftStack{jumped, fell})
+			jumpedBody = append(jumpedBody, spills[0]...)
+			fellBody = append(fellBody, spills[1]...)
+			value, zero, other := taken, fellBody, jumpedBody
+			if inner, ok := iszeroOperand(taken); ok {
+				value, zero, other = inner, jumpedBody, fellBody
+			}
+			out = append(out, &YulSwitch{
+				Expression: value,
+				Cases:      []*YulCase{{Value: *NewWordLiteral(big.NewInt(0), SourcePosition{}), Body: &YulBlock{Statements: zero}}},
+				Default:    &YulBlock{Statements: other},
+			})
+			if joined == nil {
+				return out, false
+			}
+			*stack = *joined
+			i = join
+			continue
+
+		case op == RET:
+			if len(stack.items) > l.outputs {
+				l.outputs = len(stack.items)
+			}
+			// The first result is on top
+			for k := range stack.items {
+				item := stack.items[len(stack.items)-1-k]
+				rest := &liftStack{items: stack.items[:len(stack.items)-1-k]}
+				out = l.store(out, rest, fmt.Sprintf("r_%d", k), item)
+			}
+			return append(out, &YulLeave{}), false
+
+		case op == THROW || op == ABORTMSG:
+			name := strings.ToLower(OpcodeMnemonic(op))
+			return append(out, &YulExpressionStatement{Expression: builtinCall(name, SourcePosition{}, l.pop(stack, 1)...)}), false
+
+		case op == ABORT || op == ENDFINALLY:
+			return append(out, &YulExpressionStatement{Expression: builtinCall(strings.ToLower(OpcodeMnemonic(op)), SourcePosition{})}), false
+		}
+
+		var ok bool
+		if out, ok = l.instruction(out, i, stack); !ok {
+			return append(out, &YulExpressionStatement{Expression: builtinCall("opaque", SourcePosition{}, offsetLiteral(l.d.offsets[i]))}), false
+		}
+		i++
+	}
+}
+
+// liftedIf appends an if running statements, after which the path has
+// stack body when it falls through, and joins stack, the path skipping it
+func (l *routineLifter) liftedIf(out []YulStatement, stack *liftStack, cond YulExpression, statements []YulStatement, body *liftStack, falls bool) []YulStatement {
+	if !falls {
+		body = nil
+	}
+	joined, spills := l.merge([]*liftStack{body, stack})
+	out = append(out, spills[1]...)
+	out = append(out, &YulIf{Condition: cond, Body: &YulBlock{Statements: append(statements, spills[0]...)}})
+	*stack = *joined
+	return out
+}
+
+// lifterState is what lifting a region changes besides its statements,
+// kept to lift it another way. Steps are not restored, so the bound holds
+// across the ways tried.
+type lifterState struct {
+	temps, spills, gotos, tails, inputs, outputs int
+	exitDepth, exitTaken                         int
+}
+
+func (l *routineLifter) save(loop *liftLoop) lifterState {
+	state := lifterState{l.temps, l.spills, l.gotos, l.tails, l.inputs, l.outputs, 0, 0}
+	if loop != nil {
+		state.exitDepth, state.exitTaken = loop.exitDepth, loop.exitTaken
+	}
+	return state
+}
+
+func (l *routineLifter) restore(state lifterState, loop *liftLoop) {
+	l.temps, l.spills, l.gotos, l.tails = state.temps, state.spills, state.gotos, state.tails
+	l.inputs, l.outputs = state.inputs, state.outputs
+	if loop != nil {
+		loop.exitDepth, loop.exitTaken = state.exitDepth, state.exitTaken
+	}
+}
+
+// tailLength bounds the code of a tail
+const tailLength = 16
+
+// tail reports whether the code at i runs straight to a RET or THROW, such
+// as the end of a function a leave jumps to, to be lifted where it is
+// jumped to
+func (l *routineLifter) tail(i int) bool {
+	for end := i + tailLength; i < len(l.d.code) && i < end; i++ {
+		next := l.d.successors(i)
+		if len(next) == 0 {
+			return true
+		}
+		if op := l.d.code[i].Opcode; len(next) != 1 || isJump(op) && op != CALL && op != CALL_L {
+			return false
+		}
+	}
+	return false
+}
+
+// within reports whether the code from i to t lies in the region ending at
+// stop and in the loop being lifted
+func (l *routineLifter) within(i, t, stop int, loop *liftLoop) bool {
+	return t > i && (stop < 0 || t <= stop) && (loop == nil || t < loop.exit)
+}
+
+// newLiftedLoop returns the for loop of body and post, taking a leading
+// "if c { break }" of body as its condition
+func newLiftedLoop(body, post []YulStatement) *YulFor {
+	loop := &YulFor{Init: &YulBlock{}, Condition: NewWordLiteral(big.NewInt(1), SourcePosition{}), Post: &YulBlock{Statements: trimContinue(post)}}
+	body = trimContinue(body)
+	if len(body) > 0 {
+		if cond, ok := body[0].(*YulIf); ok && len(cond.Body.Statements) == 1 {
+			if _, ok := cond.Body.Statements[0].(*YulBreak); ok {
+				loop.Condition = negate(cond.Condition)
+				body = body[1:]
+			}
+		}
+	}
+	loop.Body = &YulBlock{Statements: body}
+	return loop
+}
+
+// trimContinue drops a continue ending statements
+func trimContinue(statements []YulStatement) []YulStatement {
+	if n := len(statements); n > 0 {
+		if _, ok := statements[n-1].(*YulContinue); ok {
+			return statements[:n-1]
+		}
+	}
+	return statements
+}
+
+// postStart returns where the post block of the loop from header to the
+// jump back at last starts: the first target of a forward JMP within the
+// loop from which the code runs forward to the jump back and which no
+// earlier jump passes, that of a continue, or header when there is none
+func (l *routineLifter) postStart(header, last int) int {
+	if op := l.d.code[last].Opcode; op != JMP && op != JMP_L {
+		return header
+	}
+	post := last
+	for j := header; j < last; j++ {
+		if op := l.d.code[j].Opcode; op != JMP && op != JMP_L {
+			continue
+		}
+		if t, ok := l.d.target(j, 0); ok && t > j && t > header && t < post && l.forward(t, last) && !l.entered(header, t, last) {
+			post = t
+		}
+	}
+	if post == last {
+		return header
+	}
+	return post
+}
+
+// forward reports whether the code from i runs to end only jumping
+// forward within it, without returning
+func (l *routineLifter) forward(i, end int) bool {
+	for k := i; k < end; k++ {
+		next := l.d.successors(k)
+		if len(next) == 0 {
+			return false
+		}
+		for _, n := range next {
+			if n <= k || n > end {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// entered reports whether a jump from header up to i targets an
+// instruction after i and before end
+func (l *routineLifter) entered(header, i, end int) bool {
+	for j := header; j < i; j++ {
+		for _, n := range l.d.successors(j) {
+			if n > i && n < end {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// instruction lifts an instruction that does not change the flow, false
+// when its stack effect cannot be followed
+func (l *routineLifter) instruction(out []YulStatement, i int, stack *liftStack) ([]YulStatement, bool) {
+	instr := l.d.code[i]
+	op := instr.Opcode
+	push := func(items ...YulExpression) {
+		stack.items = append(stack.items, items...)
+	}
+	// share returns the item n from the top, held in a variable when it is
+	// to be used twice
+	share := func(n int) YulExpression {
+		l.reach(stack, n+1)
+		k := len(stack.items) - 1 - n
+		switch stack.items[k].(type) {
+		case *YulLiteral, *YulIdentifier:
+		default:
+			var names []YulExpression
+			out, names = l.temp(out, stack.items[k], 1)
+			stack.items[k] = names[0]
+		}
+		return stack.items[k]
+	}
+
+	if kind, store, index, ok := slotAccess(op, instr.Operand); ok {
+		name := fmt.Sprintf("%s_%d", kind, index)
+		if !store {
+			push(yulIdentifier(name))
+			return out, true
+		}
+		return l.store(out, stack, name, l.pop(stack, 1)[0]), true
+	}
+
+	if op >= PUSH0 && op <= PUSH16 {
+		push(integerLiteral(big.NewInt(int64(op - PUSH0))))
+		return out, true
+	}
+	switch op {
+	case NOP, INITSSLOT:
+	case INITSLOT:
+		if len(instr.Operand) != 2 {
+			return out, false
+		}
+		if locals := int(instr.Operand[0]); locals > 0 {
+			decl := &YulVariableDeclaration{}
+			for k := 0; k < locals; k++ {
+				decl.Variables = append(decl.Variables, &YulTypedName{Name: fmt.Sprintf("loc_%d", k)})
+			}
+			out = append(out, decl)
+		}
+		for k, item := range l.popped(stack, int(instr.Operand[1])) {
+			if name := fmt.Sprintf("arg_%d", k); !mentionsExactly(item, name) {
+				out = append(out, &YulAssignment{VariableNames: []string{name}, Value: item})
+			}
+		}
+
+	case PUSHINT8, PUSHINT16, PUSHINT32, PUSHINT64, PUSHINT128, PUSHINT256:
+		push(integerLiteral(decodeInteger(instr.Operand)))
+	case PUSHM1:
+		push(integerLiteral(big.NewInt(-1)))
+	case PUSHT, PUSHF:
+		push(&YulLiteral{Kind: LiteralKindBool, Value: strconv.FormatBool(op == PUSHT), Type: DataTypeBool})
+	case PUSHNULL:
+		push(yulIdentifier("null"))
+	case PUSHDATA1, PUSHDATA2, PUSHDATA4:
+		push(dataLiteral(instr.Operand))
+	case PUSHA:
+		t, ok := l.d.target(i, 0)
+		if !ok {
+			return out, false
+		}
+		push(yulIdentifier(l.d.routines[t].name))
+
+	case DROP:
+		out = l.discard(out, stack, l.pop(stack, 1)[0])
+	case NIP:
+		items := l.pop(stack, 2)
+		push(items[1])
+	case XDROP:
+		n, ok := l.count(stack)
+		if !ok {
+			return out, false
+		}
+		l.reach(stack, n+1)
+		k := len(stack.items) - 1 - n
+		stack.items = append(stack.items[:k], stack.items[k+1:]...)
+	case CLEAR:
+		stack.items = stack.items[:0]
+	case DUP:
+		push(share(0))
+	case OVER:
+		push(share(1))
+	case PICK:
+		n, ok := l.count(stack)
+		if !ok {
+			return out, false
+		}
+		push(share(n))
+	case TUCK:
+		item := share(0)
+		items := l.pop(stack, 2)
+		push(item, items[0], items[1])
+	case SWAP:
+		items := l.pop(stack, 2)
+		push(items[1], items[0])
+	case ROT:
+		items := l.pop(stack, 3)
+		push(items[1], items[2], items[0])
+	case ROLL:
+		n, ok := l.count(stack)
+		if !ok {
+			return out, false
+		}
+		items := l.pop(stack, n+1)
+		push(append(items[1:], items[0])...)
+	case REVERSE3, REVERSE4:
+		push(l.popped(stack, int(op-REVERSE3)+3)...)
+	case REVERSEN:
+		n, ok := l.count(stack)
+		if !ok {
+			return out, false
+		}
+		push(l.popped(stack, n)...)
+
+	case PACK, PACKSTRUCT, PACKMAP:
+		n, ok := l.count(stack)
+		if !ok {
+			return out, false
+		}
+		if op == PACKMAP {
+			n *= 2
+		}
+		push(builtinCall(strings.ToLower(OpcodeMnemonic(op)), SourcePosition{}, l.popped(stack, n)...))
+
+	case SYSCALL:
+		service, ok := DefaultInteropRegistry().Lookup(string(instr.Operand))
+		if !ok || service.Pop == StackVariable || service.Push == StackVariable {
+			return out, false
+		}
+		var results []YulExpression
+		out, results = l.effect(out, stack, builtinCall(service.Name, SourcePosition{}, l.popped(stack, service.Pop)...), service.Push, false)
+		push(results...)
+
+	case CALL, CALL_L:
+		t, ok := l.d.target(i, 0)
+		if !ok {
+			return out, false
+		}
+		out = l.call(out, stack, l.d.routines[t])
+	case CALLA:
+		pointer, ok := l.pop(stack, 1)[0].(*YulIdentifier)
+		if !ok {
+			return out, false
+		}
+		start, ok := l.d.names[pointer.Name]
+		if !ok {
+			return out, false
+		}
+		out = l.call(out, stack, l.d.routines[start])
+	case CALLT:
+		index := int(binary.LittleEndian.Uint16(instr.Operand))
+		if index >= len(l.d.options.Tokens) {
+			return out, false
+		}
+		token := l.d.options.Tokens[index]
+		var hash Uint160
+		for j := range hash {
+			hash[j] = token.Hash[len(hash)-1-j]
+		}
+		args := []YulExpression{
+			&YulLiteral{Kind: LiteralKindHex, Value: "0x" + hash.String(), Type: DataTypeBytes32},
+			&YulLiteral{Kind: LiteralKindString, Value: token.Method, Type: DataTypeString},
+		}
+		results := 0
+		if token.HasReturnValue {
+			results = 1
+		}
+		var pushed []YulExpression
+		out, pushed = l.effect(out, stack, builtinCall("callt", SourcePosition{}, append(args, l.popped(stack, int(token.ParametersCount))...)...), results, false)
+		push(pushed...)
+
+	case TRY, TRY_L:
+		var args []YulExpression
+		for n := 0; n < 2; n++ {
+			if t, ok := l.d.target(i, n); ok {
+				args = append(args, yulIdentifier(l.d.routines[t].name))
+			} else {
+				args = append(args, NewWordLiteral(big.NewInt(0), SourcePosition{}))
+			}
+		}
+		out = append(out, &YulExpressionStatement{Expression: builtinCall("try", SourcePosition{}, args...)})
+
+	default:
+		info, ok := LookupOpcode(op)
+		if !ok || info.Pop == StackVariable || info.Push == StackVariable || info.Push > 1 {
+			return out, false
+		}
+		name := strings.ToLower(info.Mnemonic)
+		if op == NOT {
+			name = "iszero"
+		}
+		args := l.pop(stack, info.Pop)
+		if op == CONVERT || op == ISTYPE || op == NEWARRAY_T {
+			typeName, ok := stackItemTypeNames[NeoVMType(instr.Operand[0])]
+			if !ok {
+				return out, false
+			}
+			args = append(args, yulIdentifier(typeName))
+		}
+		call := builtinCall(name, SourcePosition{}, args...)
+		switch {
+		case info.Push == 0, op == POPITEM, op == DEPTH:
+			var results []YulExpression
+			out, results = l.effect(out, stack, call, info.Push, false)
+			push(results...)
+		default:
+			push(call)
+		}
+	}
+	return out, true
+}
+
+// call lifts a call of routine, whose arguments are on stack
+func (l *routineLifter) call(out []YulStatement, stack *liftStack, routine *decompiledRoutine) []YulStatement {
+	args := l.popped(stack, routine.inputs)
+	var results []YulExpression
+	out, results = l.effect(out, stack, builtinCall(routine.name, SourcePosition{}, args...), routine.outputs, true)
+	for k := len(results) - 1; k >= 0; k-- {
+		stack.items = append(stack.items, results[k])
+	}
+	return out
+}
+
+// gotoStatement is the statement of a jump that is not structured, to the
+// instruction i or an unknown target when i is -1
+func (l *routineLifter) gotoStatement(i int) YulStatement {
+	l.gotos++
+	offset := -1
+	if i >= 0 && i < len(l.d.offsets) {
+		offset = l.d.offsets[i]
+	}
+	return &YulExpressionStatement{Expression: builtinCall("goto", SourcePosition{}, offsetLiteral(offset))}
+}
+
+// slotAccess decodes a slot instruction: the kind of slot, whether it
+// stores, and the index
+func slotAccess(op NeoOpcode, operand []byte) (string, bool, int, bool) {
+	bases := []struct {
+		op    NeoOpcode
+		kind  string
+		store bool
+	}{
+		{LDSFLD, "sfld", false}, {STSFLD, "sfld", true},
+		{LDLOC, "loc", false}, {STLOC, "loc", true},
+		{LDARG, "arg", false}, {STARG, "arg", true},
+	}
+	for _, base := range bases {
+		if op == base.op && len(operand) == 1 {
+			return base.kind, base.store, int(operand[0]), true
+		}
+		if op >= base.op-shortSlotForms && op < base.op {
+			return base.kind, base.store, int(op - (base.op - shortSlotForms)), true
+		}
+	}
+	return "", false, 0, false
+}
+
+func yulIdentifier(name string) *YulIdentifier {
+	return &YulIdentifier{Name: name}
+}
+
+// negate returns the condition that holds when cond does not
+func negate(cond YulExpression) YulExpression {
+	if inner, ok := iszeroOperand(cond); ok {
+		return inner
+	}
+	return builtinCall("iszero", SourcePosition{}, cond)
+}
+
+// iszeroOperand returns x of iszero(x)
+func iszeroOperand(expr YulExpression) (YulExpression, bool) {
+	if call, ok := expr.(*YulFunctionCall); ok && call.FunctionName.Name == "iszero" && len(call.Arguments) == 1 {
+		return call.Arguments[0], true
+	}
+	return nil, false
+}
+
+func offsetLiteral(offset int) YulExpression {
+	return integerLiteral(big.NewInt(int64(offset)))
+}
+
+// integerLiteral is a number literal, or negate of one for values below
+// zero, which Yul literals cannot be
+func integerLiteral(value *big.Int) YulExpression {
+	if value.Sign() < 0 {
+		return builtinCall("negate", SourcePosition{}, NewWordLiteral(new(big.Int).Neg(value), SourcePosition{}))
+	}
+	return NewWordLiteral(value, SourcePosition{})
+}
+
+// decodeInteger reads a little-endian two's complement integer
+func decodeInteger(data []byte) *big.Int {
+	bigEndian := make([]byte, len(data))
+	for i, b := range data {
+		bigEndian[len(data)-1-i] = b
+	}
+	value := new(big.Int).SetBytes(bigEndian)
+	if len(data) > 0 && data[len(data)-1]&0x80 != 0 {
+		value.Sub(value, new(big.Int).Lsh(big.NewInt(1), uint(8*len(data))))
+	}
+	return value
+}
+
+// dataLiteral is a string literal of data that reads as text, a hex
+// literal otherwise
+func dataLiteral(data []byte) *YulLiteral {
+	text := len(data) != 1
+	for _, b := range data {
+		if !unicode.IsLetter(rune(b)) && !unicode.IsDigit(rune(b)) && !strings.ContainsRune(" _-.,:;!?()'/", rune(b)) || b > 0x7e {
+			text = false
+		}
+	}
+	if text {
+		return &YulLiteral{Kind: LiteralKindString, Value: string(data), Type: DataTypeString}
+	}
+	return &YulLiteral{Kind: LiteralKindHex, Value: "0x" + hex.EncodeToString(data), Type: DataTypeBytes32}
+}
+
+// RunDecompileCommand runs "decompile" with the given arguments and returns
+// the process exit code
+func RunDecompileCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("decompile", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	manifestPath := flags.String("manifest", "", "manifest naming the methods, by default name.manifest.json next to name.nef")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: decompile [flags] <file.nef|file.hex>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	path := flags.Arg(0)
+	script, tokens, status := readScriptFile(path, stderr)
+	if status != exitOK {
+		return status
+	}
+	options := DecompileOptions{Tokens: tokens, Methods: make(map[int]string)}
+	if *manifestPath == "" && strings.HasSuffix(path, ArtifactNEF) {
+		sibling := strings.TrimSuffix(path, ArtifactNEF) + ArtifactManifest
+		if _, err := os.Stat(sibling); err == nil {
+			*manifestPath = sibling
+		}
+	}
+	if *manifestPath != "" {
+		data, err := os.ReadFile(*manifestPath)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailed
+		}
+		var manifest ContractManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", *manifestPath, err)
+			return exitFailed
+		}
+		for _, method := range manifest.ABI.Methods {
+			options.Methods[method.Offset] = method.Name
+		}
+	}
+
+	ast, err := Decompile(script, options)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", path, err)
+		return exitFailed
+	}
+	fmt.Fprint(stdout, PrintYul(ast))
+	return exitOK
+}
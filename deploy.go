@@ -0,0 +1,82 @@
+package main
+
+// Deployment.
+//
+// Neo runs no constructor script: ContractManagement deploys the contract
+// script and then calls its _deploy(data, update) method. The code of a
+// deployable object, which solc emits as the constructor, therefore also
+// becomes the body of _deploy, placed after the runtime code. It runs on
+// the first deployment only; updates keep the storage the constructor
+// wrote. The constructor's labels are renamed so they cannot collide with
+// those of the runtime, and its return hands no code back: it drops the
+// memory range and ends the method. caller() is the account deploying
+// the contract rather than ContractManagement.
+
+// DeployMethod is the method ContractManagement calls after deployment
+const DeployMethod = "_deploy"
+
+// deployLabel renames a label of the constructor code of _deploy
+func deployLabel(label string) string {
+	return DeployMethod + "/" + label
+}
+
+// emitDeploy emits _deploy with the constructor code block
+func (g *CodeGenerator) emitDeploy(block *YulBlock) error {
+	var labels *OrderedMap[int]
+	var pending []PendingLabel
+	var tries []handlerFrame
+	g.deploying = true
+	code, err := g.generateSeparately(block, func() error {
+		labels, pending, tries = g.labelMap, g.pendingLabels, g.tries
+		return nil
+	})
+	g.deploying = false
+	if err != nil {
+		return err
+	}
+
+	method := &ContractMethod{
+		Name:       DeployMethod,
+		Parameters: []MethodParameter{{Name: "data", Type: "Any"}, {Name: "update", Type: "Boolean"}},
+	}
+	c := memoryCode{g, block.Location}
+	constructor := g.createUniqueLabel("deploy_constructor")
+	g.emitReturnGuard(block.Location)
+	g.entry.stubs = append(g.entry.stubs, stubMethod{DeployMethod, method})
+	depth := g.stackTracker.currentDepth
+	g.stackTracker.currentDepth = len(method.Parameters)
+	g.markLabel(DeployMethod)
+	c.op(NewStackInstruction(DROP))
+	c.jump(JMPIFNOT, constructor)
+	c.op(NewControlFlowInstruction(RET, 0))
+	g.markLabel(constructor)
+	g.stackTracker.currentDepth = depth
+
+	base := len(g.instructions)
+	g.instructions = append(g.instructions, code...)
+	labels.Range(func(name string, index int) bool {
+		g.labelMap.Set(deployLabel(name), base+index)
+		return true
+	})
+	for _, label := range pending {
+		label.Name = deployLabel(label.Name)
+		label.InstructionIndex += base
+		g.pendingLabels = append(g.pendingLabels, label)
+	}
+	for _, frame := range tries {
+		frame.try += base
+		frame.catch, frame.end = deployLabel(frame.catch), deployLabel(frame.end)
+		g.tries = append(g.tries, frame)
+	}
+	return nil
+}
+
+// generateDeployer pushes the account deploying the contract, the sender
+// of the transaction, as generateCaller pushes callers
+func (g *CodeGenerator) generateDeployer(location SourcePosition) {
+	c := memoryCode{g, location}
+	c.syscall("System.Runtime.GetScriptContainer")
+	c.push(transactionSender)
+	c.arithmetic(PICKITEM)
+	c.addressWord()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Diagnostic levels.
+//
+// Each diagnostic code can be turned off or made an error with
+// DiagnosticLevels entries or --diagnostic flags, "code=level", where code
+// is a code such as YUL3103 or its name, such as unused-variable, and level
+// is off, warning or error. WarningsAsErrors, or --warn-as-error, makes an
+// error of every warning that is not turned off. A warning made an error
+// fails the compilation.
+//
+// A line comment "// yul-disable-next-line name..." suppresses what the
+// static analyzer reports on the next line, warnings and security issues
+// alike. Names are codes or names as above, separated by spaces or commas;
+// a comment without any suppresses everything on the line.
+
+// DiagnosticLevel is what becomes of the diagnostics of a code
+type DiagnosticLevel string
+
+const (
+	DiagnosticOff     DiagnosticLevel = "off"
+	DiagnosticWarning DiagnosticLevel = "warning"
+	DiagnosticError   DiagnosticLevel = "error"
+)
+
+const (
+	diagnosticFlag  = "--diagnostic"
+	warnAsErrorFlag = "--warn-as-error"
+
+	// suppressionComment starts a line comment suppressing the next line
+	suppressionComment = "yul-disable-next-line"
+)
+
+// diagnosticNames are the names of the codes of analyzer findings
+var diagnosticNames = map[string]string{
+	"shadowing":         CodeShadowing,
+	"unassigned-read":   CodeUnassignedRead,
+	"unused-variable":   CodeUnusedVariable,
+	"unused-assignment": CodeUnusedAssignment,
+	"unreachable-code":  CodeUnreachableCode,
+	"overflow":          CodeOverflow,
+	"reentrancy":        CodeReentrancy,
+}
+
+var diagnosticCodePattern = regexp.MustCompile(`^YUL[0-9]{4}$`)
+
+// ParseDiagnosticCode returns the code a code or name stands for
+func ParseDiagnosticCode(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if code := strings.ToUpper(value); diagnosticCodePattern.MatchString(code) {
+		return code, nil
+	}
+	if code, ok := diagnosticNames[strings.ToLower(value)]; ok {
+		return code, nil
+	}
+	names := make([]string, 0, len(diagnosticNames))
+	for name := range diagnosticNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("unknown diagnostic %q (expected a code such as YUL3103 or one of %s)", value, strings.Join(names, ", "))
+}
+
+// ParseDiagnosticLevel parses a "code=level" entry
+func ParseDiagnosticLevel(value string) (string, DiagnosticLevel, error) {
+	name, level, ok := strings.Cut(value, "=")
+	if !ok {
+		return "", "", fmt.Errorf("invalid diagnostic level %q (expected code=level)", value)
+	}
+	code, err := ParseDiagnosticCode(name)
+	if err != nil {
+		return "", "", err
+	}
+	switch DiagnosticLevel(strings.ToLower(strings.TrimSpace(level))) {
+	case DiagnosticOff:
+		return code, DiagnosticOff, nil
+	case DiagnosticWarning:
+		return code, DiagnosticWarning, nil
+	case DiagnosticError:
+		return code, DiagnosticError, nil
+	}
+	return "", "", fmt.Errorf("invalid level %q of %s (expected off, warning or error)", level, name)
+}
+
+// DiagnosticLevelsFromConfig returns the levels of a configuration by code.
+// --diagnostic flags in CompilerFlags follow DiagnosticLevels, and a later
+// entry for a code takes precedence.
+func DiagnosticLevelsFromConfig(config CompilerConfig) (map[string]DiagnosticLevel, []error) {
+	values := append(append([]string{}, config.DiagnosticLevels...), flagValues(config.CompilerFlags, diagnosticFlag)...)
+	levels := make(map[string]DiagnosticLevel)
+	var errs []error
+	for _, value := range values {
+		code, level, err := ParseDiagnosticLevel(value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		levels[code] = level
+	}
+	return levels, errs
+}
+
+// WarningsAsErrorsRequested reports whether a configuration makes errors
+// of warnings
+func WarningsAsErrorsRequested(config CompilerConfig) bool {
+	return config.WarningsAsErrors || flagSet(config.CompilerFlags, warnAsErrorFlag)
+}
+
+// diagnosticLevel returns the level of a warning of code
+func (c *CompilerContext) diagnosticLevel(code string) DiagnosticLevel {
+	level, ok := c.DiagnosticLevels[code]
+	if !ok {
+		level = DiagnosticWarning
+	}
+	if level == DiagnosticWarning && c.WarningsAsErrors {
+		return DiagnosticError
+	}
+	return level
+}
+
+// applyDiagnosticLevels drops the warnings of result that are turned off
+// and moves those made errors to its errors, failing when there are any
+func (c *YulToNeoCompiler) applyDiagnosticLevels(result *CompilationResult) error {
+	var warnings []CompilerWarning
+	promoted := 0
+	for _, warning := range result.Warnings {
+		code := diagnosticCode(warning.Phase, warning.Code)
+		switch c.context.diagnosticLevel(code) {
+		case DiagnosticOff:
+		case DiagnosticError:
+			result.Errors = append(result.Errors, CompilerError{
+				Phase:    warning.Phase,
+				Message:  warning.Message,
+				File:     warning.File,
+				Line:     warning.Line,
+				Column:   warning.Column,
+				Length:   warning.Length,
+				Severity: "error",
+				Code:     code,
+				Related:  warning.Related,
+				Fix:      warning.Fix,
+			})
+			promoted++
+		default:
+			warnings = append(warnings, warning)
+		}
+	}
+	result.Warnings = warnings
+	if promoted == 0 {
+		return nil
+	}
+	result.Contract, result.GasReport, result.DebugInfo = nil, nil, nil
+	return fmt.Errorf("%d warning(s) treated as errors", promoted)
+}
+
+// Suppression is a yul-disable-next-line comment
+type Suppression struct {
+	File  string   `json:"file,omitempty"`
+	Line  int      `json:"line"`            // Line suppressed, the one after the comment
+	Names []string `json:"names,omitempty"` // Codes or names suppressed, nil for all
+}
+
+// parseSuppression returns the names of a line comment's text, after the
+// "//", and whether it is a suppression comment
+func parseSuppression(text string) ([]string, bool) {
+	fields := strings.Fields(strings.ReplaceAll(text, ",", " "))
+	if len(fields) == 0 || fields[0] != suppressionComment {
+		return nil, false
+	}
+	return fields[1:], true
+}
+
+// Suppresses reports whether the comment suppresses code at position
+func (s Suppression) Suppresses(code string, position SourcePosition) bool {
+	if s.Line != position.Line || s.File != diagnosticFile(position) {
+		return false
+	}
+	if len(s.Names) == 0 {
+		return true
+	}
+	for _, name := range s.Names {
+		if suppressed, err := ParseDiagnosticCode(name); err == nil && suppressed == code {
+			return true
+		}
+	}
+	return false
+}
+
+// securityIssueCode returns the code of a security issue
+func securityIssueCode(issue SecurityIssue) string {
+	switch issue.Type {
+	case SecurityIssueOverflow, SecurityIssueUnderflow:
+		return CodeOverflow
+	case SecurityIssueReentrancy:
+		return CodeReentrancy
+	}
+	return CodeAnalysis
+}
+
+// suppressed reports whether the analyzer drops a finding of code at
+// position, suppressed by a comment of ast or turned off
+func (sa *StaticAnalyzer) suppressed(ast *YulAST, code string, position SourcePosition) bool {
+	if sa.context != nil && sa.context.DiagnosticLevels[code] == DiagnosticOff {
+		return true
+	}
+	for _, suppression := range ast.Suppressions {
+		if suppression.Suppresses(code, position) {
+			return true
+		}
+	}
+	return false
+}
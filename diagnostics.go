@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// Diagnostics.
+//
+// Every error and warning of a compilation is also a Diagnostic: a stable
+// code, a severity, the phase reporting it, the source range, notes on
+// related locations and a suggested fix. Codes are "YUL" and four digits,
+// the first digit naming the part of the compiler: 0 configuration, 1 the
+// lexer, 2 the parser, 3 the analyzer, 4 the optimizer and code generator,
+// 5 linking, limits and finalization, and 6 the ABI check. Each phase has
+// a code for whatever it reports; the kinds tools may want to tell apart
+// have their own.
+//
+// Diagnostics can be written as JSON, a list of Diagnostic, or as a SARIF
+// 2.1.0 log for code scanning tools.
+
+// DiagnosticSeverity is how serious a diagnostic is
+type DiagnosticSeverity string
+
+const (
+	SeverityError   DiagnosticSeverity = "error"
+	SeverityWarning DiagnosticSeverity = "warning"
+	SeverityInfo    DiagnosticSeverity = "info"
+)
+
+// Diagnostic codes
+const (
+	CodeUnknown            = "YUL0000"
+	CodeConfiguration      = "YUL0001"
+	CodeLexical            = "YUL1001"
+	CodeSyntax             = "YUL2001"
+	CodeImport             = "YUL2002"
+	CodeUnavailableBuiltin = "YUL2003"
+	CodeInvalidBuiltinCall = "YUL2004"
+	CodeNormalization      = "YUL3001"
+	CodeAnalysis           = "YUL3002"
+	CodeShadowing          = "YUL3101"
+	CodeUnassignedRead     = "YUL3102"
+	CodeUnusedVariable     = "YUL3103"
+	CodeUnusedAssignment   = "YUL3104"
+	CodeUnreachableCode    = "YUL3105"
+	CodeOverflow           = "YUL3106"
+	CodeReentrancy         = "YUL3107"
+	CodeOptimization       = "YUL4001"
+	CodeCodeGeneration     = "YUL4002"
+	CodeStack              = "YUL4003"
+	CodeLinking            = "YUL5001"
+	CodeLimits             = "YUL5002"
+	CodeRuntime            = "YUL5003"
+	CodeABI                = "YUL6001"
+)
+
+// phaseCodes are the codes of the phases, for what they report without a
+// code of its own
+var phaseCodes = map[string]string{
+	"Configuration":       CodeConfiguration,
+	"Lexing":              CodeLexical,
+	"Parsing":             CodeSyntax,
+	"Normalization":       CodeNormalization,
+	"Static Analysis":     CodeAnalysis,
+	"Optimization":        CodeOptimization,
+	"Code Generation":     CodeCodeGeneration,
+	"Linking":             CodeLinking,
+	"Limit Validation":    CodeLimits,
+	"Runtime Integration": CodeRuntime,
+	"ABI Check":           CodeABI,
+}
+
+// DiagnosticRange is a range of source, from the start position to the
+// end position on the same or a later line. Lines and columns are 1-based
+// and 0 when unknown.
+type DiagnosticRange struct {
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	EndColumn int    `json:"end_column,omitempty"`
+}
+
+// DiagnosticNote points at a location related to a diagnostic
+type DiagnosticNote struct {
+	Message string          `json:"message"`
+	Range   DiagnosticRange `json:"range"`
+}
+
+// Diagnostic is an error or warning of a compilation
+type Diagnostic struct {
+	Code     string             `json:"code"`
+	Severity DiagnosticSeverity `json:"severity"`
+	Phase    string             `json:"phase"`
+	Message  string             `json:"message"`
+	Range    DiagnosticRange    `json:"range"`
+	Related  []DiagnosticNote   `json:"related,omitempty"`
+	Fix      string             `json:"fix,omitempty"` // Suggested change, in words
+}
+
+// sourceRange returns the range of length characters at position
+func sourceRange(position SourcePosition) DiagnosticRange {
+	return rangeAt(diagnosticFile(position), position.Line, position.Column, position.Length)
+}
+
+// rangeAt returns the range of length characters at line and column
+func rangeAt(file string, line, column, length int) DiagnosticRange {
+	r := DiagnosticRange{File: file, Line: line, Column: column}
+	if line > 0 {
+		r.EndLine, r.EndColumn = line, column+length
+	}
+	return r
+}
+
+// relatedNote notes position with message
+func relatedNote(position SourcePosition, message string) DiagnosticNote {
+	return DiagnosticNote{Message: message, Range: sourceRange(position)}
+}
+
+// diagnosticCode returns code, or the code of phase when it is empty
+func diagnosticCode(phase, code string) string {
+	if code != "" {
+		return code
+	}
+	if code, ok := phaseCodes[phase]; ok {
+		return code
+	}
+	return CodeUnknown
+}
+
+// Diagnostic returns the error as a diagnostic
+func (e CompilerError) Diagnostic() Diagnostic {
+	return Diagnostic{
+		Code:     diagnosticCode(e.Phase, e.Code),
+		Severity: SeverityError,
+		Phase:    e.Phase,
+		Message:  e.Message,
+		Range:    rangeAt(e.File, e.Line, e.Column, e.Length),
+		Related:  e.Related,
+		Fix:      e.Fix,
+	}
+}
+
+// Diagnostic returns the warning as a diagnostic
+func (w CompilerWarning) Diagnostic() Diagnostic {
+	return Diagnostic{
+		Code:     diagnosticCode(w.Phase, w.Code),
+		Severity: SeverityWarning,
+		Phase:    w.Phase,
+		Message:  w.Message,
+		Range:    rangeAt(w.File, w.Line, w.Column, w.Length),
+		Related:  w.Related,
+		Fix:      w.Fix,
+	}
+}
+
+// Diagnostics returns the errors and then the warnings of the result
+func (r *CompilationResult) Diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, compilerErr := range r.Errors {
+		diagnostics = append(diagnostics, compilerErr.Diagnostic())
+	}
+	for _, warning := range r.Warnings {
+		diagnostics = append(diagnostics, warning.Diagnostic())
+	}
+	return diagnostics
+}
+
+// WriteDiagnosticsJSON writes diagnostics as a JSON list
+func WriteDiagnosticsJSON(w io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
+
+// SARIF log, the parts of the 2.1.0 format diagnostics use
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version"`
+	Rules   []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string            `json:"ruleId"`
+	Level            string            `json:"level"`
+	Message          sarifMessage      `json:"message"`
+	Locations        []sarifLocation   `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation   `json:"relatedLocations,omitempty"`
+	Properties       map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	ID       int                   `json:"id,omitempty"`
+	Physical sarifPhysicalLocation `json:"physicalLocation"`
+	Message  *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	Artifact sarifArtifact `json:"artifactLocation"`
+	Region   *sarifRegion  `json:"region,omitempty"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// sarifLevels are the SARIF levels of the severities
+var sarifLevels = map[DiagnosticSeverity]string{
+	SeverityError:   "error",
+	SeverityWarning: "warning",
+	SeverityInfo:    "note",
+}
+
+// sarifLocationOf returns the location of a range, nil when it has no file
+func sarifLocationOf(r DiagnosticRange) *sarifLocation {
+	if r.File == "" {
+		return nil
+	}
+	location := &sarifLocation{Physical: sarifPhysicalLocation{Artifact: sarifArtifact{URI: strings.ReplaceAll(r.File, "\\", "/")}}}
+	if r.Line > 0 {
+		location.Physical.Region = &sarifRegion{StartLine: r.Line, StartColumn: r.Column, EndLine: r.EndLine, EndColumn: r.EndColumn}
+	}
+	return location
+}
+
+// WriteSARIF writes diagnostics as a SARIF log with one run. A suggested
+// fix is the "fix" property of its result, since SARIF fixes are edits.
+func WriteSARIF(w io.Writer, diagnostics []Diagnostic) error {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: NEFCompilerName, Version: CompilerVersion, Rules: []sarifRule{}}},
+		Results: []sarifResult{},
+	}
+	rules := make(map[string]bool)
+	for _, d := range diagnostics {
+		if !rules[d.Code] {
+			rules[d.Code] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: d.Code})
+		}
+		result := sarifResult{RuleID: d.Code, Level: sarifLevels[d.Severity], Message: sarifMessage{Text: d.Message}}
+		if location := sarifLocationOf(d.Range); location != nil {
+			result.Locations = append(result.Locations, *location)
+		}
+		for i, note := range d.Related {
+			if location := sarifLocationOf(note.Range); location != nil {
+				location.ID = i + 1
+				location.Message = &sarifMessage{Text: note.Message}
+				result.RelatedLocations = append(result.RelatedLocations, *location)
+			}
+		}
+		if d.Fix != "" {
+			result.Properties = map[string]string{"fix": d.Fix}
+		}
+		run.Results = append(run.Results, result)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	})
+}
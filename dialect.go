@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Yul dialects.
+//
+// A dialect is the set of builtins Yul code may call. solc writes Yul for
+// an EVM version, and builtins come and go with versions: basefee came
+// with london, prevrandao replaced difficulty in paris, and mcopy, tload,
+// tstore, blobhash and blobbasefee came with cancun. The lexer classifies
+// only the builtins of the configured dialect, and the parser rejects a
+// call to a builtin of another dialect unless the program defines a
+// function of that name, naming the dialect that has it, so code written
+// for another EVM fails at the call instead of in code generation.
+//
+// Each EVM version from homestead to cancun is a dialect. The neo dialect,
+// the default, is cancun with the builtins this compiler adds for Neo,
+// sha256 and those of neo_builtins.go.
+//
+// A few EVM builtins have nothing to compile to on Neo. Every dialect
+// keeps them, as solc may write them, but the parser rejects a call to one
+// with the reason, at the call.
+
+// Dialect names
+const (
+	DialectShanghai = "shanghai"
+	DialectCancun   = "cancun"
+	DialectNeo      = "neo"
+	DefaultDialect  = DialectNeo
+)
+
+const dialectFlag = "--dialect"
+
+// Dialect is the set of builtins of a Yul dialect
+type Dialect struct {
+	Name     string
+	builtins map[string]bool
+}
+
+// evmVersions lists the EVM versions, oldest first, with the builtins each
+// adds to and removes from the previous one
+var evmVersions = []struct {
+	name           string
+	added, removed []string
+}{
+	{name: "homestead", added: []string{
+		"stop", "add", "sub", "mul", "div", "sdiv", "mod", "smod", "exp", "not",
+		"lt", "gt", "slt", "sgt", "eq", "iszero", "and", "or", "xor", "byte",
+		"signextend", "addmod", "mulmod", "keccak256", "pop",
+		"mload", "mstore", "mstore8", "sload", "sstore", "msize", "gas",
+		"address", "balance", "origin", "caller", "callvalue",
+		"calldataload", "calldatasize", "calldatacopy", "codesize", "codecopy",
+		"gasprice", "extcodesize", "extcodecopy", "blockhash", "coinbase",
+		"timestamp", "number", "difficulty", "gaslimit",
+		"log0", "log1", "log2", "log3", "log4",
+		"create", "call", "callcode", "delegatecall", "return", "invalid", "selfdestruct",
+		// Object access, which is Yul's rather than the EVM's
+		"datasize", "dataoffset", "datacopy", "setimmutable", "loadimmutable",
+		"linkersymbol", "memoryguard",
+	}},
+	{name: "tangerineWhistle"},
+	{name: "spuriousDragon"},
+	{name: "byzantium", added: []string{"returndatasize", "returndatacopy", "staticcall", "revert"}},
+	{name: "constantinople", added: []string{"shl", "shr", "sar", "create2", "extcodehash"}},
+	{name: "petersburg"},
+	{name: "istanbul", added: []string{"chainid", "selfbalance"}},
+	{name: "berlin"},
+	{name: "london", added: []string{"basefee"}},
+	{name: "paris", added: []string{"prevrandao"}, removed: []string{"difficulty"}},
+	{name: DialectShanghai},
+	{name: DialectCancun, added: []string{"mcopy", "tload", "tstore", "blobhash", "blobbasefee"}},
+}
+
+// unsupportedBuiltins are the EVM builtins Neo has no equivalent of, with
+// the reason
+var unsupportedBuiltins = map[string]string{
+	"codesize":    "a contract cannot read its own script",
+	"extcodecopy": "contract scripts are not readable, extcodesize and extcodehash read their NEF files",
+	"callcode":    "calls always run in the storage context of the callee",
+	"difficulty":  "blocks have no difficulty",
+	"basefee":     "blocks have no base fee",
+	"blobhash":    "transactions carry no blobs",
+	"blobbasefee": "transactions carry no blobs",
+}
+
+// neoBuiltins are the builtins the neo dialect adds to cancun
+var neoBuiltins = []string{"sha256"}
+
+// DialectByName returns the dialect called name, the default for ""
+func DialectByName(name string) (*Dialect, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = DefaultDialect
+	}
+	if strings.EqualFold(name, DialectNeo) {
+		d := evmDialect(len(evmVersions) - 1)
+		d.Name = DialectNeo
+		for _, builtin := range neoBuiltins {
+			d.builtins[builtin] = true
+		}
+		return d, nil
+	}
+	for i, version := range evmVersions {
+		if strings.EqualFold(name, version.name) {
+			return evmDialect(i), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown dialect %q (expected an EVM version such as %s or %s, or %s)", name, DialectShanghai, DialectCancun, DialectNeo)
+}
+
+// evmDialect returns the dialect of the EVM version at index of evmVersions
+func evmDialect(index int) *Dialect {
+	d := &Dialect{Name: evmVersions[index].name, builtins: make(map[string]bool)}
+	for _, version := range evmVersions[:index+1] {
+		for _, builtin := range version.added {
+			d.builtins[builtin] = true
+		}
+		for _, builtin := range version.removed {
+			delete(d.builtins, builtin)
+		}
+	}
+	return d
+}
+
+// DialectFromConfig returns the dialect of a configuration. A --dialect
+// flag in CompilerFlags takes precedence over Dialect.
+func DialectFromConfig(config CompilerConfig) (*Dialect, error) {
+	return DialectByName(flagValue(config.CompilerFlags, dialectFlag, config.Dialect))
+}
+
+// IsBuiltin reports whether name is a builtin of the dialect
+func (d *Dialect) IsBuiltin(name string) bool {
+	return d.builtins[name] || isVerbatim(name) || (d.Name == DialectNeo && knownNeoBuiltin(name))
+}
+
+// unavailable explains why name, a builtin of some other dialect, is not
+// one of d, or returns "" when it is one of d or of no dialect
+func (d *Dialect) unavailable(name string) string {
+	if d.IsBuiltin(name) {
+		return ""
+	}
+	reason := ""
+	for _, version := range evmVersions {
+		for _, builtin := range version.added {
+			if builtin == name {
+				reason = "added in " + version.name
+			}
+		}
+		for _, builtin := range version.removed {
+			if builtin == name {
+				reason = "removed in " + version.name
+				if name == "difficulty" {
+					reason += ", use prevrandao"
+				}
+			}
+		}
+	}
+	for _, builtin := range neoBuiltins {
+		if builtin == name {
+			reason = "a Neo builtin of the " + DialectNeo + " dialect"
+		}
+	}
+	if knownNeoBuiltin(name) {
+		reason = "a Neo builtin of the " + DialectNeo + " dialect"
+	}
+	if reason == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s is not a builtin of the %s dialect (%s)", name, d.Name, reason)
+}
+
+// SetDialect makes the parser, and its lexer, recognize the builtins of d
+// and reject calls to those of other dialects. A nil dialect accepts every
+// builtin.
+func (p *YulParser) SetDialect(d *Dialect) {
+	p.dialect = d
+	p.lexer.dialect = d
+}
+
+// checkBuiltins reports the first call of ast to a builtin outside the
+// dialect of the parser, or the first malformed call to a Neo builtin or
+// verbatim, that no function of ast defines
+func (p *YulParser) checkBuiltins(ast *YulAST) error {
+	neo := p.dialect == nil || p.dialect.Name == DialectNeo
+	defined := make(map[string]bool)
+	forEachFunctionDef(ast, func(def *YulFunctionDef) {
+		defined[def.Name] = true
+	})
+	var err *ParseError
+	forEachBlock(ast, func(block *YulBlock) {
+		for _, stmt := range block.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(e YulExpression) {
+					call, ok := e.(*YulFunctionCall)
+					if !ok || err != nil || defined[call.FunctionName.Name] {
+						return
+					}
+					message, code := "", CodeUnavailableBuiltin
+					if p.dialect != nil {
+						message = p.dialect.unavailable(call.FunctionName.Name)
+					}
+					if reason, ok := unsupportedBuiltins[call.FunctionName.Name]; ok && message == "" {
+						message = fmt.Sprintf("%s is not supported on Neo (%s)", call.FunctionName.Name, reason)
+					}
+					if message == "" && neo && isNeoBuiltin(call.FunctionName.Name) {
+						if _, err := checkNeoCall(call); err != nil {
+							message, code = err.Error(), CodeInvalidBuiltinCall
+						}
+					} else if message == "" && isVerbatim(call.FunctionName.Name) {
+						if _, err := checkVerbatim(call); err != nil {
+							message, code = err.Error(), CodeInvalidBuiltinCall
+						}
+					}
+					if message != "" {
+						location := call.FunctionName.Location
+						if location.Line == 0 {
+							location = call.Location
+						}
+						err = &ParseError{
+							Position: location,
+							Got:      TokenIdentifier,
+							Lexeme:   call.FunctionName.Name,
+							Message:  message,
+							Snippet:  p.lexer.Snippet(location.Line, location.Column),
+							Code:     code,
+						}
+					}
+				})
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
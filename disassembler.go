@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Disassembler.
+//
+// Disassemble decodes a script back into instructions, with SYSCALLs naming
+// their interop service and every jump, CALL, TRY, ENDTRY and PUSHA
+// annotated with the instructions it targets, by index and script offset.
+// AttachDebugInfo gives the instructions the source locations of NEP-19
+// debug information. The disasm command prints the result:
+//
+//	neo-yulc disasm [-debug name.debug.json] name.nef
+//	neo-yulc disasm script.hex
+//
+// A .nef file is disassembled with the debug information next to it, when
+// there is some; any other file holds the script in hex.
+
+// Disassemble decodes a contract script into annotated instructions
+func Disassemble(script []byte) ([]NeoInstruction, error) {
+	instructions, err := DisassembleScript(script)
+	if err != nil {
+		return nil, err
+	}
+	offsets := make([]int, len(instructions))
+	indices := make(map[int]int) // Instruction index by offset
+	offset := 0
+	for i, instr := range instructions {
+		offsets[i], indices[offset] = offset, i
+		offset += instr.Size
+	}
+	target := func(offset int) string {
+		if index, ok := indices[offset]; ok {
+			return fmt.Sprintf("-> %d (offset %d)", index, offset)
+		}
+		return fmt.Sprintf("-> offset %d, not an instruction", offset)
+	}
+	for i := range instructions {
+		instr := &instructions[i]
+		switch {
+		case instr.Opcode == TRY || instr.Opcode == TRY_L:
+			width := len(instr.Operand) / 2
+			var parts []string
+			for j, name := range []string{"catch", "finally"} {
+				if relative := decodeJumpOffset(instr.Operand[j*width : (j+1)*width]); relative != 0 {
+					parts = append(parts, name+" "+target(offsets[i]+relative))
+				}
+			}
+			instr.Comment = strings.Join(parts, ", ")
+		case isJump(instr.Opcode) || instr.Opcode == PUSHA:
+			instr.Comment = target(offsets[i] + decodeJumpOffset(instr.Operand))
+		}
+	}
+	return instructions, nil
+}
+
+// decodeJumpOffset reads a little-endian signed offset of 1 or 4 bytes
+func decodeJumpOffset(operand []byte) int {
+	if len(operand) == 1 {
+		return int(int8(operand[0]))
+	}
+	return int(int32(binary.LittleEndian.Uint32(operand)))
+}
+
+// debugSequencePoint is a parsed sequence point
+type debugSequencePoint struct {
+	address int
+	ref     SourcePosition
+}
+
+// parseSequencePoint parses "address[document]line:column-line:column"
+func parseSequencePoint(point string, documents []string) (debugSequencePoint, error) {
+	var p debugSequencePoint
+	var document, endLine, endColumn int
+	_, err := fmt.Sscanf(point, "%d[%d]%d:%d-%d:%d", &p.address, &document, &p.ref.Line, &p.ref.Column, &endLine, &endColumn)
+	if err != nil {
+		return p, fmt.Errorf("sequence point %q: %w", point, err)
+	}
+	if document < 0 || document >= len(documents) {
+		return p, fmt.Errorf("sequence point %q: no document %d", point, document)
+	}
+	p.ref.File = documents[document]
+	if endLine == p.ref.Line && endColumn > p.ref.Column {
+		p.ref.Length = endColumn - p.ref.Column
+	}
+	return p, nil
+}
+
+// AttachDebugInfo sets the source reference of each instruction to the
+// last sequence point at or before it of the first method holding it
+func AttachDebugInfo(instructions []NeoInstruction, debug *NeoDebugInfo) error {
+	type method struct {
+		start, end int
+		points     []debugSequencePoint
+	}
+	var methods []method
+	for _, m := range debug.Methods {
+		var parsed method
+		if _, err := fmt.Sscanf(m.Range, "%d-%d", &parsed.start, &parsed.end); err != nil {
+			return fmt.Errorf("method %s: range %q: %w", m.ID, m.Range, err)
+		}
+		for _, point := range m.SequencePoints {
+			p, err := parseSequencePoint(point, debug.Documents)
+			if err != nil {
+				return fmt.Errorf("method %s: %w", m.ID, err)
+			}
+			parsed.points = append(parsed.points, p)
+		}
+		sort.SliceStable(parsed.points, func(i, j int) bool { return parsed.points[i].address < parsed.points[j].address })
+		methods = append(methods, parsed)
+	}
+
+	offset := 0
+	for i := range instructions {
+		for _, m := range methods {
+			if offset < m.start || offset > m.end {
+				continue
+			}
+			if n := sort.Search(len(m.points), func(j int) bool { return m.points[j].address > offset }); n > 0 {
+				ref := m.points[n-1].ref
+				instructions[i].SourceRef = &ref
+			}
+			break
+		}
+		offset += instructions[i].Size
+	}
+	return nil
+}
+
+// RunDisasmCommand runs "disasm" with the given arguments and returns the
+// process exit code
+func RunDisasmCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	debugPath := flags.String("debug", "", "NEP-19 debug information with the source lines, by default name.debug.json next to name.nef")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: disasm [flags] <file.nef|file.hex>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	path := flags.Arg(0)
+	script, tokens, status := readScriptFile(path, stderr)
+	if status != exitOK {
+		return status
+	}
+	if *debugPath == "" && filepath.Ext(path) == ArtifactNEF {
+		sibling := strings.TrimSuffix(path, ArtifactNEF) + ArtifactDebug
+		if _, err := os.Stat(sibling); err == nil {
+			*debugPath = sibling
+		}
+	}
+
+	instructions, err := Disassemble(script)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", path, err)
+		return exitFailed
+	}
+	for i, instr := range instructions {
+		if instr.Opcode != CALLT {
+			continue
+		}
+		if index := int(binary.LittleEndian.Uint16(instr.Operand)); index < len(tokens) {
+			token := tokens[index]
+			var hash Uint160
+			for j := range hash {
+				hash[j] = token.Hash[len(hash)-1-j]
+			}
+			instructions[i].Comment = fmt.Sprintf("%s.%s", hash, token.Method)
+		}
+	}
+	if *debugPath != "" {
+		data, err := os.ReadFile(*debugPath)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailed
+		}
+		var debug NeoDebugInfo
+		if err := json.Unmarshal(data, &debug); err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", *debugPath, err)
+			return exitFailed
+		}
+		if hash := ScriptHash(script).String(); debug.Hash != "" && !strings.EqualFold(debug.Hash, hash) {
+			fmt.Fprintf(stderr, "%s: debug information of script %s, not %s\n", *debugPath, debug.Hash, hash)
+			return exitFailed
+		}
+		if err := AttachDebugInfo(instructions, &debug); err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", *debugPath, err)
+			return exitFailed
+		}
+	}
+	fmt.Fprint(stdout, PrettyPrintInstructions(instructions))
+	return exitOK
+}
+
+// readScriptFile reads the script of a .nef file, with its method tokens,
+// or of a file holding it in hex, reporting failures to stderr
+func readScriptFile(path string, stderr io.Writer) ([]byte, []MethodToken, int) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil, nil, exitUsage
+	}
+	if filepath.Ext(path) == ArtifactNEF {
+		nef, err := DecodeNEF(data)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			return nil, nil, exitFailed
+		}
+		return nef.Script, nef.Tokens, exitOK
+	}
+	text := strings.Join(strings.Fields(string(data)), "")
+	script, err := hex.DecodeString(strings.TrimPrefix(text, "0x"))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: script is not hex: %v\n", path, err)
+		return nil, nil, exitFailed
+	}
+	return script, nil, exitOK
+}
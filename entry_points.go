@@ -0,0 +1,173 @@
+package main
+
+import "fmt"
+
+// Entry points.
+//
+// The contract script is invoked at offset 0 as the ExternalCallMethod,
+// with [selector, arguments] when it reads calldata and no arguments
+// otherwise, and is declared to return a byte string when it calls
+// return(p, s). The payment shim is the onNEP17Payment method.
+//
+// Functions listed in ExportFunctions become methods of their own, taking
+// their parameters as integers and returning their single return value, if
+// any. Each is entered through a stub that initializes the static fields
+// the way the top-level code does, with empty calldata and no call value,
+// and then calls the function. Exported functions that do not change state
+// are Safe methods. NEP-17 and NEP-11 tokens have stubs of the
+// same kind for their standard methods. Stubs precede the routines they call.
+//
+// The generator also records every contract method the script calls, so
+// the manifest can permit exactly those calls.
+
+// entryPoint describes the top-level code of the contract script
+type entryPoint struct {
+	calldata bool         // Invoked with [selector, arguments]
+	returns  bool         // Calls return
+	stubs    []stubMethod // Methods entered through stubs, in order
+}
+
+// stubMethod is a method whose code starts at a stub label
+type stubMethod struct {
+	label  string
+	method *ContractMethod
+}
+
+// callsFunction reports whether block, including its functions, calls name
+func callsFunction(block *YulBlock, name string) bool {
+	called := false
+	walkBlock(block, func(b *YulBlock) {
+		for _, stmt := range b.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(expr YulExpression) {
+					if call, ok := expr.(*YulFunctionCall); ok && call.FunctionName.Name == name {
+						called = true
+					}
+				})
+			}
+		}
+	})
+	return called
+}
+
+// exportLabel is the label of the stub entering an exported function
+func exportLabel(name string) string {
+	return "export_" + name
+}
+
+// emitExportStubs emits the entry stubs of the exported functions defined
+// in the top-level code
+func (g *CodeGenerator) emitExportStubs(fields int, location SourcePosition) error {
+	if g.context == nil {
+		return nil
+	}
+	c := memoryCode{g, location}
+	depth := g.stackTracker.currentDepth
+	defer func() { g.stackTracker.currentDepth = depth }()
+
+	for _, name := range g.context.ExportFunctions {
+		def, ok := g.signatures[name]
+		if !ok {
+			return fmt.Errorf("exported function %s is not defined", name)
+		}
+		if len(def.Returns) > 1 {
+			return fmt.Errorf("exported function %s returns %d values; methods return at most one", name, len(def.Returns))
+		}
+		method := &ContractMethod{Name: name, Safe: g.readOnly(name)}
+		for _, param := range def.Parameters {
+			method.Parameters = append(method.Parameters, MethodParameter{Name: param.Name, Type: "Integer"})
+		}
+		for _, ret := range def.Returns {
+			method.Returns = append(method.Returns, MethodParameter{Name: ret.Name, Type: "Integer"})
+		}
+		g.emitStubEntry(exportLabel(name), method, fields, location)
+		c.callFunction(def)
+		c.op(NewControlFlowInstruction(RET, 0))
+	}
+	return nil
+}
+
+// emitStubEntry starts the stub of method, with its arguments on the stack,
+// and initializes the static fields the way the top-level code does, with
+// empty calldata and no call value
+func (g *CodeGenerator) emitStubEntry(label string, method *ContractMethod, fields int, location SourcePosition) {
+	c := memoryCode{g, location}
+	g.emitReturnGuard(location)
+	g.entry.stubs = append(g.entry.stubs, stubMethod{label, method})
+
+	g.stackTracker.currentDepth = len(method.Parameters)
+	g.markLabel(label)
+	if fields > 0 {
+		c.op(NewInitStaticSlotInstruction(fields))
+	}
+	if g.memory.callValue >= 0 {
+		c.push(0)
+		c.op(NewSlotInstruction(STSFLD, g.memory.callValue))
+	}
+	if g.memory.slot >= 0 {
+		g.emitMemoryInit(location)
+	}
+	if g.memory.calldata >= 0 {
+		c.push(0)
+		c.arithmetic(NEWBUFFER)
+		c.op(NewSlotInstruction(STSFLD, g.memory.calldata))
+	}
+	if g.memory.returnData >= 0 {
+		g.emitReturnDataInit(location)
+	}
+	if g.memory.storage >= 0 {
+		g.emitStorageContextInit(method.Safe, location)
+	}
+	if g.memory.transient >= 0 {
+		g.emitTransientInit(location)
+	}
+}
+
+// callFunction calls a Yul function from the stub last started, with its
+// arguments on the stack
+func (c memoryCode) callFunction(def *YulFunctionDef) {
+	stub := c.g.entry.stubs[len(c.g.entry.stubs)-1]
+	halts := c.g.tryHalts(c.location)
+	call := NewControlFlowInstruction(CALL, 0)
+	call.StackPop, call.StackPush = len(def.Parameters), len(def.Returns)
+	c.op(call)
+	c.g.addPendingLabel("func_"+def.Name, len(c.g.instructions)-1)
+	c.g.catchHalts(halts, len(stub.method.Returns), c.location)
+}
+
+// describeMethods lists the methods of the contract script
+func (g *CodeGenerator) describeMethods(contract *NeoContract) {
+	if g.entry == nil {
+		return
+	}
+	main := &ContractMethod{Name: ExternalCallMethod, Offset: 0}
+	if g.entry.calldata {
+		main.Parameters = []MethodParameter{{Name: "selector", Type: "ByteArray"}, {Name: "arguments", Type: "Array"}}
+	}
+	if g.entry.returns {
+		main.Returns = []MethodParameter{{Name: "data", Type: "ByteArray"}}
+	}
+	contract.Methods = append(contract.Methods, main)
+
+	if offset, ok := g.labelMap.Get(PaymentMethod); ok {
+		contract.Methods = append(contract.Methods, &ContractMethod{
+			Name: PaymentMethod,
+			Parameters: []MethodParameter{
+				{Name: "from", Type: "Hash160"}, {Name: "amount", Type: "Integer"}, {Name: "data", Type: "Any"},
+			},
+			Offset:  g.byteOffset(offset),
+			Payable: true,
+		})
+	}
+
+	for _, stub := range g.entry.stubs {
+		offset, _ := g.labelMap.Get(stub.label)
+		stub.method.Offset = g.byteOffset(offset)
+		contract.Methods = append(contract.Methods, stub.method)
+	}
+}
+
+// permit records that the script calls method of contract, "*" for any
+func (g *CodeGenerator) permit(contract, method string) {
+	g.permissions = mergePermission(g.permissions, ContractPermission{Contract: contract, Methods: ManifestWildcard{Items: []string{method}}})
+}
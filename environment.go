@@ -0,0 +1,237 @@
+package main
+
+import "math/big"
+
+// Environment built-ins.
+//
+// gas() is the GAS left to the execution, System.Runtime.GasLeft, and
+// gaslimit() the system fee of the transaction, the most its execution may
+// spend. gasprice() is the execution fee factor of the Policy contract,
+// which scales every opcode price, and selfbalance() the GAS balance of the
+// executing contract. All amounts are in datoshi (10^-8 GAS).
+//
+// On chains where these have no meaning, StubGasBuiltins compiles them to
+// constants instead: gas() and gaslimit() give the largest 64-bit value,
+// gasprice() and selfbalance() 0.
+//
+// Transactions run while their block is persisted, after the previous block
+// became the Ledger's current block. number() is therefore the current index
+// plus one and blockhash(n) the hash of block n for the 256 blocks before
+// it, 0 for any other n as in the EVM. timestamp() is the block time,
+// System.Runtime.GetTime, in seconds rather than milliseconds; chainid() is
+// the network magic and coinbase() the NextConsensus account of the current
+// block, the validators producing the block. origin() is the sender of the
+// transaction, the account paying its fees. Hashes and accounts are read
+// as little-endian integers, like addresses, so their words print as the
+// hashes Neo displays.
+//
+// Neo keeps no code of accounts, only the NEF files of deployed contracts,
+// which ContractManagement.getContract returns. extcodesize(a) is the size
+// of the NEF file of contract a and extcodehash(a) its SHA-256, both 0 when
+// no contract is deployed at a, so the checks solc emits before external
+// calls pass for deployed contracts only. prevrandao() is the random number
+// of the transaction, System.Runtime.GetRandom.
+
+// stubGasBuiltinsFlag enables the constant gas built-ins
+const stubGasBuiltinsFlag = "--stub-gas-builtins"
+
+// Script hashes of the native contracts queried for the environment
+const (
+	GASTokenHash = "0xd2a4cff31913016155e38e474a2c06d08be276cf"
+	PolicyHash   = "0xcc5e4edd9f5f8dba8bb65734541df7a1c081c67b"
+	LedgerHash   = "0xda65b600f7124ce6c79950c1772a36403104f2be"
+)
+
+// callFlagsReadStates lets a native call read the chain state
+const callFlagsReadStates = 0x01
+
+// Fields of the transaction and block items
+const (
+	transactionSender    = 3
+	transactionSystemFee = 4
+	blockHash            = 0
+	blockNextConsensus   = 8
+)
+
+// contractStateNEF is the field of the contract state holding the NEF file
+const contractStateNEF = 3
+
+// blockHashRoutine is the routine behind blockhash
+const blockHashRoutine = "block_hash"
+
+// addressModulus is 2^160, one past the largest address word
+var addressModulus = new(big.Int).Lsh(big.NewInt(1), 160)
+
+// blockHashWindow is the number of recent blocks blockhash sees
+const blockHashWindow = 256
+
+// stubGasValues are the constants of the stubbed gas built-ins
+var stubGasValues = map[string]*big.Int{
+	"gas":         new(big.Int).SetUint64(^uint64(0)),
+	"gaslimit":    new(big.Int).SetUint64(^uint64(0)),
+	"gasprice":    big.NewInt(0),
+	"selfbalance": big.NewInt(0),
+}
+
+// StubGasBuiltinsRequested reports whether the gas built-ins compile to
+// constants, through StubGasBuiltins or the --stub-gas-builtins flag
+func StubGasBuiltinsRequested(config CompilerConfig) bool {
+	return config.StubGasBuiltins || flagSet(config.CompilerFlags, stubGasBuiltinsFlag)
+}
+
+// generateEnvironmentBuiltin emits an environment built-in with its
+// arguments on the stack and reports whether name is one
+func (g *CodeGenerator) generateEnvironmentBuiltin(name string, location SourcePosition) bool {
+	if value, ok := stubGasValues[name]; ok && g.context != nil && g.context.StubGasBuiltins {
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(value)), location)
+		return true
+	}
+
+	c := memoryCode{g, location}
+	switch name {
+	case "gas":
+		c.syscall("System.Runtime.GasLeft")
+	case "gaslimit":
+		c.syscall("System.Runtime.GetScriptContainer")
+		c.push(transactionSystemFee)
+		c.arithmetic(PICKITEM)
+	case "gasprice":
+		c.callNative(PolicyHash, "getExecFeeFactor", 0, callFlagsReadStates)
+	case "selfbalance":
+		c.syscall("System.Runtime.GetExecutingScriptHash")
+		c.callNative(GASTokenHash, "balanceOf", 1, callFlagsReadStates)
+	case "timestamp":
+		c.syscall("System.Runtime.GetTime")
+		c.push(1000)
+		c.arithmetic(DIV)
+	case "number":
+		c.callNative(LedgerHash, "currentIndex", 0, callFlagsReadStates)
+		c.push(1)
+		c.arithmetic(ADD)
+	case "blockhash":
+		g.emitMemoryCall(blockHashRoutine, 1, 1, location)
+	case "chainid":
+		c.syscall("System.Runtime.GetNetwork")
+	case "origin":
+		c.syscall("System.Runtime.GetScriptContainer")
+		c.push(transactionSender)
+		c.arithmetic(PICKITEM)
+		c.addressWord()
+	case "coinbase":
+		c.callNative(LedgerHash, "currentIndex", 0, callFlagsReadStates)
+		c.callNative(LedgerHash, "getBlock", 1, callFlagsReadStates)
+		c.push(blockNextConsensus)
+		c.arithmetic(PICKITEM)
+		c.addressWord()
+	case "extcodesize", "extcodehash":
+		g.emitContractCode(name, location)
+	case "prevrandao":
+		c.syscall("System.Runtime.GetRandom")
+	default:
+		return false
+	}
+	return true
+}
+
+// syscall emits a syscall
+func (c memoryCode) syscall(method string) {
+	c.op(NewSyscallInstruction(method))
+}
+
+// littleEndianWord reads the bytes on top of the stack, fewer than 32, as an
+// unsigned little-endian integer
+func (c memoryCode) littleEndianWord() {
+	c.op(NewPushInstruction(CreateNeoVMByteString([]byte{0})))
+	c.arithmetic(CAT)
+	c.op(NewConvertInstruction(IntegerType))
+}
+
+// paddedWord reads the bytes on top of the stack, at most 32, as an
+// unsigned little-endian word. They are zero-padded to 32 bytes, whose
+// integer is the word; an extra zero byte would make 33.
+func (c memoryCode) paddedWord() {
+	c.op(NewPushInstruction(CreateNeoVMByteString(make([]byte, 32))))
+	c.arithmetic(CAT)
+	c.push(32)
+	c.arithmetic(LEFT)
+	c.op(NewConvertInstruction(IntegerType))
+}
+
+// scriptHash converts the address word on top of the stack to the 20-byte
+// script hash it reads as
+func (c memoryCode) scriptHash() {
+	c.push(new(big.Int).Sub(addressModulus, big.NewInt(1)))
+	c.arithmetic(AND)
+	c.push(addressModulus)
+	c.arithmetic(ADD)
+	c.op(NewConvertInstruction(ByteStringType))
+	c.push(20)
+	c.arithmetic(LEFT)
+	c.op(NewConvertInstruction(ByteStringType))
+}
+
+// emitContractCode replaces the address word on top of the stack with the
+// size, for extcodesize, or the hash, for extcodehash, of the NEF file of
+// the contract at it, or 0 when there is none
+func (g *CodeGenerator) emitContractCode(name string, location SourcePosition) {
+	c := memoryCode{g, location}
+	none := g.createUniqueLabel(name + "_none")
+	done := g.createUniqueLabel(name + "_done")
+	c.addressScriptHash()
+	c.callNative(ContractManagementHash, "getContract", 1, callFlagsReadStates)
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(ISNULL)
+	c.jump(JMPIF, none)
+	c.push(contractStateNEF)
+	c.arithmetic(PICKITEM)
+	if name == "extcodesize" {
+		c.arithmetic(SIZE)
+	} else {
+		c.callNative(CryptoLibHash, "sha256", 1, 0)
+		c.paddedWord()
+	}
+	c.jump(JMP, done)
+	g.markLabel(none)
+	c.op(NewStackInstruction(DROP))
+	c.push(0)
+	g.markLabel(done)
+}
+
+// emitBlockHash returns the hash of block n, or 0 outside the window of
+// recent blocks. Argument: n; local: the current index.
+func (g *CodeGenerator) emitBlockHash(location SourcePosition) {
+	c := memoryCode{g, location}
+	missing := g.createUniqueLabel("block_hash_missing")
+	zero := g.createUniqueLabel("block_hash_zero")
+	done := g.createUniqueLabel("block_hash_done")
+
+	// current < n or n + 256 <= current, where number() = current + 1
+	c.callNative(LedgerHash, "currentIndex", 0, callFlagsReadStates)
+	c.op(NewSlotInstruction(STLOC, 0))
+	c.arg(0)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.arithmetic(GT)
+	c.jump(JMPIF, zero)
+	c.arg(0)
+	c.push(blockHashWindow)
+	c.arithmetic(ADD)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.arithmetic(LE)
+	c.jump(JMPIF, zero)
+
+	c.arg(0)
+	c.callNative(LedgerHash, "getBlock", 1, callFlagsReadStates)
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(ISNULL)
+	c.jump(JMPIF, missing)
+	c.push(blockHash)
+	c.arithmetic(PICKITEM)
+	c.paddedWord()
+	c.jump(JMP, done)
+
+	g.markLabel(missing)
+	c.op(NewStackInstruction(DROP))
+	g.markLabel(zero)
+	c.push(0)
+	g.markLabel(done)
+}
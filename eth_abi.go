@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Ethereum ABI conversion.
+//
+// Ethereum tooling describes a contract by its Ethereum ABI, Neo by the
+// ABI of its manifest. The compiler's values are u256 words, which the
+// manifest declares as Integer, and the types map onto each other as:
+//
+//	address          Hash160
+//	uintN, intN      Integer
+//	bool             Boolean
+//	string           String
+//	bytes32          Hash256
+//	bytes, bytesN    ByteArray
+//	T[], T[N], tuple Array
+//
+// PublicKey and Signature become bytes, as do the types without an
+// Ethereum counterpart. A parameter's internalType keeps its manifest type,
+// so a manifest ABI converted to Ethereum form and back is unchanged.
+// Neo methods return at most one value: a function with several outputs
+// returns them as an Array.
+//
+// The abi command converts a file either way: an Ethereum ABI, or a build
+// artifact holding one, becomes a manifest ABI, and a manifest or manifest
+// ABI becomes an Ethereum ABI.
+
+// ethereumTypes maps manifest types onto Ethereum ABI types
+var ethereumTypes = map[string]string{
+	"Boolean":   "bool",
+	"Integer":   "uint256",
+	"ByteArray": "bytes",
+	"String":    "string",
+	"Hash160":   "address",
+	"Hash256":   "bytes32",
+	"PublicKey": "bytes",
+	"Signature": "bytes",
+}
+
+// manifestTypes are the types of manifest parameters and return values
+var manifestTypes = map[string]bool{
+	"Any":              true,
+	"Boolean":          true,
+	"Integer":          true,
+	"ByteArray":        true,
+	"String":           true,
+	"Hash160":          true,
+	"Hash256":          true,
+	"PublicKey":        true,
+	"Signature":        true,
+	"Array":            true,
+	"Map":              true,
+	"InteropInterface": true,
+	"Void":             true, // Return type only
+}
+
+// EthereumType returns the Ethereum ABI type of a manifest type
+func EthereumType(manifestType string) string {
+	if kind, ok := ethereumTypes[manifestType]; ok {
+		return kind
+	}
+	return "bytes"
+}
+
+// ManifestType returns the manifest type of an Ethereum ABI type
+func ManifestType(ethereumType string) (string, error) {
+	kind := ethereumType
+	switch {
+	case strings.HasSuffix(kind, "]") && strings.Contains(kind, "["), kind == "tuple":
+		return "Array", nil
+	case kind == "address":
+		return "Hash160", nil
+	case kind == "bool":
+		return "Boolean", nil
+	case kind == "string":
+		return "String", nil
+	case kind == "bytes32":
+		return "Hash256", nil
+	case kind == "bytes", kind == "function":
+		return "ByteArray", nil
+	}
+	if size, ok := typeSize(kind, "bytes"); ok && size >= 1 && size <= 32 {
+		return "ByteArray", nil
+	}
+	for _, prefix := range []string{"uint", "int"} {
+		if bits, ok := typeSize(kind, prefix); ok && (bits == 0 || bits%8 == 0 && bits <= 256) {
+			return "Integer", nil
+		}
+	}
+	return "", fmt.Errorf("Ethereum ABI type %q has no manifest type", ethereumType)
+}
+
+// typeSize returns the size following prefix in kind, 0 for none
+func typeSize(kind, prefix string) (int, bool) {
+	if !strings.HasPrefix(kind, prefix) {
+		return 0, false
+	}
+	size := kind[len(prefix):]
+	if size == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(size)
+	if err != nil || n <= 0 || size[0] == '0' {
+		return 0, false
+	}
+	return n, true
+}
+
+// ethereumParameter returns a parameter of manifest type in Ethereum form
+func ethereumParameter(name, manifestType string) StandardJSONABIParam {
+	return StandardJSONABIParam{Name: name, Type: EthereumType(manifestType), InternalType: manifestType}
+}
+
+// parameterType returns the manifest type of an Ethereum parameter, the
+// one its internalType names if any
+func parameterType(param StandardJSONABIParam) (string, error) {
+	if manifestTypes[param.InternalType] && param.InternalType != "Void" {
+		return param.InternalType, nil
+	}
+	return ManifestType(param.Type)
+}
+
+// canonicalType returns the type of param as function signatures write it
+func canonicalType(param StandardJSONABIParam) string {
+	base, suffix := param.Type, ""
+	if i := strings.Index(base, "["); i >= 0 {
+		base, suffix = base[:i], base[i:]
+	}
+	switch base {
+	case "uint", "int":
+		base += "256"
+	case "tuple":
+		components := make([]string, len(param.Components))
+		for i, component := range param.Components {
+			components[i] = canonicalType(component)
+		}
+		base = "(" + strings.Join(components, ",") + ")"
+	}
+	return base + suffix
+}
+
+// ethereumSignature returns the signature of a function or event, whose
+// Keccak-256 hash selects it
+func ethereumSignature(name string, params []StandardJSONABIParam) string {
+	types := make([]string, len(params))
+	for i, param := range params {
+		types[i] = canonicalType(param)
+	}
+	return name + "(" + strings.Join(types, ",") + ")"
+}
+
+// ParseEthereumABI parses an Ethereum ABI, given as a list of entries or
+// as a build artifact holding it under "abi"
+func ParseEthereumABI(data []byte) ([]StandardJSONABIEntry, error) {
+	var entries []StandardJSONABIEntry
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		var artifact struct {
+			ABI []StandardJSONABIEntry `json:"abi"`
+		}
+		if err := json.Unmarshal(data, &artifact); err != nil {
+			return nil, fmt.Errorf("invalid Ethereum ABI: %w", err)
+		}
+		entries = artifact.ABI
+	} else if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid Ethereum ABI: %w", err)
+	}
+	if entries == nil {
+		return nil, errors.New("invalid Ethereum ABI: no entries")
+	}
+	return entries, nil
+}
+
+// ContractInterfaceOfEthereumABI converts the functions and events of an
+// Ethereum ABI. Constructors, fallbacks and errors have no manifest
+// counterpart and are left out; unnamed parameters are named argN.
+func ContractInterfaceOfEthereumABI(entries []StandardJSONABIEntry) ([]*ContractMethod, []*ContractEvent, error) {
+	methods, events := []*ContractMethod{}, []*ContractEvent{}
+	params := func(owner string, inputs []StandardJSONABIParam) ([]MethodParameter, error) {
+		list := []MethodParameter{}
+		for i, input := range inputs {
+			kind, err := parameterType(input)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", owner, err)
+			}
+			name := input.Name
+			if name == "" {
+				name = fmt.Sprintf("arg%d", i)
+			}
+			list = append(list, MethodParameter{Name: name, Type: kind, Indexed: input.Indexed != nil && *input.Indexed})
+		}
+		return list, nil
+	}
+	for _, entry := range entries {
+		switch entry.Type {
+		case "function", "":
+			method := &ContractMethod{
+				Name:    entry.Name,
+				Safe:    entry.StateMutability == "view" || entry.StateMutability == "pure",
+				Payable: entry.StateMutability == "payable",
+			}
+			copy(method.Selector[:], keccak256([]byte(ethereumSignature(entry.Name, entry.Inputs))))
+			var err error
+			if method.Parameters, err = params("function "+entry.Name, entry.Inputs); err != nil {
+				return nil, nil, err
+			}
+			if method.Returns, err = params("function "+entry.Name, entry.Outputs); err != nil {
+				return nil, nil, err
+			}
+			if len(method.Returns) > 1 {
+				method.Returns = []MethodParameter{{Name: "values", Type: "Array"}}
+			}
+			methods = append(methods, method)
+		case "event":
+			event := &ContractEvent{
+				Name:       entry.Name,
+				Signature:  ethereumSignature(entry.Name, entry.Inputs),
+				Parameters: []EventParameter{},
+				Anonymous:  entry.Anonymous != nil && *entry.Anonymous,
+			}
+			list, err := params("event "+entry.Name, entry.Inputs)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, param := range list {
+				event.Parameters = append(event.Parameters, EventParameter(param))
+			}
+			events = append(events, event)
+		case "constructor", "fallback", "receive", "error":
+		default:
+			return nil, nil, fmt.Errorf("unknown Ethereum ABI entry type %q", entry.Type)
+		}
+	}
+	return methods, events, nil
+}
+
+// EthereumABIOfContract converts methods and events to an Ethereum ABI
+func EthereumABIOfContract(methods []*ContractMethod, events []*ContractEvent) []StandardJSONABIEntry {
+	entries := []StandardJSONABIEntry{}
+	for _, method := range methods {
+		entry := StandardJSONABIEntry{Type: "function", Name: method.Name, Inputs: []StandardJSONABIParam{}, Outputs: []StandardJSONABIParam{}, StateMutability: "nonpayable"}
+		switch {
+		case method.Payable:
+			entry.StateMutability = "payable"
+		case method.Safe:
+			entry.StateMutability = "view"
+		}
+		for _, param := range method.Parameters {
+			entry.Inputs = append(entry.Inputs, ethereumParameter(param.Name, param.Type))
+		}
+		for _, ret := range method.Returns {
+			if ret.Type != "Void" {
+				entry.Outputs = append(entry.Outputs, ethereumParameter(ret.Name, ret.Type))
+			}
+		}
+		entries = append(entries, entry)
+	}
+	for _, event := range events {
+		anonymous := event.Anonymous
+		entry := StandardJSONABIEntry{Type: "event", Name: event.Name, Inputs: []StandardJSONABIParam{}, Anonymous: &anonymous}
+		for _, param := range event.Parameters {
+			indexed := param.Indexed
+			input := ethereumParameter(param.Name, param.Type)
+			input.Indexed = &indexed
+			entry.Inputs = append(entry.Inputs, input)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// contractInterfaceOf returns the methods and events of a manifest ABI
+func contractInterfaceOf(abi ManifestABI) ([]*ContractMethod, []*ContractEvent) {
+	var methods []*ContractMethod
+	var events []*ContractEvent
+	for _, entry := range abi.Methods {
+		method := &ContractMethod{Name: entry.Name, Offset: entry.Offset, Safe: entry.Safe}
+		for _, param := range entry.Parameters {
+			method.Parameters = append(method.Parameters, MethodParameter{Name: param.Name, Type: param.Type})
+		}
+		if entry.ReturnType != "" && entry.ReturnType != "Void" {
+			method.Returns = []MethodParameter{{Type: entry.ReturnType}}
+		}
+		methods = append(methods, method)
+	}
+	for _, entry := range abi.Events {
+		event := &ContractEvent{Name: entry.Name}
+		for _, param := range entry.Parameters {
+			event.Parameters = append(event.Parameters, EventParameter{Name: param.Name, Type: param.Type})
+		}
+		events = append(events, event)
+	}
+	return methods, events
+}
+
+// ConvertABI converts an Ethereum ABI to a manifest ABI, and a manifest or
+// manifest ABI to an Ethereum ABI
+func ConvertABI(data []byte) (interface{}, error) {
+	var document struct {
+		ABI     json.RawMessage `json:"abi"`
+		Methods []ABIMethod     `json:"methods"`
+		Events  []ABIEvent      `json:"events"`
+	}
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		if err := json.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("invalid ABI: %w", err)
+		}
+		abi := ManifestABI{Methods: document.Methods, Events: document.Events}
+		if document.ABI == nil || strings.HasPrefix(strings.TrimSpace(string(document.ABI)), "{") {
+			if document.ABI != nil {
+				if err := json.Unmarshal(document.ABI, &abi); err != nil {
+					return nil, fmt.Errorf("invalid manifest ABI: %w", err)
+				}
+			}
+			return EthereumABIOfContract(contractInterfaceOf(abi)), nil
+		}
+	}
+	entries, err := ParseEthereumABI(data)
+	if err != nil {
+		return nil, err
+	}
+	methods, events, err := ContractInterfaceOfEthereumABI(entries)
+	if err != nil {
+		return nil, err
+	}
+	abi, err := manifestABI(methods, events)
+	return abi, err
+}
+
+// RunABICommand runs "abi" with the given arguments and returns the process
+// exit code
+func RunABICommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("abi", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: abi file.json")
+		fmt.Fprintln(stderr, "Converts an Ethereum ABI to a manifest ABI, or a manifest to an Ethereum ABI.")
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailed
+	}
+	converted, err := ConvertABI(data)
+	if err != nil {
+		fmt.Fprintf(stderr, "abi: %v\n", err)
+		return exitFailed
+	}
+	data, _ = json.MarshalIndent(converted, "", "  ")
+	fmt.Fprintf(stdout, "%s\n", data)
+	return exitOK
+}
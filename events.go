@@ -0,0 +1,115 @@
+package main
+
+import "fmt"
+
+// Event lowering.
+//
+// logN(p, s, t1, ..., tN) becomes a Runtime.Notify whose state is the array
+// [t1, ..., tN, data], where data is the memory range [p, p+s) as a byte
+// string and topics stay integers. Solidity puts the hash of the event
+// signature in t1 of non-anonymous events; when t1 is a literal the event
+// is named after it, e.g. Event_ddf252ad, and the full hash is kept as its
+// signature. Other events are named LogN and recorded as anonymous. Every
+// event is recorded once in NeoContract.Events for the manifest. NEP-17
+// tokens emit the ERC-20 Transfer event as the NEP-17 notification instead,
+// and NEP-11 tokens their transfer events as the NEP-11 notification.
+
+// logTopics returns the number of topics of a log built-in, or -1 when name
+// is not one
+func logTopics(name string) int {
+	switch name {
+	case "log0", "log1", "log2", "log3", "log4":
+		return int(name[3] - '0')
+	}
+	return -1
+}
+
+// generateLog emits a log built-in with its arguments on the stack, first
+// on top
+func (g *CodeGenerator) generateLog(call *YulFunctionCall) error {
+	name := call.FunctionName.Name
+	topics := logTopics(name)
+	if len(call.Arguments) != topics+2 {
+		return fmt.Errorf("%s expects %d arguments, got %d at line %d", name, topics+2, len(call.Arguments), call.Location.Line)
+	}
+	if g.isNEP17Transfer(call) {
+		if _, err := g.addEvent(nep17TransferEvent(), call.Location); err != nil {
+			return err
+		}
+		g.generateNEP17Transfer(call.Location)
+		return nil
+	}
+	if g.isNEP11Transfer(call) {
+		if _, err := g.addEvent(nep11TransferEvent(g.standard()), call.Location); err != nil {
+			return err
+		}
+		g.generateNEP11Transfer(call.Location)
+		return nil
+	}
+	event, err := g.recordEvent(call, topics)
+	if err != nil {
+		return err
+	}
+	location := call.Location
+
+	g.emitMemoryCall(memorySlice, 2, 1, location)
+
+	// Move the data below the topics, keeping t1 on top, so PACK puts the
+	// topics first in order
+	if topics > 0 {
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(topics+1)), location)
+		g.emitInstruction(NewStackInstruction(REVERSEN), location)
+	}
+	if topics > 1 {
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(topics)), location)
+		g.emitInstruction(NewStackInstruction(REVERSEN), location)
+	}
+	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(topics+1)), location)
+	pack := NewArithmeticInstruction(PACK)
+	pack.StackPop, pack.StackPush = topics+2, 1
+	g.emitInstruction(pack, location)
+
+	g.emitInstruction(NewPushInstruction(CreateNeoVMByteString(event.Name)), location)
+	g.emitInstruction(NewSyscallInstruction("System.Runtime.Notify"), location)
+	return nil
+}
+
+// recordEvent adds the event emitted by call to the contract interface
+func (g *CodeGenerator) recordEvent(call *YulFunctionCall, topics int) (*ContractEvent, error) {
+	event := &ContractEvent{Name: fmt.Sprintf("Log%d", topics), Anonymous: true}
+	if topics > 0 {
+		if lit, ok := call.Arguments[2].(*YulLiteral); ok {
+			if value, err := ParseYulLiteralValue(lit); err == nil {
+				signature := fmt.Sprintf("%064x", toWord(value))
+				event.Name = "Event_" + signature[:8]
+				event.Signature = "0x" + signature
+				event.Anonymous = false
+			}
+		}
+	}
+	for i := 1; i <= topics; i++ {
+		event.Parameters = append(event.Parameters, EventParameter{Name: fmt.Sprintf("topic%d", i), Type: "Integer", Indexed: true})
+	}
+	event.Parameters = append(event.Parameters, EventParameter{Name: "data", Type: "ByteArray"})
+	return g.addEvent(event, call.Location)
+}
+
+// addEvent records event once, returning the recorded event of its name
+func (g *CodeGenerator) addEvent(event *ContractEvent, location SourcePosition) (*ContractEvent, error) {
+	for _, existing := range g.events {
+		if existing.Name != event.Name {
+			continue
+		}
+		if existing.Signature != event.Signature {
+			return nil, fmt.Errorf("events %s and %s share the name %s at line %d",
+				existing.Signature, event.Signature, event.Name, location.Line)
+		}
+		if len(existing.Parameters) != len(event.Parameters) {
+			return nil, fmt.Errorf("event %s emitted with %d and %d topics at line %d",
+				event.Name, len(existing.Parameters)-1, len(event.Parameters)-1, location.Line)
+		}
+		return existing, nil
+	}
+	g.events = append(g.events, event)
+	return event, nil
+}
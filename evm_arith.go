@@ -0,0 +1,848 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// EVM word semantics: every value is an unsigned 256-bit integer, arithmetic
+// wraps modulo 2^256 and signed operations use two's complement.
+
+var (
+	wordModulus = new(big.Int).Lsh(big.NewInt(1), 256)
+	wordMask    = new(big.Int).Sub(wordModulus, big.NewInt(1))
+	signBit     = new(big.Int).Lsh(big.NewInt(1), 255)
+
+	halfWordModulus = new(big.Int).Lsh(big.NewInt(1), 128)
+	halfWordMask    = new(big.Int).Sub(halfWordModulus, big.NewInt(1))
+)
+
+// toWord reduces x modulo 2^256 into the unsigned word range
+func toWord(x *big.Int) *big.Int {
+	return new(big.Int).And(x, wordMask)
+}
+
+// toSigned interprets a word as a two's complement signed integer
+func toSigned(x *big.Int) *big.Int {
+	if x.Cmp(signBit) >= 0 {
+		return new(big.Int).Sub(x, wordModulus)
+	}
+	return new(big.Int).Set(x)
+}
+
+func boolWord(b bool) *big.Int {
+	if b {
+		return big.NewInt(1)
+	}
+	return big.NewInt(0)
+}
+
+// pureBuiltinArity gives the argument count of each side-effect free built-in
+var pureBuiltinArity = map[string]int{
+	"add": 2, "sub": 2, "mul": 2, "div": 2, "sdiv": 2,
+	"mod": 2, "smod": 2, "exp": 2, "not": 1, "lt": 2,
+	"gt": 2, "slt": 2, "sgt": 2, "eq": 2, "iszero": 1,
+	"and": 2, "or": 2, "xor": 2, "byte": 2, "shl": 2,
+	"shr": 2, "sar": 2, "addmod": 3, "mulmod": 3, "signextend": 2,
+}
+
+// isPureBuiltin reports whether name is a built-in without side effects that
+// optimization passes may evaluate, move or duplicate freely
+func isPureBuiltin(name string) bool {
+	_, ok := pureBuiltinArity[name]
+	return ok
+}
+
+// EvaluatePureBuiltin computes a side-effect free EVM built-in on word
+// arguments. Arguments are given in source order.
+func EvaluatePureBuiltin(name string, args []*big.Int) (*big.Int, error) {
+	arity, ok := pureBuiltinArity[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a pure built-in", name)
+	}
+	if len(args) != arity {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", name, arity, len(args))
+	}
+
+	a := args[0]
+	var b *big.Int
+	if arity > 1 {
+		b = args[1]
+	}
+	zero := big.NewInt(0)
+
+	switch name {
+	case "add":
+		return toWord(new(big.Int).Add(a, b)), nil
+	case "sub":
+		return toWord(new(big.Int).Sub(a, b)), nil
+	case "mul":
+		return toWord(new(big.Int).Mul(a, b)), nil
+	case "div":
+		if b.Sign() == 0 {
+			return zero, nil
+		}
+		return new(big.Int).Quo(a, b), nil
+	case "sdiv":
+		if b.Sign() == 0 {
+			return zero, nil
+		}
+		return toWord(new(big.Int).Quo(toSigned(a), toSigned(b))), nil
+	case "mod":
+		if b.Sign() == 0 {
+			return zero, nil
+		}
+		return new(big.Int).Rem(a, b), nil
+	case "smod":
+		if b.Sign() == 0 {
+			return zero, nil
+		}
+		return toWord(new(big.Int).Rem(toSigned(a), toSigned(b))), nil
+	case "exp":
+		return new(big.Int).Exp(a, b, wordModulus), nil
+	case "not":
+		return new(big.Int).Xor(a, wordMask), nil
+	case "lt":
+		return boolWord(a.Cmp(b) < 0), nil
+	case "gt":
+		return boolWord(a.Cmp(b) > 0), nil
+	case "slt":
+		return boolWord(toSigned(a).Cmp(toSigned(b)) < 0), nil
+	case "sgt":
+		return boolWord(toSigned(a).Cmp(toSigned(b)) > 0), nil
+	case "eq":
+		return boolWord(a.Cmp(b) == 0), nil
+	case "iszero":
+		return boolWord(a.Sign() == 0), nil
+	case "and":
+		return new(big.Int).And(a, b), nil
+	case "or":
+		return new(big.Int).Or(a, b), nil
+	case "xor":
+		return new(big.Int).Xor(a, b), nil
+	case "byte":
+		// byte(n, x) is the nth byte of x, counting from the most significant
+		if a.Cmp(big.NewInt(32)) >= 0 {
+			return zero, nil
+		}
+		shift := uint(8 * (31 - a.Int64()))
+		return new(big.Int).And(new(big.Int).Rsh(b, shift), big.NewInt(0xff)), nil
+	case "shl":
+		// shl(shift, value)
+		if a.Cmp(big.NewInt(256)) >= 0 {
+			return zero, nil
+		}
+		return toWord(new(big.Int).Lsh(b, uint(a.Int64()))), nil
+	case "shr":
+		if a.Cmp(big.NewInt(256)) >= 0 {
+			return zero, nil
+		}
+		return new(big.Int).Rsh(b, uint(a.Int64())), nil
+	case "sar":
+		shift := uint(255)
+		if a.Cmp(big.NewInt(255)) < 0 {
+			shift = uint(a.Int64())
+		}
+		return toWord(new(big.Int).Rsh(toSigned(b), shift)), nil
+	case "addmod":
+		if args[2].Sign() == 0 {
+			return zero, nil
+		}
+		return new(big.Int).Mod(new(big.Int).Add(a, b), args[2]), nil
+	case "mulmod":
+		if args[2].Sign() == 0 {
+			return zero, nil
+		}
+		return new(big.Int).Mod(new(big.Int).Mul(a, b), args[2]), nil
+	case "signextend":
+		// signextend(i, x) extends the sign bit of byte i (from the least significant)
+		if a.Cmp(big.NewInt(31)) >= 0 {
+			return new(big.Int).Set(b), nil
+		}
+		bit := uint(8*a.Int64() + 7)
+		mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bit+1), big.NewInt(1))
+		if b.Bit(int(bit)) == 1 {
+			return new(big.Int).Or(b, new(big.Int).Xor(mask, wordMask)), nil
+		}
+		return new(big.Int).And(b, mask), nil
+	}
+
+	return nil, fmt.Errorf("%s is not a pure built-in", name)
+}
+
+// ParseYulLiteralValue converts a literal to its EVM word value. String
+// literals are left-aligned in the word as in solc.
+func ParseYulLiteralValue(lit *YulLiteral) (*big.Int, error) {
+	switch lit.Kind {
+	case LiteralKindNumber:
+		value, ok := new(big.Int).SetString(lit.Value, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid number literal %q", lit.Value)
+		}
+		return toWord(value), nil
+	case LiteralKindHex:
+		value, ok := new(big.Int).SetString(lit.Value[2:], 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid hex literal %q", lit.Value)
+		}
+		return toWord(value), nil
+	case LiteralKindBool:
+		return boolWord(lit.Value == "true"), nil
+	case LiteralKindString:
+		if len(lit.Value) > 32 {
+			return nil, fmt.Errorf("string literal %q longer than 32 bytes", lit.Value)
+		}
+		padded := make([]byte, 32)
+		copy(padded, lit.Value)
+		return new(big.Int).SetBytes(padded), nil
+	}
+	return nil, fmt.Errorf("unsupported literal kind: %s", lit.Kind)
+}
+
+// NewWordLiteral builds a number literal holding value
+func NewWordLiteral(value *big.Int, location SourcePosition) *YulLiteral {
+	return &YulLiteral{
+		Kind:     LiteralKindNumber,
+		Value:    value.String(),
+		Type:     DataTypeUint256,
+		Location: location,
+	}
+}
+
+// Word arithmetic in generated code.
+//
+// NeoVM integers hold at most 32 bytes, so a word is kept on the stack as
+// the signed integer with the same 256 bits: words from 2^255 up are
+// negative. The bitwise built-ins, eq, iszero, the signed comparisons and
+// sar work on that form as they are; the unsigned ones correct for the
+// sign, and arithmetic wraps without ever leaving the range. Arguments are
+// pushed last to first, so the first argument is on top when the operation
+// runs; operations whose NeoVM operand order differs from Yul swap first.
+
+var (
+	minWordInteger = new(big.Int).Neg(signBit)
+	maxWordInteger = new(big.Int).Sub(signBit, big.NewInt(1))
+)
+
+// Routines of the arithmetic too long to emit inline
+const (
+	wordDivMod     = "word_divmod"
+	wordModularSum = "word_modular_sum"
+	wordAddMod     = "word_addmod"
+	wordMulMod     = "word_mulmod"
+)
+
+// maxShift is the largest shift NeoVM accepts; Yul shifts by 256 or more
+// give the same result as shifting by 256
+const maxShift = 256
+
+// wordInteger returns the integer a word is held as on the stack
+func wordInteger(x *big.Int) *big.Int {
+	return toSigned(toWord(x))
+}
+
+// generateWordBuiltin emits a built-in with EVM word semantics and reports
+// whether name is one
+func (g *CodeGenerator) generateWordBuiltin(name string, location SourcePosition) bool {
+	c := memoryCode{g, location}
+	switch name {
+	case "add":
+		g.emitWordAddition(ADD, location)
+	case "mul":
+		g.emitWordMultiplication(location)
+	case "sub":
+		c.stack(SWAP)
+		g.emitWordAddition(SUB, location)
+	case "div":
+		g.emitMemoryCall(wordDivMod, 2, 2, location)
+		c.stack(DROP)
+	case "mod":
+		g.emitMemoryCall(wordDivMod, 2, 2, location)
+		c.stack(NIP)
+	case "sdiv":
+		c.stack(SWAP)
+		g.emitSignedDivision(location)
+	case "smod":
+		c.stack(SWAP)
+		g.emitGuardedDivision(MOD, location)
+	case "not":
+		c.arithmetic(INVERT)
+	case "lt":
+		// b > a with a on top
+		g.emitUnsignedOperands(location)
+		c.arithmetic(GT)
+	case "gt":
+		g.emitUnsignedOperands(location)
+		c.arithmetic(LT)
+	case "slt":
+		c.arithmetic(GT)
+	case "sgt":
+		c.arithmetic(LT)
+	case "shl":
+		g.emitShiftLeft(location)
+	case "shr":
+		// The value is shifted by one as a word first, which clears the
+		// sign; the remaining shift is then arithmetic as well as logical
+		unshifted := g.createUniqueLabel("shr_unshifted")
+		end := g.createUniqueLabel("shr_end")
+		g.emitUnsignedClamp(maxShift, location)
+		c.stack(DUP)
+		c.jump(JMPIFNOT, unshifted)
+		depth := g.stackTracker.currentDepth
+		c.stack(SWAP)
+		c.push(1)
+		c.arithmetic(SHR)
+		c.push(maxWordInteger)
+		c.arithmetic(AND)
+		c.stack(SWAP)
+		c.arithmetic(DEC, SHR)
+		c.jump(JMP, end)
+		g.stackTracker.currentDepth = depth
+		g.markLabel(unshifted)
+		c.stack(DROP)
+		g.markLabel(end)
+	case "sar":
+		// SHR on a negative integer rounds towards negative infinity, which
+		// is an arithmetic shift
+		g.emitUnsignedClamp(maxShift, location)
+		c.arithmetic(SHR)
+	case "signextend":
+		g.emitSignExtend(location)
+	case "addmod":
+		g.emitMemoryCall(wordAddMod, 3, 1, location)
+	case "mulmod":
+		g.emitMemoryCall(wordMulMod, 3, 1, location)
+	case "exp":
+		g.emitExp(location)
+	case "byte":
+		g.emitByte(location)
+	default:
+		return false
+	}
+	return true
+}
+
+// emitWordAddition computes x op y modulo 2^256 for op ADD or SUB, with y
+// on top. A sum of operands with different signs, or a difference of
+// operands with the same sign, is in range as it is; otherwise x has its
+// sign bit flipped first, which keeps the result in range, and the result
+// has it flipped back.
+func (g *CodeGenerator) emitWordAddition(op NeoOpcode, location SourcePosition) {
+	c := memoryCode{g, location}
+	exact := g.createUniqueLabel("word_exact")
+	end := g.createUniqueLabel("word_end")
+
+	c.stack(OVER, OVER)
+	c.arithmetic(XOR)
+	c.push(0)
+	c.arithmetic(LT)
+	if op == ADD {
+		c.jump(JMPIF, exact)
+	} else {
+		c.jump(JMPIFNOT, exact)
+	}
+	depth := g.stackTracker.currentDepth
+
+	c.stack(SWAP)
+	c.push(minWordInteger)
+	c.arithmetic(XOR)
+	c.stack(SWAP)
+	c.arithmetic(op)
+	c.push(minWordInteger)
+	c.arithmetic(XOR)
+	c.jump(JMP, end)
+
+	g.stackTracker.currentDepth = depth
+	g.markLabel(exact)
+	c.arithmetic(op)
+	g.markLabel(end)
+}
+
+// emitWordMultiplication multiplies the two words on top of the stack
+// modulo 2^256. Their full product can take 64 bytes, more than a NeoVM
+// integer holds, so it is built as 2((a >> 1) b) + (a & 1) b: MODMUL
+// reduces (a >> 1) b modulo 2^255, which is all its double keeps.
+func (g *CodeGenerator) emitWordMultiplication(location SourcePosition) {
+	c := memoryCode{g, location}
+
+	// b a -> b a 2((a >> 1) b)
+	c.stack(OVER, OVER)
+	c.push(1)
+	c.arithmetic(SHR)
+	c.push(minWordInteger)
+	c.arithmetic(MODMUL)
+	g.emitSignExtendBit(254, location)
+	c.push(1)
+	c.arithmetic(SHL)
+
+	// -> 2((a >> 1) b) (a & 1) b -> a b
+	c.stack(SWAP)
+	c.push(1)
+	c.arithmetic(AND)
+	c.stack(ROT)
+	c.arithmetic(MUL)
+	g.emitWordAddition(ADD, location)
+}
+
+// emitSignExtendBit sign-extends the integer on top of the stack from a
+// constant bit, the same as signextend does from its computed one
+func (g *CodeGenerator) emitSignExtendBit(bit int, location SourcePosition) {
+	c := memoryCode{g, location}
+	c.stack(DUP)
+	c.push(new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bit)), big.NewInt(1)))
+	c.arithmetic(AND)
+	c.stack(SWAP)
+	c.push(bit)
+	c.arithmetic(SHR)
+	c.push(1)
+	c.arithmetic(AND, NEGATE)
+	c.push(bit)
+	c.arithmetic(SHL, OR)
+}
+
+// emitUnsignedOperands flips the sign bit of the two words on top of the
+// stack, so that the signed comparisons order them as unsigned words
+func (g *CodeGenerator) emitUnsignedOperands(location SourcePosition) {
+	c := memoryCode{g, location}
+	c.push(minWordInteger)
+	c.arithmetic(XOR)
+	c.stack(SWAP)
+	c.push(minWordInteger)
+	c.arithmetic(XOR)
+	c.stack(SWAP)
+}
+
+// emitUnsignedClamp limits the word on top of the stack, read unsigned, to
+// limit: words with the sign bit set are the largest
+func (g *CodeGenerator) emitUnsignedClamp(limit int, location SourcePosition) {
+	c := memoryCode{g, location}
+	c.stack(DUP)
+	c.push(255)
+	c.arithmetic(SHR)
+	c.push(limit)
+	c.arithmetic(AND)
+	c.stack(SWAP)
+	c.push(limit)
+	c.arithmetic(MIN, MAX)
+}
+
+// emitGuardedDivision divides the dividend below the top by the divisor on
+// top. Division by zero gives 0 in the EVM instead of faulting.
+func (g *CodeGenerator) emitGuardedDivision(op NeoOpcode, location SourcePosition) {
+	zeroLabel := g.createUniqueLabel("div_zero")
+	endLabel := g.createUniqueLabel("div_end")
+
+	g.emitInstruction(NewStackInstruction(DUP), location)
+	g.emitInstruction(NewControlFlowInstruction(JMPIFNOT, 0), location)
+	g.addPendingLabel(zeroLabel, len(g.instructions)-1)
+	depth := g.stackTracker.currentDepth
+
+	g.emitInstruction(NewArithmeticInstruction(op), location)
+	g.emitInstruction(NewControlFlowInstruction(JMP, 0), location)
+	g.addPendingLabel(endLabel, len(g.instructions)-1)
+
+	g.stackTracker.currentDepth = depth
+	g.markLabel(zeroLabel)
+	g.emitInstruction(NewStackInstruction(DROP), location)
+	g.emitInstruction(NewStackInstruction(DROP), location)
+	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(0)), location)
+	g.markLabel(endLabel)
+}
+
+// emitSignedDivision divides the dividend below the top by the divisor on
+// top as sdiv does. Division by -1 negates modulo 2^256, since -2^255 / -1
+// is not a word.
+func (g *CodeGenerator) emitSignedDivision(location SourcePosition) {
+	c := memoryCode{g, location}
+	divide := g.createUniqueLabel("sdiv_divide")
+	end := g.createUniqueLabel("sdiv_end")
+
+	c.stack(DUP)
+	c.op(NewPushInstruction(CreateNeoVMInteger(-1)))
+	c.arithmetic(NUMEQUAL)
+	c.jump(JMPIFNOT, divide)
+	depth := g.stackTracker.currentDepth
+	c.stack(DROP)
+	c.push(0)
+	c.stack(SWAP)
+	g.emitWordAddition(SUB, location)
+	c.jump(JMP, end)
+
+	g.stackTracker.currentDepth = depth
+	g.markLabel(divide)
+	g.emitGuardedDivision(DIV, location)
+	g.markLabel(end)
+}
+
+// emitWordDivMod returns the unsigned quotient and remainder of two words,
+// the remainder on top. Arguments: the dividend and the divisor; local:
+// the divisor less the halved remainder.
+//
+// A divisor from 2^255 up goes into the dividend at most once. Otherwise a
+// dividend from 2^255 up is halved first: n = 2h + b gives the quotient
+// 2(h / d) and the remainder 2(h % d) + b, less d once when that reaches d.
+func (g *CodeGenerator) emitWordDivMod(location SourcePosition) {
+	c := memoryCode{g, location}
+	zero := g.createUniqueLabel("word_divmod_zero")
+	largeDivisor := g.createUniqueLabel("word_divmod_large_divisor")
+	largeDividend := g.createUniqueLabel("word_divmod_large_dividend")
+	below := g.createUniqueLabel("word_divmod_below")
+	reduce := g.createUniqueLabel("word_divmod_reduce")
+	ret := func() {
+		c.op(NewControlFlowInstruction(RET, 0))
+		g.stackTracker.currentDepth = 0
+	}
+
+	c.arg(1)
+	c.jump(JMPIFNOT, zero)
+	c.arg(1)
+	c.push(0)
+	c.arithmetic(LT)
+	c.jump(JMPIF, largeDivisor)
+	c.arg(0)
+	c.push(0)
+	c.arithmetic(LT)
+	c.jump(JMPIF, largeDividend)
+	c.arg(0)
+	c.arg(1)
+	c.arithmetic(DIV)
+	c.arg(0)
+	c.arg(1)
+	c.arithmetic(MOD)
+	ret()
+
+	g.markLabel(largeDivisor)
+	c.arg(0)
+	c.arg(1)
+	g.emitUnsignedOperands(location)
+	c.arithmetic(LT)
+	c.jump(JMPIF, below)
+	c.push(1)
+	c.arg(0)
+	c.arg(1)
+	c.arithmetic(SUB)
+	ret()
+	g.markLabel(below)
+	c.push(0)
+	c.arg(0)
+	ret()
+
+	// h = n >> 1 as a word, q = 2(h / d), r = h % d
+	g.markLabel(largeDividend)
+	c.arg(0)
+	c.push(1)
+	c.arithmetic(SHR)
+	c.push(maxWordInteger)
+	c.arithmetic(AND)
+	c.stack(DUP)
+	c.arg(1)
+	c.arithmetic(DIV)
+	g.emitSignExtendBit(254, location)
+	c.push(1)
+	c.arithmetic(SHL)
+	c.stack(SWAP)
+	c.arg(1)
+	c.arithmetic(MOD)
+	c.arg(1)
+	c.stack(OVER)
+	c.arithmetic(SUB)
+	c.op(NewSlotInstruction(STLOC, 0))
+
+	// 2r + b reaches d when r + b reaches d - r
+	c.stack(DUP)
+	c.arg(0)
+	c.push(1)
+	c.arithmetic(AND, ADD)
+	c.stack(DUP)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.arithmetic(GE)
+	c.jump(JMPIF, reduce)
+	c.arithmetic(ADD)
+	ret()
+	g.markLabel(reduce)
+	c.stack(NIP)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.arithmetic(SUB)
+	c.stack(SWAP)
+	c.arithmetic(INC)
+	c.stack(SWAP)
+	ret()
+
+	g.markLabel(zero)
+	c.push(0)
+	c.push(0)
+}
+
+// emitWordModularSum returns (x + y) mod m for words x and y below m.
+// Arguments: x, y and m.
+func (g *CodeGenerator) emitWordModularSum(location SourcePosition) {
+	c := memoryCode{g, location}
+	reduce := g.createUniqueLabel("word_modular_sum_reduce")
+	done := g.createUniqueLabel("word_modular_sum_done")
+
+	// The sum wrapped when it is below x; it is reduced then or when it
+	// reaches m
+	c.arg(0)
+	c.arg(1)
+	g.emitWordAddition(ADD, location)
+	c.stack(DUP)
+	c.arg(0)
+	g.emitUnsignedOperands(location)
+	c.arithmetic(LT)
+	c.jump(JMPIF, reduce)
+	c.stack(DUP)
+	c.arg(2)
+	g.emitUnsignedOperands(location)
+	c.arithmetic(LT)
+	c.jump(JMPIF, done)
+	g.markLabel(reduce)
+	c.arg(2)
+	g.emitWordAddition(SUB, location)
+	g.markLabel(done)
+}
+
+// reduceArg replaces argument index of a routine with its unsigned
+// remainder by argument modulus
+func (c memoryCode) reduceArg(index, modulus int) {
+	c.arg(modulus)
+	c.arg(index)
+	c.call(wordDivMod, 2, 2)
+	c.stack(NIP)
+	c.op(NewSlotInstruction(STARG, index))
+}
+
+// emitWordAddMod returns addmod(a, b, m). Arguments: a, b and m.
+func (g *CodeGenerator) emitWordAddMod(location SourcePosition) {
+	c := memoryCode{g, location}
+	zero := g.createUniqueLabel("word_addmod_zero")
+	done := g.createUniqueLabel("word_addmod_done")
+
+	c.arg(2)
+	c.jump(JMPIFNOT, zero)
+	c.reduceArg(0, 2)
+	c.reduceArg(1, 2)
+	c.arg(2)
+	c.arg(1)
+	c.arg(0)
+	c.call(wordModularSum, 3, 1)
+	c.jump(JMP, done)
+	g.markLabel(zero)
+	g.stackTracker.currentDepth--
+	c.push(0)
+	g.markLabel(done)
+}
+
+// emitWordMulMod returns mulmod(a, b, m). Arguments: a, b and m; locals:
+// the product so far and the bit of b. Below 2^255 the reduced operands are
+// positive and MODMUL computes the product; a larger m is handled by
+// doubling and adding over the bits of b, which never leaves the word.
+func (g *CodeGenerator) emitWordMulMod(location SourcePosition) {
+	c := memoryCode{g, location}
+	zero := g.createUniqueLabel("word_mulmod_zero")
+	large := g.createUniqueLabel("word_mulmod_large")
+	loop := g.createUniqueLabel("word_mulmod_loop")
+	next := g.createUniqueLabel("word_mulmod_next")
+	done := g.createUniqueLabel("word_mulmod_done")
+	sum := func() {
+		c.call(wordModularSum, 3, 1)
+		c.op(NewSlotInstruction(STLOC, 0))
+	}
+
+	c.arg(2)
+	c.jump(JMPIFNOT, zero)
+	c.reduceArg(0, 2)
+	c.reduceArg(1, 2)
+	c.arg(2)
+	c.push(0)
+	c.arithmetic(LT)
+	c.jump(JMPIF, large)
+	c.arg(0)
+	c.arg(1)
+	c.arg(2)
+	c.arithmetic(MODMUL)
+	c.jump(JMP, done)
+
+	g.markLabel(large)
+	g.stackTracker.currentDepth--
+	c.push(0)
+	c.op(NewSlotInstruction(STLOC, 0))
+	c.push(255)
+	c.op(NewSlotInstruction(STLOC, 1))
+	g.markLabel(loop)
+	c.arg(2)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.op(NewSlotInstruction(LDLOC, 0))
+	sum()
+	c.arg(1)
+	c.op(NewSlotInstruction(LDLOC, 1))
+	c.arithmetic(SHR)
+	c.push(1)
+	c.arithmetic(AND)
+	c.jump(JMPIFNOT, next)
+	c.arg(2)
+	c.arg(0)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	sum()
+	g.markLabel(next)
+	c.op(NewSlotInstruction(LDLOC, 1))
+	c.arithmetic(DEC)
+	c.stack(DUP)
+	c.op(NewSlotInstruction(STLOC, 1))
+	c.push(0)
+	c.arithmetic(GE)
+	c.jump(JMPIF, loop)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.jump(JMP, done)
+
+	g.markLabel(zero)
+	g.stackTracker.currentDepth--
+	c.push(0)
+	g.markLabel(done)
+}
+
+// emitShiftLeft computes shl(s, v) with s on top. The bits shifted out of
+// the word are dropped first by sign-extending v from bit 255 - s, so the
+// shift stays in range; shifts from 256 up give 0.
+func (g *CodeGenerator) emitShiftLeft(location SourcePosition) {
+	c := memoryCode{g, location}
+	zero := g.createUniqueLabel("shl_zero")
+	end := g.createUniqueLabel("shl_end")
+
+	c.stack(DUP)
+	c.push(0)
+	c.push(maxShift)
+	c.arithmetic(WITHIN)
+	c.jump(JMPIFNOT, zero)
+	depth := g.stackTracker.currentDepth
+
+	// v, s -> s, v, 255 - s -> s, x -> x << s
+	c.push(255)
+	c.stack(OVER)
+	c.arithmetic(SUB)
+	c.stack(ROT, SWAP)
+	g.emitSignExtendFrom(location)
+	c.stack(SWAP)
+	c.arithmetic(SHL)
+	c.jump(JMP, end)
+
+	g.stackTracker.currentDepth = depth
+	g.markLabel(zero)
+	c.stack(DROP, DROP)
+	c.push(0)
+	g.markLabel(end)
+}
+
+// emitSignExtendFrom sign-extends x from bit b, with b on top:
+// x & (2^b - 1) | -((x >> b) & 1) << b
+func (g *CodeGenerator) emitSignExtendFrom(location SourcePosition) {
+	c := memoryCode{g, location}
+	c.stack(OVER, OVER)
+	c.arithmetic(SHR)
+	c.push(1)
+	c.arithmetic(AND, NEGATE)
+	c.stack(OVER)
+	c.arithmetic(SHL)
+	c.stack(ROT, ROT)
+	c.op(NewPushInstruction(CreateNeoVMInteger(-1)))
+	c.stack(SWAP)
+	c.arithmetic(SHL, INVERT, AND, OR)
+}
+
+// emitSignExtend computes signextend(i, x) with i on top by extending the
+// sign of bit 8i + 7, with i limited to 31 so that larger i leave x
+// unchanged
+func (g *CodeGenerator) emitSignExtend(location SourcePosition) {
+	c := memoryCode{g, location}
+	g.emitUnsignedClamp(31, location)
+	c.push(8)
+	c.arithmetic(MUL)
+	c.push(7)
+	c.arithmetic(ADD)
+	g.emitSignExtendFrom(location)
+}
+
+// emitExp computes exp(base, e) with base on top by square-and-multiply,
+// keeping e, base and the result on the stack
+func (g *CodeGenerator) emitExp(location SourcePosition) {
+	c := memoryCode{g, location}
+	loopLabel := g.createUniqueLabel("exp_loop")
+	squareLabel := g.createUniqueLabel("exp_square")
+	endLabel := g.createUniqueLabel("exp_end")
+
+	// e, base -> e, base, result
+	c.push(1)
+
+	// Loop until the exponent is zero
+	g.markLabel(loopLabel)
+	depth := g.stackTracker.currentDepth
+	c.push(2)
+	c.stack(PICK)
+	c.jump(JMPIFNOT, endLabel)
+
+	// Odd exponent: result *= base
+	c.push(2)
+	c.stack(PICK)
+	c.push(1)
+	c.arithmetic(AND)
+	c.jump(JMPIFNOT, squareLabel)
+	c.stack(OVER)
+	g.emitWordMultiplication(location)
+
+	// base *= base, e >>= 1 as a word
+	g.markLabel(squareLabel)
+	c.stack(SWAP, DUP)
+	g.emitWordMultiplication(location)
+	c.stack(SWAP, ROT)
+	c.push(1)
+	c.arithmetic(SHR)
+	c.push(maxWordInteger)
+	c.arithmetic(AND)
+	c.stack(ROT, ROT)
+	c.jump(JMP, loopLabel)
+
+	// 0, base, result -> result
+	g.stackTracker.currentDepth = depth
+	g.markLabel(endLabel)
+	c.stack(NIP, NIP)
+}
+
+// emitByte computes byte(n, x) with n on top: byte n of x counting from the
+// most significant, or 0 when n is 32 or more
+func (g *CodeGenerator) emitByte(location SourcePosition) {
+	push := func(value int) {
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(value)), location)
+	}
+	arithmetic := func(op NeoOpcode) {
+		g.emitInstruction(NewArithmeticInstruction(op), location)
+	}
+
+	outOfRange := g.createUniqueLabel("byte_out_of_range")
+	endLabel := g.createUniqueLabel("byte_end")
+
+	g.emitInstruction(NewStackInstruction(DUP), location)
+	push(0)
+	push(32)
+	arithmetic(WITHIN)
+	g.emitInstruction(NewControlFlowInstruction(JMPIFNOT, 0), location)
+	g.addPendingLabel(outOfRange, len(g.instructions)-1)
+	depth := g.stackTracker.currentDepth
+
+	// x >> 8(31 - n) & 0xff
+	push(31)
+	g.emitInstruction(NewStackInstruction(SWAP), location)
+	arithmetic(SUB)
+	push(8)
+	arithmetic(MUL)
+	arithmetic(SHR)
+	push(0xff)
+	arithmetic(AND)
+	g.emitInstruction(NewControlFlowInstruction(JMP, 0), location)
+	g.addPendingLabel(endLabel, len(g.instructions)-1)
+
+	g.stackTracker.currentDepth = depth
+	g.markLabel(outOfRange)
+	g.emitInstruction(NewStackInstruction(DROP), location)
+	g.emitInstruction(NewStackInstruction(DROP), location)
+	push(0)
+	g.markLabel(endLabel)
+}
@@ -0,0 +1,197 @@
+package main
+
+// Exceptions.
+//
+// revert(p, s) throws the pair [reason, data], where data is the memory
+// range [p, p+s) and reason a readable message: the string of an
+// Error(string) payload, Panic(0x..) with the code of a Panic(uint256)
+// payload, or "execution reverted". invalid() throws the pair
+// ["invalid instruction", ""]. NeoVM reports the first item of a thrown
+// array as the exception message, so RPC users see the reason. THROW,
+// unlike ABORT, can be caught, so a revert in a called contract unwinds to
+// the handler frame of the caller, and Neo discards the storage changes of
+// the reverted call as the EVM does. Uncaught, it faults the transaction.
+//
+// External calls and creations run in a handler frame: TRY names the catch
+// block, and the frame is recorded in NeoContract.ExceptionHandlers. The
+// catch block of an external call keeps the data of a thrown pair, or a
+// thrown byte string, as the return data, so the catch clause of Solidity
+// try/catch decodes its reason with returndatacopy as on the EVM.
+
+// handlerFrame is a TRY block whose offsets are known once labels are
+type handlerFrame struct {
+	try   int    // Index of the TRY instruction
+	catch string // Label of the catch block
+	end   string // Label following the catch block
+	depth int    // Stack depth at TRY
+}
+
+// emitTry opens a handler frame whose exceptions continue at catch, with
+// the exception on the stack; the protected code and the catch block leave
+// it with ENDTRY.
+func (g *CodeGenerator) emitTry(catch, end string, location SourcePosition) {
+	// Catch offset, then finally offset, which stays 0 for no finally block
+	g.emitInstruction(NewControlFlowInstruction(TRY, 0), location)
+	g.addPendingLabel(catch, len(g.instructions)-1)
+	g.tries = append(g.tries, handlerFrame{
+		try:   len(g.instructions) - 1,
+		catch: catch,
+		end:   end,
+		depth: g.stackTracker.currentDepth,
+	})
+}
+
+// resolveHandlers returns the handler frames with byte offsets. A frame
+// without a finally block has FinallyOffset -1.
+func (g *CodeGenerator) resolveHandlers() []ExceptionHandler {
+	handlers := make([]ExceptionHandler, 0, len(g.tries))
+	for _, frame := range g.tries {
+		catch, _ := g.labelMap.Get(frame.catch)
+		end, _ := g.labelMap.Get(frame.end)
+		handlers = append(handlers, ExceptionHandler{
+			TryOffset:     g.byteOffset(frame.try),
+			CatchOffset:   g.byteOffset(catch),
+			FinallyOffset: -1,
+			EndOffset:     g.byteOffset(end),
+			StackDepth:    frame.depth,
+		})
+	}
+	return handlers
+}
+
+// revertReason is the routine building the thrown pair
+const revertReason = "revert_reason"
+
+// Selectors of the Solidity error payloads
+var (
+	errorSelector = []byte{0x08, 0xc3, 0x79, 0xa0} // Error(string)
+	panicSelector = []byte{0x4e, 0x48, 0x7b, 0x71} // Panic(uint256)
+)
+
+// generateRevert throws the revert data, with the offset on top of the
+// length
+func (g *CodeGenerator) generateRevert(location SourcePosition) {
+	g.emitMemoryCall(memorySlice, 2, 1, location)
+	g.emitMemoryCall(revertReason, 1, 1, location)
+	throw := NewControlFlowInstruction(THROW, 0)
+	throw.StackPop = 1
+	g.emitInstruction(throw, location)
+}
+
+// generateInvalid throws the pair of invalid()
+func (g *CodeGenerator) generateInvalid(location SourcePosition) {
+	c := memoryCode{g, location}
+	c.op(NewPushInstruction(CreateNeoVMByteString("")))
+	c.op(NewPushInstruction(CreateNeoVMByteString("invalid instruction")))
+	c.push(2)
+	pack := NewArithmeticInstruction(PACK)
+	pack.StackPop, pack.StackPush = 3, 1
+	c.op(pack)
+	throw := NewControlFlowInstruction(THROW, 0)
+	throw.StackPop = 1
+	c.op(throw)
+}
+
+// emitRevertReason returns [reason, data] for the revert data. Argument:
+// data; locals: string offset, string length.
+func (g *CodeGenerator) emitRevertReason(location SourcePosition) {
+	c := memoryCode{g, location}
+	ld := func(i int) { c.op(NewSlotInstruction(LDLOC, i)) }
+	st := func(i int) { c.op(NewSlotInstruction(STLOC, i)) }
+	notError := g.createUniqueLabel("revert_not_error")
+	plain := g.createUniqueLabel("revert_plain")
+	pack := g.createUniqueLabel("revert_pack")
+
+	// selectorIs pushes whether the data starts with selector
+	selectorIs := func(selector []byte) {
+		c.arg(0)
+		c.push(0)
+		c.push(4)
+		c.arithmetic(SUBSTR)
+		c.op(NewConvertInstruction(ByteStringType))
+		c.op(NewPushInstruction(CreateNeoVMByteString(selector)))
+		c.arithmetic(EQUAL)
+	}
+	// uint32At pushes the low 32 bits of the word at the offset on top;
+	// offsets and lengths never need more
+	uint32At := func() {
+		c.push(28)
+		c.arithmetic(ADD)
+		c.arg(0)
+		c.op(NewStackInstruction(SWAP))
+		c.push(4)
+		c.arithmetic(SUBSTR)
+		c.op(NewStackInstruction(DUP))
+		c.arithmetic(REVERSEITEMS)
+		c.op(NewPushInstruction(CreateNeoVMByteString([]byte{0})))
+		c.arithmetic(CAT)
+		c.op(NewConvertInstruction(IntegerType))
+	}
+
+	// Error(string): the string is at 4 + its offset word, length first
+	c.arg(0)
+	c.arithmetic(SIZE)
+	c.push(68)
+	c.arithmetic(LT)
+	c.jump(JMPIF, notError)
+	selectorIs(errorSelector)
+	c.jump(JMPIFNOT, notError)
+	c.push(4)
+	uint32At()
+	c.push(36)
+	c.arithmetic(ADD)
+	st(0)
+	ld(0)
+	c.arg(0)
+	c.arithmetic(SIZE, GT)
+	c.jump(JMPIF, notError)
+	ld(0)
+	c.push(32)
+	c.arithmetic(SUB)
+	uint32At()
+	st(1)
+	ld(0)
+	ld(1)
+	c.arithmetic(ADD)
+	c.arg(0)
+	c.arithmetic(SIZE, GT)
+	c.jump(JMPIF, notError)
+	c.arg(0)
+	ld(0)
+	ld(1)
+	c.arithmetic(SUBSTR)
+	c.op(NewConvertInstruction(ByteStringType))
+	c.jump(JMP, pack)
+
+	// Panic(uint256): Panic(0x<code>)
+	g.markLabel(notError)
+	c.arg(0)
+	c.arithmetic(SIZE)
+	c.push(36)
+	c.arithmetic(NUMEQUAL)
+	c.jump(JMPIFNOT, plain)
+	selectorIs(panicSelector)
+	c.jump(JMPIFNOT, plain)
+	c.op(NewPushInstruction(CreateNeoVMByteString("Panic(0x")))
+	c.push(16)
+	c.push(4)
+	uint32At()
+	c.callNative(StdLibHash, "itoa", 2, 0)
+	c.arithmetic(CAT)
+	c.op(NewPushInstruction(CreateNeoVMByteString(")")))
+	c.arithmetic(CAT)
+	c.op(NewConvertInstruction(ByteStringType))
+	c.jump(JMP, pack)
+
+	g.markLabel(plain)
+	g.stackTracker.currentDepth--
+	c.op(NewPushInstruction(CreateNeoVMByteString("execution reverted")))
+
+	g.markLabel(pack)
+	c.arg(0)
+	c.op(NewStackInstruction(SWAP))
+	c.push(2)
+	packItems := NewArithmeticInstruction(PACK)
+	packItems.StackPop, packItems.StackPush = 3, 1
+	c.op(packItems)
+}
@@ -0,0 +1,100 @@
+package main
+
+import "fmt"
+
+// Calling convention.
+//
+// The caller pushes the arguments last to first, so the first argument is
+// on top, and CALLs the function label. The callee's INITSLOT pops them into
+// argument slots 0..n-1. On exit the callee pushes its return variables
+// last to first, so after the call the first return value is on top and the
+// caller stores the values in declaration order. Each call therefore
+// replaces its arguments with exactly the function's return values, and
+// callers drop whatever they do not use.
+//
+// Function bodies are placed where they are defined; straight-line code
+// jumps over them, so a function only runs when it is called.
+
+// voidBuiltins are the built-ins that leave no value on the stack
+var voidBuiltins = map[string]bool{
+	"sstore": true, "tstore": true, "setimmutable": true, "mstore": true, "mstore8": true,
+	"calldatacopy": true, "datacopy": true, "codecopy": true, "mcopy": true, "returndatacopy": true, "pop": true,
+	"revert": true, "invalid": true, "return": true, "stop": true, "selfdestruct": true,
+	"log0": true, "log1": true, "log2": true, "log3": true, "log4": true,
+}
+
+// collectFunctions records the signature of every function defined in
+// block, including nested ones, so calls can be checked before the callee
+// is generated
+func (g *CodeGenerator) collectFunctions(block *YulBlock) error {
+	g.signatures = make(map[string]*YulFunctionDef)
+	var err error
+	walkBlock(block, func(b *YulBlock) {
+		for _, stmt := range b.Statements {
+			def, ok := stmt.(*YulFunctionDef)
+			if !ok || err != nil {
+				continue
+			}
+			if _, exists := g.signatures[def.Name]; exists {
+				err = fmt.Errorf("function %s defined more than once at line %d", def.Name, def.Location.Line)
+				return
+			}
+			g.signatures[def.Name] = def
+		}
+	})
+	return err
+}
+
+// returnCount returns the number of values call leaves on the stack
+func (g *CodeGenerator) returnCount(call *YulFunctionCall) int {
+	name := call.FunctionName.Name
+	if def, ok := g.signatures[name]; ok {
+		return len(def.Returns)
+	}
+	if isNeoBuiltin(name) {
+		if results, err := checkNeoCall(call); err == nil {
+			return results
+		}
+	}
+	if _, results, ok := verbatimArity(name); ok {
+		return results
+	}
+	if voidBuiltins[name] {
+		return 0
+	}
+	return 1
+}
+
+// checkValueCount reports an error unless expr yields exactly want values
+func (g *CodeGenerator) checkValueCount(expr YulExpression, want int) error {
+	call, ok := expr.(*YulFunctionCall)
+	if !ok {
+		if want != 1 {
+			return fmt.Errorf("expected %d values at line %d, got 1", want, expr.GetLocation().Line)
+		}
+		return nil
+	}
+	if got := g.returnCount(call); got != want {
+		return fmt.Errorf("%s returns %d values at line %d, expected %d", call.FunctionName.Name, got, call.Location.Line, want)
+	}
+	return nil
+}
+
+// generateUserCall calls a function defined in the code being generated
+func (g *CodeGenerator) generateUserCall(call *YulFunctionCall) error {
+	name := call.FunctionName.Name
+	def, ok := g.signatures[name]
+	if !ok {
+		return fmt.Errorf("undefined function %s at line %d", name, call.Location.Line)
+	}
+	if len(call.Arguments) != len(def.Parameters) {
+		return fmt.Errorf("function %s expects %d arguments, got %d at line %d",
+			name, len(def.Parameters), len(call.Arguments), call.Location.Line)
+	}
+
+	instr := NewControlFlowInstruction(CALL, 0)
+	instr.StackPop, instr.StackPush = len(call.Arguments), len(def.Returns)
+	g.emitInstruction(instr, call.Location)
+	g.addPendingLabel("func_"+name, len(g.instructions)-1)
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// Gas baselines.
+//
+// A GasBaseline records, per contract, the size of its script, the worst
+// case gas the gas report estimates for each function and the gas measured
+// running benchmark invocations. The gas benchmarks write one per commit;
+// comparing the baseline of a change with the one checked in lists every
+// metric that grew by more than a tolerance, in percent, so a codegen
+// change that makes contracts bigger or more expensive is caught in review.
+
+// GasBaseline holds the metrics of benchmark contracts
+type GasBaseline struct {
+	Commit    string                      `json:"commit,omitempty"` // Revision the metrics were taken at
+	Contracts map[string]*ContractMetrics `json:"contracts"`
+}
+
+// ContractMetrics are the size and gas metrics of a contract
+type ContractMetrics struct {
+	Size      int64            `json:"size"`                // Script bytes
+	Estimated map[string]int64 `json:"estimated,omitempty"` // Maximum gas report fee by function, in datoshi
+	Measured  map[string]int64 `json:"measured,omitempty"`  // Gas consumed by invocation, in datoshi
+}
+
+// GasRegression is a metric that grew beyond the tolerance
+type GasRegression struct {
+	Contract string
+	Metric   string // "size", "estimated <function>" or "measured <invocation>"
+	Old, New int64
+	Percent  float64 // Growth over Old, +Inf when Old is 0
+}
+
+func (r GasRegression) String() string {
+	return fmt.Sprintf("%s: %s grew %.1f%%, %d -> %d", r.Contract, r.Metric, r.Percent, r.Old, r.New)
+}
+
+// NewGasBaseline creates an empty baseline
+func NewGasBaseline() *GasBaseline {
+	return &GasBaseline{Contracts: make(map[string]*ContractMetrics)}
+}
+
+// LoadGasBaseline reads a JSON baseline from path
+func LoadGasBaseline(path string) (*GasBaseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading gas baseline: %w", err)
+	}
+	baseline := NewGasBaseline()
+	if err := json.Unmarshal(data, baseline); err != nil {
+		return nil, fmt.Errorf("invalid gas baseline: %w", err)
+	}
+	if baseline.Contracts == nil {
+		baseline.Contracts = make(map[string]*ContractMetrics)
+	}
+	return baseline, nil
+}
+
+// Save writes the baseline as indented JSON
+func (b *GasBaseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Record adds the size of contract and the estimated fees of report under
+// name, replacing what was recorded before
+func (b *GasBaseline) Record(name string, contract *NeoContract, report *GasReport) *ContractMetrics {
+	script, _ := contract.Script()
+	metrics := &ContractMetrics{
+		Size:      int64(len(script)),
+		Estimated: make(map[string]int64),
+		Measured:  make(map[string]int64),
+	}
+	if report != nil {
+		for _, cost := range report.Functions {
+			metrics.Estimated[cost.Name] = cost.Max
+		}
+	}
+	b.Contracts[name] = metrics
+	return metrics
+}
+
+// CompareGasBaselines lists the metrics of current that grew by more than
+// tolerance percent over base, by contract and metric. Contracts and
+// metrics base does not have are new and never regress.
+func CompareGasBaselines(base, current *GasBaseline, tolerance float64) []GasRegression {
+	var regressions []GasRegression
+	check := func(contract, metric string, old, new int64) {
+		if new <= old {
+			return
+		}
+		percent := math.Inf(1)
+		if old != 0 {
+			percent = float64(new-old) * 100 / float64(old)
+		}
+		if percent > tolerance {
+			regressions = append(regressions, GasRegression{contract, metric, old, new, percent})
+		}
+	}
+	for name, metrics := range current.Contracts {
+		old, ok := base.Contracts[name]
+		if !ok {
+			continue
+		}
+		check(name, "size", old.Size, metrics.Size)
+		for function, fee := range metrics.Estimated {
+			if before, ok := old.Estimated[function]; ok {
+				check(name, "estimated "+function, before, fee)
+			}
+		}
+		for invocation, gas := range metrics.Measured {
+			if before, ok := old.Measured[invocation]; ok {
+				check(name, "measured "+invocation, before, gas)
+			}
+		}
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		if regressions[i].Contract != regressions[j].Contract {
+			return regressions[i].Contract < regressions[j].Contract
+		}
+		return regressions[i].Metric < regressions[j].Metric
+	})
+	return regressions
+}
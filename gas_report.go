@@ -0,0 +1,299 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Gas report.
+//
+// The gas estimator walks the emitted instructions as a graph: jumps lead
+// to their label, conditional jumps and TRY to their label and the next
+// instruction, and CALL adds the cost of the called routine. The cheapest
+// and the most expensive path from the start of each function to its RET
+// are priced with the network price table, and so are the paths from each
+// case label of a switch, which for the dispatcher is the cost of one
+// selector. A path that only throws counts when no path returns. Loops and
+// recursion are priced once per iteration and flag the maximum as
+// unbounded.
+
+// GasCost is the execution fee, in datoshi, of a function or a switch case
+type GasCost struct {
+	Name      string `json:"name"`               // Function name, or the case value
+	Function  string `json:"function,omitempty"` // Function holding a case, empty at top level
+	Line      int    `json:"line,omitempty"`
+	Min       int64  `json:"min"`
+	Max       int64  `json:"max"`
+	Unbounded bool   `json:"unbounded,omitempty"` // A loop or recursion may exceed Max
+}
+
+// GasReport lists the costs of the functions and switch cases of a script
+type GasReport struct {
+	Functions []GasCost `json:"functions"`
+	Cases     []GasCost `json:"cases"`
+}
+
+// switchCase is a case label of a generated switch
+type switchCase struct {
+	label    string
+	value    string
+	function string
+	location SourcePosition
+}
+
+// gasPath is the cost of the paths from an instruction to the end of its
+// routine
+type gasPath struct {
+	min, max  int64
+	returns   bool // Some path ends at RET
+	unbounded bool
+}
+
+// GasEstimator prices the paths through generated instructions
+type GasEstimator struct {
+	instructions []NeoInstruction
+	prices       *PriceTable
+	jumps        map[int]int // Instruction to the instruction its label marks
+	routines     map[int]*gasPath
+	active       map[int]bool // Routines being priced, for recursion
+}
+
+// NewGasEstimator prices the instructions generated by g with prices
+func NewGasEstimator(g *CodeGenerator, prices *PriceTable) *GasEstimator {
+	e := &GasEstimator{
+		instructions: g.instructions,
+		prices:       prices,
+		jumps:        make(map[int]int, len(g.pendingLabels)),
+		routines:     make(map[int]*gasPath),
+		active:       make(map[int]bool),
+	}
+	for _, pending := range g.pendingLabels {
+		if target, ok := g.labelMap.Get(pending.Name); ok {
+			e.jumps[pending.InstructionIndex] = target
+		}
+	}
+	return e
+}
+
+// GasReport prices the functions and switch cases generated by g
+func (g *CodeGenerator) GasReport(prices *PriceTable) *GasReport {
+	e := NewGasEstimator(g, prices)
+	report := &GasReport{Functions: []GasCost{}, Cases: []GasCost{}}
+	for name, info := range g.functionTable {
+		report.Functions = append(report.Functions, e.cost(name, info.StartOffset))
+	}
+	sort.Slice(report.Functions, func(i, j int) bool { return report.Functions[i].Name < report.Functions[j].Name })
+	for _, c := range g.switchCases {
+		if start, ok := g.labelMap.Get(c.label); ok {
+			cost := e.cost("case "+c.value, start)
+			cost.Function, cost.Line = c.function, c.location.Line
+			report.Cases = append(report.Cases, cost)
+		}
+	}
+	return report
+}
+
+func (e *GasEstimator) cost(name string, start int) GasCost {
+	path := e.paths(start)
+	return GasCost{Name: name, Min: path.min, Max: path.max, Unbounded: path.unbounded}
+}
+
+// routine prices a routine called at target, once
+func (e *GasEstimator) routine(target int) gasPath {
+	if path, ok := e.routines[target]; ok {
+		return *path
+	}
+	if e.active[target] {
+		// Recursion: the call is priced without its body
+		return gasPath{returns: true, unbounded: true}
+	}
+	e.active[target] = true
+	path := e.paths(target)
+	delete(e.active, target)
+	e.routines[target] = &path
+	return path
+}
+
+// step returns the successors of the instruction at i and whether it
+// ends its routine
+func (e *GasEstimator) step(i int) (next []int, end bool) {
+	op := e.instructions[i].Opcode
+	target, jumps := e.jumps[i]
+	mnemonic := OpcodeMnemonic(op)
+	switch {
+	case op == RET:
+		return nil, true
+	case op == THROW || op == ABORT || op == ABORTMSG:
+		return nil, false
+	case jumps && (op == JMP || op == JMP_L || op == ENDTRY || op == ENDTRY_L):
+		return []int{target}, false
+	case jumps && (strings.HasPrefix(mnemonic, "JMP") || op == TRY || op == TRY_L):
+		next = []int{target}
+	}
+	if i+1 < len(e.instructions) {
+		next = append(next, i+1)
+	} else {
+		end = true
+	}
+	return next, end
+}
+
+// price returns the fee of the instruction at i, with the routine it calls
+func (e *GasEstimator) price(i int) gasPath {
+	fee := e.prices.ExecutionFee(e.prices.InstructionPrice(e.instructions[i]))
+	path := gasPath{min: fee, max: fee, returns: true}
+	op := e.instructions[i].Opcode
+	if target, ok := e.jumps[i]; ok && (op == CALL || op == CALL_L) {
+		called := e.routine(target)
+		path.min += called.min
+		path.max += called.max
+		path.unbounded = called.unbounded
+	}
+	return path
+}
+
+// paths computes the cheapest path by Dijkstra's algorithm and the most
+// expensive one over the instructions reachable from start, whose back
+// edges close loops
+func (e *GasEstimator) paths(start int) gasPath {
+	result := gasPath{}
+
+	// Cheapest path to a RET, else to a throw
+	dist := map[int]int64{start: e.price(start).min}
+	queue := &gasQueue{{start, dist[start]}}
+	bestReturn, bestThrow := int64(math.MaxInt64), int64(math.MaxInt64)
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(gasItem)
+		if item.fee > dist[item.index] {
+			continue
+		}
+		next, end := e.step(item.index)
+		if end && item.fee < bestReturn {
+			bestReturn = item.fee
+		}
+		if !end && len(next) == 0 && item.fee < bestThrow {
+			bestThrow = item.fee
+		}
+		for _, n := range next {
+			fee := item.fee + e.price(n).min
+			if old, ok := dist[n]; !ok || fee < old {
+				dist[n] = fee
+				heap.Push(queue, gasItem{n, fee})
+			}
+		}
+	}
+	result.returns = bestReturn != math.MaxInt64
+	result.min = bestReturn
+	if !result.returns {
+		result.min = bestThrow
+		if bestThrow == math.MaxInt64 {
+			result.min = 0
+		}
+	}
+
+	// Most expensive path, by depth-first search
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[int]int{}
+	longest := map[int]int64{}
+	returning := map[int]bool{}
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = visiting
+		own := e.price(i)
+		result.unbounded = result.unbounded || own.unbounded
+		next, end := e.step(i)
+		best, returns := int64(-1), end
+		if end {
+			best = 0
+		}
+		throwing := int64(-1)
+		for _, n := range next {
+			switch state[n] {
+			case visiting:
+				// A loop: the iteration ends here and may repeat
+				result.unbounded = true
+				if best < 0 {
+					best = 0
+				}
+				returns = true
+				continue
+			case 0:
+				visit(n)
+			}
+			if returning[n] && longest[n] > best {
+				best, returns = longest[n], true
+			} else if !returning[n] && longest[n] > throwing {
+				throwing = longest[n]
+			}
+		}
+		if !returns {
+			best = throwing
+			if best < 0 {
+				best = 0
+			}
+		}
+		longest[i], returning[i] = own.max+best, returns
+		state[i] = visited
+	}
+	visit(start)
+	result.max = longest[start]
+	if result.max < result.min {
+		result.max = result.min
+	}
+	return result
+}
+
+// WriteTable prints the report as a table
+func (r *GasReport) WriteTable(w io.Writer) {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "FUNCTION\tLINE\tMIN\tMAX")
+	row := func(name string, cost GasCost) {
+		max := fmt.Sprint(cost.Max)
+		if cost.Unbounded {
+			max += "+ (unbounded)"
+		}
+		line := ""
+		if cost.Line > 0 {
+			line = fmt.Sprint(cost.Line)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\n", name, line, cost.Min, max)
+	}
+	for _, cost := range r.Functions {
+		row(cost.Name, cost)
+	}
+	for _, cost := range r.Cases {
+		name := cost.Name
+		if cost.Function != "" {
+			name = cost.Function + ": " + name
+		}
+		row(name, cost)
+	}
+	table.Flush()
+}
+
+// gasQueue orders instructions by the fee of reaching them
+type gasItem struct {
+	index int
+	fee   int64
+}
+
+type gasQueue []gasItem
+
+func (q gasQueue) Len() int            { return len(q) }
+func (q gasQueue) Less(i, j int) bool  { return q[i].fee < q[j].fee }
+func (q gasQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *gasQueue) Push(x interface{}) { *q = append(*q, x.(gasItem)) }
+func (q *gasQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
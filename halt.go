@@ -0,0 +1,152 @@
+package main
+
+// Halting.
+//
+// return(p, s), stop() and selfdestruct(a) end the whole invocation, not
+// just the Yul function calling them. In the top-level code they drop what
+// the code holds on the stack and return from the method, with the memory
+// range [p, p+s) as a byte string when the method returns data, which is
+// empty for stop and selfdestruct. NeoVM cannot return through the
+// routines of the Yul functions, so a function halting throws a halt
+// marker instead, the data as a buffer, which unwinds to a handler frame
+// around the entry point: the top-level code, and the call of each stub.
+// The catch block rethrows anything else, and ends the method on a marker
+// with an empty stack, or with the data for a method returning a value.
+// Scripts whose functions never halt have no such frames.
+
+// haltingBuiltins are the builtins ending the invocation, with the number
+// of their arguments
+var haltingBuiltins = map[string]int{
+	"return":       2,
+	"stop":         0,
+	"selfdestruct": 1,
+}
+
+// functionsHalt reports whether a function defined in block calls a
+// halting builtin
+func functionsHalt(block *YulBlock) bool {
+	halts := false
+	walkBlock(block, func(b *YulBlock) {
+		for _, stmt := range b.Statements {
+			if def, ok := stmt.(*YulFunctionDef); ok {
+				for name := range haltingBuiltins {
+					halts = halts || callsFunction(def.Body, name)
+				}
+			}
+		}
+	})
+	return halts
+}
+
+// haltResults is the number of values the top-level code returns
+func (g *CodeGenerator) haltResults() int {
+	if g.entry != nil && g.entry.returns && !g.deploying {
+		return 1
+	}
+	return 0
+}
+
+// generateHalt ends the invocation with the arguments of the halting
+// builtin name on the stack
+func (g *CodeGenerator) generateHalt(name string, location SourcePosition) {
+	c := memoryCode{g, location}
+	args := haltingBuiltins[name]
+	depth := g.stackTracker.currentDepth
+	defer func() { g.stackTracker.currentDepth = depth - args }()
+	if g.frame != nil {
+		if name == "return" {
+			g.emitMemoryCall(memorySlice, 2, 1, location)
+			c.op(NewConvertInstruction(BufferType))
+		} else {
+			for i := 0; i < args; i++ {
+				c.op(NewStackInstruction(DROP))
+			}
+			c.push(0)
+			c.arithmetic(NEWBUFFER)
+		}
+		c.op(NewControlFlowInstruction(THROW, 0))
+		return
+	}
+
+	// The constructor of _deploy hands no code back
+	results := g.haltResults()
+	if name == "return" && results > 0 {
+		g.emitMemoryCall(memorySlice, 2, 1, location)
+	} else {
+		for i := 0; i < args; i++ {
+			c.op(NewStackInstruction(DROP))
+		}
+		if results > 0 {
+			c.op(NewPushInstruction(CreateNeoVMByteString("")))
+		}
+	}
+	for i := 0; i < g.stackItems; i++ {
+		if results > 0 {
+			c.op(NewStackInstruction(NIP))
+		} else {
+			c.op(NewStackInstruction(DROP))
+		}
+	}
+	c.op(NewControlFlowInstruction(RET, 0))
+}
+
+// haltFrame is a handler frame taking the halt marker
+type haltFrame struct {
+	caught string // Label of the catch block
+	end    string // Label following the catch block
+	depth  int    // Stack depth at TRY
+}
+
+// tryHalts opens a handler frame for the code entering the Yul code of a
+// method, nil when no function of the script halts
+func (g *CodeGenerator) tryHalts(location SourcePosition) *haltFrame {
+	if !g.halts {
+		return nil
+	}
+	frame := &haltFrame{
+		caught: g.createUniqueLabel("halt_caught"),
+		end:    g.createUniqueLabel("halt_end"),
+		depth:  g.stackTracker.currentDepth,
+	}
+	g.emitTry(frame.caught, frame.end, location)
+	return frame
+}
+
+// catchHalts closes frame with its catch block, which ends a method
+// returning results values
+func (g *CodeGenerator) catchHalts(frame *haltFrame, results int, location SourcePosition) {
+	if frame == nil {
+		return
+	}
+	c := memoryCode{g, location}
+	halted := g.createUniqueLabel("halt_halted")
+	depth := g.stackTracker.currentDepth
+	if g.reachable() {
+		c.jump(ENDTRY, frame.end)
+	}
+
+	g.markLabel(frame.caught)
+	g.stackTracker.currentDepth = frame.depth + 1 // The exception
+	c.op(NewStackInstruction(DUP))
+	c.op(NewIsTypeInstruction(BufferType))
+	c.jump(JMPIF, halted)
+	c.op(NewControlFlowInstruction(THROW, 0))
+	g.markLabel(halted)
+	g.stackTracker.currentDepth = frame.depth + 1
+	if results == 0 {
+		c.op(NewStackInstruction(CLEAR))
+	} else {
+		// The data is on top of whatever the unwound routines left
+		c.op(NewConvertInstruction(ByteStringType))
+		c.op(NewStackInstruction(DEPTH))
+		pack := NewArithmeticInstruction(PACK)
+		pack.StackPop, pack.StackPush = g.stackTracker.currentDepth, 1
+		c.op(pack)
+		c.push(0)
+		c.arithmetic(PICKITEM)
+	}
+	c.op(NewControlFlowInstruction(RET, 0))
+
+	g.markLabel(frame.end)
+	g.stackTracker.currentDepth = depth
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Immutables.
+//
+// solc assigns immutables in the constructor with setimmutable(offset,
+// "name", value), which patches value into the runtime code it copies to
+// memory at offset, and the runtime reads them with loadimmutable("name").
+// Neo deploys the contract script as compiled, so there is no code to
+// patch: an immutable instead lives in storage under ImmutableStoragePrefix
+// followed by its name, written by setimmutable in _deploy and read by
+// loadimmutable like a slot. The offset is evaluated and dropped. An
+// immutable the constructor never set loads as 0, and setimmutable is only
+// available in constructor code.
+//
+// The contract records the immutables of its code in an ImmutableTable, in
+// the order they first appear.
+
+// ImmutableStoragePrefix is the reserved key prefix of immutables. The
+// leading 0xff byte keeps it out of the range of slot keys.
+var ImmutableStoragePrefix = []byte("\xffimmutable/")
+
+// Immutable is an immutable of the contract with its storage key
+type Immutable struct {
+	Name string `json:"name"`
+	Key  []byte `json:"key"`
+	Set  bool   `json:"set"` // Assigned by the constructor
+}
+
+// ImmutableTable collects the immutables of the contract
+type ImmutableTable struct {
+	immutables []Immutable
+}
+
+// NewImmutableTable creates an empty table
+func NewImmutableTable() *ImmutableTable {
+	return &ImmutableTable{}
+}
+
+// ImmutableKey returns the storage key of the immutable name
+func ImmutableKey(name string) []byte {
+	return append(append([]byte{}, ImmutableStoragePrefix...), name...)
+}
+
+// Add returns the storage key of name, adding it unless the table has it,
+// and marks it set when set is true
+func (t *ImmutableTable) Add(name string, set bool) []byte {
+	for i := range t.immutables {
+		if t.immutables[i].Name == name {
+			t.immutables[i].Set = t.immutables[i].Set || set
+			return t.immutables[i].Key
+		}
+	}
+	t.immutables = append(t.immutables, Immutable{Name: name, Key: ImmutableKey(name), Set: set})
+	return t.immutables[len(t.immutables)-1].Key
+}
+
+// Lookup returns the immutable name
+func (t *ImmutableTable) Lookup(name string) (Immutable, bool) {
+	if t != nil {
+		for _, immutable := range t.immutables {
+			if immutable.Name == name {
+				return immutable, true
+			}
+		}
+	}
+	return Immutable{}, false
+}
+
+// Immutables returns the immutables in the order they were added
+func (t *ImmutableTable) Immutables() []Immutable {
+	if t == nil {
+		return nil
+	}
+	return t.immutables
+}
+
+// Len returns the number of immutables
+func (t *ImmutableTable) Len() int {
+	return len(t.Immutables())
+}
+
+// MarshalJSON encodes the table as its list of immutables
+func (t *ImmutableTable) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Immutables())
+}
+
+// immutableName returns the string literal naming the immutable of a
+// setimmutable or loadimmutable call
+func immutableName(call *YulFunctionCall, index int) (string, error) {
+	if index < len(call.Arguments) {
+		if lit, ok := call.Arguments[index].(*YulLiteral); ok && lit.Kind == LiteralKindString {
+			return lit.Value, nil
+		}
+	}
+	return "", fmt.Errorf("%s expects a string literal naming the immutable at line %d", call.FunctionName.Name, call.Location.Line)
+}
+
+// generateImmutable emits a setimmutable or loadimmutable call
+func (g *CodeGenerator) generateImmutable(call *YulFunctionCall) error {
+	name, location := call.FunctionName.Name, call.Location
+	c := memoryCode{g, location}
+	if name == "loadimmutable" {
+		if len(call.Arguments) != 1 {
+			return fmt.Errorf("loadimmutable expects 1 argument, got %d at line %d", len(call.Arguments), location.Line)
+		}
+		immutable, err := immutableName(call, 0)
+		if err != nil {
+			return err
+		}
+		c.op(NewPushInstruction(CreateNeoVMByteString(g.immutables.Add(immutable, false))))
+		g.emitStorageRead(location)
+		return nil
+	}
+
+	if len(call.Arguments) != 3 {
+		return fmt.Errorf("setimmutable expects 3 arguments, got %d at line %d", len(call.Arguments), location.Line)
+	}
+	immutable, err := immutableName(call, 1)
+	if err != nil {
+		return err
+	}
+	if !g.constructing {
+		return fmt.Errorf("setimmutable of %q outside constructor code at line %d", immutable, location.Line)
+	}
+	for _, arg := range []YulExpression{call.Arguments[2], call.Arguments[0]} {
+		if err := g.checkValueCount(arg, 1); err != nil {
+			return err
+		}
+		if err := g.generateExpression(arg); err != nil {
+			return err
+		}
+	}
+	// value offset -> value
+	c.op(NewStackInstruction(DROP))
+	c.op(NewPushInstruction(CreateNeoVMByteString(g.immutables.Add(immutable, true))))
+	g.emitStorageContext(location)
+	c.syscall("System.Storage.Put")
+	return nil
+}
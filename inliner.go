@@ -0,0 +1,261 @@
+package main
+
+import "sort"
+
+// FunctionInliningPass replaces calls to small single-expression functions
+// with the function body, guided by the shared OptimizationProfile.
+//
+// A function is an inlining candidate when it has exactly one return
+// variable and its body is a single assignment of an expression over its
+// parameters to that variable, e.g.
+//
+//	function safeAdd(a, b) -> r { r := add(a, b) }
+type FunctionInliningPass struct {
+	profile   *OptimizationProfile
+	Decisions map[string]InliningDecision
+}
+
+// inlineCandidate is a function whose body can be substituted at call sites
+type inlineCandidate struct {
+	def      *YulFunctionDef
+	body     YulExpression
+	uses     map[string]int // Parameter name -> occurrences in body
+	size     int
+	calls    int
+	inlined  int
+	rejected bool
+}
+
+// NewFunctionInliningPass creates an inlining pass driven by the given profile
+func NewFunctionInliningPass(profile *OptimizationProfile) *FunctionInliningPass {
+	if profile == nil {
+		profile = DefaultOptimizationProfile()
+	}
+	return &FunctionInliningPass{
+		profile:   profile,
+		Decisions: make(map[string]InliningDecision),
+	}
+}
+
+func (p *FunctionInliningPass) Name() string       { return "function_inlining" }
+func (p *FunctionInliningPass) RequiredLevel() int { return 3 }
+
+// Apply inlines every candidate the cost model accepts and drops definitions
+// whose call sites were all inlined.
+func (p *FunctionInliningPass) Apply(ast *YulAST) (*YulAST, error) {
+	userFunctions := make(map[string]int)
+	forEachFunctionDef(ast, func(fn *YulFunctionDef) {
+		userFunctions[fn.Name]++
+	})
+
+	candidates := make(map[string]*inlineCandidate)
+	forEachFunctionDef(ast, func(fn *YulFunctionDef) {
+		// Functions that share a name in different scopes are left alone
+		if userFunctions[fn.Name] != 1 {
+			return
+		}
+		if c := p.makeCandidate(fn, userFunctions); c != nil {
+			candidates[fn.Name] = c
+		}
+	})
+	if len(candidates) == 0 {
+		return ast, nil
+	}
+
+	// Count call sites and decide per function
+	forEachExpression(ast, func(expr YulExpression) YulExpression {
+		if call, ok := expr.(*YulFunctionCall); ok {
+			if c, exists := candidates[call.FunctionName.Name]; exists {
+				c.calls++
+			}
+		}
+		return expr
+	})
+
+	currentSize := estimateASTSize(ast)
+	for _, name := range sortedCandidateNames(candidates) {
+		c := candidates[name]
+		decision := p.profile.EvaluateFunctionInlining(name, c.size, c.calls, currentSize)
+		p.Decisions[name] = decision
+		if !decision.Inline {
+			c.rejected = true
+			continue
+		}
+		currentSize += decision.SizeDelta
+	}
+
+	forEachExpression(ast, func(expr YulExpression) YulExpression {
+		call, ok := expr.(*YulFunctionCall)
+		if !ok {
+			return expr
+		}
+		c, exists := candidates[call.FunctionName.Name]
+		if !exists || c.rejected || !c.canSubstitute(call) {
+			return expr
+		}
+		c.inlined++
+		return c.instantiate(call)
+	})
+
+	// Remove definitions that no longer have any callers
+	removeFunctionDefs(ast, func(fn *YulFunctionDef) bool {
+		c, exists := candidates[fn.Name]
+		return exists && !c.rejected && c.inlined == c.calls
+	})
+
+	return ast, nil
+}
+
+// makeCandidate returns the inlining candidate for fn, or nil if its shape
+// does not allow expression-level inlining.
+func (p *FunctionInliningPass) makeCandidate(fn *YulFunctionDef, userFunctions map[string]int) *inlineCandidate {
+	if len(fn.Returns) != 1 || fn.Body == nil || len(fn.Body.Statements) != 1 {
+		return nil
+	}
+	assign, ok := fn.Body.Statements[0].(*YulAssignment)
+	if !ok || len(assign.VariableNames) != 1 || assign.VariableNames[0] != fn.Returns[0].Name {
+		return nil
+	}
+
+	params := make(map[string]bool)
+	for _, param := range fn.Parameters {
+		params[param.Name] = true
+	}
+
+	uses := make(map[string]int)
+	valid := true
+	walkExpression(assign.Value, func(expr YulExpression) {
+		switch e := expr.(type) {
+		case *YulIdentifier:
+			if !params[e.Name] {
+				valid = false
+			}
+			uses[e.Name]++
+		case *YulFunctionCall:
+			// Only built-ins, so inlined copies never create new call sites
+			if userFunctions[e.FunctionName.Name] > 0 {
+				valid = false
+			}
+		}
+	})
+	if !valid {
+		return nil
+	}
+
+	return &inlineCandidate{
+		def:  fn,
+		body: assign.Value,
+		uses: uses,
+		size: estimateExpressionSize(assign.Value),
+	}
+}
+
+// canSubstitute reports whether the arguments of call can replace the
+// parameters without changing how often or in which order they are evaluated.
+func (c *inlineCandidate) canSubstitute(call *YulFunctionCall) bool {
+	if len(call.Arguments) != len(c.def.Parameters) {
+		return false
+	}
+	for i, arg := range call.Arguments {
+		switch arg.(type) {
+		case *YulLiteral, *YulIdentifier:
+			continue
+		}
+		if c.uses[c.def.Parameters[i].Name] != 1 || !isPureExpression(arg) {
+			return false
+		}
+	}
+	return true
+}
+
+// instantiate returns a copy of the function body with parameters replaced by
+// the call arguments.
+func (c *inlineCandidate) instantiate(call *YulFunctionCall) YulExpression {
+	args := make(map[string]YulExpression, len(call.Arguments))
+	for i, param := range c.def.Parameters {
+		args[param.Name] = call.Arguments[i]
+	}
+	return substituteExpression(c.body, args, call.Location)
+}
+
+// substituteExpression deep-copies expr, replacing identifiers found in args
+func substituteExpression(expr YulExpression, args map[string]YulExpression, location SourcePosition) YulExpression {
+	switch e := expr.(type) {
+	case *YulIdentifier:
+		if arg, ok := args[e.Name]; ok {
+			return cloneExpression(arg)
+		}
+		copied := *e
+		return &copied
+	case *YulLiteral:
+		copied := *e
+		copied.Location = location
+		return &copied
+	case *YulFunctionCall:
+		copied := *e
+		copied.Location = location
+		copied.Arguments = make([]YulExpression, len(e.Arguments))
+		for i, arg := range e.Arguments {
+			copied.Arguments[i] = substituteExpression(arg, args, location)
+		}
+		return &copied
+	default:
+		return expr
+	}
+}
+
+// isPureExpression reports whether evaluating expr has no side effects
+func isPureExpression(expr YulExpression) bool {
+	pure := true
+	walkExpression(expr, func(e YulExpression) {
+		if call, ok := e.(*YulFunctionCall); ok && !isPureBuiltin(call.FunctionName.Name) {
+			pure = false
+		}
+	})
+	return pure
+}
+
+// estimateExpressionSize approximates the encoded size in bytes of expr
+func estimateExpressionSize(expr YulExpression) int {
+	size := 0
+	walkExpression(expr, func(e YulExpression) {
+		switch v := e.(type) {
+		case *YulLiteral:
+			size += 1 + len(v.Value)/2
+		case *YulIdentifier:
+			size += 1
+		case *YulFunctionCall:
+			if isPureBuiltin(v.FunctionName.Name) {
+				size += 1
+			} else {
+				size += callSiteOverheadBytes
+			}
+		}
+	})
+	return size
+}
+
+// estimateASTSize approximates the encoded size in bytes of the whole program
+func estimateASTSize(ast *YulAST) int {
+	size := 0
+	forEachBlock(ast, func(block *YulBlock) {
+		for _, stmt := range block.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				size += estimateExpressionSize(*slot)
+			}
+		}
+	})
+	forEachFunctionDef(ast, func(*YulFunctionDef) {
+		size += functionEpilogueBytes
+	})
+	return size
+}
+
+func sortedCandidateNames(candidates map[string]*inlineCandidate) []string {
+	names := make([]string, 0, len(candidates))
+	for name := range candidates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// Interop services.
+//
+// SYSCALL names an interop service by its 4-byte ID, the first 4 bytes of
+// the SHA-256 of the service name, read as a little-endian uint32. The
+// registry describes the services of Neo N3: the items each takes from and
+// leaves on the stack, which NewSyscallInstruction gives the stack tracker,
+// and their mainnet prices, which the gas estimator charges. Scripts are
+// assembled and disassembled through it, so a SYSCALL naming a service the
+// node does not provide fails compilation instead of faulting at runtime.
+//
+// Hashing and other library functions are not interop services but
+// methods of native contracts such as CryptoLib, called through
+// System.Contract.Call.
+
+// InteropService is a service a script calls with SYSCALL
+type InteropService struct {
+	Name  string
+	ID    uint32
+	Pop   int   // Arguments taken from the stack, or StackVariable
+	Push  int   // Results pushed, or StackVariable
+	Price int64 // Mainnet price in Policy units
+}
+
+// InteropRegistry maps interop service names to their IDs and back
+type InteropRegistry struct {
+	byName map[string]InteropService
+	byID   map[uint32]InteropService
+}
+
+// neoInteropServices describes the interop services of Neo N3
+var neoInteropServices = []InteropService{
+	{Name: "System.Contract.Call", Pop: 4, Push: 1, Price: 1 << 15},
+	{Name: "System.Contract.CallNative", Pop: 1, Push: StackVariable, Price: 0},
+	{Name: "System.Contract.GetCallFlags", Pop: 0, Push: 1, Price: 1 << 10},
+	{Name: "System.Contract.CreateStandardAccount", Pop: 1, Push: 1, Price: 0},
+	{Name: "System.Contract.CreateMultisigAccount", Pop: 2, Push: 1, Price: 0},
+	{Name: "System.Contract.NativeOnPersist", Pop: 0, Push: 0, Price: 0},
+	{Name: "System.Contract.NativePostPersist", Pop: 0, Push: 0, Price: 0},
+	{Name: "System.Crypto.CheckSig", Pop: 2, Push: 1, Price: 1 << 15},
+	{Name: "System.Crypto.CheckMultisig", Pop: 2, Push: 1, Price: 0},
+	{Name: "System.Iterator.Next", Pop: 1, Push: 1, Price: 1 << 15},
+	{Name: "System.Iterator.Value", Pop: 1, Push: 1, Price: 1 << 4},
+	{Name: "System.Runtime.Platform", Pop: 0, Push: 1, Price: 1 << 3},
+	{Name: "System.Runtime.GetNetwork", Pop: 0, Push: 1, Price: 1 << 3},
+	{Name: "System.Runtime.GetAddressVersion", Pop: 0, Push: 1, Price: 1 << 3},
+	{Name: "System.Runtime.GetTrigger", Pop: 0, Push: 1, Price: 1 << 3},
+	{Name: "System.Runtime.GetTime", Pop: 0, Push: 1, Price: 1 << 3},
+	{Name: "System.Runtime.GetScriptContainer", Pop: 0, Push: 1, Price: 1 << 3},
+	{Name: "System.Runtime.GetExecutingScriptHash", Pop: 0, Push: 1, Price: 1 << 4},
+	{Name: "System.Runtime.GetCallingScriptHash", Pop: 0, Push: 1, Price: 1 << 4},
+	{Name: "System.Runtime.GetEntryScriptHash", Pop: 0, Push: 1, Price: 1 << 4},
+	{Name: "System.Runtime.LoadScript", Pop: 3, Push: StackVariable, Price: 1 << 15},
+	{Name: "System.Runtime.CheckWitness", Pop: 1, Push: 1, Price: 1 << 10},
+	{Name: "System.Runtime.GetInvocationCounter", Pop: 0, Push: 1, Price: 1 << 4},
+	{Name: "System.Runtime.GetRandom", Pop: 0, Push: 1, Price: 0},
+	{Name: "System.Runtime.Log", Pop: 1, Push: 0, Price: 1 << 15},
+	{Name: "System.Runtime.Notify", Pop: 2, Push: 0, Price: 1 << 15},
+	{Name: "System.Runtime.GetNotifications", Pop: 1, Push: 1, Price: 1 << 12},
+	{Name: "System.Runtime.GasLeft", Pop: 0, Push: 1, Price: 1 << 4},
+	{Name: "System.Runtime.BurnGas", Pop: 1, Push: 0, Price: 1 << 4},
+	{Name: "System.Runtime.CurrentSigners", Pop: 0, Push: 1, Price: 1 << 4},
+	{Name: "System.Storage.GetContext", Pop: 0, Push: 1, Price: 1 << 4},
+	{Name: "System.Storage.GetReadOnlyContext", Pop: 0, Push: 1, Price: 1 << 4},
+	{Name: "System.Storage.AsReadOnly", Pop: 1, Push: 1, Price: 1 << 4},
+	{Name: "System.Storage.Get", Pop: 2, Push: 1, Price: 1 << 15},
+	{Name: "System.Storage.Find", Pop: 3, Push: 1, Price: 1 << 15},
+	{Name: "System.Storage.Put", Pop: 3, Push: 0, Price: 1 << 15},
+	{Name: "System.Storage.Delete", Pop: 2, Push: 0, Price: 1 << 15},
+}
+
+// defaultInterops is the registry of the Neo N3 services
+var defaultInterops = NewInteropRegistry()
+
+// DefaultInteropRegistry returns the registry of the Neo N3 services
+func DefaultInteropRegistry() *InteropRegistry {
+	return defaultInterops
+}
+
+// NewInteropRegistry creates a registry of the Neo N3 services
+func NewInteropRegistry() *InteropRegistry {
+	r := &InteropRegistry{byName: make(map[string]InteropService), byID: make(map[uint32]InteropService)}
+	for _, service := range neoInteropServices {
+		if err := r.Register(service); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// InteropID returns the ID of the interop service name
+func InteropID(name string) uint32 {
+	hash := sha256.Sum256([]byte(name))
+	return binary.LittleEndian.Uint32(hash[:4])
+}
+
+// Register adds a service, such as one a private network provides. The ID
+// is derived from the name.
+func (r *InteropRegistry) Register(service InteropService) error {
+	service.ID = InteropID(service.Name)
+	if _, ok := r.byName[service.Name]; ok {
+		return fmt.Errorf("interop service %s is already registered", service.Name)
+	}
+	if other, ok := r.byID[service.ID]; ok {
+		return fmt.Errorf("interop services %s and %s share the ID %08x", other.Name, service.Name, service.ID)
+	}
+	r.byName[service.Name], r.byID[service.ID] = service, service
+	return nil
+}
+
+// Lookup returns the service named name
+func (r *InteropRegistry) Lookup(name string) (InteropService, bool) {
+	service, ok := r.byName[name]
+	return service, ok
+}
+
+// LookupID returns the service with the given ID
+func (r *InteropRegistry) LookupID(id uint32) (InteropService, bool) {
+	service, ok := r.byID[id]
+	return service, ok
+}
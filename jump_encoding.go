@@ -0,0 +1,104 @@
+package main
+
+// Jump encoding.
+//
+// Jumps, CALL, TRY and ENDTRY address their targets by offsets relative to
+// their own first byte. Each has a short form with 1-byte signed offsets and
+// a long _L form with 4-byte ones; TRY carries two, the catch and the
+// finally offset. Jumps are emitted in the short form and relaxed when
+// labels are resolved: a jump whose distance does not fit the short form,
+// or whose label is not marked yet, becomes long. Growing a jump can push
+// the distances spanning it out of range, so relaxation repeats until no
+// jump changes. Jumps only grow, which bounds the number of rounds.
+
+// longJumps maps the short form of each jump to its long form
+var longJumps = map[NeoOpcode]NeoOpcode{
+	JMP:      JMP_L,
+	JMPIF:    JMPIF_L,
+	JMPIFNOT: JMPIFNOT_L,
+	JMPEQ:    JMPEQ_L,
+	JMPNE:    JMPNE_L,
+	JMPGT:    JMPGT_L,
+	JMPGE:    JMPGE_L,
+	JMPLT:    JMPLT_L,
+	JMPLE:    JMPLE_L,
+	CALL:     CALL_L,
+	TRY:      TRY_L,
+	ENDTRY:   ENDTRY_L,
+}
+
+// isLongJump reports whether op is the long form of a jump
+func isLongJump(op NeoOpcode) bool {
+	for _, long := range longJumps {
+		if op == long {
+			return true
+		}
+	}
+	return false
+}
+
+// isJump reports whether op is a jump in either form
+func isJump(op NeoOpcode) bool {
+	_, short := longJumps[op]
+	return short || isLongJump(op)
+}
+
+// jumpOffsets returns the number of offsets the jump op takes
+func jumpOffsets(op NeoOpcode) int {
+	if op == TRY || op == TRY_L {
+		return 2
+	}
+	return 1
+}
+
+// longJump gives the jump instr its long form, with zero offsets
+func longJump(instr *NeoInstruction) {
+	if long, ok := longJumps[instr.Opcode]; ok {
+		instr.Opcode = long
+	}
+	instr.Operand = make([]byte, opcodeTable[instr.Opcode].OperandSize)
+	instr.Size = 1 + len(instr.Operand)
+}
+
+// encodeJumpOffset writes offset as the index-th offset of the jump instr,
+// little-endian in the width of its form
+func encodeJumpOffset(instr *NeoInstruction, index, offset int) {
+	width := len(instr.Operand) / jumpOffsets(instr.Opcode)
+	for i := 0; i < width; i++ {
+		instr.Operand[index*width+i] = byte(offset >> (8 * i))
+	}
+}
+
+// byteOffsets returns the script offset of each instruction, followed by
+// the size of the script, where labels marking its end point
+func (g *CodeGenerator) byteOffsets() []int {
+	offsets := make([]int, len(g.instructions)+1)
+	for i, instr := range g.instructions {
+		offsets[i+1] = offsets[i] + instr.Size
+	}
+	return offsets
+}
+
+// relaxJumps gives the long form to every pending jump whose label is not
+// marked or too far for the short form, until all short jumps fit
+func (g *CodeGenerator) relaxJumps() {
+	for changed := true; changed; {
+		changed = false
+		offsets := g.byteOffsets()
+		for _, pending := range g.pendingLabels {
+			instr := &g.instructions[pending.InstructionIndex]
+			if _, short := longJumps[instr.Opcode]; !short {
+				continue
+			}
+			target, known := g.labelMap.Get(pending.Name)
+			distance := 0
+			if known {
+				distance = offsets[target] - offsets[pending.InstructionIndex]
+			}
+			if !g.profile().UseShortJump(distance, known) {
+				longJump(instr)
+				changed = true
+			}
+		}
+	}
+}
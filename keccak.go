@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+)
+
+// keccak256 over memory.
+//
+// keccak256(p, n) hashes the memory range [p, p+n) and returns the digest
+// as a word, its first byte most significant. Neo versions whose CryptoLib
+// provides keccak256 hash with it; older targets get a software Keccak-256
+// routine emitted with the script, which computes the same digest with
+// integer operations on 64-bit lanes.
+
+// NativeKeccakVersion is the first Neo version with CryptoLib.keccak256
+var NativeKeccakVersion = SemanticVersion{3, 7, 0}
+
+// TargetVersionFromConfig returns the configured target NeoVM version. The
+// zero version stands for the latest one.
+func TargetVersionFromConfig(config CompilerConfig) (SemanticVersion, error) {
+	if config.TargetNeoVMVersion == "" {
+		return SemanticVersion{}, nil
+	}
+	version, err := ParseSemanticVersion(config.TargetNeoVMVersion)
+	if err != nil {
+		return SemanticVersion{}, fmt.Errorf("target NeoVM version: %w", err)
+	}
+	return version, nil
+}
+
+// nativeKeccak reports whether the target provides CryptoLib.keccak256
+func (g *CodeGenerator) nativeKeccak() bool {
+	if g.context == nil || g.context.TargetVersion == (SemanticVersion{}) {
+		return true
+	}
+	return !g.context.TargetVersion.Less(NativeKeccakVersion)
+}
+
+// generateKeccak emits keccak256 with the offset on top of the length
+func (g *CodeGenerator) generateKeccak(location SourcePosition) {
+	g.emitMemoryCall(memorySlice, 2, 1, location)
+	c := memoryCode{g, location}
+	if g.nativeKeccak() {
+		c.callNative(CryptoLibHash, "keccak256", 1, 0)
+	} else {
+		g.emitMemoryCall(keccakSoftware, 1, 1, location)
+	}
+
+	// Big-endian digest to a word, as in memory_load
+	c.op(NewConvertInstruction(BufferType))
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(REVERSEITEMS)
+	c.op(NewConvertInstruction(IntegerType))
+}
+
+// Keccak-f[1600] parameters
+const (
+	keccakRate   = 136 // Bytes absorbed per block for a 256-bit digest
+	keccakRounds = 24
+)
+
+var keccakRoundConstants = []uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808A, 0x8000000080008000,
+	0x000000000000808B, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008A, 0x0000000000000088, 0x0000000080008009, 0x000000008000000A,
+	0x000000008000808B, 0x800000000000008B, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800A, 0x800000008000000A,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+// keccakRotations[x][y] is the rotation of lane (x, y) in the rho step
+var keccakRotations = [5][5]uint{
+	{0, 36, 3, 41, 18},
+	{1, 44, 10, 45, 2},
+	{62, 6, 43, 15, 61},
+	{28, 55, 25, 21, 56},
+	{27, 20, 39, 8, 14},
+}
+
+// keccak256 hashes data at compile time, as the emitted code does at runtime
+func keccak256(data []byte) []byte {
+	padded := append(append([]byte{}, data...), 0x01)
+	for len(padded)%keccakRate != 0 {
+		padded = append(padded, 0)
+	}
+	padded[len(padded)-1] |= 0x80
+
+	var a [25]uint64
+	for offset := 0; offset < len(padded); offset += keccakRate {
+		for i := 0; i < keccakRate/8; i++ {
+			for j := 0; j < 8; j++ {
+				a[i] ^= uint64(padded[offset+8*i+j]) << (8 * j)
+			}
+		}
+		for round := 0; round < keccakRounds; round++ {
+			var c [5]uint64
+			for x := 0; x < 5; x++ {
+				c[x] = a[x] ^ a[x+5] ^ a[x+10] ^ a[x+15] ^ a[x+20]
+			}
+			for x := 0; x < 5; x++ {
+				d := c[(x+4)%5] ^ bits.RotateLeft64(c[(x+1)%5], 1)
+				for y := 0; y < 5; y++ {
+					a[x+5*y] ^= d
+				}
+			}
+			var b [25]uint64
+			for x := 0; x < 5; x++ {
+				for y := 0; y < 5; y++ {
+					b[y+5*((2*x+3*y)%5)] = bits.RotateLeft64(a[x+5*y], int(keccakRotations[x][y]))
+				}
+			}
+			for y := 0; y < 5; y++ {
+				for x := 0; x < 5; x++ {
+					a[x+5*y] = b[x+5*y] ^ (^b[(x+1)%5+5*y] & b[(x+2)%5+5*y])
+				}
+			}
+			a[0] ^= keccakRoundConstants[round]
+		}
+	}
+
+	digest := make([]byte, 32)
+	for i := range digest {
+		digest[i] = byte(a[i/8] >> (8 * (i % 8)))
+	}
+	return digest
+}
+
+// Locals of the software Keccak routine. Lane (x, y) of the state A and of
+// the rho/pi output B is local x+5y of its block.
+const (
+	keccakA      = 0
+	keccakB      = 25
+	keccakC      = 50
+	keccakD      = 55
+	keccakRound  = 56
+	keccakRC     = 57
+	keccakOffset = 58
+	keccakPadded = 59
+	keccakLocals = 60
+)
+
+// emitKeccakSoftware hashes the byte string argument and returns the 32
+// digest bytes
+func (g *CodeGenerator) emitKeccakSoftware(location SourcePosition) {
+	c := memoryCode{g, location}
+	ld := func(i int) { c.op(NewSlotInstruction(LDLOC, i)) }
+	st := func(i int) { c.op(NewSlotInstruction(STLOC, i)) }
+	laneMask := new(big.Int).SetUint64(^uint64(0))
+	absorb := g.createUniqueLabel("keccak_absorb")
+	permute := g.createUniqueLabel("keccak_round")
+	permuted := g.createUniqueLabel("keccak_round_end")
+	squeeze := g.createUniqueLabel("keccak_squeeze")
+
+	// padded = data ++ 0x01 ++ zeros, with 0x80 or'ed into the last byte,
+	// a whole number of blocks long
+	c.arg(0)
+	c.arithmetic(SIZE)
+	c.push(keccakRate)
+	c.arithmetic(DIV)
+	c.push(1)
+	c.arithmetic(ADD)
+	c.push(keccakRate)
+	c.arithmetic(MUL, NEWBUFFER)
+	st(keccakPadded)
+	ld(keccakPadded)
+	c.push(0)
+	c.arg(0)
+	c.push(0)
+	c.arg(0)
+	c.arithmetic(SIZE, MEMCPY)
+	ld(keccakPadded)
+	c.arg(0)
+	c.arithmetic(SIZE)
+	c.push(1)
+	c.arithmetic(SETITEM)
+	ld(keccakPadded)
+	ld(keccakPadded)
+	c.arithmetic(SIZE)
+	c.push(1)
+	c.arithmetic(SUB)
+	ld(keccakPadded)
+	ld(keccakPadded)
+	c.arithmetic(SIZE)
+	c.push(1)
+	c.arithmetic(SUB, PICKITEM)
+	c.push(0x80)
+	c.arithmetic(OR, SETITEM)
+
+	for i := 0; i < 25; i++ {
+		c.push(0)
+		st(keccakA + i)
+	}
+	for i := keccakRounds - 1; i >= 0; i-- {
+		c.push(new(big.Int).SetUint64(keccakRoundConstants[i]))
+	}
+	c.push(keccakRounds)
+	pack := NewArithmeticInstruction(PACK)
+	pack.StackPop, pack.StackPush = keccakRounds+1, 1
+	c.op(pack)
+	st(keccakRC)
+	c.push(0)
+	st(keccakOffset)
+
+	// Absorb: xor each block into the first 17 lanes, little-endian
+	g.markLabel(absorb)
+	ld(keccakOffset)
+	ld(keccakPadded)
+	c.arithmetic(SIZE, LT)
+	c.jump(JMPIFNOT, squeeze)
+	for i := 0; i < keccakRate/8; i++ {
+		ld(keccakA + i)
+		ld(keccakPadded)
+		ld(keccakOffset)
+		c.push(8 * i)
+		c.arithmetic(ADD)
+		c.push(8)
+		c.arithmetic(SUBSTR)
+		c.op(NewPushInstruction(CreateNeoVMByteString([]byte{0})))
+		c.arithmetic(CAT)
+		c.op(NewConvertInstruction(IntegerType))
+		c.arithmetic(XOR)
+		st(keccakA + i)
+	}
+
+	c.push(0)
+	st(keccakRound)
+	g.markLabel(permute)
+	ld(keccakRound)
+	c.push(keccakRounds)
+	c.arithmetic(LT)
+	c.jump(JMPIFNOT, permuted)
+
+	// rotate pushes the lane in local i rotated left by n bits
+	rotate := func(i int, n uint) {
+		ld(i)
+		if n == 0 {
+			return
+		}
+		c.push(int(n))
+		c.arithmetic(SHL)
+		ld(i)
+		c.push(int(64 - n))
+		c.arithmetic(SHR, OR)
+		c.push(laneMask)
+		c.arithmetic(AND)
+	}
+
+	// Theta
+	for x := 0; x < 5; x++ {
+		ld(keccakA + x)
+		for y := 1; y < 5; y++ {
+			ld(keccakA + x + 5*y)
+			c.arithmetic(XOR)
+		}
+		st(keccakC + x)
+	}
+	for x := 0; x < 5; x++ {
+		ld(keccakC + (x+4)%5)
+		rotate(keccakC+(x+1)%5, 1)
+		c.arithmetic(XOR)
+		st(keccakD)
+		for y := 0; y < 5; y++ {
+			ld(keccakA + x + 5*y)
+			ld(keccakD)
+			c.arithmetic(XOR)
+			st(keccakA + x + 5*y)
+		}
+	}
+
+	// Rho and pi
+	for x := 0; x < 5; x++ {
+		for y := 0; y < 5; y++ {
+			rotate(keccakA+x+5*y, keccakRotations[x][y])
+			st(keccakB + y + 5*((2*x+3*y)%5))
+		}
+	}
+
+	// Chi
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			ld(keccakB + x + 5*y)
+			ld(keccakB + (x+1)%5 + 5*y)
+			c.push(laneMask)
+			c.arithmetic(XOR)
+			ld(keccakB + (x+2)%5 + 5*y)
+			c.arithmetic(AND, XOR)
+			st(keccakA + x + 5*y)
+		}
+	}
+
+	// Iota
+	ld(keccakA)
+	ld(keccakRC)
+	ld(keccakRound)
+	c.arithmetic(PICKITEM, XOR)
+	st(keccakA)
+
+	ld(keccakRound)
+	c.push(1)
+	c.arithmetic(ADD)
+	st(keccakRound)
+	c.jump(JMP, permute)
+
+	g.markLabel(permuted)
+	ld(keccakOffset)
+	c.push(keccakRate)
+	c.arithmetic(ADD)
+	st(keccakOffset)
+	c.jump(JMP, absorb)
+
+	// Squeeze: the digest is the first four lanes, little-endian. Adding
+	// 2^64 makes each lane encode to exactly 9 bytes.
+	g.markLabel(squeeze)
+	for i := 0; i < 4; i++ {
+		ld(keccakA + i)
+		c.push(new(big.Int).Lsh(big.NewInt(1), 64))
+		c.arithmetic(ADD)
+		c.op(NewConvertInstruction(ByteStringType))
+		c.push(8)
+		c.arithmetic(LEFT)
+		if i > 0 {
+			c.arithmetic(CAT)
+		}
+	}
+}
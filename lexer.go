@@ -3,23 +3,49 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
-// YulLexer tokenizes Yul source code into tokens for parsing
+// YulLexer tokenizes Yul source code into tokens for parsing.
+//
+// A lexer initialized with Init scans a string held in memory. One
+// initialized with InitReader streams its source: it reads the reader in
+// chunks as tokens are asked for and only keeps the bytes of the current
+// token and line, so memory does not grow with the size of the source.
+// Offsets are counted from the start of the source either way.
 type YulLexer struct {
-	source   string
-	tokens   []Token
-	start    int
-	current  int
-	line     int
-	column   int
-	keywords map[string]TokenType
+	source      string
+	tokens      []Token // Tokens scanned by the last call to scanToken
+	start       int
+	current     int
+	line        int
+	column      int
+	startLine   int // Line at which the current token begins
+	startColumn int // Column at which the current token begins
+	keywords    map[string]TokenType
+
+	reader    io.Reader // Source of a streaming lexer, nil when scanning a string
+	window    []byte    // Bytes read from reader, from offset base on
+	base      int
+	readErr   error               // First error of reader, io.EOF at its end
+	lineStart int                 // Offset of the current line
+	lines     [streamLines]string // Last lines read by a streaming lexer, by line number
+
+	dialect *Dialect // Builtins classified by category, nil for all
+
+	suppressions []Suppression // yul-disable-next-line comments scanned, without a file
 }
 
+const (
+	streamChunk = 4096 // Bytes a streaming lexer reads at a time
+	streamLines = 16   // Lines a streaming lexer keeps for error snippets
+)
+
 // Token represents a lexical token in Yul source code
 type Token struct {
 	Type     TokenType     `json:"type"`
@@ -29,12 +55,17 @@ type Token struct {
 	Position TokenPosition `json:"position"`
 }
 
-// TokenPosition represents the position of a token in source code
+// TokenPosition represents the position of a token in source code.
+// Line and Column mark the first character of the token; EndLine and
+// EndColumn mark the position just past its last character, so tokens
+// spanning several lines (strings) report both ends correctly.
 type TokenPosition struct {
-	Line   int `json:"line"`
-	Column int `json:"column"`
-	Offset int `json:"offset"`
-	Length int `json:"length"`
+	Line      int `json:"line"`
+	Column    int `json:"column"`
+	EndLine   int `json:"end_line"`
+	EndColumn int `json:"end_column"`
+	Offset    int `json:"offset"`
+	Length    int `json:"length"`
 }
 
 // TokenType represents different types of tokens in Yul
@@ -59,6 +90,7 @@ const (
 	TokenString        TokenType = "STRING"
 	TokenNumber        TokenType = "NUMBER"
 	TokenHex           TokenType = "HEX"
+	TokenHexString     TokenType = "HEX_STRING" // hex"..." with the digits as lexeme
 	TokenTrue          TokenType = "true"
 	TokenFalse         TokenType = "false"
 
@@ -111,7 +143,7 @@ var (
 	}
 
 	storageOps = map[string]bool{
-		"sload": true, "sstore": true,
+		"sload": true, "sstore": true, "tload": true, "tstore": true,
 	}
 
 	environmentOps = map[string]bool{
@@ -164,70 +196,140 @@ func (l *YulLexer) Init(source string) error {
 		return errors.New("empty source code")
 	}
 
+	l.reset()
 	l.source = source
+	return nil
+}
+
+// InitReader initializes the lexer to stream the source read from r
+func (l *YulLexer) InitReader(r io.Reader) error {
+	if r == nil {
+		return errors.New("nil source reader")
+	}
+	l.reset()
+	l.reader = r
+	return nil
+}
+
+// reset clears the state of a previous source
+func (l *YulLexer) reset() {
+	l.source = ""
 	l.tokens = []Token{}
 	l.start = 0
 	l.current = 0
 	l.line = 1
 	l.column = 1
-
-	return nil
+	l.startLine = 1
+	l.startColumn = 1
+	l.reader = nil
+	l.window = nil
+	l.base = 0
+	l.readErr = nil
+	l.lineStart = 0
+	l.suppressions = nil
 }
 
 // ScanTokens scans the entire source and returns all tokens
 func (l *YulLexer) ScanTokens() ([]Token, error) {
-	if l.source == "" {
-		return nil, errors.New("lexer not initialized")
+	tokens := []Token{}
+	for {
+		token, err := l.Next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+		if token.Type == TokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+// Next scans the next token of the source. At the end of the source it
+// returns EOF, again on every call.
+func (l *YulLexer) Next() (Token, error) {
+	if l.source == "" && l.reader == nil {
+		return Token{}, errors.New("lexer not initialized")
 	}
 
-	for !l.isAtEnd() {
+	l.tokens = l.tokens[:0]
+	for len(l.tokens) == 0 {
+		if l.isAtEnd() {
+			if l.readErr != nil && l.readErr != io.EOF {
+				return Token{}, fmt.Errorf("reading source: %w", l.readErr)
+			}
+			if l.current == 0 {
+				return Token{}, errors.New("empty source code")
+			}
+			return l.eofToken(), nil
+		}
 		l.start = l.current
-		err := l.scanToken()
-		if err != nil {
-			return nil, err
+		l.startLine = l.line
+		l.startColumn = l.column
+		if err := l.scanToken(); err != nil {
+			return Token{}, err
+		}
+	}
+	return l.tokens[0], nil
+}
+
+// NextToken returns the next token from the source, or an ERROR token
+// holding the message of a lexical error
+func (l *YulLexer) NextToken() Token {
+	token, err := l.Next()
+	if err != nil {
+		return Token{
+			Type:   TokenError,
+			Lexeme: err.Error(),
+			Line:   l.startLine,
+			Column: l.startColumn,
+			Position: TokenPosition{
+				Line:      l.startLine,
+				Column:    l.startColumn,
+				EndLine:   l.line,
+				EndColumn: l.column,
+				Offset:    l.start,
+				Length:    l.current - l.start,
+			},
 		}
 	}
+	return token
+}
 
-	l.tokens = append(l.tokens, Token{
+// eofToken returns the EOF token at the current position
+func (l *YulLexer) eofToken() Token {
+	return Token{
 		Type:   TokenEOF,
 		Lexeme: "",
 		Line:   l.line,
 		Column: l.column,
 		Position: TokenPosition{
-			Line:   l.line,
-			Column: l.column,
-			Offset: l.current,
-			Length: 0,
+			Line:      l.line,
+			Column:    l.column,
+			EndLine:   l.line,
+			EndColumn: l.column,
+			Offset:    l.current,
+			Length:    0,
 		},
-	})
-
-	return l.tokens, nil
+	}
 }
 
-// NextToken returns the next token from the source
-func (l *YulLexer) NextToken() Token {
-	if l.current >= len(l.tokens) {
-		if len(l.tokens) > 0 {
-			return l.tokens[len(l.tokens)-1] // Return EOF
-		}
-		// Generate EOF token
-		return Token{
-			Type:   TokenEOF,
-			Lexeme: "",
-			Line:   l.line,
-			Column: l.column,
-			Position: TokenPosition{
-				Line:   l.line,
-				Column: l.column,
-				Offset: len(l.source),
-				Length: 0,
-			},
+// Snippet returns the given line of the source with a caret marking
+// column. A streaming lexer only knows the last lines it has read.
+func (l *YulLexer) Snippet(line, column int) string {
+	if l.reader == nil {
+		return sourceSnippet(l.source, line, column)
+	}
+	switch {
+	case line == l.line:
+		end := l.current
+		for c, ok := l.at(end); ok && c != '\n'; c, ok = l.at(end) {
+			end++
 		}
+		return markColumn(l.slice(l.lineStart, end), column)
+	case line >= 1 && line < l.line && l.line-line < streamLines:
+		return markColumn(l.lines[line%streamLines], column)
 	}
-
-	token := l.tokens[l.current]
-	l.current++
-	return token
+	return ""
 }
 
 // scanToken scans a single token from the source
@@ -257,13 +359,10 @@ func (l *YulLexer) scanToken() error {
 		if l.match('>') {
 			l.addToken(TokenArrow)
 		} else {
-			return fmt.Errorf("unexpected character '-' at line %d, column %d", l.line, l.column-1)
+			return fmt.Errorf("unexpected character '-' at line %d, column %d", l.startLine, l.startColumn)
 		}
-	case ' ', '\r', '\t':
-		// Ignore whitespace
-	case '\n':
-		l.line++
-		l.column = 0 // Will be incremented in advance()
+	case ' ', '\r', '\t', '\n':
+		// Ignore whitespace; advance() tracks line breaks
 	case '/':
 		if l.match('/') {
 			// Line comment
@@ -275,7 +374,7 @@ func (l *YulLexer) scanToken() error {
 				return err
 			}
 		} else {
-			return fmt.Errorf("unexpected character '/' at line %d, column %d", l.line, l.column-1)
+			return fmt.Errorf("unexpected character '/' at line %d, column %d", l.startLine, l.startColumn)
 		}
 	case '"':
 		err := l.scanString()
@@ -302,36 +401,118 @@ func (l *YulLexer) scanToken() error {
 				return err
 			}
 		} else if l.isAlpha(c) {
-			l.scanIdentifier()
+			return l.scanIdentifier()
+		} else if r, size := l.runeAt(l.start); c >= utf8.RuneSelf && unicode.IsLetter(r) {
+			for i := 1; i < size; i++ {
+				l.advance()
+			}
+			return l.scanIdentifier()
 		} else {
-			return fmt.Errorf("unexpected character '%c' at line %d, column %d", c, l.line, l.column-1)
+			return fmt.Errorf("unexpected character %q at line %d, column %d", r, l.startLine, l.startColumn)
 		}
 	}
 
 	return nil
 }
 
-// scanString scans a string literal
+// scanString scans a string literal. The lexeme is its value, with escape
+// sequences decoded.
 func (l *YulLexer) scanString() error {
+	var value strings.Builder
 	for l.peek() != '"' && !l.isAtEnd() {
-		if l.peek() == '\n' {
-			l.line++
-			l.column = 0
+		if l.peek() != '\\' {
+			value.WriteByte(l.advance())
+			continue
+		}
+		if err := l.scanEscape(&value); err != nil {
+			return err
 		}
-		l.advance()
 	}
 
 	if l.isAtEnd() {
-		return fmt.Errorf("unterminated string at line %d", l.line)
+		return fmt.Errorf("unterminated string starting at line %d, column %d", l.startLine, l.startColumn)
 	}
 
 	// Consume closing "
 	l.advance()
 
-	// Get string value (without quotes)
-	value := l.source[l.start+1 : l.current-1]
-	l.addTokenWithLiteral(TokenString, value)
+	l.addTokenWithLiteral(TokenString, value.String())
+	return nil
+}
 
+// scanEscape decodes the escape sequence at the current backslash into
+// value. The sequences are those of Solidity: \\, \", \', \n, \r, \t,
+// \xNN for a byte, \uNNNN for a UTF-8 encoded code point, and a backslash
+// before a line break, which continues the string on the next line.
+func (l *YulLexer) scanEscape(value *strings.Builder) error {
+	line, column := l.line, l.column
+	l.advance() // consume the backslash
+	if l.isAtEnd() {
+		return nil // Reported as an unterminated string
+	}
+	c := l.advance()
+	switch c {
+	case '\\', '"', '\'':
+		value.WriteByte(c)
+	case 'n':
+		value.WriteByte('\n')
+	case 'r':
+		value.WriteByte('\r')
+	case 't':
+		value.WriteByte('\t')
+	case '\n':
+	case 'x', 'u':
+		digits := 2
+		if c == 'u' {
+			digits = 4
+		}
+		code := 0
+		for i := 0; i < digits; i++ {
+			d := l.peek()
+			if !l.isHexDigit(d) {
+				return fmt.Errorf("invalid escape sequence '\\%c' at line %d, column %d: expected %d hex digits", c, line, column, digits)
+			}
+			l.advance()
+			n, _ := strconv.ParseUint(string(d), 16, 8)
+			code = code<<4 | int(n)
+		}
+		if c == 'x' {
+			value.WriteByte(byte(code))
+		} else {
+			value.WriteRune(rune(code))
+		}
+	default:
+		return fmt.Errorf("invalid escape sequence '\\%c' at line %d, column %d", c, line, column)
+	}
+	return nil
+}
+
+// scanHexString scans the quoted digits of a hex string literal, whose
+// "hex" prefix has been consumed. An underscore may separate two bytes.
+func (l *YulLexer) scanHexString() error {
+	quote := l.advance()
+	var digits strings.Builder
+	for l.peek() != quote && !l.isAtEnd() {
+		line, column := l.line, l.column
+		c := l.advance()
+		if c == '_' && digits.Len() > 0 && digits.Len()%2 == 0 && l.isHexDigit(l.peek()) {
+			continue
+		}
+		if !l.isHexDigit(c) {
+			return fmt.Errorf("invalid character %q in hex string at line %d, column %d", c, line, column)
+		}
+		digits.WriteByte(c)
+	}
+
+	if l.isAtEnd() {
+		return fmt.Errorf("unterminated hex string starting at line %d, column %d", l.startLine, l.startColumn)
+	}
+	l.advance() // consume closing quote
+
+	if digits.Len()%2 != 0 {
+		return fmt.Errorf("hex string at line %d, column %d has an odd number of digits", l.startLine, l.startColumn)
+	}
+	l.addTokenWithLiteral(TokenHexString, digits.String())
 	return nil
 }
 
@@ -342,7 +523,7 @@ func (l *YulLexer) scanNumber() error {
 	}
 
 	// Validate number format
-	value := l.source[l.start:l.current]
+	value := l.slice(l.start, l.current)
 	_, err := strconv.ParseUint(value, 10, 64)
 	if err != nil {
 		// Try parsing as big integer (Yul supports arbitrary precision)
@@ -366,7 +547,7 @@ func (l *YulLexer) scanHexNumber() error {
 	}
 
 	// Get hex value including '0x' prefix
-	value := l.source[l.start:l.current]
+	value := l.slice(l.start, l.current)
 	
 	// Validate hex format
 	if !l.isValidHex(value) {
@@ -377,22 +558,40 @@ func (l *YulLexer) scanHexNumber() error {
 	return nil
 }
 
-// scanIdentifier scans identifiers and keywords
-func (l *YulLexer) scanIdentifier() {
-	for l.isAlphaNumeric(l.peek()) {
-		l.advance()
+// scanIdentifier scans identifiers, keywords and hex string literals.
+// Identifiers may hold Unicode letters and digits.
+func (l *YulLexer) scanIdentifier() error {
+	for {
+		if c := l.peek(); l.isAlphaNumeric(c) {
+			l.advance()
+			continue
+		} else if c < utf8.RuneSelf {
+			break
+		}
+		r, size := l.runeAt(l.current)
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		for i := 0; i < size; i++ {
+			l.advance()
+		}
 	}
 
-	text := l.source[l.start:l.current]
+	text := l.slice(l.start, l.current)
+	if text == "hex" && (l.peek() == '"' || l.peek() == '\'') {
+		return l.scanHexString()
+	}
 	
 	// Check if it's a keyword
 	if tokenType, exists := l.keywords[text]; exists {
 		l.addToken(tokenType)
-		return
+		return nil
 	}
 
 	// Check if it's a built-in function and categorize
-	if arithmeticOps[text] {
+	if l.dialect != nil && !l.dialect.IsBuiltin(text) {
+		l.addToken(TokenIdentifier)
+	} else if arithmeticOps[text] {
 		l.addTokenWithLiteral(TokenArithmetic, text)
 	} else if memoryOps[text] {
 		l.addTokenWithLiteral(TokenMemory, text)
@@ -406,6 +605,7 @@ func (l *YulLexer) scanIdentifier() {
 		// Regular identifier
 		l.addToken(TokenIdentifier)
 	}
+	return nil
 }
 
 // scanLineComment scans line comments
@@ -413,7 +613,10 @@ func (l *YulLexer) scanLineComment() {
 	for l.peek() != '\n' && !l.isAtEnd() {
 		l.advance()
 	}
-	// Comments are ignored in this implementation
+	// Comments are ignored, but for those suppressing diagnostics
+	if names, ok := parseSuppression(l.slice(l.start+2, l.current)); ok {
+		l.suppressions = append(l.suppressions, Suppression{Line: l.startLine + 1, Names: names})
+	}
 }
 
 // scanBlockComment scans block comments
@@ -430,16 +633,12 @@ func (l *YulLexer) scanBlockComment() error {
 			l.advance() // consume '*'
 			l.advance() // consume '/'
 		} else {
-			if l.peek() == '\n' {
-				l.line++
-				l.column = 0
-			}
 			l.advance()
 		}
 	}
 
 	if nesting > 0 {
-		return fmt.Errorf("unterminated block comment at line %d", l.line)
+		return fmt.Errorf("unterminated block comment starting at line %d, column %d", l.startLine, l.startColumn)
 	}
 
 	return nil
@@ -447,24 +646,96 @@ func (l *YulLexer) scanBlockComment() error {
 
 // Utility methods
 func (l *YulLexer) isAtEnd() bool {
-	return l.current >= len(l.source)
+	if l.reader == nil {
+		return l.current >= len(l.source)
+	}
+	_, ok := l.at(l.current)
+	return !ok
+}
+
+// at returns the byte at offset
+func (l *YulLexer) at(offset int) (byte, bool) {
+	if l.reader != nil {
+		return l.streamAt(offset)
+	}
+	if offset < len(l.source) {
+		return l.source[offset], true
+	}
+	return 0, false
 }
 
+// streamAt returns the byte at offset of a streamed source, reading more
+// of it when offset is past the window
+func (l *YulLexer) streamAt(offset int) (byte, bool) {
+	for offset-l.base >= len(l.window) {
+		if !l.fill() {
+			return 0, false
+		}
+	}
+	return l.window[offset-l.base], true
+}
+
+// slice returns the source between two offsets
+func (l *YulLexer) slice(from, to int) string {
+	if l.reader == nil {
+		return l.source[from:to]
+	}
+	return string(l.window[from-l.base : to-l.base])
+}
+
+// fill reads the next chunk of a streamed source into the window, first
+// dropping the bytes before both the current token and the current line
+func (l *YulLexer) fill() bool {
+	if l.readErr != nil {
+		return false
+	}
+	keep := l.start
+	if l.lineStart < keep {
+		keep = l.lineStart
+	}
+	if drop := keep - l.base; drop > 0 {
+		l.window = append(l.window[:0], l.window[drop:]...)
+		l.base = keep
+	}
+	if cap(l.window)-len(l.window) < streamChunk {
+		window := make([]byte, len(l.window), 2*cap(l.window)+streamChunk)
+		copy(window, l.window)
+		l.window = window
+	}
+	n, err := l.reader.Read(l.window[len(l.window):cap(l.window)])
+	l.window = l.window[:len(l.window)+n]
+	if err != nil {
+		l.readErr = err
+	}
+	return n > 0 || err == nil
+}
+
+// advance consumes one byte and keeps line/column pointing at the next
+// unconsumed character, so line breaks inside strings and block comments
+// are accounted for in one place.
 func (l *YulLexer) advance() byte {
 	if l.isAtEnd() {
 		return 0
 	}
-	l.column++
-	char := l.source[l.current]
+	char, _ := l.at(l.current)
 	l.current++
+	if char == '\n' {
+		if l.reader != nil {
+			l.lines[l.line%streamLines] = l.slice(l.lineStart, l.current-1)
+			l.lineStart = l.current
+		}
+		l.line++
+		l.column = 1
+	} else if !utf8.RuneStart(char) {
+		// Columns count characters: continuation bytes do not start one
+	} else {
+		l.column++
+	}
 	return char
 }
 
 func (l *YulLexer) match(expected byte) bool {
-	if l.isAtEnd() {
-		return false
-	}
-	if l.source[l.current] != expected {
+	if c, ok := l.at(l.current); !ok || c != expected {
 		return false
 	}
 	l.current++
@@ -473,29 +744,42 @@ func (l *YulLexer) match(expected byte) bool {
 }
 
 func (l *YulLexer) peek() byte {
-	if l.isAtEnd() {
-		return 0
-	}
-	return l.source[l.current]
+	c, _ := l.at(l.current)
+	return c
 }
 
 func (l *YulLexer) peekNext() byte {
-	if l.current+1 >= len(l.source) {
-		return 0
+	c, _ := l.at(l.current + 1)
+	return c
+}
+
+// runeAt decodes the character at offset
+func (l *YulLexer) runeAt(offset int) (rune, int) {
+	var buf [utf8.UTFMax]byte
+	n := 0
+	for ; n < len(buf); n++ {
+		c, ok := l.at(offset + n)
+		if !ok {
+			break
+		}
+		buf[n] = c
 	}
-	return l.source[l.current+1]
+	return utf8.DecodeRune(buf[:n])
 }
 
 func (l *YulLexer) isDigit(c byte) bool {
 	return c >= '0' && c <= '9'
 }
 
+// isAlpha reports whether c may start an identifier; solc's IR names
+// variables of inline assembly usr$x
 func (l *YulLexer) isAlpha(c byte) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '$'
 }
 
+// isAlphaNumeric reports whether c may continue an identifier
 func (l *YulLexer) isAlphaNumeric(c byte) bool {
-	return l.isAlpha(c) || l.isDigit(c)
+	return l.isAlpha(c) || l.isDigit(c) || c == '.'
 }
 
 func (l *YulLexer) isHexDigit(c byte) bool {
@@ -527,25 +811,25 @@ func (l *YulLexer) isValidHex(s string) bool {
 }
 
 func (l *YulLexer) addToken(tokenType TokenType) {
-	l.addTokenWithLiteral(tokenType, "")
+	l.addTokenWithLiteral(tokenType, l.slice(l.start, l.current))
 }
 
+// addTokenWithLiteral adds a token whose lexeme is literal rather than the
+// source text, e.g. the value of a string
 func (l *YulLexer) addTokenWithLiteral(tokenType TokenType, literal string) {
-	text := l.source[l.start:l.current]
-	if literal == "" {
-		literal = text
-	}
 
 	token := Token{
 		Type:   tokenType,
 		Lexeme: literal,
-		Line:   l.line,
-		Column: l.column - (l.current - l.start),
+		Line:   l.startLine,
+		Column: l.startColumn,
 		Position: TokenPosition{
-			Line:   l.line,
-			Column: l.column - (l.current - l.start),
-			Offset: l.start,
-			Length: l.current - l.start,
+			Line:      l.startLine,
+			Column:    l.startColumn,
+			EndLine:   l.line,
+			EndColumn: l.column,
+			Offset:    l.start,
+			Length:    l.current - l.start,
 		},
 	}
 
@@ -583,6 +867,8 @@ func GetTokenInfo(tokenType TokenType) TokenInfo {
 		return TokenInfo{tokenType, "Number literal", "Literal", 0}
 	case TokenHex:
 		return TokenInfo{tokenType, "Hexadecimal literal", "Literal", 0}
+	case TokenHexString:
+		return TokenInfo{tokenType, "Hex string literal", "Literal", 0}
 	case TokenArithmetic:
 		return TokenInfo{tokenType, "Arithmetic built-in", "Built-in", 10}
 	case TokenMemory:
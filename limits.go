@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NeoVM limits.
+//
+// A node refuses to deploy a contract whose script is too large, and
+// faults one that pushes an item larger than MaxItemSize or holds more
+// than MaxStackSize items. The limits check runs on the generated script
+// after code generation so that such a contract fails compilation instead,
+// with the instruction and source line at fault and what to change.
+//
+// The stack bound of a frame is the deepest evaluation stack the code
+// generator tracked plus the largest slot frame, since NeoVM counts the
+// items held in slots against the same limit.
+
+// NeoVMLimits are the NeoVM 3 limits a script is checked against
+type NeoVMLimits struct {
+	MaxScriptSize int // Bytes of the script
+	MaxStackSize  int // Stack items of a frame, its slots included
+	MaxItemSize   int // Bytes of an item pushed by PUSHDATA
+}
+
+// DefaultNeoVMLimits returns the limits of ExecutionEngineLimits.Default
+// and of a NEF script
+func DefaultNeoVMLimits() NeoVMLimits {
+	return NeoVMLimits{
+		MaxScriptSize: MaxNEFScriptSize,
+		MaxStackSize:  NeoVMMaxStackSize,
+		MaxItemSize:   NeoMaxItemSize,
+	}
+}
+
+// limitsFromContext returns the default limits narrowed by the script size
+// of the optimization profile and the configured stack depth
+func limitsFromContext(context *CompilerContext) NeoVMLimits {
+	limits := DefaultNeoVMLimits()
+	if context == nil {
+		return limits
+	}
+	if context.Profile != nil && context.Profile.MaxScriptSize > 0 {
+		limits.MaxScriptSize = context.Profile.MaxScriptSize
+	}
+	if context.MaxStackDepth > 0 && context.MaxStackDepth < limits.MaxStackSize {
+		limits.MaxStackSize = context.MaxStackDepth
+	}
+	return limits
+}
+
+// LimitViolation is a limit a script exceeds
+type LimitViolation struct {
+	Limit       string         // e.g. "script size"
+	Instruction int            // Index of the offending instruction, -1 for the whole script
+	Position    SourcePosition // Source of the instruction, zero when unknown
+	Message     string
+	Suggestion  string
+}
+
+func (v LimitViolation) String() string {
+	message := v.Message
+	if v.Position.Line > 0 {
+		message += fmt.Sprintf(" at line %d, column %d", v.Position.Line, v.Position.Column)
+	}
+	return message + "; " + v.Suggestion
+}
+
+// LimitsError lists the limits a script exceeds
+type LimitsError struct {
+	Violations []LimitViolation
+}
+
+func (e *LimitsError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.String()
+	}
+	return "script exceeds NeoVM limits: " + strings.Join(messages, "; ")
+}
+
+// CheckNeoVMLimits checks instructions and the stack usage recorded while
+// generating them against limits
+func CheckNeoVMLimits(instructions []NeoInstruction, stack StackUsage, limits NeoVMLimits) error {
+	var violations []LimitViolation
+	at := func(index int, violation LimitViolation) {
+		violation.Instruction = index
+		if ref := instructions[index].SourceRef; ref != nil {
+			violation.Position = *ref
+		}
+		violations = append(violations, violation)
+	}
+
+	size, slots := 0, 0
+	for i, instr := range instructions {
+		size += instr.Size
+		switch instr.Opcode {
+		case PUSHDATA1, PUSHDATA2, PUSHDATA4:
+			if n := len(instr.Operand); n > limits.MaxItemSize {
+				at(i, LimitViolation{
+					Limit:      "item size",
+					Message:    fmt.Sprintf("%s pushes %d bytes, NeoVM allows %d per item", OpcodeMnemonic(instr.Opcode), n, limits.MaxItemSize),
+					Suggestion: "keep large data in contract storage or split it into smaller data segments",
+				})
+			}
+		case INITSLOT:
+			if len(instr.Operand) == 2 && int(instr.Operand[0])+int(instr.Operand[1]) > slots {
+				slots = int(instr.Operand[0]) + int(instr.Operand[1])
+			}
+		case INITSSLOT:
+			if len(instr.Operand) == 1 && int(instr.Operand[0]) > slots {
+				slots = int(instr.Operand[0])
+			}
+		}
+	}
+
+	if size > limits.MaxScriptSize {
+		violations = append(violations, LimitViolation{
+			Limit:       "script size",
+			Instruction: -1,
+			Message:     fmt.Sprintf("script is %d bytes, NeoVM allows %d", size, limits.MaxScriptSize),
+			Suggestion:  "compile with " + optimizeForFlag + "=size or split the contract into several contracts",
+		})
+	}
+	if items := stack.MaxDepth + slots; items > limits.MaxStackSize {
+		violations = append(violations, LimitViolation{
+			Limit:       "stack size",
+			Instruction: -1,
+			Message:     fmt.Sprintf("a frame may hold %d stack items (%d on the stack, %d in slots), NeoVM allows %d", items, stack.MaxDepth, slots, limits.MaxStackSize),
+			Suggestion:  "split deeply nested expressions and functions with many variables",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &LimitsError{Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Library linking.
+//
+// linkersymbol("name") of a library that is not configured compiles to a
+// placeholder: a push of 20 zero bytes recording the name, which the
+// optimizer leaves alone and whose size does not change when it is
+// patched. Link resolves the placeholders of a contract with the script
+// hashes of its libraries once they are known, at link or deploy time,
+// pushing the address word of each hash, the hash as a number. Libraries
+// linked this way are called dynamically, since the method tokens of a
+// contract are fixed when it is compiled, and address registries are not
+// consulted; configure a library at compile time for either. A contract
+// with placeholders left cannot be encoded as a NEF.
+
+// Uint160 is a script hash, in the order it is displayed
+type Uint160 [20]byte
+
+// ParseUint160 parses a displayed script hash, with or without "0x"
+func ParseUint160(value string) (Uint160, error) {
+	var u Uint160
+	hash, ok := parseScriptHash(value)
+	if !ok {
+		return u, fmt.Errorf("%q is not a script hash", strings.TrimSpace(value))
+	}
+	word, _ := new(big.Int).SetString(hash[2:], 16)
+	word.FillBytes(u[:])
+	return u, nil
+}
+
+// String returns the displayed hash, "0x" and 40 hex digits
+func (u Uint160) String() string {
+	return fmt.Sprintf("0x%x", u[:])
+}
+
+// NewLinkPlaceholder pushes the address of library name once linked
+func NewLinkPlaceholder(name string) NeoInstruction {
+	return NeoInstruction{
+		Opcode:    PUSHDATA1,
+		Operand:   make([]byte, len(Uint160{})),
+		Size:      2 + len(Uint160{}),
+		StackPush: 1,
+		GasCost:   opcodeTable[PUSHDATA1].Price,
+		Comment:   fmt.Sprintf("linkersymbol %s", name),
+		Link:      name,
+	}
+}
+
+// UnlinkedLibraries returns the libraries the placeholders of the contract
+// name, sorted
+func (c *NeoContract) UnlinkedLibraries() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, code := range [][]NeoInstruction{c.Runtime, c.Constructor} {
+		for _, instr := range code {
+			if instr.Link != "" && !seen[instr.Link] {
+				seen[instr.Link] = true
+				names = append(names, instr.Link)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Link resolves the placeholders of contract with the hashes of
+// libraries. Unless every library the placeholders name has a hash, it
+// fails without changing the contract.
+func Link(contract *NeoContract, libraries map[string]Uint160) error {
+	if contract == nil {
+		return fmt.Errorf("no contract to link")
+	}
+	var missing []string
+	for _, name := range contract.UnlinkedLibraries() {
+		if _, ok := libraries[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("unresolved library symbols: %s", strings.Join(missing, ", "))
+	}
+
+	linked := make(map[string]bool)
+	for _, code := range [][]NeoInstruction{contract.Runtime, contract.Constructor} {
+		for i := range code {
+			name := code[i].Link
+			if name == "" {
+				continue
+			}
+			hash := libraries[name]
+			code[i].Operand, code[i].Link = append([]byte{}, hash[:]...), ""
+			if !linked[name] && contract.Metadata != nil {
+				contract.Metadata.Libraries = append(contract.Metadata.Libraries, LibraryInfo{Name: name, Hash: hash.String()})
+			}
+			linked[name] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1013 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Language server.
+//
+// LanguageServer serves Yul documents to editors over the Language Server
+// Protocol, JSON-RPC 2.0 framed like the Debug Adapter Protocol. Every
+// version of an open document is compiled and the errors and warnings of
+// the compilation are published as its diagnostics, so an editor shows
+// what the compile command reports while the source is typed.
+//
+// Navigation works on a YulSourceIndex of the last version that parsed.
+// The index resolves every name the way code generation does, with a
+// SymbolTable per function for variables and one per block for the
+// functions it defines: go to definition jumps to the declaration of a
+// variable or function, hover shows declarations and the signature of a
+// builtin with the gas its code costs, and document symbols list the
+// objects, data, functions and variables of the document. The gas of a
+// builtin is estimated by compiling a call of it with the configuration of
+// the session, and the gas of a function is that of its last compilation.
+//
+// The lsp command serves standard input and output. The
+// initializationOptions of the initialize request configure the
+// compilation:
+//
+//	{"optimizationLevel": 2, "dialect": "cancun", "exports": ["transfer"]}
+
+// YulReference is an occurrence of a name in Yul source
+type YulReference struct {
+	Name    string
+	Range   DiagnosticRange
+	Symbol  *Symbol // Declaration, nil for builtins and undefined names
+	Builtin bool
+}
+
+// YulDocumentSymbol is a named definition of a document
+type YulDocumentSymbol struct {
+	Name      string
+	Kind      string // "object", "data", "function" or "variable"
+	Detail    string
+	Range     DiagnosticRange // From the keyword to the end of the definition
+	Selection DiagnosticRange // The name
+	Children  []YulDocumentSymbol
+}
+
+// YulSourceIndex holds the names of a parsed source and what they refer to
+type YulSourceIndex struct {
+	References []YulReference // In source order, declarations included
+	Symbols    []YulDocumentSymbol
+	details    map[*Symbol]string // Declarations as hovers show them
+}
+
+// yulIndexer resolves the names of an AST into an index
+type yulIndexer struct {
+	*yulTokens
+	index     *YulSourceIndex
+	dialect   *Dialect
+	variables *SymbolTable
+	functions *SymbolTable
+}
+
+// IndexYul parses source in dialect, every builtin when nil, and resolves
+// its names
+func IndexYul(source string, dialect *Dialect) (*YulSourceIndex, error) {
+	parser := NewYulParser()
+	if dialect != nil {
+		parser.SetDialect(dialect)
+	}
+	ast, err := parser.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := scanYulTokens(source, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &yulIndexer{
+		yulTokens: tokens,
+		index:     &YulSourceIndex{details: make(map[*Symbol]string)},
+		dialect:   dialect,
+	}
+	for _, obj := range ast.Objects {
+		x.index.Symbols = append(x.index.Symbols, x.object(obj))
+	}
+	if len(ast.Functions) > 0 {
+		x.variables, x.functions = NewSymbolTable(), NewSymbolTable()
+		for _, def := range ast.Functions {
+			x.defineFunction(def)
+		}
+		for _, def := range ast.Functions {
+			x.statement(def, &x.index.Symbols)
+		}
+	}
+	sort.SliceStable(x.index.References, func(i, j int) bool {
+		a, b := x.index.References[i].Range, x.index.References[j].Range
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return x.index, nil
+}
+
+// tokenRange returns the range of the token at offset
+func (x *yulIndexer) tokenRange(offset int) DiagnosticRange {
+	i, ok := x.at[offset]
+	if !ok {
+		return DiagnosticRange{}
+	}
+	return tokenRange(x.tokens[i])
+}
+
+func tokenRange(token Token) DiagnosticRange {
+	p := token.Position
+	return DiagnosticRange{Line: p.Line, Column: p.Column, EndLine: p.EndLine, EndColumn: p.EndColumn}
+}
+
+// nameAfter returns the token after the keyword at offset
+func (x *yulIndexer) nameAfter(offset int) Token {
+	if i, ok := x.at[offset]; ok && i+1 < len(x.tokens) {
+		return x.tokens[i+1]
+	}
+	return Token{}
+}
+
+// extent returns the range from the keyword at offset to the "}" closing
+// the first block after it
+func (x *yulIndexer) extent(offset int) DiagnosticRange {
+	r := x.tokenRange(offset)
+	for i := x.at[offset]; i < len(x.tokens); i++ {
+		if x.tokens[i].Type == TokenLeftBrace {
+			if end, ok := x.closing[i]; ok {
+				r.EndLine, r.EndColumn = x.tokens[end].Position.EndLine, x.tokens[end].Position.EndColumn
+			}
+			break
+		}
+	}
+	return r
+}
+
+// position returns the source position of a name token
+func position(token Token) SourcePosition {
+	p := token.Position
+	return SourcePosition{Line: p.Line, Column: p.Column, Offset: p.Offset, Length: p.Length}
+}
+
+func (x *yulIndexer) reference(name string, at SourcePosition, symbol *Symbol) {
+	r := YulReference{Name: name, Range: x.tokenRange(at.Offset), Symbol: symbol}
+	if symbol == nil && x.dialect != nil {
+		r.Builtin = x.dialect.IsBuiltin(name)
+	} else if symbol == nil {
+		r.Builtin = builtinDocs[name].signature != "" || isVerbatim(name)
+	}
+	x.index.References = append(x.index.References, r)
+}
+
+// object indexes the code, data and nested objects of obj. Objects do not
+// share names.
+func (x *yulIndexer) object(obj *YulObject) YulDocumentSymbol {
+	symbol := YulDocumentSymbol{
+		Name:      obj.Name,
+		Kind:      "object",
+		Range:     x.extent(obj.Location.Offset),
+		Selection: tokenRange(x.nameAfter(obj.Location.Offset)),
+	}
+	if obj.Code != nil {
+		x.variables, x.functions = NewSymbolTable(), NewSymbolTable()
+		x.block(obj.Code, &symbol.Children)
+	}
+	for _, data := range obj.Data.Values() {
+		name := tokenRange(x.nameAfter(data.Location.Offset))
+		extent := x.tokenRange(data.Location.Offset)
+		if i, ok := x.at[data.Location.Offset]; ok && i+2 < len(x.tokens) {
+			value := tokenRange(x.tokens[i+2])
+			extent.EndLine, extent.EndColumn = value.EndLine, value.EndColumn
+		}
+		segment := YulDocumentSymbol{Name: data.Name, Kind: "data", Range: extent, Selection: name}
+		if payload, err := data.Bytes(); err == nil {
+			segment.Detail = fmt.Sprintf("%d bytes", len(payload))
+		}
+		symbol.Children = append(symbol.Children, segment)
+	}
+	for _, nested := range obj.Objects.Values() {
+		symbol.Children = append(symbol.Children, x.object(nested))
+	}
+	return symbol
+}
+
+// block indexes the statements of b in a scope of its own. The functions
+// of a block can be called from anywhere in it.
+func (x *yulIndexer) block(b *YulBlock, symbols *[]YulDocumentSymbol) {
+	if b == nil {
+		return
+	}
+	x.variables.PushScope()
+	x.functions.PushScope()
+	defer x.variables.PopScope()
+	defer x.functions.PopScope()
+	for _, stmt := range b.Statements {
+		if def, ok := stmt.(*YulFunctionDef); ok {
+			x.defineFunction(def)
+		}
+	}
+	x.statements(b.Statements, symbols)
+}
+
+func (x *yulIndexer) statements(statements []YulStatement, symbols *[]YulDocumentSymbol) {
+	for _, stmt := range statements {
+		x.statement(stmt, symbols)
+	}
+}
+
+func (x *yulIndexer) statement(stmt YulStatement, symbols *[]YulDocumentSymbol) {
+	switch s := stmt.(type) {
+	case *YulVariableDeclaration:
+		x.expression(s.Value)
+		for _, variable := range s.Variables {
+			symbol := x.defineVariable(variable, "let "+variable.Name)
+			*symbols = append(*symbols, YulDocumentSymbol{
+				Name:      variable.Name,
+				Kind:      "variable",
+				Range:     x.tokenRange(symbol.Position.Offset),
+				Selection: x.tokenRange(symbol.Position.Offset),
+			})
+		}
+	case *YulAssignment:
+		x.expression(s.Value)
+		i := x.at[s.Location.Offset]
+		for _, name := range s.VariableNames {
+			for i < len(x.tokens) && x.tokens[i].Type != TokenIdentifier {
+				i++
+			}
+			if i == len(x.tokens) {
+				break
+			}
+			symbol, _ := x.variables.Lookup(name)
+			x.reference(name, position(x.tokens[i]), symbol)
+			i++
+		}
+	case *YulExpressionStatement:
+		x.expression(s.Expression)
+	case *YulBlock:
+		x.block(s, symbols)
+	case *YulIf:
+		x.expression(s.Condition)
+		x.block(s.Body, symbols)
+	case *YulSwitch:
+		x.expression(s.Expression)
+		for _, c := range s.Cases {
+			x.block(c.Body, symbols)
+		}
+		x.block(s.Default, symbols)
+	case *YulFor:
+		// Variables of the initializer are in scope until the loop ends
+		x.variables.PushScope()
+		defer x.variables.PopScope()
+		if s.Init != nil {
+			x.statements(s.Init.Statements, symbols)
+		}
+		x.expression(s.Condition)
+		x.block(s.Body, symbols)
+		x.block(s.Post, symbols)
+	case *YulFunctionDef:
+		symbol, _ := x.functions.Lookup(s.Name)
+		name := x.nameAfter(s.Location.Offset)
+		x.reference(s.Name, position(name), symbol)
+		definition := YulDocumentSymbol{
+			Name:      s.Name,
+			Kind:      "function",
+			Detail:    strings.TrimPrefix(functionSignature(s), "function "+s.Name),
+			Range:     x.extent(s.Location.Offset),
+			Selection: tokenRange(name),
+		}
+
+		// A function body sees the functions around it but no variables
+		outer := x.variables
+		x.variables = NewSymbolTable()
+		for _, param := range s.Parameters {
+			x.defineVariable(param, fmt.Sprintf("%s, a parameter of %s", param.Name, s.Name))
+		}
+		for _, ret := range s.Returns {
+			x.defineVariable(ret, fmt.Sprintf("%s, a return variable of %s", ret.Name, s.Name))
+		}
+		x.block(s.Body, &definition.Children)
+		x.variables = outer
+		*symbols = append(*symbols, definition)
+	}
+}
+
+func (x *yulIndexer) expression(expr YulExpression) {
+	switch e := expr.(type) {
+	case *YulFunctionCall:
+		symbol, _ := x.functions.Lookup(e.FunctionName.Name)
+		x.reference(e.FunctionName.Name, e.FunctionName.Location, symbol)
+		for _, arg := range e.Arguments {
+			x.expression(arg)
+		}
+	case *YulIdentifier:
+		symbol, _ := x.variables.Lookup(e.Name)
+		x.reference(e.Name, e.Location, symbol)
+	}
+}
+
+func (x *yulIndexer) defineFunction(def *YulFunctionDef) {
+	symbol := &Symbol{Name: def.Name, Kind: SymbolFunction, Position: position(x.nameAfter(def.Location.Offset))}
+	if x.functions.Define(def.Name, symbol) == nil {
+		x.index.details[symbol] = functionSignature(def)
+	}
+}
+
+// defineVariable declares variable, or a parameter or return variable of
+// the function being indexed, and notes it
+func (x *yulIndexer) defineVariable(variable *YulTypedName, detail string) *Symbol {
+	symbol := &Symbol{Name: variable.Name, Type: variable.Type, Kind: SymbolVariable, Position: variable.Location}
+	if variable.Type != DataTypeUint256 {
+		detail = strings.Replace(detail, variable.Name, fmt.Sprintf("%s:%s", variable.Name, variable.Type), 1)
+	}
+	x.variables.Define(variable.Name, symbol)
+	x.index.details[symbol] = detail
+	x.reference(variable.Name, variable.Location, symbol)
+	return symbol
+}
+
+// functionSignature writes the header of a function definition
+func functionSignature(def *YulFunctionDef) string {
+	names := func(typed []*YulTypedName) string {
+		list := make([]string, len(typed))
+		for i, name := range typed {
+			list[i] = name.Name
+			if name.Type != DataTypeUint256 {
+				list[i] += ":" + string(name.Type)
+			}
+		}
+		return strings.Join(list, ", ")
+	}
+	signature := fmt.Sprintf("function %s(%s)", def.Name, names(def.Parameters))
+	if len(def.Returns) > 0 {
+		signature += " -> " + names(def.Returns)
+	}
+	return signature
+}
+
+// ReferenceAt returns the name at a 1-based line and column. A column just
+// past the end of a name is on it, where an editor's cursor is after typing
+// the name.
+func (ix *YulSourceIndex) ReferenceAt(line, column int) (YulReference, bool) {
+	for _, r := range ix.References {
+		if r.Range.Line == line && r.Range.Column <= column && column <= r.Range.EndColumn {
+			return r, true
+		}
+	}
+	return YulReference{}, false
+}
+
+// Definition returns the range of the declaration of the name at line and
+// column
+func (ix *YulSourceIndex) Definition(line, column int) (DiagnosticRange, bool) {
+	r, ok := ix.ReferenceAt(line, column)
+	if !ok || r.Symbol == nil {
+		return DiagnosticRange{}, false
+	}
+	p := r.Symbol.Position
+	return DiagnosticRange{Line: p.Line, Column: p.Column, EndLine: p.Line, EndColumn: p.Column + utf8.RuneCountInString(r.Symbol.Name)}, true
+}
+
+// Detail returns the declaration of symbol as hovers show it
+func (ix *YulSourceIndex) Detail(symbol *Symbol) string {
+	return ix.details[symbol]
+}
+
+// builtinDoc is the signature and meaning of a builtin
+type builtinDoc struct {
+	signature   string
+	description string
+}
+
+// builtinDocs documents the builtins of every dialect
+var builtinDocs = map[string]builtinDoc{
+	"stop":               {"stop()", "Stops execution, like return(0, 0)"},
+	"add":                {"add(x, y) -> r", "x + y, modulo 2^256"},
+	"sub":                {"sub(x, y) -> r", "x - y, modulo 2^256"},
+	"mul":                {"mul(x, y) -> r", "x * y, modulo 2^256"},
+	"div":                {"div(x, y) -> r", "x / y, or 0 if y is 0"},
+	"sdiv":               {"sdiv(x, y) -> r", "x / y of two's complement words, or 0 if y is 0"},
+	"mod":                {"mod(x, y) -> r", "x % y, or 0 if y is 0"},
+	"smod":               {"smod(x, y) -> r", "x % y of two's complement words, or 0 if y is 0"},
+	"exp":                {"exp(x, y) -> r", "x to the power of y, modulo 2^256"},
+	"not":                {"not(x) -> r", "The bitwise negation of x"},
+	"lt":                 {"lt(x, y) -> r", "1 if x < y, 0 otherwise"},
+	"gt":                 {"gt(x, y) -> r", "1 if x > y, 0 otherwise"},
+	"slt":                {"slt(x, y) -> r", "1 if x < y as two's complement words, 0 otherwise"},
+	"sgt":                {"sgt(x, y) -> r", "1 if x > y as two's complement words, 0 otherwise"},
+	"eq":                 {"eq(x, y) -> r", "1 if x == y, 0 otherwise"},
+	"iszero":             {"iszero(x) -> r", "1 if x is 0, 0 otherwise"},
+	"and":                {"and(x, y) -> r", "The bitwise and of x and y"},
+	"or":                 {"or(x, y) -> r", "The bitwise or of x and y"},
+	"xor":                {"xor(x, y) -> r", "The bitwise exclusive or of x and y"},
+	"byte":               {"byte(n, x) -> r", "Byte n of x, byte 0 being the most significant"},
+	"shl":                {"shl(x, y) -> r", "y shifted left by x bits"},
+	"shr":                {"shr(x, y) -> r", "y shifted right logically by x bits"},
+	"sar":                {"sar(x, y) -> r", "y shifted right arithmetically by x bits"},
+	"signextend":         {"signextend(i, x) -> r", "x sign extended from bit i*8+7, counting from the least significant"},
+	"addmod":             {"addmod(x, y, m) -> r", "(x + y) % m in arbitrary precision, or 0 if m is 0"},
+	"mulmod":             {"mulmod(x, y, m) -> r", "(x * y) % m in arbitrary precision, or 0 if m is 0"},
+	"keccak256":          {"keccak256(p, n) -> h", "The Keccak-256 hash of memory p..p+n, by CryptoLib"},
+	"sha256":             {"sha256(p, n) -> h", "The SHA-256 hash of memory p..p+n, by CryptoLib"},
+	"pop":                {"pop(x)", "Discards x"},
+	"mload":              {"mload(p) -> v", "The word at memory p..p+32"},
+	"mstore":             {"mstore(p, v)", "Stores the word v at memory p..p+32"},
+	"mstore8":            {"mstore8(p, v)", "Stores the least significant byte of v at memory p"},
+	"mcopy":              {"mcopy(t, f, s)", "Copies memory f..f+s to t..t+s"},
+	"msize":              {"msize() -> s", "The size of memory accessed so far"},
+	"sload":              {"sload(p) -> v", "The word in storage slot p"},
+	"sstore":             {"sstore(p, v)", "Stores v in storage slot p"},
+	"tload":              {"tload(p) -> v", "The word in transient slot p, cleared after each transaction"},
+	"tstore":             {"tstore(p, v)", "Stores v in transient slot p"},
+	"gas":                {"gas() -> g", "The gas left"},
+	"address":            {"address() -> a", "The script hash of the executing contract"},
+	"balance":            {"balance(a) -> v", "The GAS balance of account a"},
+	"selfbalance":        {"selfbalance() -> v", "The GAS balance of the executing contract"},
+	"origin":             {"origin() -> a", "The sender of the transaction"},
+	"caller":             {"caller() -> a", "The script hash of the calling contract"},
+	"callvalue":          {"callvalue() -> v", "The GAS sent with the call"},
+	"calldataload":       {"calldataload(p) -> v", "The word of call data at p"},
+	"calldatasize":       {"calldatasize() -> s", "The size of the call data in bytes"},
+	"calldatacopy":       {"calldatacopy(t, f, s)", "Copies call data f..f+s to memory t..t+s"},
+	"codesize":           {"codesize() -> s", "The size of the executing script"},
+	"codecopy":           {"codecopy(t, f, s)", "Copies object data f..f+s to memory t..t+s, as datacopy"},
+	"extcodesize":        {"extcodesize(a) -> s", "The size of the NEF file of contract a, 0 when none is deployed"},
+	"extcodecopy":        {"extcodecopy(a, t, f, s)", "Copies script f..f+s of contract a to memory t..t+s"},
+	"extcodehash":        {"extcodehash(a) -> h", "The SHA-256 hash of the NEF file of contract a, 0 when none is deployed"},
+	"returndatasize":     {"returndatasize() -> s", "The size of the data the last call returned"},
+	"returndatacopy":     {"returndatacopy(t, f, s)", "Copies returned data f..f+s to memory t..t+s"},
+	"gasprice":           {"gasprice() -> p", "The gas price of the transaction"},
+	"blockhash":          {"blockhash(b) -> h", "The hash of block b, for the last 256 blocks"},
+	"coinbase":           {"coinbase() -> a", "The primary validator of the block"},
+	"timestamp":          {"timestamp() -> t", "The time of the block"},
+	"number":             {"number() -> n", "The index of the block"},
+	"difficulty":         {"difficulty() -> d", "The difficulty of the block"},
+	"prevrandao":         {"prevrandao() -> r", "The random number of the transaction"},
+	"gaslimit":           {"gaslimit() -> g", "The gas limit of the block"},
+	"chainid":            {"chainid() -> id", "The network magic"},
+	"basefee":            {"basefee() -> f", "The base fee of the block"},
+	"blobhash":           {"blobhash(i) -> h", "The versioned hash of blob i of the transaction"},
+	"blobbasefee":        {"blobbasefee() -> f", "The blob base fee of the block"},
+	"log0":               {"log0(p, s)", "Notifies memory p..p+s"},
+	"log1":               {"log1(p, s, t1)", "Notifies memory p..p+s with topic t1"},
+	"log2":               {"log2(p, s, t1, t2)", "Notifies memory p..p+s with topics t1 and t2"},
+	"log3":               {"log3(p, s, t1, t2, t3)", "Notifies memory p..p+s with topics t1, t2 and t3"},
+	"log4":               {"log4(p, s, t1, t2, t3, t4)", "Notifies memory p..p+s with topics t1, t2, t3 and t4"},
+	"create":             {"create(v, p, n) -> a", "Deploys the contract in memory p..p+n, sending v"},
+	"create2":            {"create2(v, p, n, s) -> a", "Deploys the contract in memory p..p+n with salt s, sending v"},
+	"call":               {"call(g, a, v, in, insize, out, outsize) -> success", "Calls contract a with input in..in+insize, sending v"},
+	"callcode":           {"callcode(g, a, v, in, insize, out, outsize) -> success", "Like call, in the storage of the executing contract"},
+	"delegatecall":       {"delegatecall(g, a, in, insize, out, outsize) -> success", "Like callcode, keeping the caller and value"},
+	"staticcall":         {"staticcall(g, a, in, insize, out, outsize) -> success", "Like call, without changes of state"},
+	"return":             {"return(p, s)", "Ends execution returning memory p..p+s"},
+	"revert":             {"revert(p, s)", "Ends execution undoing its changes, returning memory p..p+s"},
+	"invalid":            {"invalid()", "Ends execution with an invalid instruction"},
+	"selfdestruct":       {"selfdestruct(a)", "Destroys the executing contract"},
+	"datasize":           {"datasize(\"name\") -> s", "The size of the object or data name"},
+	"dataoffset":         {"dataoffset(\"name\") -> p", "The offset of the object or data name"},
+	"datacopy":           {"datacopy(t, f, s)", "Copies object data f..f+s to memory t..t+s"},
+	"setimmutable":       {"setimmutable(offset, \"name\", v)", "Sets the immutable name to v"},
+	"loadimmutable":      {"loadimmutable(\"name\") -> v", "The value of the immutable name"},
+	"linkersymbol":       {"linkersymbol(\"library\") -> a", "The address of a library, filled in by linking"},
+	"memoryguard":        {"memoryguard(size) -> p", "size, the start of memory the code may use freely"},
+	neoSyscall:           {"neo.syscall(\"Service\", a1, ..., an)", "Calls the interop service named by the literal"},
+	neoNotify:            {"neo.notify(\"Name\", v1, ..., vn)", "Sends the notification Name with state [v1, ..., vn]"},
+	"neo.checkwitness":   {"neo.checkwitness(account) -> r", "1 when account witnessed the transaction"},
+	"neo.storage_find":   {"neo.storage_find(prefix, options) -> iterator", "An iterator over the storage under prefix"},
+	"neo.iterator_next":  {"neo.iterator_next(iterator) -> r", "1 when the iterator moved to a value"},
+	"neo.iterator_value": {"neo.iterator_value(iterator) -> v", "The value the iterator is at"},
+}
+
+// BuiltinSignature returns the signature and a description of a builtin,
+// noting why Neo does not support it if it does not
+func BuiltinSignature(name string) (string, string, bool) {
+	doc, ok := builtinDocs[name]
+	if !ok && isVerbatim(name) {
+		in, out, _ := verbatimArity(name)
+		return fmt.Sprintf("%s(\"code\", %d arguments) -> %d values", name, in, out), "Runs the given NeoVM code", true
+	}
+	if reason, unsupported := unsupportedBuiltins[name]; unsupported {
+		return doc.signature, fmt.Sprintf("%s. Not supported on Neo: %s", doc.description, reason), ok
+	}
+	return doc.signature, doc.description, ok
+}
+
+// BuiltinGasCost estimates the gas of a call of a builtin, by compiling a
+// function making it with config: the difference between its cost and that
+// of an empty function with the same arguments. Builtins taking literals
+// cannot be estimated.
+func BuiltinGasCost(config CompilerConfig, name string) (GasCost, error) {
+	signature, _, ok := BuiltinSignature(name)
+	if !ok || strings.Contains(signature, "\"") {
+		return GasCost{}, fmt.Errorf("no gas estimate for %s", name)
+	}
+	open, close := strings.Index(signature, "("), strings.Index(signature, ")")
+	var args []string
+	for i := range strings.Split(signature[open+1:close], ",") {
+		if strings.TrimSpace(signature[open+1:close]) != "" {
+			args = append(args, fmt.Sprintf("a%d", i))
+		}
+	}
+	call := fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+	returns := ""
+	if strings.Contains(signature, "->") {
+		call, returns = "r := "+call, " -> r"
+	}
+	source := fmt.Sprintf("object \"gas\" {\n\tcode {\n\t\tfunction probe(%[1]s)%[2]s { %[3]s }\n\t\tfunction base(%[1]s)%[2]s { }\n\t}\n}\n",
+		strings.Join(args, ", "), returns, call)
+
+	config.ExportFunctions = []string{"probe", "base"}
+	config.EnableDebugInfo = false
+	result, err := NewYulToNeoCompiler(config).Compile(source)
+	if err != nil {
+		return GasCost{}, fmt.Errorf("no gas estimate for %s: %w", name, err)
+	}
+	costs := make(map[string]GasCost)
+	for _, cost := range result.GasReport.Functions {
+		costs[cost.Name] = cost
+	}
+	probe, base := costs["probe"], costs["base"]
+	return GasCost{Name: name, Min: probe.Min - base.Min, Max: probe.Max - base.Max, Unbounded: probe.Unbounded}, nil
+}
+
+// gasText describes an estimated cost
+func gasText(cost GasCost) string {
+	text := fmt.Sprintf("%d datoshi", cost.Max)
+	if cost.Min != cost.Max {
+		text = fmt.Sprintf("%d to %d datoshi", cost.Min, cost.Max)
+	}
+	if cost.Unbounded {
+		text += ", per loop iteration"
+	}
+	return text
+}
+
+// Language Server Protocol messages
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type lspResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+type lspErrorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   lspError         `json:"error"`
+}
+
+type lspNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes
+const (
+	lspInvalidRequest = -32600
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+)
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range              lspRange             `json:"range"`
+	Severity           int                  `json:"severity"`
+	Code               string               `json:"code"`
+	Source             string               `json:"source"`
+	Message            string               `json:"message"`
+	RelatedInformation []lspRelatedLocation `json:"relatedInformation,omitempty"`
+}
+
+type lspRelatedLocation struct {
+	Location lspLocation `json:"location"`
+	Message  string      `json:"message"`
+}
+
+type lspDocumentSymbol struct {
+	Name           string              `json:"name"`
+	Detail         string              `json:"detail,omitempty"`
+	Kind           int                 `json:"kind"`
+	Range          lspRange            `json:"range"`
+	SelectionRange lspRange            `json:"selectionRange"`
+	Children       []lspDocumentSymbol `json:"children,omitempty"`
+}
+
+type lspMarkup struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type lspHover struct {
+	Contents lspMarkup `json:"contents"`
+	Range    lspRange  `json:"range"`
+}
+
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+// lspOptions are the initializationOptions configuring compilation
+type lspOptions struct {
+	OptimizationLevel *int     `json:"optimizationLevel"`
+	Dialect           string   `json:"dialect"`
+	Exports           []string `json:"exports"`
+	CompilerFlags     []string `json:"compilerFlags"`
+}
+
+// LSP symbol kinds of YulDocumentSymbol kinds
+var lspSymbolKinds = map[string]int{"object": 2, "function": 12, "variable": 13, "data": 14}
+
+// Diagnostic severities of the protocol
+var lspSeverities = map[DiagnosticSeverity]int{SeverityError: 1, SeverityWarning: 2, SeverityInfo: 3}
+
+// lspDocument is an open document
+type lspDocument struct {
+	text  string
+	index *YulSourceIndex // Of the last version that parsed
+	gas   *GasReport      // Of the last version that compiled
+}
+
+// LanguageServer serves Yul documents over the Language Server Protocol
+type LanguageServer struct {
+	in        *bufio.Reader
+	out       io.Writer
+	config    CompilerConfig
+	dialect   *Dialect
+	documents map[string]*lspDocument // By URI
+	gas       map[string]*GasCost     // Builtin estimates, nil when there is none
+	shutdown  bool
+}
+
+// NewLanguageServer creates a server reading messages from in and writing
+// to out
+func NewLanguageServer(in io.Reader, out io.Writer) *LanguageServer {
+	dialect, _ := DialectByName(DefaultDialect)
+	return &LanguageServer{
+		in:        bufio.NewReader(in),
+		out:       out,
+		config:    CompilerConfig{OptimizationLevel: 2},
+		dialect:   dialect,
+		documents: make(map[string]*lspDocument),
+		gas:       make(map[string]*GasCost),
+	}
+}
+
+// Serve handles messages until an exit notification or the end of input.
+// It fails when the client exits without shutting the server down.
+func (s *LanguageServer) Serve() error {
+	for {
+		content, err := ReadDAPMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var message lspMessage
+		if err := json.Unmarshal(content, &message); err != nil {
+			return fmt.Errorf("invalid message: %w", err)
+		}
+		if message.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+			return nil
+		}
+		if message.Method == "" {
+			continue // A response to a request of the server
+		}
+		result, rpcErr := s.dispatch(message)
+		if message.ID == nil {
+			continue
+		}
+		var response interface{} = &lspResponse{JSONRPC: "2.0", ID: message.ID, Result: result}
+		if rpcErr != nil {
+			response = &lspErrorResponse{JSONRPC: "2.0", ID: message.ID, Error: *rpcErr}
+		}
+		if err := WriteDAPMessage(s.out, response); err != nil {
+			return err
+		}
+	}
+}
+
+// notify sends a notification to the client
+func (s *LanguageServer) notify(method string, params interface{}) error {
+	return WriteDAPMessage(s.out, &lspNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// dispatch handles a request or notification and returns the result of a
+// request
+func (s *LanguageServer) dispatch(message lspMessage) (interface{}, *lspError) {
+	if s.shutdown {
+		return nil, &lspError{lspInvalidRequest, "the server is shut down"}
+	}
+	decode := func(v interface{}) *lspError {
+		if err := json.Unmarshal(message.Params, v); err != nil {
+			return &lspError{lspInvalidParams, err.Error()}
+		}
+		return nil
+	}
+
+	switch message.Method {
+	case "initialize":
+		var params struct {
+			InitializationOptions *lspOptions `json:"initializationOptions"`
+		}
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		if options := params.InitializationOptions; options != nil {
+			if options.OptimizationLevel != nil {
+				s.config.OptimizationLevel = *options.OptimizationLevel
+			}
+			s.config.Dialect = options.Dialect
+			s.config.ExportFunctions = options.Exports
+			s.config.CompilerFlags = options.CompilerFlags
+			dialect, err := DialectFromConfig(s.config)
+			if err != nil {
+				return nil, &lspError{lspInvalidParams, err.Error()}
+			}
+			s.dialect = dialect
+		}
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       1, // Full
+				"definitionProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "neo-yulc", "version": CompilerVersion},
+		}, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": params.TextDocument.URI, "diagnostics": []lspDiagnostic{}})
+		return nil, nil
+
+	case "textDocument/definition":
+		var params lspTextDocumentPosition
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		doc, line, column := s.at(params)
+		if doc == nil {
+			return nil, nil
+		}
+		if r, ok := doc.index.Definition(line, column); ok {
+			return lspLocation{URI: params.TextDocument.URI, Range: lspRangeOf(r)}, nil
+		}
+		return nil, nil
+
+	case "textDocument/hover":
+		var params lspTextDocumentPosition
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		doc, line, column := s.at(params)
+		if doc == nil {
+			return nil, nil
+		}
+		if r, ok := doc.index.ReferenceAt(line, column); ok {
+			if text := s.hover(doc, r); text != "" {
+				return lspHover{Contents: lspMarkup{"markdown", text}, Range: lspRangeOf(r.Range)}, nil
+			}
+		}
+		return nil, nil
+
+	case "textDocument/documentSymbol":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		symbols := []lspDocumentSymbol{}
+		if doc := s.documents[params.TextDocument.URI]; doc != nil && doc.index != nil {
+			symbols = lspSymbols(doc.index.Symbols)
+		}
+		return symbols, nil
+	}
+
+	if message.ID == nil || strings.HasPrefix(message.Method, "$/") {
+		return nil, nil // Notifications the server has no use for
+	}
+	return nil, &lspError{lspMethodNotFound, fmt.Sprintf("unsupported method %s", message.Method)}
+}
+
+// update compiles a new version of a document, publishes its diagnostics
+// and indexes it when it parses
+func (s *LanguageServer) update(uri, text string) {
+	doc := s.documents[uri]
+	if doc == nil {
+		doc = &lspDocument{}
+		s.documents[uri] = doc
+	}
+	doc.text = text
+	if index, err := IndexYul(text, s.dialect); err == nil {
+		doc.index = index
+	}
+
+	diagnostics := []lspDiagnostic{}
+	result, _ := NewYulToNeoCompiler(s.config).Compile(text)
+	if result != nil {
+		if result.GasReport != nil {
+			doc.gas = result.GasReport
+		}
+		for _, d := range result.Diagnostics() {
+			diagnostic := lspDiagnostic{
+				Range:    lspRangeOf(d.Range),
+				Severity: lspSeverities[d.Severity],
+				Code:     d.Code,
+				Source:   "neo-yulc",
+				Message:  d.Message,
+			}
+			if d.Fix != "" {
+				diagnostic.Message += "\n" + d.Fix
+			}
+			for _, note := range d.Related {
+				diagnostic.RelatedInformation = append(diagnostic.RelatedInformation, lspRelatedLocation{
+					Location: lspLocation{URI: uri, Range: lspRangeOf(note.Range)},
+					Message:  note.Message,
+				})
+			}
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": diagnostics})
+}
+
+// at returns the indexed document and the 1-based line and column of a
+// position
+func (s *LanguageServer) at(params lspTextDocumentPosition) (*lspDocument, int, int) {
+	doc := s.documents[params.TextDocument.URI]
+	if doc == nil || doc.index == nil {
+		return nil, 0, 0
+	}
+	return doc, params.Position.Line + 1, params.Position.Character + 1
+}
+
+// hover describes what a name refers to
+func (s *LanguageServer) hover(doc *lspDocument, r YulReference) string {
+	if r.Symbol != nil {
+		text := "```yul\n" + doc.index.Detail(r.Symbol) + "\n```"
+		if r.Symbol.Kind == SymbolFunction && doc.gas != nil {
+			for _, cost := range doc.gas.Functions {
+				if cost.Name == r.Name {
+					text += "\n\nGas: " + gasText(cost)
+				}
+			}
+		}
+		return text
+	}
+	if !r.Builtin {
+		return ""
+	}
+	signature, description, ok := BuiltinSignature(r.Name)
+	if !ok {
+		return ""
+	}
+	text := "```yul\n" + signature + "\n```\n\n" + description
+	cost, seen := s.gas[r.Name]
+	if !seen {
+		if estimate, err := BuiltinGasCost(s.config, r.Name); err == nil {
+			cost = &estimate
+		}
+		s.gas[r.Name] = cost
+	}
+	if cost != nil {
+		text += "\n\nGas: " + gasText(*cost)
+	}
+	return text
+}
+
+// lspRangeOf converts a 1-based range; a range without a line is the
+// start of the document
+func lspRangeOf(r DiagnosticRange) lspRange {
+	if r.Line <= 0 {
+		return lspRange{}
+	}
+	start := lspPosition{r.Line - 1, r.Column - 1}
+	if start.Character < 0 {
+		start.Character = 0
+	}
+	end := start
+	if r.EndLine > 0 {
+		end = lspPosition{r.EndLine - 1, r.EndColumn - 1}
+	}
+	return lspRange{start, end}
+}
+
+func lspSymbols(symbols []YulDocumentSymbol) []lspDocumentSymbol {
+	converted := make([]lspDocumentSymbol, len(symbols))
+	for i, symbol := range symbols {
+		converted[i] = lspDocumentSymbol{
+			Name:           symbol.Name,
+			Detail:         symbol.Detail,
+			Kind:           lspSymbolKinds[symbol.Kind],
+			Range:          lspRangeOf(symbol.Range),
+			SelectionRange: lspRangeOf(symbol.Selection),
+			Children:       lspSymbols(symbol.Children),
+		}
+	}
+	return converted
+}
+
+// RunLSPCommand runs "lsp" with the given arguments and returns the process
+// exit code
+func RunLSPCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: lsp")
+		fmt.Fprintln(stderr, "Serves the Language Server Protocol on standard input and output.")
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if err := NewLanguageServer(stdin, stdout).Serve(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Contract manifests.
+//
+// The manifest declares what a Neo node needs to know about a deployed
+// contract: its ABI, the contracts and methods it may call (permissions),
+// the contracts allowed to call it with all flags (trusts) and the
+// standards it implements. ManifestGenerator derives the ABI from the
+// contract methods and events, and permits every call the script makes:
+// native contract methods by hash and name, external calls as the
+// ExternalCallMethod of any contract. Permissions, trusts and standards
+// from the configuration are added to those.
+//
+// Permissions and trusts are configured as strings. A permission is a
+// contract hash or group public key, optionally followed by ':' and a
+// comma-separated list of methods, e.g. "0xd2a4...76cf:transfer,balanceOf";
+// "*" stands for every contract or every method. A trust is a contract hash,
+// a group public key or "*". Hashes are 20 bytes in hex, public keys 33
+// bytes compressed.
+
+// MaxManifestSize is the largest manifest Neo accepts, in bytes of JSON
+const MaxManifestSize = 0xFFFF
+
+// ManifestWildcard is "*" or a list of names
+type ManifestWildcard struct {
+	All   bool
+	Items []string
+}
+
+func (w ManifestWildcard) MarshalJSON() ([]byte, error) {
+	if w.All {
+		return json.Marshal("*")
+	}
+	if w.Items == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(w.Items)
+}
+
+func (w *ManifestWildcard) UnmarshalJSON(data []byte) error {
+	var all string
+	if err := json.Unmarshal(data, &all); err == nil {
+		if all != "*" {
+			return fmt.Errorf("expected \"*\" or a list, got %q", all)
+		}
+		*w = ManifestWildcard{All: true}
+		return nil
+	}
+	*w = ManifestWildcard{}
+	return json.Unmarshal(data, &w.Items)
+}
+
+// add returns w with name included
+func (w ManifestWildcard) add(name string) ManifestWildcard {
+	if w.All || name == "*" {
+		return ManifestWildcard{All: true}
+	}
+	for _, item := range w.Items {
+		if item == name {
+			return w
+		}
+	}
+	return ManifestWildcard{Items: append(append([]string(nil), w.Items...), name)}
+}
+
+// ContractPermission lets the contract call methods of a contract
+type ContractPermission struct {
+	Contract string           `json:"contract"` // Script hash, group public key or "*"
+	Methods  ManifestWildcard `json:"methods"`
+}
+
+// mergePermission adds permission to permissions, joining the methods of
+// permissions for the same contract
+func mergePermission(permissions []ContractPermission, permission ContractPermission) []ContractPermission {
+	for i, existing := range permissions {
+		if existing.Contract != permission.Contract {
+			continue
+		}
+		methods := existing.Methods
+		if permission.Methods.All {
+			methods = ManifestWildcard{All: true}
+		}
+		for _, method := range permission.Methods.Items {
+			methods = methods.add(method)
+		}
+		permissions[i].Methods = methods
+		return permissions
+	}
+	return append(permissions, permission)
+}
+
+// parseManifestContract returns the contract of a permission or trust,
+// "*", a script hash in lower case with "0x" or a compressed public key in
+// lower case
+func parseManifestContract(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "*" {
+		return value, true
+	}
+	if hash, ok := parseScriptHash(value); ok {
+		return hash, true
+	}
+	key, err := parseHexBytes(strings.ToLower(value), 33)
+	if err != nil {
+		return "", false
+	}
+	if x, _ := elliptic.UnmarshalCompressed(elliptic.P256(), key); x == nil {
+		return "", false
+	}
+	return hex.EncodeToString(key), true
+}
+
+// ParseContractPermission parses a configured permission
+func ParseContractPermission(value string) (ContractPermission, error) {
+	name, methods, listed := strings.Cut(strings.TrimSpace(value), ":")
+	if name == "" {
+		return ContractPermission{}, fmt.Errorf("permission %q names no contract", value)
+	}
+	contract, ok := parseManifestContract(name)
+	if !ok {
+		return ContractPermission{}, fmt.Errorf("permission %q: %q is not \"*\", a script hash or a group public key", value, name)
+	}
+	permission := ContractPermission{Contract: contract, Methods: ManifestWildcard{All: true}}
+	if !listed || methods == "*" {
+		return permission, nil
+	}
+	permission.Methods = ManifestWildcard{}
+	for _, method := range strings.Split(methods, ",") {
+		method = strings.TrimSpace(method)
+		if problem := CheckManifestName(ManifestMethod, method); problem != "" {
+			return ContractPermission{}, fmt.Errorf("permission %q: method %q %s", value, method, problem)
+		}
+		permission.Methods = permission.Methods.add(method)
+	}
+	return permission, nil
+}
+
+// ManifestSettings are the configured parts of the manifest
+type ManifestSettings struct {
+	Permissions []ContractPermission
+	Trusts      ManifestWildcard
+	Standards   []string
+}
+
+// ManifestSettingsFromConfig parses the manifest settings of config,
+// returning the settings that parse with the errors of those that do not
+func ManifestSettingsFromConfig(config CompilerConfig) (ManifestSettings, []error) {
+	var settings ManifestSettings
+	var errs []error
+	for _, value := range config.Permissions {
+		permission, err := ParseContractPermission(value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		settings.Permissions = mergePermission(settings.Permissions, permission)
+	}
+	for _, trust := range config.Trusts {
+		contract, ok := parseManifestContract(trust)
+		if !ok {
+			errs = append(errs, fmt.Errorf("trust %q is not \"*\", a script hash or a group public key", trust))
+			continue
+		}
+		settings.Trusts = settings.Trusts.add(contract)
+	}
+	for _, standard := range config.SupportedStandards {
+		if strings.TrimSpace(standard) == "" {
+			errs = append(errs, fmt.Errorf("empty supported standard"))
+			continue
+		}
+		settings.Standards = append(settings.Standards, strings.TrimSpace(standard))
+	}
+	return settings, errs
+}
+
+// ContractManifest is the manifest.json of a Neo N3 contract
+type ContractManifest struct {
+	Name               string                 `json:"name"`
+	Groups             []ManifestGroup        `json:"groups"`
+	Features           map[string]interface{} `json:"features"`
+	SupportedStandards []string               `json:"supportedstandards"`
+	ABI                ManifestABI            `json:"abi"`
+	Permissions        []ContractPermission   `json:"permissions"`
+	Trusts             ManifestWildcard       `json:"trusts"`
+	Extra              map[string]interface{} `json:"extra"`
+}
+
+// ManifestGroup is a group the contract belongs to, signed by its key
+type ManifestGroup struct {
+	PublicKey string `json:"pubkey"`
+	Signature string `json:"signature"`
+}
+
+// ManifestABI lists the methods and events of the contract
+type ManifestABI struct {
+	Methods []ABIMethod `json:"methods"`
+	Events  []ABIEvent  `json:"events"`
+}
+
+// ABIMethod is a method in the manifest ABI
+type ABIMethod struct {
+	Name       string         `json:"name"`
+	Parameters []ABIParameter `json:"parameters"`
+	ReturnType string         `json:"returntype"`
+	Offset     int            `json:"offset"`
+	Safe       bool           `json:"safe"`
+}
+
+// ABIEvent is an event in the manifest ABI
+type ABIEvent struct {
+	Name       string         `json:"name"`
+	Parameters []ABIParameter `json:"parameters"`
+}
+
+// ABIParameter is a named, typed parameter
+type ABIParameter struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ManifestGenerator builds contract manifests
+type ManifestGenerator struct {
+	settings ManifestSettings
+}
+
+// NewManifestGenerator creates a manifest generator with the configured
+// settings of context
+func NewManifestGenerator(context *CompilerContext) *ManifestGenerator {
+	generator := &ManifestGenerator{}
+	if context != nil {
+		generator.settings = context.Manifest
+	}
+	return generator
+}
+
+// Generate builds the manifest of contract
+func (m *ManifestGenerator) Generate(contract *NeoContract) (*ContractManifest, error) {
+	manifest := &ContractManifest{
+		Name:               contract.Name,
+		Groups:             []ManifestGroup{},
+		Features:           map[string]interface{}{},
+		SupportedStandards: append([]string{}, m.settings.Standards...),
+		Permissions:        []ContractPermission{},
+		Trusts:             m.settings.Trusts,
+	}
+	if contract.Author != "" || contract.Description != "" {
+		manifest.Extra = map[string]interface{}{}
+		if contract.Author != "" {
+			manifest.Extra["Author"] = contract.Author
+		}
+		if contract.Description != "" {
+			manifest.Extra["Description"] = contract.Description
+		}
+	}
+
+	abi, err := manifestABI(contract.Methods, contract.Events)
+	if err != nil {
+		return nil, err
+	}
+	manifest.ABI = abi
+
+	for _, permission := range contract.Permissions {
+		manifest.Permissions = mergePermission(manifest.Permissions, permission)
+	}
+	for _, permission := range m.settings.Permissions {
+		manifest.Permissions = mergePermission(manifest.Permissions, permission)
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("encoding manifest: %w", err)
+	}
+	if len(data) > MaxManifestSize {
+		return nil, fmt.Errorf("manifest is %d bytes, Neo allows %d", len(data), MaxManifestSize)
+	}
+	return manifest, nil
+}
+
+// manifestABI returns the manifest ABI of methods and events, whose
+// parameters must have manifest types
+func manifestABI(methods []*ContractMethod, events []*ContractEvent) (ManifestABI, error) {
+	abi := ManifestABI{Methods: []ABIMethod{}, Events: []ABIEvent{}}
+	parameters := func(owner string, params []ABIParameter) error {
+		for _, param := range params {
+			if !manifestTypes[param.Type] || param.Type == "Void" {
+				return fmt.Errorf("%s parameter %s has type %q, not a manifest type", owner, param.Name, param.Type)
+			}
+		}
+		return nil
+	}
+	for _, method := range methods {
+		if len(method.Returns) > 1 {
+			return abi, fmt.Errorf("method %s returns %d values; methods return at most one", method.Name, len(method.Returns))
+		}
+		entry := ABIMethod{
+			Name:       method.Name,
+			Parameters: []ABIParameter{},
+			ReturnType: "Void",
+			Offset:     method.Offset,
+			Safe:       method.Safe,
+		}
+		for _, param := range method.Parameters {
+			entry.Parameters = append(entry.Parameters, ABIParameter{param.Name, param.Type})
+		}
+		if len(method.Returns) == 1 {
+			entry.ReturnType = method.Returns[0].Type
+			if !manifestTypes[entry.ReturnType] {
+				return abi, fmt.Errorf("method %s returns type %q, not a manifest type", method.Name, entry.ReturnType)
+			}
+		}
+		if err := parameters("method "+method.Name, entry.Parameters); err != nil {
+			return abi, err
+		}
+		abi.Methods = append(abi.Methods, entry)
+	}
+	for _, event := range events {
+		entry := ABIEvent{Name: event.Name, Parameters: []ABIParameter{}}
+		for _, param := range event.Parameters {
+			entry.Parameters = append(entry.Parameters, ABIParameter{param.Name, param.Type})
+		}
+		if err := parameters("event "+event.Name, entry.Parameters); err != nil {
+			return abi, err
+		}
+		abi.Events = append(abi.Events, entry)
+	}
+	return abi, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Neo manifest name validation.
+//
+// Yul identifiers may contain '.' and '$' and have no length limit, while
+// method and event names in a Neo manifest must be plain identifiers that
+// stay distinct when compared case-insensitively. Names that do not fit are
+// either reported as errors or, with RenameManifestNames, rewritten
+// deterministically; every rename is listed in the contract metadata.
+
+// MaxManifestNameLength is the longest method or event name accepted
+const MaxManifestNameLength = 64
+
+// renameManifestNamesFlag enables automatic renaming
+const renameManifestNamesFlag = "--rename-manifest-names"
+
+// systemMethodNames are the underscore-prefixed methods NeoVM invokes itself
+var systemMethodNames = map[string]bool{
+	"_deploy":     true,
+	"_initialize": true,
+}
+
+// ManifestNameKind distinguishes method and event names
+type ManifestNameKind string
+
+const (
+	ManifestMethod ManifestNameKind = "method"
+	ManifestEvent  ManifestNameKind = "event"
+)
+
+// ManifestNameIssue describes a name that cannot appear in a manifest as is
+type ManifestNameIssue struct {
+	Kind    ManifestNameKind
+	Name    string
+	Problem string
+}
+
+func (i ManifestNameIssue) String() string {
+	return fmt.Sprintf("%s %q: %s", i.Kind, i.Name, i.Problem)
+}
+
+// NameMapping records a manifest name chosen for a Yul name
+type NameMapping struct {
+	Kind     ManifestNameKind `json:"kind"`
+	Original string           `json:"original"`
+	Manifest string           `json:"manifest"`
+	Reason   string           `json:"reason"`
+}
+
+// RenameManifestNamesRequested reports whether automatic renaming is enabled
+func RenameManifestNamesRequested(config CompilerConfig) bool {
+	return config.RenameManifestNames || flagSet(config.CompilerFlags, renameManifestNamesFlag)
+}
+
+// CheckManifestName returns why name is not a valid manifest name, or ""
+func CheckManifestName(kind ManifestNameKind, name string) string {
+	if name == "" {
+		return "name is empty"
+	}
+	if len(name) > MaxManifestNameLength {
+		return fmt.Sprintf("longer than %d characters", MaxManifestNameLength)
+	}
+	for i, r := range name {
+		if !isManifestNameChar(r) {
+			return fmt.Sprintf("character %q is not allowed", r)
+		}
+		if i == 0 && r >= '0' && r <= '9' {
+			return "starts with a digit"
+		}
+	}
+	if strings.HasPrefix(name, "_") && !(kind == ManifestMethod && systemMethodNames[name]) {
+		return "names starting with '_' are reserved for system methods"
+	}
+	return ""
+}
+
+func isManifestNameChar(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// manifestNameKey is the case-folded identity of a name; methods may be
+// overloaded by parameter count
+func manifestNameKey(kind ManifestNameKind, name string, params int) string {
+	key := string(kind) + ":" + strings.ToLower(name)
+	if kind == ManifestMethod {
+		key += fmt.Sprintf("/%d", params)
+	}
+	return key
+}
+
+// manifestEntry is a renameable name in the contract interface
+type manifestEntry struct {
+	kind   ManifestNameKind
+	params int
+	name   *string
+}
+
+func manifestEntries(contract *NeoContract) []manifestEntry {
+	var entries []manifestEntry
+	for _, method := range contract.Methods {
+		entries = append(entries, manifestEntry{ManifestMethod, len(method.Parameters), &method.Name})
+	}
+	for _, event := range contract.Events {
+		entries = append(entries, manifestEntry{ManifestEvent, 0, &event.Name})
+	}
+	return entries
+}
+
+// ValidateManifestNames returns every method and event name that cannot be
+// used in the manifest, in declaration order
+func ValidateManifestNames(contract *NeoContract) []ManifestNameIssue {
+	var issues []ManifestNameIssue
+	seen := make(map[string]string)
+	for _, entry := range manifestEntries(contract) {
+		name := *entry.name
+		if problem := CheckManifestName(entry.kind, name); problem != "" {
+			issues = append(issues, ManifestNameIssue{entry.kind, name, problem})
+			continue
+		}
+		key := manifestNameKey(entry.kind, name, entry.params)
+		if previous, exists := seen[key]; exists {
+			issues = append(issues, ManifestNameIssue{entry.kind, name,
+				fmt.Sprintf("collides with %q when case is ignored", previous)})
+			continue
+		}
+		seen[key] = name
+	}
+	return issues
+}
+
+// RenameManifestNames rewrites invalid and colliding names in place and
+// returns the mapping. Valid names keep priority in declaration order, so the
+// result only depends on the contract interface.
+func RenameManifestNames(contract *NeoContract) []NameMapping {
+	entries := manifestEntries(contract)
+	taken := make(map[string]bool)
+	pending := make([]bool, len(entries))
+	reasons := make([]string, len(entries))
+
+	for i, entry := range entries {
+		name := *entry.name
+		if problem := CheckManifestName(entry.kind, name); problem != "" {
+			pending[i], reasons[i] = true, problem
+			continue
+		}
+		key := manifestNameKey(entry.kind, name, entry.params)
+		if taken[key] {
+			pending[i], reasons[i] = true, "collides with another name when case is ignored"
+			continue
+		}
+		taken[key] = true
+	}
+
+	var mappings []NameMapping
+	for i, entry := range entries {
+		if !pending[i] {
+			continue
+		}
+		original := *entry.name
+		base := sanitizeManifestName(entry.kind, original)
+		candidate := base
+		for n := 2; taken[manifestNameKey(entry.kind, candidate, entry.params)]; n++ {
+			suffix := fmt.Sprintf("_%d", n)
+			candidate = truncateManifestName(base, MaxManifestNameLength-len(suffix)) + suffix
+		}
+		taken[manifestNameKey(entry.kind, candidate, entry.params)] = true
+		*entry.name = candidate
+		mappings = append(mappings, NameMapping{entry.kind, original, candidate, reasons[i]})
+	}
+	return mappings
+}
+
+// sanitizeManifestName maps a Yul name to the closest valid manifest name
+func sanitizeManifestName(kind ManifestNameKind, name string) string {
+	var builder strings.Builder
+	for _, r := range name {
+		if isManifestNameChar(r) {
+			builder.WriteRune(r)
+		} else {
+			builder.WriteByte('_')
+		}
+	}
+	sanitized := builder.String()
+
+	if sanitized == "" || (sanitized[0] >= '0' && sanitized[0] <= '9') {
+		sanitized = "n" + sanitized
+	}
+	if strings.HasPrefix(sanitized, "_") && !(kind == ManifestMethod && systemMethodNames[sanitized]) {
+		sanitized = "x" + sanitized
+	}
+
+	if len(sanitized) > MaxManifestNameLength {
+		// Keep names distinct by replacing the tail with a hash of the original
+		sum := sha256.Sum256([]byte(name))
+		suffix := "_" + hex.EncodeToString(sum[:4])
+		sanitized = truncateManifestName(sanitized, MaxManifestNameLength-len(suffix)) + suffix
+	}
+	return sanitized
+}
+
+func truncateManifestName(name string, length int) string {
+	if len(name) <= length {
+		return name
+	}
+	return name[:length]
+}
+
+// checkManifestNames validates the contract interface during finalization,
+// renaming names when the configuration allows it
+func (rm *RuntimeManager) checkManifestNames(contract *NeoContract) error {
+	issues := ValidateManifestNames(contract)
+	if len(issues) == 0 {
+		return nil
+	}
+
+	if rm.context == nil || !rm.context.RenameManifestNames {
+		descriptions := make([]string, len(issues))
+		for i, issue := range issues {
+			descriptions[i] = issue.String()
+		}
+		return fmt.Errorf("names not representable in the Neo manifest: %s (use %s to rename them automatically)",
+			strings.Join(descriptions, "; "), renameManifestNamesFlag)
+	}
+
+	contract.Metadata.NameMappings = RenameManifestNames(contract)
+	return nil
+}
@@ -0,0 +1,453 @@
+package main
+
+// Linear memory.
+//
+// Yul memory is a byte array that grows in 32-byte steps when it is
+// accessed past its end. It is kept in a NeoVM Buffer in a static field,
+// reserved after the top-level variables whenever the code uses memory.
+// Accesses go through memory routines, which are emitted once per script
+// after the top-level code and called like functions: arguments are passed
+// first on top, the callee's INITSLOT takes them into argument slots.
+//
+// Words are stored big-endian as in the EVM. NeoVM converts integers to
+// and from little-endian two's complement, so loads and stores reverse the
+// 32 bytes of a word.
+//
+// With bounds checking enabled, growing memory beyond MaxMemorySize aborts
+// with a clear failure instead of faulting inside the VM.
+
+// MaxMemorySize is the largest memory a contract may use: NeoVM's limit on
+// the size of a single stack item
+const MaxMemorySize = NeoMaxItemSize
+
+// memoryBuiltins are the built-ins that read or write memory
+var memoryBuiltins = map[string]bool{
+	"mload": true, "mstore": true, "mstore8": true, "msize": true,
+	"mcopy": true, "calldatacopy": true, "datacopy": true, "codecopy": true,
+	"log0": true, "log1": true, "log2": true, "log3": true, "log4": true,
+	"keccak256": true, "returndatacopy": true,
+	"call": true, "staticcall": true, "delegatecall": true,
+	"create": true, "create2": true, "revert": true, "return": true,
+}
+
+// Memory routines in the order they are emitted
+const (
+	memoryExpand = "memory_expand"
+	memoryLoad   = "memory_load"
+	memoryStore  = "memory_store"
+	memoryStore8 = "memory_store8"
+	memoryCopy   = "memory_copy"
+	memoryCopyIn = "memory_copy_in"
+	memorySlice  = "memory_slice"
+)
+
+// keccakSoftware hashes on NeoVM versions without the Keccak-256 interop
+const keccakSoftware = "keccak256_software"
+
+var memoryRoutineOrder = []string{
+	memoryExpand, memoryLoad, memoryStore, memoryStore8, memoryCopy, memoryCopyIn, memorySlice,
+	calldataInit, calldataLoad, keccakSoftware, contractCall, returnDataCopy,
+	contractCreate, revertReason, blockHashRoutine, addressHash, tokenIDRoutine, nep11Adjust, nep11Record,
+	storageLoad, storageStore, transientLoad, addressWordRoutine, addressScriptHashRoutine,
+	wordDivMod, wordModularSum, wordAddMod, wordMulMod,
+}
+
+// memoryRoutine describes the slots of a memory routine
+type memoryRoutine struct {
+	args   int
+	locals int
+	calls  []string // Routines it calls
+	emit   func(g *CodeGenerator, location SourcePosition)
+}
+
+var memoryRoutines = map[string]memoryRoutine{
+	memoryExpand:   {args: 1, emit: (*CodeGenerator).emitMemoryExpand},
+	memoryLoad:     {args: 1, calls: expands, emit: (*CodeGenerator).emitMemoryLoad},
+	memoryStore:    {args: 2, calls: expands, emit: (*CodeGenerator).emitMemoryStore},
+	memoryStore8:   {args: 2, calls: expands, emit: (*CodeGenerator).emitMemoryStore8},
+	memoryCopy:     {args: 3, calls: expands, emit: (*CodeGenerator).emitMemoryCopy},
+	memoryCopyIn:   {args: 4, locals: 1, calls: expands, emit: (*CodeGenerator).emitMemoryCopyIn},
+	memorySlice:    {args: 2, calls: expands, emit: (*CodeGenerator).emitMemorySlice},
+	calldataInit:   {args: 2, locals: 1, emit: (*CodeGenerator).emitCalldataInitRoutine},
+	calldataLoad:   {args: 1, locals: 1, emit: (*CodeGenerator).emitCalldataLoad},
+	keccakSoftware: {args: 1, locals: keccakLocals, emit: (*CodeGenerator).emitKeccakSoftware},
+	contractCall: {args: 6, locals: 4, calls: []string{memorySlice, memoryExpand, memoryCopyIn},
+		emit: (*CodeGenerator).emitContractCall},
+	returnDataCopy:   {args: 3, calls: []string{memoryCopyIn}, emit: (*CodeGenerator).emitReturnDataCopy},
+	contractCreate:   {args: 4, locals: 2, calls: []string{memorySlice}, emit: (*CodeGenerator).emitContractCreate},
+	revertReason:     {args: 1, locals: 2, emit: (*CodeGenerator).emitRevertReason},
+	blockHashRoutine: {args: 1, locals: 1, emit: (*CodeGenerator).emitBlockHash},
+	addressHash:      {args: 1, emit: (*CodeGenerator).emitAddressHash},
+	tokenIDRoutine:   {args: 1, emit: (*CodeGenerator).emitTokenID},
+	nep11Adjust:      {args: 2, emit: (*CodeGenerator).emitNEP11Adjust},
+	nep11Record: {args: 4, locals: 3, calls: []string{addressHash, tokenIDRoutine, nep11Adjust},
+		emit: (*CodeGenerator).emitNEP11Record},
+	storageLoad:              {args: 1, emit: (*CodeGenerator).emitStorageLoad},
+	storageStore:             {args: 2, locals: 1, emit: (*CodeGenerator).emitStorageStore},
+	transientLoad:            {args: 1, emit: (*CodeGenerator).emitTransientLoad},
+	addressWordRoutine:       {args: 1, emit: (*CodeGenerator).emitAddressWord},
+	addressScriptHashRoutine: {args: 1, emit: (*CodeGenerator).emitAddressScriptHash},
+	wordDivMod:               {args: 2, locals: 1, emit: (*CodeGenerator).emitWordDivMod},
+	wordModularSum:           {args: 3, emit: (*CodeGenerator).emitWordModularSum},
+	wordAddMod:               {args: 3, calls: wordRoutines, emit: (*CodeGenerator).emitWordAddMod},
+	wordMulMod:               {args: 3, locals: 2, calls: wordRoutines, emit: (*CodeGenerator).emitWordMulMod},
+}
+
+var expands = []string{memoryExpand}
+
+var wordRoutines = []string{wordDivMod, wordModularSum}
+
+// memoryState is the memory of the script being generated
+type memoryState struct {
+	slot       int             // Static field holding the memory buffer
+	calldata   int             // Static field holding the calldata
+	returnData int             // Static field holding the return data of the last call
+	callValue  int             // Static field holding the call value of a payment
+	sender     int             // Static field holding the from account of a NEP-17 transfer
+	storage    int             // Static field holding the storage context
+	transient  int             // Static field holding the transient storage map
+	routines   map[string]bool // Routines called so far
+}
+
+// usesMemory reports whether block, including its functions, calls a
+// memory built-in
+func usesMemory(block *YulBlock) bool {
+	used := false
+	walkBlock(block, func(b *YulBlock) {
+		for _, stmt := range b.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(expr YulExpression) {
+					if call, ok := expr.(*YulFunctionCall); ok && memoryBuiltins[call.FunctionName.Name] {
+						used = true
+					}
+				})
+			}
+		}
+	})
+	return used
+}
+
+// emitMemoryInit allocates the empty memory buffer
+func (g *CodeGenerator) emitMemoryInit(location SourcePosition) {
+	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(0)), location)
+	g.emitInstruction(NewArithmeticInstruction(NEWBUFFER), location)
+	g.emitInstruction(NewSlotInstruction(STSFLD, g.memory.slot), location)
+}
+
+// generateMemoryBuiltin emits a memory built-in with its arguments on the
+// stack, first on top, and reports whether name is one
+func (g *CodeGenerator) generateMemoryBuiltin(name string, location SourcePosition) bool {
+	switch name {
+	case "mload":
+		g.emitMemoryCall(memoryLoad, 1, 1, location)
+	case "mstore":
+		g.emitMemoryCall(memoryStore, 2, 0, location)
+	case "mstore8":
+		g.emitMemoryCall(memoryStore8, 2, 0, location)
+	case "msize":
+		g.emitInstruction(NewSlotInstruction(LDSFLD, g.memory.slot), location)
+		g.emitInstruction(NewArithmeticInstruction(SIZE), location)
+	case "mcopy":
+		g.emitMemoryCall(memoryCopy, 3, 0, location)
+	case "datacopy", "codecopy":
+		g.emitInstruction(NewPushInstruction(CreateNeoVMByteString(g.dataArea())), location)
+		g.emitInstruction(NewStackInstruction(SWAP), location)
+		g.emitMemoryCall(memoryCopyIn, 4, 0, location)
+	default:
+		return false
+	}
+	return true
+}
+
+// emitMemoryCall calls a memory routine, which is emitted with the script
+func (g *CodeGenerator) emitMemoryCall(routine string, pop, push int, location SourcePosition) {
+	g.useRoutine(routine)
+	instr := NewControlFlowInstruction(CALL, 0)
+	instr.StackPop, instr.StackPush = pop, push
+	g.emitInstruction(instr, location)
+	g.addPendingLabel(routine, len(g.instructions)-1)
+}
+
+// useRoutine marks routine and the routines it calls for emission
+func (g *CodeGenerator) useRoutine(routine string) {
+	if g.memory.routines[routine] {
+		return
+	}
+	g.memory.routines[routine] = true
+	for _, callee := range memoryRoutines[routine].calls {
+		g.useRoutine(callee)
+	}
+}
+
+// emitMemoryRoutines emits the routines called by the script. The
+// top-level code returns before them.
+func (g *CodeGenerator) emitMemoryRoutines(location SourcePosition) {
+	if len(g.memory.routines) == 0 {
+		return
+	}
+	g.emitReturnGuard(location)
+
+	depth := g.stackTracker.currentDepth
+	for _, name := range memoryRoutineOrder {
+		if !g.memory.routines[name] {
+			continue
+		}
+		routine := memoryRoutines[name]
+		g.stackTracker.currentDepth = routine.args
+		g.markLabel(name)
+		g.emitInstruction(NewInitSlotInstruction(routine.locals, routine.args), location)
+		routine.emit(g, location)
+		g.emitInstruction(NewControlFlowInstruction(RET, 0), location)
+	}
+	g.stackTracker.currentDepth = depth
+}
+
+// memoryCode emits the instructions of a memory routine body
+type memoryCode struct {
+	g        *CodeGenerator
+	location SourcePosition
+}
+
+func (c memoryCode) op(instr NeoInstruction) {
+	c.g.emitInstruction(instr, c.location)
+}
+
+func (c memoryCode) push(value interface{}) {
+	c.op(NewPushInstruction(CreateNeoVMInteger(value)))
+}
+
+func (c memoryCode) arithmetic(ops ...NeoOpcode) {
+	for _, op := range ops {
+		c.op(NewArithmeticInstruction(op))
+	}
+}
+
+func (c memoryCode) stack(ops ...NeoOpcode) {
+	for _, op := range ops {
+		c.op(NewStackInstruction(op))
+	}
+}
+
+func (c memoryCode) arg(index int) {
+	c.op(NewSlotInstruction(LDARG, index))
+}
+
+func (c memoryCode) memory() {
+	c.op(NewSlotInstruction(LDSFLD, c.g.memory.slot))
+}
+
+func (c memoryCode) jump(op NeoOpcode, label string) {
+	c.op(NewControlFlowInstruction(op, 0))
+	c.g.addPendingLabel(label, len(c.g.instructions)-1)
+}
+
+// call calls one of the routines the routine being emitted lists in calls
+func (c memoryCode) call(routine string, pop, push int) {
+	instr := NewControlFlowInstruction(CALL, 0)
+	instr.StackPop, instr.StackPush = pop, push
+	c.op(instr)
+	c.g.addPendingLabel(routine, len(c.g.instructions)-1)
+}
+
+// expand calls memory_expand for the end offset on top of the stack
+func (c memoryCode) expand() {
+	c.call(memoryExpand, 1, 0)
+}
+
+// emitMemoryExpand grows memory to cover [0, end), rounded up to a whole
+// number of words
+func (g *CodeGenerator) emitMemoryExpand(location SourcePosition) {
+	c := memoryCode{g, location}
+	done := g.createUniqueLabel("memory_expand_done")
+
+	c.arg(0)
+	c.push(31)
+	c.arithmetic(ADD)
+	c.push(32)
+	c.arithmetic(DIV)
+	c.push(32)
+	c.arithmetic(MUL)
+	c.op(NewSlotInstruction(STARG, 0))
+
+	if g.boundsChecking() {
+		inBounds := g.createUniqueLabel("memory_in_bounds")
+		c.arg(0)
+		c.push(MaxMemorySize)
+		c.arithmetic(GT)
+		c.jump(JMPIFNOT, inBounds)
+		c.op(NeoInstruction{Opcode: ABORT, Size: 1})
+		g.markLabel(inBounds)
+	}
+
+	c.memory()
+	c.arithmetic(SIZE)
+	c.arg(0)
+	c.arithmetic(GE)
+	c.jump(JMPIF, done)
+
+	// memory = memory ++ zeros(end - size)
+	c.memory()
+	c.arg(0)
+	c.memory()
+	c.arithmetic(SIZE, SUB, NEWBUFFER, CAT)
+	c.op(NewSlotInstruction(STSFLD, g.memory.slot))
+	g.markLabel(done)
+}
+
+// emitMemoryLoad reads the word at offset
+func (g *CodeGenerator) emitMemoryLoad(location SourcePosition) {
+	c := memoryCode{g, location}
+	c.arg(0)
+	c.push(32)
+	c.arithmetic(ADD)
+	c.expand()
+
+	c.memory()
+	c.arg(0)
+	c.push(32)
+	c.arithmetic(SUBSTR)
+
+	// Big-endian bytes to the little-endian integer of the word
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(REVERSEITEMS)
+	c.op(NewConvertInstruction(IntegerType))
+}
+
+// emitMemoryStore writes value as a word at offset
+func (g *CodeGenerator) emitMemoryStore(location SourcePosition) {
+	c := memoryCode{g, location}
+	c.arg(0)
+	c.push(32)
+	c.arithmetic(ADD)
+	c.expand()
+
+	c.memory()
+	c.arg(0)
+
+	c.arg(1)
+	c.wordBytes()
+
+	c.push(0)
+	c.push(32)
+	c.arithmetic(MEMCPY)
+}
+
+// emitMemoryStore8 writes the low byte of value at offset
+func (g *CodeGenerator) emitMemoryStore8(location SourcePosition) {
+	c := memoryCode{g, location}
+	c.arg(0)
+	c.push(1)
+	c.arithmetic(ADD)
+	c.expand()
+
+	c.memory()
+	c.arg(0)
+	c.arg(1)
+	c.push(0xff)
+	c.arithmetic(AND, SETITEM)
+}
+
+// emitMemoryCopy copies length bytes from src to dst within memory
+func (g *CodeGenerator) emitMemoryCopy(location SourcePosition) {
+	c := memoryCode{g, location}
+	done := g.createUniqueLabel("memory_copy_done")
+
+	c.arg(2)
+	c.jump(JMPIFNOT, done)
+	c.arg(0)
+	c.arg(1)
+	c.arithmetic(MAX)
+	c.arg(2)
+	c.arithmetic(ADD)
+	c.expand()
+
+	c.memory()
+	c.arg(0)
+	c.memory()
+	c.arg(1)
+	c.arg(2)
+	c.arithmetic(MEMCPY)
+	g.markLabel(done)
+}
+
+// emitMemoryCopyIn copies length bytes of source, starting at offset, to
+// dst in memory. Bytes past the end of source read as zero.
+func (g *CodeGenerator) emitMemoryCopyIn(location SourcePosition) {
+	c := memoryCode{g, location}
+	pad := g.createUniqueLabel("memory_copy_in_pad")
+	done := g.createUniqueLabel("memory_copy_in_done")
+
+	c.arg(3)
+	c.jump(JMPIFNOT, done)
+	c.arg(0)
+	c.arg(3)
+	c.arithmetic(ADD)
+	c.expand()
+
+	// available = max(0, min(length, size(source) - offset))
+	c.arg(1)
+	c.arithmetic(SIZE)
+	c.arg(2)
+	c.arithmetic(SUB)
+	c.arg(3)
+	c.arithmetic(MIN)
+	c.push(0)
+	c.arithmetic(MAX)
+	c.op(NewSlotInstruction(STLOC, 0))
+
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.jump(JMPIFNOT, pad)
+	c.memory()
+	c.arg(0)
+	c.arg(1)
+	c.arg(2)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.arithmetic(MEMCPY)
+
+	// Zero the remaining length - available bytes
+	g.markLabel(pad)
+	c.memory()
+	c.arg(0)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.arithmetic(ADD)
+	c.arg(3)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.arithmetic(SUB, NEWBUFFER)
+	c.push(0)
+	c.arg(3)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.arithmetic(SUB, MEMCPY)
+	g.markLabel(done)
+}
+
+// emitMemorySlice returns length bytes of memory from offset as a byte
+// string. An empty slice does not grow memory.
+func (g *CodeGenerator) emitMemorySlice(location SourcePosition) {
+	c := memoryCode{g, location}
+	empty := g.createUniqueLabel("memory_slice_empty")
+	done := g.createUniqueLabel("memory_slice_done")
+
+	c.arg(1)
+	c.jump(JMPIFNOT, empty)
+	c.arg(0)
+	c.arg(1)
+	c.arithmetic(ADD)
+	c.expand()
+
+	c.memory()
+	c.arg(0)
+	c.arg(1)
+	c.arithmetic(SUBSTR)
+	c.op(NewConvertInstruction(ByteStringType))
+	c.jump(JMP, done)
+
+	g.markLabel(empty)
+	g.stackTracker.currentDepth--
+	c.op(NewPushInstruction(CreateNeoVMByteString([]byte{})))
+	g.markLabel(done)
+}
+
+// boundsChecking reports whether runtime bounds checks are enabled
+func (g *CodeGenerator) boundsChecking() bool {
+	return g.context != nil && g.context.BoundsChecking
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Method tokens.
+//
+// Libraries are deployed contracts whose script hashes are known at compile
+// time, configured as "name=hash" with the hash as displayed in manifests.
+// linkersymbol("name") is the address of library name, the address word of
+// its hash like that of any other contract, or a placeholder Link resolves
+// when the library is not configured.
+//
+// An external call whose address is a library, as linkersymbol or as a
+// literal, gets a method token for the ExternalCallMethod of the library
+// with the call flags of the call. The contract_call routine then invokes
+// tokens through CALLT, which is cheaper than System.Contract.Call, and
+// other contracts dynamically. Tokens are serialized into the NEF; only the
+// contract script has them, so the constructor calls every contract
+// dynamically.
+
+// Library is a deployed contract known at compile time
+type Library struct {
+	Name string
+	Hash string // Script hash as displayed, "0x" and 40 hex digits
+}
+
+// ParseLibrary parses a configured library, "name=hash"
+func ParseLibrary(value string) (Library, error) {
+	name, hash, ok := strings.Cut(strings.TrimSpace(value), "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return Library{}, fmt.Errorf("library %q is not name=hash", value)
+	}
+	parsed, ok := parseScriptHash(hash)
+	if !ok {
+		return Library{}, fmt.Errorf("library %s: %q is not a script hash", name, strings.TrimSpace(hash))
+	}
+	return Library{Name: name, Hash: parsed}, nil
+}
+
+// parseScriptHash returns a displayed script hash, with or without "0x",
+// in lower case with "0x"
+func parseScriptHash(value string) (string, bool) {
+	hash := strings.ToLower(strings.TrimSpace(value))
+	if !strings.HasPrefix(hash, "0x") {
+		hash = "0x" + hash
+	}
+	if _, err := hex.DecodeString(hash[2:]); err != nil || len(hash) != 42 {
+		return "", false
+	}
+	return hash, true
+}
+
+// LibrariesFromConfig parses the libraries of config, returning those that
+// parse with the errors of those that do not
+func LibrariesFromConfig(config CompilerConfig) ([]Library, []error) {
+	var libraries []Library
+	var errs []error
+	for _, value := range config.Libraries {
+		library, err := ParseLibrary(value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		libraries = append(libraries, library)
+	}
+	return libraries, errs
+}
+
+// MethodTokenTable collects the method tokens of the contract script, in
+// the order CALLT indexes them
+type MethodTokenTable struct {
+	tokens []MethodToken
+}
+
+// NewMethodTokenTable creates an empty table
+func NewMethodTokenTable() *MethodTokenTable {
+	return &MethodTokenTable{}
+}
+
+// Add returns the index of token, adding it unless the table has it, and
+// false when the table is full
+func (t *MethodTokenTable) Add(token MethodToken) (int, bool) {
+	for i, existing := range t.tokens {
+		if existing == token {
+			return i, true
+		}
+	}
+	if len(t.tokens) == nefMaxTokens {
+		return 0, false
+	}
+	t.tokens = append(t.tokens, token)
+	return len(t.tokens) - 1, true
+}
+
+// Tokens returns the tokens in index order
+func (t *MethodTokenTable) Tokens() []MethodToken {
+	if t == nil {
+		return nil
+	}
+	return t.tokens
+}
+
+// NewCallTokenInstruction calls the method of token index
+func NewCallTokenInstruction(index int, token MethodToken) NeoInstruction {
+	instr := NeoInstruction{
+		Opcode:   CALLT,
+		Operand:  []byte{byte(index), byte(index >> 8)},
+		Size:     3,
+		StackPop: int(token.ParametersCount),
+		GasCost:  opcodeTable[CALLT].Price,
+		Comment:  fmt.Sprintf("CALLT %s", token.Method),
+	}
+	if token.HasReturnValue {
+		instr.StackPush = 1
+	}
+	return instr
+}
+
+// library returns the configured library named name
+func (g *CodeGenerator) library(name string) (Library, bool) {
+	if g.context != nil {
+		for _, library := range g.context.Libraries {
+			if library.Name == name {
+				return library, true
+			}
+		}
+	}
+	return Library{}, false
+}
+
+// generateLinkerSymbol pushes the address of the library a linkersymbol
+// call names
+func (g *CodeGenerator) generateLinkerSymbol(call *YulFunctionCall) error {
+	if len(call.Arguments) != 1 {
+		return fmt.Errorf("linkersymbol expects 1 argument, got %d at line %d", len(call.Arguments), call.Location.Line)
+	}
+	lit, ok := call.Arguments[0].(*YulLiteral)
+	if !ok || lit.Kind != LiteralKindString {
+		return fmt.Errorf("linkersymbol expects a string literal at line %d", call.Location.Line)
+	}
+	library, ok := g.library(lit.Value)
+	if !ok {
+		g.warn(fmt.Sprintf("linkersymbol: library %q is not configured; link it before deployment", lit.Value), call.Location)
+		g.emitInstruction(NewLinkPlaceholder(lit.Value), call.Location)
+		return nil
+	}
+	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(g.addressTranslation().Word(library.Hash))), call.Location)
+	return nil
+}
+
+// staticLibrary returns the library an address expression always names
+func (g *CodeGenerator) staticLibrary(address YulExpression) (Library, bool) {
+	if g.context == nil {
+		return Library{}, false
+	}
+	switch expr := address.(type) {
+	case *YulFunctionCall:
+		if expr.FunctionName.Name != "linkersymbol" || len(expr.Arguments) != 1 {
+			return Library{}, false
+		}
+		if lit, ok := expr.Arguments[0].(*YulLiteral); ok {
+			return g.library(lit.Value)
+		}
+	case *YulLiteral:
+		value, err := ParseYulLiteralValue(expr)
+		if err != nil {
+			return Library{}, false
+		}
+		for _, library := range g.context.Libraries {
+			if toWord(value).Cmp(g.addressTranslation().Word(library.Hash)) == 0 {
+				return library, true
+			}
+		}
+	}
+	return Library{}, false
+}
+
+// addCallToken adds the token for calls to library with flags, if the
+// contract script has a token table
+func (g *CodeGenerator) addCallToken(library Library, flags int) {
+	if g.tokens == nil {
+		return
+	}
+	token := MethodToken{Method: ExternalCallMethod, ParametersCount: 2, HasReturnValue: true, CallFlags: byte(flags)}
+	copy(token.Hash[:], scriptHashBytes(library.Hash))
+	if _, ok := g.tokens.Add(token); !ok {
+		g.warn(fmt.Sprintf("more than %d method tokens; %s is called dynamically", nefMaxTokens, library.Name), SourcePosition{})
+	}
+}
+
+// emitTokenCalls calls the token matching the flags and address arguments
+// of contract_call through CALLT, with [selector, arguments] on top of the
+// stack, and continues at called
+func (g *CodeGenerator) emitTokenCalls(called string, location SourcePosition) {
+	if g.tokens == nil {
+		return
+	}
+	c := memoryCode{g, location}
+	for i, token := range g.tokens.Tokens() {
+		next := g.createUniqueLabel("contract_call_token")
+		c.arg(1)
+		c.addressScriptHash()
+		c.op(NewPushInstruction(CreateNeoVMByteString(token.Hash[:])))
+		c.arithmetic(EQUAL)
+		c.arg(0)
+		c.push(int(token.CallFlags))
+		c.arithmetic(NUMEQUAL, BOOLAND)
+		c.jump(JMPIFNOT, next)
+
+		// CALLT takes the selector on top of the arguments
+		unpack := NewArithmeticInstruction(UNPACK)
+		unpack.StackPop, unpack.StackPush = 1, 3
+		c.op(unpack)
+		c.op(NewStackInstruction(DROP))
+		c.op(NewCallTokenInstruction(i, token))
+		c.jump(JMP, called)
+		g.markLabel(next)
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Instruction stream diffing and pass bisection for miscompile investigations.
+//
+// A PassBisector compiles the same source with a growing prefix of the
+// optimization pipeline and binary-searches for the first pass whose output
+// is no longer equivalent to the unoptimized build. By default builds are
+// equivalent when they behave the same: the ExecutionOracle runs both in a
+// TestHost on the same generated inputs and compares results, notifications
+// and storage. The oracles compare any two contracts, so builds of two
+// compiler releases can be compared with Equivalent; bisecting between
+// releases, whose pipelines differ, is not supported.
+
+// DiffKind classifies a line of an instruction stream diff
+type DiffKind string
+
+const (
+	DiffEqual  DiffKind = "="
+	DiffInsert DiffKind = "+"
+	DiffDelete DiffKind = "-"
+)
+
+// InstructionDiff is one entry of an instruction stream diff
+type InstructionDiff struct {
+	Kind        DiffKind
+	OldIndex    int // -1 for inserted instructions
+	NewIndex    int // -1 for deleted instructions
+	Instruction NeoInstruction
+}
+
+// DiffInstructionStreams computes a minimal edit script turning a into b.
+// Instructions compare equal when opcode and operand match; source
+// references and comments are ignored.
+func DiffInstructionStreams(a, b []NeoInstruction) []InstructionDiff {
+	// Longest common subsequence table, filled from the end
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if sameInstruction(a[i], b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []InstructionDiff
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case sameInstruction(a[i], b[j]):
+			diff = append(diff, InstructionDiff{DiffEqual, i, j, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, InstructionDiff{DiffDelete, i, -1, a[i]})
+			i++
+		default:
+			diff = append(diff, InstructionDiff{DiffInsert, -1, j, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, InstructionDiff{DiffDelete, i, -1, a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, InstructionDiff{DiffInsert, -1, j, b[j]})
+	}
+	return diff
+}
+
+func sameInstruction(a, b NeoInstruction) bool {
+	return a.Opcode == b.Opcode && bytes.Equal(a.Operand, b.Operand)
+}
+
+// HasChanges reports whether a diff contains any insertion or deletion
+func HasChanges(diff []InstructionDiff) bool {
+	for _, d := range diff {
+		if d.Kind != DiffEqual {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatInstructionDiff renders a diff in unified style, keeping context
+// lines around each change
+func FormatInstructionDiff(diff []InstructionDiff, context int) string {
+	var builder strings.Builder
+
+	show := make([]bool, len(diff))
+	for i, d := range diff {
+		if d.Kind == DiffEqual {
+			continue
+		}
+		for k := i - context; k <= i+context; k++ {
+			if k >= 0 && k < len(diff) {
+				show[k] = true
+			}
+		}
+	}
+
+	skipped := false
+	for i, d := range diff {
+		if !show[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			builder.WriteString("...\n")
+			skipped = false
+		}
+		builder.WriteString(fmt.Sprintf("%s %-12s", d.Kind, OpcodeMnemonic(d.Instruction.Opcode)))
+		if len(d.Instruction.Operand) > 0 {
+			builder.WriteString(fmt.Sprintf(" %x", d.Instruction.Operand))
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// SemanticOracle decides whether two builds of the same source behave the same
+type SemanticOracle interface {
+	Equivalent(reference, candidate *NeoContract) (bool, string, error)
+}
+
+// InstructionStreamOracle treats builds as equivalent only when their runtime
+// instruction streams are identical. It is the strictest oracle, flagging
+// every pass that changes the code whether or not the change is sound.
+type InstructionStreamOracle struct{}
+
+func (InstructionStreamOracle) Equivalent(reference, candidate *NeoContract) (bool, string, error) {
+	diff := DiffInstructionStreams(reference.Runtime, candidate.Runtime)
+	if !HasChanges(diff) {
+		return true, "", nil
+	}
+	return false, FormatInstructionDiff(diff, 2), nil
+}
+
+// ExecutionOracle treats builds as equivalent when invoking their methods
+// with the same generated arguments, in the same order, gives the same
+// outcomes. Each build is deployed in its own TestHost, under the script
+// hash of the reference so that the address of the contract cannot tell
+// them apart.
+type ExecutionOracle struct {
+	Seed     int64 // Seed of the generated arguments
+	Rounds   int   // Invocations of each method, 4 when 0
+	GasLimit int64 // Datoshi per invocation, 10 GAS when 0
+}
+
+func (o ExecutionOracle) Equivalent(reference, candidate *NeoContract) (bool, string, error) {
+	var methods []*ContractMethod
+	for _, method := range reference.Methods {
+		if strings.HasPrefix(method.Name, "_") {
+			continue
+		}
+		if other := findContractMethod(candidate, method.Name); other == nil || len(other.Parameters) != len(method.Parameters) {
+			return false, fmt.Sprintf("method %s/%d is missing", method.Name, len(method.Parameters)), nil
+		}
+		methods = append(methods, method)
+	}
+
+	hash := NewNeoVMExecutionEngine(reference.Runtime).scriptHash()
+	a, errA := o.deploy(reference, hash)
+	b, errB := o.deploy(candidate, hash)
+	if (errA == nil) != (errB == nil) {
+		return false, fmt.Sprintf("deploy: %v, expected %v", errB, errA), nil
+	}
+
+	rounds := o.Rounds
+	if rounds == 0 {
+		rounds = 4
+	}
+	r := rand.New(rand.NewSource(o.Seed))
+	for round := 0; round < rounds; round++ {
+		for _, method := range methods {
+			args := make([]interface{}, len(method.Parameters))
+			for i, param := range method.Parameters {
+				args[i] = generatedArgument(r, param.Type)
+			}
+			why := sameInvocation(a.Invoke(method.Name, args...), b.Invoke(method.Name, args...))
+			if why == "" {
+				why = sameStorage(a.Engine.Storage, b.Engine.Storage)
+			}
+			if why != "" {
+				return false, fmt.Sprintf("%s%v: %s", method.Name, args, why), nil
+			}
+		}
+	}
+	return true, "", nil
+}
+
+// deploy deploys contract in a new host under the script hash hash
+func (o ExecutionOracle) deploy(contract *NeoContract, hash []byte) (*TestHost, error) {
+	host := NewTestHost()
+	host.GasLimit = o.GasLimit
+	if host.GasLimit == 0 {
+		host.GasLimit = 10 * 100000000
+	}
+	host.Contract, host.Engine = contract, NewNeoVMExecutionEngine(contract.Runtime)
+	scriptHash := func([]NeoVMStackItem) (NeoVMStackItem, error) {
+		return &NeoVMByteString{Value: append([]byte{}, hash...)}, nil
+	}
+	host.Engine.InteropServices["System.Runtime.GetExecutingScriptHash"] = scriptHash
+	host.Engine.InteropServices["System.Runtime.GetEntryScriptHash"] = scriptHash
+	if findContractMethod(contract, DeployMethod) != nil {
+		return host, host.Invoke(DeployMethod, nil, false).Err
+	}
+	return host, nil
+}
+
+// findContractMethod returns the method of contract called name, nil when
+// there is none
+func findContractMethod(contract *NeoContract, name string) *ContractMethod {
+	for _, method := range contract.Methods {
+		if method.Name == name {
+			return method
+		}
+	}
+	return nil
+}
+
+// generatedArgument picks an argument of the ABI type kind, words at the
+// edges of their range more often than not
+func generatedArgument(r *rand.Rand, kind string) interface{} {
+	switch kind {
+	case "Boolean":
+		return r.Intn(2) == 1
+	case "Hash160":
+		var account Uint160
+		r.Read(account[:])
+		return account
+	case "ByteArray", "ByteString":
+		// A selector and argument words
+		data := make([]byte, 4+32*r.Intn(3))
+		r.Read(data)
+		return data
+	case "Array":
+		return []interface{}{}
+	case "Any":
+		return nil
+	}
+	edges := []*big.Int{
+		big.NewInt(0), big.NewInt(1), big.NewInt(2), big.NewInt(32),
+		new(big.Int).Lsh(big.NewInt(1), 255),
+		new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1)),
+	}
+	if r.Intn(2) == 0 {
+		return edges[r.Intn(len(edges))]
+	}
+	if r.Intn(2) == 0 {
+		return big.NewInt(r.Int63n(1000))
+	}
+	word := make([]byte, 32)
+	r.Read(word)
+	return new(big.Int).SetBytes(word)
+}
+
+// sameInvocation explains how the candidate invocation b differs from the
+// reference a, empty when it does not
+func sameInvocation(a, b *Invocation) string {
+	switch {
+	case (a.Err == nil) != (b.Err == nil):
+		return fmt.Sprintf("got %v, expected %v", b.Err, a.Err)
+	case a.Err != nil:
+		return ""
+	case !sameItems(a.Stack, b.Stack):
+		return fmt.Sprintf("returned %v, expected %v", b.Stack, a.Stack)
+	case len(a.Notifications) != len(b.Notifications):
+		return fmt.Sprintf("raised %d notifications, expected %d", len(b.Notifications), len(a.Notifications))
+	}
+	for i, n := range a.Notifications {
+		m := b.Notifications[i]
+		if n.EventName != m.EventName || !sameItems([]NeoVMStackItem{n.State}, []NeoVMStackItem{m.State}) {
+			return fmt.Sprintf("raised %s%v, expected %s%v", m.EventName, m.State, n.EventName, n.State)
+		}
+	}
+	if strings.Join(a.Logs, "\n") != strings.Join(b.Logs, "\n") {
+		return fmt.Sprintf("logged %q, expected %q", b.Logs, a.Logs)
+	}
+	return ""
+}
+
+// sameStorage explains how the candidate storage b differs from the
+// reference a, empty when it does not
+func sameStorage(a, b map[string][]byte) string {
+	for key, value := range a {
+		if other, ok := b[key]; !ok || !bytes.Equal(value, other) {
+			return fmt.Sprintf("storage %x holds %x, expected %x", key, other, value)
+		}
+	}
+	for key, value := range b {
+		if _, ok := a[key]; !ok {
+			return fmt.Sprintf("storage %x holds %x, expected nothing", key, value)
+		}
+	}
+	return ""
+}
+
+// sameItems reports whether the items of two engines hold the same values:
+// arrays and structs item by item, other items by type and bytes
+func sameItems(a, b []NeoVMStackItem) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, xOK := itemsOf(a[i])
+		y, yOK := itemsOf(b[i])
+		if xOK || yOK {
+			if xOK != yOK || typeName(a[i]) != typeName(b[i]) || !sameItems(x, y) {
+				return false
+			}
+			continue
+		}
+		if typeName(a[i]) != typeName(b[i]) {
+			return false
+		}
+		p, errP := bytesOf(a[i])
+		q, errQ := bytesOf(b[i])
+		if (errP == nil) != (errQ == nil) || !bytes.Equal(p, q) {
+			return false
+		}
+	}
+	return true
+}
+
+// PassBisector locates the optimization pass that introduces a difference
+type PassBisector struct {
+	Config CompilerConfig     // Base configuration used for every build
+	Passes []OptimizationPass // Pipeline to bisect, in application order
+	Oracle SemanticOracle
+}
+
+// BisectionResult reports the outcome of bisecting one source
+type BisectionResult struct {
+	Source       string
+	Culprit      string // Name of the first pass producing a difference, empty if none
+	CulpritIndex int    // Index into Passes, -1 if none
+	Details      string // Oracle explanation for the difference
+	Builds       int    // Number of compilations performed
+}
+
+// NewPassBisector creates a bisector over the given passes judging builds
+// with oracle, an ExecutionOracle when nil
+func NewPassBisector(config CompilerConfig, passes []OptimizationPass, oracle SemanticOracle) *PassBisector {
+	if oracle == nil {
+		oracle = ExecutionOracle{}
+	}
+	return &PassBisector{
+		Config: config,
+		Passes: passes,
+		Oracle: oracle,
+	}
+}
+
+// Bisect finds the first pass whose inclusion changes the compiled output of
+// source relative to a build with no AST passes.
+func (b *PassBisector) Bisect(name, source string) (*BisectionResult, error) {
+	result := &BisectionResult{Source: name, CulpritIndex: -1}
+
+	reference, err := b.build(source, 0)
+	result.Builds++
+	if err != nil {
+		return nil, fmt.Errorf("reference build failed: %w", err)
+	}
+
+	full, err := b.build(source, len(b.Passes))
+	result.Builds++
+	if err != nil {
+		return nil, fmt.Errorf("optimized build failed: %w", err)
+	}
+	same, details, err := b.Oracle.Equivalent(reference, full)
+	if err != nil {
+		return nil, err
+	}
+	if same {
+		return result, nil
+	}
+
+	// Invariant: prefix lo is equivalent, prefix hi is not
+	lo, hi := 0, len(b.Passes)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		candidate, err := b.build(source, mid)
+		result.Builds++
+		if err != nil {
+			// A pass that breaks compilation is as much a culprit as one
+			// that changes semantics
+			hi, details = mid, err.Error()
+			continue
+		}
+		equivalent, why, err := b.Oracle.Equivalent(reference, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if equivalent {
+			lo = mid
+		} else {
+			hi, details = mid, why
+		}
+	}
+
+	result.CulpritIndex = hi - 1
+	result.Culprit = b.Passes[hi-1].Name()
+	result.Details = details
+	return result, nil
+}
+
+// BisectCorpus bisects every source in corpus, keyed by name, and returns the
+// results in name order
+func (b *PassBisector) BisectCorpus(corpus map[string]string) ([]*BisectionResult, error) {
+	names := make([]string, 0, len(corpus))
+	for name := range corpus {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]*BisectionResult, 0, len(names))
+	for _, name := range names {
+		result, err := b.Bisect(name, corpus[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// build compiles source with only the first n passes of the pipeline enabled.
+// A fresh compiler is used each time so no state leaks between builds.
+func (b *PassBisector) build(source string, n int) (*NeoContract, error) {
+	compiler := NewYulToNeoCompiler(b.Config)
+	compiler.Optimizer.SetPasses(b.Passes[:n])
+
+	result, err := compiler.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	return result.Contract, nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// NEF files.
+//
+// Neo nodes deploy the NEF3 binary format rather than the JSON contract:
+//
+//	magic     uint32   "NEF3"
+//	compiler  [64]byte name and version of the compiler, zero-padded
+//	source    varstr   URL of the source code, at most 256 bytes
+//	reserved  byte     0
+//	tokens    vararray method tokens, at most 128
+//	reserved  uint16   0
+//	script    varbytes the contract script
+//	checksum  uint32   first 4 bytes of SHA256(SHA256(everything before))
+//
+// Integers are little-endian. Variable-length fields carry a Neo var-int
+// length prefix. The script is the runtime; the constructor is deployed
+// separately.
+
+// NEFMagic is "NEF3" read as a little-endian uint32
+const NEFMagic uint32 = 0x3346454E
+
+// NEF field limits
+const (
+	nefCompilerLength = 64
+	nefMaxSource      = 256
+	nefMaxTokens      = 128
+	nefMaxMethod      = 32
+)
+
+// MaxNEFScriptSize is the largest script a NEF file holds: the MaxItemSize
+// of NeoVM's default execution limits
+const MaxNEFScriptSize = NeoMaxItemSize
+
+// NEFCompilerName identifies this compiler in NEF files
+var NEFCompilerName = "neo-solidity-" + CompilerVersion
+
+// MethodToken is a call to another contract's method through CALLT
+type MethodToken struct {
+	Hash            [20]byte `json:"hash"` // Script hash, little-endian
+	Method          string   `json:"method"`
+	ParametersCount uint16   `json:"parameters_count"`
+	HasReturnValue  bool     `json:"has_return_value"`
+	CallFlags       byte     `json:"call_flags"`
+}
+
+// NEFFile is a decoded NEF file
+type NEFFile struct {
+	Compiler string
+	Source   string
+	Tokens   []MethodToken
+	Script   []byte
+	Checksum uint32
+}
+
+// EncodeNEF serializes the runtime of contract as a NEF file
+func EncodeNEF(contract *NeoContract) ([]byte, error) {
+	if contract == nil {
+		return nil, errors.New("no contract to encode")
+	}
+	if unlinked := contract.UnlinkedLibraries(); len(unlinked) > 0 {
+		return nil, fmt.Errorf("unresolved library symbols: %s", strings.Join(unlinked, ", "))
+	}
+	script, err := contract.Script()
+	if err != nil {
+		return nil, err
+	}
+	if len(script) == 0 {
+		return nil, errors.New("contract script is empty")
+	}
+	if len(script) > MaxNEFScriptSize {
+		return nil, fmt.Errorf("contract script is %d bytes, NEF allows %d", len(script), MaxNEFScriptSize)
+	}
+	if len(contract.MethodTokens) > nefMaxTokens {
+		return nil, fmt.Errorf("%d method tokens, NEF allows %d", len(contract.MethodTokens), nefMaxTokens)
+	}
+	if len(NEFCompilerName) > nefCompilerLength {
+		return nil, fmt.Errorf("compiler name %q exceeds %d bytes", NEFCompilerName, nefCompilerLength)
+	}
+
+	for _, token := range contract.MethodTokens {
+		if len(token.Method) > nefMaxMethod {
+			return nil, fmt.Errorf("method token %q exceeds %d bytes", token.Method, nefMaxMethod)
+		}
+		if len(token.Method) > 0 && token.Method[0] == '_' {
+			return nil, fmt.Errorf("method token %q cannot start with an underscore", token.Method)
+		}
+	}
+	return encodeNEF(&NEFFile{Compiler: NEFCompilerName, Tokens: contract.MethodTokens, Script: script}), nil
+}
+
+// encodeNEF serializes file with the checksum of its fields
+func encodeNEF(file *NEFFile) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, NEFMagic)
+	compiler := make([]byte, nefCompilerLength)
+	copy(compiler, file.Compiler)
+	buf.Write(compiler)
+	writeVarBytes(&buf, []byte(file.Source))
+	buf.WriteByte(0)
+	writeVarInt(&buf, uint64(len(file.Tokens)))
+	for _, token := range file.Tokens {
+		buf.Write(token.Hash[:])
+		writeVarBytes(&buf, []byte(token.Method))
+		binary.Write(&buf, binary.LittleEndian, token.ParametersCount)
+		if token.HasReturnValue {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		buf.WriteByte(token.CallFlags)
+	}
+	binary.Write(&buf, binary.LittleEndian, uint16(0))
+	writeVarBytes(&buf, file.Script)
+	binary.Write(&buf, binary.LittleEndian, nefChecksum(buf.Bytes()))
+	return buf.Bytes()
+}
+
+// DecodeNEF parses a NEF file and verifies its checksum
+func DecodeNEF(data []byte) (*NEFFile, error) {
+	r := &nefReader{data: data}
+	if r.uint32() != NEFMagic {
+		return nil, errors.New("not a NEF3 file")
+	}
+	nef := &NEFFile{}
+	nef.Compiler = string(bytes.TrimRight(r.bytes(nefCompilerLength), "\x00"))
+	nef.Source = string(r.varBytes(nefMaxSource))
+	if r.byte() != 0 {
+		r.fail("reserved byte is not 0")
+	}
+	count := r.varInt(nefMaxTokens)
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		var token MethodToken
+		copy(token.Hash[:], r.bytes(20))
+		token.Method = string(r.varBytes(nefMaxMethod))
+		token.ParametersCount = r.uint16()
+		switch r.byte() {
+		case 0:
+		case 1:
+			token.HasReturnValue = true
+		default:
+			r.fail("invalid boolean in method token")
+		}
+		token.CallFlags = r.byte()
+		nef.Tokens = append(nef.Tokens, token)
+	}
+	if r.uint16() != 0 {
+		r.fail("reserved bytes are not 0")
+	}
+	nef.Script = r.varBytes(MaxNEFScriptSize)
+	if r.err == nil && len(nef.Script) == 0 {
+		r.fail("script is empty")
+	}
+	body := r.offset
+	nef.Checksum = r.uint32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.offset != len(data) {
+		return nil, fmt.Errorf("%d trailing bytes after the checksum", len(data)-r.offset)
+	}
+	if want := nefChecksum(data[:body]); nef.Checksum != want {
+		return nil, fmt.Errorf("checksum %08x does not match %08x", nef.Checksum, want)
+	}
+	return nef, nil
+}
+
+// nefChecksum is the first 4 bytes of the double SHA-256 of data
+func nefChecksum(data []byte) uint32 {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return binary.LittleEndian.Uint32(second[:4])
+}
+
+// writeVarInt writes n in Neo's variable-length integer encoding
+func writeVarInt(buf *bytes.Buffer, n uint64) {
+	switch {
+	case n < 0xFD:
+		buf.WriteByte(byte(n))
+	case n <= 0xFFFF:
+		buf.WriteByte(0xFD)
+		binary.Write(buf, binary.LittleEndian, uint16(n))
+	case n <= 0xFFFFFFFF:
+		buf.WriteByte(0xFE)
+		binary.Write(buf, binary.LittleEndian, uint32(n))
+	default:
+		buf.WriteByte(0xFF)
+		binary.Write(buf, binary.LittleEndian, n)
+	}
+}
+
+// writeVarBytes writes data with its var-int length
+func writeVarBytes(buf *bytes.Buffer, data []byte) {
+	writeVarInt(buf, uint64(len(data)))
+	buf.Write(data)
+}
+
+// nefReader reads NEF fields, keeping the first error
+type nefReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *nefReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("NEF offset %d: %s", r.offset, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *nefReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data)-r.offset {
+		r.fail("need %d bytes, %d left", n, len(r.data)-r.offset)
+		return nil
+	}
+	b := r.data[r.offset : r.offset+n]
+	r.offset += n
+	return b
+}
+
+func (r *nefReader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *nefReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *nefReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// varInt reads a var-int of at most max
+func (r *nefReader) varInt(max uint64) uint64 {
+	var n uint64
+	switch prefix := r.byte(); prefix {
+	case 0xFD:
+		n = uint64(r.uint16())
+	case 0xFE:
+		n = uint64(r.uint32())
+	case 0xFF:
+		if b := r.bytes(8); b != nil {
+			n = binary.LittleEndian.Uint64(b)
+		}
+	default:
+		n = uint64(prefix)
+	}
+	if n > max {
+		r.fail("length %d exceeds %d", n, max)
+		return 0
+	}
+	return n
+}
+
+// varBytes reads a var-int length of at most max and that many bytes
+func (r *nefReader) varBytes(max int) []byte {
+	return r.bytes(int(r.varInt(uint64(max))))
+}
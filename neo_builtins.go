@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Neo builtins.
+//
+// Yul names may hold dots, and the neo dialect adds builtins in a neo
+// namespace that reach NeoVM features with no EVM analog:
+//
+//	neo.syscall("Service", a1, ..., an)  the interop service named by the literal
+//	neo.checkwitness(account)            1 when account witnessed the transaction
+//	neo.notify("Name", v1, ..., vn)      the notification Name with state [v1, ..., vn]
+//	neo.storage_find(prefix, options)    an iterator over the storage under prefix
+//	neo.iterator_next(iterator)          1 when the iterator moved to a value
+//	neo.iterator_value(iterator)         the value the iterator is at
+//
+// Arguments are the service's parameters, the first on top, and must number
+// what the service takes; services taking or leaving a variable number of
+// items cannot be called. Values are passed as they are: NeoVM converts
+// words where a service expects byte strings, and iterators and other items
+// only mean something to the builtins they are given to. A notification is
+// recorded in the manifest with a parameter of type Any per value.
+//
+// The parser checks the names, argument counts and literals of these calls
+// and rejects them outside the neo dialect. A function defined under the
+// name of a builtin replaces it.
+
+// Neo builtins taking literals
+const (
+	neoSyscall = "neo.syscall"
+	neoNotify  = "neo.notify"
+)
+
+// neoCallArguments are the other Neo builtins with their number of
+// arguments; each leaves one value
+var neoCallArguments = map[string]int{
+	"neo.checkwitness":   1,
+	"neo.storage_find":   2,
+	"neo.iterator_next":  1,
+	"neo.iterator_value": 1,
+}
+
+// isNeoBuiltin reports whether name is a Neo builtin, or would be one in
+// the neo namespace
+func isNeoBuiltin(name string) bool {
+	return strings.HasPrefix(name, "neo.")
+}
+
+// knownNeoBuiltin reports whether name is a Neo builtin
+func knownNeoBuiltin(name string) bool {
+	_, fixed := neoCallArguments[name]
+	return fixed || name == neoSyscall || name == neoNotify
+}
+
+// checkNeoCall checks a call to a Neo builtin and returns the number of
+// values it leaves
+func checkNeoCall(call *YulFunctionCall) (int, error) {
+	name, args := call.FunctionName.Name, len(call.Arguments)
+	expect := func(want int) error {
+		if args != want {
+			return fmt.Errorf("%s expects %d arguments, got %d", name, want, args)
+		}
+		return nil
+	}
+	switch name {
+	case neoSyscall:
+		service, err := syscallService(call)
+		if err != nil {
+			return 0, err
+		}
+		return service.Push, expect(service.Pop + 1)
+	case neoNotify:
+		if _, err := stringArgument(call); err != nil {
+			return 0, err
+		}
+		return 0, nil
+	}
+	want, ok := neoCallArguments[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown Neo builtin %s", name)
+	}
+	return 1, expect(want)
+}
+
+// stringArgument returns the string literal call takes first
+func stringArgument(call *YulFunctionCall) (string, error) {
+	if len(call.Arguments) > 0 {
+		if lit, ok := call.Arguments[0].(*YulLiteral); ok && lit.Kind == LiteralKindString {
+			return lit.Value, nil
+		}
+	}
+	return "", fmt.Errorf("%s expects a string literal as its first argument", call.FunctionName.Name)
+}
+
+// syscallService returns the interop service a neo.syscall names
+func syscallService(call *YulFunctionCall) (InteropService, error) {
+	name, err := stringArgument(call)
+	if err != nil {
+		return InteropService{}, err
+	}
+	service, ok := DefaultInteropRegistry().Lookup(name)
+	if !ok {
+		return service, fmt.Errorf("unknown interop service %q", name)
+	}
+	if service.Pop == StackVariable || service.Push == StackVariable {
+		return service, fmt.Errorf("interop service %s takes or leaves a variable number of items", name)
+	}
+	return service, nil
+}
+
+// neoStateChange reports whether call to a Neo builtin may change state
+// or notify, which read-only calls cannot
+func neoStateChange(call *YulFunctionCall) bool {
+	name := call.FunctionName.Name
+	if name == neoNotify {
+		return true
+	}
+	if name != neoSyscall {
+		return false
+	}
+	service, _ := stringArgument(call)
+	switch service {
+	case "System.Contract.Call", "System.Runtime.Notify", "System.Runtime.Log",
+		"System.Storage.Put", "System.Storage.Delete":
+		return true
+	}
+	return false
+}
+
+// generateNeoBuiltin emits a call to a Neo builtin
+func (g *CodeGenerator) generateNeoBuiltin(call *YulFunctionCall) error {
+	name, location := call.FunctionName.Name, call.Location
+	if _, err := checkNeoCall(call); err != nil {
+		return fmt.Errorf("%v at line %d", err, location.Line)
+	}
+	args := call.Arguments
+	if name == neoSyscall || name == neoNotify {
+		args = args[1:]
+	}
+	for i := len(args) - 1; i >= 0; i-- {
+		if err := g.checkValueCount(args[i], 1); err != nil {
+			return err
+		}
+		if err := g.generateExpression(args[i]); err != nil {
+			return err
+		}
+	}
+
+	c := memoryCode{g, location}
+	switch {
+	case name == neoSyscall:
+		service, _ := syscallService(call)
+		c.syscall(service.Name)
+	case name == neoNotify:
+		event, _ := stringArgument(call)
+		recorded := &ContractEvent{Name: event}
+		for i := range args {
+			recorded.Parameters = append(recorded.Parameters, EventParameter{Name: fmt.Sprintf("value%d", i+1), Type: "Any"})
+		}
+		if _, err := g.addEvent(recorded, location); err != nil {
+			return err
+		}
+		c.push(len(args))
+		pack := NewArithmeticInstruction(PACK)
+		pack.StackPop, pack.StackPush = len(args)+1, 1
+		c.op(pack)
+		c.op(NewPushInstruction(CreateNeoVMByteString(event)))
+		c.syscall("System.Runtime.Notify")
+	case name == "neo.checkwitness":
+		c.addressScriptHash()
+		c.syscall("System.Runtime.CheckWitness")
+		c.op(NewConvertInstruction(IntegerType))
+	case name == "neo.storage_find":
+		g.emitStorageContext(location)
+		c.syscall("System.Storage.Find")
+	case name == "neo.iterator_next":
+		c.syscall("System.Iterator.Next")
+		c.op(NewConvertInstruction(IntegerType))
+	case name == "neo.iterator_value":
+		c.syscall("System.Iterator.Value")
+	}
+	return nil
+}
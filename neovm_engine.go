@@ -0,0 +1,2052 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// NeoVM execution engine.
+//
+// NeoVMExecutionEngine is a reference interpreter of generated code. It runs
+// instructions the way a Neo N3 node does: stack items keep their NeoVM
+// types and convert as NeoVM converts them, routines share the evaluation
+// stack and have slots of their own, TRY frames catch THROW and the faults
+// of instructions, and every instruction is charged its price before it
+// runs. Integers are little-endian two's complement of at most 32 bytes,
+// so a byte string used as a number is read little-endian.
+//
+// SYSCALLs are served by InteropServices, which NewNeoVMExecutionEngine
+// fills with stubs of the runtime, storage and iterator services over the
+// engine's Storage, Notifications and Logs. System.Contract.Call, which
+// CALLT goes through as well, has no stub; tests add one for the contracts
+// they call. Invoke runs a method of a compiled contract:
+//
+//	engine := NewNeoVMExecutionEngine(contract.Runtime)
+//	results, err := engine.Invoke(contract, "balanceOf", CreateNeoVMByteString(owner))
+//
+// An uncaught exception, ABORT, a failed ASSERT, running out of gas or
+// exceeding a limit FAULTs the engine with a *NeoVMFault.
+
+// VMState is the state of an execution engine
+type VMState string
+
+const (
+	VMStateNone  VMState = "NONE"
+	VMStateHalt  VMState = "HALT"
+	VMStateFault VMState = "FAULT"
+)
+
+// TryState is the block of a TRY frame that is running
+type TryState int
+
+const (
+	TryStateTry TryState = iota
+	TryStateCatch
+	TryStateFinally
+)
+
+// NeoVM execution limits
+const (
+	neoVMMaxIntegerSize     = 32 // Bytes of an integer on Neo nodes
+	neoVMMaxShift           = 256
+	neoVMMaxInvocations     = 1024
+	neoVMMaxTryNesting      = 16
+	neoVMApplicationTrigger = 0x40
+	neoMainnetMagic         = 860833102
+	neoAddressVersion       = 53
+)
+
+// Options of System.Storage.Find
+const (
+	findOptionKeysOnly     = 0x01
+	findOptionRemovePrefix = 0x02
+	findOptionValuesOnly   = 0x04
+)
+
+// NeoVMNull is the null item
+type NeoVMNull struct{}
+
+func (NeoVMNull) Type() NeoVMType { return AnyType }
+func (NeoVMNull) ToBytes() []byte { return nil }
+func (NeoVMNull) String() string  { return "null" }
+func (NeoVMNull) Size() int       { return 0 }
+
+// NeoVMNotification is an event a script raised with System.Runtime.Notify
+type NeoVMNotification struct {
+	ScriptHash Uint160
+	EventName  string
+	State      NeoVMStackItem
+}
+
+// NeoVMFault is the error of an execution that FAULTed
+type NeoVMFault struct {
+	Offset    int // Script offset of the faulting instruction
+	Opcode    NeoOpcode
+	Message   string
+	Exception NeoVMStackItem // Uncaught exception, nil when the VM faulted
+}
+
+func (f *NeoVMFault) Error() string {
+	return fmt.Sprintf("FAULT at offset %d (%s): %s", f.Offset, OpcodeMnemonic(f.Opcode), f.Message)
+}
+
+// neoVMFrame is the state of a calling routine
+type neoVMFrame struct {
+	returnIndex int
+	locals      []NeoVMStackItem
+	arguments   []NeoVMStackItem
+	handlers    []ExceptionHandler
+	slotted     bool
+}
+
+// neoVMStorageContext is the interop item of System.Storage.GetContext
+type neoVMStorageContext struct {
+	readOnly bool
+}
+
+func (c *neoVMStorageContext) Type() NeoVMType { return InteropType }
+func (c *neoVMStorageContext) ToBytes() []byte { return nil }
+func (c *neoVMStorageContext) String() string  { return "StorageContext" }
+func (c *neoVMStorageContext) Size() int       { return 0 }
+
+// neoVMIterator is the interop item of System.Storage.Find
+type neoVMIterator struct {
+	items []NeoVMStackItem
+	next  int // Index of the item after the current one
+}
+
+func (i *neoVMIterator) Type() NeoVMType { return InteropType }
+func (i *neoVMIterator) ToBytes() []byte { return nil }
+func (i *neoVMIterator) String() string  { return "Iterator" }
+func (i *neoVMIterator) Size() int       { return 0 }
+
+// NewNeoVMExecutionEngine returns an engine running instructions, with
+// the stub interop services, mainnet prices and the NeoVM stack limit
+func NewNeoVMExecutionEngine(instructions []NeoInstruction) *NeoVMExecutionEngine {
+	e := &NeoVMExecutionEngine{
+		Instructions:   instructions,
+		StackLimit:     NeoVMMaxStackSize,
+		MaxIntegerSize: neoVMMaxIntegerSize,
+		State:          VMStateNone,
+		Storage:        make(map[string][]byte),
+		indices:        make(map[int]int),
+	}
+	offset := 0
+	for i, instr := range instructions {
+		e.offsets = append(e.offsets, offset)
+		e.indices[offset] = i
+		offset += instr.Size
+	}
+	e.offsets = append(e.offsets, offset)
+	e.indices[offset] = len(instructions)
+	e.InteropServices = e.stubInteropServices()
+	return e
+}
+
+// Execute runs the script from offset with the given arguments, the first
+// on top of the stack, and returns the evaluation stack it halts with,
+// bottom first
+func (e *NeoVMExecutionEngine) Execute(offset int, arguments ...NeoVMStackItem) ([]NeoVMStackItem, error) {
+	if err := e.load(offset, arguments); err != nil {
+		return nil, err
+	}
+	return e.run()
+}
+
+// Invoke runs method of contract as a node invokes it, after the
+// contract's _initialize method when it has one
+func (e *NeoVMExecutionEngine) Invoke(contract *NeoContract, method string, arguments ...NeoVMStackItem) ([]NeoVMStackItem, error) {
+	if err := e.LoadMethod(contract, method, arguments...); err != nil {
+		return nil, err
+	}
+	return e.run()
+}
+
+// LoadMethod prepares invoking method of contract, as Invoke does, for
+// running an instruction at a time with Step
+func (e *NeoVMExecutionEngine) LoadMethod(contract *NeoContract, method string, arguments ...NeoVMStackItem) error {
+	if e.Tokens == nil {
+		e.Tokens = contract.MethodTokens
+	}
+	var target, initialize *ContractMethod
+	for _, m := range contract.Methods {
+		switch m.Name {
+		case method:
+			target = m
+		case "_initialize":
+			initialize = m
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("contract %s has no method %s", contract.Name, method)
+	}
+	if err := e.load(target.Offset, arguments); err != nil {
+		return err
+	}
+	if initialize != nil {
+		return e.call(e.InstructionPointer, initialize.Offset)
+	}
+	return nil
+}
+
+// load prepares running the script from offset
+func (e *NeoVMExecutionEngine) load(offset int, arguments []NeoVMStackItem) error {
+	index, ok := e.indices[offset]
+	if !ok {
+		return fmt.Errorf("offset %d is not an instruction", offset)
+	}
+	e.State = VMStateNone
+	e.InstructionPointer = index
+	e.EvaluationStack = nil
+	e.StaticFields = nil
+	e.LocalVariables, e.Arguments, e.ExceptionHandlers = nil, nil, nil
+	e.frames, e.slotted, e.uncaught = nil, false, nil
+	for i := len(arguments) - 1; i >= 0; i-- {
+		e.push(arguments[i])
+	}
+	return nil
+}
+
+// run executes until the engine halts or faults
+func (e *NeoVMExecutionEngine) run() ([]NeoVMStackItem, error) {
+	for e.State == VMStateNone {
+		if err := e.Step(); err != nil {
+			return nil, err
+		}
+	}
+	return append([]NeoVMStackItem{}, e.EvaluationStack...), nil
+}
+
+// Step executes the next instruction, charging its price. It returns the
+// fault when the engine FAULTs; the engine is done once State is no longer
+// VMStateNone.
+func (e *NeoVMExecutionEngine) Step() error {
+	if e.State != VMStateNone {
+		return fmt.Errorf("the engine is in state %s", e.State)
+	}
+	index := e.InstructionPointer
+	instr := NeoInstruction{Opcode: RET, Size: 1}
+	if index < len(e.Instructions) {
+		instr = e.Instructions[index]
+	}
+	e.GasConsumed += e.Prices.ExecutionFee(e.Prices.InstructionPrice(instr))
+	if e.GasLimit > 0 && e.GasConsumed > e.GasLimit {
+		return e.fault(index, instr, fmt.Sprintf("gas limit of %d exceeded", e.GasLimit), nil)
+	}
+	err := e.step(instr)
+	var fault *NeoVMFault
+	if err != nil && !errors.As(err, &fault) {
+		// Faults of instructions are exceptions catch blocks can handle
+		e.InstructionPointer = index
+		err = e.throw(&NeoVMByteString{Value: []byte(err.Error())})
+	}
+	if errors.As(err, &fault) {
+		fault.Offset, fault.Opcode = e.offsets[index], instr.Opcode
+		e.State = VMStateFault
+		return fault
+	}
+	if e.StackLimit > 0 && len(e.EvaluationStack) > e.StackLimit {
+		return e.fault(index, instr, fmt.Sprintf("stack holds more than %d items", e.StackLimit), nil)
+	}
+	return nil
+}
+
+// NeoVMContext is a routine of the invocation stack
+type NeoVMContext struct {
+	Offset    int // Of the instruction the routine runs next
+	Arguments []NeoVMStackItem
+	Locals    []NeoVMStackItem
+}
+
+// InvocationStack returns the running routine and the routines that
+// called it, innermost first
+func (e *NeoVMExecutionEngine) InvocationStack() []NeoVMContext {
+	offset := func(index int) int {
+		if index < len(e.offsets) {
+			return e.offsets[index]
+		}
+		return e.offsets[len(e.offsets)-1]
+	}
+	contexts := []NeoVMContext{{offset(e.InstructionPointer), e.Arguments, e.LocalVariables}}
+	for i := len(e.frames) - 1; i >= 0; i-- {
+		frame := e.frames[i]
+		contexts = append(contexts, NeoVMContext{offset(frame.returnIndex), frame.arguments, frame.locals})
+	}
+	return contexts
+}
+
+// fault FAULTs the engine at the instruction of index
+func (e *NeoVMExecutionEngine) fault(index int, instr NeoInstruction, message string, exception NeoVMStackItem) error {
+	e.State = VMStateFault
+	return &NeoVMFault{Offset: e.offsets[index], Opcode: instr.Opcode, Message: message, Exception: exception}
+}
+
+// abort is an error the engine FAULTs with, which no handler can catch
+func abort(format string, args ...interface{}) error {
+	return &NeoVMFault{Message: fmt.Sprintf(format, args...)}
+}
+
+// push pushes item onto the evaluation stack
+func (e *NeoVMExecutionEngine) push(item NeoVMStackItem) {
+	e.EvaluationStack = append(e.EvaluationStack, item)
+}
+
+// pop pops the top item
+func (e *NeoVMExecutionEngine) pop() (NeoVMStackItem, error) {
+	n := len(e.EvaluationStack)
+	if n == 0 {
+		return nil, errors.New("stack underflow")
+	}
+	item := e.EvaluationStack[n-1]
+	e.EvaluationStack = e.EvaluationStack[:n-1]
+	return item, nil
+}
+
+// popInteger pops the top item as an integer
+func (e *NeoVMExecutionEngine) popInteger() (*big.Int, error) {
+	item, err := e.pop()
+	if err != nil {
+		return nil, err
+	}
+	return integerOf(item, e.MaxIntegerSize)
+}
+
+// popIndex pops the top item as a non-negative int no larger than max
+func (e *NeoVMExecutionEngine) popIndex(max int) (int, error) {
+	value, err := e.popInteger()
+	if err != nil {
+		return 0, err
+	}
+	if value.Sign() < 0 || value.Cmp(big.NewInt(int64(max))) > 0 {
+		return 0, fmt.Errorf("index %s out of range [0, %d]", value, max)
+	}
+	return int(value.Int64()), nil
+}
+
+// popBytes pops the top item as bytes
+func (e *NeoVMExecutionEngine) popBytes() ([]byte, error) {
+	item, err := e.pop()
+	if err != nil {
+		return nil, err
+	}
+	return bytesOf(item)
+}
+
+// popBoolean pops the top item as a boolean
+func (e *NeoVMExecutionEngine) popBoolean() (bool, error) {
+	item, err := e.pop()
+	if err != nil {
+		return false, err
+	}
+	return booleanOf(item, e.MaxIntegerSize)
+}
+
+// peek returns the item n below the top
+func (e *NeoVMExecutionEngine) peek(n int) (NeoVMStackItem, error) {
+	if n < 0 || n >= len(e.EvaluationStack) {
+		return nil, fmt.Errorf("stack holds %d items, not %d", len(e.EvaluationStack), n+1)
+	}
+	return e.EvaluationStack[len(e.EvaluationStack)-1-n], nil
+}
+
+// jump continues at the script offset of the instruction at index plus
+// relative
+func (e *NeoVMExecutionEngine) jump(index, relative int) error {
+	return e.jumpTo(e.offsets[index] + relative)
+}
+
+// jumpTo continues at offset
+func (e *NeoVMExecutionEngine) jumpTo(offset int) error {
+	target, ok := e.indices[offset]
+	if !ok {
+		return abort("jump to offset %d, which is not an instruction", offset)
+	}
+	e.InstructionPointer = target
+	return nil
+}
+
+// call runs the routine at offset, returning to the instruction at
+// returnIndex
+func (e *NeoVMExecutionEngine) call(returnIndex, offset int) error {
+	if len(e.frames) >= neoVMMaxInvocations {
+		return abort("more than %d nested calls", neoVMMaxInvocations)
+	}
+	e.frames = append(e.frames, neoVMFrame{returnIndex, e.LocalVariables, e.Arguments, e.ExceptionHandlers, e.slotted})
+	e.LocalVariables, e.Arguments, e.ExceptionHandlers, e.slotted = nil, nil, nil, false
+	return e.jumpTo(offset)
+}
+
+// ret returns from the running routine, halting when it is the first
+func (e *NeoVMExecutionEngine) ret() {
+	if len(e.frames) == 0 {
+		e.State = VMStateHalt
+		return
+	}
+	frame := e.frames[len(e.frames)-1]
+	e.frames = e.frames[:len(e.frames)-1]
+	e.InstructionPointer = frame.returnIndex
+	e.LocalVariables, e.Arguments, e.ExceptionHandlers, e.slotted = frame.locals, frame.arguments, frame.handlers, frame.slotted
+}
+
+// throw passes exception to the innermost handler frame able to take it,
+// unwinding the routines without one. It FAULTs when none is.
+func (e *NeoVMExecutionEngine) throw(exception NeoVMStackItem) error {
+	e.uncaught = exception
+	for {
+		for n := len(e.ExceptionHandlers); n > 0; n = len(e.ExceptionHandlers) {
+			handler := &e.ExceptionHandlers[n-1]
+			if handler.State == TryStateFinally || (handler.State == TryStateCatch && handler.FinallyOffset < 0) {
+				e.ExceptionHandlers = e.ExceptionHandlers[:n-1]
+				continue
+			}
+			if handler.State == TryStateTry && handler.CatchOffset >= 0 {
+				handler.State = TryStateCatch
+				e.push(exception)
+				e.uncaught = nil
+				return e.jumpTo(handler.CatchOffset)
+			}
+			handler.State = TryStateFinally
+			return e.jumpTo(handler.FinallyOffset)
+		}
+		if len(e.frames) == 0 {
+			return &NeoVMFault{Message: exceptionMessage(exception), Exception: exception}
+		}
+		e.ret()
+	}
+}
+
+// exceptionMessage is the message of an exception: a thrown array is
+// reported by its first item, as a node reports it
+func exceptionMessage(exception NeoVMStackItem) string {
+	if items, ok := itemsOf(exception); ok && len(items) > 0 {
+		exception = items[0]
+	}
+	switch item := exception.(type) {
+	case *NeoVMByteString:
+		return string(item.Value)
+	case *NeoVMBuffer:
+		return string(item.Value)
+	}
+	return exception.String()
+}
+
+// step executes instr, the instruction at InstructionPointer
+func (e *NeoVMExecutionEngine) step(instr NeoInstruction) error {
+	index := e.InstructionPointer
+	e.InstructionPointer++
+	op := instr.Opcode
+	switch {
+	case op >= PUSH0 && op <= PUSH16:
+		e.push(&NeoVMInteger{Value: big.NewInt(int64(op - PUSH0))})
+		return nil
+	case op >= INITSSLOT && op <= STARG:
+		return e.slot(op, instr.Operand)
+	case op >= JMP && op <= JMPLE_L:
+		return e.conditionalJump(index, op, instr.Operand)
+	}
+
+	switch op {
+	case PUSHINT8, PUSHINT16, PUSHINT32, PUSHINT64, PUSHINT128, PUSHINT256:
+		e.push(&NeoVMInteger{Value: decodeInteger(instr.Operand)})
+	case PUSHT, PUSHF:
+		e.push(&NeoVMBoolean{Value: op == PUSHT})
+	case PUSHA:
+		offset := e.offsets[index] + decodeJumpOffset(instr.Operand)
+		if _, ok := e.indices[offset]; !ok {
+			return abort("PUSHA to offset %d, which is not an instruction", offset)
+		}
+		e.push(&NeoVMPointer{Offset: offset})
+	case PUSHNULL:
+		e.push(NeoVMNull{})
+	case PUSHDATA1, PUSHDATA2, PUSHDATA4:
+		e.push(&NeoVMByteString{Value: append([]byte{}, instr.Operand...)})
+	case PUSHM1:
+		e.push(&NeoVMInteger{Value: big.NewInt(-1)})
+	case NOP:
+
+	// Control flow
+	case CALL, CALL_L:
+		return e.call(e.InstructionPointer, e.offsets[index]+decodeJumpOffset(instr.Operand))
+	case CALLA:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		pointer, ok := item.(*NeoVMPointer)
+		if !ok || pointer.Target != nil {
+			return fmt.Errorf("CALLA of %s, not a pointer", typeName(item))
+		}
+		return e.call(e.InstructionPointer, pointer.Offset)
+	case CALLT:
+		return e.callToken(int(binary.LittleEndian.Uint16(instr.Operand)))
+	case ABORT:
+		return abort("ABORT")
+	case ASSERT:
+		ok, err := e.popBoolean()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return abort("ASSERT failed")
+		}
+	case THROW:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.InstructionPointer = index
+		return e.throw(item)
+	case TRY, TRY_L:
+		if len(e.ExceptionHandlers) >= neoVMMaxTryNesting {
+			return abort("more than %d nested TRY blocks", neoVMMaxTryNesting)
+		}
+		width := len(instr.Operand) / 2
+		catch, finally := decodeJumpOffset(instr.Operand[:width]), decodeJumpOffset(instr.Operand[width:])
+		if catch == 0 && finally == 0 {
+			return abort("TRY without catch or finally block")
+		}
+		handler := ExceptionHandler{TryOffset: e.offsets[index], CatchOffset: -1, FinallyOffset: -1, EndOffset: -1, StackDepth: len(e.EvaluationStack)}
+		if catch != 0 {
+			handler.CatchOffset = e.offsets[index] + catch
+		}
+		if finally != 0 {
+			handler.FinallyOffset = e.offsets[index] + finally
+		}
+		e.ExceptionHandlers = append(e.ExceptionHandlers, handler)
+	case ENDTRY, ENDTRY_L:
+		n := len(e.ExceptionHandlers)
+		if n == 0 {
+			return abort("ENDTRY outside a TRY block")
+		}
+		handler := &e.ExceptionHandlers[n-1]
+		if handler.State == TryStateFinally {
+			return abort("ENDTRY in a finally block")
+		}
+		end := e.offsets[index] + decodeJumpOffset(instr.Operand)
+		if handler.FinallyOffset >= 0 {
+			handler.State, handler.EndOffset = TryStateFinally, end
+			return e.jumpTo(handler.FinallyOffset)
+		}
+		e.ExceptionHandlers = e.ExceptionHandlers[:n-1]
+		return e.jumpTo(end)
+	case ENDFINALLY:
+		n := len(e.ExceptionHandlers)
+		if n == 0 {
+			return abort("ENDFINALLY outside a TRY block")
+		}
+		handler := e.ExceptionHandlers[n-1]
+		e.ExceptionHandlers = e.ExceptionHandlers[:n-1]
+		if e.uncaught != nil {
+			e.InstructionPointer = index
+			return e.throw(e.uncaught)
+		}
+		return e.jumpTo(handler.EndOffset)
+	case RET:
+		e.ret()
+	case SYSCALL:
+		return e.syscall(string(instr.Operand))
+	case ABORTMSG:
+		message, err := e.popBytes()
+		if err != nil {
+			return err
+		}
+		return abort("ABORTMSG: %s", message)
+	case ASSERTMSG:
+		message, err := e.popBytes()
+		if err != nil {
+			return err
+		}
+		ok, err := e.popBoolean()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return abort("ASSERTMSG: %s", message)
+		}
+
+	default:
+		if err := e.stackOperation(op, instr.Operand); err != errUnknownOpcode {
+			return err
+		}
+		if err := e.arithmetic(op); err != errUnknownOpcode {
+			return err
+		}
+		if err := e.compound(op, instr.Operand); err != errUnknownOpcode {
+			return err
+		}
+		return abort("opcode 0x%02X is not supported", byte(op))
+	}
+	return nil
+}
+
+// errUnknownOpcode reports an opcode outside a group of operations
+var errUnknownOpcode = errors.New("unknown opcode")
+
+// conditionalJump executes a jump
+func (e *NeoVMExecutionEngine) conditionalJump(index int, op NeoOpcode, operand []byte) error {
+	taken := true
+	switch op {
+	case JMPIF, JMPIF_L, JMPIFNOT, JMPIFNOT_L:
+		value, err := e.popBoolean()
+		if err != nil {
+			return err
+		}
+		taken = value == (op == JMPIF || op == JMPIF_L)
+	case JMP, JMP_L:
+	default:
+		x2, err := e.popInteger()
+		if err != nil {
+			return err
+		}
+		x1, err := e.popInteger()
+		if err != nil {
+			return err
+		}
+		c := x1.Cmp(x2)
+		switch op {
+		case JMPEQ, JMPEQ_L:
+			taken = c == 0
+		case JMPNE, JMPNE_L:
+			taken = c != 0
+		case JMPGT, JMPGT_L:
+			taken = c > 0
+		case JMPGE, JMPGE_L:
+			taken = c >= 0
+		case JMPLT, JMPLT_L:
+			taken = c < 0
+		case JMPLE, JMPLE_L:
+			taken = c <= 0
+		}
+	}
+	if !taken {
+		return nil
+	}
+	return e.jump(index, decodeJumpOffset(operand))
+}
+
+// slot executes a slot instruction
+func (e *NeoVMExecutionEngine) slot(op NeoOpcode, operand []byte) error {
+	switch op {
+	case INITSSLOT:
+		if e.StaticFields != nil {
+			return abort("INITSSLOT ran twice")
+		}
+		if operand[0] == 0 {
+			return abort("INITSSLOT of no fields")
+		}
+		e.StaticFields = make(map[int]NeoVMStackItem)
+		for i := 0; i < int(operand[0]); i++ {
+			e.StaticFields[i] = NeoVMNull{}
+		}
+		return nil
+	case INITSLOT:
+		if e.slotted {
+			return abort("INITSLOT ran twice in a routine")
+		}
+		locals, args := int(operand[0]), int(operand[1])
+		if locals == 0 && args == 0 {
+			return abort("INITSLOT of no slots")
+		}
+		e.slotted = true
+		e.LocalVariables = make([]NeoVMStackItem, locals)
+		for i := range e.LocalVariables {
+			e.LocalVariables[i] = NeoVMNull{}
+		}
+		e.Arguments = make([]NeoVMStackItem, args)
+		for i := range e.Arguments {
+			item, err := e.pop()
+			if err != nil {
+				return err
+			}
+			e.Arguments[i] = item
+		}
+		return nil
+	}
+
+	// Each slot has seven 1-byte forms, then the form with an index operand
+	group := (op - LDSFLD0) / (shortSlotForms + 1)
+	index := int((op - LDSFLD0) % (shortSlotForms + 1))
+	if index == shortSlotForms {
+		index = int(operand[0])
+	}
+	var slot []NeoVMStackItem
+	switch group / 2 {
+	case 0:
+		if _, ok := e.StaticFields[index]; !ok {
+			return abort("static field %d does not exist", index)
+		}
+		if group%2 == 0 {
+			e.push(e.StaticFields[index])
+			return nil
+		}
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.StaticFields[index] = item
+		return nil
+	case 1:
+		slot = e.LocalVariables
+	default:
+		slot = e.Arguments
+	}
+	if index >= len(slot) {
+		return abort("slot %d of %d does not exist", index, len(slot))
+	}
+	if group%2 == 0 {
+		e.push(slot[index])
+		return nil
+	}
+	item, err := e.pop()
+	if err != nil {
+		return err
+	}
+	slot[index] = item
+	return nil
+}
+
+// stackOperation executes a stack instruction
+func (e *NeoVMExecutionEngine) stackOperation(op NeoOpcode, operand []byte) error {
+	stack := e.EvaluationStack
+	n := len(stack)
+	need := func(count int) error {
+		if n < count {
+			return fmt.Errorf("stack holds %d items, %s needs %d", n, OpcodeMnemonic(op), count)
+		}
+		return nil
+	}
+	switch op {
+	case DEPTH:
+		e.push(&NeoVMInteger{Value: big.NewInt(int64(n))})
+	case DROP:
+		_, err := e.pop()
+		return err
+	case NIP:
+		if err := need(2); err != nil {
+			return err
+		}
+		e.EvaluationStack = append(stack[:n-2], stack[n-1])
+	case XDROP:
+		k, err := e.popIndex(n - 2)
+		if err != nil {
+			return err
+		}
+		stack = e.EvaluationStack
+		e.EvaluationStack = append(stack[:n-2-k], stack[n-1-k:]...)
+	case CLEAR:
+		e.EvaluationStack = nil
+	case DUP:
+		item, err := e.peek(0)
+		if err != nil {
+			return err
+		}
+		e.push(item)
+	case OVER:
+		item, err := e.peek(1)
+		if err != nil {
+			return err
+		}
+		e.push(item)
+	case PICK:
+		k, err := e.popIndex(n - 2)
+		if err != nil {
+			return err
+		}
+		item, _ := e.peek(k)
+		e.push(item)
+	case TUCK:
+		if err := need(2); err != nil {
+			return err
+		}
+		top := stack[n-1]
+		e.EvaluationStack = append(append(append(stack[:n-2:n-2], top), stack[n-2]), top)
+	case SWAP:
+		if err := need(2); err != nil {
+			return err
+		}
+		stack[n-1], stack[n-2] = stack[n-2], stack[n-1]
+	case ROT:
+		if err := need(3); err != nil {
+			return err
+		}
+		stack[n-3], stack[n-2], stack[n-1] = stack[n-2], stack[n-1], stack[n-3]
+	case ROLL:
+		k, err := e.popIndex(n - 2)
+		if err != nil {
+			return err
+		}
+		stack = e.EvaluationStack
+		item := stack[n-2-k]
+		e.EvaluationStack = append(append(stack[:n-2-k:n-2-k], stack[n-1-k:]...), item)
+	case REVERSE3, REVERSE4:
+		count := 3
+		if op == REVERSE4 {
+			count = 4
+		}
+		if err := need(count); err != nil {
+			return err
+		}
+		reverseItems(stack[n-count:])
+	case REVERSEN:
+		k, err := e.popIndex(n - 1)
+		if err != nil {
+			return err
+		}
+		reverseItems(e.EvaluationStack[n-1-k:])
+	default:
+		return errUnknownOpcode
+	}
+	return nil
+}
+
+// reverseItems reverses items in place
+func reverseItems(items []NeoVMStackItem) {
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+}
+
+// arithmetic executes a splice, bitwise, arithmetic or type instruction
+func (e *NeoVMExecutionEngine) arithmetic(op NeoOpcode) error {
+	switch op {
+	case NEWBUFFER:
+		size, err := e.popIndex(NeoMaxItemSize)
+		if err != nil {
+			return err
+		}
+		e.push(&NeoVMBuffer{Value: make([]byte, size)})
+		return nil
+	case MEMCPY:
+		count, err := e.popIndex(NeoMaxItemSize)
+		if err != nil {
+			return err
+		}
+		source, err := e.popIndex(NeoMaxItemSize)
+		if err != nil {
+			return err
+		}
+		src, err := e.popBytes()
+		if err != nil {
+			return err
+		}
+		destination, err := e.popIndex(NeoMaxItemSize)
+		if err != nil {
+			return err
+		}
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		dst, ok := item.(*NeoVMBuffer)
+		if !ok {
+			return fmt.Errorf("MEMCPY into %s, not a buffer", typeName(item))
+		}
+		if source+count > len(src) || destination+count > len(dst.Value) {
+			return fmt.Errorf("MEMCPY of %d bytes out of range", count)
+		}
+		copy(dst.Value[destination:destination+count], src[source:source+count])
+		return nil
+	case CAT:
+		x2, err := e.popBytes()
+		if err != nil {
+			return err
+		}
+		x1, err := e.popBytes()
+		if err != nil {
+			return err
+		}
+		if len(x1)+len(x2) > NeoMaxItemSize {
+			return abort("CAT result larger than %d bytes", NeoMaxItemSize)
+		}
+		e.push(&NeoVMBuffer{Value: append(append([]byte{}, x1...), x2...)})
+		return nil
+	case SUBSTR, LEFT, RIGHT:
+		count, err := e.popIndex(NeoMaxItemSize)
+		if err != nil {
+			return err
+		}
+		start := 0
+		if op == SUBSTR {
+			if start, err = e.popIndex(NeoMaxItemSize); err != nil {
+				return err
+			}
+		}
+		x, err := e.popBytes()
+		if err != nil {
+			return err
+		}
+		if op == RIGHT {
+			start = len(x) - count
+		}
+		if start < 0 || start+count > len(x) {
+			return fmt.Errorf("%s of %d bytes out of range of %d", OpcodeMnemonic(op), count, len(x))
+		}
+		e.push(&NeoVMBuffer{Value: append([]byte{}, x[start:start+count]...)})
+		return nil
+	case EQUAL, NOTEQUAL:
+		x2, err := e.pop()
+		if err != nil {
+			return err
+		}
+		x1, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.push(&NeoVMBoolean{Value: itemsEqual(x1, x2) == (op == EQUAL)})
+		return nil
+	case NOT:
+		x, err := e.popBoolean()
+		if err != nil {
+			return err
+		}
+		e.push(&NeoVMBoolean{Value: !x})
+		return nil
+	case NZ:
+		x, err := e.popInteger()
+		if err != nil {
+			return err
+		}
+		e.push(&NeoVMBoolean{Value: x.Sign() != 0})
+		return nil
+	case BOOLAND, BOOLOR:
+		x2, err := e.popBoolean()
+		if err != nil {
+			return err
+		}
+		x1, err := e.popBoolean()
+		if err != nil {
+			return err
+		}
+		if op == BOOLAND {
+			e.push(&NeoVMBoolean{Value: x1 && x2})
+		} else {
+			e.push(&NeoVMBoolean{Value: x1 || x2})
+		}
+		return nil
+	case LT, LE, GT, GE:
+		x2, err := e.pop()
+		if err != nil {
+			return err
+		}
+		x1, err := e.pop()
+		if err != nil {
+			return err
+		}
+		_, null1 := x1.(NeoVMNull)
+		_, null2 := x2.(NeoVMNull)
+		if null1 || null2 {
+			e.push(&NeoVMBoolean{Value: false})
+			return nil
+		}
+		a, err := integerOf(x1, e.MaxIntegerSize)
+		if err != nil {
+			return err
+		}
+		b, err := integerOf(x2, e.MaxIntegerSize)
+		if err != nil {
+			return err
+		}
+		c := a.Cmp(b)
+		e.push(&NeoVMBoolean{Value: op == LT && c < 0 || op == LE && c <= 0 || op == GT && c > 0 || op == GE && c >= 0})
+		return nil
+	case ISNULL:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		_, null := item.(NeoVMNull)
+		e.push(&NeoVMBoolean{Value: null})
+		return nil
+	}
+
+	if f, ok := unaryOperations[op]; ok {
+		x, err := e.popInteger()
+		if err != nil {
+			return err
+		}
+		result, err := f(x)
+		if err != nil {
+			return err
+		}
+		return e.pushInteger(result)
+	}
+
+	if f, ok := binaryOperations[op]; ok {
+		x2, err := e.popInteger()
+		if err != nil {
+			return err
+		}
+		x1, err := e.popInteger()
+		if err != nil {
+			return err
+		}
+		result, err := f(x1, x2)
+		if err != nil {
+			return err
+		}
+		if b, ok := result.(bool); ok {
+			e.push(&NeoVMBoolean{Value: b})
+			return nil
+		}
+		return e.pushInteger(result.(*big.Int))
+	}
+
+	switch op {
+	case MODMUL, MODPOW, WITHIN:
+		x3, err := e.popInteger()
+		if err != nil {
+			return err
+		}
+		x2, err := e.popInteger()
+		if err != nil {
+			return err
+		}
+		x1, err := e.popInteger()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case WITHIN:
+			e.push(&NeoVMBoolean{Value: x2.Cmp(x1) <= 0 && x1.Cmp(x3) < 0})
+			return nil
+		case MODMUL:
+			if x3.Sign() == 0 {
+				return errors.New("division by zero")
+			}
+			return e.pushInteger(new(big.Int).Rem(new(big.Int).Mul(x1, x2), x3))
+		}
+		if x3.Sign() == 0 {
+			return errors.New("division by zero")
+		}
+		if x2.Sign() < 0 {
+			if x2.Cmp(big.NewInt(-1)) != 0 {
+				return fmt.Errorf("MODPOW exponent %s", x2)
+			}
+			inverse := new(big.Int).ModInverse(x1, x3)
+			if inverse == nil || x3.Sign() < 0 {
+				return errors.New("MODPOW has no inverse")
+			}
+			return e.pushInteger(inverse)
+		}
+		// .NET ModPow keeps the sign of the base
+		result := new(big.Int).Exp(new(big.Int).Abs(x1), x2, new(big.Int).Abs(x3))
+		if x1.Sign() < 0 && x2.Bit(0) == 1 {
+			result.Neg(result)
+		}
+		return e.pushInteger(result)
+	}
+	return errUnknownOpcode
+}
+
+// unaryOperations are the integer operations of one operand
+var unaryOperations = map[NeoOpcode]func(x *big.Int) (*big.Int, error){
+	INVERT: func(x *big.Int) (*big.Int, error) { return new(big.Int).Not(x), nil },
+	SIGN:   func(x *big.Int) (*big.Int, error) { return big.NewInt(int64(x.Sign())), nil },
+	ABS:    func(x *big.Int) (*big.Int, error) { return new(big.Int).Abs(x), nil },
+	NEGATE: func(x *big.Int) (*big.Int, error) { return new(big.Int).Neg(x), nil },
+	INC:    func(x *big.Int) (*big.Int, error) { return new(big.Int).Add(x, big.NewInt(1)), nil },
+	DEC:    func(x *big.Int) (*big.Int, error) { return new(big.Int).Sub(x, big.NewInt(1)), nil },
+	SQRT: func(x *big.Int) (*big.Int, error) {
+		if x.Sign() < 0 {
+			return nil, errors.New("SQRT of a negative number")
+		}
+		return new(big.Int).Sqrt(x), nil
+	},
+}
+
+// binaryOperations are the integer operations of two operands, giving an
+// integer or a boolean
+var binaryOperations = map[NeoOpcode]func(x1, x2 *big.Int) (interface{}, error){
+	AND: func(x1, x2 *big.Int) (interface{}, error) { return new(big.Int).And(x1, x2), nil },
+	OR:  func(x1, x2 *big.Int) (interface{}, error) { return new(big.Int).Or(x1, x2), nil },
+	XOR: func(x1, x2 *big.Int) (interface{}, error) { return new(big.Int).Xor(x1, x2), nil },
+	ADD: func(x1, x2 *big.Int) (interface{}, error) { return new(big.Int).Add(x1, x2), nil },
+	SUB: func(x1, x2 *big.Int) (interface{}, error) { return new(big.Int).Sub(x1, x2), nil },
+	MUL: func(x1, x2 *big.Int) (interface{}, error) { return new(big.Int).Mul(x1, x2), nil },
+	DIV: func(x1, x2 *big.Int) (interface{}, error) {
+		if x2.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return new(big.Int).Quo(x1, x2), nil
+	},
+	MOD: func(x1, x2 *big.Int) (interface{}, error) {
+		if x2.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return new(big.Int).Rem(x1, x2), nil
+	},
+	POW: func(x1, x2 *big.Int) (interface{}, error) {
+		if x2.Sign() < 0 || x2.Cmp(big.NewInt(neoVMMaxShift)) > 0 {
+			return nil, fmt.Errorf("POW exponent %s out of range", x2)
+		}
+		return new(big.Int).Exp(x1, x2, nil), nil
+	},
+	SHL: func(x1, x2 *big.Int) (interface{}, error) {
+		if x2.Sign() < 0 || x2.Cmp(big.NewInt(neoVMMaxShift)) > 0 {
+			return nil, fmt.Errorf("shift %s out of range", x2)
+		}
+		return new(big.Int).Lsh(x1, uint(x2.Int64())), nil
+	},
+	SHR: func(x1, x2 *big.Int) (interface{}, error) {
+		if x2.Sign() < 0 || x2.Cmp(big.NewInt(neoVMMaxShift)) > 0 {
+			return nil, fmt.Errorf("shift %s out of range", x2)
+		}
+		return new(big.Int).Rsh(x1, uint(x2.Int64())), nil
+	},
+	NUMEQUAL:    func(x1, x2 *big.Int) (interface{}, error) { return x1.Cmp(x2) == 0, nil },
+	NUMNOTEQUAL: func(x1, x2 *big.Int) (interface{}, error) { return x1.Cmp(x2) != 0, nil },
+	MIN: func(x1, x2 *big.Int) (interface{}, error) {
+		if x1.Cmp(x2) <= 0 {
+			return x1, nil
+		}
+		return x2, nil
+	},
+	MAX: func(x1, x2 *big.Int) (interface{}, error) {
+		if x1.Cmp(x2) >= 0 {
+			return x1, nil
+		}
+		return x2, nil
+	},
+}
+
+// pushInteger pushes value, which must fit in an integer
+func (e *NeoVMExecutionEngine) pushInteger(value *big.Int) error {
+	if len(encodeInteger(value)) > e.MaxIntegerSize {
+		return fmt.Errorf("integer larger than %d bytes", e.MaxIntegerSize)
+	}
+	e.push(&NeoVMInteger{Value: value})
+	return nil
+}
+
+// compound executes a compound-type or type instruction
+func (e *NeoVMExecutionEngine) compound(op NeoOpcode, operand []byte) error {
+	switch op {
+	case PACKMAP:
+		count, err := e.popIndex(len(e.EvaluationStack) / 2)
+		if err != nil {
+			return err
+		}
+		m := &NeoVMMap{Items: make(map[string]NeoVMStackItem)}
+		for i := 0; i < count; i++ {
+			key, _ := e.pop()
+			value, _ := e.pop()
+			if err := mapSet(m, key, value); err != nil {
+				return err
+			}
+		}
+		e.push(m)
+	case PACKSTRUCT, PACK:
+		count, err := e.popIndex(len(e.EvaluationStack))
+		if err != nil {
+			return err
+		}
+		items := make([]NeoVMStackItem, count)
+		for i := range items {
+			items[i], _ = e.pop()
+		}
+		if op == PACK {
+			e.push(&NeoVMArray{Items: items})
+		} else {
+			e.push(&NeoVMStruct{Items: items})
+		}
+	case UNPACK:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if m, ok := item.(*NeoVMMap); ok {
+			keys := mapKeys(m)
+			for i := len(keys) - 1; i >= 0; i-- {
+				e.push(m.Items[mapKey(keys[i])])
+				e.push(keys[i])
+			}
+			e.push(&NeoVMInteger{Value: big.NewInt(int64(len(keys)))})
+			return nil
+		}
+		items, ok := itemsOf(item)
+		if !ok {
+			return fmt.Errorf("UNPACK of %s", typeName(item))
+		}
+		for i := len(items) - 1; i >= 0; i-- {
+			e.push(items[i])
+		}
+		e.push(&NeoVMInteger{Value: big.NewInt(int64(len(items)))})
+	case NEWARRAY0:
+		e.push(&NeoVMArray{Items: []NeoVMStackItem{}})
+	case NEWSTRUCT0:
+		e.push(&NeoVMStruct{Items: []NeoVMStackItem{}})
+	case NEWARRAY, NEWARRAY_T, NEWSTRUCT:
+		count, err := e.popIndex(NeoVMMaxStackSize)
+		if err != nil {
+			return err
+		}
+		var initial NeoVMStackItem = NeoVMNull{}
+		if op == NEWARRAY_T {
+			switch NeoVMType(operand[0]) {
+			case BooleanType:
+				initial = &NeoVMBoolean{}
+			case IntegerType:
+				initial = &NeoVMInteger{Value: big.NewInt(0)}
+			case ByteStringType:
+				initial = &NeoVMByteString{Value: []byte{}}
+			}
+		}
+		items := make([]NeoVMStackItem, count)
+		for i := range items {
+			items[i] = initial
+		}
+		if op == NEWSTRUCT {
+			e.push(&NeoVMStruct{Items: items})
+		} else {
+			e.push(&NeoVMArray{Items: items})
+		}
+	case NEWMAP:
+		e.push(&NeoVMMap{Items: make(map[string]NeoVMStackItem)})
+	case SIZE:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		size := 0
+		if m, ok := item.(*NeoVMMap); ok {
+			size = len(m.Items)
+		} else if items, ok := itemsOf(item); ok {
+			size = len(items)
+		} else {
+			data, err := bytesOf(item)
+			if err != nil {
+				return err
+			}
+			size = len(data)
+		}
+		e.push(&NeoVMInteger{Value: big.NewInt(int64(size))})
+	case HASKEY:
+		key, err := e.pop()
+		if err != nil {
+			return err
+		}
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if m, ok := item.(*NeoVMMap); ok {
+			if _, err := primitiveKey(key); err != nil {
+				return err
+			}
+			_, found := m.Items[mapKey(key)]
+			e.push(&NeoVMBoolean{Value: found})
+			return nil
+		}
+		index, err := integerOf(key, neoVMMaxIntegerSize)
+		if err != nil {
+			return err
+		}
+		if index.Sign() < 0 {
+			return fmt.Errorf("HASKEY of negative index %s", index)
+		}
+		size := 0
+		if items, ok := itemsOf(item); ok {
+			size = len(items)
+		} else if data, err := bytesOf(item); err == nil {
+			size = len(data)
+		} else {
+			return err
+		}
+		e.push(&NeoVMBoolean{Value: index.Cmp(big.NewInt(int64(size))) < 0})
+	case KEYS:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		m, ok := item.(*NeoVMMap)
+		if !ok {
+			return fmt.Errorf("KEYS of %s", typeName(item))
+		}
+		e.push(&NeoVMArray{Items: mapKeys(m)})
+	case VALUES:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		var values []NeoVMStackItem
+		if m, ok := item.(*NeoVMMap); ok {
+			for _, key := range mapKeys(m) {
+				values = append(values, m.Items[mapKey(key)])
+			}
+		} else if items, ok := itemsOf(item); ok {
+			values = items
+		} else {
+			return fmt.Errorf("VALUES of %s", typeName(item))
+		}
+		array := &NeoVMArray{Items: make([]NeoVMStackItem, len(values))}
+		for i, value := range values {
+			array.Items[i] = cloneStruct(value)
+		}
+		e.push(array)
+	case PICKITEM:
+		key, err := e.pop()
+		if err != nil {
+			return err
+		}
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		value, err := pickItem(item, key)
+		if err != nil {
+			return err
+		}
+		e.push(value)
+	case APPEND:
+		value, err := e.pop()
+		if err != nil {
+			return err
+		}
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		switch list := item.(type) {
+		case *NeoVMArray:
+			list.Items = append(list.Items, cloneStruct(value))
+		case *NeoVMStruct:
+			list.Items = append(list.Items, cloneStruct(value))
+		default:
+			return fmt.Errorf("APPEND to %s", typeName(item))
+		}
+	case SETITEM:
+		value, err := e.pop()
+		if err != nil {
+			return err
+		}
+		key, err := e.pop()
+		if err != nil {
+			return err
+		}
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		return setItem(item, key, cloneStruct(value))
+	case REVERSEITEMS:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if buffer, ok := item.(*NeoVMBuffer); ok {
+			for i, j := 0, len(buffer.Value)-1; i < j; i, j = i+1, j-1 {
+				buffer.Value[i], buffer.Value[j] = buffer.Value[j], buffer.Value[i]
+			}
+			return nil
+		}
+		items, ok := itemsOf(item)
+		if !ok {
+			return fmt.Errorf("REVERSEITEMS of %s", typeName(item))
+		}
+		reverseItems(items)
+	case REMOVE:
+		key, err := e.pop()
+		if err != nil {
+			return err
+		}
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if m, ok := item.(*NeoVMMap); ok {
+			if _, err := primitiveKey(key); err != nil {
+				return err
+			}
+			mapRemove(m, key)
+			return nil
+		}
+		items, ok := itemsOf(item)
+		if !ok {
+			return fmt.Errorf("REMOVE from %s", typeName(item))
+		}
+		index, err := itemIndex(key, len(items))
+		if err != nil {
+			return err
+		}
+		setItems(item, append(items[:index:index], items[index+1:]...))
+	case CLEARITEMS:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if m, ok := item.(*NeoVMMap); ok {
+			m.Items, m.Keys = make(map[string]NeoVMStackItem), nil
+			return nil
+		}
+		if _, ok := itemsOf(item); !ok {
+			return fmt.Errorf("CLEARITEMS of %s", typeName(item))
+		}
+		setItems(item, []NeoVMStackItem{})
+	case POPITEM:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		items, ok := itemsOf(item)
+		if !ok || len(items) == 0 {
+			return fmt.Errorf("POPITEM of %s", typeName(item))
+		}
+		setItems(item, items[:len(items)-1])
+		e.push(items[len(items)-1])
+	case ISTYPE, CONVERT:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		target := NeoVMType(operand[0])
+		if target == AnyType || typeNames[target] == "" {
+			return abort("%s to type 0x%02X", OpcodeMnemonic(op), operand[0])
+		}
+		if op == ISTYPE {
+			e.push(&NeoVMBoolean{Value: item.Type() == target})
+			return nil
+		}
+		converted, err := convertItem(item, target, e.MaxIntegerSize)
+		if err != nil {
+			return err
+		}
+		e.push(converted)
+	default:
+		return errUnknownOpcode
+	}
+	return nil
+}
+
+// typeNames are the names of the stack item types
+var typeNames = map[NeoVMType]string{
+	AnyType:        "Any",
+	PointerType:    "Pointer",
+	BooleanType:    "Boolean",
+	IntegerType:    "Integer",
+	ByteStringType: "ByteString",
+	BufferType:     "Buffer",
+	ArrayType:      "Array",
+	StructType:     "Struct",
+	MapType:        "Map",
+	InteropType:    "InteropInterface",
+}
+
+// typeName names the type of item
+func typeName(item NeoVMStackItem) string {
+	if _, ok := item.(NeoVMNull); ok {
+		return "null"
+	}
+	return typeNames[item.Type()]
+}
+
+// encodeInteger returns the little-endian two's complement of value in
+// the fewest bytes, none for 0
+func encodeInteger(value *big.Int) []byte {
+	if value.Sign() == 0 {
+		return []byte{}
+	}
+	size := value.BitLen()/8 + 1
+	twos := new(big.Int).Set(value)
+	if value.Sign() < 0 {
+		twos.Add(twos, new(big.Int).Lsh(big.NewInt(1), uint(8*size)))
+	}
+	data := make([]byte, size)
+	twos.FillBytes(data)
+	reverseBytes(data)
+	// A negative power of two fits in a byte fewer
+	if n := len(data); n > 1 && data[n-1] == 0xff && data[n-2]&0x80 != 0 {
+		data = data[:n-1]
+	}
+	return data
+}
+
+// reverseBytes reverses data in place
+func reverseBytes(data []byte) {
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+}
+
+// integerOf returns item as an integer, as NeoVM reads it, reading byte
+// strings of at most limit bytes
+func integerOf(item NeoVMStackItem, limit int) (*big.Int, error) {
+	switch v := item.(type) {
+	case *NeoVMInteger:
+		return v.Value, nil
+	case *NeoVMBoolean:
+		if v.Value {
+			return big.NewInt(1), nil
+		}
+		return big.NewInt(0), nil
+	case *NeoVMByteString:
+		if len(v.Value) > limit {
+			return nil, fmt.Errorf("byte string of %d bytes is not an integer", len(v.Value))
+		}
+		return decodeInteger(v.Value), nil
+	}
+	return nil, fmt.Errorf("%s is not an integer", typeName(item))
+}
+
+// bytesOf returns the bytes of a primitive item or buffer
+func bytesOf(item NeoVMStackItem) ([]byte, error) {
+	switch v := item.(type) {
+	case *NeoVMInteger:
+		return encodeInteger(v.Value), nil
+	case *NeoVMBoolean, *NeoVMByteString, *NeoVMBuffer:
+		return v.ToBytes(), nil
+	}
+	return nil, fmt.Errorf("%s has no bytes", typeName(item))
+}
+
+// booleanOf returns item as a boolean, as NeoVM reads it, reading byte
+// strings of at most limit bytes
+func booleanOf(item NeoVMStackItem, limit int) (bool, error) {
+	switch v := item.(type) {
+	case NeoVMNull:
+		return false, nil
+	case *NeoVMBoolean:
+		return v.Value, nil
+	case *NeoVMInteger:
+		return v.Value.Sign() != 0, nil
+	case *NeoVMByteString:
+		if len(v.Value) > limit {
+			return false, fmt.Errorf("byte string of %d bytes is not a boolean", len(v.Value))
+		}
+		for _, b := range v.Value {
+			if b != 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// itemsEqual reports whether EQUAL holds for a and b: primitive items of
+// the same type compare by value, structs by their items, others by
+// reference
+func itemsEqual(a, b NeoVMStackItem) bool {
+	switch x := a.(type) {
+	case NeoVMNull:
+		_, ok := b.(NeoVMNull)
+		return ok
+	case *NeoVMInteger:
+		y, ok := b.(*NeoVMInteger)
+		return ok && x.Value.Cmp(y.Value) == 0
+	case *NeoVMBoolean:
+		y, ok := b.(*NeoVMBoolean)
+		return ok && x.Value == y.Value
+	case *NeoVMByteString:
+		y, ok := b.(*NeoVMByteString)
+		return ok && bytes.Equal(x.Value, y.Value)
+	case *NeoVMPointer:
+		y, ok := b.(*NeoVMPointer)
+		return ok && (x == y || (x.Target == nil && y.Target == nil && x.Offset == y.Offset))
+	case *NeoVMStruct:
+		y, ok := b.(*NeoVMStruct)
+		if !ok || len(x.Items) != len(y.Items) {
+			return false
+		}
+		for i := range x.Items {
+			if !itemsEqual(x.Items[i], y.Items[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// itemsOf returns the items of an array or struct
+func itemsOf(item NeoVMStackItem) ([]NeoVMStackItem, bool) {
+	switch v := item.(type) {
+	case *NeoVMArray:
+		return v.Items, true
+	case *NeoVMStruct:
+		return v.Items, true
+	}
+	return nil, false
+}
+
+// setItems replaces the items of an array or struct
+func setItems(item NeoVMStackItem, items []NeoVMStackItem) {
+	switch v := item.(type) {
+	case *NeoVMArray:
+		v.Items = items
+	case *NeoVMStruct:
+		v.Items = items
+	}
+}
+
+// cloneStruct copies a struct, which NeoVM stores by value, and returns
+// other items as they are
+func cloneStruct(item NeoVMStackItem) NeoVMStackItem {
+	s, ok := item.(*NeoVMStruct)
+	if !ok {
+		return item
+	}
+	clone := &NeoVMStruct{Items: make([]NeoVMStackItem, len(s.Items))}
+	for i, field := range s.Items {
+		clone.Items[i] = cloneStruct(field)
+	}
+	return clone
+}
+
+// itemIndex returns key as an index of a list of size items
+func itemIndex(key NeoVMStackItem, size int) (int, error) {
+	index, err := integerOf(key, neoVMMaxIntegerSize)
+	if err != nil {
+		return 0, err
+	}
+	if index.Sign() < 0 || index.Cmp(big.NewInt(int64(size))) >= 0 {
+		return 0, fmt.Errorf("index %s out of range of %d items", index, size)
+	}
+	return int(index.Int64()), nil
+}
+
+// primitiveKey checks that key can be a map key
+func primitiveKey(key NeoVMStackItem) (NeoVMStackItem, error) {
+	switch key.(type) {
+	case *NeoVMInteger, *NeoVMBoolean, *NeoVMByteString:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s is not a map key", typeName(key))
+}
+
+// mapKey is the key of a map entry in NeoVMMap.Items: the type and the
+// bytes of the key, since keys of different types differ
+func mapKey(key NeoVMStackItem) string {
+	data, _ := bytesOf(key)
+	return string(rune(key.Type())) + string(data)
+}
+
+// mapKeys returns the keys of m in insertion order
+func mapKeys(m *NeoVMMap) []NeoVMStackItem {
+	return append([]NeoVMStackItem{}, m.Keys...)
+}
+
+// mapSet sets the value of key in m
+func mapSet(m *NeoVMMap, key, value NeoVMStackItem) error {
+	if _, err := primitiveKey(key); err != nil {
+		return err
+	}
+	k := mapKey(key)
+	if _, ok := m.Items[k]; !ok {
+		m.Keys = append(m.Keys, key)
+	}
+	m.Items[k] = value
+	return nil
+}
+
+// mapRemove removes key from m
+func mapRemove(m *NeoVMMap, key NeoVMStackItem) {
+	k := mapKey(key)
+	if _, ok := m.Items[k]; !ok {
+		return
+	}
+	delete(m.Items, k)
+	for i, existing := range m.Keys {
+		if mapKey(existing) == k {
+			m.Keys = append(m.Keys[:i:i], m.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// pickItem returns the item of a compound item or the byte of a primitive
+// one at key
+func pickItem(item, key NeoVMStackItem) (NeoVMStackItem, error) {
+	if m, ok := item.(*NeoVMMap); ok {
+		if _, err := primitiveKey(key); err != nil {
+			return nil, err
+		}
+		value, found := m.Items[mapKey(key)]
+		if !found {
+			return nil, fmt.Errorf("key %s not found", key)
+		}
+		return value, nil
+	}
+	if items, ok := itemsOf(item); ok {
+		index, err := itemIndex(key, len(items))
+		if err != nil {
+			return nil, err
+		}
+		return items[index], nil
+	}
+	data, err := bytesOf(item)
+	if err != nil {
+		return nil, fmt.Errorf("PICKITEM of %s", typeName(item))
+	}
+	index, err := itemIndex(key, len(data))
+	if err != nil {
+		return nil, err
+	}
+	return &NeoVMInteger{Value: big.NewInt(int64(data[index]))}, nil
+}
+
+// setItem sets the item of a compound item or the byte of a buffer at key
+func setItem(item, key, value NeoVMStackItem) error {
+	switch v := item.(type) {
+	case *NeoVMMap:
+		return mapSet(v, key, value)
+	case *NeoVMBuffer:
+		index, err := itemIndex(key, len(v.Value))
+		if err != nil {
+			return err
+		}
+		b, err := integerOf(value, neoVMMaxIntegerSize)
+		if err != nil {
+			return err
+		}
+		if b.Cmp(big.NewInt(-128)) < 0 || b.Cmp(big.NewInt(255)) > 0 {
+			return fmt.Errorf("byte %s out of range", b)
+		}
+		v.Value[index] = byte(b.Int64())
+		return nil
+	}
+	items, ok := itemsOf(item)
+	if !ok {
+		return fmt.Errorf("SETITEM of %s", typeName(item))
+	}
+	index, err := itemIndex(key, len(items))
+	if err != nil {
+		return err
+	}
+	items[index] = value
+	return nil
+}
+
+// convertItem converts item to the target type as CONVERT does, with
+// integers of at most limit bytes
+func convertItem(item NeoVMStackItem, target NeoVMType, limit int) (NeoVMStackItem, error) {
+	if _, ok := item.(NeoVMNull); ok || item.Type() == target {
+		return item, nil
+	}
+	switch target {
+	case BooleanType:
+		switch item.(type) {
+		case *NeoVMInteger, *NeoVMByteString, *NeoVMBuffer:
+			value, err := booleanOf(item, limit)
+			return &NeoVMBoolean{Value: value}, err
+		}
+	case IntegerType:
+		switch v := item.(type) {
+		case *NeoVMBuffer:
+			if len(v.Value) > limit {
+				return nil, fmt.Errorf("buffer of %d bytes is not an integer", len(v.Value))
+			}
+			return &NeoVMInteger{Value: decodeInteger(v.Value)}, nil
+		case *NeoVMBoolean, *NeoVMByteString:
+			value, err := integerOf(item, limit)
+			return &NeoVMInteger{Value: value}, err
+		}
+	case ByteStringType, BufferType:
+		data, err := bytesOf(item)
+		if err != nil {
+			break
+		}
+		if target == BufferType {
+			return &NeoVMBuffer{Value: append([]byte{}, data...)}, nil
+		}
+		return &NeoVMByteString{Value: append([]byte{}, data...)}, nil
+	case ArrayType:
+		if s, ok := item.(*NeoVMStruct); ok {
+			return &NeoVMArray{Items: append([]NeoVMStackItem{}, s.Items...)}, nil
+		}
+	case StructType:
+		if a, ok := item.(*NeoVMArray); ok {
+			return &NeoVMStruct{Items: append([]NeoVMStackItem{}, a.Items...)}, nil
+		}
+	}
+	return nil, fmt.Errorf("%s does not convert to %s", typeName(item), typeNames[target])
+}
+
+// syscall calls the interop service method
+func (e *NeoVMExecutionEngine) syscall(method string) error {
+	service, ok := DefaultInteropRegistry().Lookup(method)
+	if !ok {
+		return abort("unknown interop service %s", method)
+	}
+	handler, ok := e.InteropServices[method]
+	if !ok || service.Pop == StackVariable {
+		return abort("interop service %s is not available", method)
+	}
+	args := make([]NeoVMStackItem, service.Pop)
+	for i := range args {
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		args[i] = item
+	}
+	result, err := handler(args)
+	if err != nil {
+		return err
+	}
+	if result == nil && service.Push == 1 {
+		result = NeoVMNull{}
+	}
+	if result != nil && service.Push != 0 {
+		e.push(result)
+	}
+	return nil
+}
+
+// callToken calls the method of method token index through
+// System.Contract.Call, with all call flags
+func (e *NeoVMExecutionEngine) callToken(index int) error {
+	if index >= len(e.Tokens) {
+		return abort("CALLT of method token %d of %d", index, len(e.Tokens))
+	}
+	token := e.Tokens[index]
+	args := make([]NeoVMStackItem, token.ParametersCount)
+	for i := range args {
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		args[i] = item
+	}
+	handler, ok := e.InteropServices["System.Contract.Call"]
+	if !ok {
+		return abort("interop service System.Contract.Call is not available")
+	}
+	result, err := handler([]NeoVMStackItem{
+		&NeoVMByteString{Value: append([]byte{}, token.Hash[:]...)},
+		&NeoVMByteString{Value: []byte(token.Method)},
+		&NeoVMInteger{Value: big.NewInt(int64(token.CallFlags))},
+		&NeoVMArray{Items: args},
+	})
+	if err != nil {
+		return err
+	}
+	if token.HasReturnValue {
+		if result == nil {
+			result = NeoVMNull{}
+		}
+		e.push(result)
+	}
+	return nil
+}
+
+// scriptHash returns the script hash of the instructions as the VM holds
+// it, little-endian
+func (e *NeoVMExecutionEngine) scriptHash() []byte {
+	script, err := assembleScript(e.Instructions)
+	if err != nil {
+		return make([]byte, 20)
+	}
+	hash := ScriptHash(script)
+	data := hash[:]
+	reverseBytes(data)
+	return data
+}
+
+// storageContext returns the storage context argument
+func storageContext(item NeoVMStackItem, write bool) error {
+	context, ok := item.(*neoVMStorageContext)
+	if !ok {
+		return fmt.Errorf("%s is not a storage context", typeName(item))
+	}
+	if write && context.readOnly {
+		return errors.New("storage context is read-only")
+	}
+	return nil
+}
+
+// stubInteropServices returns stubs of the interop services of the
+// runtime, storage and iterators
+func (e *NeoVMExecutionEngine) stubInteropServices() map[string]func([]NeoVMStackItem) (NeoVMStackItem, error) {
+	integer := func(value int64) NeoVMStackItem { return &NeoVMInteger{Value: big.NewInt(value)} }
+	constant := func(item NeoVMStackItem) func([]NeoVMStackItem) (NeoVMStackItem, error) {
+		return func([]NeoVMStackItem) (NeoVMStackItem, error) { return item, nil }
+	}
+	hash := func([]NeoVMStackItem) (NeoVMStackItem, error) {
+		return &NeoVMByteString{Value: e.scriptHash()}, nil
+	}
+	return map[string]func([]NeoVMStackItem) (NeoVMStackItem, error){
+		"System.Runtime.Platform":          constant(&NeoVMByteString{Value: []byte("NEO")}),
+		"System.Runtime.GetNetwork":        constant(integer(neoMainnetMagic)),
+		"System.Runtime.GetAddressVersion": constant(integer(neoAddressVersion)),
+		"System.Runtime.GetTrigger":        constant(integer(neoVMApplicationTrigger)),
+		"System.Runtime.GetTime": func([]NeoVMStackItem) (NeoVMStackItem, error) {
+			return &NeoVMInteger{Value: new(big.Int).SetUint64(e.Time)}, nil
+		},
+		"System.Runtime.GetExecutingScriptHash": hash,
+		"System.Runtime.GetEntryScriptHash":     hash,
+		"System.Runtime.GetCallingScriptHash":   constant(NeoVMNull{}),
+		"System.Runtime.GetInvocationCounter":   constant(integer(1)),
+		"System.Contract.GetCallFlags":          constant(integer(0x0f)),
+		"System.Runtime.GasLeft": func([]NeoVMStackItem) (NeoVMStackItem, error) {
+			if e.GasLimit <= 0 {
+				return integer(math.MaxInt64), nil
+			}
+			return integer(e.GasLimit - e.GasConsumed), nil
+		},
+		"System.Runtime.BurnGas": func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+			amount, err := integerOf(args[0], e.MaxIntegerSize)
+			if err != nil {
+				return nil, err
+			}
+			if amount.Sign() <= 0 || !amount.IsInt64() {
+				return nil, fmt.Errorf("cannot burn %s datoshi", amount)
+			}
+			e.GasConsumed += amount.Int64()
+			return nil, nil
+		},
+		"System.Runtime.CheckWitness": func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+			data, err := bytesOf(args[0])
+			if err != nil {
+				return nil, err
+			}
+			if len(data) != 20 {
+				return nil, fmt.Errorf("CheckWitness of %d bytes", len(data))
+			}
+			var account Uint160
+			copy(account[:], data)
+			reverseBytes(account[:])
+			for _, signer := range e.Signers {
+				if signer == account {
+					return &NeoVMBoolean{Value: true}, nil
+				}
+			}
+			return &NeoVMBoolean{Value: false}, nil
+		},
+		"System.Runtime.Log": func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+			data, err := bytesOf(args[0])
+			if err != nil {
+				return nil, err
+			}
+			e.Logs = append(e.Logs, string(data))
+			return nil, nil
+		},
+		"System.Runtime.Notify": func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+			name, err := bytesOf(args[0])
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := itemsOf(args[1]); !ok {
+				return nil, fmt.Errorf("notification state is %s, not an array", typeName(args[1]))
+			}
+			var hash Uint160
+			copy(hash[:], e.scriptHash())
+			reverseBytes(hash[:])
+			e.Notifications = append(e.Notifications, NeoVMNotification{ScriptHash: hash, EventName: string(name), State: args[1]})
+			return nil, nil
+		},
+		"System.Storage.GetContext":         constant(&neoVMStorageContext{}),
+		"System.Storage.GetReadOnlyContext": constant(&neoVMStorageContext{readOnly: true}),
+		"System.Storage.AsReadOnly": func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+			if err := storageContext(args[0], false); err != nil {
+				return nil, err
+			}
+			return &neoVMStorageContext{readOnly: true}, nil
+		},
+		"System.Storage.Get": func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+			if err := storageContext(args[0], false); err != nil {
+				return nil, err
+			}
+			key, err := bytesOf(args[1])
+			if err != nil {
+				return nil, err
+			}
+			value, ok := e.Storage[string(key)]
+			if !ok {
+				return NeoVMNull{}, nil
+			}
+			return &NeoVMByteString{Value: append([]byte{}, value...)}, nil
+		},
+		"System.Storage.Put": func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+			if err := storageContext(args[0], true); err != nil {
+				return nil, err
+			}
+			key, err := bytesOf(args[1])
+			if err != nil {
+				return nil, err
+			}
+			value, err := bytesOf(args[2])
+			if err != nil {
+				return nil, err
+			}
+			e.GasConsumed += e.Prices.StorageFee(len(key) + len(value))
+			e.Storage[string(key)] = append([]byte{}, value...)
+			return nil, nil
+		},
+		"System.Storage.Delete": func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+			if err := storageContext(args[0], true); err != nil {
+				return nil, err
+			}
+			key, err := bytesOf(args[1])
+			if err != nil {
+				return nil, err
+			}
+			delete(e.Storage, string(key))
+			return nil, nil
+		},
+		"System.Storage.Find": func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+			if err := storageContext(args[0], false); err != nil {
+				return nil, err
+			}
+			prefix, err := bytesOf(args[1])
+			if err != nil {
+				return nil, err
+			}
+			options, err := integerOf(args[2], e.MaxIntegerSize)
+			if err != nil {
+				return nil, err
+			}
+			var keys []string
+			for key := range e.Storage {
+				if strings.HasPrefix(key, string(prefix)) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			iterator := &neoVMIterator{}
+			for _, key := range keys {
+				k := []byte(key)
+				if options.Int64()&findOptionRemovePrefix != 0 {
+					k = k[len(prefix):]
+				}
+				keyItem := &NeoVMByteString{Value: k}
+				valueItem := &NeoVMByteString{Value: append([]byte{}, e.Storage[key]...)}
+				switch {
+				case options.Int64()&findOptionKeysOnly != 0:
+					iterator.items = append(iterator.items, keyItem)
+				case options.Int64()&findOptionValuesOnly != 0:
+					iterator.items = append(iterator.items, valueItem)
+				default:
+					iterator.items = append(iterator.items, &NeoVMStruct{Items: []NeoVMStackItem{keyItem, valueItem}})
+				}
+			}
+			return iterator, nil
+		},
+		"System.Iterator.Next": func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+			iterator, ok := args[0].(*neoVMIterator)
+			if !ok {
+				return nil, fmt.Errorf("%s is not an iterator", typeName(args[0]))
+			}
+			if iterator.next < len(iterator.items) {
+				iterator.next++
+				return &NeoVMBoolean{Value: true}, nil
+			}
+			return &NeoVMBoolean{Value: false}, nil
+		},
+		"System.Iterator.Value": func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+			iterator, ok := args[0].(*neoVMIterator)
+			if !ok {
+				return nil, fmt.Errorf("%s is not an iterator", typeName(args[0]))
+			}
+			if iterator.next == 0 {
+				return nil, errors.New("iterator value before Next")
+			}
+			return iterator.items[iterator.next-1], nil
+		},
+	}
+}
@@ -18,128 +18,197 @@ type NeoInstruction struct {
 	GasCost     int64         `json:"gas_cost"`
 	SourceRef   *SourcePosition `json:"source_ref,omitempty"`
 	Comment     string        `json:"comment,omitempty"`
+	Verbatim    bool          `json:"verbatim,omitempty"` // Inserted by verbatim, kept by the optimizer
+	Link        string        `json:"link,omitempty"`     // Library whose address a placeholder pushes once linked
 }
 
 // NeoOpcode represents NeoVM instruction opcodes
 type NeoOpcode byte
 
-// NeoVM instruction set constants
+// NeoVM instruction set constants, the opcodes of Neo N3. opcodeTable
+// holds their metadata.
 const (
-	// Stack operations
-	PUSH0    NeoOpcode = 0x10
-	PUSH1    NeoOpcode = 0x11
-	PUSH2    NeoOpcode = 0x12
-	PUSH3    NeoOpcode = 0x13
-	PUSH4    NeoOpcode = 0x14
-	PUSH5    NeoOpcode = 0x15
-	PUSH6    NeoOpcode = 0x16
-	PUSH7    NeoOpcode = 0x17
-	PUSH8    NeoOpcode = 0x18
-	PUSH9    NeoOpcode = 0x19
-	PUSH10   NeoOpcode = 0x1A
-	PUSH11   NeoOpcode = 0x1B
-	PUSH12   NeoOpcode = 0x1C
-	PUSH13   NeoOpcode = 0x1D
-	PUSH14   NeoOpcode = 0x1E
-	PUSH15   NeoOpcode = 0x1F
-	PUSH16   NeoOpcode = 0x20
-
+	// Constants
 	PUSHINT8   NeoOpcode = 0x00
 	PUSHINT16  NeoOpcode = 0x01
 	PUSHINT32  NeoOpcode = 0x02
 	PUSHINT64  NeoOpcode = 0x03
 	PUSHINT128 NeoOpcode = 0x04
 	PUSHINT256 NeoOpcode = 0x05
-
-	PUSHDATA1 NeoOpcode = 0x0C
-	PUSHDATA2 NeoOpcode = 0x0D
-	PUSHDATA4 NeoOpcode = 0x0E
-
-	// Stack manipulation
-	DUP   NeoOpcode = 0x21
-	SWAP  NeoOpcode = 0x23
-	ROT   NeoOpcode = 0x24
-	ROLL  NeoOpcode = 0x25
-	PICK  NeoOpcode = 0x26
-	TUCK  NeoOpcode = 0x27
-	DROP  NeoOpcode = 0x28
-	NIP   NeoOpcode = 0x29
-	XDROP NeoOpcode = 0x2A
-	CLEAR NeoOpcode = 0x2B
-	DEPTH NeoOpcode = 0x2C
-
-	// Arithmetic
-	ADD    NeoOpcode = 0x9F
-	SUB    NeoOpcode = 0xA0
-	MUL    NeoOpcode = 0xA1
-	DIV    NeoOpcode = 0xA2
-	MOD    NeoOpcode = 0xA3
-	SHL    NeoOpcode = 0xA8
-	SHR    NeoOpcode = 0xA9
-	NOT    NeoOpcode = 0xAA
-	BOOLAND NeoOpcode = 0xAB
-	BOOLOR  NeoOpcode = 0xAC
-	NUMEQUAL  NeoOpcode = 0xAD
-	NUMNOTEQUAL NeoOpcode = 0xAE
-	LT     NeoOpcode = 0xAF
-	LE     NeoOpcode = 0xB0
-	GT     NeoOpcode = 0xB1
-	GE     NeoOpcode = 0xB2
-	MIN    NeoOpcode = 0xB3
-	MAX    NeoOpcode = 0xB4
-	WITHIN NeoOpcode = 0xB5
-
-	// Bitwise
-	AND NeoOpcode = 0xA4
-	OR  NeoOpcode = 0xA5
-	XOR NeoOpcode = 0xA6
-	EQUAL NeoOpcode = 0x97
+	PUSHT      NeoOpcode = 0x08
+	PUSHF      NeoOpcode = 0x09
+	PUSHA      NeoOpcode = 0x0A
+	PUSHNULL   NeoOpcode = 0x0B
+	PUSHDATA1  NeoOpcode = 0x0C
+	PUSHDATA2  NeoOpcode = 0x0D
+	PUSHDATA4  NeoOpcode = 0x0E
+	PUSHM1     NeoOpcode = 0x0F
+	PUSH0      NeoOpcode = 0x10
+	PUSH1      NeoOpcode = 0x11
+	PUSH2      NeoOpcode = 0x12
+	PUSH3      NeoOpcode = 0x13
+	PUSH4      NeoOpcode = 0x14
+	PUSH5      NeoOpcode = 0x15
+	PUSH6      NeoOpcode = 0x16
+	PUSH7      NeoOpcode = 0x17
+	PUSH8      NeoOpcode = 0x18
+	PUSH9      NeoOpcode = 0x19
+	PUSH10     NeoOpcode = 0x1A
+	PUSH11     NeoOpcode = 0x1B
+	PUSH12     NeoOpcode = 0x1C
+	PUSH13     NeoOpcode = 0x1D
+	PUSH14     NeoOpcode = 0x1E
+	PUSH15     NeoOpcode = 0x1F
+	PUSH16     NeoOpcode = 0x20
+
+	// Flow control. Jumps, CALL, TRY and ENDTRY take offsets relative to
+	// their first byte, 1 byte wide in the short form and 4 in the _L form.
+	NOP        NeoOpcode = 0x21
+	JMP        NeoOpcode = 0x22
+	JMP_L      NeoOpcode = 0x23
+	JMPIF      NeoOpcode = 0x24
+	JMPIF_L    NeoOpcode = 0x25
+	JMPIFNOT   NeoOpcode = 0x26
+	JMPIFNOT_L NeoOpcode = 0x27
+	JMPEQ      NeoOpcode = 0x28
+	JMPEQ_L    NeoOpcode = 0x29
+	JMPNE      NeoOpcode = 0x2A
+	JMPNE_L    NeoOpcode = 0x2B
+	JMPGT      NeoOpcode = 0x2C
+	JMPGT_L    NeoOpcode = 0x2D
+	JMPGE      NeoOpcode = 0x2E
+	JMPGE_L    NeoOpcode = 0x2F
+	JMPLT      NeoOpcode = 0x30
+	JMPLT_L    NeoOpcode = 0x31
+	JMPLE      NeoOpcode = 0x32
+	JMPLE_L    NeoOpcode = 0x33
+	CALL       NeoOpcode = 0x34
+	CALL_L     NeoOpcode = 0x35
+	CALLA      NeoOpcode = 0x36
+	CALLT      NeoOpcode = 0x37
+	ABORT      NeoOpcode = 0x38
+	ASSERT     NeoOpcode = 0x39
+	THROW      NeoOpcode = 0x3A
+	TRY        NeoOpcode = 0x3B
+	TRY_L      NeoOpcode = 0x3C
+	ENDTRY     NeoOpcode = 0x3D
+	ENDTRY_L   NeoOpcode = 0x3E
+	ENDFINALLY NeoOpcode = 0x3F
+	RET        NeoOpcode = 0x40
+	SYSCALL    NeoOpcode = 0x41
+
+	// Stack. PICK, ROLL, XDROP and REVERSEN take their index from the stack.
+	DEPTH    NeoOpcode = 0x43
+	DROP     NeoOpcode = 0x45
+	NIP      NeoOpcode = 0x46
+	XDROP    NeoOpcode = 0x48
+	CLEAR    NeoOpcode = 0x49
+	DUP      NeoOpcode = 0x4A
+	OVER     NeoOpcode = 0x4B
+	PICK     NeoOpcode = 0x4D
+	TUCK     NeoOpcode = 0x4E
+	SWAP     NeoOpcode = 0x50
+	ROT      NeoOpcode = 0x51
+	ROLL     NeoOpcode = 0x52
+	REVERSE3 NeoOpcode = 0x53
+	REVERSE4 NeoOpcode = 0x54
+	REVERSEN NeoOpcode = 0x55
+
+	// Slots. The LD and ST forms take an index operand; indices 0-6 also
+	// have 1-byte forms such as LDLOC0, which NewSlotInstruction picks.
+	INITSSLOT NeoOpcode = 0x56
+	INITSLOT  NeoOpcode = 0x57
+	LDSFLD0   NeoOpcode = 0x58
+	LDSFLD    NeoOpcode = 0x5F
+	STSFLD0   NeoOpcode = 0x60
+	STSFLD    NeoOpcode = 0x67
+	LDLOC0    NeoOpcode = 0x68
+	LDLOC     NeoOpcode = 0x6F
+	STLOC0    NeoOpcode = 0x70
+	STLOC     NeoOpcode = 0x77
+	LDARG0    NeoOpcode = 0x78
+	LDARG     NeoOpcode = 0x7F
+	STARG0    NeoOpcode = 0x80
+	STARG     NeoOpcode = 0x87
+
+	// Splice
+	NEWBUFFER NeoOpcode = 0x88
+	MEMCPY    NeoOpcode = 0x89
+	CAT       NeoOpcode = 0x8B
+	SUBSTR    NeoOpcode = 0x8C
+	LEFT      NeoOpcode = 0x8D
+	RIGHT     NeoOpcode = 0x8E
+
+	// Bitwise logic
+	INVERT   NeoOpcode = 0x90
+	AND      NeoOpcode = 0x91
+	OR       NeoOpcode = 0x92
+	XOR      NeoOpcode = 0x93
+	EQUAL    NeoOpcode = 0x97
 	NOTEQUAL NeoOpcode = 0x98
 
-	// Control flow
-	NOP     NeoOpcode = 0x21
-	JMP     NeoOpcode = 0x22
-	JMPIF   NeoOpcode = 0x23
-	JMPIFNOT NeoOpcode = 0x24
-	JMPEQ   NeoOpcode = 0x25
-	JMPNE   NeoOpcode = 0x26
-	JMPGT   NeoOpcode = 0x27
-	JMPGE   NeoOpcode = 0x28
-	JMPLT   NeoOpcode = 0x29
-	JMPLE   NeoOpcode = 0x2A
-	CALL    NeoOpcode = 0x2B
-	CALLA   NeoOpcode = 0x2C
-	CALLT   NeoOpcode = 0x2D
-	ABORT   NeoOpcode = 0x2E
-	ASSERT  NeoOpcode = 0x2F
-	THROW   NeoOpcode = 0x3A
-	TRY     NeoOpcode = 0x3B
-	TRYFINALLY NeoOpcode = 0x3C
-	ENDTRY  NeoOpcode = 0x3D
-	ENDFINALLY NeoOpcode = 0x3E
-	RET     NeoOpcode = 0x40
-
-	// Array and buffer operations
-	NEWARRAY  NeoOpcode = 0xC5
-	NEWSTRUCT NeoOpcode = 0xC6
-	NEWMAP    NeoOpcode = 0xC8
-	APPEND    NeoOpcode = 0xC9
-	REVERSE   NeoOpcode = 0xCA
-	REMOVE    NeoOpcode = 0xCB
-	HASKEY    NeoOpcode = 0xCC
-	KEYS      NeoOpcode = 0xCD
-	VALUES    NeoOpcode = 0xCE
-	PICKITEM  NeoOpcode = 0xCF
-	SETITEM   NeoOpcode = 0xD0
-	SIZE      NeoOpcode = 0xD1
-
-	// Type operations
-	ISNULL   NeoOpcode = 0xD8
-	ISTYPE   NeoOpcode = 0xD9
-	CONVERT  NeoOpcode = 0xDB
-
-	// System calls
-	SYSCALL NeoOpcode = 0x41
+	// Arithmetic
+	SIGN        NeoOpcode = 0x99
+	ABS         NeoOpcode = 0x9A
+	NEGATE      NeoOpcode = 0x9B
+	INC         NeoOpcode = 0x9C
+	DEC         NeoOpcode = 0x9D
+	ADD         NeoOpcode = 0x9E
+	SUB         NeoOpcode = 0x9F
+	MUL         NeoOpcode = 0xA0
+	DIV         NeoOpcode = 0xA1
+	MOD         NeoOpcode = 0xA2
+	POW         NeoOpcode = 0xA3
+	SQRT        NeoOpcode = 0xA4
+	MODMUL      NeoOpcode = 0xA5
+	MODPOW      NeoOpcode = 0xA6
+	SHL         NeoOpcode = 0xA8
+	SHR         NeoOpcode = 0xA9
+	NOT         NeoOpcode = 0xAA
+	BOOLAND     NeoOpcode = 0xAB
+	BOOLOR      NeoOpcode = 0xAC
+	NZ          NeoOpcode = 0xB1
+	NUMEQUAL    NeoOpcode = 0xB3
+	NUMNOTEQUAL NeoOpcode = 0xB4
+	LT          NeoOpcode = 0xB5
+	LE          NeoOpcode = 0xB6
+	GT          NeoOpcode = 0xB7
+	GE          NeoOpcode = 0xB8
+	MIN         NeoOpcode = 0xB9
+	MAX         NeoOpcode = 0xBA
+	WITHIN      NeoOpcode = 0xBB
+
+	// Compound types
+	PACKMAP      NeoOpcode = 0xBE
+	PACKSTRUCT   NeoOpcode = 0xBF
+	PACK         NeoOpcode = 0xC0
+	UNPACK       NeoOpcode = 0xC1
+	NEWARRAY0    NeoOpcode = 0xC2
+	NEWARRAY     NeoOpcode = 0xC3
+	NEWARRAY_T   NeoOpcode = 0xC4
+	NEWSTRUCT0   NeoOpcode = 0xC5
+	NEWSTRUCT    NeoOpcode = 0xC6
+	NEWMAP       NeoOpcode = 0xC8
+	SIZE         NeoOpcode = 0xCA
+	HASKEY       NeoOpcode = 0xCB
+	KEYS         NeoOpcode = 0xCC
+	VALUES       NeoOpcode = 0xCD
+	PICKITEM     NeoOpcode = 0xCE
+	APPEND       NeoOpcode = 0xCF
+	SETITEM      NeoOpcode = 0xD0
+	REVERSEITEMS NeoOpcode = 0xD1
+	REMOVE       NeoOpcode = 0xD2
+	CLEARITEMS   NeoOpcode = 0xD3
+	POPITEM      NeoOpcode = 0xD4
+
+	// Types
+	ISNULL  NeoOpcode = 0xD8
+	ISTYPE  NeoOpcode = 0xD9
+	CONVERT NeoOpcode = 0xDB
+
+	// Extensions
+	ABORTMSG  NeoOpcode = 0xE0
+	ASSERTMSG NeoOpcode = 0xE1
 )
 
 // NeoVMStackItem represents different types of items on the NeoVM stack
@@ -201,11 +270,13 @@ type (
 	// NeoVMMap represents key-value mappings
 	NeoVMMap struct {
 		Items map[string]NeoVMStackItem
+		Keys  []NeoVMStackItem // Keys in insertion order, when kept
 	}
 
 	// NeoVMPointer represents references to other stack items
 	NeoVMPointer struct {
 		Target NeoVMStackItem
+		Offset int // Script offset of a code pointer, when Target is nil
 	}
 
 	// NeoVMInterop represents external system interfaces
@@ -308,8 +379,18 @@ func (m *NeoVMMap) Size() int              {
 }
 
 func (p *NeoVMPointer) Type() NeoVMType    { return PointerType }
-func (p *NeoVMPointer) ToBytes() []byte    { return p.Target.ToBytes() }
-func (p *NeoVMPointer) String() string     { return fmt.Sprintf("Pointer -> %s", p.Target.String()) }
+func (p *NeoVMPointer) ToBytes() []byte    {
+	if p.Target == nil {
+		return nil
+	}
+	return p.Target.ToBytes()
+}
+func (p *NeoVMPointer) String() string     {
+	if p.Target == nil {
+		return fmt.Sprintf("Pointer -> offset %d", p.Offset)
+	}
+	return fmt.Sprintf("Pointer -> %s", p.Target.String())
+}
 func (p *NeoVMPointer) Size() int          { return 8 } // Pointer size
 
 func (i *NeoVMInterop) Type() NeoVMType    { return InteropType }
@@ -334,9 +415,15 @@ type NeoContract struct {
 	Events      []*ContractEvent    `json:"events"`
 	
 	// Runtime information
-	EntryPoints map[string]int      `json:"entry_points"`
-	Constants   map[string]NeoVMStackItem `json:"constants"`
+	EntryPoints *OrderedMap[int]    `json:"entry_points"` // Label offsets in emission order
+	Constants   *OrderedMap[NeoVMStackItem] `json:"constants"`
 	Imports     []string            `json:"imports,omitempty"`
+	DataSegments *OrderedMap[[]byte] `json:"data_segments,omitempty"` // Yul data sections by name, laid out in order
+	ExceptionHandlers []ExceptionHandler `json:"exception_handlers,omitempty"` // TRY frames of the runtime
+	MethodTokens []MethodToken `json:"method_tokens,omitempty"` // Contract methods called through CALLT
+	Immutables  *ImmutableTable `json:"immutables,omitempty"` // Immutables the constructor stores, nil for none
+	Permissions []ContractPermission `json:"permissions,omitempty"` // Contract methods the script calls
+	Manifest    *ContractManifest `json:"manifest,omitempty"` // Built by finalization
 	
 	// Debug and metadata
 	SourceMap   map[int]SourcePosition `json:"source_map,omitempty"`
@@ -383,6 +470,7 @@ type ContractMetadata struct {
 	Libraries       []LibraryInfo       `json:"libraries,omitempty"`
 	Optimization    OptimizationInfo    `json:"optimization"`
 	Security        SecurityInfo        `json:"security"`
+	NameMappings    []NameMapping       `json:"name_mappings,omitempty"` // Yul names renamed for the manifest
 }
 
 type LibraryInfo struct {
@@ -425,12 +513,32 @@ type NeoVMExecutionEngine struct {
 	GasLimit          int64             `json:"gas_limit"`
 	GasConsumed       int64             `json:"gas_consumed"`
 	StackLimit        int               `json:"stack_limit"`
+	MaxIntegerSize    int               `json:"max_integer_size"` // Bytes of an integer
 	
 	// Exception handling
 	ExceptionHandlers []ExceptionHandler `json:"exception_handlers"`
 	
-	// Interop services
+	// Interop services, called with their arguments in popped order
 	InteropServices   map[string]func([]NeoVMStackItem) (NeoVMStackItem, error) `json:"-"`
+
+	// Invocation state
+	State             VMState            `json:"state"`
+	Arguments         []NeoVMStackItem   `json:"arguments"`
+	Prices            *PriceTable        `json:"-"` // Mainnet pricing when nil
+	Tokens            []MethodToken      `json:"-"` // Methods CALLT calls
+
+	// Runtime context of the default interop services
+	Storage           map[string][]byte  `json:"-"` // Storage of the contract by key
+	Notifications     []NeoVMNotification `json:"-"`
+	Logs              []string           `json:"-"`
+	Signers           []Uint160          `json:"-"` // Accounts CheckWitness accepts
+	Time              uint64             `json:"-"` // Block time in milliseconds
+
+	offsets           []int              // Script offset by instruction index
+	indices           map[int]int        // Instruction index by script offset
+	frames            []neoVMFrame       // Callers of the running routine
+	slotted           bool               // INITSLOT ran in the running routine
+	uncaught          NeoVMStackItem     // Exception a finally block rethrows
 }
 
 // ExceptionHandler represents an exception handling frame
@@ -440,11 +548,16 @@ type ExceptionHandler struct {
 	FinallyOffset int    `json:"finally_offset"`
 	EndOffset     int    `json:"end_offset"`
 	StackDepth    int    `json:"stack_depth"`
+	State         TryState `json:"state,omitempty"` // Block running, while an engine executes the frame
 }
 
 // Instruction creation helpers
 func NewPushInstruction(value NeoVMStackItem) NeoInstruction {
 	data := value.ToBytes()
+	if intVal, ok := value.(*NeoVMInteger); ok {
+		// NeoVM reads the bytes of an integer little-endian
+		data = encodeInteger(intVal.Value)
+	}
 	opcode := PUSHDATA1
 	
 	// Optimize for small integers
@@ -481,259 +594,157 @@ func NewPushInstruction(value NeoVMStackItem) NeoInstruction {
 		Size:      1 + len(data) + getSizeByteCount(opcode),
 		StackPop:  0,
 		StackPush: 1,
-		GasCost:   int64(1 + len(data)/32), // Base cost + data cost
+		GasCost:   opcodeTable[opcode].Price,
 	}
 }
 
-func NewArithmeticInstruction(op NeoOpcode) NeoInstruction {
-	var stackPop, stackPush int
-	var gasCost int64
-	
-	switch op {
-	case ADD, SUB, MUL, DIV, MOD, AND, OR, XOR:
-		stackPop, stackPush = 2, 1
-		gasCost = 8
-	case NOT, BOOLAND, BOOLOR:
-		stackPop, stackPush = 1, 1
-		gasCost = 4
-	case SHL, SHR:
-		stackPop, stackPush = 2, 1
-		gasCost = 8
-	case LT, LE, GT, GE, EQUAL, NOTEQUAL, NUMEQUAL, NUMNOTEQUAL:
-		stackPop, stackPush = 2, 1
-		gasCost = 8
-	case MIN, MAX:
-		stackPop, stackPush = 2, 1
-		gasCost = 8
-	case WITHIN:
-		stackPop, stackPush = 3, 1
-		gasCost = 16
-	default:
-		stackPop, stackPush = 0, 0
-		gasCost = 1
-	}
-	
-	return NeoInstruction{
-		Opcode:    op,
-		Operand:   nil,
-		Size:      1,
-		StackPop:  stackPop,
-		StackPush: stackPush,
-		GasCost:   gasCost,
+// NewPushBooleanInstruction pushes a Boolean, unlike NewPushInstruction,
+// which pushes a boolean as its byte
+func NewPushBooleanInstruction(value bool) NeoInstruction {
+	opcode := PUSHF
+	if value {
+		opcode = PUSHT
 	}
+	return NeoInstruction{Opcode: opcode, Size: 1, StackPush: 1, GasCost: 1}
+}
+
+// NewPushNullInstruction pushes null
+func NewPushNullInstruction() NeoInstruction {
+	return NeoInstruction{Opcode: PUSHNULL, Size: 1, StackPush: 1, GasCost: 1}
+}
+
+// NewArithmeticInstruction creates an instruction without operand, such as
+// ADD or PICKITEM, with the price and stack effect of opcodeTable.
+// Variable stack effects, such as those of PACK, are left to the caller.
+func NewArithmeticInstruction(op NeoOpcode) NeoInstruction {
+	return newTableInstruction(op)
 }
 
+// NewControlFlowInstruction creates a control flow instruction. Jumps take
+// target as their offset, in the short form when it fits and otherwise in
+// the long one; labelled jumps are emitted with 0 and encoded by
+// resolveLabels.
 func NewControlFlowInstruction(op NeoOpcode, target int) NeoInstruction {
-	var operand []byte
-	var stackPop int
-	var gasCost int64
-	
-	switch op {
-	case JMP:
-		stackPop = 0
-		gasCost = 2
-	case JMPIF, JMPIFNOT:
-		stackPop = 1
-		gasCost = 2
-	case CALL, CALLA:
-		stackPop = 0
-		gasCost = 512
-	case RET:
-		stackPop = 0
-		gasCost = 0
-	default:
-		stackPop = 0
-		gasCost = 1
-	}
-	
-	// Encode target address (4 bytes for NeoVM)
-	if target != 0 {
-		operand = make([]byte, 4)
-		operand[0] = byte(target)
-		operand[1] = byte(target >> 8)
-		operand[2] = byte(target >> 16)
-		operand[3] = byte(target >> 24)
+	if isJump(op) && (target < -128 || target > shortJumpRange) {
+		if long, ok := longJumps[op]; ok {
+			op = long
+		}
 	}
-	
-	return NeoInstruction{
-		Opcode:    op,
-		Operand:   operand,
-		Size:      1 + len(operand),
-		StackPop:  stackPop,
-		StackPush: 0,
-		GasCost:   gasCost,
+	instr := newTableInstruction(op)
+	if isJump(op) {
+		instr.Operand = make([]byte, opcodeTable[op].OperandSize)
+		for i := 0; i < len(instr.Operand)/jumpOffsets(op); i++ {
+			instr.Operand[i] = byte(target >> (8 * i))
+		}
+		instr.Size += len(instr.Operand)
 	}
+	return instr
 }
 
-func NewStackInstruction(op NeoOpcode, depth int) NeoInstruction {
-	var operand []byte
-	var stackPop, stackPush int
-	var gasCost int64
-	
+// NewStackInstruction creates a stack instruction such as DUP or SWAP.
+// PICK, XDROP and REVERSEN take their index from the stack, pushed first.
+func NewStackInstruction(op NeoOpcode) NeoInstruction {
+	return newTableInstruction(op)
+}
+
+// shortSlotForms is the number of slot indices with a 1-byte instruction
+const shortSlotForms = 7
+
+// MaxSlots is the number of slots an INITSLOT or INITSSLOT can allocate
+const MaxSlots = 255
+
+// NewSlotInstruction loads or stores slot index with op, one of LDSFLD,
+// STSFLD, LDLOC, STLOC, LDARG or STARG
+func NewSlotInstruction(op NeoOpcode, index int) NeoInstruction {
+	instr := NeoInstruction{Opcode: op, Size: 1, GasCost: opcodeTable[op].Price}
+	if index < shortSlotForms {
+		instr.Opcode = op - shortSlotForms + NeoOpcode(index)
+	} else {
+		instr.Operand = []byte{byte(index)}
+		instr.Size = 2
+	}
 	switch op {
-	case DUP:
-		stackPop, stackPush = 0, 1
-		gasCost = 2
-	case SWAP:
-		stackPop, stackPush = 2, 2
-		gasCost = 2
-	case ROT, ROLL:
-		stackPop, stackPush = 3, 3
-		gasCost = 2
-	case PICK:
-		stackPop, stackPush = 0, 1
-		gasCost = 2
-	case TUCK:
-		stackPop, stackPush = 2, 3
-		gasCost = 2
-	case DROP, NIP:
-		stackPop, stackPush = 1, 0
-		gasCost = 2
-	case XDROP:
-		stackPop, stackPush = 2, 0
-		gasCost = 16
-	case CLEAR:
-		stackPop, stackPush = 0, 0 // Clears entire stack
-		gasCost = 16
-	case DEPTH:
-		stackPop, stackPush = 0, 1
-		gasCost = 2
+	case LDSFLD, LDLOC, LDARG:
+		instr.StackPush = 1
 	default:
-		stackPop, stackPush = 0, 0
-		gasCost = 1
+		instr.StackPop = 1
 	}
-	
-	// Some instructions need depth parameter
-	if depth > 0 {
-		operand = []byte{byte(depth)}
+	return instr
+}
+
+// NewInitSlotInstruction allocates a function's local and argument slots,
+// popping the arguments off the stack
+func NewInitSlotInstruction(locals, args int) NeoInstruction {
+	return NeoInstruction{
+		Opcode:   INITSLOT,
+		Operand:  []byte{byte(locals), byte(args)},
+		Size:     3,
+		StackPop: args,
+		GasCost:  opcodeTable[INITSLOT].Price,
 	}
-	
+}
+
+// NewInitStaticSlotInstruction allocates the script's static fields
+func NewInitStaticSlotInstruction(count int) NeoInstruction {
 	return NeoInstruction{
-		Opcode:    op,
-		Operand:   operand,
-		Size:      1 + len(operand),
-		StackPop:  stackPop,
-		StackPush: stackPush,
-		GasCost:   gasCost,
+		Opcode:  INITSSLOT,
+		Operand: []byte{byte(count)},
+		Size:    2,
+		GasCost: opcodeTable[INITSSLOT].Price,
 	}
 }
 
-func NewSyscallInstruction(method string) NeoInstruction {
-	methodBytes := []byte(method)
-	
+// NewConvertInstruction converts the top stack item to the given type
+func NewConvertInstruction(target NeoVMType) NeoInstruction {
 	return NeoInstruction{
-		Opcode:    SYSCALL,
-		Operand:   methodBytes,
-		Size:      1 + len(methodBytes),
-		StackPop:  0, // Variable based on syscall
-		StackPush: 0, // Variable based on syscall  
-		GasCost:   1024, // Base syscall cost
-		Comment:   fmt.Sprintf("SYSCALL %s", method),
+		Opcode:    CONVERT,
+		Operand:   []byte{byte(target)},
+		Size:      2,
+		StackPop:  1,
+		StackPush: 1,
+		GasCost:   opcodeTable[CONVERT].Price,
 	}
 }
 
-// Helper functions
-func getSizeByteCount(opcode NeoOpcode) int {
-	switch opcode {
-	case PUSHDATA1:
-		return 1
-	case PUSHDATA2:
-		return 2
-	case PUSHDATA4:
-		return 4
-	default:
-		return 0
+// NewIsTypeInstruction tests whether the top stack item has the given type
+func NewIsTypeInstruction(target NeoVMType) NeoInstruction {
+	return NeoInstruction{
+		Opcode:    ISTYPE,
+		Operand:   []byte{byte(target)},
+		Size:      2,
+		StackPop:  1,
+		StackPush: 1,
+		GasCost:   opcodeTable[ISTYPE].Price,
 	}
 }
 
-// OpcodeMnemonic returns the string representation of an opcode
-func OpcodeMnemonic(op NeoOpcode) string {
-	switch op {
-	case PUSH0: return "PUSH0"
-	case PUSH1: return "PUSH1"
-	case PUSH2: return "PUSH2"
-	case PUSH3: return "PUSH3"
-	case PUSH4: return "PUSH4"
-	case PUSH5: return "PUSH5"
-	case PUSH6: return "PUSH6"
-	case PUSH7: return "PUSH7"
-	case PUSH8: return "PUSH8"
-	case PUSH9: return "PUSH9"
-	case PUSH10: return "PUSH10"
-	case PUSH11: return "PUSH11"
-	case PUSH12: return "PUSH12"
-	case PUSH13: return "PUSH13"
-	case PUSH14: return "PUSH14"
-	case PUSH15: return "PUSH15"
-	case PUSH16: return "PUSH16"
-	case PUSHDATA1: return "PUSHDATA1"
-	case PUSHDATA2: return "PUSHDATA2"
-	case PUSHDATA4: return "PUSHDATA4"
-	case DUP: return "DUP"
-	case SWAP: return "SWAP"
-	case ROT: return "ROT"
-	case ROLL: return "ROLL"
-	case PICK: return "PICK"
-	case TUCK: return "TUCK"
-	case DROP: return "DROP"
-	case NIP: return "NIP"
-	case XDROP: return "XDROP"
-	case CLEAR: return "CLEAR"
-	case DEPTH: return "DEPTH"
-	case ADD: return "ADD"
-	case SUB: return "SUB"
-	case MUL: return "MUL"
-	case DIV: return "DIV"
-	case MOD: return "MOD"
-	case SHL: return "SHL"
-	case SHR: return "SHR"
-	case NOT: return "NOT"
-	case BOOLAND: return "BOOLAND"
-	case BOOLOR: return "BOOLOR"
-	case NUMEQUAL: return "NUMEQUAL"
-	case NUMNOTEQUAL: return "NUMNOTEQUAL"
-	case LT: return "LT"
-	case LE: return "LE"
-	case GT: return "GT"
-	case GE: return "GE"
-	case MIN: return "MIN"
-	case MAX: return "MAX"
-	case WITHIN: return "WITHIN"
-	case AND: return "AND"
-	case OR: return "OR"
-	case XOR: return "XOR"
-	case EQUAL: return "EQUAL"
-	case NOTEQUAL: return "NOTEQUAL"
-	case JMP: return "JMP"
-	case JMPIF: return "JMPIF"
-	case JMPIFNOT: return "JMPIFNOT"
-	case CALL: return "CALL"
-	case RET: return "RET"
-	case SYSCALL: return "SYSCALL"
-	case NEWARRAY: return "NEWARRAY"
-	case NEWSTRUCT: return "NEWSTRUCT"
-	case NEWMAP: return "NEWMAP"
-	case APPEND: return "APPEND"
-	case REVERSE: return "REVERSE"
-	case REMOVE: return "REMOVE"
-	case HASKEY: return "HASKEY"
-	case KEYS: return "KEYS"
-	case VALUES: return "VALUES"
-	case PICKITEM: return "PICKITEM"
-	case SETITEM: return "SETITEM"
-	case SIZE: return "SIZE"
-	case ISNULL: return "ISNULL"
-	case ISTYPE: return "ISTYPE"
-	case CONVERT: return "CONVERT"
-	case ABORT: return "ABORT"
-	case ASSERT: return "ASSERT"
-	case THROW: return "THROW"
-	case TRY: return "TRY"
-	case ENDTRY: return "ENDTRY"
-	case ENDFINALLY: return "ENDFINALLY"
-	default:
-		return fmt.Sprintf("UNKNOWN(0x%02X)", byte(op))
+// NewSyscallInstruction calls an interop service with its registered stack
+// effect and price. The operand keeps the service name; the script encodes
+// its 4-byte interop ID.
+func NewSyscallInstruction(method string) NeoInstruction {
+	methodBytes := []byte(method)
+	instr := NeoInstruction{
+		Opcode:  SYSCALL,
+		Operand: methodBytes,
+		Size:    1 + opcodeTable[SYSCALL].OperandSize,
+		Comment: fmt.Sprintf("SYSCALL %s", method),
+	}
+	if service, ok := DefaultInteropRegistry().Lookup(method); ok {
+		instr.GasCost = service.Price
+		if service.Pop != StackVariable {
+			instr.StackPop = service.Pop
+		}
+		if service.Push != StackVariable {
+			instr.StackPush = service.Push
+		}
 	}
+	return instr
+}
+
+// getSizeByteCount returns the size of the length prefix of a PUSHDATA
+// operand
+func getSizeByteCount(opcode NeoOpcode) int {
+	return opcodeTable[opcode].SizePrefix
 }
 
 // CreateNeoVMInteger creates a NeoVM integer from various input types
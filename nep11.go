@@ -0,0 +1,568 @@
+package main
+
+import "fmt"
+
+// NEP-11 compliance mode.
+//
+// With the nep11 standard, an ERC-721 contract is also a non-divisible
+// NEP-11 token; with nep11-divisible, an ERC-1155 contract is a divisible
+// one. Token ids are the 32 big-endian bytes of their uint256 words; ids
+// passed in may be shorter. The stubs map the NEP-11 methods onto the
+// functions solc generates, found as for NEP-17:
+//
+//	symbol() String                      symbol()
+//	decimals() Integer                   0, or decimals() when divisible
+//	transfer(to, tokenId, data) Boolean  transferFrom(ownerOf(id), to, id)
+//	transfer(from, to, amount, tokenId, data) Boolean
+//	                                     safeTransferFrom(from, to, id, amount, "")
+//	ownerOf(tokenId) Hash160             ownerOf(id)
+//	balanceOf(owner, tokenId) Integer    balanceOf(owner, id), divisible
+//	properties(tokenId) Map              name() or symbol(), and tokenURI(id)
+//	                                     or uri(id) when defined
+//
+// Transfers succeed, fail and call back onNEP11Payment like NEP-17
+// transfers, with caller() as the owner or from account.
+//
+// EVM tokens cannot enumerate their tokens and owners, so the contract
+// keeps an index in storage under keys starting with 0xFF, updated by the
+// Transfer event of ERC-721 and the TransferSingle event of ERC-1155, which
+// are emitted as the NEP-11 Transfer notification [from, to, amount,
+// tokenId]. totalSupply(), balanceOf(owner) and the iterators of tokens(),
+// tokensOf(owner) and, for divisible tokens, ownerOf(tokenId) read the
+// index. TransferBatch is emitted as is and leaves the index unchanged.
+
+// NEP-11 standards
+const (
+	StandardNEP11          = "nep11"
+	StandardNEP11Divisible = "nep11-divisible"
+)
+
+// NEP11Standard is the name of NEP-11 in manifests
+const NEP11Standard = "NEP-11"
+
+// NEP11PaymentMethod is the method NEP-11 transfers invoke on the recipient
+const NEP11PaymentMethod = "onNEP11Payment"
+
+// erc1155TransferSingleSignature is the hash of
+// TransferSingle(address,address,address,uint256,uint256)
+const erc1155TransferSingleSignature = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"
+
+// Routines of the NEP-11 index
+const (
+	tokenIDRoutine = "token_id"
+	nep11Record    = "nep11_record"
+	nep11Adjust    = "nep11_adjust"
+)
+
+// Keys of the NEP-11 index
+var (
+	nep11TotalKey      = []byte{0xFF, 'C'} // Total supply
+	nep11SupplyPrefix  = []byte{0xFF, 'S'} // + id: supply of the token
+	nep11TokenPrefix   = []byte{0xFF, 'O'} // + owner + id: amount owned
+	nep11OwnerPrefix   = []byte{0xFF, 'H'} // + id + owner: amount owned, divisible only
+	nep11BalancePrefix = []byte{0xFF, 'B'} // + owner: total amount owned
+)
+
+// findKeysOnly finds the keys under a prefix, without the prefix
+const findKeysOnly = 0x01 | 0x02
+
+// zeroSlot is the memory word solc keeps 0, the empty bytes
+const zeroSlot = 0x60
+
+// ERC-721 and ERC-1155 functions of NEP-11 tokens
+var (
+	nep11Functions          = []tokenFunction{{"symbol", 0, 1}, {"ownerOf", 1, 1}, {"transferFrom", 3, 0}}
+	nep11DivisibleFunctions = []tokenFunction{{"symbol", 0, 1}, {"decimals", 0, 1}, {"balanceOf", 2, 1}, {"safeTransferFrom", 5, 0}}
+	nep11Properties         = []tokenFunction{{"name", 0, 1}, {"tokenURI", 1, 1}, {"uri", 1, 1}}
+)
+
+// nep11 reports whether the contract is compiled as a NEP-11 token
+func (g *CodeGenerator) nep11() bool {
+	return g.standard() == StandardNEP11 || g.standard() == StandardNEP11Divisible
+}
+
+// emitNEP11Stubs emits the NEP-11 methods of the token
+func (g *CodeGenerator) emitNEP11Stubs(fields int, location SourcePosition) error {
+	if !g.nep11() {
+		return nil
+	}
+	divisible := g.standard() == StandardNEP11Divisible
+	required := nep11Functions
+	if divisible {
+		required = nep11DivisibleFunctions
+	}
+	defs, err := g.tokenFunctions(required, nep11Properties)
+	if err != nil {
+		return err
+	}
+	c := memoryCode{g, location}
+	depth := g.stackTracker.currentDepth
+	defer func() { g.stackTracker.currentDepth = depth }()
+
+	integer := []MethodParameter{{Type: "Integer"}}
+	iterator := []MethodParameter{{Type: "InteropInterface"}}
+	owner := MethodParameter{Name: "owner", Type: "Hash160"}
+	tokenID := MethodParameter{Name: "tokenId", Type: "ByteArray"}
+
+	g.emitSymbolStub(defs["symbol"], fields, location)
+	g.emitTokenEntry(&ContractMethod{Name: "decimals", Returns: integer, Safe: true}, fields, location)
+	if divisible {
+		c.callFunction(defs["decimals"])
+	} else {
+		c.push(0)
+	}
+	c.op(NewControlFlowInstruction(RET, 0))
+
+	g.emitTokenEntry(&ContractMethod{Name: "totalSupply", Returns: integer, Safe: true}, fields, location)
+	c.op(NewPushInstruction(CreateNeoVMByteString(nep11TotalKey)))
+	g.emitStorageRead(location)
+	c.op(NewControlFlowInstruction(RET, 0))
+
+	g.emitTokenEntry(&ContractMethod{Name: "balanceOf", Parameters: []MethodParameter{owner}, Returns: integer, Safe: true}, fields, location)
+	g.emitAccountCheck("owner", location)
+	c.op(NewPushInstruction(CreateNeoVMByteString(nep11BalancePrefix)))
+	c.op(NewStackInstruction(SWAP))
+	c.arithmetic(CAT)
+	g.emitStorageRead(location)
+	c.op(NewControlFlowInstruction(RET, 0))
+
+	g.emitTokenEntry(&ContractMethod{Name: "tokensOf", Parameters: []MethodParameter{owner}, Returns: iterator, Safe: true}, fields, location)
+	g.emitAccountCheck("owner", location)
+	c.op(NewPushInstruction(CreateNeoVMByteString(nep11TokenPrefix)))
+	c.op(NewStackInstruction(SWAP))
+	c.arithmetic(CAT)
+	g.emitIndexFind(location)
+	c.op(NewControlFlowInstruction(RET, 0))
+
+	if divisible {
+		g.emitTokenEntry(&ContractMethod{Name: "ownerOf", Parameters: []MethodParameter{tokenID}, Returns: iterator, Safe: true}, fields, location)
+		g.emitTokenIDWord(location)
+		g.emitMemoryCall(tokenIDRoutine, 1, 1, location)
+		c.op(NewPushInstruction(CreateNeoVMByteString(nep11OwnerPrefix)))
+		c.op(NewStackInstruction(SWAP))
+		c.arithmetic(CAT)
+		g.emitIndexFind(location)
+		c.op(NewControlFlowInstruction(RET, 0))
+
+		g.emitTokenEntry(&ContractMethod{Name: "balanceOf", Parameters: []MethodParameter{owner, tokenID}, Returns: integer, Safe: true}, fields, location)
+		c.op(NewInitSlotInstruction(0, 2))
+		g.stackTracker.currentDepth = 0
+		c.arg(1)
+		g.emitTokenIDWord(location)
+		c.arg(0)
+		g.emitAccountCheck("owner", location)
+		c.addressWord()
+		c.callFunction(defs["balanceOf"])
+		c.op(NewControlFlowInstruction(RET, 0))
+	} else {
+		g.emitTokenEntry(&ContractMethod{Name: "ownerOf", Parameters: []MethodParameter{tokenID}, Returns: []MethodParameter{{Type: "Hash160"}}, Safe: true}, fields, location)
+		g.emitTokenIDWord(location)
+		c.callFunction(defs["ownerOf"])
+		c.addressScriptHash()
+		c.op(NewControlFlowInstruction(RET, 0))
+	}
+
+	g.emitTokenEntry(&ContractMethod{Name: "tokens", Returns: iterator, Safe: true}, fields, location)
+	c.op(NewPushInstruction(CreateNeoVMByteString(nep11SupplyPrefix)))
+	g.emitIndexFind(location)
+	c.op(NewControlFlowInstruction(RET, 0))
+
+	g.emitNEP11Properties(defs, fields, location)
+	if divisible {
+		g.emitNEP11DivisibleTransfer(defs["safeTransferFrom"], fields, location)
+	} else {
+		g.emitNEP11Transfer(defs, fields, location)
+	}
+	return nil
+}
+
+// emitNEP11Properties emits properties(tokenId), which throws for tokens
+// not in the index. Local: the token word.
+func (g *CodeGenerator) emitNEP11Properties(defs map[string]*YulFunctionDef, fields int, location SourcePosition) {
+	c := memoryCode{g, location}
+	known := g.createUniqueLabel("properties_known")
+	g.emitTokenEntry(&ContractMethod{
+		Name:       "properties",
+		Parameters: []MethodParameter{{Name: "tokenId", Type: "ByteArray"}},
+		Returns:    []MethodParameter{{Type: "Map"}},
+		Safe:       true,
+	}, fields, location)
+	c.op(NewInitSlotInstruction(1, 1))
+	g.stackTracker.currentDepth = 0
+	c.arg(0)
+	g.emitTokenIDWord(location)
+	c.op(NewSlotInstruction(STLOC, 0))
+
+	c.op(NewPushInstruction(CreateNeoVMByteString(nep11SupplyPrefix)))
+	c.op(NewSlotInstruction(LDLOC, 0))
+	g.emitMemoryCall(tokenIDRoutine, 1, 1, location)
+	c.arithmetic(CAT)
+	g.emitStorageRead(location)
+	c.jump(JMPIF, known)
+	c.op(NewPushInstruction(CreateNeoVMByteString("unknown token")))
+	c.op(NewControlFlowInstruction(THROW, 0))
+
+	g.markLabel(known)
+	newMap := NewArithmeticInstruction(NEWMAP)
+	newMap.StackPop, newMap.StackPush = 0, 1
+	c.op(newMap)
+	setItem := NewArithmeticInstruction(SETITEM)
+	setItem.StackPop, setItem.StackPush = 3, 0
+
+	name := defs["name"]
+	if name == nil {
+		name = defs["symbol"]
+	}
+	c.op(NewStackInstruction(DUP))
+	c.op(NewPushInstruction(CreateNeoVMByteString("name")))
+	c.callFunction(name)
+	g.emitMemoryString(location)
+	c.op(setItem)
+
+	uri := defs["tokenURI"]
+	if g.standard() == StandardNEP11Divisible || uri == nil {
+		uri = defs["uri"]
+	}
+	if uri != nil {
+		c.op(NewStackInstruction(DUP))
+		c.op(NewPushInstruction(CreateNeoVMByteString("tokenURI")))
+		c.op(NewSlotInstruction(LDLOC, 0))
+		c.callFunction(uri)
+		g.emitMemoryString(location)
+		c.op(setItem)
+	}
+	c.op(NewControlFlowInstruction(RET, 0))
+}
+
+// emitNEP11Transfer emits transfer(to, tokenId, data), which runs the
+// ERC-721 transferFrom(owner, to, id) as the owner. Locals: the owner and
+// token words.
+func (g *CodeGenerator) emitNEP11Transfer(defs map[string]*YulFunctionDef, fields int, location SourcePosition) {
+	c := memoryCode{g, location}
+	failed := g.createUniqueLabel("transfer_failed")
+
+	g.emitTokenEntry(&ContractMethod{
+		Name: "transfer",
+		Parameters: []MethodParameter{
+			{Name: "to", Type: "Hash160"}, {Name: "tokenId", Type: "ByteArray"}, {Name: "data", Type: "Any"},
+		},
+		Returns: []MethodParameter{{Type: "Boolean"}},
+	}, fields, location)
+	c.op(NewInitSlotInstruction(2, 3))
+	g.stackTracker.currentDepth = 0
+
+	c.arg(0)
+	g.emitAccountCheck("to", location)
+	c.op(NewStackInstruction(DROP))
+	c.arg(1)
+	g.emitTokenIDWord(location)
+	c.op(NewSlotInstruction(STLOC, 1))
+	c.op(NewSlotInstruction(LDLOC, 1))
+	c.callFunction(defs["ownerOf"])
+	c.op(NewStackInstruction(DUP))
+	c.op(NewSlotInstruction(STLOC, 0))
+	c.op(NewSlotInstruction(STSFLD, g.memory.sender))
+
+	c.op(NewSlotInstruction(LDLOC, 0))
+	c.addressScriptHash()
+	g.emitWitnessCheck(failed, location)
+	g.emitTransferCall(defs["transferFrom"], func() {
+		c.op(NewSlotInstruction(LDLOC, 1))
+		c.arg(0)
+		c.addressWord()
+		c.op(NewSlotInstruction(LDLOC, 0))
+	}, location)
+	c.jump(JMPIFNOT, failed)
+	g.emitPaymentCallback(NEP11PaymentMethod, func() { c.arg(0) }, func() {
+		c.arg(2)
+		c.arg(1)
+		c.push(1)
+		c.op(NewSlotInstruction(LDLOC, 0))
+		c.addressScriptHash()
+	}, 4, location)
+	c.op(NewPushBooleanInstruction(true))
+	c.op(NewControlFlowInstruction(RET, 0))
+
+	g.markLabel(failed)
+	c.op(NewPushBooleanInstruction(false))
+	c.op(NewControlFlowInstruction(RET, 0))
+}
+
+// emitNEP11DivisibleTransfer emits transfer(from, to, amount, tokenId,
+// data), which runs the ERC-1155 safeTransferFrom(from, to, id, amount, "")
+// as from. Locals: the to and token words.
+func (g *CodeGenerator) emitNEP11DivisibleTransfer(def *YulFunctionDef, fields int, location SourcePosition) {
+	c := memoryCode{g, location}
+	failed := g.createUniqueLabel("transfer_failed")
+
+	g.emitTokenEntry(&ContractMethod{
+		Name: "transfer",
+		Parameters: []MethodParameter{
+			{Name: "from", Type: "Hash160"}, {Name: "to", Type: "Hash160"}, {Name: "amount", Type: "Integer"},
+			{Name: "tokenId", Type: "ByteArray"}, {Name: "data", Type: "Any"},
+		},
+		Returns: []MethodParameter{{Type: "Boolean"}},
+	}, fields, location)
+	c.op(NewInitSlotInstruction(2, 5))
+	g.stackTracker.currentDepth = 0
+
+	c.arg(0)
+	g.emitAccountCheck("from", location)
+	c.addressWord()
+	c.op(NewSlotInstruction(STSFLD, g.memory.sender))
+	c.arg(1)
+	g.emitAccountCheck("to", location)
+	c.addressWord()
+	c.op(NewSlotInstruction(STLOC, 0))
+	c.arg(2)
+	g.emitAmountCheck(location)
+	c.op(NewStackInstruction(DROP))
+	c.arg(3)
+	g.emitTokenIDWord(location)
+	c.op(NewSlotInstruction(STLOC, 1))
+
+	c.arg(0)
+	g.emitWitnessCheck(failed, location)
+	g.emitTransferCall(def, func() {
+		c.push(zeroSlot)
+		c.arg(2)
+		c.op(NewSlotInstruction(LDLOC, 1))
+		c.op(NewSlotInstruction(LDLOC, 0))
+		c.op(NewSlotInstruction(LDSFLD, g.memory.sender))
+	}, location)
+	c.jump(JMPIFNOT, failed)
+	g.emitPaymentCallback(NEP11PaymentMethod, func() { c.arg(1) }, func() {
+		c.arg(4)
+		c.arg(3)
+		c.arg(2)
+		c.arg(0)
+	}, 4, location)
+	c.op(NewPushBooleanInstruction(true))
+	c.op(NewControlFlowInstruction(RET, 0))
+
+	g.markLabel(failed)
+	c.op(NewPushBooleanInstruction(false))
+	c.op(NewControlFlowInstruction(RET, 0))
+}
+
+// emitTokenIDWord converts the token id on top of the stack to its word,
+// throwing for ids longer than 32 bytes
+func (g *CodeGenerator) emitTokenIDWord(location SourcePosition) {
+	c := memoryCode{g, location}
+	valid := g.createUniqueLabel("token_id_valid")
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(SIZE)
+	c.push(32)
+	c.arithmetic(GT)
+	c.jump(JMPIFNOT, valid)
+	c.op(NewPushInstruction(CreateNeoVMByteString("invalid tokenId")))
+	c.op(NewControlFlowInstruction(THROW, 0))
+
+	g.markLabel(valid)
+	c.op(NewConvertInstruction(BufferType))
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(REVERSEITEMS)
+	c.paddedWord()
+}
+
+// emitIndexFind iterates the keys under the index prefix on top of the
+// stack, without the prefix
+func (g *CodeGenerator) emitIndexFind(location SourcePosition) {
+	c := memoryCode{g, location}
+	c.push(findKeysOnly)
+	c.op(NewStackInstruction(SWAP))
+	g.emitStorageContext(location)
+	c.op(NewSyscallInstruction("System.Storage.Find"))
+}
+
+// nep11TransferEvent is the Transfer event of a NEP-11 token of standard
+func nep11TransferEvent(standard string) *ContractEvent {
+	signature := erc20TransferSignature
+	if standard == StandardNEP11Divisible {
+		signature = erc1155TransferSingleSignature
+	}
+	return &ContractEvent{
+		Name:      "Transfer",
+		Signature: signature,
+		Parameters: []EventParameter{
+			{Name: "from", Type: "Hash160"}, {Name: "to", Type: "Hash160"},
+			{Name: "amount", Type: "Integer"}, {Name: "tokenId", Type: "ByteArray"},
+		},
+	}
+}
+
+// isNEP11Transfer reports whether a log emits the transfer event of the
+// EVM token behind a NEP-11 token
+func (g *CodeGenerator) isNEP11Transfer(call *YulFunctionCall) bool {
+	if !g.nep11() || call.FunctionName.Name != "log4" || len(call.Arguments) != 6 {
+		return false
+	}
+	lit, ok := call.Arguments[2].(*YulLiteral)
+	if !ok {
+		return false
+	}
+	value, err := ParseYulLiteralValue(lit)
+	if err != nil {
+		return false
+	}
+	signature := fmt.Sprintf("0x%064x", toWord(value))
+	if g.standard() == StandardNEP11Divisible {
+		return signature == erc1155TransferSingleSignature
+	}
+	return signature == erc20TransferSignature
+}
+
+// generateNEP11Transfer records log4(p, s, signature, from, to, id) of
+// ERC-721, or log4(p, s, signature, operator, from, to) of ERC-1155 with
+// the id and amount at p, in the index and emits the Transfer
+// notification
+func (g *CodeGenerator) generateNEP11Transfer(location SourcePosition) {
+	c := memoryCode{g, location}
+	if g.standard() != StandardNEP11Divisible {
+		c.op(NewStackInstruction(DROP))
+		c.op(NewStackInstruction(DROP))
+		c.op(NewStackInstruction(DROP))
+		c.push(1)
+		g.emitMemoryCall(nep11Record, 4, 0, location)
+		return
+	}
+
+	c.op(NewStackInstruction(NIP))
+	c.op(NewStackInstruction(NIP))
+	c.op(NewStackInstruction(NIP))
+	c.op(NewStackInstruction(DUP))
+	c.push(32)
+	c.arithmetic(ADD)
+	g.emitMemoryCall(memoryLoad, 1, 1, location)
+	c.op(NewStackInstruction(SWAP))
+	g.emitMemoryCall(memoryLoad, 1, 1, location)
+
+	// id, amount, from, to to amount, from, to, id
+	c.push(4)
+	c.op(NewStackInstruction(REVERSEN))
+	c.push(3)
+	c.op(NewStackInstruction(REVERSEN))
+	g.emitMemoryCall(nep11Record, 4, 0, location)
+}
+
+// emitNEP11Record updates the index for a transfer and emits the Transfer
+// notification. Arguments: amount, from, to and id words; locals: from
+// and to script hashes or null, token id.
+func (g *CodeGenerator) emitNEP11Record(location SourcePosition) {
+	c := memoryCode{g, location}
+	ld := func(i int) { c.op(NewSlotInstruction(LDLOC, i)) }
+	st := func(i int) { c.op(NewSlotInstruction(STLOC, i)) }
+	key := func(prefix []byte, parts ...int) {
+		c.op(NewPushInstruction(CreateNeoVMByteString(prefix)))
+		for _, part := range parts {
+			ld(part)
+			c.arithmetic(CAT)
+		}
+	}
+	// adjust adds the amount, or subtracts it, under the key
+	adjust := func(subtract bool, prefix []byte, parts ...int) {
+		if subtract {
+			c.push(0)
+			c.arg(0)
+			c.arithmetic(SUB)
+		} else {
+			c.arg(0)
+		}
+		key(prefix, parts...)
+		c.call(nep11Adjust, 2, 0)
+	}
+	notMinted := g.createUniqueLabel("nep11_not_minted")
+	notBurned := g.createUniqueLabel("nep11_not_burned")
+	fromDone := g.createUniqueLabel("nep11_from_done")
+	toDone := g.createUniqueLabel("nep11_to_done")
+	divisible := g.standard() == StandardNEP11Divisible
+
+	c.arg(1)
+	c.call(addressHash, 1, 1)
+	st(0)
+	c.arg(2)
+	c.call(addressHash, 1, 1)
+	st(1)
+	c.arg(3)
+	c.call(tokenIDRoutine, 1, 1)
+	st(2)
+
+	// Mints and burns change the supplies
+	ld(0)
+	c.arithmetic(ISNULL)
+	c.jump(JMPIFNOT, notMinted)
+	adjust(false, nep11TotalKey)
+	adjust(false, nep11SupplyPrefix, 2)
+	g.markLabel(notMinted)
+	ld(1)
+	c.arithmetic(ISNULL)
+	c.jump(JMPIFNOT, notBurned)
+	adjust(true, nep11TotalKey)
+	adjust(true, nep11SupplyPrefix, 2)
+	g.markLabel(notBurned)
+
+	ld(0)
+	c.arithmetic(ISNULL)
+	c.jump(JMPIF, fromDone)
+	adjust(true, nep11TokenPrefix, 0, 2)
+	adjust(true, nep11BalancePrefix, 0)
+	if divisible {
+		adjust(true, nep11OwnerPrefix, 2, 0)
+	}
+	g.markLabel(fromDone)
+	ld(1)
+	c.arithmetic(ISNULL)
+	c.jump(JMPIF, toDone)
+	adjust(false, nep11TokenPrefix, 1, 2)
+	adjust(false, nep11BalancePrefix, 1)
+	if divisible {
+		adjust(false, nep11OwnerPrefix, 2, 1)
+	}
+	g.markLabel(toDone)
+
+	ld(2)
+	c.arg(0)
+	ld(1)
+	ld(0)
+	c.push(4)
+	pack := NewArithmeticInstruction(PACK)
+	pack.StackPop, pack.StackPush = 5, 1
+	c.op(pack)
+	c.op(NewPushInstruction(CreateNeoVMByteString("Transfer")))
+	c.op(NewSyscallInstruction("System.Runtime.Notify"))
+}
+
+// emitNEP11Adjust adds delta to the integer under key, deleting the key
+// when it reaches 0. Arguments: key, delta.
+func (g *CodeGenerator) emitNEP11Adjust(location SourcePosition) {
+	c := memoryCode{g, location}
+	remove := g.createUniqueLabel("nep11_adjust_remove")
+	done := g.createUniqueLabel("nep11_adjust_done")
+
+	c.arg(0)
+	g.emitStorageRead(location)
+	c.arg(1)
+	c.arithmetic(ADD)
+	c.op(NewStackInstruction(DUP))
+	c.jump(JMPIFNOT, remove)
+	c.arg(0)
+	g.emitStorageContext(location)
+	c.op(NewSyscallInstruction("System.Storage.Put"))
+	c.jump(JMP, done)
+
+	g.markLabel(remove)
+	c.op(NewStackInstruction(DROP))
+	c.arg(0)
+	g.emitStorageContext(location)
+	c.op(NewSyscallInstruction("System.Storage.Delete"))
+	g.markLabel(done)
+}
+
+// emitTokenID returns the 32 big-endian bytes of a word. Argument: the
+// word.
+func (g *CodeGenerator) emitTokenID(location SourcePosition) {
+	c := memoryCode{g, location}
+	c.arg(0)
+	c.wordBytes()
+	c.op(NewConvertInstruction(ByteStringType))
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// NEP-17 compliance mode.
+//
+// With the nep17 standard, an ERC-20 contract is also a NEP-17 token. The
+// functions solc generates for symbol, decimals, totalSupply, balanceOf and
+// transfer, fun_<name>_<id> or getter_fun_<name>_<id> for public state
+// variables, or Yul functions of those names, get NEP-17 methods entered
+// through stubs:
+//
+//	symbol() String             the string at the returned memory pointer
+//	decimals() Integer
+//	totalSupply() Integer
+//	balanceOf(account Hash160) Integer
+//	transfer(from, to Hash160, amount Integer, data Any) Boolean
+//
+// transfer returns false when from neither signed the transaction nor is
+// the calling contract, and when the ERC-20 transfer returns 0. It runs the
+// ERC-20 transfer with caller() as from. A revert of the transfer faults
+// the invocation rather than returning false: caught in the same execution
+// context, it would leave Neo to keep what the transfer wrote before
+// reverting. After a transfer to a deployed contract, the stub calls its
+// onNEP17Payment(from, amount, data).
+//
+// The ERC-20 Transfer event, log3 with the Transfer signature, is emitted
+// as the NEP-17 Transfer notification [from, to, amount], where accounts
+// are script hashes and the zero address of mints and burns is null. The
+// manifest declares NEP-17.
+
+// StandardNEP17 is the NEP-17 compliance mode
+const StandardNEP17 = "nep17"
+
+// standardFlag selects the standard, as --standard=nep17 or
+// --standard nep17
+const standardFlag = "--standard"
+
+// NEP17Standard is the name of NEP-17 in manifests
+const NEP17Standard = "NEP-17"
+
+// erc20TransferSignature is the hash of Transfer(address,address,uint256)
+const erc20TransferSignature = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// addressHash is the routine converting an address word to a script hash
+const addressHash = "address_hash"
+
+// tokenFreeMemory is where solc code expects the free memory pointer to
+// start, as set by the dispatcher the stubs bypass
+const tokenFreeMemory = 0x80
+
+// tokenFunction is a function of the EVM token a token standard maps
+type tokenFunction struct {
+	name    string
+	params  int
+	returns int
+}
+
+// nep17Functions are the ERC-20 functions of a NEP-17 token
+var nep17Functions = []tokenFunction{
+	{"symbol", 0, 1}, {"decimals", 0, 1}, {"totalSupply", 0, 1}, {"balanceOf", 1, 1}, {"transfer", 2, 1},
+}
+
+// solcFunctionName matches the names solc gives functions and getters
+var solcFunctionName = regexp.MustCompile(`^(?:getter_)?fun_(.+)_[0-9]+$`)
+
+// StandardFromConfig returns the standard of a configuration, "" for none.
+// A --standard flag in CompilerFlags takes precedence over Standard.
+func StandardFromConfig(config CompilerConfig) (string, error) {
+	value := flagValue(config.CompilerFlags, standardFlag, config.Standard)
+	switch strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(value))) {
+	case "":
+		return "", nil
+	case StandardNEP17:
+		return StandardNEP17, nil
+	case StandardNEP11:
+		return StandardNEP11, nil
+	case "nep11divisible":
+		return StandardNEP11Divisible, nil
+	default:
+		return "", fmt.Errorf("unknown standard %q (expected nep17, nep11 or nep11-divisible)", value)
+	}
+}
+
+// StandardName is the name of standard in manifests, "" for none
+func StandardName(standard string) string {
+	switch standard {
+	case StandardNEP17:
+		return NEP17Standard
+	case StandardNEP11, StandardNEP11Divisible:
+		return NEP11Standard
+	}
+	return ""
+}
+
+// declareStandard returns standards with name included
+func declareStandard(standards []string, name string) []string {
+	for _, standard := range standards {
+		if standard == name {
+			return standards
+		}
+	}
+	return append(standards, name)
+}
+
+// standard returns the token standard the contract complies with
+func (g *CodeGenerator) standard() string {
+	if g.context == nil {
+		return ""
+	}
+	return g.context.Standard
+}
+
+// nep17 reports whether the contract is compiled as a NEP-17 token
+func (g *CodeGenerator) nep17() bool {
+	return g.standard() == StandardNEP17
+}
+
+// findTokenFunction returns the function of the EVM token fn names, nil
+// when there is none
+func (g *CodeGenerator) findTokenFunction(fn tokenFunction) (*YulFunctionDef, error) {
+	var found []*YulFunctionDef
+	for name, def := range g.signatures {
+		if match := solcFunctionName.FindStringSubmatch(name); name == fn.name || match != nil && match[1] == fn.name {
+			found = append(found, def)
+		}
+	}
+	standard := StandardName(g.standard())
+	switch {
+	case len(found) == 0:
+		return nil, nil
+	case len(found) > 1:
+		names := make([]string, len(found))
+		for i, def := range found {
+			names[i] = def.Name
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%s %s is ambiguous: %s", standard, fn.name, strings.Join(names, ", "))
+	}
+	def := found[0]
+	if len(def.Parameters) != fn.params || len(def.Returns) != fn.returns {
+		return nil, fmt.Errorf("%s %s: function %s takes %d parameters and returns %d values, expected %d and %d",
+			standard, fn.name, def.Name, len(def.Parameters), len(def.Returns), fn.params, fn.returns)
+	}
+	return def, nil
+}
+
+// tokenFunctions returns the functions of the EVM token by name, requiring
+// those in required
+func (g *CodeGenerator) tokenFunctions(required, optional []tokenFunction) (map[string]*YulFunctionDef, error) {
+	defs := make(map[string]*YulFunctionDef)
+	for i, fn := range append(append([]tokenFunction(nil), required...), optional...) {
+		def, err := g.findTokenFunction(fn)
+		if err != nil {
+			return nil, err
+		}
+		if def == nil && i < len(required) {
+			return nil, fmt.Errorf("%s requires %s, but no function %s or fun_%s_<id> is defined",
+				StandardName(g.standard()), fn.name, fn.name, fn.name)
+		}
+		if def != nil {
+			defs[fn.name] = def
+		}
+	}
+	if g.memory.slot < 0 {
+		return nil, fmt.Errorf("%s symbol returns a memory string, but the contract uses no memory", StandardName(g.standard()))
+	}
+	return defs, nil
+}
+
+// emitNEP17Stubs emits the NEP-17 methods of the token
+func (g *CodeGenerator) emitNEP17Stubs(fields int, location SourcePosition) error {
+	if !g.nep17() {
+		return nil
+	}
+	defs, err := g.tokenFunctions(nep17Functions, nil)
+	if err != nil {
+		return err
+	}
+	c := memoryCode{g, location}
+	depth := g.stackTracker.currentDepth
+	defer func() { g.stackTracker.currentDepth = depth }()
+
+	integer := []MethodParameter{{Type: "Integer"}}
+	g.emitSymbolStub(defs["symbol"], fields, location)
+	for _, name := range []string{"decimals", "totalSupply"} {
+		g.emitTokenEntry(&ContractMethod{Name: name, Returns: integer, Safe: true}, fields, location)
+		c.callFunction(defs[name])
+		c.op(NewControlFlowInstruction(RET, 0))
+	}
+
+	g.emitTokenEntry(&ContractMethod{
+		Name:       "balanceOf",
+		Parameters: []MethodParameter{{Name: "account", Type: "Hash160"}},
+		Returns:    integer,
+		Safe:       true,
+	}, fields, location)
+	g.emitAccountCheck("account", location)
+	c.addressWord()
+	c.callFunction(defs["balanceOf"])
+	c.op(NewControlFlowInstruction(RET, 0))
+
+	g.emitNEP17Transfer(defs["transfer"], fields, location)
+	return nil
+}
+
+// tokenLabel is the label of the stub of a token method with params
+// parameters
+func tokenLabel(method string, params int) string {
+	return fmt.Sprintf("token_%s_%d", method, params)
+}
+
+// emitTokenEntry starts the stub of a token method with the free memory
+// pointer solc code expects
+func (g *CodeGenerator) emitTokenEntry(method *ContractMethod, fields int, location SourcePosition) {
+	g.emitStubEntry(tokenLabel(method.Name, len(method.Parameters)), method, fields, location)
+	c := memoryCode{g, location}
+	c.push(tokenFreeMemory)
+	c.push(0x40)
+	g.emitMemoryCall(memoryStore, 2, 0, location)
+}
+
+// emitSymbolStub emits symbol(), the string at the memory pointer def
+// returns
+func (g *CodeGenerator) emitSymbolStub(def *YulFunctionDef, fields int, location SourcePosition) {
+	c := memoryCode{g, location}
+	g.emitTokenEntry(&ContractMethod{Name: "symbol", Returns: []MethodParameter{{Type: "String"}}, Safe: true}, fields, location)
+	c.callFunction(def)
+	g.emitMemoryString(location)
+	c.op(NewControlFlowInstruction(RET, 0))
+}
+
+// emitMemoryString reads the Solidity string or bytes at the memory
+// pointer on top of the stack, its length word first
+func (g *CodeGenerator) emitMemoryString(location SourcePosition) {
+	c := memoryCode{g, location}
+	c.op(NewStackInstruction(DUP))
+	g.emitMemoryCall(memoryLoad, 1, 1, location)
+	c.op(NewStackInstruction(SWAP))
+	c.push(32)
+	c.arithmetic(ADD)
+	g.emitMemoryCall(memorySlice, 2, 1, location)
+	c.op(NewConvertInstruction(ByteStringType))
+}
+
+// emitAccountCheck throws unless the item on top of the stack is a 20-byte
+// script hash, keeping it
+func (g *CodeGenerator) emitAccountCheck(name string, location SourcePosition) {
+	c := memoryCode{g, location}
+	valid := g.createUniqueLabel(name + "_valid")
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(SIZE)
+	c.push(20)
+	c.arithmetic(NUMEQUAL)
+	c.jump(JMPIF, valid)
+	c.op(NewPushInstruction(CreateNeoVMByteString("invalid " + name)))
+	c.op(NewControlFlowInstruction(THROW, 0))
+	g.markLabel(valid)
+}
+
+// emitNEP17Transfer emits transfer(from, to, amount, data), which runs the
+// ERC-20 transfer(to, amount) as from. Local: the word of to.
+func (g *CodeGenerator) emitNEP17Transfer(def *YulFunctionDef, fields int, location SourcePosition) {
+	c := memoryCode{g, location}
+	failed := g.createUniqueLabel("transfer_failed")
+
+	g.emitTokenEntry(&ContractMethod{
+		Name: "transfer",
+		Parameters: []MethodParameter{
+			{Name: "from", Type: "Hash160"}, {Name: "to", Type: "Hash160"},
+			{Name: "amount", Type: "Integer"}, {Name: "data", Type: "Any"},
+		},
+		Returns: []MethodParameter{{Type: "Boolean"}},
+	}, fields, location)
+	c.op(NewInitSlotInstruction(1, 4))
+	g.stackTracker.currentDepth = 0
+
+	c.arg(0)
+	g.emitAccountCheck("from", location)
+	c.addressWord()
+	c.op(NewSlotInstruction(STSFLD, g.memory.sender))
+	c.arg(1)
+	g.emitAccountCheck("to", location)
+	c.addressWord()
+	c.op(NewSlotInstruction(STLOC, 0))
+	c.arg(2)
+	g.emitAmountCheck(location)
+	c.op(NewStackInstruction(DROP))
+
+	c.arg(0)
+	g.emitWitnessCheck(failed, location)
+	g.emitTransferCall(def, func() {
+		c.arg(2)
+		c.op(NewSlotInstruction(LDLOC, 0))
+	}, location)
+	c.jump(JMPIFNOT, failed)
+	g.emitPaymentCallback(PaymentMethod, func() { c.arg(1) }, func() {
+		c.arg(3)
+		c.arg(2)
+		c.arg(0)
+	}, 3, location)
+	c.op(NewPushBooleanInstruction(true))
+	c.op(NewControlFlowInstruction(RET, 0))
+
+	g.markLabel(failed)
+	c.op(NewPushBooleanInstruction(false))
+	c.op(NewControlFlowInstruction(RET, 0))
+}
+
+// emitAmountCheck throws if the amount on top of the stack is negative,
+// keeping it
+func (g *CodeGenerator) emitAmountCheck(location SourcePosition) {
+	c := memoryCode{g, location}
+	valid := g.createUniqueLabel("amount_valid")
+	c.op(NewStackInstruction(DUP))
+	c.push(0)
+	c.arithmetic(LT)
+	c.jump(JMPIFNOT, valid)
+	c.op(NewPushInstruction(CreateNeoVMByteString("negative amount")))
+	c.op(NewControlFlowInstruction(THROW, 0))
+	g.markLabel(valid)
+}
+
+// emitWitnessCheck continues at failed unless the account on top of the
+// stack signed the transaction or is the calling contract
+func (g *CodeGenerator) emitWitnessCheck(failed string, location SourcePosition) {
+	c := memoryCode{g, location}
+	c.op(NewStackInstruction(DUP))
+	c.syscall("System.Runtime.GetCallingScriptHash")
+	c.arithmetic(EQUAL)
+	c.op(NewStackInstruction(SWAP))
+	c.op(NewSyscallInstruction("System.Runtime.CheckWitness"))
+	c.arithmetic(BOOLOR)
+	c.jump(JMPIFNOT, failed)
+}
+
+// emitTransferCall calls def with the arguments args pushes and leaves
+// whether it succeeded: its return value, or 1 when it returns nothing. A
+// revert is left to fault the invocation, so that Neo discards the storage
+// def wrote before reverting. It is called with an empty stack.
+func (g *CodeGenerator) emitTransferCall(def *YulFunctionDef, args func(), location SourcePosition) {
+	c := memoryCode{g, location}
+	args()
+	c.callFunction(def)
+	if len(def.Returns) == 0 {
+		c.push(1)
+	}
+}
+
+// emitPaymentCallback calls method of the recipient to pushes, with the
+// count arguments args pushes, when it is a deployed contract
+func (g *CodeGenerator) emitPaymentCallback(method string, to, args func(), count int, location SourcePosition) {
+	c := memoryCode{g, location}
+	done := g.createUniqueLabel("payment_callback_done")
+	to()
+	c.callNative(ContractManagementHash, "getContract", 1, callFlagsReadStates)
+	c.arithmetic(ISNULL)
+	c.jump(JMPIF, done)
+	args()
+	c.push(count)
+	pack := NewArithmeticInstruction(PACK)
+	pack.StackPop, pack.StackPush = count+1, 1
+	c.op(pack)
+	c.push(callFlagsAll)
+	c.op(NewPushInstruction(CreateNeoVMByteString(method)))
+	to()
+	c.op(NewSyscallInstruction("System.Contract.Call"))
+	c.op(NewStackInstruction(DROP))
+	g.permit("*", method)
+	g.markLabel(done)
+}
+
+// generateCaller pushes the caller. Tokens see the from account of a
+// transfer, and others the calling contract, as an address word. _deploy
+// sees the deploying account.
+func (g *CodeGenerator) generateCaller(location SourcePosition) {
+	if g.deploying {
+		g.generateDeployer(location)
+		return
+	}
+	c := memoryCode{g, location}
+	if g.memory != nil && g.memory.sender >= 0 {
+		done := g.createUniqueLabel("caller_done")
+		c.op(NewSlotInstruction(LDSFLD, g.memory.sender))
+		c.op(NewStackInstruction(DUP))
+		c.arithmetic(ISNULL)
+		c.jump(JMPIFNOT, done)
+		c.op(NewStackInstruction(DROP))
+		c.syscall("System.Runtime.GetCallingScriptHash")
+		c.addressWord()
+		g.markLabel(done)
+		return
+	}
+	c.syscall("System.Runtime.GetCallingScriptHash")
+	c.addressWord()
+}
+
+// isNEP17Transfer reports whether a log emits the ERC-20 Transfer event of
+// a NEP-17 token
+func (g *CodeGenerator) isNEP17Transfer(call *YulFunctionCall) bool {
+	if !g.nep17() || call.FunctionName.Name != "log3" || len(call.Arguments) != 5 {
+		return false
+	}
+	lit, ok := call.Arguments[2].(*YulLiteral)
+	if !ok {
+		return false
+	}
+	value, err := ParseYulLiteralValue(lit)
+	return err == nil && fmt.Sprintf("0x%064x", toWord(value)) == erc20TransferSignature
+}
+
+// nep17TransferEvent is the Transfer event of a NEP-17 token
+func nep17TransferEvent() *ContractEvent {
+	return &ContractEvent{
+		Name:      "Transfer",
+		Signature: erc20TransferSignature,
+		Parameters: []EventParameter{
+			{Name: "from", Type: "Hash160"}, {Name: "to", Type: "Hash160"}, {Name: "amount", Type: "Integer"},
+		},
+	}
+}
+
+// generateNEP17Transfer emits the Transfer notification of
+// log3(p, s, signature, from, to), whose data at p is the amount
+func (g *CodeGenerator) generateNEP17Transfer(location SourcePosition) {
+	c := memoryCode{g, location}
+	g.emitMemoryCall(memoryLoad, 1, 1, location)
+	c.op(NewStackInstruction(NIP))
+	c.op(NewStackInstruction(NIP))
+
+	// amount, from, to to from, to, amount as script hashes
+	c.op(NewStackInstruction(SWAP))
+	g.emitMemoryCall(addressHash, 1, 1, location)
+	c.op(NewStackInstruction(ROT))
+	g.emitMemoryCall(addressHash, 1, 1, location)
+	c.op(NewStackInstruction(SWAP))
+	c.push(3)
+	pack := NewArithmeticInstruction(PACK)
+	pack.StackPop, pack.StackPush = 4, 1
+	c.op(pack)
+
+	c.op(NewPushInstruction(CreateNeoVMByteString("Transfer")))
+	c.op(NewSyscallInstruction("System.Runtime.Notify"))
+}
+
+// emitAddressHash returns the script hash of an address word, or null for
+// the zero address. Argument: the word.
+func (g *CodeGenerator) emitAddressHash(location SourcePosition) {
+	c := memoryCode{g, location}
+	zero := g.createUniqueLabel("address_hash_zero")
+	done := g.createUniqueLabel("address_hash_done")
+	c.arg(0)
+	c.jump(JMPIFNOT, zero)
+	c.arg(0)
+	c.addressScriptHash()
+	c.jump(JMP, done)
+	g.markLabel(zero)
+	c.op(NewPushNullInstruction())
+	g.markLabel(done)
+}
@@ -0,0 +1,234 @@
+package main
+
+import "fmt"
+
+// NeoVM opcode metadata.
+//
+// opcodeTable describes each opcode of the Neo N3 instruction set: its
+// mnemonic, the size of its operand, its stack effect and its price in the
+// Policy units of the mainnet opcode price table. The instruction
+// constructors, OpcodeMnemonic and pricing files read it.
+//
+// Stack effects count the items an instruction consumes and produces.
+// Items it only reads, such as the one DUP copies, are not counted; items
+// it reorders, such as the ones SWAP exchanges, are counted both ways.
+
+// StackVariable marks a stack effect decided by the operands or the stack,
+// which the emitting code sets on the instruction
+const StackVariable = -1
+
+// OpcodeInfo describes an opcode
+type OpcodeInfo struct {
+	Mnemonic    string
+	OperandSize int   // Fixed operand bytes
+	SizePrefix  int   // Bytes of the length prefix of a PUSHDATA operand
+	Pop         int   // Items consumed, or StackVariable
+	Push        int   // Items produced, or StackVariable
+	Price       int64 // Mainnet price in Policy units
+}
+
+// opcodeTable holds the metadata of every opcode
+var opcodeTable = buildOpcodeTable()
+
+// buildOpcodeTable lists the opcodes and adds the PUSH0-PUSH16 and 1-byte
+// slot forms
+func buildOpcodeTable() map[NeoOpcode]OpcodeInfo {
+	v := StackVariable
+	table := map[NeoOpcode]OpcodeInfo{
+		// Constants
+		PUSHINT8:   {"PUSHINT8", 1, 0, 0, 1, 1},
+		PUSHINT16:  {"PUSHINT16", 2, 0, 0, 1, 1},
+		PUSHINT32:  {"PUSHINT32", 4, 0, 0, 1, 1},
+		PUSHINT64:  {"PUSHINT64", 8, 0, 0, 1, 1},
+		PUSHINT128: {"PUSHINT128", 16, 0, 0, 1, 1 << 2},
+		PUSHINT256: {"PUSHINT256", 32, 0, 0, 1, 1 << 2},
+		PUSHT:      {"PUSHT", 0, 0, 0, 1, 1},
+		PUSHF:      {"PUSHF", 0, 0, 0, 1, 1},
+		PUSHA:      {"PUSHA", 4, 0, 0, 1, 1 << 2},
+		PUSHNULL:   {"PUSHNULL", 0, 0, 0, 1, 1},
+		PUSHDATA1:  {"PUSHDATA1", 0, 1, 0, 1, 1 << 3},
+		PUSHDATA2:  {"PUSHDATA2", 0, 2, 0, 1, 1 << 9},
+		PUSHDATA4:  {"PUSHDATA4", 0, 4, 0, 1, 1 << 12},
+		PUSHM1:     {"PUSHM1", 0, 0, 0, 1, 1},
+
+		// Flow control
+		NOP:        {"NOP", 0, 0, 0, 0, 1},
+		JMP:        {"JMP", 1, 0, 0, 0, 1 << 1},
+		JMP_L:      {"JMP_L", 4, 0, 0, 0, 1 << 1},
+		JMPIF:      {"JMPIF", 1, 0, 1, 0, 1 << 1},
+		JMPIF_L:    {"JMPIF_L", 4, 0, 1, 0, 1 << 1},
+		JMPIFNOT:   {"JMPIFNOT", 1, 0, 1, 0, 1 << 1},
+		JMPIFNOT_L: {"JMPIFNOT_L", 4, 0, 1, 0, 1 << 1},
+		JMPEQ:      {"JMPEQ", 1, 0, 2, 0, 1 << 1},
+		JMPEQ_L:    {"JMPEQ_L", 4, 0, 2, 0, 1 << 1},
+		JMPNE:      {"JMPNE", 1, 0, 2, 0, 1 << 1},
+		JMPNE_L:    {"JMPNE_L", 4, 0, 2, 0, 1 << 1},
+		JMPGT:      {"JMPGT", 1, 0, 2, 0, 1 << 1},
+		JMPGT_L:    {"JMPGT_L", 4, 0, 2, 0, 1 << 1},
+		JMPGE:      {"JMPGE", 1, 0, 2, 0, 1 << 1},
+		JMPGE_L:    {"JMPGE_L", 4, 0, 2, 0, 1 << 1},
+		JMPLT:      {"JMPLT", 1, 0, 2, 0, 1 << 1},
+		JMPLT_L:    {"JMPLT_L", 4, 0, 2, 0, 1 << 1},
+		JMPLE:      {"JMPLE", 1, 0, 2, 0, 1 << 1},
+		JMPLE_L:    {"JMPLE_L", 4, 0, 2, 0, 1 << 1},
+		CALL:       {"CALL", 1, 0, v, v, 1 << 9},
+		CALL_L:     {"CALL_L", 4, 0, v, v, 1 << 9},
+		CALLA:      {"CALLA", 0, 0, v, v, 1 << 9},
+		CALLT:      {"CALLT", 2, 0, v, v, 1 << 15},
+		ABORT:      {"ABORT", 0, 0, 0, 0, 0},
+		ASSERT:     {"ASSERT", 0, 0, 1, 0, 1},
+		THROW:      {"THROW", 0, 0, 1, 0, 1 << 9},
+		TRY:        {"TRY", 2, 0, 0, 0, 1 << 2},
+		TRY_L:      {"TRY_L", 8, 0, 0, 0, 1 << 2},
+		ENDTRY:     {"ENDTRY", 1, 0, 0, 0, 1 << 2},
+		ENDTRY_L:   {"ENDTRY_L", 4, 0, 0, 0, 1 << 2},
+		ENDFINALLY: {"ENDFINALLY", 0, 0, 0, 0, 1 << 2},
+		RET:        {"RET", 0, 0, 0, 0, 0},
+		SYSCALL:    {"SYSCALL", 4, 0, v, v, 0},
+
+		// Stack
+		DEPTH:    {"DEPTH", 0, 0, 0, 1, 1 << 1},
+		DROP:     {"DROP", 0, 0, 1, 0, 1 << 1},
+		NIP:      {"NIP", 0, 0, 1, 0, 1 << 1},
+		XDROP:    {"XDROP", 0, 0, 2, 0, 1 << 4},
+		CLEAR:    {"CLEAR", 0, 0, v, 0, 1 << 4},
+		DUP:      {"DUP", 0, 0, 0, 1, 1 << 1},
+		OVER:     {"OVER", 0, 0, 0, 1, 1 << 1},
+		PICK:     {"PICK", 0, 0, 1, 1, 1 << 1},
+		TUCK:     {"TUCK", 0, 0, 2, 3, 1 << 1},
+		SWAP:     {"SWAP", 0, 0, 2, 2, 1 << 1},
+		ROT:      {"ROT", 0, 0, 3, 3, 1 << 1},
+		ROLL:     {"ROLL", 0, 0, v, v, 1 << 4},
+		REVERSE3: {"REVERSE3", 0, 0, 3, 3, 1 << 1},
+		REVERSE4: {"REVERSE4", 0, 0, 4, 4, 1 << 1},
+		REVERSEN: {"REVERSEN", 0, 0, 1, 0, 1 << 4},
+
+		// Slots
+		INITSSLOT: {"INITSSLOT", 1, 0, 0, 0, 1 << 4},
+		INITSLOT:  {"INITSLOT", 2, 0, v, 0, 1 << 6},
+		LDSFLD:    {"LDSFLD", 1, 0, 0, 1, 1 << 1},
+		STSFLD:    {"STSFLD", 1, 0, 1, 0, 1 << 1},
+		LDLOC:     {"LDLOC", 1, 0, 0, 1, 1 << 1},
+		STLOC:     {"STLOC", 1, 0, 1, 0, 1 << 1},
+		LDARG:     {"LDARG", 1, 0, 0, 1, 1 << 1},
+		STARG:     {"STARG", 1, 0, 1, 0, 1 << 1},
+
+		// Splice
+		NEWBUFFER: {"NEWBUFFER", 0, 0, 1, 1, 1 << 8},
+		MEMCPY:    {"MEMCPY", 0, 0, 5, 0, 1 << 11},
+		CAT:       {"CAT", 0, 0, 2, 1, 1 << 11},
+		SUBSTR:    {"SUBSTR", 0, 0, 3, 1, 1 << 11},
+		LEFT:      {"LEFT", 0, 0, 2, 1, 1 << 11},
+		RIGHT:     {"RIGHT", 0, 0, 2, 1, 1 << 11},
+
+		// Bitwise logic
+		INVERT:   {"INVERT", 0, 0, 1, 1, 1 << 2},
+		AND:      {"AND", 0, 0, 2, 1, 1 << 3},
+		OR:       {"OR", 0, 0, 2, 1, 1 << 3},
+		XOR:      {"XOR", 0, 0, 2, 1, 1 << 3},
+		EQUAL:    {"EQUAL", 0, 0, 2, 1, 1 << 5},
+		NOTEQUAL: {"NOTEQUAL", 0, 0, 2, 1, 1 << 5},
+
+		// Arithmetic
+		SIGN:        {"SIGN", 0, 0, 1, 1, 1 << 2},
+		ABS:         {"ABS", 0, 0, 1, 1, 1 << 2},
+		NEGATE:      {"NEGATE", 0, 0, 1, 1, 1 << 2},
+		INC:         {"INC", 0, 0, 1, 1, 1 << 2},
+		DEC:         {"DEC", 0, 0, 1, 1, 1 << 2},
+		ADD:         {"ADD", 0, 0, 2, 1, 1 << 3},
+		SUB:         {"SUB", 0, 0, 2, 1, 1 << 3},
+		MUL:         {"MUL", 0, 0, 2, 1, 1 << 3},
+		DIV:         {"DIV", 0, 0, 2, 1, 1 << 3},
+		MOD:         {"MOD", 0, 0, 2, 1, 1 << 3},
+		POW:         {"POW", 0, 0, 2, 1, 1 << 6},
+		SQRT:        {"SQRT", 0, 0, 1, 1, 1 << 6},
+		MODMUL:      {"MODMUL", 0, 0, 3, 1, 1 << 5},
+		MODPOW:      {"MODPOW", 0, 0, 3, 1, 1 << 11},
+		SHL:         {"SHL", 0, 0, 2, 1, 1 << 3},
+		SHR:         {"SHR", 0, 0, 2, 1, 1 << 3},
+		NOT:         {"NOT", 0, 0, 1, 1, 1 << 2},
+		BOOLAND:     {"BOOLAND", 0, 0, 2, 1, 1 << 3},
+		BOOLOR:      {"BOOLOR", 0, 0, 2, 1, 1 << 3},
+		NZ:          {"NZ", 0, 0, 1, 1, 1 << 2},
+		NUMEQUAL:    {"NUMEQUAL", 0, 0, 2, 1, 1 << 3},
+		NUMNOTEQUAL: {"NUMNOTEQUAL", 0, 0, 2, 1, 1 << 3},
+		LT:          {"LT", 0, 0, 2, 1, 1 << 3},
+		LE:          {"LE", 0, 0, 2, 1, 1 << 3},
+		GT:          {"GT", 0, 0, 2, 1, 1 << 3},
+		GE:          {"GE", 0, 0, 2, 1, 1 << 3},
+		MIN:         {"MIN", 0, 0, 2, 1, 1 << 3},
+		MAX:         {"MAX", 0, 0, 2, 1, 1 << 3},
+		WITHIN:      {"WITHIN", 0, 0, 3, 1, 1 << 3},
+
+		// Compound types
+		PACKMAP:      {"PACKMAP", 0, 0, v, 1, 1 << 11},
+		PACKSTRUCT:   {"PACKSTRUCT", 0, 0, v, 1, 1 << 11},
+		PACK:         {"PACK", 0, 0, v, 1, 1 << 11},
+		UNPACK:       {"UNPACK", 0, 0, 1, v, 1 << 11},
+		NEWARRAY0:    {"NEWARRAY0", 0, 0, 0, 1, 1 << 4},
+		NEWARRAY:     {"NEWARRAY", 0, 0, 1, 1, 1 << 9},
+		NEWARRAY_T:   {"NEWARRAY_T", 1, 0, 1, 1, 1 << 9},
+		NEWSTRUCT0:   {"NEWSTRUCT0", 0, 0, 0, 1, 1 << 4},
+		NEWSTRUCT:    {"NEWSTRUCT", 0, 0, 1, 1, 1 << 9},
+		NEWMAP:       {"NEWMAP", 0, 0, 0, 1, 1 << 3},
+		SIZE:         {"SIZE", 0, 0, 1, 1, 1 << 2},
+		HASKEY:       {"HASKEY", 0, 0, 2, 1, 1 << 6},
+		KEYS:         {"KEYS", 0, 0, 1, 1, 1 << 4},
+		VALUES:       {"VALUES", 0, 0, 1, 1, 1 << 13},
+		PICKITEM:     {"PICKITEM", 0, 0, 2, 1, 1 << 6},
+		APPEND:       {"APPEND", 0, 0, 2, 0, 1 << 13},
+		SETITEM:      {"SETITEM", 0, 0, 3, 0, 1 << 13},
+		REVERSEITEMS: {"REVERSEITEMS", 0, 0, 1, 0, 1 << 13},
+		REMOVE:       {"REMOVE", 0, 0, 2, 0, 1 << 4},
+		CLEARITEMS:   {"CLEARITEMS", 0, 0, 1, 0, 1 << 4},
+		POPITEM:      {"POPITEM", 0, 0, 1, 1, 1 << 4},
+
+		// Types
+		ISNULL:  {"ISNULL", 0, 0, 1, 1, 1 << 1},
+		ISTYPE:  {"ISTYPE", 1, 0, 1, 1, 1 << 1},
+		CONVERT: {"CONVERT", 1, 0, 1, 1, 1 << 13},
+
+		// Extensions
+		ABORTMSG:  {"ABORTMSG", 0, 0, 1, 0, 0},
+		ASSERTMSG: {"ASSERTMSG", 0, 0, 2, 0, 1},
+	}
+	for op := PUSH0; op <= PUSH16; op++ {
+		table[op] = OpcodeInfo{fmt.Sprintf("PUSH%d", op-PUSH0), 0, 0, 0, 1, 1}
+	}
+	for _, base := range []NeoOpcode{LDSFLD, STSFLD, LDLOC, STLOC, LDARG, STARG} {
+		info := table[base]
+		for i := 0; i < shortSlotForms; i++ {
+			table[base-shortSlotForms+NeoOpcode(i)] = OpcodeInfo{fmt.Sprintf("%s%d", info.Mnemonic, i), 0, 0, info.Pop, info.Push, info.Price}
+		}
+	}
+	return table
+}
+
+// LookupOpcode returns the metadata of op, false for bytes that are not
+// opcodes
+func LookupOpcode(op NeoOpcode) (OpcodeInfo, bool) {
+	info, ok := opcodeTable[op]
+	return info, ok
+}
+
+// OpcodeMnemonic returns the string representation of an opcode
+func OpcodeMnemonic(op NeoOpcode) string {
+	if info, ok := opcodeTable[op]; ok {
+		return info.Mnemonic
+	}
+	return fmt.Sprintf("UNKNOWN(0x%02X)", byte(op))
+}
+
+// newTableInstruction creates an instruction for op without operand, with
+// its price and stack effect; variable effects are left for the caller
+func newTableInstruction(op NeoOpcode) NeoInstruction {
+	info := opcodeTable[op]
+	instr := NeoInstruction{Opcode: op, Size: 1, GasCost: info.Price}
+	if info.Pop != StackVariable {
+		instr.StackPop = info.Pop
+	}
+	if info.Push != StackVariable {
+		instr.StackPush = info.Push
+	}
+	return instr
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OptimizationGoal selects what the optimizer trades off against: gas
+// consumed at runtime or the size of the emitted script.
+type OptimizationGoal string
+
+const (
+	OptimizeForGas  OptimizationGoal = "gas"
+	OptimizeForSize OptimizationGoal = "size"
+)
+
+// optimizeForFlag is the compiler flag that selects the optimization goal,
+// e.g. "--optimize-for=size".
+const optimizeForFlag = "--optimize-for"
+
+// Estimated costs used by the optimization cost model
+const (
+	callSiteOverheadBytes = 5   // CALL_L plus its 4-byte offset
+	callGasOverhead       = 512 // CALL
+	retGasOverhead        = 0   // RET
+	functionEpilogueBytes = 1   // trailing RET of an out-of-line function
+	shortJumpRange        = 127 // Largest forward distance a 1-byte jump offset can encode
+)
+
+// OptimizationProfile is the single cost model shared by every pass that has
+// to choose between smaller code and cheaper execution, so that a build
+// optimized for size does not have one pass undoing another. Inlining weighs
+// the goal; jump-form selection consults the profile too, though the short
+// forms it prefers win under either goal.
+type OptimizationProfile struct {
+	Goal            OptimizationGoal
+	MaxScriptSize   int         // Upper bound on the emitted script, normally MaxNEFScriptSize
+	MaxInlineGrowth int         // Largest size increase a single inlining decision may cause
+	GasPerByte      float64     // Minimum gas saved per byte of growth to justify inlining for gas
+	Prices          *PriceTable // Opcode and syscall prices of the target network
+
+	// Feedback holds execution counts from profiled runs, nil without
+	// profile-guided optimization
+	Feedback *ExecutionProfile
+}
+
+// NewOptimizationProfile creates a profile for the given goal with default limits
+func NewOptimizationProfile(goal OptimizationGoal) *OptimizationProfile {
+	profile := &OptimizationProfile{
+		Goal:            goal,
+		MaxScriptSize:   MaxNEFScriptSize,
+		MaxInlineGrowth: 256,
+		GasPerByte:      4,
+		Prices:          DefaultPriceTable(),
+	}
+	if goal == OptimizeForSize {
+		profile.MaxInlineGrowth = 0
+	}
+	return profile
+}
+
+// DefaultOptimizationProfile returns the profile used when no goal is configured
+func DefaultOptimizationProfile() *OptimizationProfile {
+	return NewOptimizationProfile(OptimizeForGas)
+}
+
+// ParseOptimizationGoal parses the value of --optimize-for
+func ParseOptimizationGoal(value string) (OptimizationGoal, error) {
+	switch OptimizationGoal(strings.ToLower(strings.TrimSpace(value))) {
+	case OptimizeForGas:
+		return OptimizeForGas, nil
+	case OptimizeForSize:
+		return OptimizeForSize, nil
+	default:
+		return "", fmt.Errorf("invalid optimization goal %q (expected size or gas)", value)
+	}
+}
+
+// OptimizationProfileFromConfig builds the profile for a compiler configuration.
+// An --optimize-for flag in CompilerFlags takes precedence over OptimizeFor.
+func OptimizationProfileFromConfig(config CompilerConfig) (*OptimizationProfile, error) {
+	value := flagValue(config.CompilerFlags, optimizeForFlag, config.OptimizeFor)
+	if value == "" {
+		return DefaultOptimizationProfile(), nil
+	}
+
+	goal, err := ParseOptimizationGoal(value)
+	if err != nil {
+		return nil, err
+	}
+	return NewOptimizationProfile(goal), nil
+}
+
+// InliningDecision records why the cost model accepted or rejected inlining a function
+type InliningDecision struct {
+	Inline     bool
+	SizeDelta  int   // Net change in script size if every call site is inlined
+	GasSavings int64 // Gas saved across all call sites
+	Reason     string
+}
+
+// EvaluateInlining weighs the per-call savings of inlining a function against
+// the code-size growth it causes. bodySize is the estimated size of the inlined
+// expression, callCount the number of call sites and currentSize the estimated
+// size of the whole script before inlining.
+func (p *OptimizationProfile) EvaluateInlining(bodySize, callCount, currentSize int) InliningDecision {
+	return p.evaluateInlining(bodySize, callCount, int64(callCount), currentSize)
+}
+
+// EvaluateFunctionInlining is EvaluateInlining for a named function. With
+// execution feedback the gas savings are based on how often the function
+// actually ran, so hot functions may grow the code further and functions
+// that never ran are only inlined when that shrinks the code.
+func (p *OptimizationProfile) EvaluateFunctionInlining(name string, bodySize, callCount, currentSize int) InliningDecision {
+	executions, profiled := p.Feedback.CallCount(name)
+	if !profiled {
+		return p.EvaluateInlining(bodySize, callCount, currentSize)
+	}
+	return p.evaluateInlining(bodySize, callCount, executions, currentSize)
+}
+
+// evaluateInlining weighs callCount call sites executed executions times in total
+func (p *OptimizationProfile) evaluateInlining(bodySize, callCount int, executions int64, currentSize int) InliningDecision {
+	if callCount == 0 {
+		return InliningDecision{Reason: "no call sites"}
+	}
+
+	// Every call site trades a CALL for a copy of the body; the out-of-line
+	// definition disappears once all call sites are inlined.
+	sizeDelta := callCount*(bodySize-callSiteOverheadBytes) - (bodySize + functionEpilogueBytes)
+	gasSavings := executions * (p.Prices.OpcodePrice(CALL, callGasOverhead) + p.Prices.OpcodePrice(RET, retGasOverhead))
+
+	decision := InliningDecision{SizeDelta: sizeDelta, GasSavings: gasSavings}
+
+	if currentSize+sizeDelta > p.MaxScriptSize {
+		decision.Reason = "would exceed script size limit"
+		return decision
+	}
+
+	if sizeDelta <= 0 {
+		decision.Inline = true
+		decision.Reason = "shrinks code"
+		return decision
+	}
+
+	if p.Goal == OptimizeForSize || sizeDelta > p.MaxInlineGrowth {
+		decision.Reason = "code growth not justified"
+		return decision
+	}
+
+	if float64(gasSavings) < float64(sizeDelta)*p.GasPerByte {
+		decision.Reason = "gas savings too small for code growth"
+		return decision
+	}
+
+	decision.Inline = true
+	decision.Reason = "gas savings outweigh code growth"
+	return decision
+}
+
+// UseShortJump reports whether a jump spanning distance bytes should use the
+// 1-byte offset form. Short forms are both smaller and no more expensive, so
+// they are chosen for either goal whenever the distance is known to fit.
+func (p *OptimizationProfile) UseShortJump(distance int, known bool) bool {
+	return known && distance >= -128 && distance <= shortJumpRange
+}
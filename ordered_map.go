@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// OrderedMap is a string-keyed map that remembers insertion order. It is used
+// for every collection that ends up in an artifact (nested objects, entry
+// points, constants) so JSON output, manifests and listings come out in
+// source order and are identical across runs.
+//
+// A nil *OrderedMap behaves as an empty map for all read operations.
+type OrderedMap[V any] struct {
+	keys   []string
+	values map[string]V
+}
+
+// NewOrderedMap creates an empty ordered map
+func NewOrderedMap[V any]() *OrderedMap[V] {
+	return &OrderedMap[V]{values: make(map[string]V)}
+}
+
+// Set stores value under key. A new key is appended to the order; updating an
+// existing key keeps its original position.
+func (m *OrderedMap[V]) Set(key string, value V) {
+	if m.values == nil {
+		m.values = make(map[string]V)
+	}
+	if _, exists := m.values[key]; !exists {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Get returns the value stored under key
+func (m *OrderedMap[V]) Get(key string) (V, bool) {
+	if m == nil {
+		var zero V
+		return zero, false
+	}
+	value, ok := m.values[key]
+	return value, ok
+}
+
+// Delete removes key, preserving the order of the remaining entries
+func (m *OrderedMap[V]) Delete(key string) {
+	if m == nil {
+		return
+	}
+	if _, exists := m.values[key]; !exists {
+		return
+	}
+	delete(m.values, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Len returns the number of entries
+func (m *OrderedMap[V]) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.keys)
+}
+
+// Keys returns the keys in insertion order
+func (m *OrderedMap[V]) Keys() []string {
+	if m == nil {
+		return nil
+	}
+	return append([]string(nil), m.keys...)
+}
+
+// Values returns the values in insertion order
+func (m *OrderedMap[V]) Values() []V {
+	if m == nil {
+		return nil
+	}
+	values := make([]V, len(m.keys))
+	for i, key := range m.keys {
+		values[i] = m.values[key]
+	}
+	return values
+}
+
+// Range calls fn for every entry in insertion order until fn returns false
+func (m *OrderedMap[V]) Range(fn func(key string, value V) bool) {
+	if m == nil {
+		return
+	}
+	for _, key := range m.keys {
+		if !fn(key, m.values[key]) {
+			return
+		}
+	}
+}
+
+// MarshalJSON encodes the map as a JSON object with keys in insertion order
+func (m *OrderedMap[V]) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.Keys() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		encodedValue, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, fmt.Errorf("encoding %q: %w", key, err)
+		}
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(encodedValue)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a JSON object, keeping the order in which keys appear
+func (m *OrderedMap[V]) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected JSON object, got %v", token)
+	}
+
+	m.keys = nil
+	m.values = make(map[string]V)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("expected object key, got %v", token)
+		}
+		var value V
+		if err := decoder.Decode(&value); err != nil {
+			return fmt.Errorf("decoding %q: %w", key, err)
+		}
+		m.Set(key, value)
+	}
+
+	_, err = decoder.Token()
+	return err
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Integer overflow.
+//
+// Yul add, sub and mul wrap modulo 2^256. The overflow analysis tracks the
+// range of every variable of a body, over all of its assignments, and
+// whether it derives from calldataload or callvalue, which the caller
+// chooses. An add, sub or mul of such a value whose result may leave the
+// word range is reported, unless bounds checking is enabled: the code
+// generator then checks the operation and throws Panic(0x11) when it
+// overflows, as Solidity 0.8 does. Parameters are not attacker-controlled,
+// so the checked_add helpers of Solidity are not reported, and other
+// wrapping arithmetic keeps the semantics of Yul.
+
+// Ranges of environment built-ins
+var (
+	maxWord    = new(big.Int).Set(wordMask)
+	maxAddress = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 160), big.NewInt(1))
+	maxSize    = big.NewInt(1<<32 - 1)
+)
+
+// overflowSources are the built-ins whose results the caller chooses
+var overflowSources = map[string]bool{"calldataload": true, "callvalue": true}
+
+// overflowPanic is the Panic(uint256) code of an arithmetic overflow
+const overflowPanic = 0x11
+
+// valueRange is the interval of values an expression may take, with
+// whether the caller controls it
+type valueRange struct {
+	lo, hi  *big.Int
+	tainted bool
+}
+
+func fullRange(tainted bool) valueRange {
+	return valueRange{lo: new(big.Int), hi: maxWord, tainted: tainted}
+}
+
+// boundedRange is [lo, hi], or the full range when hi is not a word
+func boundedRange(lo, hi *big.Int, tainted bool) valueRange {
+	if lo.Sign() < 0 || hi.Cmp(maxWord) > 0 {
+		return fullRange(tainted)
+	}
+	return valueRange{lo: lo, hi: hi, tainted: tainted}
+}
+
+// overflowAnalysis holds the ranges of the variables of one body
+type overflowAnalysis struct {
+	vars      map[string]valueRange
+	functions map[string]bool
+}
+
+// overflowingCall is an add, sub or mul of attacker-controlled values that
+// may overflow
+type overflowingCall struct {
+	call      *YulFunctionCall
+	underflow bool
+}
+
+// findOverflows lists the arithmetic of every body of the AST that may
+// overflow on values the caller controls
+func findOverflows(ast *YulAST) []overflowingCall {
+	functions := make(map[string]bool)
+	forEachFunctionDef(ast, func(fn *YulFunctionDef) {
+		functions[fn.Name] = true
+	})
+	var found []overflowingCall
+	for _, body := range controlFlowBodies(ast) {
+		a := &overflowAnalysis{vars: make(map[string]valueRange), functions: functions}
+		a.solve(body.block)
+		functionBody(body.block, func(stmt YulStatement) {
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(e YulExpression) {
+					if call, ok := e.(*YulFunctionCall); ok {
+						if overflow, ok := a.overflows(call); ok {
+							found = append(found, overflow)
+						}
+					}
+				})
+			}
+		})
+	}
+	return found
+}
+
+// solve computes the ranges of the variables until they no longer change.
+// A range still growing after a few rounds is widened to the full range,
+// as for a counter incremented in a loop.
+func (a *overflowAnalysis) solve(body *YulBlock) {
+	const widenAfter = 4
+	for round := 0; ; round++ {
+		changed := false
+		assign := func(name string, value valueRange) {
+			old, ok := a.vars[name]
+			if ok {
+				value = joinRanges(old, value)
+				if value.lo.Cmp(old.lo) == 0 && value.hi.Cmp(old.hi) == 0 && value.tainted == old.tainted {
+					return
+				}
+				if round >= widenAfter {
+					value = fullRange(value.tainted)
+				}
+			}
+			a.vars[name] = value
+			changed = true
+		}
+		functionBody(body, func(stmt YulStatement) {
+			switch s := stmt.(type) {
+			case *YulVariableDeclaration:
+				value := valueRange{lo: new(big.Int), hi: new(big.Int)}
+				if s.Value != nil {
+					value = a.rangeOf(s.Value)
+				}
+				for _, variable := range s.Variables {
+					if len(s.Variables) > 1 {
+						value = fullRange(false)
+					}
+					assign(variable.Name, value)
+				}
+			case *YulAssignment:
+				value := a.rangeOf(s.Value)
+				for _, name := range s.VariableNames {
+					if len(s.VariableNames) > 1 {
+						value = fullRange(false)
+					}
+					assign(name, value)
+				}
+			}
+		})
+		if !changed {
+			return
+		}
+	}
+}
+
+func joinRanges(x, y valueRange) valueRange {
+	lo, hi := x.lo, x.hi
+	if y.lo.Cmp(lo) < 0 {
+		lo = y.lo
+	}
+	if y.hi.Cmp(hi) > 0 {
+		hi = y.hi
+	}
+	return valueRange{lo: lo, hi: hi, tainted: x.tainted || y.tainted}
+}
+
+// rangeOf returns the range of expr. Pure built-ins pass on the taint of
+// their arguments; variables not assigned in the body, such as
+// parameters, may hold any value.
+func (a *overflowAnalysis) rangeOf(expr YulExpression) valueRange {
+	switch e := expr.(type) {
+	case *YulLiteral:
+		if value, err := ParseYulLiteralValue(e); err == nil {
+			return valueRange{lo: value, hi: value}
+		}
+	case *YulIdentifier:
+		if value, ok := a.vars[e.Name]; ok {
+			return value
+		}
+	case *YulFunctionCall:
+		name := e.FunctionName.Name
+		if a.functions[name] {
+			return fullRange(false)
+		}
+		if overflowSources[name] {
+			return fullRange(true)
+		}
+		args := make([]valueRange, len(e.Arguments))
+		tainted := false
+		for i, arg := range e.Arguments {
+			args[i] = a.rangeOf(arg)
+			tainted = tainted || args[i].tainted
+		}
+		return builtinRange(name, args, tainted && isPureBuiltin(name))
+	}
+	return fullRange(false)
+}
+
+// builtinRange returns the range of a built-in of arguments in args
+func builtinRange(name string, args []valueRange, tainted bool) valueRange {
+	zero := new(big.Int)
+	binary := len(args) == 2
+	switch {
+	case name == "add" && binary:
+		return boundedRange(new(big.Int).Add(args[0].lo, args[1].lo), new(big.Int).Add(args[0].hi, args[1].hi), tainted)
+	case name == "sub" && binary:
+		return boundedRange(new(big.Int).Sub(args[0].lo, args[1].hi), new(big.Int).Sub(args[0].hi, args[1].lo), tainted)
+	case name == "mul" && binary:
+		return boundedRange(new(big.Int).Mul(args[0].lo, args[1].lo), new(big.Int).Mul(args[0].hi, args[1].hi), tainted)
+	case name == "div" && binary:
+		if args[1].lo.Sign() > 0 {
+			return valueRange{lo: new(big.Int).Div(args[0].lo, args[1].hi), hi: new(big.Int).Div(args[0].hi, args[1].lo), tainted: tainted}
+		}
+		return valueRange{lo: zero, hi: args[0].hi, tainted: tainted}
+	case name == "mod" && binary:
+		if args[1].hi.Sign() == 0 {
+			return valueRange{lo: zero, hi: zero, tainted: tainted}
+		}
+		return valueRange{lo: zero, hi: minInt(args[0].hi, new(big.Int).Sub(args[1].hi, big.NewInt(1))), tainted: tainted}
+	case name == "and" && binary:
+		return valueRange{lo: zero, hi: minInt(args[0].hi, args[1].hi), tainted: tainted}
+	case name == "shr" && binary && args[0].lo.Cmp(args[0].hi) == 0 && args[0].lo.IsInt64():
+		shift := uint(minInt(args[0].lo, big.NewInt(maxShift)).Int64())
+		return valueRange{lo: new(big.Int).Rsh(args[1].lo, shift), hi: new(big.Int).Rsh(args[1].hi, shift), tainted: tainted}
+	case name == "shl" && binary && args[0].lo.Cmp(args[0].hi) == 0 && args[0].lo.IsInt64():
+		shift := uint(minInt(args[0].lo, big.NewInt(maxShift)).Int64())
+		return boundedRange(new(big.Int).Lsh(args[1].lo, shift), new(big.Int).Lsh(args[1].hi, shift), tainted)
+	}
+	switch name {
+	case "lt", "gt", "slt", "sgt", "eq", "iszero":
+		return valueRange{lo: zero, hi: big.NewInt(1), tainted: tainted}
+	case "byte":
+		return valueRange{lo: zero, hi: big.NewInt(255), tainted: tainted}
+	case "caller", "address", "origin", "coinbase":
+		return valueRange{lo: zero, hi: maxAddress}
+	case "calldatasize", "returndatasize", "codesize", "msize":
+		return valueRange{lo: zero, hi: maxSize}
+	}
+	return fullRange(tainted)
+}
+
+func minInt(x, y *big.Int) *big.Int {
+	if x.Cmp(y) < 0 {
+		return x
+	}
+	return y
+}
+
+// overflows reports whether call is an add, sub or mul of a value the
+// caller controls whose result may leave the word range
+func (a *overflowAnalysis) overflows(call *YulFunctionCall) (overflowingCall, bool) {
+	name := call.FunctionName.Name
+	if a.functions[name] || len(call.Arguments) != 2 {
+		return overflowingCall{}, false
+	}
+	x, y := a.rangeOf(call.Arguments[0]), a.rangeOf(call.Arguments[1])
+	if !x.tainted && !y.tainted {
+		return overflowingCall{}, false
+	}
+	switch name {
+	case "add":
+		return overflowingCall{call: call}, new(big.Int).Add(x.hi, y.hi).Cmp(maxWord) > 0
+	case "mul":
+		return overflowingCall{call: call}, new(big.Int).Mul(x.hi, y.hi).Cmp(maxWord) > 0
+	case "sub":
+		return overflowingCall{call: call, underflow: true}, x.lo.Cmp(y.hi) < 0
+	}
+	return overflowingCall{}, false
+}
+
+// overflowIssues reports the unchecked arithmetic that may overflow, none
+// when bounds checking checks it
+func (sa *StaticAnalyzer) overflowIssues(ast *YulAST) ([]SecurityIssue, []CompilerWarning) {
+	if sa.context != nil && sa.context.BoundsChecking {
+		return nil, nil
+	}
+	var issues []SecurityIssue
+	var warnings []CompilerWarning
+	for _, overflow := range findOverflows(ast) {
+		issue := SecurityIssue{
+			Type:        SecurityIssueOverflow,
+			Severity:    SeverityHigh,
+			Location:    overflow.call.Location,
+			Description: fmt.Sprintf("%s of attacker-controlled values may overflow", overflow.call.FunctionName.Name),
+			Suggestion:  "Check the operands before the operation or enable bounds checking",
+		}
+		if overflow.underflow {
+			issue.Type = SecurityIssueUnderflow
+			issue.Description = "sub of attacker-controlled values may underflow"
+		}
+		issues = append(issues, issue)
+		warning := dataFlowWarning(CodeOverflow, issue.Location, "%s", issue.Description)
+		warning.Fix = issue.Suggestion
+		warnings = append(warnings, warning)
+	}
+	return issues, warnings
+}
+
+// emitCheckedArithmetic emits add, sub or mul of the operands on the
+// stack, throwing Panic(0x11) when the result is not a word: when the
+// wrapped sum is below an operand, the subtrahend is above the minuend or
+// the wrapped product divided by one operand is not the other
+func (g *CodeGenerator) emitCheckedArithmetic(name string, location SourcePosition) {
+	c := memoryCode{g, location}
+	ok := g.createUniqueLabel("arithmetic_ok")
+	switch name {
+	case "add":
+		// b a -> a s, s < a
+		c.stack(TUCK)
+		g.emitWordAddition(ADD, location)
+		c.stack(TUCK)
+		g.emitUnsignedOperands(location)
+		c.arithmetic(GT)
+	case "mul":
+		// b a -> a p, p / a != b -> p, a != 0 and p / a != b
+		c.stack(OVER, OVER)
+		g.emitWordMultiplication(location)
+		c.stack(DUP)
+		c.push(2)
+		c.stack(PICK, SWAP)
+		g.emitMemoryCall(wordDivMod, 2, 2, location)
+		c.stack(DROP)
+		c.push(3)
+		c.stack(ROLL)
+		c.arithmetic(NUMNOTEQUAL)
+		c.stack(ROT)
+		c.push(0)
+		c.arithmetic(NUMNOTEQUAL, BOOLAND)
+	case "sub":
+		c.stack(OVER, OVER)
+		g.emitUnsignedOperands(location)
+		c.arithmetic(GT)
+	}
+	c.jump(JMPIFNOT, ok)
+
+	// Thrown as revert(p, 36) of the Panic(uint256) payload would be
+	depth := g.stackTracker.currentDepth
+	payload := make([]byte, 36)
+	copy(payload, panicSelector)
+	payload[35] = overflowPanic
+	c.op(NewPushInstruction(CreateNeoVMByteString(payload)))
+	c.op(NewPushInstruction(CreateNeoVMByteString(fmt.Sprintf("Panic(0x%x)", overflowPanic))))
+	c.push(2)
+	pack := NewArithmeticInstruction(PACK)
+	pack.StackPop, pack.StackPush = 3, 1
+	c.op(pack)
+	throw := NewControlFlowInstruction(THROW, 0)
+	throw.StackPop = 1
+	c.op(throw)
+	g.stackTracker.currentDepth = depth
+	g.markLabel(ok)
+	if name == "sub" {
+		c.stack(SWAP)
+		g.emitWordAddition(SUB, location)
+	}
+}
+
+// checkedArithmetic returns the calls emitCheckedArithmetic checks,
+// none without bounds checking
+func (g *CodeGenerator) checkedArithmetic(ast *YulAST) map[*YulFunctionCall]bool {
+	if !g.boundsChecking() {
+		return nil
+	}
+	checked := make(map[*YulFunctionCall]bool)
+	for _, overflow := range findOverflows(ast) {
+		checked[overflow.call] = true
+	}
+	return checked
+}
@@ -0,0 +1,95 @@
+package main
+
+// Peephole optimization.
+//
+// The peephole patterns of the optimization engine run over the generated
+// instructions once their jumps are encoded, so a pattern can read jump
+// offsets like any other operand. Labels, pending jumps, handler frames and
+// function ranges move with the instructions the patterns keep, and the
+// jumps are encoded again for the shorter code. The runtime code of a
+// deployable object is optimized before its size is measured; the code
+// after it when the script is finished.
+
+// SetPeepholeOptimizer makes the generator optimize its instructions with
+// the peephole patterns of engine, nil for none
+func (g *CodeGenerator) SetPeepholeOptimizer(engine *OptimizationEngine) {
+	g.peephole = engine
+}
+
+// constantPushes lists the opcodes pushing a constant operand
+func constantPushes() []NeoOpcode {
+	pushes := []NeoOpcode{PUSHINT8, PUSHINT16, PUSHINT32, PUSHINT64, PUSHINT128, PUSHINT256,
+		PUSHT, PUSHF, PUSHNULL, PUSHDATA1, PUSHDATA2, PUSHDATA4, PUSHM1}
+	for op := PUSH0; op <= PUSH16; op++ {
+		pushes = append(pushes, op)
+	}
+	return pushes
+}
+
+// jumpsToNext reports whether the jump opening window continues at the
+// instruction after it
+func jumpsToNext(window []NeoInstruction) bool {
+	jump := window[0]
+	offset := 0
+	for i, b := range jump.Operand {
+		offset |= int(b) << (8 * i)
+	}
+	return len(jump.Operand) > 0 && offset == jump.Size
+}
+
+// optimizeCode runs the peephole patterns over the instructions from index
+// start
+func (g *CodeGenerator) optimizeCode(start int) {
+	if g.peephole == nil {
+		return
+	}
+	g.encodeJumps()
+	targets := make(map[int]bool)
+	g.labelMap.Range(func(_ string, index int) bool {
+		if index >= start {
+			targets[index-start] = true
+		}
+		return true
+	})
+	optimized, moves := g.peephole.OptimizeInstructions(g.instructions[start:], targets)
+	if len(optimized) == len(g.instructions)-start {
+		return
+	}
+	move := func(index int) int {
+		if index < start {
+			return index
+		}
+		return start + moves[index-start]
+	}
+
+	for _, name := range g.labelMap.Keys() {
+		index, _ := g.labelMap.Get(name)
+		g.labelMap.Set(name, move(index))
+	}
+	pending := g.pendingLabels[:0]
+	for _, label := range g.pendingLabels {
+		// A jump to the next instruction may be removed
+		if index := label.InstructionIndex; index >= start && moves[index-start] == moves[index-start+1] {
+			continue
+		}
+		label.InstructionIndex = move(label.InstructionIndex)
+		pending = append(pending, label)
+	}
+	g.pendingLabels = pending
+	for i := range g.tries {
+		g.tries[i].try = move(g.tries[i].try)
+	}
+	for _, info := range g.functionTable {
+		info.StartOffset, info.EndOffset = move(info.StartOffset), move(info.EndOffset)
+	}
+	depths := make(map[int]int, len(g.stackTracker.stackMap))
+	for index, depth := range g.stackTracker.stackMap {
+		if index < start || moves[index-start] != moves[index-start+1] {
+			depths[move(index)] = depth
+		}
+	}
+	g.stackTracker.stackMap = depths
+
+	g.instructions = append(g.instructions[:start:start], optimized...)
+	g.encodeJumps()
+}
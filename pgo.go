@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Profile-guided optimization.
+//
+// An ExecutionProfile counts how often functions were called and which switch
+// cases were taken while running a contract, either in the Yul interpreter
+// (attach a profile to YulInterpreter.Profile) or on a testnet, by tooling
+// that converts invocation logs into the same JSON format. Fed back through
+// CompilerConfig.ProfileFeedback it biases inlining towards hot functions and
+// orders switch cases, including the selector dispatch chain, so that the
+// most frequent cases are compared first.
+
+// profileFeedbackFlag selects an execution profile, e.g. "--profile-feedback=run.json"
+const profileFeedbackFlag = "--profile-feedback"
+
+// ExecutionProfile holds execution counts gathered from profiled runs
+type ExecutionProfile struct {
+	// Calls counts invocations of each user function
+	Calls map[string]int64 `json:"calls"`
+
+	// Cases counts the cases taken by each switch, keyed by the switch's
+	// source location ("line:column") and then by case value
+	Cases map[string]map[string]int64 `json:"cases,omitempty"`
+
+	// Selectors counts external invocations by method selector value. It is
+	// the usual result of converting testnet invocations and applies to any
+	// switch whose location has no entry in Cases.
+	Selectors map[string]int64 `json:"selectors,omitempty"`
+}
+
+// defaultCaseKey is the Cases key under which default branches are counted
+const defaultCaseKey = "default"
+
+// NewExecutionProfile creates an empty profile
+func NewExecutionProfile() *ExecutionProfile {
+	return &ExecutionProfile{
+		Calls:     make(map[string]int64),
+		Cases:     make(map[string]map[string]int64),
+		Selectors: make(map[string]int64),
+	}
+}
+
+// LoadExecutionProfile reads a JSON execution profile from path
+func LoadExecutionProfile(path string) (*ExecutionProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading execution profile: %w", err)
+	}
+	return ParseExecutionProfile(data)
+}
+
+// ParseExecutionProfile decodes a JSON execution profile. Selector and case
+// values are normalized so "0xA9059CBB" and "2835717307" name the same case.
+func ParseExecutionProfile(data []byte) (*ExecutionProfile, error) {
+	raw := NewExecutionProfile()
+	if err := json.Unmarshal(data, raw); err != nil {
+		return nil, fmt.Errorf("invalid execution profile: %w", err)
+	}
+
+	profile := NewExecutionProfile()
+	for name, count := range raw.Calls {
+		profile.Calls[name] = count
+	}
+	for value, count := range raw.Selectors {
+		key, err := normalizeCaseValue(value)
+		if err != nil {
+			return nil, err
+		}
+		profile.Selectors[key] += count
+	}
+	for location, cases := range raw.Cases {
+		for value, count := range cases {
+			key := value
+			if value != defaultCaseKey {
+				normalized, err := normalizeCaseValue(value)
+				if err != nil {
+					return nil, err
+				}
+				key = normalized
+			}
+			profile.recordCase(location, key, count)
+		}
+	}
+	return profile, nil
+}
+
+// Save writes the profile as indented JSON
+func (p *ExecutionProfile) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Merge adds the counts of other to p
+func (p *ExecutionProfile) Merge(other *ExecutionProfile) {
+	for name, count := range other.Calls {
+		p.Calls[name] += count
+	}
+	for value, count := range other.Selectors {
+		p.Selectors[value] += count
+	}
+	for location, cases := range other.Cases {
+		for value, count := range cases {
+			p.recordCase(location, value, count)
+		}
+	}
+}
+
+// RecordCall counts one invocation of a user function
+func (p *ExecutionProfile) RecordCall(name string) {
+	p.Calls[name]++
+}
+
+// RecordCase counts one execution of a switch case; value is nil for the
+// default branch
+func (p *ExecutionProfile) RecordCase(location SourcePosition, value *big.Int) {
+	key := defaultCaseKey
+	if value != nil {
+		key = caseKey(value)
+	}
+	p.recordCase(switchKey(location), key, 1)
+}
+
+func (p *ExecutionProfile) recordCase(location, value string, count int64) {
+	if p.Cases[location] == nil {
+		p.Cases[location] = make(map[string]int64)
+	}
+	p.Cases[location][value] += count
+}
+
+// CallCount returns how often a function was called. The second result is
+// false when the profile has no call counts at all; a function missing from a
+// profile that does have them never ran.
+func (p *ExecutionProfile) CallCount(name string) (int64, bool) {
+	if p == nil || len(p.Calls) == 0 {
+		return 0, false
+	}
+	return p.Calls[name], true
+}
+
+// CaseWeight returns the execution count of a case of the switch at location
+func (p *ExecutionProfile) CaseWeight(location SourcePosition, value *big.Int) int64 {
+	if p == nil {
+		return 0
+	}
+	key := caseKey(value)
+	if cases, ok := p.Cases[switchKey(location)]; ok {
+		return cases[key]
+	}
+	return p.Selectors[key]
+}
+
+func switchKey(location SourcePosition) string {
+	return fmt.Sprintf("%d:%d", location.Line, location.Column)
+}
+
+func caseKey(value *big.Int) string {
+	return "0x" + value.Text(16)
+}
+
+// normalizeCaseValue converts a decimal or 0x-prefixed hex value to caseKey form
+func normalizeCaseValue(value string) (string, error) {
+	lit := &YulLiteral{Kind: LiteralKindNumber, Value: value}
+	if strings.HasPrefix(strings.ToLower(value), "0x") {
+		lit.Kind = LiteralKindHex
+	}
+	word, err := ParseYulLiteralValue(lit)
+	if err != nil {
+		return "", fmt.Errorf("invalid case value in execution profile: %w", err)
+	}
+	return caseKey(word), nil
+}
+
+// ExecutionProfileFromConfig loads the execution profile named by
+// ProfileFeedback or a --profile-feedback flag. It returns nil when no
+// profile is configured.
+func ExecutionProfileFromConfig(config CompilerConfig) (*ExecutionProfile, error) {
+	path := flagValue(config.CompilerFlags, profileFeedbackFlag, config.ProfileFeedback)
+	if path == "" {
+		return nil, nil
+	}
+	return LoadExecutionProfile(path)
+}
+
+// ProfileGuidedDispatchPass reorders switch cases so the most frequently
+// taken cases are compared first. Case values are distinct, so the order
+// does not change which case runs, only how many comparisons it takes.
+type ProfileGuidedDispatchPass struct {
+	profile   *OptimizationProfile
+	Reordered int // Number of switches reordered by the last Apply
+}
+
+// NewProfileGuidedDispatchPass creates the pass; it does nothing unless the
+// profile carries execution feedback
+func NewProfileGuidedDispatchPass(profile *OptimizationProfile) *ProfileGuidedDispatchPass {
+	if profile == nil {
+		profile = DefaultOptimizationProfile()
+	}
+	return &ProfileGuidedDispatchPass{profile: profile}
+}
+
+func (p *ProfileGuidedDispatchPass) Name() string       { return "profile_guided_dispatch" }
+func (p *ProfileGuidedDispatchPass) RequiredLevel() int { return 2 }
+
+// Apply sorts the cases of every profiled switch by descending weight
+func (p *ProfileGuidedDispatchPass) Apply(ast *YulAST) (*YulAST, error) {
+	p.Reordered = 0
+	feedback := p.profile.Feedback
+	if feedback == nil {
+		return ast, nil
+	}
+
+	forEachBlock(ast, func(block *YulBlock) {
+		for _, stmt := range block.Statements {
+			sw, ok := stmt.(*YulSwitch)
+			if !ok || len(sw.Cases) < 2 {
+				continue
+			}
+			if reorderSwitchCases(sw, feedback) {
+				p.Reordered++
+			}
+		}
+	})
+	return ast, nil
+}
+
+// reorderSwitchCases sorts cases by weight, keeping source order among equal
+// weights, and reports whether anything moved
+func reorderSwitchCases(sw *YulSwitch, feedback *ExecutionProfile) bool {
+	weights := make([]int64, len(sw.Cases))
+	for i := range sw.Cases {
+		value, err := ParseYulLiteralValue(&sw.Cases[i].Value)
+		if err != nil {
+			return false
+		}
+		weights[i] = feedback.CaseWeight(sw.Location, value)
+	}
+
+	order := make([]int, len(sw.Cases))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return weights[order[a]] > weights[order[b]]
+	})
+
+	moved := false
+	cases := make([]*YulCase, len(sw.Cases))
+	for i, index := range order {
+		cases[i] = sw.Cases[index]
+		moved = moved || index != i
+	}
+	sw.Cases = cases
+	return moved
+}
+
+// ExpectedDispatchComparisons returns the average number of case comparisons
+// a switch performs under the profile; the default branch pays for every case.
+// It is the figure the dispatch pass minimizes.
+func ExpectedDispatchComparisons(sw *YulSwitch, feedback *ExecutionProfile) float64 {
+	if feedback == nil {
+		return 0
+	}
+	var total, weighted int64
+	for i := range sw.Cases {
+		value, err := ParseYulLiteralValue(&sw.Cases[i].Value)
+		if err != nil {
+			continue
+		}
+		weight := feedback.CaseWeight(sw.Location, value)
+		total += weight
+		weighted += weight * int64(i+1)
+	}
+	if cases, ok := feedback.Cases[switchKey(sw.Location)]; ok {
+		defaults := cases[defaultCaseKey]
+		total += defaults
+		weighted += defaults * int64(len(sw.Cases))
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(weighted) / float64(total)
+}
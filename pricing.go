@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Network pricing.
+//
+// Instruction GasCost values are the opcode and syscall prices of Neo
+// mainnet, in units the Policy contract multiplies by the execution fee
+// factor. Private networks often change the Policy prices, so a pricing file
+// can override individual opcode and syscall prices, the fee factor and the
+// storage price. Cost estimates and the gas side of the optimization cost
+// model both read the same PriceTable.
+
+// pricingFlag selects a pricing file, e.g. "--pricing=privnet.json"
+const pricingFlag = "--pricing"
+
+// Neo mainnet Policy defaults
+const (
+	DefaultExecFeeFactor = 30
+	DefaultStoragePrice  = 100000 // Datoshi per stored byte
+)
+
+// PriceTable holds the prices of a target network. Opcodes without an
+// override keep the price built into their instruction, syscalls their
+// registered price.
+type PriceTable struct {
+	ExecFeeFactor int64
+	StoragePrice  int64
+	Opcodes       map[NeoOpcode]int64
+	Syscalls      map[string]int64
+}
+
+// DefaultPriceTable returns mainnet pricing
+func DefaultPriceTable() *PriceTable {
+	return &PriceTable{
+		ExecFeeFactor: DefaultExecFeeFactor,
+		StoragePrice:  DefaultStoragePrice,
+		Opcodes:       make(map[NeoOpcode]int64),
+		Syscalls:      make(map[string]int64),
+	}
+}
+
+// pricingFile is the JSON form of a PriceTable; opcodes are named by mnemonic
+type pricingFile struct {
+	ExecFeeFactor *int64           `json:"execFeeFactor"`
+	StoragePrice  *int64           `json:"storagePrice"`
+	Opcodes       map[string]int64 `json:"opcodes"`
+	Syscalls      map[string]int64 `json:"syscalls"`
+}
+
+// LoadPriceTable reads a pricing file
+func LoadPriceTable(path string) (*PriceTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading pricing file: %w", err)
+	}
+	return ParsePriceTable(data)
+}
+
+// ParsePriceTable decodes a JSON pricing file such as
+//
+//	{"execFeeFactor": 1, "storagePrice": 1000, "opcodes": {"CALL": 256}, "syscalls": {"System.Storage.Put": 4096}}
+//
+// Omitted fields keep mainnet pricing.
+func ParsePriceTable(data []byte) (*PriceTable, error) {
+	var file pricingFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid pricing file: %w", err)
+	}
+
+	prices := DefaultPriceTable()
+	if file.ExecFeeFactor != nil {
+		if *file.ExecFeeFactor <= 0 {
+			return nil, fmt.Errorf("invalid pricing file: execFeeFactor must be positive")
+		}
+		prices.ExecFeeFactor = *file.ExecFeeFactor
+	}
+	if file.StoragePrice != nil {
+		if *file.StoragePrice < 0 {
+			return nil, fmt.Errorf("invalid pricing file: storagePrice must not be negative")
+		}
+		prices.StoragePrice = *file.StoragePrice
+	}
+
+	opcodes := opcodesByMnemonic()
+	for name, price := range file.Opcodes {
+		opcode, ok := opcodes[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid pricing file: unknown opcode %q", name)
+		}
+		if price < 0 {
+			return nil, fmt.Errorf("invalid pricing file: negative price for %s", name)
+		}
+		prices.Opcodes[opcode] = price
+	}
+	for name, price := range file.Syscalls {
+		if _, ok := DefaultInteropRegistry().Lookup(name); !ok {
+			return nil, fmt.Errorf("invalid pricing file: unknown syscall %q", name)
+		}
+		if price < 0 {
+			return nil, fmt.Errorf("invalid pricing file: negative price for %s", name)
+		}
+		prices.Syscalls[name] = price
+	}
+	return prices, nil
+}
+
+// opcodesByMnemonic maps mnemonics back to opcodes
+func opcodesByMnemonic() map[string]NeoOpcode {
+	opcodes := make(map[string]NeoOpcode, len(opcodeTable))
+	for op, info := range opcodeTable {
+		opcodes[info.Mnemonic] = op
+	}
+	return opcodes
+}
+
+// OpcodePrice returns the price of op, or builtin when it is not overridden
+func (p *PriceTable) OpcodePrice(op NeoOpcode, builtin int64) int64 {
+	if p == nil {
+		return builtin
+	}
+	if price, ok := p.Opcodes[op]; ok {
+		return price
+	}
+	return builtin
+}
+
+// SyscallPrice returns the price of the interop service method, or its
+// registered price when it is not overridden
+func (p *PriceTable) SyscallPrice(method string) int64 {
+	if p != nil {
+		if price, ok := p.Syscalls[method]; ok {
+			return price
+		}
+	}
+	service, _ := DefaultInteropRegistry().Lookup(method)
+	return service.Price
+}
+
+// InstructionPrice returns the price of one execution of instr. A SYSCALL
+// is priced by its method, other instructions by their opcode.
+func (p *PriceTable) InstructionPrice(instr NeoInstruction) int64 {
+	if instr.Opcode == SYSCALL {
+		return p.SyscallPrice(string(instr.Operand))
+	}
+	return p.OpcodePrice(instr.Opcode, instr.GasCost)
+}
+
+// Reprice sets the GasCost of every instruction to the table's price
+func (p *PriceTable) Reprice(instructions []NeoInstruction) {
+	for i := range instructions {
+		instructions[i].GasCost = p.InstructionPrice(instructions[i])
+	}
+}
+
+// ExecutionFee converts a price in Policy units to datoshi
+func (p *PriceTable) ExecutionFee(price int64) int64 {
+	if p == nil {
+		return price * DefaultExecFeeFactor
+	}
+	return price * p.ExecFeeFactor
+}
+
+// StorageFee returns the datoshi charged for storing the given number of bytes
+func (p *PriceTable) StorageFee(size int) int64 {
+	if p == nil {
+		return int64(size) * DefaultStoragePrice
+	}
+	return int64(size) * p.StoragePrice
+}
+
+// CostEstimate is the fee, in datoshi, of running every instruction of a
+// script once
+type CostEstimate struct {
+	ExecutionFee int64 `json:"execution_fee"`
+	StorageFee   int64 `json:"storage_fee"` // Writes whose key and value are constants
+	Instructions int   `json:"instructions"`
+}
+
+// Total returns the combined fee
+func (c CostEstimate) Total() int64 {
+	return c.ExecutionFee + c.StorageFee
+}
+
+// EstimateCost prices a straight-line pass over the script. Storage.Put is
+// charged for its key and value when both are pushed as constants right
+// before the call, or before the storage context, since the size of other
+// writes is unknown until runtime.
+func (p *PriceTable) EstimateCost(instructions []NeoInstruction) CostEstimate {
+	estimate := CostEstimate{Instructions: len(instructions)}
+	for i, instr := range instructions {
+		estimate.ExecutionFee += p.ExecutionFee(p.InstructionPrice(instr))
+		if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Storage.Put" {
+			top := i
+			if top > 0 && isStorageContext(instructions[top-1]) {
+				top--
+			}
+			if top < 2 {
+				continue
+			}
+			key, value := instructions[top-1], instructions[top-2]
+			if isPush(key.Opcode) && isPush(value.Opcode) {
+				estimate.StorageFee += p.StorageFee(pushedSize(key) + pushedSize(value))
+			}
+		}
+	}
+	return estimate
+}
+
+// isPush reports whether op pushes a constant
+func isPush(op NeoOpcode) bool {
+	return op == PUSHDATA1 || op == PUSHDATA2 || op == PUSHDATA4 || (op >= PUSH0 && op <= PUSH16)
+}
+
+// isStorageContext reports whether instr pushes the storage context
+func isStorageContext(instr NeoInstruction) bool {
+	if instr.Opcode == SYSCALL {
+		return string(instr.Operand) == "System.Storage.GetContext"
+	}
+	return strings.HasPrefix(OpcodeMnemonic(instr.Opcode), "LDSFLD")
+}
+
+// pushedSize returns the stored size of the constant a push instruction
+// pushes: zero is stored as an empty value, PUSH1-PUSH16 as one byte
+func pushedSize(instr NeoInstruction) int {
+	switch {
+	case instr.Opcode == PUSH0:
+		return 0
+	case instr.Opcode > PUSH0 && instr.Opcode <= PUSH16:
+		return 1
+	}
+	return len(instr.Operand)
+}
+
+// PriceTableFromConfig loads the pricing file named by CompilerConfig.PricingFile
+// or a --pricing flag, which takes precedence. It returns mainnet pricing when
+// neither is set.
+func PriceTableFromConfig(config CompilerConfig) (*PriceTable, error) {
+	path := flagValue(config.CompilerFlags, pricingFlag, config.PricingFile)
+	if path == "" {
+		return DefaultPriceTable(), nil
+	}
+	return LoadPriceTable(path)
+}
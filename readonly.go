@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Read-only functions.
+//
+// A function is read-only when neither it nor any function it calls
+// changes state: writes storage, emits events, calls contracts with call or
+// delegatecall, creates contracts, runs entry hooks such as the
+// reentrancy guard or runs verbatim code or a Neo builtin that notifies or
+// writes. Exported read-only functions are Safe methods, and the
+// stubs of Safe methods cache the read-only storage context, so the
+// classification is also what keeps Put out of them.
+//
+// Functions listed in ViewFunctions must be read-only; compiling fails at
+// the first operation that changes state.
+
+// stateBuiltins are the built-ins that change state
+var stateBuiltins = map[string]bool{
+	"sstore": true, "setimmutable": true, "log0": true, "log1": true, "log2": true, "log3": true, "log4": true,
+	"call": true, "callcode": true, "delegatecall": true,
+	"create": true, "create2": true, "selfdestruct": true,
+}
+
+// stateChange is the first operation through which a function changes
+// state
+type stateChange struct {
+	operation string         // Built-in or hook
+	location  SourcePosition // Of the operation, or of the call leading to it
+	via       []string       // Functions called on the way, outermost first
+}
+
+func (s *stateChange) String() string {
+	if len(s.via) == 0 {
+		return fmt.Sprintf("%s at line %d", s.operation, s.location.Line)
+	}
+	return fmt.Sprintf("%s through %s at line %d", s.operation, strings.Join(s.via, " -> "), s.location.Line)
+}
+
+// functionBody calls fn for the statements of block and its nested blocks,
+// without those of the functions defined inside it
+func functionBody(block *YulBlock, fn func(YulStatement)) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		if _, ok := stmt.(*YulFunctionDef); ok {
+			continue
+		}
+		fn(stmt)
+		for _, nested := range statementBlocks(stmt) {
+			functionBody(nested, fn)
+		}
+	}
+}
+
+// classifyFunctions finds the state change of every function in
+// signatures, leaving read-only functions out
+func (g *CodeGenerator) classifyFunctions() map[string]*stateChange {
+	changes := make(map[string]*stateChange)
+	calls := make(map[string][]*YulFunctionCall)
+	for name, def := range g.signatures {
+		if hooks := g.functionHooks[name]; len(hooks) > 0 {
+			changes[name] = &stateChange{operation: hooks[0].Name, location: def.Location}
+		}
+		functionBody(def.Body, func(stmt YulStatement) {
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(expr YulExpression) {
+					call, ok := expr.(*YulFunctionCall)
+					if !ok {
+						return
+					}
+					callee := call.FunctionName.Name
+					if _, defined := g.signatures[callee]; defined {
+						calls[name] = append(calls[name], call)
+					} else if (stateBuiltins[callee] || isVerbatim(callee) || neoStateChange(call)) && changes[name] == nil {
+						changes[name] = &stateChange{operation: callee, location: call.Location}
+					}
+				})
+			}
+		})
+	}
+
+	// Functions calling one that changes state change it too
+	callers := make([]string, 0, len(calls))
+	for name := range calls {
+		callers = append(callers, name)
+	}
+	sort.Strings(callers)
+	for changed := true; changed; {
+		changed = false
+		for _, name := range callers {
+			called := calls[name]
+			if changes[name] != nil {
+				continue
+			}
+			for _, call := range called {
+				if change := changes[call.FunctionName.Name]; change != nil {
+					via := append([]string{call.FunctionName.Name}, change.via...)
+					changes[name] = &stateChange{operation: change.operation, location: call.Location, via: via}
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return changes
+}
+
+// verifyViews classifies the functions of the contract script and fails
+// for view functions that change state
+func (g *CodeGenerator) verifyViews() error {
+	g.stateChanges = g.classifyFunctions()
+	if g.context == nil {
+		return nil
+	}
+	for _, name := range g.context.ViewFunctions {
+		if _, ok := g.signatures[name]; !ok {
+			return fmt.Errorf("view function %s is not defined", name)
+		}
+		if change := g.stateChanges[name]; change != nil {
+			return fmt.Errorf("view function %s changes state: %s", name, change)
+		}
+	}
+	return nil
+}
+
+// readOnly reports whether the function name of the contract script
+// leaves state unchanged
+func (g *CodeGenerator) readOnly(name string) bool {
+	_, changes := g.stateChanges[name]
+	return !changes
+}
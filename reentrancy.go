@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Reentrancy.
+//
+// A contract called with call or delegatecall may call back before the
+// call returns, and sees the storage as it was before the call. A storage
+// write on a path of the control flow graph after such a call in the same
+// body violates checks-effects-interactions: the write is reported with
+// the call it follows. Calls to functions that write storage, directly or
+// through the functions they call, are writes too. A write in the
+// arguments of the call runs before it.
+
+// reentrantCalls are the built-ins through which the callee may reenter
+var reentrantCalls = map[string]bool{"call": true, "callcode": true, "delegatecall": true}
+
+// storageWriters returns the functions that write storage, with the
+// sstore or the call through which they do
+func storageWriters(ast *YulAST) map[string]*YulFunctionCall {
+	writers := make(map[string]*YulFunctionCall)
+	calls := make(map[string][]*YulFunctionCall)
+	forEachFunctionDef(ast, func(fn *YulFunctionDef) {
+		functionBody(fn.Body, func(stmt YulStatement) {
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(e YulExpression) {
+					call, ok := e.(*YulFunctionCall)
+					if !ok {
+						return
+					}
+					if call.FunctionName.Name == "sstore" && writers[fn.Name] == nil {
+						writers[fn.Name] = call
+					}
+					calls[fn.Name] = append(calls[fn.Name], call)
+				})
+			}
+		})
+	})
+	names := make([]string, 0, len(calls))
+	for name := range calls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for changed := true; changed; {
+		changed = false
+		for _, name := range names {
+			if writers[name] != nil {
+				continue
+			}
+			for _, call := range calls[name] {
+				if writers[call.FunctionName.Name] != nil {
+					writers[name] = call
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return writers
+}
+
+// reentrancyIssues reports the storage writes after external calls
+func (sa *StaticAnalyzer) reentrancyIssues(ast *YulAST, cfg *ControlFlowGraph) []SecurityIssue {
+	writers := storageWriters(ast)
+	isWrite := func(call *YulFunctionCall) bool {
+		return call.FunctionName.Name == "sstore" || writers[call.FunctionName.Name] != nil
+	}
+	callsIn := func(node *CFGNode, match func(*YulFunctionCall) bool) []*YulFunctionCall {
+		var found []*YulFunctionCall
+		for _, slot := range statementExpressions(node.Statement) {
+			walkExpression(*slot, func(e YulExpression) {
+				if call, ok := e.(*YulFunctionCall); ok && match(call) {
+					found = append(found, call)
+				}
+			})
+		}
+		return found
+	}
+	external := func(call *YulFunctionCall) bool {
+		return reentrantCalls[call.FunctionName.Name]
+	}
+
+	// The first call each write follows
+	after := make(map[*YulFunctionCall]*YulFunctionCall)
+	var writes []*YulFunctionCall
+	follow := func(write, call *YulFunctionCall) {
+		if after[write] == nil {
+			after[write] = call
+			writes = append(writes, write)
+		}
+	}
+	for _, entry := range cfg.Entries {
+		for _, node := range reachableFrom(entry) {
+			for _, call := range callsIn(node, external) {
+				// Writes taking the result of the call
+				for _, write := range callsIn(node, isWrite) {
+					if write != call && containsExpression(write, call) {
+						follow(write, call)
+					}
+				}
+				seen := make(map[*CFGNode]bool)
+				queue := append([]*CFGNode(nil), node.Successors...)
+				for len(queue) > 0 {
+					next := queue[0]
+					queue = queue[1:]
+					if seen[next] {
+						continue
+					}
+					seen[next] = true
+					for _, write := range callsIn(next, isWrite) {
+						follow(write, call)
+					}
+					queue = append(queue, next.Successors...)
+				}
+			}
+		}
+	}
+
+	issues := make([]SecurityIssue, 0, len(writes))
+	for _, write := range writes {
+		call := after[write]
+		operation := "sstore"
+		if name := write.FunctionName.Name; name != "sstore" {
+			operation = "storage write through " + name
+		}
+		issues = append(issues, SecurityIssue{
+			Type:        SecurityIssueReentrancy,
+			Severity:    SeverityHigh,
+			Location:    write.Location,
+			Related:     []SourcePosition{call.Location},
+			Description: fmt.Sprintf("%s at line %d, column %d runs after the %s at line %d, column %d", operation, write.Location.Line, write.Location.Column, call.FunctionName.Name, call.Location.Line, call.Location.Column),
+			Suggestion:  fmt.Sprintf("Move the %s at line %d before the %s at line %d (checks-effects-interactions)", operation, write.Location.Line, call.FunctionName.Name, call.Location.Line),
+		})
+	}
+	return issues
+}
+
+// reachableFrom lists the nodes reachable from entry, in ID order
+func reachableFrom(entry *CFGNode) []*CFGNode {
+	seen := map[*CFGNode]bool{entry: true}
+	nodes := []*CFGNode{entry}
+	for i := 0; i < len(nodes); i++ {
+		for _, next := range nodes[i].Successors {
+			if !seen[next] {
+				seen[next] = true
+				nodes = append(nodes, next)
+			}
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// containsExpression reports whether inner is part of expr
+func containsExpression(expr, inner YulExpression) bool {
+	found := false
+	walkExpression(expr, func(e YulExpression) {
+		found = found || e == inner
+	})
+	return found
+}
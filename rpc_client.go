@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Node RPC.
+//
+// RPCClient calls the JSON-RPC API of a Neo N3 node. Transact sends a
+// script as a transaction of one account: it runs the script with
+// invokescript for the system fee, which must be the gas it consumes, has
+// the node calculate the network fee, signs, broadcasts and polls
+// getapplicationlog until a block includes the transaction.
+
+// Transaction sending defaults
+const (
+	defaultValidUntilIncrement = 5760 // MaxValidUntilBlockIncrement of mainnet
+	defaultTransactTimeout     = 2 * time.Minute
+	defaultPollInterval        = time.Second
+)
+
+// VM state of an execution that ended normally
+const vmStateHalt = "HALT"
+
+// RPCClient calls a node
+type RPCClient struct {
+	Endpoint string
+	HTTP     *http.Client
+	id       int
+}
+
+// NewRPCClient creates a client of the node at endpoint
+func NewRPCClient(endpoint string) *RPCClient {
+	return &RPCClient{Endpoint: endpoint, HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// RPCError is an error the node returned
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	if e.Data != "" && e.Data != e.Message {
+		return fmt.Sprintf("RPC error %d: %s: %s", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("RPC error %d: %s", e.Code, e.Message)
+}
+
+// Datoshi is an amount of GAS in datoshi, which the RPC API writes as a
+// string
+type Datoshi int64
+
+func (d *Datoshi) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s", data)
+	}
+	*d = Datoshi(n)
+	return nil
+}
+
+// String returns the amount in GAS
+func (d Datoshi) String() string {
+	sign := ""
+	n := int64(d)
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	return fmt.Sprintf("%s%d.%08d GAS", sign, n/1e8, n%1e8)
+}
+
+// RPCStackItem is a stack item as the RPC API writes it
+type RPCStackItem struct {
+	Type      string          `json:"type"`
+	Value     json.RawMessage `json:"value,omitempty"`
+	Interface string          `json:"interface,omitempty"` // Of an InteropInterface
+}
+
+// RPCNotification is a notification of an execution
+type RPCNotification struct {
+	Contract  string       `json:"contract"`
+	EventName string       `json:"eventname"`
+	State     RPCStackItem `json:"state"`
+}
+
+// InvocationResult is the result of a test invocation
+type InvocationResult struct {
+	Script        string            `json:"script"`
+	State         string            `json:"state"`
+	GasConsumed   Datoshi           `json:"gasconsumed"`
+	Exception     string            `json:"exception"`
+	Stack         []RPCStackItem    `json:"stack"`
+	Notifications []RPCNotification `json:"notifications"`
+}
+
+// ApplicationExecution is an execution of the application log
+type ApplicationExecution struct {
+	Trigger       string            `json:"trigger"`
+	VMState       string            `json:"vmstate"`
+	Exception     string            `json:"exception"`
+	GasConsumed   Datoshi           `json:"gasconsumed"`
+	Stack         []RPCStackItem    `json:"stack"`
+	Notifications []RPCNotification `json:"notifications"`
+}
+
+// ApplicationLog is the application log of a transaction
+type ApplicationLog struct {
+	TxID       string                 `json:"txid"`
+	Executions []ApplicationExecution `json:"executions"`
+}
+
+// RPCVersion is the version of a node and its protocol settings
+type RPCVersion struct {
+	UserAgent string `json:"useragent"`
+	Protocol  struct {
+		AddressVersion              byte   `json:"addressversion"`
+		Network                     uint32 `json:"network"`
+		MaxValidUntilBlockIncrement uint32 `json:"maxvaliduntilblockincrement"`
+	} `json:"protocol"`
+}
+
+// ContractState is a deployed contract
+type ContractState struct {
+	ID            int    `json:"id"`
+	UpdateCounter int    `json:"updatecounter"`
+	Hash          string `json:"hash"`
+	NEF           struct {
+		Compiler string           `json:"compiler"`
+		Source   string           `json:"source"`
+		Script   []byte           `json:"script"`
+		Tokens   []RPCMethodToken `json:"tokens"`
+		Checksum uint32           `json:"checksum"`
+	} `json:"nef"`
+	Manifest ContractManifest `json:"manifest"`
+}
+
+// RPCMethodToken is a method token of a deployed NEF file, whose call
+// flags nodes write as names
+type RPCMethodToken struct {
+	Hash           string          `json:"hash"`
+	Method         string          `json:"method"`
+	ParamCount     uint16          `json:"paramcount"`
+	HasReturnValue bool            `json:"hasreturnvalue"`
+	CallFlags      json.RawMessage `json:"callflags"`
+}
+
+// rpcSigner is a signer in RPC requests
+type rpcSigner struct {
+	Account string `json:"account"`
+	Scopes  string `json:"scopes"`
+}
+
+// Call calls method with params and decodes its result into result
+func (c *RPCClient) Call(method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	c.id++
+	request, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	response, err := c.HTTP.Post(c.Endpoint, "application/json", bytes.NewReader(request))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return fmt.Errorf("%s: %s returned %s", method, c.Endpoint, response.Status)
+	}
+	if reply.Error != nil {
+		return reply.Error
+	}
+	if err := json.Unmarshal(reply.Result, result); err != nil {
+		return fmt.Errorf("%s: invalid result: %w", method, err)
+	}
+	return nil
+}
+
+// GetVersion returns the version of the node
+func (c *RPCClient) GetVersion() (*RPCVersion, error) {
+	var version RPCVersion
+	return &version, c.Call("getversion", nil, &version)
+}
+
+// GetBlockCount returns the height of the chain plus one
+func (c *RPCClient) GetBlockCount() (uint32, error) {
+	var count uint32
+	return count, c.Call("getblockcount", nil, &count)
+}
+
+// InvokeScript runs script without persisting it, witnessed by signers
+func (c *RPCClient) InvokeScript(script []byte, signers []TransactionSigner) (*InvocationResult, error) {
+	var result InvocationResult
+	return &result, c.Call("invokescript", []interface{}{base64.StdEncoding.EncodeToString(script), rpcSigners(signers)}, &result)
+}
+
+// InvokeFunction runs method of the contract hash with args without
+// persisting it, witnessed by signers
+func (c *RPCClient) InvokeFunction(hash Uint160, method string, args []ContractParameter, signers []TransactionSigner) (*InvocationResult, error) {
+	if args == nil {
+		args = []ContractParameter{}
+	}
+	var result InvocationResult
+	return &result, c.Call("invokefunction", []interface{}{hash.String(), method, args, rpcSigners(signers)}, &result)
+}
+
+// GetContractState returns the contract deployed at hash
+func (c *RPCClient) GetContractState(hash Uint160) (*ContractState, error) {
+	var state ContractState
+	return &state, c.Call("getcontractstate", []interface{}{hash.String()}, &state)
+}
+
+// CalculateNetworkFee returns the network fee the node asks for tx, whose
+// witnesses hold the verification scripts of its signers
+func (c *RPCClient) CalculateNetworkFee(tx *Transaction) (Datoshi, error) {
+	var result struct {
+		NetworkFee Datoshi `json:"networkfee"`
+	}
+	err := c.Call("calculatenetworkfee", []interface{}{base64.StdEncoding.EncodeToString(tx.Bytes())}, &result)
+	return result.NetworkFee, err
+}
+
+// SendRawTransaction broadcasts tx and returns its hash
+func (c *RPCClient) SendRawTransaction(tx *Transaction) (string, error) {
+	var result struct {
+		Hash string `json:"hash"`
+	}
+	err := c.Call("sendrawtransaction", []interface{}{base64.StdEncoding.EncodeToString(tx.Bytes())}, &result)
+	return result.Hash, err
+}
+
+// GetApplicationLog returns the application log of the transaction hash
+func (c *RPCClient) GetApplicationLog(hash string) (*ApplicationLog, error) {
+	var log ApplicationLog
+	return &log, c.Call("getapplicationlog", []interface{}{hash}, &log)
+}
+
+// WaitApplicationLog polls the application log of the transaction hash
+// until the node has one or timeout passes
+func (c *RPCClient) WaitApplicationLog(hash string, timeout, interval time.Duration) (*ApplicationLog, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		log, err := c.GetApplicationLog(hash)
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			return log, err
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return nil, fmt.Errorf("transaction %s was not persisted within %v: %w", hash, timeout, err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// rpcSigners returns signers as RPC requests write them
+func rpcSigners(signers []TransactionSigner) []rpcSigner {
+	list := make([]rpcSigner, len(signers))
+	for i, signer := range signers {
+		list[i] = rpcSigner{Account: signer.Account.String(), Scopes: witnessScopeNames[signer.Scopes]}
+	}
+	return list
+}
+
+// TransactOptions configure sending a transaction
+type TransactOptions struct {
+	Timeout      time.Duration // Wait for the application log, 2 minutes when 0
+	PollInterval time.Duration // Between getapplicationlog calls, 1 second when 0
+}
+
+// TransactionResult is a persisted transaction
+type TransactionResult struct {
+	Hash       string
+	SystemFee  Datoshi
+	NetworkFee Datoshi
+	Execution  *ApplicationExecution
+}
+
+// Transact sends script as a transaction of account, witnessed for the
+// contracts the script calls, and waits for its execution. An execution
+// ending in a fault is returned with an error.
+func (c *RPCClient) Transact(account *Account, script []byte, options TransactOptions) (*TransactionResult, error) {
+	if options.Timeout == 0 {
+		options.Timeout = defaultTransactTimeout
+	}
+	if options.PollInterval == 0 {
+		options.PollInterval = defaultPollInterval
+	}
+	version, err := c.GetVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version.Protocol.AddressVersion != 0 && version.Protocol.AddressVersion != AddressVersion {
+		return nil, fmt.Errorf("node uses address version %d, not Neo N3's %d", version.Protocol.AddressVersion, AddressVersion)
+	}
+	tx := &Transaction{
+		Signers: []TransactionSigner{{Account: account.ScriptHash(), Scopes: WitnessCalledByEntry}},
+		Script:  script,
+	}
+	invocation, err := c.InvokeScript(script, tx.Signers)
+	if err != nil {
+		return nil, err
+	}
+	if invocation.State != vmStateHalt {
+		return nil, fmt.Errorf("script faults: %s", invocation.Exception)
+	}
+	tx.SystemFee = int64(invocation.GasConsumed)
+
+	height, err := c.GetBlockCount()
+	if err != nil {
+		return nil, err
+	}
+	increment := version.Protocol.MaxValidUntilBlockIncrement
+	if increment == 0 {
+		increment = defaultValidUntilIncrement
+	}
+	tx.ValidUntilBlock = height + increment - 1
+	var nonce [4]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	tx.Nonce = binary.LittleEndian.Uint32(nonce[:])
+
+	tx.setWitness(account, nil)
+	fee, err := c.CalculateNetworkFee(tx)
+	if err != nil {
+		return nil, err
+	}
+	tx.NetworkFee = int64(fee)
+	if err := tx.Sign(account, version.Protocol.Network); err != nil {
+		return nil, err
+	}
+	hash, err := c.SendRawTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	if hash != tx.Hash() {
+		return nil, fmt.Errorf("node accepted transaction %s, not %s", hash, tx.Hash())
+	}
+
+	result := &TransactionResult{Hash: hash, SystemFee: Datoshi(tx.SystemFee), NetworkFee: fee}
+	log, err := c.WaitApplicationLog(hash, options.Timeout, options.PollInterval)
+	if err != nil {
+		return result, err
+	}
+	for i := range log.Executions {
+		if log.Executions[i].Trigger == "Application" {
+			result.Execution = &log.Executions[i]
+		}
+	}
+	switch {
+	case result.Execution == nil:
+		return result, fmt.Errorf("transaction %s has no application execution", hash)
+	case result.Execution.VMState != vmStateHalt:
+		return result, fmt.Errorf("transaction %s faulted: %s", hash, result.Execution.Exception)
+	}
+	return result, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// Deployment through a node.
+//
+// The deploy command deploys compiled artifacts: it sends a transaction
+// calling ContractManagement.deploy(nef, manifest), signed with a key
+// given in WIF or by a NEP-6 wallet, and prints the hash of the contract
+// once a block includes it:
+//
+//	neo-yulc deploy -rpc http://localhost:10332 -wif KEY out/token.nef
+//	neo-yulc deploy -rpc URL -wallet wallet.json -account ADDRESS out/token.nef out/token.manifest.json
+//
+// The manifest defaults to the one written next to the NEF. A wallet's
+// password is read from NEO_WALLET_PASSWORD unless -password gives it.
+
+// PasswordVariable is the environment variable holding a wallet's password
+const PasswordVariable = "NEO_WALLET_PASSWORD"
+
+// DeployResult is a deployed contract
+type DeployResult struct {
+	*TransactionResult
+	Contract Uint160
+}
+
+// DeployScript returns the script calling ContractManagement.deploy with
+// the NEF file and manifest
+func DeployScript(nef, manifest []byte) ([]byte, error) {
+	management, err := ParseUint160(ContractManagementHash)
+	if err != nil {
+		return nil, err
+	}
+	return ContractCallScript(management, "deploy", []NeoVMStackItem{CreateNeoVMByteString(nef), CreateNeoVMByteString(manifest)})
+}
+
+// ContractHash returns the hash of the contract sender deploys with the
+// NEF checksum and manifest name: the script hash of
+//
+//	ABORT
+//	PUSHDATA1 <sender>
+//	PUSH      <checksum>
+//	PUSHDATA1 <name>
+func ContractHash(sender Uint160, checksum uint32, name string) Uint160 {
+	script := []byte{byte(ABORT), byte(PUSHDATA1), byte(len(sender))}
+	script = append(script, scriptOrder(sender)...)
+	script = append(script, pushIntegerScript(new(big.Int).SetUint64(uint64(checksum)))...)
+	push, _ := assembleScript([]NeoInstruction{NewPushInstruction(CreateNeoVMByteString(name))})
+	return ScriptHash(append(script, push...))
+}
+
+// pushIntegerScript returns the script pushing n the way nodes emit
+// integers: PUSHM1 to PUSH16, or the smallest PUSHINT holding it
+func pushIntegerScript(n *big.Int) []byte {
+	if n.IsInt64() && n.Int64() >= -1 && n.Int64() <= 16 {
+		return []byte{byte(PUSH0) + byte(n.Int64())}
+	}
+	data := encodeInteger(n)
+	op, size := PUSHINT8, 1
+	for size < len(data) {
+		op, size = op+1, size*2
+	}
+	pad := byte(0)
+	if n.Sign() < 0 {
+		pad = 0xff
+	}
+	for len(data) < size {
+		data = append(data, pad)
+	}
+	return append([]byte{byte(op)}, data...)
+}
+
+// Deploy deploys the contract of a NEF file and manifest from account
+func (c *RPCClient) Deploy(account *Account, nef, manifest []byte, options TransactOptions) (*DeployResult, error) {
+	file, err := DecodeNEF(nef)
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(manifest, &header); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	script, err := DeployScript(nef, manifest)
+	if err != nil {
+		return nil, err
+	}
+	deployed := &DeployResult{Contract: ContractHash(account.ScriptHash(), file.Checksum, header.Name)}
+	deployed.TransactionResult, err = c.Transact(account, script, options)
+	if err != nil {
+		return deployed, err
+	}
+	if hash, ok := deployedContract(deployed.Execution); ok && hash != deployed.Contract {
+		return deployed, fmt.Errorf("ContractManagement deployed %s, not %s", hash, deployed.Contract)
+	}
+	return deployed, nil
+}
+
+// deployedContract returns the contract the Deploy notification of
+// ContractManagement in execution names
+func deployedContract(execution *ApplicationExecution) (Uint160, bool) {
+	var hash Uint160
+	for _, notification := range execution.Notifications {
+		if notification.Contract != ContractManagementHash || notification.EventName != "Deploy" {
+			continue
+		}
+		var state []RPCStackItem
+		var value string
+		if json.Unmarshal(notification.State.Value, &state) != nil || len(state) != 1 || json.Unmarshal(state[0].Value, &value) != nil {
+			return hash, false
+		}
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(data) != len(hash) {
+			return hash, false
+		}
+		copy(hash[:], scriptOrder(Uint160(data)))
+		return hash, true
+	}
+	return hash, false
+}
+
+// loadAccount returns the account of a WIF key or wallet file
+func loadAccount(wif, wallet, address, password string) (*Account, error) {
+	switch {
+	case wif != "" && wallet != "":
+		return nil, errors.New("give either a WIF key or a wallet")
+	case wif != "":
+		return ParseWIF(wif)
+	case wallet != "":
+		w, err := LoadNEP6Wallet(wallet)
+		if err != nil {
+			return nil, err
+		}
+		if password == "" {
+			password = os.Getenv(PasswordVariable)
+		}
+		return w.Account(address, password)
+	}
+	return nil, errors.New("no key: give -wif or -wallet")
+}
+
+// RunDeployCommand runs "deploy" with the given arguments and returns the
+// process exit code
+func RunDeployCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	endpoint := flags.String("rpc", "", "RPC endpoint of the node")
+	wif := flags.String("wif", "", "private key of the deploying account in WIF")
+	wallet := flags.String("wallet", "", "NEP-6 wallet holding the deploying account")
+	address := flags.String("account", "", "address of the wallet account, the default one if empty")
+	password := flags.String("password", "", "wallet password, $"+PasswordVariable+" if empty")
+	timeout := flags.Duration("timeout", defaultTransactTimeout, "how long to wait for the transaction to be persisted")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: deploy -rpc URL (-wif KEY | -wallet FILE) [flags] contract.nef [contract.manifest.json]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *endpoint == "" || flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	nefPath := flags.Arg(0)
+	manifestPath := strings.TrimSuffix(nefPath, ArtifactNEF) + ArtifactManifest
+	if flags.NArg() == 2 {
+		manifestPath = flags.Arg(1)
+	}
+	nef, err := os.ReadFile(nefPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailed
+	}
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailed
+	}
+	account, err := loadAccount(*wif, *wallet, *address, *password)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailed
+	}
+
+	deployed, err := NewRPCClient(*endpoint).Deploy(account, nef, manifest, TransactOptions{Timeout: *timeout})
+	if deployed != nil && deployed.TransactionResult != nil {
+		fmt.Fprintf(stdout, "Transaction: %s\n", deployed.Hash)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "deploy: %v\n", err)
+		return exitFailed
+	}
+	fmt.Fprintf(stdout, "Contract:    %s\n", deployed.Contract)
+	fmt.Fprintf(stdout, "Fees:        %s system, %s network\n", deployed.SystemFee, deployed.NetworkFee)
+	return exitOK
+}
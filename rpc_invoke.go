@@ -0,0 +1,577 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Contract invocation through a node.
+//
+// The invoke command calls a method of a deployed contract. It reads the
+// method's parameter types from the manifest the node holds and converts
+// each argument to its type:
+//
+//	Boolean    true or false
+//	Integer    decimal, or hex with 0x
+//	String     the text
+//	ByteArray  hex, with or without 0x
+//	Hash160    an address or a script hash
+//	Hash256    a hash
+//	PublicKey  a compressed public key in hex
+//	Signature  64 bytes in hex
+//	Array      a JSON array, its strings read as Any
+//
+// An Any argument is read as null, true, false, a decimal integer, an
+// address or 0x-prefixed script hash, other 0x-prefixed hex as bytes, or
+// else as a string; a type and a colon, such as Integer:0x10, gives its
+// type instead. By default the method is run with invokefunction and
+// nothing is persisted; -send signs and broadcasts it as a transaction.
+// The results are decoded and shown as the ABI return type reads them:
+//
+//	neo-yulc invoke -rpc URL 0x1234...cdef balanceOf NPTmAHDxo6Pkyic8Nvu3kwyXoYJCvcCB6i
+//	neo-yulc invoke -rpc URL -wif KEY -send 0x1234...cdef transfer FROM TO 100 null
+
+// ContractParameter is a typed argument of a contract method. Its value is
+// nil, a bool, *big.Int, string, []byte, a Uint160 or []ContractParameter.
+// Hash256 bytes are in displayed order.
+type ContractParameter struct {
+	Type  string
+	Value interface{}
+}
+
+// parameterTypes are the ABI types an argument may have
+var parameterTypes = []string{"Any", "Boolean", "Integer", "ByteArray", "String", "Hash160", "Hash256", "PublicKey", "Signature", "Array"}
+
+// ParseContractParameter converts a command line argument to an ABI type
+func ParseContractParameter(kind, text string) (ContractParameter, error) {
+	p := ContractParameter{Type: kind}
+	var err error
+	switch kind {
+	case "Any":
+		return inferParameter(text)
+	case "Boolean":
+		p.Value, err = strconv.ParseBool(text)
+	case "Integer":
+		n, ok := new(big.Int).SetString(text, 0)
+		if !ok {
+			err = fmt.Errorf("%q is not an integer", text)
+		}
+		p.Value = n
+	case "String":
+		p.Value = text
+	case "ByteArray":
+		p.Value, err = parseHexBytes(text, -1)
+	case "Signature":
+		p.Value, err = parseHexBytes(text, 64)
+	case "PublicKey":
+		var key []byte
+		if key, err = parseHexBytes(text, 33); err == nil {
+			if x, _ := elliptic.UnmarshalCompressed(elliptic.P256(), key); x == nil {
+				err = fmt.Errorf("%s is not a public key", text)
+			}
+		}
+		p.Value = key
+	case "Hash160":
+		p.Value, err = parseAccount(text)
+	case "Hash256":
+		p.Value, err = parseHexBytes(text, 32)
+	case "Array":
+		var elements []json.RawMessage
+		if err := json.Unmarshal([]byte(text), &elements); err != nil {
+			return p, fmt.Errorf("%q is not a JSON array", text)
+		}
+		items := make([]ContractParameter, len(elements))
+		for i, element := range elements {
+			if items[i], err = jsonParameter(element); err != nil {
+				return p, err
+			}
+		}
+		p.Value = items
+	default:
+		err = fmt.Errorf("%s arguments cannot be given", kind)
+	}
+	return p, err
+}
+
+// inferParameter reads an Any argument
+func inferParameter(text string) (ContractParameter, error) {
+	if i := strings.IndexByte(text, ':'); i > 0 {
+		for _, kind := range parameterTypes {
+			if kind != "Any" && strings.EqualFold(kind, text[:i]) {
+				return ParseContractParameter(kind, text[i+1:])
+			}
+		}
+	}
+	switch {
+	case text == "null":
+		return ContractParameter{Type: "Any"}, nil
+	case text == "true" || text == "false":
+		return ParseContractParameter("Boolean", text)
+	case strings.HasPrefix(text, "0x") && len(text) == 42:
+		if p, err := ParseContractParameter("Hash160", text); err == nil {
+			return p, nil
+		}
+	case strings.HasPrefix(text, "0x"):
+		if p, err := ParseContractParameter("ByteArray", text); err == nil {
+			return p, nil
+		}
+	}
+	if n, ok := new(big.Int).SetString(text, 10); ok {
+		return ContractParameter{Type: "Integer", Value: n}, nil
+	}
+	if hash, err := ParseAddress(text); err == nil {
+		return ContractParameter{Type: "Hash160", Value: hash}, nil
+	}
+	return ContractParameter{Type: "String", Value: text}, nil
+}
+
+// jsonParameter reads an element of an Array argument
+func jsonParameter(element json.RawMessage) (ContractParameter, error) {
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(element)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return ContractParameter{}, err
+	}
+	switch v := value.(type) {
+	case nil:
+		return ContractParameter{Type: "Any"}, nil
+	case bool:
+		return ContractParameter{Type: "Boolean", Value: v}, nil
+	case json.Number:
+		return ParseContractParameter("Integer", v.String())
+	case string:
+		return inferParameter(v)
+	case []interface{}:
+		return ParseContractParameter("Array", string(element))
+	}
+	return ContractParameter{}, fmt.Errorf("%s cannot be an argument", element)
+}
+
+// parseHexBytes decodes hex with an optional 0x prefix, of size bytes
+// unless size is negative
+func parseHexBytes(text string, size int) ([]byte, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(text, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("%q is not hex", text)
+	}
+	if size >= 0 && len(data) != size {
+		return nil, fmt.Errorf("%s is %d bytes, not %d", text, len(data), size)
+	}
+	return data, nil
+}
+
+// parseAccount parses an address or a script hash
+func parseAccount(text string) (Uint160, error) {
+	if hash, err := ParseAddress(text); err == nil {
+		return hash, nil
+	}
+	hash, err := ParseUint160(text)
+	if err != nil {
+		return hash, fmt.Errorf("%q is neither an address nor a script hash", text)
+	}
+	return hash, nil
+}
+
+// MarshalJSON writes the parameter as RPC requests take it
+func (p ContractParameter) MarshalJSON() ([]byte, error) {
+	value := p.Value
+	switch v := p.Value.(type) {
+	case *big.Int:
+		value = v.String()
+	case Uint160:
+		value = v.String()
+	case []byte:
+		switch p.Type {
+		case "PublicKey":
+			value = hex.EncodeToString(v)
+		case "Hash256":
+			value = "0x" + hex.EncodeToString(v)
+		default:
+			value = base64.StdEncoding.EncodeToString(v)
+		}
+	}
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Value interface{} `json:"value,omitempty"`
+	}{p.Type, value})
+}
+
+// StackItem returns the item a script pushes for the parameter
+func (p ContractParameter) StackItem() NeoVMStackItem {
+	switch v := p.Value.(type) {
+	case bool:
+		return CreateNeoVMBoolean(v)
+	case *big.Int:
+		return CreateNeoVMInteger(v)
+	case string:
+		return CreateNeoVMByteString(v)
+	case Uint160:
+		return CreateNeoVMByteString(scriptOrder(v))
+	case []byte:
+		data := append([]byte{}, v...)
+		if p.Type == "Hash256" {
+			reverseBytes(data)
+		}
+		return CreateNeoVMByteString(data)
+	case []ContractParameter:
+		items := make([]NeoVMStackItem, len(v))
+		for i, element := range v {
+			items[i] = element.StackItem()
+		}
+		return CreateNeoVMArray(items)
+	}
+	return NeoVMNull{}
+}
+
+// ContractCallScript returns the script calling method of the contract
+// hash with args and every call flag
+func ContractCallScript(hash Uint160, method string, args []NeoVMStackItem) ([]byte, error) {
+	script, err := appendPush(nil, CreateNeoVMArray(args))
+	if err != nil {
+		return nil, err
+	}
+	script = append(script, pushIntegerScript(big.NewInt(callFlagsAll))...)
+	call, err := assembleScript([]NeoInstruction{
+		NewPushInstruction(CreateNeoVMByteString(method)),
+		NewPushInstruction(CreateNeoVMByteString(scriptOrder(hash))),
+		NewSyscallInstruction("System.Contract.Call"),
+	})
+	return append(script, call...), err
+}
+
+// appendPush appends the script pushing item, an array by its items in
+// reverse order and PACK
+func appendPush(script []byte, item NeoVMStackItem) ([]byte, error) {
+	switch v := item.(type) {
+	case NeoVMNull:
+		return append(script, byte(PUSHNULL)), nil
+	case *NeoVMBoolean:
+		if v.Value {
+			return append(script, byte(PUSHT)), nil
+		}
+		return append(script, byte(PUSHF)), nil
+	case *NeoVMInteger:
+		return append(script, pushIntegerScript(v.Value)...), nil
+	case *NeoVMArray:
+		var err error
+		for i := len(v.Items) - 1; i >= 0; i-- {
+			if script, err = appendPush(script, v.Items[i]); err != nil {
+				return nil, err
+			}
+		}
+		script = append(script, pushIntegerScript(big.NewInt(int64(len(v.Items))))...)
+		return append(script, byte(PACK)), nil
+	}
+	data, err := bytesOf(item)
+	if err != nil {
+		return nil, err
+	}
+	push, err := assembleScript([]NeoInstruction{NewPushInstruction(CreateNeoVMByteString(data))})
+	return append(script, push...), err
+}
+
+// DecodeRPCStackItem decodes a stack item of an RPC result
+func DecodeRPCStackItem(item RPCStackItem) (NeoVMStackItem, error) {
+	invalid := func(err error) (NeoVMStackItem, error) {
+		return nil, fmt.Errorf("invalid %s item %s: %v", item.Type, item.Value, err)
+	}
+	switch item.Type {
+	case "Any":
+		return NeoVMNull{}, nil
+	case "Boolean":
+		var value bool
+		if err := json.Unmarshal(item.Value, &value); err != nil {
+			return invalid(err)
+		}
+		return CreateNeoVMBoolean(value), nil
+	case "Integer":
+		var text string
+		if err := json.Unmarshal(item.Value, &text); err != nil {
+			return invalid(err)
+		}
+		n, ok := new(big.Int).SetString(text, 10)
+		if !ok {
+			return invalid(errors.New("not an integer"))
+		}
+		return CreateNeoVMInteger(n), nil
+	case "ByteString", "Buffer":
+		var data []byte
+		if err := json.Unmarshal(item.Value, &data); err != nil {
+			return invalid(err)
+		}
+		if item.Type == "Buffer" {
+			return &NeoVMBuffer{Value: data}, nil
+		}
+		return CreateNeoVMByteString(data), nil
+	case "Array", "Struct":
+		var elements []RPCStackItem
+		if err := json.Unmarshal(item.Value, &elements); err != nil {
+			return invalid(err)
+		}
+		items := make([]NeoVMStackItem, len(elements))
+		for i, element := range elements {
+			decoded, err := DecodeRPCStackItem(element)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = decoded
+		}
+		if item.Type == "Struct" {
+			return &NeoVMStruct{Items: items}, nil
+		}
+		return CreateNeoVMArray(items), nil
+	case "Map":
+		var entries []struct {
+			Key   RPCStackItem `json:"key"`
+			Value RPCStackItem `json:"value"`
+		}
+		if err := json.Unmarshal(item.Value, &entries); err != nil {
+			return invalid(err)
+		}
+		m := &NeoVMMap{Items: make(map[string]NeoVMStackItem)}
+		for _, entry := range entries {
+			key, err := DecodeRPCStackItem(entry.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := DecodeRPCStackItem(entry.Value)
+			if err != nil {
+				return nil, err
+			}
+			if err := mapSet(m, key, value); err != nil {
+				return invalid(err)
+			}
+		}
+		return m, nil
+	case "Pointer":
+		var offset int
+		if err := json.Unmarshal(item.Value, &offset); err != nil {
+			return invalid(err)
+		}
+		return &NeoVMPointer{Offset: offset}, nil
+	case "InteropInterface":
+		return &NeoVMInterop{Interface: item.Interface}, nil
+	}
+	return nil, fmt.Errorf("unknown stack item type %q", item.Type)
+}
+
+// FormatStackItem formats item as a value of the ABI type kind
+func FormatStackItem(item NeoVMStackItem, kind string) string {
+	data, bytesErr := bytesOf(item)
+	switch kind {
+	case "Integer":
+		if n, err := integerOf(item, 32); err == nil {
+			return n.String()
+		}
+	case "Boolean":
+		if _, ok := item.(NeoVMNull); !ok {
+			if b, err := booleanOf(item, 32); err == nil {
+				return strconv.FormatBool(b)
+			}
+		}
+	case "String":
+		if bytesErr == nil && utf8.Valid(data) {
+			return string(data)
+		}
+	case "Hash160":
+		if bytesErr == nil && len(data) == len(Uint160{}) {
+			return Uint160(scriptOrder(Uint160(data))).String()
+		}
+	case "Hash256":
+		if bytesErr == nil && len(data) == 32 {
+			hash := append([]byte{}, data...)
+			reverseBytes(hash)
+			return "0x" + hex.EncodeToString(hash)
+		}
+	case "ByteArray", "PublicKey", "Signature":
+		if bytesErr == nil {
+			return "0x" + hex.EncodeToString(data)
+		}
+	}
+	return formatAnyItem(item)
+}
+
+// formatAnyItem formats an item of no particular type: bytes as a quoted
+// string when they are printable text, else in hex
+func formatAnyItem(item NeoVMStackItem) string {
+	switch v := item.(type) {
+	case NeoVMNull:
+		return "null"
+	case *NeoVMInteger:
+		return v.Value.String()
+	case *NeoVMBoolean:
+		return strconv.FormatBool(v.Value)
+	case *NeoVMByteString, *NeoVMBuffer:
+		data := v.ToBytes()
+		if utf8.Valid(data) && strings.IndexFunc(string(data), func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+			return strconv.Quote(string(data))
+		}
+		return "0x" + hex.EncodeToString(data)
+	case *NeoVMMap:
+		entries := make([]string, len(v.Keys))
+		for i, key := range v.Keys {
+			entries[i] = formatAnyItem(key) + ": " + formatAnyItem(v.Items[mapKey(key)])
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case *NeoVMInterop:
+		return "InteropInterface " + v.Interface
+	case *NeoVMPointer:
+		return fmt.Sprintf("Pointer %d", v.Offset)
+	}
+	if items, ok := itemsOf(item); ok {
+		elements := make([]string, len(items))
+		for i, element := range items {
+			elements[i] = formatAnyItem(element)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	}
+	return item.String()
+}
+
+// findMethod returns the ABI method name taking count arguments
+func findMethod(manifest *ContractManifest, name string, count int) (*ABIMethod, error) {
+	var counts []string
+	for i, method := range manifest.ABI.Methods {
+		if method.Name != name {
+			continue
+		}
+		if len(method.Parameters) == count {
+			return &manifest.ABI.Methods[i], nil
+		}
+		counts = append(counts, strconv.Itoa(len(method.Parameters)))
+	}
+	if len(counts) == 0 {
+		return nil, fmt.Errorf("contract %s has no method %s", manifest.Name, name)
+	}
+	return nil, fmt.Errorf("%s takes %s arguments, got %d", name, strings.Join(counts, " or "), count)
+}
+
+// printExecution writes the outcome of running method
+func printExecution(w io.Writer, method *ABIMethod, state, exception string, gas Datoshi, stack []RPCStackItem, notifications []RPCNotification) {
+	fmt.Fprintf(w, "State:       %s\n", state)
+	fmt.Fprintf(w, "Gas:         %s\n", gas)
+	if exception != "" {
+		fmt.Fprintf(w, "Exception:   %s\n", exception)
+	}
+	for _, result := range stack {
+		item, err := DecodeRPCStackItem(result)
+		if err != nil {
+			fmt.Fprintf(w, "Result:      %s (%v)\n", result.Type, err)
+			continue
+		}
+		fmt.Fprintf(w, "Result:      %s\n", FormatStackItem(item, method.ReturnType))
+	}
+	for _, notification := range notifications {
+		state, err := DecodeRPCStackItem(notification.State)
+		text := notification.State.Type
+		if err == nil {
+			text = formatAnyItem(state)
+		}
+		fmt.Fprintf(w, "Event:       %s %s %s\n", notification.Contract, notification.EventName, text)
+	}
+}
+
+// RunInvokeCommand runs "invoke" with the given arguments and returns the
+// process exit code
+func RunInvokeCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("invoke", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	endpoint := flags.String("rpc", "", "RPC endpoint of the node")
+	wif := flags.String("wif", "", "private key of the invoking account in WIF")
+	wallet := flags.String("wallet", "", "NEP-6 wallet holding the invoking account")
+	address := flags.String("account", "", "address of the wallet account, the default one if empty")
+	password := flags.String("password", "", "wallet password, $"+PasswordVariable+" if empty")
+	send := flags.Bool("send", false, "sign and broadcast the invocation instead of running it without persisting it")
+	timeout := flags.Duration("timeout", defaultTransactTimeout, "how long to wait for a sent transaction to be persisted")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: invoke -rpc URL [flags] contract method [argument ...]")
+		fmt.Fprintln(stderr, "A test invocation needs a key only for the contract to see its witness.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *endpoint == "" || flags.NArg() < 2 {
+		flags.Usage()
+		return exitUsage
+	}
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "invoke: %v\n", err)
+		return exitFailed
+	}
+
+	hash, err := parseAccount(flags.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	var account *Account
+	if *send || *wif != "" || *wallet != "" {
+		if account, err = loadAccount(*wif, *wallet, *address, *password); err != nil {
+			return fail(err)
+		}
+	}
+	client := NewRPCClient(*endpoint)
+	contract, err := client.GetContractState(hash)
+	if err != nil {
+		return fail(err)
+	}
+	name, values := flags.Arg(1), flags.Args()[2:]
+	method, err := findMethod(&contract.Manifest, name, len(values))
+	if err != nil {
+		return fail(err)
+	}
+	parameters := make([]ContractParameter, len(values))
+	for i, value := range values {
+		if parameters[i], err = ParseContractParameter(method.Parameters[i].Type, value); err != nil {
+			return fail(fmt.Errorf("argument %s: %w", method.Parameters[i].Name, err))
+		}
+	}
+
+	if !*send {
+		var signers []TransactionSigner
+		if account != nil {
+			signers = []TransactionSigner{{Account: account.ScriptHash(), Scopes: WitnessCalledByEntry}}
+		}
+		result, err := client.InvokeFunction(hash, name, parameters, signers)
+		if err != nil {
+			return fail(err)
+		}
+		printExecution(stdout, method, result.State, result.Exception, result.GasConsumed, result.Stack, result.Notifications)
+		if result.State != vmStateHalt {
+			return exitFailed
+		}
+		return exitOK
+	}
+
+	items := make([]NeoVMStackItem, len(parameters))
+	for i, parameter := range parameters {
+		items[i] = parameter.StackItem()
+	}
+	script, err := ContractCallScript(hash, name, items)
+	if err != nil {
+		return fail(err)
+	}
+	result, err := client.Transact(account, script, TransactOptions{Timeout: *timeout})
+	if result != nil {
+		fmt.Fprintf(stdout, "Transaction: %s\n", result.Hash)
+		if execution := result.Execution; execution != nil {
+			printExecution(stdout, method, execution.VMState, execution.Exception, execution.GasConsumed, execution.Stack, execution.Notifications)
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
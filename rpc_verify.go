@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source verification.
+//
+// The verify command checks that sources compile to a deployed contract,
+// so explorers can show them as its verified source. The sources and the
+// compiler settings are declared as a standard JSON input document, the
+// one --standard-json compiles; the contract is fetched from a node:
+//
+//	neo-yulc verify -rpc URL -input token.json 0x1234...cdef
+//
+// Only what the sources determine is compared. The NEF files are compared
+// byte for byte with their metadata canonicalized: the compiler name and
+// source URL are cleared and the checksum recomputed, which leaves the
+// method tokens and the script. The manifests are compared field by field
+// as JSON, with empty lists and objects dropped; the name, groups and
+// extra are chosen at deployment and are ignored.
+
+// Call flags by name, as nodes write those of method tokens
+var callFlagNames = map[string]byte{
+	"None":        0,
+	"ReadStates":  0x01,
+	"WriteStates": 0x02,
+	"AllowCall":   0x04,
+	"AllowNotify": 0x08,
+	"States":      0x03,
+	"ReadOnly":    0x05,
+	"All":         0x0F,
+}
+
+// Manifest fields chosen at deployment rather than by the sources
+var deploymentManifestFields = map[string]bool{"name": true, "groups": true, "extra": true}
+
+// NEFFile returns the NEF file of the contract
+func (s *ContractState) NEFFile() (*NEFFile, error) {
+	file := &NEFFile{Compiler: s.NEF.Compiler, Source: s.NEF.Source, Script: s.NEF.Script, Checksum: s.NEF.Checksum}
+	for _, token := range s.NEF.Tokens {
+		hash, err := ParseUint160(token.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("method token %s: %w", token.Method, err)
+		}
+		flags, err := parseCallFlags(token.CallFlags)
+		if err != nil {
+			return nil, fmt.Errorf("method token %s: %w", token.Method, err)
+		}
+		method := MethodToken{Method: token.Method, ParametersCount: token.ParamCount, HasReturnValue: token.HasReturnValue, CallFlags: flags}
+		copy(method.Hash[:], scriptOrder(hash))
+		file.Tokens = append(file.Tokens, method)
+	}
+	return file, nil
+}
+
+// parseCallFlags parses call flags written as a number or as names joined
+// by commas
+func parseCallFlags(raw json.RawMessage) (byte, error) {
+	var number byte
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return number, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return 0, fmt.Errorf("invalid call flags %s", raw)
+	}
+	var flags byte
+	for _, name := range strings.Split(text, ",") {
+		flag, ok := callFlagNames[strings.TrimSpace(name)]
+		if !ok {
+			return 0, fmt.Errorf("unknown call flag %q", name)
+		}
+		flags |= flag
+	}
+	return flags, nil
+}
+
+// CanonicalNEF serializes file without its compiler name and source URL
+func CanonicalNEF(file *NEFFile) []byte {
+	canonical := *file
+	canonical.Compiler, canonical.Source = "", ""
+	return encodeNEF(&canonical)
+}
+
+// canonicalManifest returns the JSON of the fields of manifest the sources
+// determine, by name
+func canonicalManifest(manifest *ContractManifest) (map[string]string, error) {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	canonical := make(map[string]string)
+	for name, value := range fields {
+		if deploymentManifestFields[name] {
+			continue
+		}
+		text, _ := json.Marshal(dropEmpty(value))
+		canonical[name] = string(text)
+	}
+	return canonical, nil
+}
+
+// dropEmpty returns a JSON value without the empty lists and objects in
+// it, and nil when nothing is left of it
+func dropEmpty(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if v[key] = dropEmpty(field); v[key] == nil {
+				delete(v, key)
+			}
+		}
+		if len(v) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		for i := range v {
+			v[i] = dropEmpty(v[i])
+		}
+	}
+	return value
+}
+
+// VerifyContract compares a compiled NEF file and manifest with a deployed
+// contract and returns the differences, none when they match
+func VerifyContract(deployed *ContractState, nef []byte, manifest *ContractManifest) ([]string, error) {
+	compiled, err := DecodeNEF(nef)
+	if err != nil {
+		return nil, fmt.Errorf("compiled NEF: %w", err)
+	}
+	onChain, err := deployed.NEFFile()
+	if err != nil {
+		return nil, fmt.Errorf("deployed NEF: %w", err)
+	}
+
+	var differences []string
+	if !bytes.Equal(CanonicalNEF(compiled), CanonicalNEF(onChain)) {
+		if !tokensEqual(compiled.Tokens, onChain.Tokens) {
+			differences = append(differences, fmt.Sprintf("method tokens: compiled %d, deployed %d differ", len(compiled.Tokens), len(onChain.Tokens)))
+		}
+		if difference := scriptDifference(compiled.Script, onChain.Script); difference != "" {
+			differences = append(differences, difference)
+		}
+	}
+
+	want, err := canonicalManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	got, err := canonicalManifest(&deployed.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	var fields []string
+	for name := range want {
+		fields = append(fields, name)
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	for _, name := range fields {
+		if want[name] != got[name] {
+			differences = append(differences, fmt.Sprintf("manifest %s: compiled %s, deployed %s", name, want[name], got[name]))
+		}
+	}
+	return differences, nil
+}
+
+// tokensEqual reports whether two lists of method tokens are the same
+func tokensEqual(a, b []MethodToken) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptDifference describes where script differs from deployed, naming
+// the instructions there
+func scriptDifference(script, deployed []byte) string {
+	if bytes.Equal(script, deployed) {
+		return ""
+	}
+	offset := 0
+	for offset < len(script) && offset < len(deployed) && script[offset] == deployed[offset] {
+		offset++
+	}
+	text := fmt.Sprintf("script: compiled %d bytes, deployed %d, first differing at offset %d", len(script), len(deployed), offset)
+	compiled, deployedAt := instructionAt(script, offset), instructionAt(deployed, offset)
+	if compiled != "" && deployedAt != "" {
+		text += fmt.Sprintf(" (compiled %s, deployed %s)", compiled, deployedAt)
+	}
+	return text
+}
+
+// instructionAt returns the mnemonic of the instruction of script holding
+// offset, empty when the script does not decode
+func instructionAt(script []byte, offset int) string {
+	instructions, err := DisassembleScript(script)
+	if err != nil {
+		return ""
+	}
+	start := 0
+	for _, instr := range instructions {
+		if offset < start+instr.Size {
+			return OpcodeMnemonic(instr.Opcode)
+		}
+		start += instr.Size
+	}
+	return "the end"
+}
+
+// compileDeclared compiles a standard JSON input for its NEF files and
+// manifests and returns the contract named "file:Name", or the only one
+func compileDeclared(input []byte, name string) (*StandardJSONContract, string, error) {
+	var request StandardJSONInput
+	if err := json.Unmarshal(input, &request); err != nil {
+		return nil, "", fmt.Errorf("invalid standard JSON input: %w", err)
+	}
+	request.Settings.OutputSelection = map[string]map[string][]string{"*": {"*": {"neo.nef", "neo.manifest"}}}
+	input, _ = json.Marshal(request)
+	output := CompileStandardJSON(input)
+	var problems []string
+	for _, e := range output.Errors {
+		if e.Severity == "error" {
+			problems = append(problems, e.FormattedMessage)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, "", errors.New(strings.Join(problems, "\n"))
+	}
+
+	var names []string
+	for file, contracts := range output.Contracts {
+		for contract := range contracts {
+			names = append(names, file+":"+contract)
+		}
+	}
+	sort.Strings(names)
+	switch {
+	case name == "" && len(names) == 1:
+		name = names[0]
+	case name == "":
+		return nil, "", fmt.Errorf("the input has %d contracts; choose one of %s", len(names), strings.Join(names, ", "))
+	}
+	file, contract, _ := strings.Cut(name, ":")
+	if compiled := output.Contracts[file][contract]; compiled != nil && compiled.Neo != nil {
+		return compiled, name, nil
+	}
+	return nil, "", fmt.Errorf("the input has no contract %s; it has %s", name, strings.Join(names, ", "))
+}
+
+// RunVerifyCommand runs "verify" with the given arguments and returns the
+// process exit code
+func RunVerifyCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	endpoint := flags.String("rpc", "", "RPC endpoint of the node")
+	inputPath := flags.String("input", "", "standard JSON input declaring the sources and compiler settings")
+	name := flags.String("contract", "", "contract of the input to verify, file:Name, when it has several")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: verify -rpc URL -input input.json [-contract file:Name] contract")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *endpoint == "" || *inputPath == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "verify: %v\n", err)
+		return exitFailed
+	}
+
+	hash, err := parseAccount(flags.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	input, err := os.ReadFile(*inputPath)
+	if err != nil {
+		return fail(err)
+	}
+	compiled, source, err := compileDeclared(input, *name)
+	if err != nil {
+		return fail(err)
+	}
+	nef, err := base64.StdEncoding.DecodeString(compiled.Neo.NEF)
+	if err != nil {
+		return fail(err)
+	}
+	deployed, err := NewRPCClient(*endpoint).GetContractState(hash)
+	if err != nil {
+		return fail(err)
+	}
+	differences, err := VerifyContract(deployed, nef, compiled.Neo.Manifest)
+	if err != nil {
+		return fail(err)
+	}
+
+	fmt.Fprintf(stdout, "Contract:    %s\n", hash)
+	fmt.Fprintf(stdout, "Source:      %s\n", source)
+	fmt.Fprintf(stdout, "Compiler:    %s, deployed by %s\n", NEFCompilerName, strconv.Quote(deployed.NEF.Compiler))
+	if len(differences) > 0 {
+		fmt.Fprintln(stdout, "Not verified:")
+		for _, difference := range differences {
+			fmt.Fprintf(stdout, "  %s\n", difference)
+		}
+		return exitFailed
+	}
+	fmt.Fprintln(stdout, "Verified: the deployed script, method tokens and manifest match the source")
+	return exitOK
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Sandboxed execution limits for the Yul interpreter. The defaults mirror the
+// limits a Neo node enforces at runtime so that tests and the fuzzer hit a
+// violation during development instead of a FAULT on chain.
+
+// ErrSandboxLimitExceeded is matched by every LimitError
+var ErrSandboxLimitExceeded = errors.New("sandbox limit exceeded")
+
+// LimitKind names an enforced limit
+type LimitKind string
+
+const (
+	LimitFuel             LimitKind = "fuel"
+	LimitItemSize         LimitKind = "item size"
+	LimitNotifications    LimitKind = "notification count"
+	LimitNotificationSize LimitKind = "notification size"
+	LimitStorageWrites    LimitKind = "storage writes"
+)
+
+// Neo N3 runtime limits
+const (
+	NeoMaxItemSize          = 2 * math.MaxUint16 // ExecutionEngineLimits.MaxItemSize, ushort.MaxValue * 2
+	NeoMaxNotificationSize  = 1024               // ApplicationEngine.MaxNotificationSize
+	NeoMaxNotificationCount = 512                // ApplicationEngine.MaxNotificationCount
+)
+
+// maxUnlimitedMemory caps memory when no item size limit is configured
+const maxUnlimitedMemory = 1 << 32
+
+// SandboxLimits are the budgets enforced while interpreting; a zero field
+// means the corresponding resource is unlimited
+type SandboxLimits struct {
+	Fuel                int // Evaluation steps
+	MaxItemSize         int // Largest memory area or log payload in bytes
+	MaxNotifications    int // Events emitted by log0..log4
+	MaxNotificationSize int // Payload bytes of a single event
+	MaxStorageWrites    int // sstore operations
+}
+
+// NeoSandboxLimits returns the limits of a Neo N3 node. Fuel and storage
+// writes are bounded on chain by GAS rather than a count, so callers set them
+// to suit their tests.
+func NeoSandboxLimits() *SandboxLimits {
+	return &SandboxLimits{
+		MaxItemSize:         NeoMaxItemSize,
+		MaxNotifications:    NeoMaxNotificationCount,
+		MaxNotificationSize: NeoMaxNotificationSize,
+	}
+}
+
+// LimitError reports which limit a run exceeded
+type LimitError struct {
+	Limit LimitKind
+	Value int // Value that broke the limit
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded: %d > %d", e.Limit, e.Value, e.Max)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrSandboxLimitExceeded
+}
+
+func (l *SandboxLimits) max(kind LimitKind) int {
+	switch kind {
+	case LimitFuel:
+		return l.Fuel
+	case LimitItemSize:
+		return l.MaxItemSize
+	case LimitNotifications:
+		return l.MaxNotifications
+	case LimitNotificationSize:
+		return l.MaxNotificationSize
+	case LimitStorageWrites:
+		return l.MaxStorageWrites
+	}
+	return 0
+}
+
+// checkLimit fails when value exceeds the configured limit of kind
+func (in *YulInterpreter) checkLimit(kind LimitKind, value int) error {
+	if in.Limits == nil {
+		return nil
+	}
+	if max := in.Limits.max(kind); max > 0 && value > max {
+		return &LimitError{Limit: kind, Value: value, Max: max}
+	}
+	return nil
+}
+
+// YulNotification is an event emitted by log0..log4
+type YulNotification struct {
+	Topics []*big.Int
+	Data   []byte
+}
+
+// evalEffectBuiltin runs a built-in that reads or changes interpreter state
+func (in *YulInterpreter) evalEffectBuiltin(name string, args []*big.Int) ([]*big.Int, error) {
+	arity := map[string]int{
+		"sload": 1, "sstore": 2, "tload": 1, "tstore": 2, "mload": 1, "mstore": 2, "mstore8": 2, "msize": 0,
+		"log0": 2, "log1": 3, "log2": 4, "log3": 5, "log4": 6,
+	}
+	expected, ok := arity[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported built-in function: %s", name)
+	}
+	if len(args) != expected {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", name, expected, len(args))
+	}
+
+	switch name {
+	case "sload":
+		return []*big.Int{in.loadWord(args[0])}, nil
+	case "sstore":
+		return nil, in.storeWord(args[0], args[1])
+	case "tload":
+		if value, ok := in.Transient[storageKey(args[0])]; ok {
+			return []*big.Int{value}, nil
+		}
+		return []*big.Int{big.NewInt(0)}, nil
+	case "tstore":
+		in.Transient[storageKey(args[0])] = args[1]
+		return nil, nil
+
+	case "mload":
+		data, err := in.memoryRange(args[0], big.NewInt(32))
+		if err != nil {
+			return nil, err
+		}
+		return []*big.Int{new(big.Int).SetBytes(data)}, nil
+	case "mstore":
+		data, err := in.memoryRange(args[0], big.NewInt(32))
+		if err != nil {
+			return nil, err
+		}
+		args[1].FillBytes(data)
+		return nil, nil
+	case "mstore8":
+		data, err := in.memoryRange(args[0], big.NewInt(1))
+		if err != nil {
+			return nil, err
+		}
+		data[0] = byte(args[1].Uint64())
+		return nil, nil
+	case "msize":
+		return []*big.Int{big.NewInt(int64(len(in.Memory)))}, nil
+	}
+
+	// log0..log4(offset, size, topics...)
+	data, err := in.memoryRange(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := in.checkLimit(LimitNotificationSize, len(data)); err != nil {
+		return nil, err
+	}
+	if err := in.checkLimit(LimitNotifications, len(in.Notifications)+1); err != nil {
+		return nil, err
+	}
+	in.Notifications = append(in.Notifications, YulNotification{
+		Topics: append([]*big.Int(nil), args[2:]...),
+		Data:   append([]byte(nil), data...),
+	})
+	return nil, nil
+}
+
+// memoryRange returns memory[offset:offset+size], expanding memory in 32-byte
+// words as the EVM does. The slice aliases interpreter memory.
+func (in *YulInterpreter) memoryRange(offset, size *big.Int) ([]byte, error) {
+	if size.Sign() == 0 {
+		return nil, nil
+	}
+
+	limit := maxUnlimitedMemory
+	if in.Limits != nil && in.Limits.MaxItemSize > 0 {
+		limit = in.Limits.MaxItemSize
+	}
+
+	end := new(big.Int).Add(offset, size)
+	if !end.IsInt64() || end.Int64() > int64(limit) {
+		value := limit + 1
+		if end.IsInt64() {
+			value = int(end.Int64())
+		}
+		return nil, &LimitError{Limit: LimitItemSize, Value: value, Max: limit}
+	}
+
+	needed := int((end.Int64() + 31) / 32 * 32)
+	if needed > len(in.Memory) {
+		in.Memory = append(in.Memory, make([]byte, needed-len(in.Memory))...)
+	}
+	start := int(offset.Int64())
+	return in.Memory[start : start+int(size.Int64())], nil
+}
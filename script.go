@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Script assembly.
+//
+// The contract script is the byte encoding of the runtime instructions:
+// each opcode, the length prefix of a PUSHDATA operand, then the operand.
+// Instructions keep SYSCALL operands as interop service names, which
+// listings, pricing and the tests read; the script carries their 4-byte
+// interop IDs from the interop registry, and DisassembleScript maps them
+// back. resolveLabels computed jump offsets, method offsets and handler
+// frames from the instruction sizes, so every instruction must encode to
+// exactly its Size.
+
+// Script assembles the runtime into the contract script
+func (c *NeoContract) Script() ([]byte, error) {
+	return assembleScript(c.Runtime)
+}
+
+// assembleScript concatenates the encodings of instructions
+func assembleScript(instructions []NeoInstruction) ([]byte, error) {
+	var script []byte
+	for i, instr := range instructions {
+		info, ok := LookupOpcode(instr.Opcode)
+		if !ok {
+			return nil, fmt.Errorf("instruction %d: unknown opcode 0x%02X", i, byte(instr.Opcode))
+		}
+		start := len(script)
+		operand := instr.Operand
+		if instr.Opcode == SYSCALL {
+			service, ok := DefaultInteropRegistry().Lookup(string(instr.Operand))
+			if !ok {
+				return nil, fmt.Errorf("instruction %d: unknown interop service %q", i, instr.Operand)
+			}
+			operand = binary.LittleEndian.AppendUint32(nil, service.ID)
+		}
+		script = append(script, byte(instr.Opcode))
+		switch n := len(operand); info.SizePrefix {
+		case 0:
+			if n != info.OperandSize {
+				return nil, fmt.Errorf("instruction %d: %s takes %d operand bytes, got %d", i, info.Mnemonic, info.OperandSize, n)
+			}
+		case 1:
+			if n > 0xFF {
+				return nil, fmt.Errorf("instruction %d: %d bytes exceed %s", i, n, info.Mnemonic)
+			}
+			script = append(script, byte(n))
+		case 2:
+			if n > 0xFFFF {
+				return nil, fmt.Errorf("instruction %d: %d bytes exceed %s", i, n, info.Mnemonic)
+			}
+			script = binary.LittleEndian.AppendUint16(script, uint16(n))
+		case 4:
+			script = binary.LittleEndian.AppendUint32(script, uint32(n))
+		}
+		script = append(script, operand...)
+		if size := len(script) - start; size != instr.Size {
+			return nil, fmt.Errorf("instruction %d: %s encodes to %d bytes, not its size %d", i, info.Mnemonic, size, instr.Size)
+		}
+	}
+	return script, nil
+}
+
+// DisassembleScript decodes a contract script into instructions, naming
+// the interop service of each SYSCALL
+func DisassembleScript(script []byte) ([]NeoInstruction, error) {
+	var instructions []NeoInstruction
+	for offset := 0; offset < len(script); {
+		op := NeoOpcode(script[offset])
+		info, ok := LookupOpcode(op)
+		if !ok {
+			return nil, fmt.Errorf("offset %d: unknown opcode 0x%02X", offset, byte(op))
+		}
+		start, n := offset+1+info.SizePrefix, info.OperandSize
+		if start > len(script) {
+			return nil, fmt.Errorf("offset %d: %s is truncated", offset, info.Mnemonic)
+		}
+		switch prefix := script[offset+1 : start]; info.SizePrefix {
+		case 1:
+			n = int(prefix[0])
+		case 2:
+			n = int(binary.LittleEndian.Uint16(prefix))
+		case 4:
+			n = int(binary.LittleEndian.Uint32(prefix))
+		}
+		if n > len(script)-start {
+			return nil, fmt.Errorf("offset %d: %s is truncated", offset, info.Mnemonic)
+		}
+		instr := newTableInstruction(op)
+		instr.Operand = script[start : start+n]
+		if op == SYSCALL {
+			service, ok := DefaultInteropRegistry().LookupID(binary.LittleEndian.Uint32(instr.Operand))
+			if !ok {
+				return nil, fmt.Errorf("offset %d: unknown interop service %x", offset, instr.Operand)
+			}
+			instr = NewSyscallInstruction(service.Name)
+		}
+		instr.Size = start + n - offset
+		instructions = append(instructions, instr)
+		offset += instr.Size
+	}
+	return instructions, nil
+}
+
+// VerifyScript checks script the way a node checks a contract script on
+// deployment: it decodes, every jump, CALL, TRY, ENDTRY and PUSHA targets
+// an instruction, and NEWARRAY_T, ISTYPE and CONVERT name a type, only
+// NEWARRAY_T Any
+func VerifyScript(script []byte) error {
+	instructions, err := DisassembleScript(script)
+	if err != nil {
+		return err
+	}
+	offsets := make([]int, len(instructions))
+	boundaries := make(map[int]bool)
+	offset := 0
+	for i, instr := range instructions {
+		offsets[i], boundaries[offset] = offset, true
+		offset += instr.Size
+	}
+	for i, instr := range instructions {
+		switch {
+		case isJump(instr.Opcode) || instr.Opcode == PUSHA:
+			width := len(instr.Operand) / jumpOffsets(instr.Opcode)
+			for j := 0; j < len(instr.Operand); j += width {
+				relative := decodeJumpOffset(instr.Operand[j : j+width])
+				if (instr.Opcode == TRY || instr.Opcode == TRY_L) && relative == 0 {
+					continue // No catch or finally block
+				}
+				if target := offsets[i] + relative; !boundaries[target] {
+					return fmt.Errorf("offset %d: %s targets offset %d, which is not an instruction", offsets[i], OpcodeMnemonic(instr.Opcode), target)
+				}
+			}
+		case instr.Opcode == NEWARRAY_T || instr.Opcode == ISTYPE || instr.Opcode == CONVERT:
+			target := NeoVMType(instr.Operand[0])
+			if typeNames[target] == "" || (instr.Opcode != NEWARRAY_T && target == AnyType) {
+				return fmt.Errorf("offset %d: %s of unknown type 0x%02X", offsets[i], OpcodeMnemonic(instr.Opcode), byte(target))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Solidity front end.
+//
+// SolidityFrontend goes from Solidity to NeoVM in one step: it asks solc
+// for the Yul IR of every contract, the output of solc --ir, through solc's
+// standard JSON interface so that its diagnostics arrive with locations,
+// and compiles each IR with this compiler. Interfaces and abstract
+// contracts have no IR and are skipped.
+//
+// solc annotates the IR with the Solidity ranges it was generated from:
+// "/// @use-src 0:\"Token.sol\"" names the sources of an object and
+// "/// @src 0:120:340" starts the code of a range. Diagnostics of this
+// compiler are located at the Solidity range in force at their IR line,
+// so solc's and ours read the same.
+
+// DefaultSolc is the solc executable used when none is configured
+const DefaultSolc = "solc"
+
+// SolidityFrontend compiles Solidity sources through solc
+type SolidityFrontend struct {
+	Solc   string // solc executable, DefaultSolc on the PATH when empty
+	Config CompilerConfig
+
+	// Run runs solc --standard-json on input and returns its output; nil
+	// runs the Solc executable
+	Run func(input []byte) ([]byte, error)
+}
+
+// SolidityContract is a contract of the Solidity sources compiled to NeoVM
+type SolidityContract struct {
+	File   string // Solidity source declaring the contract
+	Name   string
+	IR     string // Yul IR from solc
+	Result *CompilationResult
+	Err    error // Compilation error of the IR, nil on success
+}
+
+// SolidityResult is the outcome of compiling Solidity sources
+type SolidityResult struct {
+	Contracts   []SolidityContract
+	Diagnostics []StandardJSONError // solc's diagnostics, then those of every contract
+}
+
+// HasErrors reports whether solc or the compilation of a contract failed
+func (r *SolidityResult) HasErrors() bool {
+	for _, d := range r.Diagnostics {
+		if d.Severity == "error" {
+			return true
+		}
+	}
+	return false
+}
+
+// solcInput asks solc for the IR of every contract. solc rejects settings
+// it does not know, so this is not a StandardJSONInput.
+type solcInput struct {
+	Language string                        `json:"language"`
+	Sources  map[string]StandardJSONSource `json:"sources"`
+	Settings struct {
+		OutputSelection map[string]map[string][]string `json:"outputSelection"`
+	} `json:"settings"`
+}
+
+// solcOutput is the part of solc's standard JSON output the front end reads
+type solcOutput struct {
+	Errors    []StandardJSONError `json:"errors"`
+	Contracts map[string]map[string]struct {
+		IR string `json:"ir"`
+	} `json:"contracts"`
+}
+
+// CompileFiles compiles the Solidity files at paths
+func (f *SolidityFrontend) CompileFiles(paths []string) (*SolidityResult, error) {
+	sources := make(map[string]string, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		sources[path] = string(data)
+	}
+	return f.Compile(sources)
+}
+
+// Compile compiles Solidity sources given by file name
+func (f *SolidityFrontend) Compile(sources map[string]string) (*SolidityResult, error) {
+	input := solcInput{Language: "Solidity", Sources: make(map[string]StandardJSONSource, len(sources))}
+	input.Settings.OutputSelection = map[string]map[string][]string{"*": {"*": {"ir"}}}
+	for name, content := range sources {
+		content := content
+		input.Sources[name] = StandardJSONSource{Content: &content}
+	}
+	request, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	response, err := f.run(request)
+	if err != nil {
+		return nil, err
+	}
+	var output solcOutput
+	if err := json.Unmarshal(response, &output); err != nil {
+		return nil, fmt.Errorf("reading solc output: %w", err)
+	}
+
+	result := &SolidityResult{Diagnostics: output.Errors}
+	if result.HasErrors() {
+		return result, nil
+	}
+	files := make([]string, 0, len(output.Contracts))
+	for file := range output.Contracts {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		names := make([]string, 0, len(output.Contracts[file]))
+		for name := range output.Contracts[file] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ir := output.Contracts[file][name].IR
+			if strings.TrimSpace(ir) == "" {
+				continue
+			}
+			contract := SolidityContract{File: file, Name: name, IR: ir}
+			contract.Result, contract.Err = NewYulToNeoCompiler(f.Config).Compile(ir)
+			result.Diagnostics = append(result.Diagnostics, irDiagnostics(contract, sources)...)
+			result.Contracts = append(result.Contracts, contract)
+		}
+	}
+	return result, nil
+}
+
+// run runs solc on a standard JSON input
+func (f *SolidityFrontend) run(input []byte) ([]byte, error) {
+	if f.Run != nil {
+		return f.Run(input)
+	}
+	solc := f.Solc
+	if solc == "" {
+		solc = DefaultSolc
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(solc, "--standard-json")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(input), &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("%s not found: install solc or name it with -solc", solc)
+		}
+		return nil, fmt.Errorf("running %s: %v: %s", solc, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+var (
+	useSrcPattern = regexp.MustCompile(`@use-src\s+(.*)`)
+	useSrcEntry   = regexp.MustCompile(`(\d+):"((?:[^"\\]|\\.)*)"`)
+	srcPattern    = regexp.MustCompile(`@src\s+(-?\d+):(-?\d+):(-?\d+)`)
+)
+
+// irSourceMap locates lines of solc's IR in the Solidity sources
+type irSourceMap struct {
+	files  map[int]string               // Source index to file name
+	ranges map[int]StandardJSONLocation // IR line to the range in force
+}
+
+// newIRSourceMap reads the @use-src and @src annotations of ir
+func newIRSourceMap(ir string) *irSourceMap {
+	m := &irSourceMap{files: make(map[int]string), ranges: make(map[int]StandardJSONLocation)}
+	var current *StandardJSONLocation
+	for i, line := range strings.Split(ir, "\n") {
+		if use := useSrcPattern.FindStringSubmatch(line); use != nil {
+			for _, entry := range useSrcEntry.FindAllStringSubmatch(use[1], -1) {
+				index, _ := strconv.Atoi(entry[1])
+				if name, err := strconv.Unquote(`"` + entry[2] + `"`); err == nil {
+					m.files[index] = name
+				}
+			}
+		}
+		if src := srcPattern.FindStringSubmatch(line); src != nil {
+			index, _ := strconv.Atoi(src[1])
+			start, _ := strconv.Atoi(src[2])
+			end, _ := strconv.Atoi(src[3])
+			current = nil
+			if name, ok := m.files[index]; ok && start >= 0 {
+				current = &StandardJSONLocation{File: name, Start: start, End: end}
+			}
+		}
+		if current != nil {
+			m.ranges[i+1] = *current
+		}
+	}
+	return m
+}
+
+// irDiagnostics converts the diagnostics of compiling a contract's IR,
+// located in the Solidity source when the IR says where they come from
+func irDiagnostics(contract SolidityContract, sources map[string]string) []StandardJSONError {
+	m := newIRSourceMap(contract.IR)
+	var diagnostics []StandardJSONError
+	add := func(kind, severity, code, message string, line int) {
+		location := &StandardJSONLocation{File: contract.File}
+		if r, ok := m.ranges[line]; ok {
+			location = &r
+		}
+		formatted := fmt.Sprintf("%s: %s: %s", location.File, kind, message)
+		if source, ok := sources[location.File]; ok && location.Start > 0 {
+			line, column := sourceLineColumn(source, location.Start)
+			formatted = fmt.Sprintf("%s:%d:%d: %s: %s", location.File, line, column, kind, message)
+		}
+		diagnostics = append(diagnostics, StandardJSONError{
+			SourceLocation:   location,
+			Type:             kind,
+			Component:        "neo",
+			Severity:         severity,
+			ErrorCode:        code,
+			Message:          fmt.Sprintf("%s: %s", contract.Name, message),
+			FormattedMessage: formatted,
+		})
+	}
+	if result := contract.Result; result != nil {
+		for _, warning := range result.Warnings {
+			add("Warning", "warning", warning.Diagnostic().Code, warning.Message, warning.Line)
+		}
+		for _, compilerErr := range result.Errors {
+			add("CompilerError", "error", compilerErr.Diagnostic().Code, compilerErr.Message, compilerErr.Line)
+		}
+	}
+	if contract.Err != nil && (contract.Result == nil || len(contract.Result.Errors) == 0) {
+		add("CompilerError", "error", CodeUnknown, contract.Err.Error(), 0)
+	}
+	return diagnostics
+}
+
+// sourceLineColumn returns the 1-based line and column of a byte offset
+func sourceLineColumn(source string, offset int) (int, int) {
+	if offset > len(source) {
+		offset = len(source)
+	}
+	before := source[:offset]
+	line := strings.Count(before, "\n") + 1
+	return line, offset - strings.LastIndexByte(before, '\n')
+}
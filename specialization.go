@@ -0,0 +1,442 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// FunctionSpecializationPass propagates constants across function
+// boundaries. Calls to small functions that pass literal arguments are
+// redirected to a clone of the function with those parameters replaced by
+// the literals, after which the clone is folded: pure built-ins over literals
+// are evaluated and branches on constant conditions are resolved, e.g.
+//
+//	function require_helper(cond, code) { if iszero(cond) { revert(0, code) } }
+//	require_helper(1, 4)
+//
+// calls an empty clone require_helper_spec1(). A clone is only kept when
+// folding simplified it and the growth fits the OptimizationProfile budget.
+type FunctionSpecializationPass struct {
+	profile       *OptimizationProfile
+	MaxStatements int // Largest function body, in statements, considered small
+	MaxClones     int // Most clones created per function
+	Specialized   int // Call sites redirected by the last Apply
+	Clones        map[string][]string
+}
+
+// Default limits for function specialization
+const (
+	defaultSpecializationMaxStatements = 16
+	defaultSpecializationMaxClones     = 4
+)
+
+// specialization is one clone of a function for a set of constant arguments
+type specialization struct {
+	def      *YulFunctionDef
+	key      string
+	consts   map[int]*YulLiteral // Parameter index -> literal argument
+	calls    int
+	clone    *YulFunctionDef
+	accepted bool
+}
+
+// NewFunctionSpecializationPass creates the pass driven by the given profile
+func NewFunctionSpecializationPass(profile *OptimizationProfile) *FunctionSpecializationPass {
+	if profile == nil {
+		profile = DefaultOptimizationProfile()
+	}
+	return &FunctionSpecializationPass{
+		profile:       profile,
+		MaxStatements: defaultSpecializationMaxStatements,
+		MaxClones:     defaultSpecializationMaxClones,
+	}
+}
+
+func (p *FunctionSpecializationPass) Name() string       { return "function_specialization" }
+func (p *FunctionSpecializationPass) RequiredLevel() int { return 2 }
+
+// Apply clones functions for constant arguments and redirects their callers
+func (p *FunctionSpecializationPass) Apply(ast *YulAST) (*YulAST, error) {
+	p.Specialized = 0
+	p.Clones = make(map[string][]string)
+
+	userFunctions := make(map[string][]*YulFunctionDef)
+	forEachFunctionDef(ast, func(fn *YulFunctionDef) {
+		userFunctions[fn.Name] = append(userFunctions[fn.Name], fn)
+	})
+
+	candidates := make(map[string]*YulFunctionDef)
+	for name, defs := range userFunctions {
+		if len(defs) == 1 && p.specializable(defs[0]) {
+			candidates[name] = defs[0]
+		}
+	}
+	if len(candidates) == 0 {
+		return ast, nil
+	}
+
+	// Collect call sites with literal arguments in source order
+	var order []*specialization
+	byKey := make(map[string]*specialization)
+	forEachExpression(ast, func(expr YulExpression) YulExpression {
+		if spec := p.lookup(expr, candidates, byKey); spec != nil {
+			spec.calls++
+		} else if spec := p.newSpecialization(expr, candidates); spec != nil {
+			byKey[spec.key] = spec
+			order = append(order, spec)
+		}
+		return expr
+	})
+
+	names := usedNames(ast)
+	clones := make(map[*YulFunctionDef][]*YulFunctionDef)
+	currentSize := estimateASTSize(ast)
+	for _, spec := range order {
+		if len(clones[spec.def]) >= p.MaxClones {
+			continue
+		}
+		clone, folded := specializeFunction(spec.def, spec.consts)
+		if folded == 0 {
+			continue
+		}
+
+		growth := estimateBlockSize(clone.Body) + functionEpilogueBytes
+		for _, lit := range spec.consts {
+			growth -= estimateExpressionSize(lit) * spec.calls
+		}
+		if growth > p.profile.MaxInlineGrowth || currentSize+growth > p.profile.MaxScriptSize {
+			continue
+		}
+
+		clone.Name = uniqueName(fmt.Sprintf("%s_spec%d", spec.def.Name, len(clones[spec.def])+1), names)
+		spec.clone, spec.accepted = clone, true
+		clones[spec.def] = append(clones[spec.def], clone)
+		p.Clones[spec.def.Name] = append(p.Clones[spec.def.Name], clone.Name)
+		currentSize += growth
+	}
+	if len(clones) == 0 {
+		return ast, nil
+	}
+
+	forEachExpression(ast, func(expr YulExpression) YulExpression {
+		spec := p.lookup(expr, candidates, byKey)
+		if spec == nil || !spec.accepted {
+			return expr
+		}
+		call := expr.(*YulFunctionCall)
+		redirected := *call
+		redirected.FunctionName = YulIdentifier{Name: spec.clone.Name, Location: call.FunctionName.Location}
+		redirected.Arguments = nil
+		for i, arg := range call.Arguments {
+			if _, constant := spec.consts[i]; !constant {
+				redirected.Arguments = append(redirected.Arguments, arg)
+			}
+		}
+		p.Specialized++
+		return &redirected
+	})
+
+	insertClones(ast, clones)
+
+	// Drop originals whose every call site now uses a clone
+	calls := make(map[string]int)
+	forEachExpression(ast, func(expr YulExpression) YulExpression {
+		if call, ok := expr.(*YulFunctionCall); ok {
+			calls[call.FunctionName.Name]++
+		}
+		return expr
+	})
+	removeFunctionDefs(ast, func(fn *YulFunctionDef) bool {
+		return len(clones[fn]) > 0 && calls[fn.Name] == 0
+	})
+	return ast, nil
+}
+
+// specializable reports whether fn is small and never reassigns a parameter
+func (p *FunctionSpecializationPass) specializable(fn *YulFunctionDef) bool {
+	if len(fn.Parameters) == 0 || fn.Body == nil || countStatements(fn.Body) > p.MaxStatements {
+		return false
+	}
+	params := make(map[string]bool)
+	for _, param := range fn.Parameters {
+		params[param.Name] = true
+	}
+	ok := true
+	walkBlock(fn.Body, func(block *YulBlock) {
+		for _, stmt := range block.Statements {
+			switch s := stmt.(type) {
+			case *YulAssignment:
+				for _, name := range s.VariableNames {
+					if params[name] {
+						ok = false
+					}
+				}
+			case *YulFunctionDef:
+				// Clones would duplicate nested definitions
+				ok = false
+			}
+		}
+	})
+	return ok
+}
+
+// constantArguments returns the literal arguments of a call to a candidate
+// and the key identifying its specialization
+func constantArguments(call *YulFunctionCall) (map[int]*YulLiteral, string) {
+	consts := make(map[int]*YulLiteral)
+	var parts []string
+	for i, arg := range call.Arguments {
+		lit, ok := arg.(*YulLiteral)
+		if !ok {
+			continue
+		}
+		value, err := ParseYulLiteralValue(lit)
+		if err != nil {
+			continue
+		}
+		consts[i] = lit
+		parts = append(parts, fmt.Sprintf("%d=%s", i, caseKey(value)))
+	}
+	return consts, fmt.Sprintf("%s/%d(%s)", call.FunctionName.Name, len(call.Arguments), strings.Join(parts, ","))
+}
+
+// lookup returns the specialization a call belongs to, if already known
+func (p *FunctionSpecializationPass) lookup(expr YulExpression, candidates map[string]*YulFunctionDef, byKey map[string]*specialization) *specialization {
+	call, ok := expr.(*YulFunctionCall)
+	if !ok || candidates[call.FunctionName.Name] == nil {
+		return nil
+	}
+	_, key := constantArguments(call)
+	return byKey[key]
+}
+
+// newSpecialization starts a specialization for a call with literal arguments
+func (p *FunctionSpecializationPass) newSpecialization(expr YulExpression, candidates map[string]*YulFunctionDef) *specialization {
+	call, ok := expr.(*YulFunctionCall)
+	if !ok {
+		return nil
+	}
+	def := candidates[call.FunctionName.Name]
+	if def == nil || len(call.Arguments) != len(def.Parameters) {
+		return nil
+	}
+	consts, key := constantArguments(call)
+	if len(consts) == 0 {
+		return nil
+	}
+	return &specialization{def: def, key: key, consts: consts, calls: 1}
+}
+
+// specializeFunction clones fn with the constant parameters substituted and
+// folded, returning the clone and the number of simplifications made
+func specializeFunction(fn *YulFunctionDef, consts map[int]*YulLiteral) (*YulFunctionDef, int) {
+	clone := cloneStatement(fn).(*YulFunctionDef)
+
+	values := make(map[string]YulExpression)
+	var params []*YulTypedName
+	for i, param := range clone.Parameters {
+		if lit, constant := consts[i]; constant {
+			values[param.Name] = lit
+			continue
+		}
+		params = append(params, param)
+	}
+	clone.Parameters = params
+
+	walkBlock(clone.Body, func(block *YulBlock) {
+		for _, stmt := range block.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				*slot = rewriteExpression(*slot, func(expr YulExpression) YulExpression {
+					if id, ok := expr.(*YulIdentifier); ok {
+						if value, constant := values[id.Name]; constant {
+							return cloneExpression(value)
+						}
+					}
+					return expr
+				})
+			}
+		}
+	})
+
+	return clone, foldBlock(clone.Body)
+}
+
+// foldBlock evaluates pure built-ins over literals and resolves branches on
+// constant conditions in block and its nested blocks, returning the number
+// of simplifications
+func foldBlock(block *YulBlock) int {
+	if block == nil {
+		return 0
+	}
+	folded := 0
+	var statements []YulStatement
+	for _, stmt := range block.Statements {
+		for _, slot := range statementExpressions(stmt) {
+			*slot = rewriteExpression(*slot, func(expr YulExpression) YulExpression {
+				if value, ok := foldBuiltinCall(expr); ok {
+					folded++
+					return NewWordLiteral(value, expr.GetLocation())
+				}
+				return expr
+			})
+		}
+		for _, nested := range statementBlocks(stmt) {
+			folded += foldBlock(nested)
+		}
+
+		if taken, resolved := resolveBranch(stmt); resolved {
+			folded++
+			if taken != nil {
+				statements = append(statements, taken.Statements...)
+			}
+			continue
+		}
+		statements = append(statements, stmt)
+	}
+	block.Statements = statements
+	return folded
+}
+
+// foldBuiltinCall evaluates a pure built-in whose arguments are all literals
+func foldBuiltinCall(expr YulExpression) (*big.Int, bool) {
+	call, ok := expr.(*YulFunctionCall)
+	if !ok || !isPureBuiltin(call.FunctionName.Name) {
+		return nil, false
+	}
+	args, ok := literalArguments(call)
+	if !ok {
+		return nil, false
+	}
+	value, err := EvaluatePureBuiltin(call.FunctionName.Name, args)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// resolveBranch returns the block that runs in place of an if or switch on a
+// constant. Bodies declaring variables keep their scope and are not resolved.
+func resolveBranch(stmt YulStatement) (*YulBlock, bool) {
+	switch s := stmt.(type) {
+	case *YulIf:
+		condition, ok := constantValue(s.Condition)
+		if !ok {
+			return nil, false
+		}
+		if condition.Sign() == 0 {
+			return nil, true
+		}
+		return s.Body, !declaresVariables(s.Body)
+	case *YulSwitch:
+		value, ok := constantValue(s.Expression)
+		if !ok {
+			return nil, false
+		}
+		taken := s.Default
+		for _, c := range s.Cases {
+			caseValue, err := ParseYulLiteralValue(&c.Value)
+			if err != nil {
+				return nil, false
+			}
+			if caseValue.Cmp(value) == 0 {
+				taken = c.Body
+				break
+			}
+		}
+		if taken == nil {
+			return nil, true
+		}
+		return taken, !declaresVariables(taken)
+	}
+	return nil, false
+}
+
+func constantValue(expr YulExpression) (*big.Int, bool) {
+	lit, ok := expr.(*YulLiteral)
+	if !ok {
+		return nil, false
+	}
+	value, err := ParseYulLiteralValue(lit)
+	return value, err == nil
+}
+
+// declaresVariables reports whether block declares variables or functions
+// directly in its own scope
+func declaresVariables(block *YulBlock) bool {
+	for _, stmt := range block.Statements {
+		switch stmt.(type) {
+		case *YulVariableDeclaration, *YulFunctionDef:
+			return true
+		}
+	}
+	return false
+}
+
+// estimateBlockSize approximates the encoded size in bytes of block
+func estimateBlockSize(block *YulBlock) int {
+	size := 0
+	walkBlock(block, func(b *YulBlock) {
+		for _, stmt := range b.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				size += estimateExpressionSize(*slot)
+			}
+		}
+	})
+	return size
+}
+
+// usedNames returns every function and variable name in the AST
+func usedNames(ast *YulAST) map[string]bool {
+	names := make(map[string]bool)
+	forEachFunctionDef(ast, func(fn *YulFunctionDef) {
+		names[fn.Name] = true
+		for _, param := range append(append([]*YulTypedName(nil), fn.Parameters...), fn.Returns...) {
+			names[param.Name] = true
+		}
+	})
+	forEachBlock(ast, func(block *YulBlock) {
+		for _, stmt := range block.Statements {
+			if decl, ok := stmt.(*YulVariableDeclaration); ok {
+				for _, variable := range decl.Variables {
+					names[variable.Name] = true
+				}
+			}
+		}
+	})
+	return names
+}
+
+// uniqueName returns name, suffixed if needed to avoid names, and reserves it
+func uniqueName(name string, names map[string]bool) string {
+	candidate := name
+	for n := 2; names[candidate]; n++ {
+		candidate = fmt.Sprintf("%s_%d", name, n)
+	}
+	names[candidate] = true
+	return candidate
+}
+
+// insertClones places every clone right after its original definition so it
+// is visible wherever the original is
+func insertClones(ast *YulAST, clones map[*YulFunctionDef][]*YulFunctionDef) {
+	var functions []*YulFunctionDef
+	for _, def := range ast.Functions {
+		functions = append(functions, def)
+		functions = append(functions, clones[def]...)
+	}
+	ast.Functions = functions
+
+	forEachBlock(ast, func(block *YulBlock) {
+		var statements []YulStatement
+		for _, stmt := range block.Statements {
+			statements = append(statements, stmt)
+			if def, ok := stmt.(*YulFunctionDef); ok {
+				for _, clone := range clones[def] {
+					statements = append(statements, clone)
+				}
+			}
+		}
+		block.Statements = statements
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import "fmt"
+
+// Stack verification.
+//
+// The stack tracker follows the instruction stream in emission order and
+// relies on the emitting code to reset it where control flow joins. The
+// verifier checks the finished code instead: it walks the control flow
+// graph of every method and every CALL target from its entry depth, and
+// fails compilation when two paths reach an instruction with different
+// depths, an instruction pops more items than the frame holds, the depth
+// exceeds the configured maximum or a callee returns a different number
+// of items than its calls expect.
+//
+// Depths count the items of one frame: a method starts with its arguments,
+// a callee with the items its CALL pops, and a catch block with the items
+// at its TRY plus the exception. Unreachable code is not checked.
+
+// NeoVMMaxStackSize is the number of stack items NeoVM allows, the default
+// maximum depth
+const NeoVMMaxStackSize = 2048
+
+// StackError is a stack inconsistency the verifier found in generated code
+type StackError struct {
+	Position    SourcePosition // Source of the offending instruction
+	Instruction int            // Index of the offending instruction
+	Message     string
+}
+
+func (e *StackError) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", e.Message, e.Position.Line, e.Position.Column)
+}
+
+// stackRoot is an entry of the control flow graph
+type stackRoot struct {
+	index   int
+	depth   int
+	returns int // Items at RET, or -1 when unchecked
+}
+
+// maxStackDepth returns the configured maximum depth
+func (g *CodeGenerator) maxStackDepth() int {
+	if g.context != nil && g.context.MaxStackDepth > 0 {
+		return g.context.MaxStackDepth
+	}
+	return NeoVMMaxStackSize
+}
+
+// verifyStack checks the stack depths of the generated code, entered at
+// the given methods or, without methods, at its first instruction
+func (g *CodeGenerator) verifyStack(methods []*ContractMethod) error {
+	if len(g.instructions) == 0 {
+		return nil
+	}
+	targets := make(map[int]int, len(g.pendingLabels))
+	for _, pending := range g.pendingLabels {
+		target, _ := g.labelMap.Get(pending.Name)
+		targets[pending.InstructionIndex] = target
+	}
+
+	var roots []stackRoot
+	if len(methods) == 0 {
+		roots = append(roots, stackRoot{index: 0, returns: -1})
+	}
+	offsets := g.byteOffsets()
+	for _, method := range methods {
+		for index, offset := range offsets[:len(g.instructions)] {
+			if offset == method.Offset {
+				roots = append(roots, stackRoot{index: index, depth: len(method.Parameters), returns: -1})
+				break
+			}
+		}
+	}
+
+	// Each CALL target is a root entered with the items the call pops
+	callees := make(map[int]int) // Target -> index in roots
+	for i, instr := range g.instructions {
+		if instr.Opcode != CALL && instr.Opcode != CALL_L {
+			continue
+		}
+		target := targets[i]
+		if r, ok := callees[target]; ok {
+			if roots[r].depth != instr.StackPop || roots[r].returns != instr.StackPush {
+				return g.stackError(i, "call takes %d and returns %d items, other calls of the same target %d and %d",
+					instr.StackPop, instr.StackPush, roots[r].depth, roots[r].returns)
+			}
+			continue
+		}
+		callees[target] = len(roots)
+		roots = append(roots, stackRoot{index: target, depth: instr.StackPop, returns: instr.StackPush})
+	}
+
+	for _, root := range roots {
+		if err := g.verifyFrame(root, targets); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyFrame walks the code reachable from root without entering calls
+func (g *CodeGenerator) verifyFrame(root stackRoot, targets map[int]int) error {
+	max := g.maxStackDepth()
+	depths := map[int]int{root.index: root.depth}
+	work := []int{root.index}
+	visit := func(from, index, depth int) error {
+		if index == len(g.instructions) {
+			// Running off the end of the script returns
+			if root.returns >= 0 && depth != root.returns {
+				return g.stackError(from, "returns %d items, its calls expect %d", depth, root.returns)
+			}
+			return nil
+		}
+		if seen, ok := depths[index]; ok {
+			if seen != depth {
+				return g.stackError(from, "stack depth %d where another path has %d", depth, seen)
+			}
+			return nil
+		}
+		depths[index] = depth
+		work = append(work, index)
+		return nil
+	}
+
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		instr, depth := g.instructions[i], depths[i]
+		if depth < instr.StackPop {
+			return g.stackError(i, "%s pops %d items from a stack of %d", OpcodeMnemonic(instr.Opcode), instr.StackPop, depth)
+		}
+		next := depth - instr.StackPop + instr.StackPush
+		if next > max {
+			return g.stackError(i, "stack depth %d exceeds the maximum of %d", next, max)
+		}
+
+		switch op := instr.Opcode; {
+		case op == RET:
+			if root.returns >= 0 && depth != root.returns {
+				return g.stackError(i, "returns %d items, its calls expect %d", depth, root.returns)
+			}
+			continue
+		case op == THROW || op == ABORT || op == ABORTMSG || op == ENDFINALLY:
+			continue
+		case op == JMP || op == JMP_L || op == ENDTRY || op == ENDTRY_L:
+			if err := visit(i, targets[i], next); err != nil {
+				return err
+			}
+			continue
+		case op == TRY || op == TRY_L:
+			if err := visit(i, targets[i], depth+1); err != nil {
+				return err
+			}
+		case op == CALL || op == CALL_L:
+		case isJump(op):
+			if err := visit(i, targets[i], next); err != nil {
+				return err
+			}
+		case op == CLEAR:
+			next = 0
+		}
+		if err := visit(i, i+1, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stackError reports a stack inconsistency at the instruction at index
+func (g *CodeGenerator) stackError(index int, format string, args ...interface{}) error {
+	err := &StackError{Instruction: index, Message: fmt.Sprintf(format, args...)}
+	if ref := g.instructions[index].SourceRef; ref != nil {
+		err.Position = *ref
+	}
+	return err
+}
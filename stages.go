@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Staged compilation API.
+//
+// Compile runs Lex → Parse → Analyze → Lower → Emit in one go. Each stage is
+// also exported so tools can stop after any of them, inspect or rewrite the
+// intermediate result and feed it to the next stage:
+//
+//	tokens, _ := compiler.Lex(source)
+//	ast, _ := compiler.Parse(source)
+//	annotated, _ := compiler.Analyze(ast)
+//	ir, _ := compiler.Lower(annotated, nil)
+//	contract, _ := compiler.Emit(ir)
+//
+// PrintYul dumps annotated.AST or ir.AST as Yul source for inspection.
+
+// StageError reports which phase of the pipeline failed
+type StageError struct {
+	Phase   string // Phase name as used in CompilerError
+	Message string // Short description, e.g. "Parse error"
+	Err     error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// AnnotatedAST is a normalized AST together with its static analysis
+type AnnotatedAST struct {
+	Source   *YulAST // AST as parsed
+	AST      *YulAST // Normalized AST
+	Analysis *AnalysisResult
+}
+
+// LowerOptions adjusts the Lower stage
+type LowerOptions struct {
+	SkipOptimization bool               // Generate code from the AST as analyzed
+	Passes           []OptimizationPass // Replaces the configured pass pipeline when non-nil
+}
+
+// LoweredIR is the generated NeoVM code before runtime finalization
+type LoweredIR struct {
+	AST       *YulAST      // AST the code was generated from, after optimization
+	Contract  *NeoContract // Unfinalized contract holding the instruction stream
+	Functions map[string]FunctionInfo
+	Stack     StackUsage
+}
+
+// Lex tokenizes source
+func (c *YulToNeoCompiler) Lex(source string) ([]Token, error) {
+	lexer := NewYulLexer()
+	lexer.dialect = c.Parser.dialect
+	if err := lexer.Init(source); err != nil {
+		return nil, &StageError{"Lexing", "Lex error", err}
+	}
+	tokens, err := lexer.ScanTokens()
+	if err != nil {
+		return nil, &StageError{"Lexing", "Lex error", err}
+	}
+	return tokens, nil
+}
+
+// Parse parses source into an AST
+func (c *YulToNeoCompiler) Parse(source string) (*YulAST, error) {
+	ast, err := c.Parser.Parse(source)
+	if err != nil {
+		return nil, &StageError{"Parsing", "Parse error", err}
+	}
+	return ast, nil
+}
+
+// Analyze normalizes an AST and runs static analysis over it. The input AST
+// is not modified.
+func (c *YulToNeoCompiler) Analyze(ast *YulAST) (*AnnotatedAST, error) {
+	normalized, err := c.Normalizer.Normalize(ast)
+	if err != nil {
+		return nil, &StageError{"Normalization", "Normalization error", err}
+	}
+
+	analysis, err := c.StaticAnalyzer.Analyze(normalized)
+	if err != nil {
+		return nil, &StageError{"Static Analysis", "Analysis error", err}
+	}
+
+	return &AnnotatedAST{Source: ast, AST: normalized, Analysis: analysis}, nil
+}
+
+// Lower optimizes an annotated AST and generates NeoVM code for it. Every
+// call uses a fresh code generator, which is left in c.CodeGenerator.
+func (c *YulToNeoCompiler) Lower(annotated *AnnotatedAST, options *LowerOptions) (*LoweredIR, error) {
+	if options == nil {
+		options = &LowerOptions{}
+	}
+
+	ast := annotated.AST
+	if !options.SkipOptimization {
+		optimizer := c.Optimizer
+		if options.Passes != nil {
+			optimizer = NewOptimizationEngine(c.Config.OptimizationLevel)
+			optimizer.SetProfile(c.Optimizer.Profile())
+			optimizer.SetPasses(options.Passes)
+		}
+
+		optimized, err := optimizer.Optimize(ast)
+		if err != nil {
+			return nil, &StageError{"Optimization", "Optimization error", err}
+		}
+		ast = optimized
+	}
+
+	c.CodeGenerator = NewCodeGenerator(c.context)
+	if !options.SkipOptimization {
+		c.CodeGenerator.SetPeepholeOptimizer(c.Optimizer)
+	}
+	contract, err := c.CodeGenerator.Generate(ast)
+	if err != nil {
+		return nil, &StageError{"Code Generation", "Code generation error", err}
+	}
+
+	return &LoweredIR{
+		AST:       ast,
+		Contract:  contract,
+		Functions: c.CodeGenerator.Functions(),
+		Stack:     c.CodeGenerator.StackUsage(),
+	}, nil
+}
+
+// Emit checks lowered code against the NeoVM limits and finalizes it into a
+// deployable contract
+func (c *YulToNeoCompiler) Emit(ir *LoweredIR) (*NeoContract, error) {
+	if err := CheckNeoVMLimits(ir.Contract.Runtime, ir.Stack, limitsFromContext(c.context)); err != nil {
+		return nil, &StageError{"Limit Validation", "Limit error", err}
+	}
+	contract, err := c.RuntimeManager.Finalize(ir.Contract)
+	if err != nil {
+		return nil, &StageError{"Runtime Integration", "Runtime error", err}
+	}
+	c.context.Profile.Prices.Reprice(contract.Runtime)
+	return contract, nil
+}
+
+// runStages is the body of Compile: every stage in order, starting from
+// the AST parse returns, recording the failing phase in result
+func (c *YulToNeoCompiler) runStages(parse func() (*YulAST, error), result *CompilationResult) (*YulAST, *NeoContract, error) {
+	fail := func(err error) (*YulAST, *NeoContract, error) {
+		if stageErr, ok := err.(*StageError); ok {
+			compilerErr := CompilerError{
+				Phase:   stageErr.Phase,
+				Message: stageErr.Error(),
+			}
+			locate := func(position SourcePosition) {
+				compilerErr.File = diagnosticFile(position)
+				compilerErr.Line, compilerErr.Column = position.Line, position.Column
+				compilerErr.Length = position.Length
+			}
+			if stageErr.Message == "Import error" {
+				compilerErr.Code = CodeImport
+			}
+			var stackErr *StackError
+			if errors.As(err, &stackErr) {
+				compilerErr.Code = CodeStack
+				locate(stackErr.Position)
+			}
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				compilerErr.Code = parseErr.Code
+				if parseErr.Position.Line > 0 {
+					locate(parseErr.Position)
+				}
+			}
+			var linkErr *LinkError
+			if errors.As(err, &linkErr) {
+				locate(linkErr.Position)
+				if linkErr.Related.Line > 0 {
+					compilerErr.Related = append(compilerErr.Related, relatedNote(linkErr.Related, "first defined here"))
+				}
+			}
+			var limitsErr *LimitsError
+			if errors.As(err, &limitsErr) {
+				for _, violation := range limitsErr.Violations {
+					if violation.Position.Line > 0 {
+						locate(violation.Position)
+						break
+					}
+				}
+			}
+			result.Errors = append(result.Errors, compilerErr)
+		}
+		return nil, nil, err
+	}
+
+	log.Printf("Phase 1: Parsing Yul source")
+	ast, err := parse()
+	if err != nil {
+		return fail(err)
+	}
+
+	log.Printf("Phase 2: Normalization and static analysis")
+	annotated, err := c.Analyze(ast)
+	if err != nil {
+		return fail(err)
+	}
+	result.Warnings = append(result.Warnings, annotated.Analysis.Warnings...)
+
+	log.Printf("Phase 3: Optimization and code generation")
+	generated := len(c.context.ErrorCollector.GetWarnings())
+	ir, err := c.Lower(annotated, nil)
+	result.Warnings = append(result.Warnings, c.context.ErrorCollector.GetWarnings()[generated:]...)
+	if err != nil {
+		return fail(err)
+	}
+	result.Statistics.FunctionsCompiled = len(ir.Functions)
+
+	log.Printf("Phase 4: Runtime integration")
+	contract, err := c.Emit(ir)
+	if err != nil {
+		return fail(err)
+	}
+	script, err := contract.Script()
+	if err != nil {
+		return fail(err)
+	}
+	result.Statistics.CompiledSizeBytes = len(script)
+	result.Statistics.EstimatedCost = c.context.Profile.Prices.EstimateCost(contract.Runtime)
+	return ast, contract, nil
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Standard JSON interface.
+//
+// Tools built around solc drive it with a JSON document on stdin naming the
+// sources, the settings and the outputs they want, and read a JSON document
+// of contracts and errors back. --standard-json accepts the same input for
+// Yul sources and answers in the same shape, so those tools can drive this
+// compiler unchanged:
+//
+//   - each source is one contract, named after its top-level object;
+//   - evm.bytecode and evm.deployedBytecode carry the NeoVM script, which
+//     has no separate constructor code; opcodes are NeoVM mnemonics and the
+//     source map has one uncompressed entry per instruction;
+//   - abi is the manifest ABI in Ethereum ABI form;
+//   - neo.nef, neo.manifest and neo.debugInfo carry the Neo artifacts.
+//
+// settings.neo sets the fields of CompilerConfig that have no solc
+// counterpart. A compilation error fails only its source; malformed input
+// is reported as a JSONError with no contracts, as solc does.
+
+// StandardJSONInput is a solc standard JSON input document
+type StandardJSONInput struct {
+	Language string                        `json:"language"`
+	Sources  map[string]StandardJSONSource `json:"sources"`
+	Settings StandardJSONSettings          `json:"settings"`
+}
+
+// StandardJSONSource is a source given by content or by local file URLs
+type StandardJSONSource struct {
+	Content *string  `json:"content,omitempty"`
+	URLs    []string `json:"urls,omitempty"`
+}
+
+// StandardJSONSettings are the compiler settings of the input
+type StandardJSONSettings struct {
+	Optimizer struct {
+		Enabled *bool `json:"enabled"` // Level 2 unless disabled; runs are ignored
+	} `json:"optimizer"`
+	OutputSelection map[string]map[string][]string `json:"outputSelection"`
+	EVMVersion      string                         `json:"evmVersion,omitempty"` // Dialect of the sources unless Neo sets one
+	Neo             StandardJSONNeoSettings        `json:"neo"`
+}
+
+// StandardJSONNeoSettings are the Neo-specific settings
+type StandardJSONNeoSettings struct {
+	OptimizationLevel  *int     `json:"optimizationLevel,omitempty"` // Overrides the optimizer setting
+	DebugInfo          bool     `json:"debugInfo,omitempty"`
+	ExportFunctions    []string `json:"exportFunctions,omitempty"`
+	ViewFunctions      []string `json:"viewFunctions,omitempty"`
+	Permissions        []string `json:"permissions,omitempty"`
+	Trusts             []string `json:"trusts,omitempty"`
+	SupportedStandards []string `json:"supportedStandards,omitempty"`
+	Libraries          []string `json:"libraries,omitempty"`
+	CompilerFlags      []string `json:"compilerFlags,omitempty"`
+	Dialect            string   `json:"dialect,omitempty"` // Overrides evmVersion
+}
+
+// StandardJSONOutput is a solc standard JSON output document
+type StandardJSONOutput struct {
+	Errors    []StandardJSONError                         `json:"errors,omitempty"`
+	Sources   map[string]StandardJSONSourceID             `json:"sources,omitempty"`
+	Contracts map[string]map[string]*StandardJSONContract `json:"contracts,omitempty"`
+}
+
+// StandardJSONSourceID numbers a source for source maps
+type StandardJSONSourceID struct {
+	ID int `json:"id"`
+}
+
+// StandardJSONError is an error or warning of the output
+type StandardJSONError struct {
+	SourceLocation   *StandardJSONLocation `json:"sourceLocation,omitempty"`
+	Type             string                `json:"type"` // JSONError, ParserError, CompilerError or Warning
+	Component        string                `json:"component"`
+	Severity         string                `json:"severity"`            // error or warning
+	ErrorCode        string                `json:"errorCode,omitempty"` // solc's code, or a diagnostic code of this compiler
+	Message          string                `json:"message"`
+	FormattedMessage string                `json:"formattedMessage"`
+}
+
+// StandardJSONLocation is a byte range of a source
+type StandardJSONLocation struct {
+	File  string `json:"file"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// StandardJSONContract holds the selected outputs of a contract
+type StandardJSONContract struct {
+	ABI []StandardJSONABIEntry `json:"abi,omitempty"`
+	EVM *StandardJSONEVM       `json:"evm,omitempty"`
+	Neo *StandardJSONNeo       `json:"neo,omitempty"`
+}
+
+// StandardJSONABIEntry is a function or event in Ethereum ABI form
+type StandardJSONABIEntry struct {
+	Type            string                 `json:"type"`
+	Name            string                 `json:"name"`
+	Inputs          []StandardJSONABIParam `json:"inputs"`
+	Outputs         []StandardJSONABIParam `json:"outputs,omitempty"`
+	StateMutability string                 `json:"stateMutability,omitempty"`
+	Anonymous       *bool                  `json:"anonymous,omitempty"`
+}
+
+// StandardJSONABIParam is a parameter of an ABI entry
+type StandardJSONABIParam struct {
+	Name         string                 `json:"name"`
+	Type         string                 `json:"type"`
+	InternalType string                 `json:"internalType,omitempty"` // Manifest type
+	Indexed      *bool                  `json:"indexed,omitempty"`
+	Components   []StandardJSONABIParam `json:"components,omitempty"` // Of a tuple
+}
+
+// StandardJSONEVM holds the bytecode outputs
+type StandardJSONEVM struct {
+	Bytecode         *StandardJSONBytecode `json:"bytecode,omitempty"`
+	DeployedBytecode *StandardJSONBytecode `json:"deployedBytecode,omitempty"`
+}
+
+// StandardJSONBytecode is a script with its listing and source map
+type StandardJSONBytecode struct {
+	Object    string `json:"object,omitempty"` // Script in hex
+	Opcodes   string `json:"opcodes,omitempty"`
+	SourceMap string `json:"sourceMap,omitempty"`
+}
+
+// StandardJSONNeo holds the Neo artifacts
+type StandardJSONNeo struct {
+	NEF       string            `json:"nef,omitempty"` // NEF file in base64
+	Manifest  *ContractManifest `json:"manifest,omitempty"`
+	DebugInfo *DebugInformation `json:"debugInfo,omitempty"`
+}
+
+// CompileStandardJSON compiles a standard JSON input document
+func CompileStandardJSON(input []byte) *StandardJSONOutput {
+	output := &StandardJSONOutput{}
+	var request StandardJSONInput
+	if err := json.Unmarshal(input, &request); err != nil {
+		output.addError(nil, "JSONError", "error", "", fmt.Sprintf("invalid standard JSON input: %v", err))
+		return output
+	}
+	if request.Language != "Yul" {
+		output.addError(nil, "JSONError", "error", "", fmt.Sprintf("only Yul is supported, got language %q", request.Language))
+		return output
+	}
+	if len(request.Sources) == 0 {
+		output.addError(nil, "JSONError", "error", "", "no input sources specified")
+		return output
+	}
+
+	names := make([]string, 0, len(request.Sources))
+	for name := range request.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	output.Sources = make(map[string]StandardJSONSourceID, len(names))
+	output.Contracts = make(map[string]map[string]*StandardJSONContract)
+	for id, name := range names {
+		output.Sources[name] = StandardJSONSourceID{ID: id}
+		source, err := request.Sources[name].read()
+		if err != nil {
+			output.addError(&StandardJSONLocation{File: name}, "IOError", "error", "", err.Error())
+			continue
+		}
+		output.compile(name, id, source, &request.Settings)
+	}
+	return output
+}
+
+// read returns the content of the source, or of the first readable URL
+func (s StandardJSONSource) read() (string, error) {
+	if s.Content != nil {
+		return *s.Content, nil
+	}
+	for _, url := range s.URLs {
+		if data, err := os.ReadFile(strings.TrimPrefix(url, "file://")); err == nil {
+			return string(data), nil
+		}
+	}
+	if len(s.URLs) == 0 {
+		return "", fmt.Errorf("source has neither content nor urls")
+	}
+	return "", fmt.Errorf("cannot read source from %s", strings.Join(s.URLs, ", "))
+}
+
+// config returns the compiler configuration of the settings
+func (s *StandardJSONSettings) config() CompilerConfig {
+	level := 2
+	if s.Optimizer.Enabled != nil && !*s.Optimizer.Enabled {
+		level = 0
+	}
+	if s.Neo.OptimizationLevel != nil {
+		level = *s.Neo.OptimizationLevel
+	}
+	dialect := s.EVMVersion
+	if s.Neo.Dialect != "" {
+		dialect = s.Neo.Dialect
+	}
+	return CompilerConfig{
+		OptimizationLevel:  level,
+		EnableDebugInfo:    s.Neo.DebugInfo,
+		ExportFunctions:    s.Neo.ExportFunctions,
+		ViewFunctions:      s.Neo.ViewFunctions,
+		Permissions:        s.Neo.Permissions,
+		Trusts:             s.Neo.Trusts,
+		SupportedStandards: s.Neo.SupportedStandards,
+		Libraries:          s.Neo.Libraries,
+		CompilerFlags:      s.Neo.CompilerFlags,
+		Dialect:            dialect,
+	}
+}
+
+// selection returns the outputs selected for a contract of a source
+func (s *StandardJSONSettings) selection(file, contract string) []string {
+	var selected []string
+	for _, f := range []string{"*", file} {
+		for _, c := range []string{"*", contract} {
+			selected = append(selected, s.OutputSelection[f][c]...)
+		}
+	}
+	return selected
+}
+
+// compile compiles one source and adds its contract and diagnostics
+func (o *StandardJSONOutput) compile(file string, id int, source string, settings *StandardJSONSettings) {
+	location := func(line, column int) *StandardJSONLocation {
+		offset := sourceOffset(source, line, column)
+		return &StandardJSONLocation{File: file, Start: offset, End: offset}
+	}
+
+	result, err := NewYulToNeoCompiler(settings.config()).Compile(source)
+	if result != nil {
+		for _, warning := range result.Warnings {
+			o.addError(location(warning.Line, warning.Column), "Warning", "warning", warning.Diagnostic().Code, warning.Message)
+		}
+		for _, compilerErr := range result.Errors {
+			kind := "CompilerError"
+			if compilerErr.Phase == "Lexing" || compilerErr.Phase == "Parsing" {
+				kind = "ParserError"
+			}
+			o.addError(location(compilerErr.Line, compilerErr.Column), kind, "error", compilerErr.Diagnostic().Code, compilerErr.Message)
+		}
+	}
+	if err != nil || result == nil || result.Contract == nil {
+		if result == nil || len(result.Errors) == 0 {
+			o.addError(&StandardJSONLocation{File: file}, "CompilerError", "error", CodeUnknown, fmt.Sprint(err))
+		}
+		return
+	}
+
+	name := result.Contract.Name
+	if ast, err := NewYulParser().Parse(source); err == nil && len(ast.Objects) > 0 {
+		name = ast.Objects[0].Name
+	}
+	contract, err := standardJSONContract(result, id, settings.selection(file, name))
+	if err != nil {
+		o.addError(&StandardJSONLocation{File: file}, "CompilerError", "error", CodeUnknown, err.Error())
+		return
+	}
+	if o.Contracts[file] == nil {
+		o.Contracts[file] = make(map[string]*StandardJSONContract)
+	}
+	o.Contracts[file][name] = contract
+}
+
+// standardJSONContract builds the selected outputs of a compiled contract
+func standardJSONContract(result *CompilationResult, id int, selected []string) (*StandardJSONContract, error) {
+	wants := func(output string) bool {
+		for _, s := range selected {
+			if s == "*" || s == output || strings.HasPrefix(output, s+".") {
+				return true
+			}
+		}
+		return false
+	}
+
+	contract := &StandardJSONContract{}
+	compiled := result.Contract
+	if wants("abi") && compiled.Manifest != nil {
+		contract.ABI = standardJSONABI(compiled.Manifest.ABI)
+	}
+
+	bytecode := func(prefix string) (*StandardJSONBytecode, error) {
+		code := &StandardJSONBytecode{}
+		if wants(prefix + ".object") {
+			script, err := compiled.Script()
+			if err != nil {
+				return nil, err
+			}
+			code.Object = hex.EncodeToString(script)
+		}
+		if wants(prefix + ".opcodes") {
+			opcodes := make([]string, len(compiled.Runtime))
+			for i, instr := range compiled.Runtime {
+				opcodes[i] = OpcodeMnemonic(instr.Opcode)
+				if instr.Opcode == SYSCALL {
+					opcodes[i] += " " + string(instr.Operand)
+				} else if len(instr.Operand) > 0 {
+					opcodes[i] += fmt.Sprintf(" 0x%x", instr.Operand)
+				}
+			}
+			code.Opcodes = strings.Join(opcodes, " ")
+		}
+		if wants(prefix + ".sourceMap") {
+			code.SourceMap = standardJSONSourceMap(compiled.Runtime, id)
+		}
+		if *code == (StandardJSONBytecode{}) {
+			return nil, nil
+		}
+		return code, nil
+	}
+	evm := &StandardJSONEVM{}
+	var err error
+	if evm.Bytecode, err = bytecode("evm.bytecode"); err != nil {
+		return nil, err
+	}
+	if evm.DeployedBytecode, err = bytecode("evm.deployedBytecode"); err != nil {
+		return nil, err
+	}
+	if evm.Bytecode != nil || evm.DeployedBytecode != nil {
+		contract.EVM = evm
+	}
+
+	neo := &StandardJSONNeo{}
+	if wants("neo.nef") {
+		nef, err := EncodeNEF(compiled)
+		if err != nil {
+			return nil, err
+		}
+		neo.NEF = base64.StdEncoding.EncodeToString(nef)
+	}
+	if wants("neo.manifest") {
+		neo.Manifest = compiled.Manifest
+	}
+	if wants("neo.debugInfo") {
+		neo.DebugInfo = result.DebugInfo
+	}
+	if *neo != (StandardJSONNeo{}) {
+		contract.Neo = neo
+	}
+	return contract, nil
+}
+
+// standardJSONABI converts a manifest ABI to Ethereum ABI form
+func standardJSONABI(abi ManifestABI) []StandardJSONABIEntry {
+	return EthereumABIOfContract(contractInterfaceOf(abi))
+}
+
+// standardJSONSourceMap writes a solc source map, "s:l:f:j" per instruction
+// separated by semicolons. Instructions without a source map to -1.
+func standardJSONSourceMap(instructions []NeoInstruction, id int) string {
+	entries := make([]string, len(instructions))
+	for i, instr := range instructions {
+		jump := "-"
+		switch instr.Opcode {
+		case CALL, CALL_L, CALLA, CALLT:
+			jump = "i"
+		case RET:
+			jump = "o"
+		}
+		if ref := instr.SourceRef; ref != nil && ref.Line > 0 {
+			entries[i] = fmt.Sprintf("%d:%d:%d:%s", ref.Offset, ref.Length, id, jump)
+		} else {
+			entries[i] = fmt.Sprintf("-1:-1:-1:%s", jump)
+		}
+	}
+	return strings.Join(entries, ";")
+}
+
+func (o *StandardJSONOutput) addError(location *StandardJSONLocation, kind, severity, code, message string) {
+	formatted := fmt.Sprintf("%s: %s", kind, message)
+	if location != nil {
+		formatted = fmt.Sprintf("%s: %s", location.File, formatted)
+	}
+	o.Errors = append(o.Errors, StandardJSONError{
+		SourceLocation:   location,
+		Type:             kind,
+		Component:        "general",
+		Severity:         severity,
+		ErrorCode:        code,
+		Message:          message,
+		FormattedMessage: formatted,
+	})
+}
+
+// Diagnostic returns the error as a diagnostic. The range names the file
+// only, since standard JSON locates errors by byte offsets.
+func (e StandardJSONError) Diagnostic() Diagnostic {
+	d := Diagnostic{
+		Code:     e.ErrorCode,
+		Severity: DiagnosticSeverity(e.Severity),
+		Phase:    e.Type,
+		Message:  e.Message,
+	}
+	if d.Code == "" {
+		d.Code = CodeUnknown
+	}
+	if e.SourceLocation != nil {
+		d.Range.File = e.SourceLocation.File
+	}
+	return d
+}
+
+// sourceOffset returns the byte offset of a 1-based line and column, 0
+// when the position is unknown
+func sourceOffset(source string, line, column int) int {
+	if line < 1 {
+		return 0
+	}
+	offset := 0
+	for ; line > 1; line-- {
+		next := strings.IndexByte(source[offset:], '\n')
+		if next < 0 {
+			return len(source)
+		}
+		offset += next + 1
+	}
+	if column > 1 {
+		offset += column - 1
+	}
+	if offset > len(source) {
+		offset = len(source)
+	}
+	return offset
+}
+
+// RunStandardJSON reads a standard JSON input document from r and writes
+// the output document to w. Compilation errors are part of the output, so
+// the exit code is non-zero only when the output cannot be written.
+func RunStandardJSON(r io.Reader, w io.Writer) int {
+	var output *StandardJSONOutput
+	input, err := io.ReadAll(r)
+	if err != nil {
+		output = &StandardJSONOutput{}
+		output.addError(nil, "IOError", "error", "", err.Error())
+	} else {
+		output = CompileStandardJSON(input)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(output); err != nil {
+		return exitFailed
+	}
+	return exitOK
+}
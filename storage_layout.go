@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Storage layout.
+//
+// A Yul storage slot is a word. Its storage key is the contract's storage
+// prefix followed by the 32 big-endian bytes of the slot, so the keys of
+// mappings and arrays, which Solidity derives with keccak256, stay apart
+// from each other and from the keys the compiler keeps for itself, which
+// start with 0xff. Slots holding 0 are deleted, like unset EVM slots.
+//
+// The storage context is read once per invocation into a static field and
+// loaded from there by every storage access.
+
+// DefaultStoragePrefix prefixes slot keys unless another prefix is configured
+var DefaultStoragePrefix = []byte{0x00}
+
+// Compiler flag overriding the configured storage prefix
+const storagePrefixFlag = "--storage-prefix"
+
+// maxStoragePrefix leaves room for the slot in NeoVM's 64-byte keys
+const maxStoragePrefix = 32
+
+// Storage routines
+const (
+	storageLoad  = "storage_load"
+	storageStore = "storage_store"
+)
+
+// storageBuiltins are the built-ins that access contract storage
+var storageBuiltins = map[string]bool{
+	"sload": true, "sstore": true, "neo.storage_find": true,
+	"setimmutable": true, "loadimmutable": true,
+}
+
+// StorageLayoutManager derives the storage keys of a contract
+type StorageLayoutManager struct {
+	prefix []byte
+}
+
+// NewStorageLayoutManager creates a layout prefixing slot keys with prefix
+func NewStorageLayoutManager(prefix []byte) (*StorageLayoutManager, error) {
+	switch {
+	case len(prefix) == 0:
+		return nil, fmt.Errorf("storage prefix is empty")
+	case len(prefix) > maxStoragePrefix:
+		return nil, fmt.Errorf("storage prefix has %d bytes (limit %d)", len(prefix), maxStoragePrefix)
+	case prefix[0] == 0xff:
+		return nil, fmt.Errorf("storage prefix %x starts with 0xff, which is reserved for the compiler", prefix)
+	}
+	return &StorageLayoutManager{prefix: append([]byte{}, prefix...)}, nil
+}
+
+// DefaultStorageLayout returns the layout with DefaultStoragePrefix
+func DefaultStorageLayout() *StorageLayoutManager {
+	layout, _ := NewStorageLayoutManager(DefaultStoragePrefix)
+	return layout
+}
+
+// ParseStoragePrefix parses a hex storage prefix, with or without "0x"
+func ParseStoragePrefix(value string) ([]byte, error) {
+	value = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), "0x")
+	prefix, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("storage prefix %q is not hex", value)
+	}
+	return prefix, nil
+}
+
+// StorageLayoutFromConfig returns the storage layout of a configuration. A
+// --storage-prefix flag in CompilerFlags takes precedence over
+// StoragePrefix.
+func StorageLayoutFromConfig(config CompilerConfig) (*StorageLayoutManager, error) {
+	value := flagValue(config.CompilerFlags, storagePrefixFlag, config.StoragePrefix)
+	if value == "" {
+		return DefaultStorageLayout(), nil
+	}
+	prefix, err := ParseStoragePrefix(value)
+	if err != nil {
+		return nil, err
+	}
+	return NewStorageLayoutManager(prefix)
+}
+
+// Prefix returns the prefix of slot keys
+func (l *StorageLayoutManager) Prefix() []byte {
+	return append([]byte{}, l.prefix...)
+}
+
+// SlotKey returns the storage key of slot
+func (l *StorageLayoutManager) SlotKey(slot *big.Int) []byte {
+	return append(l.Prefix(), wordBytes(slot)...)
+}
+
+// MappingSlot returns the slot of key in the mapping at slot, as Solidity
+// lays out mappings with value-type keys
+func (l *StorageLayoutManager) MappingSlot(key, slot *big.Int) *big.Int {
+	return l.BytesMappingSlot(wordBytes(key), slot)
+}
+
+// BytesMappingSlot returns the slot of a string or bytes key in the
+// mapping at slot
+func (l *StorageLayoutManager) BytesMappingSlot(key []byte, slot *big.Int) *big.Int {
+	data := append(append([]byte{}, key...), wordBytes(slot)...)
+	return new(big.Int).SetBytes(keccak256(data))
+}
+
+// ArrayElementSlot returns the first slot of element index of the dynamic
+// array at slot, whose elements take size slots each
+func (l *StorageLayoutManager) ArrayElementSlot(slot, index *big.Int, size int) *big.Int {
+	element := new(big.Int).SetBytes(keccak256(wordBytes(slot)))
+	element.Add(element, new(big.Int).Mul(index, big.NewInt(int64(size))))
+	return toWord(element)
+}
+
+// wordBytes returns the 32 big-endian bytes of a word
+func wordBytes(word *big.Int) []byte {
+	return toWord(word).FillBytes(make([]byte, 32))
+}
+
+// storageLayout returns the layout of the contract being generated
+func (g *CodeGenerator) storageLayout() *StorageLayoutManager {
+	if g.context != nil && g.context.StorageLayout != nil {
+		return g.context.StorageLayout
+	}
+	return DefaultStorageLayout()
+}
+
+// usesStorage reports whether the code generated for block accesses
+// storage
+func (g *CodeGenerator) usesStorage(block *YulBlock) bool {
+	if owner := g.updateOwner(); g.entry == nil && owner != nil && owner.Slot != nil {
+		return true
+	}
+	if len(g.functionHooks) > 0 || (g.entry == nil && g.nep11()) {
+		return true
+	}
+	used := false
+	walkBlock(block, func(b *YulBlock) {
+		for _, stmt := range b.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(expr YulExpression) {
+					if call, ok := expr.(*YulFunctionCall); ok && storageBuiltins[call.FunctionName.Name] {
+						used = true
+					}
+				})
+			}
+		}
+	})
+	return used
+}
+
+// emitStorageContextInit stores the storage context in its static field,
+// the read-only one for Safe methods
+func (g *CodeGenerator) emitStorageContextInit(readOnly bool, location SourcePosition) {
+	if readOnly {
+		g.emitInstruction(NewSyscallInstruction("System.Storage.GetReadOnlyContext"), location)
+	} else {
+		g.emitInstruction(NewSyscallInstruction("System.Storage.GetContext"), location)
+	}
+	g.emitInstruction(NewSlotInstruction(STSFLD, g.memory.storage), location)
+}
+
+// emitStorageContext pushes the storage context, from its static field
+// when the script has one
+func (g *CodeGenerator) emitStorageContext(location SourcePosition) {
+	if g.memory != nil && g.memory.storage >= 0 {
+		g.emitInstruction(NewSlotInstruction(LDSFLD, g.memory.storage), location)
+		return
+	}
+	g.emitInstruction(NewSyscallInstruction("System.Storage.GetContext"), location)
+}
+
+// emitStorageRead reads the integer under the key on top of the stack, 0
+// when there is none
+func (g *CodeGenerator) emitStorageRead(location SourcePosition) {
+	c := memoryCode{g, location}
+	found := g.createUniqueLabel("storage_found")
+	g.emitStorageContext(location)
+	c.op(NewSyscallInstruction("System.Storage.Get"))
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(ISNULL)
+	c.jump(JMPIFNOT, found)
+	c.op(NewStackInstruction(DROP))
+	c.push(0)
+	g.markLabel(found)
+	c.op(NewConvertInstruction(IntegerType))
+}
+
+// emitSlotKey replaces the slot on top of the stack with its storage key
+func (g *CodeGenerator) emitSlotKey(location SourcePosition) {
+	c := memoryCode{g, location}
+	c.wordBytes()
+	c.op(NewPushInstruction(CreateNeoVMByteString(g.storageLayout().Prefix())))
+	c.op(NewStackInstruction(SWAP))
+	c.arithmetic(CAT)
+}
+
+// wordBytes replaces the word on top of the stack with a buffer of its 32
+// big-endian bytes
+func (c memoryCode) wordBytes() {
+	c.op(NewStackInstruction(DUP))
+	c.push(128)
+	c.arithmetic(SHR)
+	c.halfWordBytes()
+	c.op(NewStackInstruction(SWAP))
+	c.halfWordBytes()
+	c.op(NewStackInstruction(SWAP))
+	c.arithmetic(CAT)
+	c.op(NewStackInstruction(DUP))
+	c.arithmetic(REVERSEITEMS)
+}
+
+// halfWordBytes replaces the integer on top of the stack with the 16
+// little-endian bytes of its low half. Setting bit 128 makes the encoding
+// of the half exactly 17 bytes long, whatever its sign.
+func (c memoryCode) halfWordBytes() {
+	c.push(halfWordMask)
+	c.arithmetic(AND)
+	c.push(halfWordModulus)
+	c.arithmetic(OR)
+	c.op(NewConvertInstruction(ByteStringType))
+	c.push(16)
+	c.arithmetic(LEFT)
+}
+
+// emitStorageLoad returns the word in a slot. Argument: the slot.
+func (g *CodeGenerator) emitStorageLoad(location SourcePosition) {
+	c := memoryCode{g, location}
+	c.arg(0)
+	g.emitSlotKey(location)
+	g.emitStorageRead(location)
+}
+
+// emitStorageStore writes a word to a slot, deleting the key of a 0.
+// Arguments: slot, value. Local 0 holds the key.
+func (g *CodeGenerator) emitStorageStore(location SourcePosition) {
+	c := memoryCode{g, location}
+	remove := g.createUniqueLabel("storage_store_remove")
+	done := g.createUniqueLabel("storage_store_done")
+
+	c.arg(0)
+	g.emitSlotKey(location)
+	c.op(NewSlotInstruction(STLOC, 0))
+	if g.canaryEnabled() {
+		c.arg(1)
+		c.op(NewSlotInstruction(LDLOC, 0))
+		g.emitCanaryRecord(location)
+	}
+
+	c.arg(1)
+	c.jump(JMPIFNOT, remove)
+	c.arg(1)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	g.emitStorageContext(location)
+	c.op(NewSyscallInstruction("System.Storage.Put"))
+	c.jump(JMP, done)
+
+	g.markLabel(remove)
+	c.op(NewSlotInstruction(LDLOC, 0))
+	g.emitStorageContext(location)
+	c.op(NewSyscallInstruction("System.Storage.Delete"))
+	g.markLabel(done)
+}
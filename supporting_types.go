@@ -20,6 +20,7 @@ type Symbol struct {
 	Type     YulDataType
 	Kind     SymbolKind
 	Location SymbolLocation
+	Position SourcePosition // Declaration of the name, for tools
 	Value    interface{} // For constants
 	Used     bool        // For dead code elimination
 }
@@ -100,6 +101,7 @@ type SecurityIssue struct {
 	Type        SecurityIssueType
 	Severity    SeverityLevel
 	Location    SourcePosition
+	Related     []SourcePosition // Other locations involved, e.g. the call a write follows
 	Description string
 	Suggestion  string
 }
@@ -146,12 +148,14 @@ type ControlFlowGraph struct {
 	Edges     []*CFGEdge
 	EntryNode *CFGNode
 	ExitNodes []*CFGNode
+	Entries   []*CFGNode // Entry of every object's code and function body, in the order of ExitNodes
 }
 
 type CFGNode struct {
 	ID          int
 	Type        CFGNodeType
 	Statement   YulStatement
+	Label       string // Statement or condition, for display
 	Successors  []*CFGNode
 	Predecessors []*CFGNode
 }
@@ -188,6 +192,7 @@ type VariableUse struct {
 	Variable *Variable
 	Location SourcePosition
 	Node     *CFGNode
+	Defs     []*VariableDef // Definitions that may reach the use
 }
 
 type VariableDef struct {
@@ -195,11 +200,14 @@ type VariableDef struct {
 	Location SourcePosition
 	Node     *CFGNode
 	Value    YulExpression
+	Zero     bool           // Declared without a value
+	Uses     []*VariableUse // Uses the definition may reach
 }
 
 // OptimizationEngine performs various optimization passes
 type OptimizationEngine struct {
 	level         int
+	profile       *OptimizationProfile
 	passes        []OptimizationPass
 	peepholePasses []PeepholePattern
 }
@@ -215,7 +223,9 @@ type OptimizationPass interface {
 type PeepholePattern struct {
 	Name        string
 	Pattern     []NeoOpcode
-	Replacement []NeoInstruction
+	Match       func(window []NeoInstruction) bool // Conditions on the operands, nil for none
+	Replacement []NeoInstruction // Replaces the window; a jump may only be removed
+	Keep        int // Leading instructions of the window kept ahead of the replacement
 	Savings     int // Gas savings estimate
 }
 
@@ -318,6 +328,11 @@ func (ec *ErrorCollector) AddWarning(phase string, message string, line int, col
 	})
 }
 
+// AddCompilerWarning records a warning with its file, code and notes
+func (ec *ErrorCollector) AddCompilerWarning(warning CompilerWarning) {
+	ec.warnings = append(ec.warnings, warning)
+}
+
 func (ec *ErrorCollector) HasErrors() bool {
 	return len(ec.errors) > 0
 }
@@ -381,9 +396,35 @@ func (sa *StaticAnalyzer) Analyze(ast *YulAST) (*AnalysisResult, error) {
 	}
 	result.ControlFlow = cfg
 
+	// Link uses to definitions and report suspicious variables,
+	// unreachable code and unchecked overflows
+	dataFlow, warnings := sa.buildDataFlowGraph(ast, cfg)
+	result.DataFlow = dataFlow
+	warnings = append(warnings, sa.unreachableCodeWarnings(ast, cfg)...)
+	overflows, overflowWarnings := sa.overflowIssues(ast)
+	result.SecurityIssues = append(result.SecurityIssues, overflows...)
+	result.SecurityIssues = append(result.SecurityIssues, sa.reentrancyIssues(ast, cfg)...)
+	warnings = append(warnings, overflowWarnings...)
+	for _, warning := range warnings {
+		if sa.suppressed(ast, diagnosticCode(warning.Phase, warning.Code), SourcePosition{File: warning.File, Line: warning.Line}) {
+			continue
+		}
+		if sa.context != nil && sa.context.ErrorCollector != nil {
+			sa.context.ErrorCollector.AddCompilerWarning(warning)
+		}
+		result.Warnings = append(result.Warnings, warning)
+	}
+
 	// Perform security analysis
 	securityIssues := sa.analyzeSecurityIssues(ast)
 	result.SecurityIssues = append(result.SecurityIssues, securityIssues...)
+	issues := result.SecurityIssues[:0]
+	for _, issue := range result.SecurityIssues {
+		if !sa.suppressed(ast, securityIssueCode(issue), issue.Location) {
+			issues = append(issues, issue)
+		}
+	}
+	result.SecurityIssues = issues
 
 	// Perform performance analysis
 	perfIssues := sa.analyzePerformanceIssues(ast)
@@ -392,16 +433,6 @@ func (sa *StaticAnalyzer) Analyze(ast *YulAST) (*AnalysisResult, error) {
 	return result, nil
 }
 
-func (sa *StaticAnalyzer) buildControlFlowGraph(ast *YulAST) (*ControlFlowGraph, error) {
-	// Build complete control flow graph for analysis
-	return &ControlFlowGraph{
-		Nodes:     []*CFGNode{},
-		Edges:     []*CFGEdge{},
-		EntryNode: nil,
-		ExitNodes: []*CFGNode{},
-	}, nil
-}
-
 func (sa *StaticAnalyzer) analyzeSecurityIssues(ast *YulAST) []SecurityIssue {
 	issues := []SecurityIssue{}
 	
@@ -447,6 +478,9 @@ func (sa *StaticAnalyzer) traverseASTForSecurity(block *YulBlock, issues *[]Secu
 				})
 			}
 			
+		case *YulBlock:
+			sa.traverseASTForSecurity(s, issues)
+			
 		case *YulIf:
 			sa.traverseASTForSecurity(s.Body, issues)
 			
@@ -523,6 +557,9 @@ func (sa *StaticAnalyzer) traverseASTForPerformance(block *YulBlock, issues *[]P
 				}
 			}
 			
+		case *YulBlock:
+			sa.traverseASTForPerformance(s, issues, depth)
+			
 		case *YulIf:
 			sa.traverseASTForPerformance(s.Body, issues, depth)
 			
@@ -541,6 +578,7 @@ func (sa *StaticAnalyzer) traverseASTForPerformance(block *YulBlock, issues *[]P
 func NewOptimizationEngine(level int) *OptimizationEngine {
 	engine := &OptimizationEngine{
 		level:  level,
+		profile: DefaultOptimizationProfile(),
 		passes: []OptimizationPass{},
 		peepholePasses: []PeepholePattern{},
 	}
@@ -551,7 +589,24 @@ func NewOptimizationEngine(level int) *OptimizationEngine {
 	return engine
 }
 
+// SetProfile switches the size/gas cost model and rebuilds the pass list
+func (oe *OptimizationEngine) SetProfile(profile *OptimizationProfile) {
+	if profile == nil {
+		profile = DefaultOptimizationProfile()
+	}
+	oe.profile = profile
+	oe.initializePasses()
+}
+
+// Profile returns the cost model used by the optimization passes
+func (oe *OptimizationEngine) Profile() *OptimizationProfile {
+	return oe.profile
+}
+
 func (oe *OptimizationEngine) initializePasses() {
+	oe.passes = []OptimizationPass{}
+	oe.peepholePasses = []PeepholePattern{}
+
 	// Level 0: No optimization
 	if oe.level == 0 {
 		return
@@ -559,22 +614,51 @@ func (oe *OptimizationEngine) initializePasses() {
 	
 	// Level 1: Basic optimizations
 	if oe.level >= 1 {
-		oe.peepholePasses = append(oe.peepholePasses, PeepholePattern{
-			Name:        "push_drop",
-			Pattern:     []NeoOpcode{PUSHDATA1, DROP},
-			Replacement: []NeoInstruction{}, // Remove both
-			Savings:     3,
-		})
+		oe.passes = append(oe.passes, NewConstantFoldingPass())
+		oe.passes = append(oe.passes, NewUnreachableCodePass())
+		for _, push := range constantPushes() {
+			oe.peepholePasses = append(oe.peepholePasses, PeepholePattern{
+				Name:        "push_drop",
+				Pattern:     []NeoOpcode{push, DROP},
+				Replacement: []NeoInstruction{}, // Remove both
+				Savings:     3,
+			})
+		}
+		for _, jump := range []NeoOpcode{JMP, JMP_L} {
+			oe.peepholePasses = append(oe.peepholePasses, PeepholePattern{
+				Name:        "jump_next",
+				Pattern:     []NeoOpcode{jump},
+				Match:       jumpsToNext,
+				Replacement: []NeoInstruction{},
+				Savings:     2,
+			})
+		}
 	}
 	
 	// Level 2: Advanced optimizations
 	if oe.level >= 2 {
+		oe.passes = append(oe.passes, NewProfileGuidedDispatchPass(oe.profile))
+		oe.passes = append(oe.passes, NewFunctionSpecializationPass(oe.profile))
+		oe.passes = append(oe.passes, NewCompileTimeEvaluationPass())
+		if oe.level >= 3 {
+			// Inlining drops the functions it inlines from the function
+			// table, which only the aggressive level gives up
+			oe.passes = append(oe.passes, NewFunctionInliningPass(oe.profile))
+		}
+		oe.passes = append(oe.passes, NewCommonSubexpressionPass())
 		oe.peepholePasses = append(oe.peepholePasses, PeepholePattern{
 			Name:        "dup_drop",
 			Pattern:     []NeoOpcode{DUP, DROP},
 			Replacement: []NeoInstruction{}, // Remove both
 			Savings:     2,
 		})
+		oe.peepholePasses = append(oe.peepholePasses, PeepholePattern{
+			Name:        "dup_swap",
+			Pattern:     []NeoOpcode{DUP, SWAP},
+			Replacement: []NeoInstruction{}, // Swapping equal items does nothing
+			Keep:        1,
+			Savings:     2,
+		})
 	}
 	
 	// Level 3: Aggressive optimizations
@@ -583,6 +667,17 @@ func (oe *OptimizationEngine) initializePasses() {
 	}
 }
 
+// SetPasses replaces the AST pass pipeline, e.g. to bisect a miscompile.
+// Passes requiring a higher level than the engine's are still skipped.
+func (oe *OptimizationEngine) SetPasses(passes []OptimizationPass) {
+	oe.passes = append([]OptimizationPass{}, passes...)
+}
+
+// Passes returns the AST passes in application order
+func (oe *OptimizationEngine) Passes() []OptimizationPass {
+	return oe.passes
+}
+
 func (oe *OptimizationEngine) Optimize(ast *YulAST) (*YulAST, error) {
 	optimizedAST := ast
 	
@@ -600,49 +695,83 @@ func (oe *OptimizationEngine) Optimize(ast *YulAST) (*YulAST, error) {
 	return optimizedAST, nil
 }
 
-func (oe *OptimizationEngine) OptimizeInstructions(instructions []NeoInstruction) []NeoInstruction {
+// OptimizeInstructions applies the peephole patterns until none matches.
+// Instructions whose indexes are in targets are jumped to, so a match may
+// start but not continue at one; verbatim instructions are never matched.
+// The returned moves give, for each index of instructions and for its end,
+// the index execution continues at in the optimized code; a removed
+// instruction moves onto what follows it.
+func (oe *OptimizationEngine) OptimizeInstructions(instructions []NeoInstruction, targets map[int]bool) ([]NeoInstruction, []int) {
+	moves := make([]int, len(instructions)+1)
+	for i := range moves {
+		moves[i] = i
+	}
 	optimized := instructions
-	
-	// Apply peephole optimizations
-	for _, pattern := range oe.peepholePasses {
-		optimized = oe.applyPeepholePattern(optimized, pattern)
+	for changed := true; changed; {
+		changed = false
+		for _, pattern := range oe.peepholePasses {
+			var step []int
+			optimized, step, targets = oe.applyPeepholePattern(optimized, pattern, targets)
+			if len(step) == 0 {
+				continue
+			}
+			for i, index := range moves {
+				moves[i] = step[index]
+			}
+			changed = true
+		}
 	}
-	
-	return optimized
+	return optimized, moves
 }
 
-func (oe *OptimizationEngine) applyPeepholePattern(instructions []NeoInstruction, pattern PeepholePattern) []NeoInstruction {
+// applyPeepholePattern replaces the matches of pattern. It returns the
+// moves of the indexes and the moved targets, no moves when nothing
+// matched.
+func (oe *OptimizationEngine) applyPeepholePattern(instructions []NeoInstruction, pattern PeepholePattern, targets map[int]bool) ([]NeoInstruction, []int, map[int]bool) {
 	result := []NeoInstruction{}
+	moves := make([]int, len(instructions)+1)
+	matched := false
 	
 	i := 0
 	for i < len(instructions) {
-		matched := false
-		
-		// Check if pattern matches at current position
-		if i+len(pattern.Pattern) <= len(instructions) {
-			match := true
-			for j, opcode := range pattern.Pattern {
-				if instructions[i+j].Opcode != opcode {
-					match = false
-					break
-				}
-			}
-			
-			if match {
-				// Apply replacement
-				result = append(result, pattern.Replacement...)
-				i += len(pattern.Pattern)
-				matched = true
-			}
+		n := len(pattern.Pattern)
+		match := i+n <= len(instructions)
+		for j := 0; match && j < n; j++ {
+			match = instructions[i+j].Opcode == pattern.Pattern[j] && !instructions[i+j].Verbatim && instructions[i+j].Link == "" && (j == 0 || !targets[i+j])
 		}
-		
-		if !matched {
+		if match && pattern.Match != nil {
+			match = pattern.Match(instructions[i : i+n])
+		}
+		if !match {
+			moves[i] = len(result)
 			result = append(result, instructions[i])
 			i++
+			continue
 		}
+		
+		// Apply replacement
+		matched = true
+		moves[i] = len(result)
+		result = append(result, instructions[i:i+pattern.Keep]...)
+		for _, instr := range pattern.Replacement {
+			instr.SourceRef = instructions[i].SourceRef
+			result = append(result, instr)
+		}
+		for j := 1; j < n; j++ {
+			moves[i+j] = len(result)
+		}
+		i += n
+	}
+	moves[len(instructions)] = len(result)
+	if !matched {
+		return instructions, nil, targets
 	}
 	
-	return result
+	moved := make(map[int]bool, len(targets))
+	for index := range targets {
+		moved[moves[index]] = true
+	}
+	return result, moves, moved
 }
 
 // NewRuntimeManager creates a new runtime manager
@@ -655,15 +784,15 @@ func NewRuntimeManager(context *CompilerContext) *RuntimeManager {
 func (rm *RuntimeManager) Finalize(contract *NeoContract) (*NeoContract, error) {
 	// Generate contract metadata
 	contract.Metadata.CompilationTime = time.Now().Format(time.RFC3339)
+	contract.Metadata.Compiler = NewArtifactCompilerInfo(rm.context)
 	
-	// Generate method descriptors
-	err := rm.generateMethodDescriptors(contract)
+	// Method and event names must be representable in the manifest
+	err := rm.checkManifestNames(contract)
 	if err != nil {
 		return nil, err
 	}
-	
-	// Generate ABI information
-	err = rm.generateABI(contract)
+
+	contract.Manifest, err = NewManifestGenerator(rm.context).Generate(contract)
 	if err != nil {
 		return nil, err
 	}
@@ -671,16 +800,6 @@ func (rm *RuntimeManager) Finalize(contract *NeoContract) (*NeoContract, error)
 	return contract, nil
 }
 
-func (rm *RuntimeManager) generateMethodDescriptors(contract *NeoContract) error {
-	// Generate complete method descriptors from function definitions
-	return nil
-}
-
-func (rm *RuntimeManager) generateABI(contract *NeoContract) error {
-	// Generate complete ABI from contract analysis
-	return nil
-}
-
 // Utility functions for pretty printing and debugging
 
 func PrettyPrintAST(ast *YulAST) string {
@@ -693,8 +812,8 @@ func PrettyPrintAST(ast *YulAST) string {
 		if obj.Code != nil {
 			builder.WriteString(fmt.Sprintf("  Code: %d statements\n", len(obj.Code.Statements)))
 		}
-		if len(obj.Objects) > 0 {
-			builder.WriteString(fmt.Sprintf("  Nested objects: %d\n", len(obj.Objects)))
+		if obj.Objects.Len() > 0 {
+			builder.WriteString(fmt.Sprintf("  Nested objects: %d\n", obj.Objects.Len()))
 		}
 	}
 	
@@ -715,13 +834,22 @@ func PrettyPrintInstructions(instructions []NeoInstruction) string {
 	for i, instr := range instructions {
 		builder.WriteString(fmt.Sprintf("%3d: %-12s", i, OpcodeMnemonic(instr.Opcode)))
 		
-		if len(instr.Operand) > 0 {
+		if instr.Opcode == SYSCALL {
+			builder.WriteString(fmt.Sprintf(" %s", instr.Operand))
+		} else if len(instr.Operand) > 0 {
 			builder.WriteString(fmt.Sprintf(" %x", instr.Operand))
 		}
 		
 		if instr.Comment != "" {
 			builder.WriteString(fmt.Sprintf(" // %s", instr.Comment))
 		}
+		if ref := instr.SourceRef; ref != nil && ref.Line > 0 {
+			if file := diagnosticFile(*ref); file != "" {
+				builder.WriteString(fmt.Sprintf(" ; %s:%d", file, ref.Line))
+			} else {
+				builder.WriteString(fmt.Sprintf(" ; line %d", ref.Line))
+			}
+		}
 		
 		builder.WriteString("\n")
 	}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+// Switch dispatch by binary search.
+//
+// A switch compares its value with each case in turn, so dispatching on
+// one of n selectors costs O(n) comparisons. From the configured number of
+// cases, a switch whose cases are all numbers instead compares the value
+// with the middle case of the sorted cases and continues in the half that
+// may hold it, until a few cases are left, which are compared in turn. The
+// case bodies and the default body are generated as for the compare chain.
+
+// DefaultSwitchSearchThreshold is the number of cases from which a switch
+// is dispatched by binary search
+const DefaultSwitchSearchThreshold = 10
+
+// switchSearchLeaf is the most cases compared in turn at the end of a search
+const switchSearchLeaf = 3
+
+const switchSearchFlag = "--switch-search-threshold"
+
+// SwitchSearchThresholdFromConfig returns the number of cases from which a
+// switch is dispatched by binary search, 0 for never. A
+// --switch-search-threshold flag in CompilerFlags takes precedence over
+// SwitchSearchThreshold.
+func SwitchSearchThresholdFromConfig(config CompilerConfig) (int, error) {
+	threshold := config.SwitchSearchThreshold
+	for _, value := range flagValues(config.CompilerFlags, switchSearchFlag) {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return DefaultSwitchSearchThreshold, fmt.Errorf("invalid %s %q", switchSearchFlag, value)
+		}
+		threshold = n
+	}
+	switch {
+	case threshold == 0:
+		return DefaultSwitchSearchThreshold, nil
+	case threshold < 0:
+		return 0, nil
+	}
+	return threshold, nil
+}
+
+// searchCase is a case of a switch dispatched by binary search
+type searchCase struct {
+	value *big.Int
+	label string
+}
+
+// searchCases returns the cases of stmt sorted by the integers their words
+// are held as when the switch is dispatched by binary search, nil
+// otherwise. A repeated value keeps its first case, which the compare chain
+// would match.
+func (g *CodeGenerator) searchCases(stmt *YulSwitch, labels []string) []searchCase {
+	threshold := DefaultSwitchSearchThreshold
+	if g.context != nil {
+		threshold = g.context.SwitchSearchThreshold
+	}
+	if threshold <= 0 || len(stmt.Cases) < threshold {
+		return nil
+	}
+	cases := make([]searchCase, 0, len(stmt.Cases))
+	seen := make(map[string]bool)
+	for i, caseStmt := range stmt.Cases {
+		if caseStmt.Value.Kind == LiteralKindString {
+			return nil
+		}
+		value, err := ParseYulLiteralValue(&caseStmt.Value)
+		if err != nil {
+			return nil
+		}
+		if !seen[value.String()] {
+			seen[value.String()] = true
+			cases = append(cases, searchCase{value: wordInteger(value), label: labels[i]})
+		}
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].value.Cmp(cases[j].value) < 0 })
+	return cases
+}
+
+// emitCaseSearch jumps from the switch value on the stack to the label of
+// the matching case, or continues after the search when none matches
+func (g *CodeGenerator) emitCaseSearch(cases []searchCase, location SourcePosition) {
+	noMatch := g.createUniqueLabel("switch_default")
+	g.emitSearchRange(cases, noMatch, true, location)
+	g.markLabel(noMatch)
+}
+
+// emitSearchRange searches the sorted cases. Unless it is the last range
+// emitted, a range that does not match jumps to noMatch.
+func (g *CodeGenerator) emitSearchRange(cases []searchCase, noMatch string, last bool, location SourcePosition) {
+	if len(cases) <= switchSearchLeaf {
+		for _, c := range cases {
+			g.emitInstruction(NewStackInstruction(DUP), location)
+			g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(c.value)), location)
+			g.emitInstruction(NewArithmeticInstruction(NUMEQUAL), location)
+			g.emitInstruction(NewControlFlowInstruction(JMPIF, 0), location)
+			g.addPendingLabel(c.label, len(g.instructions)-1)
+		}
+		if !last {
+			g.emitInstruction(NewControlFlowInstruction(JMP, 0), location)
+			g.addPendingLabel(noMatch, len(g.instructions)-1)
+		}
+		return
+	}
+
+	// Values below the middle case are in the lower half
+	mid := len(cases) / 2
+	lower := g.createUniqueLabel("switch_lower")
+	g.emitInstruction(NewStackInstruction(DUP), location)
+	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(cases[mid].value)), location)
+	g.emitInstruction(NewArithmeticInstruction(LT), location)
+	g.emitInstruction(NewControlFlowInstruction(JMPIF, 0), location)
+	g.addPendingLabel(lower, len(g.instructions)-1)
+	g.emitSearchRange(cases[mid:], noMatch, false, location)
+	g.markLabel(lower)
+	g.emitSearchRange(cases[:mid], noMatch, last, location)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Contract test host.
+//
+// TestHost runs a compiled contract in the execution engine the way a node
+// would, so contract authors can unit test compiled Yul from Go:
+//
+//	host := NewTestHost()
+//	if err := host.Deploy(result.Contract); err != nil {
+//		t.Fatal(err)
+//	}
+//	invocation := host.Invoke("transfer", to, 100)
+//	invocation.ExpectResult(t, true)
+//	invocation.ExpectNotification(t, "Transfer", from, to, 100)
+//	host.ExpectStorage(t, host.Layout.MappingSlot(to, big.NewInt(0)), 100)
+//
+// Storage persists across invocations. An invocation that FAULTs leaves
+// neither storage changes nor notifications behind, as a node commits only
+// those of a transaction that HALTs. Arguments and expected values are Go
+// values StackItemOf converts; an expected integer matches any item that
+// reads as that integer.
+
+// TestingT is the part of testing.TB the assertions use
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// TestHost is a chain of one deployed contract
+type TestHost struct {
+	Contract *NeoContract
+	Engine   *NeoVMExecutionEngine
+	Layout   *StorageLayoutManager // Slot keys of the storage assertions
+	GasLimit int64                 // Datoshi per invocation, unlimited when 0
+	Signers  []Uint160             // Accounts CheckWitness accepts
+}
+
+// Invocation is the outcome of invoking a method
+type Invocation struct {
+	Method        string
+	Stack         []NeoVMStackItem // Evaluation stack, bottom first
+	Err           error            // *NeoVMFault when the invocation FAULTed
+	GasConsumed   int64
+	Notifications []NeoVMNotification
+	Logs          []string
+}
+
+// NewTestHost creates a host with the default storage layout
+func NewTestHost() *TestHost {
+	return &TestHost{Layout: DefaultStorageLayout()}
+}
+
+// Deploy deploys contract, with empty storage, and calls its _deploy
+// method when it has one
+func (h *TestHost) Deploy(contract *NeoContract) error {
+	engine := NewNeoVMExecutionEngine(contract.Runtime)
+	h.Contract, h.Engine = contract, engine
+	for _, method := range contract.Methods {
+		if method.Name == DeployMethod {
+			return h.Invoke(DeployMethod, nil, false).Err
+		}
+	}
+	return nil
+}
+
+// Invoke invokes method of the deployed contract with args
+func (h *TestHost) Invoke(method string, args ...interface{}) *Invocation {
+	invocation := &Invocation{Method: method}
+	if h.Engine == nil {
+		invocation.Err = errors.New("no contract is deployed")
+		return invocation
+	}
+	items := make([]NeoVMStackItem, len(args))
+	for i, arg := range args {
+		item, err := StackItemOf(arg)
+		if err != nil {
+			invocation.Err = fmt.Errorf("argument %d: %w", i, err)
+			return invocation
+		}
+		items[i] = item
+	}
+
+	e := h.Engine
+	storage := make(map[string][]byte, len(e.Storage))
+	for key, value := range e.Storage {
+		storage[key] = value
+	}
+	notifications, logs := len(e.Notifications), len(e.Logs)
+	e.GasLimit, e.GasConsumed, e.Signers = h.GasLimit, 0, h.Signers
+	invocation.Stack, invocation.Err = e.Invoke(h.Contract, method, items...)
+	invocation.GasConsumed = e.GasConsumed
+	if invocation.Err != nil {
+		e.Storage = storage
+		e.Notifications, e.Logs = e.Notifications[:notifications], e.Logs[:logs]
+		return invocation
+	}
+	invocation.Notifications = append([]NeoVMNotification{}, e.Notifications[notifications:]...)
+	invocation.Logs = append([]string{}, e.Logs[logs:]...)
+	return invocation
+}
+
+// StackItemOf converts a Go value to a stack item: nil, bools, integers,
+// *big.Int, words from 2^255 up as the negative integers they are held as,
+// strings and byte slices, Uint160 as its script-order bytes,
+// []interface{} as an array and stack items as themselves
+func StackItemOf(value interface{}) (NeoVMStackItem, error) {
+	switch v := value.(type) {
+	case nil:
+		return NeoVMNull{}, nil
+	case NeoVMStackItem:
+		return v, nil
+	case bool:
+		return CreateNeoVMBoolean(v), nil
+	case int:
+		return CreateNeoVMInteger(v), nil
+	case int64:
+		return CreateNeoVMInteger(v), nil
+	case uint64:
+		return CreateNeoVMInteger(new(big.Int).SetUint64(v)), nil
+	case *big.Int:
+		if v.Sign() > 0 && v.BitLen() <= 256 {
+			return CreateNeoVMInteger(wordInteger(v)), nil
+		}
+		return CreateNeoVMInteger(new(big.Int).Set(v)), nil
+	case string:
+		return CreateNeoVMByteString(v), nil
+	case []byte:
+		return CreateNeoVMByteString(append([]byte{}, v...)), nil
+	case Uint160:
+		reverseBytes(v[:])
+		return CreateNeoVMByteString(v[:]), nil
+	case []interface{}:
+		items := make([]NeoVMStackItem, len(v))
+		for i, element := range v {
+			item, err := StackItemOf(element)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return CreateNeoVMArray(items), nil
+	}
+	return nil, fmt.Errorf("%T has no stack item", value)
+}
+
+// itemMatches reports whether actual is the expected item, reading actual
+// as an integer or boolean when that is what is expected. Integers match
+// as words, so -1 is 2^256-1.
+func itemMatches(actual, expected NeoVMStackItem) bool {
+	switch want := expected.(type) {
+	case *NeoVMInteger:
+		value, err := integerOf(actual, neoVMMaxIntegerSize)
+		return err == nil && toWord(value).Cmp(toWord(want.Value)) == 0
+	case *NeoVMBoolean:
+		value, err := booleanOf(actual, neoVMMaxIntegerSize)
+		return err == nil && value == want.Value
+	case *NeoVMArray:
+		items, ok := itemsOf(actual)
+		if !ok || len(items) != len(want.Items) {
+			return false
+		}
+		for i := range items {
+			if !itemMatches(items[i], want.Items[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return itemsEqual(actual, expected)
+}
+
+// matches reports whether items are the expected values
+func matches(t TestingT, items []NeoVMStackItem, expected []interface{}) bool {
+	t.Helper()
+	if len(items) != len(expected) {
+		return false
+	}
+	for i, value := range expected {
+		want, err := StackItemOf(value)
+		if err != nil {
+			t.Errorf("Expected value %d: %v", i, err)
+			return false
+		}
+		if !itemMatches(items[i], want) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExpectHalt fails t unless the invocation HALTed
+func (i *Invocation) ExpectHalt(t TestingT) bool {
+	t.Helper()
+	if i.Err != nil {
+		t.Errorf("%s: expected HALT, got %v", i.Method, i.Err)
+		return false
+	}
+	return true
+}
+
+// ExpectFault fails t unless the invocation FAULTed with a message
+// containing message
+func (i *Invocation) ExpectFault(t TestingT, message string) bool {
+	t.Helper()
+	var fault *NeoVMFault
+	if !errors.As(i.Err, &fault) || !strings.Contains(fault.Message, message) {
+		t.Errorf("%s: expected a FAULT with %q, got %v", i.Method, message, i.Err)
+		return false
+	}
+	return true
+}
+
+// ExpectResult fails t unless the invocation HALTed with the stack
+// holding values, bottom first
+func (i *Invocation) ExpectResult(t TestingT, values ...interface{}) bool {
+	t.Helper()
+	if !i.ExpectHalt(t) {
+		return false
+	}
+	if !matches(t, i.Stack, values) {
+		t.Errorf("%s: expected result %v, got %v", i.Method, values, i.Stack)
+		return false
+	}
+	return true
+}
+
+// ExpectNotification fails t unless the invocation raised event with the
+// state values
+func (i *Invocation) ExpectNotification(t TestingT, event string, values ...interface{}) bool {
+	t.Helper()
+	for _, n := range i.Notifications {
+		if items, _ := itemsOf(n.State); n.EventName == event && matches(t, items, values) {
+			return true
+		}
+	}
+	t.Errorf("%s: expected notification %s%v, got %v", i.Method, event, values, i.Notifications)
+	return false
+}
+
+// ExpectGasAtMost fails t if the invocation consumed more than limit
+// datoshi
+func (i *Invocation) ExpectGasAtMost(t TestingT, limit int64) bool {
+	t.Helper()
+	if i.GasConsumed > limit {
+		t.Errorf("%s: expected at most %d datoshi, consumed %d", i.Method, limit, i.GasConsumed)
+		return false
+	}
+	return true
+}
+
+// StorageAt returns the word stored at slot, 0 when unset
+func (h *TestHost) StorageAt(slot *big.Int) *big.Int {
+	if h.Engine == nil {
+		return new(big.Int)
+	}
+	return toWord(decodeInteger(h.Engine.Storage[string(h.Layout.SlotKey(slot))]))
+}
+
+// ExpectStorage fails t unless slot holds value
+func (h *TestHost) ExpectStorage(t TestingT, slot, value interface{}) bool {
+	t.Helper()
+	item, err := StackItemOf(slot)
+	var s *big.Int
+	if err == nil {
+		s, err = integerOf(item, neoVMMaxIntegerSize)
+	}
+	if err != nil {
+		t.Errorf("Expected storage slot: %v", err)
+		return false
+	}
+	got := h.StorageAt(s)
+	if !matches(t, []NeoVMStackItem{CreateNeoVMInteger(got)}, []interface{}{value}) {
+		t.Errorf("Expected slot %s to hold %v, got %s", s, value, got)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"math"
+	"testing"
+)
+
+// The gas benchmarks record the size and gas of each benchmark contract in
+// a baseline checked in next to them and fail when a metric grows by more
+// than -gas-tolerance percent over it. After an intended change:
+//
+//	go test ./tests/benchmarks -run TestGasBaseline -gas-update -gas-commit=$(git rev-parse HEAD)
+var (
+	gasBaselinePath = flag.String("gas-baseline", "testdata/gas_baseline.json", "gas baseline to compare with")
+	gasUpdate       = flag.Bool("gas-update", false, "rewrite the gas baseline with the current metrics")
+	gasTolerance    = flag.Float64("gas-tolerance", 5, "growth in percent a metric may have over the baseline")
+	gasWarn         = flag.Bool("gas-warn", false, "log regressions instead of failing")
+	gasCommit       = flag.String("gas-commit", "", "revision recorded in an updated baseline")
+)
+
+// gasInvocation is a benchmark call of a contract method
+type gasInvocation struct {
+	name   string // Measured metric name
+	method string
+	args   []interface{}
+}
+
+// gasBenchmarks are the contracts whose metrics the baseline tracks
+var gasBenchmarks = []struct {
+	name        string
+	exports     []string
+	invocations []gasInvocation
+	source      string
+}{
+	{
+		name:    "counter",
+		exports: []string{"increase", "get"},
+		invocations: []gasInvocation{
+			{"increase", "increase", []interface{}{5}},
+			{"get", "get", nil},
+		},
+		source: `object "Counter" {
+	code {
+		sstore(0, 10)
+		datacopy(0, dataoffset("runtime"), datasize("runtime"))
+		return(0, datasize("runtime"))
+	}
+	object "runtime" {
+		code {
+			function increase(n) -> total {
+				if gt(n, 100) { revert(0, 0) }
+				total := add(sload(0), n)
+				sstore(0, total)
+				log2(0, 0, 0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef, n)
+			}
+			function get() -> value { value := sload(0) }
+		}
+	}
+}`,
+	},
+	{
+		name:    "token",
+		exports: []string{"mint", "transfer", "balanceOf"},
+		invocations: []gasInvocation{
+			{"mint", "mint", []interface{}{1, 1000}},
+			{"transfer", "transfer", []interface{}{1, 2, 250}},
+			{"balanceOf", "balanceOf", []interface{}{2}},
+		},
+		source: `object "Token" {
+	code {
+		function balanceSlot(account) -> slot {
+			mstore(0, account)
+			mstore(32, 1)
+			slot := keccak256(0, 64)
+		}
+		function mint(to, amount) {
+			sstore(balanceSlot(to), add(sload(balanceSlot(to)), amount))
+			sstore(0, add(sload(0), amount))
+		}
+		function transfer(from, to, amount) -> ok {
+			let balance := sload(balanceSlot(from))
+			if lt(balance, amount) { revert(0, 0) }
+			sstore(balanceSlot(from), sub(balance, amount))
+			sstore(balanceSlot(to), add(sload(balanceSlot(to)), amount))
+			log3(0, 0, 0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef, from, to)
+			ok := 1
+		}
+		function balanceOf(account) -> balance {
+			balance := sload(balanceSlot(account))
+		}
+	}
+}`,
+	},
+	{
+		name:    "loops",
+		exports: []string{"sum", "fib"},
+		invocations: []gasInvocation{
+			{"sum 50", "sum", []interface{}{50}},
+			{"fib 30", "fib", []interface{}{30}},
+		},
+		source: `object "Loops" {
+	code {
+		function sum(n) -> total {
+			for { let i := 0 } lt(i, n) { i := add(i, 1) } {
+				switch mod(i, 3)
+				case 0 { total := add(total, mul(i, i)) }
+				case 1 { total := add(total, i) }
+				default { continue }
+			}
+		}
+		function fib(n) -> b {
+			let a := 0
+			b := 1
+			for { let i := 1 } lt(i, n) { i := add(i, 1) } {
+				let c := add(a, b)
+				a := b
+				b := c
+			}
+		}
+	}
+}`,
+	},
+	{
+		name:    "words",
+		exports: []string{"mix", "digest"},
+		invocations: []gasInvocation{
+			{"mix", "mix", []interface{}{0x1234, 77}},
+			{"digest", "digest", []interface{}{8}},
+		},
+		source: `object "Words" {
+	code {
+		function mix(a, b) -> r {
+			r := xor(shl(7, mul(a, b)), shr(3, not(a)))
+			r := add(r, sdiv(sub(0, b), 3))
+			r := and(r, byte(31, exp(a, 3)))
+		}
+		function digest(n) -> h {
+			for { let i := 0 } lt(i, n) { i := add(i, 1) } {
+				mstore(mul(i, 32), add(h, i))
+			}
+			h := keccak256(0, mul(n, 32))
+		}
+	}
+}`,
+	},
+}
+
+// currentGasBaseline compiles and runs the benchmark contracts
+func currentGasBaseline(t *testing.T) *GasBaseline {
+	baseline := NewGasBaseline()
+	baseline.Commit = *gasCommit
+	for _, b := range gasBenchmarks {
+		result, err := NewYulToNeoCompiler(CompilerConfig{OptimizationLevel: 2, ExportFunctions: b.exports}).Compile(b.source)
+		if err != nil {
+			t.Fatalf("%s: compilation failed: %v", b.name, err)
+		}
+		metrics := baseline.Record(b.name, result.Contract, result.GasReport)
+
+		host := NewTestHost()
+		if err := host.Deploy(result.Contract); err != nil {
+			t.Fatalf("%s: deploy failed: %v", b.name, err)
+		}
+		host.Engine.InteropServices["System.Contract.Call"] = callCryptoLib
+		for _, call := range b.invocations {
+			invocation := host.Invoke(call.method, call.args...)
+			if !invocation.ExpectHalt(t) {
+				continue
+			}
+			metrics.Measured[call.name] = invocation.GasConsumed
+		}
+	}
+	return baseline
+}
+
+// callCryptoLib serves the CryptoLib.keccak256 calls of keccak256. The fee
+// of the native method is not charged.
+func callCryptoLib(args []NeoVMStackItem) (NeoVMStackItem, error) {
+	method, _ := bytesOf(args[1])
+	items, _ := itemsOf(args[3])
+	if string(method) != "keccak256" || len(items) != 1 {
+		return nil, errors.New("only CryptoLib.keccak256 is available")
+	}
+	data, err := bytesOf(items[0])
+	if err != nil {
+		return nil, err
+	}
+	return CreateNeoVMByteString(keccak256(data)), nil
+}
+
+// TestGasBaseline compares the metrics of the benchmark contracts with the
+// checked in baseline
+func TestGasBaseline(t *testing.T) {
+	current := currentGasBaseline(t)
+	if *gasUpdate {
+		if err := current.Save(*gasBaselinePath); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	base, err := LoadGasBaseline(*gasBaselinePath)
+	if err != nil {
+		t.Fatalf("%v; run with -gas-update to create it", err)
+	}
+	for name := range current.Contracts {
+		if base.Contracts[name] == nil {
+			t.Logf("%s is not in the baseline; run with -gas-update to add it", name)
+		}
+	}
+	for _, regression := range CompareGasBaselines(base, current, *gasTolerance) {
+		if *gasWarn {
+			t.Logf("warning: %s (baseline %s)", regression, base.Commit)
+		} else {
+			t.Errorf("%s (baseline %s)", regression, base.Commit)
+		}
+	}
+}
+
+// TestGasBaselineComparison tests which metric changes count as regressions
+func TestGasBaselineComparison(t *testing.T) {
+	base := NewGasBaseline()
+	base.Contracts["token"] = &ContractMetrics{
+		Size:      1000,
+		Estimated: map[string]int64{"transfer": 2000, "mint": 500},
+		Measured:  map[string]int64{"transfer": 1000, "idle": 0},
+	}
+	current := NewGasBaseline()
+	current.Contracts["token"] = &ContractMetrics{
+		Size:      1040,                                                         // 4%, within tolerance
+		Estimated: map[string]int64{"transfer": 2200, "mint": 400, "burn": 900}, // 10%, cheaper, new
+		Measured:  map[string]int64{"transfer": 1000, "idle": 30},
+	}
+	current.Contracts["new"] = &ContractMetrics{Size: 10}
+
+	regressions := CompareGasBaselines(base, current, 5)
+	if len(regressions) != 2 {
+		t.Fatalf("Expected 2 regressions, got %v", regressions)
+	}
+	if r := regressions[0]; r.Metric != "estimated transfer" || r.Old != 2000 || r.New != 2200 || math.Abs(r.Percent-10) > 1e-9 {
+		t.Errorf("Unexpected regression %v", r)
+	}
+	if r := regressions[1]; r.Metric != "measured idle" || !math.IsInf(r.Percent, 1) {
+		t.Errorf("Unexpected regression %v", r)
+	}
+	if regressions := CompareGasBaselines(base, current, 50); len(regressions) != 1 {
+		t.Errorf("Expected only the metric growing from 0 past 50%%, got %v", regressions)
+	}
+
+	path := t.TempDir() + "/baseline.json"
+	current.Commit = "abc123"
+	if err := current.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadGasBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Commit != "abc123" || len(CompareGasBaselines(loaded, current, 0)) != 0 || loaded.Contracts["token"].Estimated["burn"] != 900 {
+		t.Errorf("Baseline did not round trip: %+v", loaded)
+	}
+}
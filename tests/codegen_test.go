@@ -1,7 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"math/big"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -142,12 +149,12 @@ func TestCodeGeneratorArithmetic(t *testing.T) {
 		{
 			name:   "comparison",
 			source: "lt(3, 5)",
-			expected: []NeoOpcode{PUSH5, PUSH3, LT, DROP},
+			expected: []NeoOpcode{PUSH5, PUSH3, GT, DROP}, // lt(a, b) is b > a with a on top
 		},
 		{
 			name:   "equality",
 			source: "eq(1, 1)",
-			expected: []NeoOpcode{PUSH1, PUSH1, EQUAL, DROP},
+			expected: []NeoOpcode{PUSH1, PUSH1, NUMEQUAL, DROP},
 		},
 		{
 			name:   "logical and",
@@ -212,7 +219,7 @@ func TestCodeGeneratorControlFlow(t *testing.T) {
 	}{
 		{
 			name: "if statement",
-			source: `if iszero(x) { revert(0, 0) }`,
+			source: `let x := 0 if iszero(x) { revert(0, 0) }`,
 			validate: func(instructions []NeoInstruction) error {
 				// Should have conditional jump
 				var hasJmpIfNot bool
@@ -230,7 +237,8 @@ func TestCodeGeneratorControlFlow(t *testing.T) {
 		},
 		{
 			name: "switch statement",
-			source: `switch x
+			source: `let x := 0 let y
+				switch x
 				case 0 { y := 1 }
 				case 1 { y := 2 }
 				default { y := 3 }`,
@@ -327,7 +335,7 @@ func TestCodeGeneratorBuiltins(t *testing.T) {
 		{
 			name:       "memory load",
 			function:   "mload(0)",
-			expectedSys: "System.Storage.Get", // Mapped to storage in NeoVM
+			expectedOp: SUBSTR, // Read from the memory buffer
 		},
 		{
 			name:       "get caller",
@@ -341,13 +349,13 @@ func TestCodeGeneratorBuiltins(t *testing.T) {
 		},
 		{
 			name:       "keccak256 hash",
-			function:   "keccak256(0x41)",
-			expectedSys: "Neo.Crypto.Keccak256",
+			function:   "keccak256(0, 32)",
+			expectedSys: "System.Contract.Call",
 		},
 		{
 			name:       "revert",
 			function:   "revert(0, 0)",
-			expectedOp: ABORT,
+			expectedOp: THROW,
 		},
 		{
 			name:       "return",
@@ -468,14 +476,15 @@ func TestCodeGeneratorLiterals(t *testing.T) {
 			validate: func(instructions []NeoInstruction) error {
 				found := false
 				for _, instr := range instructions {
-					if instr.Opcode == PUSHDATA1 && len(instr.Operand) == 4 {
-						// Check that the bytes match the hex value
-						expected := []byte{0xde, 0xad, 0xbe, 0xef}
-						if len(instr.Operand) >= 4 &&
+					if instr.Opcode == PUSHDATA1 && len(instr.Operand) == 5 {
+						// Check that the bytes are the integer, little-endian
+						expected := []byte{0xef, 0xbe, 0xad, 0xde, 0x00}
+						if len(instr.Operand) >= 5 &&
 							instr.Operand[0] == expected[0] &&
 							instr.Operand[1] == expected[1] &&
 							instr.Operand[2] == expected[2] &&
-							instr.Operand[3] == expected[3] {
+							instr.Operand[3] == expected[3] &&
+							instr.Operand[4] == expected[4] {
 							found = true
 							break
 						}
@@ -613,16 +622,16 @@ func TestCodeGeneratorFunctions(t *testing.T) {
 	}
 
 	// Check function table is populated
-	if len(generator.functionTable) != 2 {
-		t.Errorf("Expected 2 functions in function table, got %d", len(generator.functionTable))
+	if len(generator.Functions()) != 2 {
+		t.Errorf("Expected 2 functions in function table, got %d", len(generator.Functions()))
 	}
 
 	// Check specific functions exist
-	if _, exists := generator.functionTable["add"]; !exists {
+	if _, exists := generator.Functions()["add"]; !exists {
 		t.Error("Expected 'add' function in function table")
 	}
 
-	if _, exists := generator.functionTable["factorial"]; !exists {
+	if _, exists := generator.Functions()["factorial"]; !exists {
 		t.Error("Expected 'factorial' function in function table")
 	}
 
@@ -784,16 +793,17 @@ func TestCodeGeneratorStackTracking(t *testing.T) {
 	}
 
 	// Check stack tracking worked
-	if generator.stackTracker.maxDepth <= 0 {
+	usage := generator.StackUsage()
+	if usage.MaxDepth <= 0 {
 		t.Error("Expected positive maximum stack depth")
 	}
 
-	if generator.stackTracker.currentDepth < 0 {
+	if usage.CurrentDepth < 0 {
 		t.Error("Final stack depth should not be negative")
 	}
 
 	// Check that stack map was populated
-	if len(generator.stackTracker.stackMap) == 0 {
+	if usage.TrackedInstructions == 0 {
 		t.Error("Expected stack map to be populated")
 	}
 }
@@ -1056,7 +1066,7 @@ func TestCodeGeneratorInstructionProperties(t *testing.T) {
 		},
 		{
 			name:         "DUP",
-			createInstr:  func() NeoInstruction { return NewStackInstruction(DUP, 0) },
+			createInstr:  func() NeoInstruction { return NewStackInstruction(DUP) },
 			expectedSize: 1,
 			expectedPop:  0,
 			expectedPush: 1,
@@ -1064,17 +1074,24 @@ func TestCodeGeneratorInstructionProperties(t *testing.T) {
 		{
 			name:         "JMP",
 			createInstr:  func() NeoInstruction { return NewControlFlowInstruction(JMP, 100) },
-			expectedSize: 5, // 1 opcode + 4 address bytes
+			expectedSize: 2, // 1 opcode + 1 offset byte
 			expectedPop:  0,
 			expectedPush: 0,
 		},
 		{
-			name:         "SYSCALL",
-			createInstr:  func() NeoInstruction { return NewSyscallInstruction("System.Storage.Get") },
-			expectedSize: 1 + len("System.Storage.Get"),
+			name:         "JMP_L",
+			createInstr:  func() NeoInstruction { return NewControlFlowInstruction(JMP, 1000) },
+			expectedSize: 5, // 1 opcode + 4 offset bytes
 			expectedPop:  0,
 			expectedPush: 0,
 		},
+		{
+			name:         "SYSCALL",
+			createInstr:  func() NeoInstruction { return NewSyscallInstruction("System.Storage.Get") },
+			expectedSize: 5, // 1 opcode + 4-byte interop ID
+			expectedPop:  2, // Context and key
+			expectedPush: 1,
+		},
 	}
 
 	for _, test := range tests {
@@ -1094,50 +1111,2887 @@ func TestCodeGeneratorInstructionProperties(t *testing.T) {
 	}
 }
 
-// Helper functions for testing
+// TestCodeGeneratorJumpEncoding tests relative jump offsets and the
+// relaxation of jumps too far for the short form
+func TestCodeGeneratorJumpEncoding(t *testing.T) {
+	source := `object "Test" {
+		code {
+			for { let i := 0 } lt(i, 10) { i := add(i, 1) } {
+				if eq(i, 3) { continue }
+				sstore(0x1111111111111111111111111111111111111111111111111111111111111111, i)
+				sstore(0x2222222222222222222222222222222222222222222222222222222222222222, i)
+				sstore(0x3333333333333333333333333333333333333333333333333333333333333333, i)
+				sstore(0x4444444444444444444444444444444444444444444444444444444444444444, i)
+			}
+		}
+	}`
 
-func NewSymbolTable() *SymbolTable {
-	return &SymbolTable{
-		Symbols: make(map[string]*Symbol),
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{
+		SymbolTable:    NewSymbolTable(),
+		TypeTable:      NewTypeTable(),
+		ErrorCollector: NewErrorCollector(),
+		Metadata:       NewCompilationMetadata(),
+	}
+	generator := NewCodeGenerator(context)
+	contract, err := generator.Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+
+	short, long := 0, 0
+	for _, pending := range generator.pendingLabels {
+		instr := contract.Runtime[pending.InstructionIndex]
+		target, _ := generator.labelMap.Get(pending.Name)
+		distance := generator.byteOffset(target) - generator.byteOffset(pending.InstructionIndex)
+		var offset int
+		switch width := len(instr.Operand) / jumpOffsets(instr.Opcode); width {
+		case 1:
+			short++
+			offset = int(int8(instr.Operand[0]))
+		case 4:
+			long++
+			offset = int(int32(uint32(instr.Operand[0]) | uint32(instr.Operand[1])<<8 | uint32(instr.Operand[2])<<16 | uint32(instr.Operand[3])<<24))
+			if distance >= -128 && distance <= 127 {
+				t.Errorf("Expected %s to %s to be short, spanning %d bytes", OpcodeMnemonic(instr.Opcode), pending.Name, distance)
+			}
+		default:
+			t.Fatalf("Unexpected %s operand %x", OpcodeMnemonic(instr.Opcode), instr.Operand)
+		}
+		if !isLongJump(instr.Opcode) != (len(instr.Operand) == jumpOffsets(instr.Opcode)) {
+			t.Errorf("Expected %s to match its operand width", OpcodeMnemonic(instr.Opcode))
+		}
+		if offset != distance || pending.Offset != distance {
+			t.Errorf("Expected %s to %s at offset %d, got %d", OpcodeMnemonic(instr.Opcode), pending.Name, distance, offset)
+		}
+	}
+	// The continue is short, the loop back-edge spans the body
+	if short == 0 || long == 0 {
+		t.Errorf("Expected short and long jumps, got %d short and %d long", short, long)
 	}
 }
 
-func NewTypeTable() *TypeTable {
-	return &TypeTable{
-		Types: make(map[string]*TypeInfo),
+// TestCodeGeneratorOpcodeTable tests the opcode values and metadata against
+// the Neo N3 instruction set
+func TestCodeGeneratorOpcodeTable(t *testing.T) {
+	values := map[NeoOpcode]byte{
+		PUSHINT8: 0x00, PUSHDATA1: 0x0C, PUSH0: 0x10, NOP: 0x21, JMP: 0x22, JMPIF: 0x24, CALL: 0x34,
+		SYSCALL: 0x41, DROP: 0x45, DUP: 0x4A, SWAP: 0x50, ROT: 0x51, LDSFLD0: 0x58, CAT: 0x8B,
+		AND: 0x91, ADD: 0x9E, NUMEQUAL: 0xB3, PACK: 0xC0, PICKITEM: 0xCE, CONVERT: 0xDB,
+	}
+	for op, value := range values {
+		if byte(op) != value {
+			t.Errorf("Expected %s to be 0x%02X, got 0x%02X", OpcodeMnemonic(op), value, byte(op))
+		}
+	}
+
+	mnemonics := make(map[string]NeoOpcode)
+	for i := 0; i < 256; i++ {
+		op := NeoOpcode(i)
+		info, ok := LookupOpcode(op)
+		if !ok {
+			if name := OpcodeMnemonic(op); !strings.HasPrefix(name, "UNKNOWN") {
+				t.Errorf("Expected 0x%02X to be unknown, got %s", i, name)
+			}
+			continue
+		}
+		if other, taken := mnemonics[info.Mnemonic]; taken {
+			t.Errorf("%s names both 0x%02X and 0x%02X", info.Mnemonic, byte(other), i)
+		}
+		mnemonics[info.Mnemonic] = op
+	}
+	if len(mnemonics) != 196 {
+		t.Errorf("Expected 196 opcodes, got %d", len(mnemonics))
+	}
+	if OpcodeMnemonic(LDLOC0+2) != "LDLOC2" || OpcodeMnemonic(PUSH16) != "PUSH16" {
+		t.Errorf("Expected short forms named by index, got %s and %s", OpcodeMnemonic(LDLOC0+2), OpcodeMnemonic(PUSH16))
+	}
+
+	for _, op := range []NeoOpcode{JMP, JMPIF_L, CALL_L, TRY, TRY_L, ENDTRY} {
+		instr := NewControlFlowInstruction(op, 0)
+		if info, _ := LookupOpcode(op); instr.Size != 1+info.OperandSize || instr.GasCost != info.Price {
+			t.Errorf("Expected %s to take %d operand bytes at price %d, got size %d and price %d",
+				OpcodeMnemonic(op), info.OperandSize, info.Price, instr.Size, instr.GasCost)
+		}
+	}
+	if info, _ := LookupOpcode(PUSHDATA2); info.SizePrefix != 2 || info.Price != 512 {
+		t.Errorf("Expected PUSHDATA2 to have a 2-byte prefix at price 512, got %+v", info)
+	}
+	if pack := NewArithmeticInstruction(PACK); pack.StackPop != 0 || pack.GasCost != 2048 {
+		t.Errorf("Expected PACK to leave its variable stack effect unset, got %+v", pack)
 	}
 }
 
-func NewErrorCollector() *ErrorCollector {
-	return &ErrorCollector{
-		Errors:   []CompilerError{},
-		Warnings: []CompilerWarning{},
+// TestCodeGeneratorStackVerification tests the stack depth checks over the
+// control flow graph of the generated code
+func TestCodeGeneratorStackVerification(t *testing.T) {
+	source := `object "Test" { code {
+		function f(a) -> r { r := add(a, 1) }
+		switch calldataload(0) case 1 { sstore(0, f(2)) } default { if lt(1, 2) { sstore(1, 1) } }
+		for { let i := 0 } lt(i, 3) { i := add(i, 1) } { pop(f(i)) }
+	} }`
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, err := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()}).Generate(ast); err != nil {
+		t.Fatalf("Expected generated code to verify, got %v", err)
+	}
+
+	at := SourcePosition{Line: 3, Column: 5}
+	push := func(g *CodeGenerator, location SourcePosition) {
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(1)), location)
+	}
+	verify := func(max int, build func(g *CodeGenerator)) *StackError {
+		g := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable(), MaxStackDepth: max})
+		build(g)
+		if err := g.resolveLabels(); err != nil {
+			t.Fatalf("resolveLabels failed: %v", err)
+		}
+		var stackErr *StackError
+		if err := g.verifyStack(nil); err != nil && !errors.As(err, &stackErr) {
+			t.Fatalf("Expected a StackError, got %v", err)
+		}
+		return stackErr
+	}
+
+	tests := []struct {
+		name  string
+		max   int
+		build func(g *CodeGenerator)
+		want  string // Error message prefix, "" for none
+	}{
+		{"balanced branches", 0, func(g *CodeGenerator) {
+			push(g, SourcePosition{})
+			g.emitInstruction(NewControlFlowInstruction(JMPIF, 0), SourcePosition{})
+			g.addPendingLabel("join", len(g.instructions)-1)
+			push(g, SourcePosition{})
+			g.emitInstruction(NewStackInstruction(DROP), SourcePosition{})
+			g.markLabel("join")
+			g.emitInstruction(NewControlFlowInstruction(RET, 0), SourcePosition{})
+		}, ""},
+		{"unbalanced join", 0, func(g *CodeGenerator) {
+			push(g, SourcePosition{})
+			g.emitInstruction(NewControlFlowInstruction(JMPIF, 0), SourcePosition{})
+			g.addPendingLabel("join", len(g.instructions)-1)
+			push(g, at)
+			g.markLabel("join")
+			g.emitInstruction(NewControlFlowInstruction(RET, 0), SourcePosition{})
+		}, "stack depth 1 where another path has 0"},
+		{"underflow", 0, func(g *CodeGenerator) {
+			push(g, SourcePosition{})
+			g.emitInstruction(NewArithmeticInstruction(ADD), at)
+		}, "ADD pops 2 items from a stack of 1"},
+		{"too deep", 2, func(g *CodeGenerator) {
+			push(g, SourcePosition{})
+			push(g, SourcePosition{})
+			push(g, at)
+		}, "stack depth 3 exceeds the maximum of 2"},
+		{"callee returning too much", 0, func(g *CodeGenerator) {
+			call := NewControlFlowInstruction(CALL, 0)
+			call.StackPop, call.StackPush = 1, 1
+			push(g, SourcePosition{})
+			g.emitInstruction(call, SourcePosition{})
+			g.addPendingLabel("callee", len(g.instructions)-1)
+			g.emitInstruction(NewControlFlowInstruction(RET, 0), SourcePosition{})
+			g.markLabel("callee")
+			push(g, SourcePosition{})
+			g.emitInstruction(NewControlFlowInstruction(RET, 0), at)
+		}, "returns 2 items, its calls expect 1"},
+		{"catch with the exception", 0, func(g *CodeGenerator) {
+			g.emitInstruction(NewControlFlowInstruction(TRY, 0), SourcePosition{})
+			g.addPendingLabel("catch", len(g.instructions)-1)
+			g.emitInstruction(NewControlFlowInstruction(ENDTRY, 0), SourcePosition{})
+			g.addPendingLabel("end", len(g.instructions)-1)
+			g.markLabel("catch")
+			g.emitInstruction(NewStackInstruction(DROP), SourcePosition{})
+			g.emitInstruction(NewStackInstruction(DROP), at)
+			g.markLabel("end")
+		}, "DROP pops 1 items from a stack of 0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verify(test.max, test.build)
+			switch {
+			case test.want == "" && err != nil:
+				t.Errorf("Expected the code to verify, got %v", err)
+			case test.want != "" && err == nil:
+				t.Errorf("Expected %q", test.want)
+			case test.want != "" && (!strings.HasPrefix(err.Message, test.want) || err.Position != at):
+				t.Errorf("Expected %q at line 3, column 5, got %v", test.want, err)
+			}
+		})
+	}
+
+	// Compilation fails with the source location
+	compiler := NewYulToNeoCompiler(CompilerConfig{MaxStackDepth: 1})
+	result, err := compiler.Compile(`object "Test" { code { sstore(0, add(1, 2)) } }`)
+	if err == nil || len(result.Errors) == 0 || result.Errors[0].Line != 1 {
+		t.Errorf("Expected a located stack error, got %v", err)
 	}
 }
 
-// Test types for code generation validation (defined in supporting_types.go)
-type SymbolTable struct {
-	Symbols map[string]*Symbol
+// TestCodeGeneratorStorageLayout tests prefixed slot keys, slot derivation
+// and the cached storage context
+func TestCodeGeneratorStorageLayout(t *testing.T) {
+	layout, err := StorageLayoutFromConfig(CompilerConfig{StoragePrefix: "0x0102"})
+	if err != nil {
+		t.Fatalf("StorageLayoutFromConfig failed: %v", err)
+	}
+	key := layout.SlotKey(big.NewInt(5))
+	if len(key) != 34 || key[0] != 1 || key[1] != 2 || key[33] != 5 {
+		t.Errorf("Expected the prefix and the 32-byte slot, got %x", key)
+	}
+	if flagged, _ := StorageLayoutFromConfig(CompilerConfig{StoragePrefix: "01", CompilerFlags: []string{"--storage-prefix=0a"}}); flagged.Prefix()[0] != 0x0a {
+		t.Errorf("Expected --storage-prefix to override StoragePrefix")
+	}
+	if _, err := StorageLayoutFromConfig(CompilerConfig{StoragePrefix: "ff01"}); err == nil {
+		t.Errorf("Expected a prefix starting with 0xff to be refused")
+	}
+	result, err := NewYulToNeoCompiler(CompilerConfig{StoragePrefix: "zz"}).Compile(`object "T" { code { sstore(0, 1) } }`)
+	if err == nil || !strings.Contains(err.Error(), "invalid configuration") || len(result.Errors) != 1 || result.Errors[0].Phase != "Configuration" {
+		t.Errorf("Expected an invalid prefix to fail compilation, got %v", err)
+	}
+
+	// Solidity's slots of mapping(uint => ...) and uint[] at slot 0
+	mapping := layout.MappingSlot(big.NewInt(0), big.NewInt(0))
+	if mapping.Text(16) != "ad3228b676f7d3cd4284a5443f17f1962b36e491b30a40b2405849e597ba5fb5" {
+		t.Errorf("Unexpected mapping slot %x", mapping)
+	}
+	element := layout.ArrayElementSlot(big.NewInt(0), big.NewInt(2), 1)
+	if element.Text(16) != "290decd9548b62a8d60345a988386fc84ba6bc95484008f6362f93160ef3e565" {
+		t.Errorf("Unexpected array element slot %x", element)
+	}
+
+	ast, err := NewYulParser().Parse(`object "Test" { code {
+		sstore(0, add(sload(0), 1))
+		function f() { sstore(1, sload(0)) }
+		f()
+	} }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{SymbolTable: NewSymbolTable(), StorageLayout: layout}
+	contract, err := NewCodeGenerator(context).Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	contexts, prefixed, deletes := 0, false, false
+	for _, instr := range contract.Runtime {
+		if instr.Opcode == SYSCALL {
+			switch string(instr.Operand) {
+			case "System.Storage.GetContext":
+				contexts++
+			case "System.Storage.Delete":
+				deletes = true
+			}
+		}
+		prefixed = prefixed || string(instr.Operand) == "\x01\x02"
+	}
+	if contexts != 1 {
+		t.Errorf("Expected the storage context to be read once, got %d", contexts)
+	}
+	if !prefixed {
+		t.Errorf("Expected slot keys with the configured prefix")
+	}
+	if !deletes {
+		t.Errorf("Expected storing 0 to delete the slot")
+	}
 }
 
-type Symbol struct {
-	Name     string
-	Type     string
-	Scope    string
-	Location SourcePosition
+// TestCodeGeneratorAddressTranslation tests the mapping of address words
+// onto script hashes
+func TestCodeGeneratorAddressTranslation(t *testing.T) {
+	neo := "0x0909090909090909090909090909090909090909"
+	registry, err := AddressTranslationFromConfig(CompilerConfig{AddressStrategy: "registry", AddressRegistry: []string{"0x1234=" + neo}})
+	if err != nil {
+		t.Fatalf("AddressTranslationFromConfig failed: %v", err)
+	}
+	if word := registry.Word(neo); word.Int64() != 0x1234 {
+		t.Errorf("Expected the registered address, got %#x", word)
+	}
+	if hash, _ := registry.ScriptHash(big.NewInt(0x1234)); hash != neo {
+		t.Errorf("Expected the registered script hash, got %s", hash)
+	}
+	if hash, _ := registry.ScriptHash(big.NewInt(0x99)); hash != "0x0000000000000000000000000000000000000099" {
+		t.Errorf("Expected an identity hash for an unregistered address, got %s", hash)
+	}
+	checksum, _ := AddressTranslationFromConfig(CompilerConfig{CompilerFlags: []string{"--address-strategy=checksum"}})
+	if _, err := checksum.ScriptHash(addressModulus); err == nil {
+		t.Errorf("Expected the checksum strategy to refuse a word wider than 160 bits")
+	}
+	if _, err := AddressTranslationFromConfig(CompilerConfig{AddressRegistry: []string{"0x1=" + neo}}); err == nil {
+		t.Errorf("Expected a registry to need the registry strategy")
+	}
+	if _, err := AddressTranslationFromConfig(CompilerConfig{AddressStrategy: "registry", AddressRegistry: []string{"0x1=" + neo, "0x2=" + neo}}); err == nil {
+		t.Errorf("Expected a script hash registered twice to be refused")
+	}
+	if _, err := NewYulToNeoCompiler(CompilerConfig{AddressStrategy: "hashed"}).Compile(`object "T" { code { sstore(0, 1) } }`); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected an unknown strategy to fail compilation, got %v", err)
+	}
+
+	ast, err := NewYulParser().Parse(`object "Test" { code {
+		sstore(0, caller())
+		sstore(1, balance(sload(0)))
+	} }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	routines := func(translation *AddressTranslation) map[string]bool {
+		g := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable(), AddressTranslation: translation})
+		if _, err := g.Generate(ast); err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+		found := make(map[string]bool)
+		for _, name := range []string{addressWordRoutine, addressScriptHashRoutine} {
+			_, found[name] = g.labelMap.Get(name)
+		}
+		return found
+	}
+	if found := routines(nil); found[addressWordRoutine] || found[addressScriptHashRoutine] {
+		t.Errorf("Expected identity conversions inline, got routines %v", found)
+	}
+	if found := routines(registry); !found[addressWordRoutine] || !found[addressScriptHashRoutine] {
+		t.Errorf("Expected the registry conversions as routines, got %v", found)
+	}
 }
 
-type TypeTable struct {
-	Types map[string]*TypeInfo
+// TestCodeGeneratorCanaryMode tests sstore changelog instrumentation
+func TestCodeGeneratorCanaryMode(t *testing.T) {
+	source := `object "Test" {
+		code {
+			sstore(0, 1)
+		}
+	}`
+
+	countPuts := func(canary bool) int {
+		parser := NewYulParser()
+		ast, err := parser.Parse(source)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+
+		context := &CompilerContext{
+			SymbolTable:    NewSymbolTable(),
+			TypeTable:      NewTypeTable(),
+			ErrorCollector: NewErrorCollector(),
+			Metadata:       NewCompilationMetadata(),
+			CanaryTracking: canary,
+		}
+		contract, err := NewCodeGenerator(context).Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+
+		puts := 0
+		for _, instr := range contract.Runtime {
+			if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Storage.Put" {
+				puts++
+			}
+		}
+		return puts
+	}
+
+	if puts := countPuts(false); puts != 1 {
+		t.Errorf("Expected 1 storage write without canary mode, got %d", puts)
+	}
+	// Changelog entry and head pointer in addition to the write itself
+	if puts := countPuts(true); puts != 3 {
+		t.Errorf("Expected 3 storage writes in canary mode, got %d", puts)
+	}
+
+	// Canary mode is stripped from release builds
+	release := NewYulToNeoCompiler(CompilerConfig{CompilerFlags: []string{"--canary"}})
+	if release.context.CanaryTracking {
+		t.Errorf("Expected canary tracking to be disabled in release builds")
+	}
+	staging := NewYulToNeoCompiler(CompilerConfig{BuildMode: "staging", CompilerFlags: []string{"--canary"}})
+	if !staging.context.CanaryTracking {
+		t.Errorf("Expected canary tracking in staging builds")
+	}
+
+	// Changelog keys fit NeoVM's 64-byte keys with the longest slot keys
+	prefix := bytes.Repeat([]byte{0xab}, maxStoragePrefix)
+	result, err := NewYulToNeoCompiler(CompilerConfig{BuildMode: "staging", CanaryMode: true, StoragePrefix: hex.EncodeToString(prefix)}).Compile(source)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	host := NewTestHost()
+	if err := host.Deploy(result.Contract); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	txHash := bytes.Repeat([]byte{0x11}, 32)
+	host.Engine.InteropServices["System.Runtime.GetScriptContainer"] = func([]NeoVMStackItem) (NeoVMStackItem, error) {
+		return &NeoVMArray{Items: []NeoVMStackItem{&NeoVMByteString{Value: txHash}}}, nil
+	}
+	host.Engine.InteropServices["System.Contract.Call"] = func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+		items, _ := itemsOf(args[3])
+		data, err := bytesOf(items[0])
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(data)
+		return &NeoVMByteString{Value: digest[:]}, nil
+	}
+	host.Invoke("main").ExpectHalt(t)
+	slotKey := append(prefix, make([]byte, 32)...)
+	changelog := CanaryChangelogKey(txHash, slotKey)
+	if _, ok := host.Engine.Storage[string(changelog)]; !ok {
+		t.Errorf("Expected a changelog entry at %x", changelog)
+	}
+	for key := range host.Engine.Storage {
+		if len(key) > 64 {
+			t.Errorf("Expected storage keys of at most 64 bytes, got %d bytes at %x", len(key), key)
+		}
+	}
+
+	// A mistyped build mode fails rather than stripping the tracking
+	_, err = NewYulToNeoCompiler(CompilerConfig{BuildMode: "stagign", CompilerFlags: []string{"--canary"}}).Compile(`object "T" { code { sstore(0, 1) } }`)
+	if err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected an invalid build mode to fail compilation, got %v", err)
+	}
 }
 
-type TypeInfo struct {
-	Name   string
-	Size   int
-	Signed bool
+// TestCodeGeneratorTypedVariables tests push and conversion of typed variables
+func TestCodeGeneratorTypedVariables(t *testing.T) {
+	generate := func(code string) []NeoInstruction {
+		ast, err := NewYulParser().Parse(`object "Test" { code { ` + code + ` } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		contract, err := NewCodeGenerator(nil).Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+		return contract.Runtime
+	}
+	has := func(instructions []NeoInstruction, opcode NeoOpcode, operand []byte) bool {
+		for _, instr := range instructions {
+			if instr.Opcode == opcode && (operand == nil || string(instr.Operand) == string(operand)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Uninitialized bool defaults to false rather than integer zero
+	pushFalse := NewPushInstruction(CreateNeoVMBoolean(false))
+	if code := generate(`let flag:bool`); !has(code, pushFalse.Opcode, pushFalse.Operand) {
+		t.Errorf("Expected false pushed for an uninitialized bool")
+	}
+	// Integer value assigned to a bool is converted
+	if code := generate(`let flag:bool := sload(0)`); !has(code, CONVERT, []byte{byte(BooleanType)}) {
+		t.Errorf("Expected CONVERT to Boolean")
+	}
+	if code := generate(`let flag:bool := true`); has(code, CONVERT, nil) {
+		t.Errorf("Expected no conversion for a bool literal")
+	}
+	// Narrowing to u8 masks the value
+	if code := generate(`let x:u8 := sload(0)`); !has(code, AND, nil) {
+		t.Errorf("Expected AND mask when narrowing to u8")
+	}
+	// Only the storage routine after the top-level code converts
+	code := generate(`let x := sload(0)`)
+	for i, instr := range code {
+		if instr.Opcode == RET {
+			code = code[:i]
+			break
+		}
+	}
+	if has(code, AND, nil) || has(code, CONVERT, nil) {
+		t.Errorf("Expected no conversion for untyped variables")
+	}
 }
 
-type ErrorCollector struct {
-	Errors   []CompilerError
-	Warnings []CompilerWarning
-}
\ No newline at end of file
+// TestCodeGeneratorLeaveCleanup tests that leave, break and continue inside
+// nested control flow unwind the stack and reach a single function exit
+func TestCodeGeneratorLeaveCleanup(t *testing.T) {
+	source := `object "Test" {
+		code {
+			function f(n) -> r {
+				for { let i := 0 } lt(i, n) { i := add(i, 1) } {
+					switch i
+					case 3 { leave }
+					default {
+						if eq(i, 1) { continue }
+						if eq(i, 2) { break }
+					}
+				}
+				r := 1
+			}
+		}
+	}`
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{
+		SymbolTable:    NewSymbolTable(),
+		TypeTable:      NewTypeTable(),
+		ErrorCollector: NewErrorCollector(),
+		Metadata:       NewCompilationMetadata(),
+	}
+	generator := NewCodeGenerator(context)
+	generator.AddFunctionHook("f", NewReentrancyGuard("lock"))
+	contract, err := generator.Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+
+	info := generator.Functions()["f"]
+	body := contract.Runtime[info.StartOffset:info.EndOffset]
+
+	rets, releases := 0, 0
+	for _, instr := range body {
+		if instr.Opcode == RET {
+			rets++
+		}
+		if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Storage.Delete" {
+			releases++
+		}
+	}
+	if rets != 1 || body[len(body)-1].Opcode != RET {
+		t.Errorf("Expected a single RET at the end of f, got %d", rets)
+	}
+	if releases != 1 {
+		t.Errorf("Expected the guard to be released once at the exit, got %d", releases)
+	}
+
+	// The exit label sits right before the release code, key, storage
+	// context and Delete, which is followed by loading r and RET
+	exit := -1
+	for _, label := range contract.EntryPoints.Keys() {
+		if strings.HasPrefix(label, "func_exit_f") {
+			exit, _ = contract.EntryPoints.Get(label)
+		}
+	}
+	if exit != info.EndOffset-5 {
+		t.Fatalf("Expected exit label at %d, got %d", info.EndOffset-5, exit)
+	}
+
+	// leave, break and continue each drop the switch value before jumping
+	unwinding := 0
+	for i := 1; i < len(body); i++ {
+		if body[i].Opcode == JMP && body[i-1].Opcode == DROP {
+			unwinding++
+		}
+	}
+	if unwinding != 3 {
+		t.Errorf("Expected 3 unwinding jumps, got %d", unwinding)
+	}
+
+	// leave outside of a function is rejected
+	ast, err = NewYulParser().Parse(`object "Test" { code { leave } }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, err := NewCodeGenerator(context).Generate(ast); err == nil {
+		t.Errorf("Expected an error for leave outside of a function")
+	}
+}
+
+// TestCodeGeneratorSwitchLiteralCases tests that hex and bool cases compare
+// numerically and string cases compare bytes
+func TestCodeGeneratorSwitchLiteralCases(t *testing.T) {
+	source := `object "Test" {
+		code {
+			switch shr(224, calldataload(0))
+			case 0x70a08231 { sstore(0, 1) }
+			case "transfer" { sstore(0, 2) }
+			case true { sstore(0, 3) }
+			default { sstore(0, 4) }
+		}
+	}`
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{
+		SymbolTable:    NewSymbolTable(),
+		TypeTable:      NewTypeTable(),
+		ErrorCollector: NewErrorCollector(),
+		Metadata:       NewCompilationMetadata(),
+	}
+	contract, err := NewCodeGenerator(context).Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+
+	var comparisons []NeoOpcode
+	var pushed []string
+	for i, instr := range contract.Runtime {
+		if instr.Opcode == EQUAL || instr.Opcode == NUMEQUAL {
+			comparisons = append(comparisons, instr.Opcode)
+			pushed = append(pushed, string(contract.Runtime[i-1].Operand))
+		}
+	}
+	if len(comparisons) != 3 || comparisons[0] != NUMEQUAL || comparisons[1] != EQUAL || comparisons[2] != NUMEQUAL {
+		t.Fatalf("Expected NUMEQUAL, EQUAL, NUMEQUAL comparisons, got %v", comparisons)
+	}
+
+	selector := NewPushInstruction(CreateNeoVMInteger(0x70a08231))
+	if pushed[0] != string(selector.Operand) {
+		t.Errorf("Expected selector pushed as an integer, got %x", pushed[0])
+	}
+	if pushed[1] != string(NewPushInstruction(CreateNeoVMByteString("transfer")).Operand) {
+		t.Errorf("Expected string case pushed as bytes, got %x", pushed[1])
+	}
+}
+
+func TestCodeGeneratorDataSegments(t *testing.T) {
+	source := `object "Test" {
+		code {
+			datacopy(0, dataoffset("table"), datasize("table"))
+		}
+		data "name" "neo"
+		data "table" hex"00ff10"
+	}`
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{
+		SymbolTable:    NewSymbolTable(),
+		TypeTable:      NewTypeTable(),
+		ErrorCollector: NewErrorCollector(),
+		Metadata:       NewCompilationMetadata(),
+	}
+	contract, err := NewCodeGenerator(context).Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+
+	if got := contract.DataSegments.Keys(); len(got) != 2 || got[0] != "name" || got[1] != "table" {
+		t.Fatalf("Expected data segments in declaration order, got %v", got)
+	}
+	if table, _ := contract.DataSegments.Get("table"); string(table) != "\x00\xff\x10" {
+		t.Errorf("Expected hex payload to be decoded, got %x", table)
+	}
+
+	// After allocating memory, arguments are pushed last to first: size 3,
+	// offset 3 (after "neo"), then 0
+	runtime := contract.Runtime[4:]
+	if runtime[0].Opcode != PUSH3 || runtime[1].Opcode != PUSH3 || runtime[2].Opcode != PUSH0 {
+		t.Errorf("Expected datasize and dataoffset to push constants, got %v %v %v",
+			runtime[0].Opcode, runtime[1].Opcode, runtime[2].Opcode)
+	}
+	if string(runtime[3].Operand) != "neo\x00\xff\x10" {
+		t.Errorf("Expected datacopy to push the data area, got %x", runtime[3].Operand)
+	}
+	foundCopy := false
+	for _, instr := range runtime {
+		foundCopy = foundCopy || instr.Opcode == MEMCPY
+	}
+	if !foundCopy {
+		t.Errorf("Expected datacopy to copy the data area into memory with MEMCPY")
+	}
+
+	ast, _ = NewYulParser().Parse(`object "Test" { code { pop(datasize("missing")) } }`)
+	if _, err := NewCodeGenerator(context).Generate(ast); err == nil || !strings.Contains(err.Error(), "unknown data segment") {
+		t.Errorf("Expected unknown data segment error, got %v", err)
+	}
+}
+
+func TestCodeGeneratorDeployRuntimeSeparation(t *testing.T) {
+	source := `object "Token" {
+		code {
+			sstore(0, caller())
+			datacopy(0, dataoffset("runtime"), datasize("runtime"))
+			return(0, datasize("runtime"))
+			function helper() -> r { r := 1 }
+		}
+		object "runtime" {
+			code {
+				sstore(1, helper())
+				function helper() -> r { r := 2 }
+			}
+		}
+	}`
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{
+		SymbolTable:    NewSymbolTable(),
+		TypeTable:      NewTypeTable(),
+		ErrorCollector: NewErrorCollector(),
+		Metadata:       NewCompilationMetadata(),
+	}
+	contract, err := NewCodeGenerator(context).Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	if len(contract.Constructor) == 0 || len(contract.Runtime) == 0 {
+		t.Fatalf("Expected separate constructor and runtime code, got %d and %d instructions",
+			len(contract.Constructor), len(contract.Runtime))
+	}
+
+	// The runtime object comes first, followed by _deploy
+	deploy, ok := contract.EntryPoints.Get(DeployMethod)
+	if !ok {
+		t.Fatalf("Expected a %s entry point", DeployMethod)
+	}
+	for _, instr := range contract.Runtime[:deploy] {
+		if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Runtime.GetCallingScriptHash" {
+			t.Errorf("Expected constructor code to stay out of the runtime object")
+		}
+	}
+
+	runtimeSize := 0
+	for _, instr := range contract.Runtime[:deploy] {
+		runtimeSize += instr.Size
+	}
+	sizePush := NewPushInstruction(CreateNeoVMInteger(runtimeSize))
+	foundSize := false
+	for _, instr := range contract.Constructor {
+		if instr.Opcode == sizePush.Opcode && string(instr.Operand) == string(sizePush.Operand) {
+			foundSize = true
+		}
+		if instr.Opcode == SUBSTR {
+			t.Errorf("Expected datacopy of the runtime object not to copy anything")
+		}
+	}
+	if !foundSize {
+		t.Errorf("Expected datasize(\"runtime\") to push the runtime script size %d", runtimeSize)
+	}
+	if _, ok := contract.EntryPoints.Get("func_helper"); !ok {
+		t.Errorf("Expected runtime functions in the contract entry points")
+	}
+
+	// _deploy skips the constructor on updates, runs it on the first
+	// deployment with the deployer as caller and ends at its return
+	var method *ContractMethod
+	for _, m := range contract.Methods {
+		if m.Name == DeployMethod {
+			method = m
+		}
+	}
+	if method == nil || len(method.Parameters) != 2 || method.Parameters[1].Type != "Boolean" || len(method.Returns) != 0 {
+		t.Fatalf("Expected the %s method, got %+v", DeployMethod, method)
+	}
+	code := contract.Runtime[deploy:]
+	if code[0].Opcode != DROP || code[1].Opcode != JMPIFNOT || code[2].Opcode != RET {
+		t.Errorf("Expected _deploy to return early on updates")
+	}
+	deployer, returned := false, false
+	for i, instr := range code {
+		if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Runtime.GetCallingScriptHash" {
+			t.Errorf("Expected caller() in _deploy not to be ContractManagement")
+		}
+		deployer = deployer || instr.Opcode == SYSCALL && string(instr.Operand) == "System.Runtime.GetScriptContainer"
+		returned = returned || i >= 2 && code[i-2].Opcode == DROP && code[i-1].Opcode == DROP && instr.Opcode == RET
+	}
+	if !deployer || !returned {
+		t.Errorf("Expected the deployer as caller and return to drop its memory range")
+	}
+	if _, ok := contract.EntryPoints.Get(deployLabel("func_helper")); !ok {
+		t.Errorf("Expected constructor functions under their own labels")
+	}
+}
+
+func TestCodeGeneratorVariableSlots(t *testing.T) {
+	source := `object "Test" {
+		code {
+			let x := 5
+			if x { let z := 1 }
+			if x { let z := 2 }
+			x := f(x, 7)
+			function f(a, b) -> r {
+				let t := add(a, b)
+				r := t
+			}
+		}
+	}`
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{
+		SymbolTable:    NewSymbolTable(),
+		TypeTable:      NewTypeTable(),
+		ErrorCollector: NewErrorCollector(),
+		Metadata:       NewCompilationMetadata(),
+	}
+	generator := NewCodeGenerator(context)
+	contract, err := generator.Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+
+	mnemonics := func(instructions []NeoInstruction) []string {
+		var names []string
+		for _, instr := range instructions {
+			names = append(names, OpcodeMnemonic(instr.Opcode))
+		}
+		return names
+	}
+
+	// Top-level variables are static fields; the z of sibling blocks share
+	// a slot
+	top := mnemonics(contract.Runtime)
+	if top[0] != "INITSSLOT" || contract.Runtime[0].Operand[0] != 2 {
+		t.Fatalf("Expected INITSSLOT 2 first, got %v", top)
+	}
+	if top[1] != "PUSH5" || top[2] != "STSFLD0" {
+		t.Errorf("Expected let x := 5 to store static field 0, got %v", top[1:3])
+	}
+	if joined := strings.Join(top, " "); strings.Count(joined, "STSFLD1") != 2 || strings.Contains(joined, "STSFLD2") {
+		t.Errorf("Expected both z in static field 1, got %v", top)
+	}
+
+	// Parameters are arguments, return and let variables are locals
+	info := generator.Functions()["f"]
+	body := strings.Join(mnemonics(contract.Runtime[info.StartOffset:info.EndOffset]), " ")
+	want := "INITSLOT PUSH0 STLOC0 LDARG1 LDARG0 OVER OVER XOR PUSH0 LT JMPIF SWAP PUSHDATA1 XOR SWAP ADD PUSHDATA1 XOR JMP ADD STLOC1 LDLOC1 STLOC0 LDLOC0 RET"
+	if body != want {
+		t.Errorf("Expected f to compile to %q, got %q", want, body)
+	}
+	if operand := contract.Runtime[info.StartOffset].Operand; operand[0] != 2 || operand[1] != 2 {
+		t.Errorf("Expected INITSLOT with 2 locals and 2 arguments, got %v", operand)
+	}
+
+	// A variable's slot is reused after its last use, except in a loop's
+	// init block
+	reused, _ := NewYulParser().Parse(`object "T" { code {
+		function g(a) -> r {
+			let t := add(a, 1)
+			r := t
+			let u := 2
+			r := add(r, u)
+			for { let i := 0 let n := 3 } lt(i, n) { i := add(i, 1) } { }
+		}
+	} }`)
+	generator = NewCodeGenerator(context)
+	if contract, err = generator.Generate(reused); err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	info = generator.Functions()["g"]
+	if operand := contract.Runtime[info.StartOffset].Operand; operand[0] != 3 {
+		t.Errorf("Expected INITSLOT with r, t or u, i and n in 3 locals, got %v", operand)
+	}
+
+	// A nested block is a scope of its own, and all its statements run
+	result, err := NewYulToNeoCompiler(CompilerConfig{}).Compile(`object "T" { code {
+		let a := 1
+		{ a := 3 let b := 4 sstore(2, b) }
+		sstore(1, a)
+	} }`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	host := NewTestHost()
+	if err := host.Deploy(result.Contract); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	host.Invoke("main").ExpectHalt(t)
+	host.ExpectStorage(t, 1, 3)
+	host.ExpectStorage(t, 2, 4)
+
+	for _, invalid := range []string{
+		`object "T" { code { y := 1 } }`,
+		`object "T" { code { if 1 { let z := 1 } sstore(0, z) } }`,
+		`object "T" { code { { let z := 1 } sstore(0, z) } }`,
+		`object "T" { code { let v := 1 function g() -> r { r := v } } }`,
+	} {
+		ast, err := NewYulParser().Parse(invalid)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if _, err := NewCodeGenerator(context).Generate(ast); err == nil || !strings.Contains(err.Error(), "undefined variable") {
+			t.Errorf("Expected undefined variable error for %s, got %v", invalid, err)
+		}
+	}
+}
+
+// TestCodeGeneratorHalt tests that return and stop end the invocation from
+// any depth of Yul function calls
+func TestCodeGeneratorHalt(t *testing.T) {
+	invoke := func(source string, exports []string, method string, args ...interface{}) (*TestHost, *Invocation) {
+		t.Helper()
+		result, err := NewYulToNeoCompiler(CompilerConfig{ExportFunctions: exports}).Compile(source)
+		if err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		host := NewTestHost()
+		if err := host.Deploy(result.Contract); err != nil {
+			t.Fatalf("Deploy failed: %v", err)
+		}
+		return host, host.Invoke(method, args...)
+	}
+
+	// stop in a function ends main, not just the function
+	host, invocation := invoke(`object "T" { code {
+		f()
+		sstore(1, 7)
+		function f() { stop() }
+	} }`, nil, "main")
+	invocation.ExpectResult(t)
+	host.ExpectStorage(t, 1, 0)
+
+	// So does return, from nested calls and a switch, and main returns
+	// its data
+	host, invocation = invoke(`object "T" { code {
+		switch 1
+		case 1 { f() }
+		sstore(1, 7)
+		function f() { g() sstore(2, 7) }
+		function g() { if 1 { return(0, 0) } }
+	} }`, nil, "main")
+	invocation.ExpectResult(t, "")
+	host.ExpectStorage(t, 1, 0)
+	host.ExpectStorage(t, 2, 0)
+
+	// In the top-level code they drop the values switches hold
+	host, invocation = invoke(`object "T" { code {
+		switch 1
+		case 1 { switch 2 case 2 { stop() } }
+		sstore(1, 7)
+	} }`, nil, "main")
+	invocation.ExpectResult(t)
+	host.ExpectStorage(t, 1, 0)
+
+	// main returns the memory range of return as a byte string
+	word := make([]byte, 32)
+	word[31] = 42
+	_, invocation = invoke(`object "T" { code {
+		mstore(0, 42)
+		return(0, 32)
+	} }`, nil, "main")
+	invocation.ExpectResult(t, word)
+	_, invocation = invoke(`object "T" { code {
+		mstore(0, 42)
+		switch 1
+		case 1 { f() }
+		function f() { return(31, 1) }
+	} }`, nil, "main")
+	invocation.ExpectResult(t, []byte{42})
+
+	// Running off the end of code calling return returns no data
+	_, invocation = invoke(`object "T" { code {
+		if 0 { return(0, 0) }
+	} }`, nil, "main")
+	invocation.ExpectResult(t, "")
+
+	// Exported methods end with the halt, returning its data when they
+	// return a value
+	host, invocation = invoke(`object "T" { code {
+		function set(v) { sstore(1, v) halt() sstore(2, v) }
+		function get() -> r { r := 1 halt() }
+		function word() -> r { mstore(0, 42) return(0, 32) }
+		function halt() { stop() }
+	} }`, []string{"set", "get", "word"}, "set", 7)
+	invocation.ExpectResult(t)
+	host.ExpectStorage(t, 1, 7)
+	host.ExpectStorage(t, 2, 0)
+	host.Invoke("get").ExpectResult(t, "")
+	host.Invoke("word").ExpectResult(t, word)
+
+	// Reverts still fault through the halt handlers
+	_, invocation = invoke(`object "T" { code {
+		f()
+		function f() { if 1 { revert(0, 0) } stop() }
+	} }`, nil, "main")
+	invocation.ExpectFault(t, "execution reverted")
+}
+
+func TestCodeGeneratorCallingConvention(t *testing.T) {
+	source := `object "Test" {
+		code {
+			let q, r := divmod(7, 2)
+			store(q, r)
+			function divmod(a, b) -> quot, rem {
+				quot := div(a, b)
+				rem := mod(a, b)
+			}
+			function store(k, v) {
+				sstore(k, v)
+			}
+		}
+	}`
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{
+		SymbolTable:    NewSymbolTable(),
+		TypeTable:      NewTypeTable(),
+		ErrorCollector: NewErrorCollector(),
+		Metadata:       NewCompilationMetadata(),
+	}
+	generator := NewCodeGenerator(context)
+	contract, err := generator.Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+
+	var top []string
+	var calls [][2]int
+	for _, instr := range contract.Runtime {
+		name := OpcodeMnemonic(instr.Opcode)
+		if instr.Opcode == CALL {
+			calls = append(calls, [2]int{instr.StackPop, instr.StackPush})
+		}
+		top = append(top, name)
+		if instr.Opcode == JMP {
+			break // First function body starts here
+		}
+	}
+	// The storage context is cached first. Arguments last to first, first
+	// return value stored first, and no DROP after calling a function
+	// without return values
+	want := "INITSSLOT SYSCALL STSFLD2 PUSH2 PUSH7 CALL STSFLD0 STSFLD1 LDSFLD1 LDSFLD0 CALL JMP"
+	if got := strings.Join(top, " "); got != want {
+		t.Errorf("Expected top-level code %q, got %q", want, got)
+	}
+
+	// divmod replaces 2 arguments with 2 results, store consumes 2
+	if len(calls) != 2 || calls[0] != [2]int{2, 2} || calls[1] != [2]int{2, 0} {
+		t.Errorf("Expected CALL stack effects [[2 2] [2 0]], got %v", calls)
+	}
+
+	info := generator.Functions()["divmod"]
+	body := contract.Runtime[info.StartOffset:info.EndOffset]
+	n := len(body)
+	exit := OpcodeMnemonic(body[n-3].Opcode) + " " + OpcodeMnemonic(body[n-2].Opcode) + " " + OpcodeMnemonic(body[n-1].Opcode)
+	if exit != "LDLOC1 LDLOC0 RET" {
+		t.Errorf("Expected divmod to exit with LDLOC1 LDLOC0 RET, got %s", exit)
+	}
+
+	for source, message := range map[string]string{
+		`object "T" { code { let x := f(1) function f(a, b) -> r { } } }`:        "expects 2 arguments",
+		`object "T" { code { let x := f() function f() -> a, b { } } }`:          "returns 2 values",
+		`object "T" { code { sstore(0, f()) function f() { } } }`:                "returns 0 values",
+		`object "T" { code { g() } }`:                                              "undefined function g",
+		`object "T" { code { function f() { } if 1 { function f() { } } } }`: "defined more than once",
+	} {
+		ast, err := NewYulParser().Parse(source)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if _, err := NewCodeGenerator(context).Generate(ast); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected error containing %q for %s, got %v", message, source, err)
+		}
+	}
+}
+
+// TestCodeGeneratorLoopExits tests that break jumps past the innermost loop
+// and continue jumps to its post block
+func TestCodeGeneratorLoopExits(t *testing.T) {
+	source := `object "Test" {
+		code {
+			for { let i := 0 } lt(i, 10) { i := add(i, 1) } {
+				for { } 1 { } {
+					if eq(i, 5) { break }
+				}
+				if eq(i, 2) { continue }
+				if eq(i, 7) { break }
+			}
+		}
+	}`
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{
+		SymbolTable:    NewSymbolTable(),
+		TypeTable:      NewTypeTable(),
+		ErrorCollector: NewErrorCollector(),
+		Metadata:       NewCompilationMetadata(),
+	}
+	generator := NewCodeGenerator(context)
+	contract, err := generator.Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+
+	// Unconditional jumps in source order: inner break, inner loop back edge,
+	// continue, outer break, outer loop back edge
+	var targets []string
+	for _, pending := range generator.pendingLabels {
+		if op := contract.Runtime[pending.InstructionIndex].Opcode; (op == JMP || op == JMP_L) && strings.HasPrefix(pending.Name, "for_") {
+			targets = append(targets, strings.TrimRight(pending.Name, "_0123456789"))
+		}
+	}
+	want := "for_end for_start for_continue for_end for_start"
+	if got := strings.Join(targets, " "); got != want {
+		t.Errorf("Expected jump targets %q, got %q", want, got)
+	}
+
+	// The continue label of the outer loop is its post block, i := add(i, 1)
+	for _, label := range contract.EntryPoints.Keys() {
+		if !strings.HasPrefix(label, "for_continue") {
+			continue
+		}
+		offset, _ := contract.EntryPoints.Get(label)
+		if offset+3 < len(contract.Runtime) && contract.Runtime[offset+2].Opcode == OVER && contract.Runtime[offset+3].Opcode == OVER {
+			return
+		}
+	}
+	t.Errorf("Expected a continue label at the outer post block")
+}
+
+// TestCodeGeneratorLoopExitErrors tests that break and continue are
+// rejected outside of a loop, including in functions defined in a loop body
+func TestCodeGeneratorLoopExitErrors(t *testing.T) {
+	context := &CompilerContext{
+		SymbolTable:    NewSymbolTable(),
+		TypeTable:      NewTypeTable(),
+		ErrorCollector: NewErrorCollector(),
+		Metadata:       NewCompilationMetadata(),
+	}
+	for source, message := range map[string]string{
+		`object "T" { code { break } }`:                                   "break outside of a for loop",
+		`object "T" { code { if 1 { continue } } }`:                       "continue outside of a for loop",
+		`object "T" { code { for { } 1 { } { function f() { break } } } }`: "break outside of a for loop",
+	} {
+		ast, err := NewYulParser().Parse(source)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if _, err := NewCodeGenerator(context).Generate(ast); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected error containing %q for %s, got %v", message, source, err)
+		}
+	}
+}
+
+// TestCodeGeneratorSwitchLayout tests the compare-and-jump chain: the
+// default body follows the chain, case bodies follow in source order and
+// every path meets at the end label, which drops the switch value
+func TestCodeGeneratorSwitchLayout(t *testing.T) {
+	source := `object "Test" {
+		code {
+			switch sload(0)
+			case 1 { sstore(0, 1) }
+			case 2 { sstore(0, 2) }
+			default { sstore(0, 3) }
+			sstore(1, 1)
+		}
+	}`
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{
+		SymbolTable:    NewSymbolTable(),
+		TypeTable:      NewTypeTable(),
+		ErrorCollector: NewErrorCollector(),
+		Metadata:       NewCompilationMetadata(),
+	}
+	generator := NewCodeGenerator(context)
+	contract, err := generator.Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	code := contract.Runtime
+
+	// Jumps in order: two JMPIFs to the cases, then a JMP to the end after
+	// the default body and after the first case body. Calls to the storage
+	// routines are left out.
+	var switchJumps []PendingLabel
+	var jumps []string
+	for _, pending := range generator.pendingLabels {
+		if strings.HasPrefix(pending.Name, "storage_") {
+			continue
+		}
+		switchJumps = append(switchJumps, pending)
+		jumps = append(jumps, strings.TrimRight(pending.Name, "_0123456789"))
+	}
+	if got := strings.Join(jumps, " "); got != "case case switch_end switch_end" {
+		t.Fatalf("Expected jumps to case case switch_end switch_end, got %q", got)
+	}
+	for i, pending := range switchJumps {
+		want := JMPIF
+		if i >= 2 {
+			want = JMP
+		}
+		if code[pending.InstructionIndex].Opcode != want {
+			t.Errorf("Expected jump %d to use opcode %d, got %d", i, want, code[pending.InstructionIndex].Opcode)
+		}
+	}
+
+	// The default body runs right after the chain and stores 3
+	chainEnd := switchJumps[1].InstructionIndex
+	if value := code[chainEnd+1]; string(value.Operand) != string(NewPushInstruction(CreateNeoVMInteger(3)).Operand) {
+		t.Errorf("Expected the default body after the comparison chain")
+	}
+
+	// Each case label directly follows a JMP and its body stores its value
+	first, _ := contract.EntryPoints.Get(switchJumps[0].Name)
+	second, _ := contract.EntryPoints.Get(switchJumps[1].Name)
+	end, _ := contract.EntryPoints.Get(switchJumps[2].Name)
+	if !(chainEnd < first && first < second && second < end) {
+		t.Fatalf("Expected default, case 1, case 2, end in order, got %d %d %d", first, second, end)
+	}
+	for i, label := range []int{first, second} {
+		if code[label-1].Opcode != JMP {
+			t.Errorf("Expected case %d to follow a jump to the end", i+1)
+		}
+		want := NewPushInstruction(CreateNeoVMInteger(int64(i + 1))).Operand
+		if string(code[label].Operand) != string(want) {
+			t.Errorf("Expected case %d body at its label", i+1)
+		}
+	}
+
+	// The end label drops the switch value before the following statement
+	if code[end].Opcode != DROP {
+		t.Errorf("Expected DROP at the end label, got %d", code[end].Opcode)
+	}
+	if code[end+4].Opcode != RET {
+		t.Errorf("Expected the statement after the switch to follow the end label")
+	}
+}
+
+// TestCodeGeneratorSwitchSearch tests the binary search dispatch of
+// switches with many cases and its threshold
+func TestCodeGeneratorSwitchSearch(t *testing.T) {
+	source := "object \"Test\" { code { switch shr(224, calldataload(0))\n"
+	for i := 0; i < 12; i++ {
+		source += fmt.Sprintf("case %d { sstore(0, %d) }\n", 0x10000000+i*0x1000, i)
+	}
+	source += "default { revert(0, 0) } } }"
+
+	counts := func(threshold int) (compares, lowers int) {
+		ast, err := NewYulParser().Parse(source)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		generator := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable(), SwitchSearchThreshold: threshold})
+		contract, err := generator.Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+		for _, instr := range contract.Runtime {
+			switch instr.Opcode {
+			case NUMEQUAL:
+				compares++
+			case LT:
+				lowers++
+			}
+		}
+		return compares, lowers
+	}
+	// The calldata routines compare too
+	compares, lowers := counts(0)
+	// Halved three times into four ranges of three cases
+	if c, l := counts(10); c != compares || l != lowers+3 {
+		t.Errorf("Expected the 12 comparisons after 3 halvings, got %d and %d more", c-compares, l-lowers)
+	}
+	if c, l := counts(13); c != compares || l != lowers {
+		t.Errorf("Expected a chain below the threshold, got %d and %d more", c-compares, l-lowers)
+	}
+
+	for _, tc := range []struct {
+		config CompilerConfig
+		want   int
+	}{
+		{CompilerConfig{}, DefaultSwitchSearchThreshold},
+		{CompilerConfig{SwitchSearchThreshold: -1}, 0},
+		{CompilerConfig{SwitchSearchThreshold: 4, CompilerFlags: []string{"--switch-search-threshold=20"}}, 20},
+	} {
+		if got, err := SwitchSearchThresholdFromConfig(tc.config); err != nil || got != tc.want {
+			t.Errorf("Expected threshold %d for %+v, got %d (%v)", tc.want, tc.config, got, err)
+		}
+	}
+	if _, err := SwitchSearchThresholdFromConfig(CompilerConfig{CompilerFlags: []string{"--switch-search-threshold=many"}}); err == nil {
+		t.Errorf("Expected an invalid threshold to be refused")
+	}
+	if _, err := NewYulToNeoCompiler(CompilerConfig{CompilerFlags: []string{"--switch-search-threshold=many"}}).Compile(`object "T" { code { sstore(0, 1) } }`); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected an invalid threshold to fail compilation, got %v", err)
+	}
+}
+
+// TestCodeGeneratorWordArithmetic tests that arithmetic wraps modulo 2^256,
+// takes its operands in Yul order and that the signed built-ins are lowered
+func TestCodeGeneratorWordArithmetic(t *testing.T) {
+	context := &CompilerContext{
+		SymbolTable:    NewSymbolTable(),
+		TypeTable:      NewTypeTable(),
+		ErrorCollector: NewErrorCollector(),
+		Metadata:       NewCompilationMetadata(),
+	}
+	generate := func(expr string) []NeoInstruction {
+		ast, err := NewYulParser().Parse(`object "Test" { code { let a := sload(0) let b := sload(1) let r := ` + expr + ` } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		contract, err := NewCodeGenerator(context).Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed for %s: %v", expr, err)
+		}
+		// Skip INITSSLOT, the storage context and the two sload lets, 3
+		// instructions each, and stop at the storage routines
+		code := contract.Runtime[9:]
+		for i, instr := range code {
+			if instr.Opcode == RET {
+				return code[:i]
+			}
+		}
+		return code
+	}
+	contains := func(code []NeoInstruction, opcode NeoOpcode) bool {
+		for _, instr := range code {
+			if instr.Opcode == opcode {
+				return true
+			}
+		}
+		return false
+	}
+
+	// No integer pushed takes more than the 32 bytes NeoVM integers hold
+	for _, expr := range []string{`add(a, b)`, `sub(a, b)`, `mul(a, b)`, `not(a)`, `shl(a, b)`, `shr(a, b)`, `exp(a, b)`, `signextend(a, b)`, `lt(a, b)`} {
+		for _, instr := range generate(expr) {
+			if instr.Opcode == PUSHDATA1 && len(instr.Operand) > 1+32 {
+				t.Errorf("Expected %s to push integers of at most 32 bytes, got %d", expr, len(instr.Operand)-1)
+			}
+		}
+	}
+
+	// sub(a, b): b pushed first, then a; SWAP puts b on top so SUB computes
+	// a - b, after the sign check choosing how it wraps
+	code := generate(`sub(a, b)`)
+	if code[2].Opcode != SWAP || code[3].Opcode != OVER || code[4].Opcode != OVER || code[5].Opcode != XOR || !contains(code, SUB) {
+		t.Errorf("Expected SWAP and a wrapping SUB for sub")
+	}
+
+	// Division by zero gives 0 instead of aborting; unsigned division is a
+	// routine
+	code = generate(`div(a, b)`)
+	for _, instr := range code {
+		if instr.Opcode == ABORT {
+			t.Errorf("Expected div by zero to give 0, not abort")
+		}
+	}
+	if !contains(code, CALL) && !contains(code, CALL_L) {
+		t.Errorf("Expected a call of word_divmod for div")
+	}
+
+	// lt(a, b) compares b > a with a on top, both with the sign bit flipped;
+	// the signed comparisons compare the integers as they are
+	if code := generate(`lt(a, b)`); code[len(code)-2].Opcode != GT || !contains(code, XOR) {
+		t.Errorf("Expected lt to compile to GT on reversed operands")
+	}
+	for expr, op := range map[string]NeoOpcode{`slt(a, b)`: GT, `sgt(a, b)`: LT} {
+		if code := generate(expr); len(code) != 4 || code[2].Opcode != op {
+			t.Errorf("Expected %s to compile to %s, got %d instructions", expr, OpcodeMnemonic(op), len(code))
+		}
+	}
+	for _, expr := range []string{`sdiv(a, b)`, `smod(a, b)`} {
+		if code := generate(expr); code[2].Opcode != SWAP {
+			t.Errorf("Expected %s to swap its operands", expr)
+		}
+	}
+
+	// Shifts are limited to the largest NeoVM shift
+	code = generate(`shl(a, b)`)
+	if !contains(code, WITHIN) || !contains(code, SHL) {
+		t.Errorf("Expected a guarded SHL for shl")
+	}
+	if code := generate(`shr(a, b)`); !contains(code, MIN) || !contains(code, SHR) {
+		t.Errorf("Expected a clamped SHR for shr")
+	}
+	if code := generate(`signextend(0, a)`); !contains(code, SHL) || !contains(code, SHR) {
+		t.Errorf("Expected signextend as a shift pair")
+	}
+	if code := generate(`sar(a, b)`); !contains(code, SHR) {
+		t.Errorf("Expected SHR for sar")
+	}
+}
+
+// TestCodeGeneratorModularBuiltins tests addmod, mulmod, exp and byte
+func TestCodeGeneratorModularBuiltins(t *testing.T) {
+	context := &CompilerContext{
+		SymbolTable:    NewSymbolTable(),
+		TypeTable:      NewTypeTable(),
+		ErrorCollector: NewErrorCollector(),
+		Metadata:       NewCompilationMetadata(),
+	}
+	generate := func(expr string) (*CodeGenerator, []NeoInstruction) {
+		ast, err := NewYulParser().Parse(`object "Test" { code { let a := sload(0) let r := ` + expr + ` } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		generator := NewCodeGenerator(context)
+		contract, err := generator.Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed for %s: %v", expr, err)
+		}
+		// The storage routines follow the top-level code
+		for i, instr := range contract.Runtime {
+			if instr.Opcode == RET {
+				return generator, contract.Runtime[:i]
+			}
+		}
+		return generator, contract.Runtime
+	}
+
+	// addmod and mulmod are routines, which reduce without leaving the word
+	for expr, routine := range map[string]string{`addmod(a, a, 7)`: "word_addmod", `mulmod(a, a, 7)`: "word_mulmod"} {
+		generator, _ := generate(expr)
+		called := false
+		for _, pending := range generator.pendingLabels {
+			called = called || pending.Name == routine
+		}
+		if !called {
+			t.Errorf("Expected %s to call %s", expr, routine)
+		}
+	}
+
+	// exp loops back to its start until the exponent is zero
+	generator, code := generate(`exp(a, 10)`)
+	loops := 0
+	for _, pending := range generator.pendingLabels {
+		target, _ := generator.labelMap.Get(pending.Name)
+		if pending.InstructionIndex >= len(code) {
+			continue
+		}
+		if op := code[pending.InstructionIndex].Opcode; strings.HasPrefix(pending.Name, "exp_loop") && (op == JMP || op == JMP_L) && target < pending.InstructionIndex {
+			loops++
+		}
+	}
+	if loops != 1 {
+		t.Errorf("Expected one backward jump in exp, got %d", loops)
+	}
+	if code[len(code)-3].Opcode != NIP || code[len(code)-2].Opcode != NIP {
+		t.Errorf("Expected exp to leave only the result on the stack")
+	}
+
+	// byte guards indices of 32 and more
+	generator, _ = generate(`byte(a, 0xff)`)
+	guarded := false
+	for _, label := range generator.labelMap.Keys() {
+		guarded = guarded || strings.HasPrefix(label, "byte_out_of_range")
+	}
+	if !guarded {
+		t.Errorf("Expected byte to handle out of range indices")
+	}
+}
+
+// TestCodeGeneratorLinearMemory tests that memory lives in a buffer in a
+// static field and is accessed through routines emitted once per script
+func TestCodeGeneratorLinearMemory(t *testing.T) {
+	source := `object "Test" {
+		code {
+			let x := 7
+			mstore(0, x)
+			mstore(32, mload(0))
+			sstore(0, msize())
+		}
+	}`
+	generate := func(bounds bool) (*CodeGenerator, *NeoContract) {
+		ast, err := NewYulParser().Parse(source)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		context := &CompilerContext{
+			SymbolTable:    NewSymbolTable(),
+			TypeTable:      NewTypeTable(),
+			ErrorCollector: NewErrorCollector(),
+			Metadata:       NewCompilationMetadata(),
+			BoundsChecking: bounds,
+		}
+		generator := NewCodeGenerator(context)
+		contract, err := generator.Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+		return generator, contract
+	}
+
+	generator, contract := generate(true)
+	code := contract.Runtime
+
+	// One static field for x, one for the memory buffer after it and one
+	// for the storage context
+	if code[0].Opcode != INITSSLOT || code[0].Operand[0] != 3 {
+		t.Fatalf("Expected INITSSLOT 3, got %v", code[0])
+	}
+	if code[2].Opcode != NEWBUFFER || OpcodeMnemonic(code[3].Opcode) != "STSFLD1" {
+		t.Errorf("Expected the empty memory buffer stored in static field 1")
+	}
+
+	// Memory is not backed by storage
+	for _, instr := range code {
+		if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Storage.Get" {
+			t.Errorf("Expected mload not to read storage")
+		}
+	}
+
+	// Each routine is emitted once, after the top-level code returns
+	calls := make(map[string]int)
+	for _, pending := range generator.pendingLabels {
+		if strings.HasPrefix(pending.Name, "memory_") && !strings.Contains(pending.Name, "_done") && !strings.Contains(pending.Name, "_in_bounds") {
+			calls[pending.Name]++
+		}
+	}
+	if calls["memory_store"] != 2 || calls["memory_load"] != 1 {
+		t.Errorf("Expected 2 memory_store and 1 memory_load calls, got %v", calls)
+	}
+	expand, ok := contract.EntryPoints.Get("memory_expand")
+	if !ok {
+		t.Fatalf("Expected memory_expand to be emitted")
+	}
+	if code[expand-1].Opcode != RET {
+		t.Errorf("Expected the top-level code to return before the memory routines")
+	}
+	for _, name := range []string{"memory_load", "memory_store"} {
+		if _, ok := contract.EntryPoints.Get(name); !ok {
+			t.Errorf("Expected %s to be emitted", name)
+		}
+	}
+	if _, ok := contract.EntryPoints.Get("memory_copy"); ok {
+		t.Errorf("Expected unused routines to be left out")
+	}
+
+	// Bounds checking aborts on oversized memory; without it there is no check
+	aborts := func(code []NeoInstruction) int {
+		count := 0
+		for _, instr := range code {
+			if instr.Opcode == ABORT {
+				count++
+			}
+		}
+		return count
+	}
+	if got := aborts(code); got != 1 {
+		t.Errorf("Expected one memory bounds check, got %d", got)
+	}
+	if _, unchecked := generate(false); aborts(unchecked.Runtime) != 0 {
+		t.Errorf("Expected no bounds check with bounds checking disabled")
+	}
+
+	// Code that does not use memory gets no memory field
+	ast, _ := NewYulParser().Parse(`object "Test" { code { sstore(0, 1) } }`)
+	plain, err := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()}).Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	if plain.Runtime[0].Opcode != INITSSLOT || plain.Runtime[0].Operand[0] != 1 {
+		t.Errorf("Expected only the storage context field without memory use")
+	}
+}
+
+// TestCodeGeneratorCalldata tests that calldata is rebuilt from the
+// invocation arguments on entry and read through routines
+func TestCodeGeneratorCalldata(t *testing.T) {
+	source := `object "Test" {
+		code {
+			switch shr(224, calldataload(0))
+			case 0xa9059cbb { sstore(calldataload(4), calldataload(36)) }
+			sstore(0, calldatasize())
+		}
+	}`
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	generator := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()})
+	contract, err := generator.Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	code := contract.Runtime
+
+	// One static field for the calldata, built from the selector and the
+	// argument array before any user code runs, and one for the storage
+	// context
+	if code[0].Opcode != INITSSLOT || code[0].Operand[0] != 2 {
+		t.Fatalf("Expected INITSSLOT 2, got %v", code[0])
+	}
+	if generator.pendingLabels[0].Name != "calldata_init" || generator.pendingLabels[0].InstructionIndex != 1 {
+		t.Fatalf("Expected calldata_init to be called first, got %v", generator.pendingLabels[0])
+	}
+	if code[1].StackPop != 2 || code[1].StackPush != 0 {
+		t.Errorf("Expected calldata_init to consume the two invocation arguments")
+	}
+
+	loads := 0
+	for i, instr := range code {
+		if instr.Opcode == SYSCALL && strings.HasPrefix(string(instr.Operand), "System.Runtime.GetArgument") {
+			t.Errorf("Expected no argument syscalls at %d", i)
+		}
+		if instr.Opcode == SIZE && i > 0 && OpcodeMnemonic(code[i-1].Opcode) == "LDSFLD0" {
+			loads++
+		}
+	}
+	calls := 0
+	for _, pending := range generator.pendingLabels {
+		if pending.Name == "calldata_load" {
+			calls++
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calldata_load calls, got %d", calls)
+	}
+	if loads == 0 {
+		t.Errorf("Expected calldatasize to read the size of the calldata field")
+	}
+	for _, name := range []string{"calldata_init", "calldata_load"} {
+		if _, ok := contract.EntryPoints.Get(name); !ok {
+			t.Errorf("Expected %s to be emitted", name)
+		}
+	}
+	if _, ok := contract.EntryPoints.Get("memory_expand"); ok {
+		t.Errorf("Expected no memory routines without memory use")
+	}
+}
+
+// TestCodeGeneratorEvents tests that log built-ins notify [topics..., data]
+// and are recorded as contract events
+func TestCodeGeneratorEvents(t *testing.T) {
+	generate := func(body string) (*NeoContract, error) {
+		ast, err := NewYulParser().Parse(`object "Test" { code { ` + body + ` } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		return NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()}).Generate(ast)
+	}
+
+	contract, err := generate(`
+		log3(0, 32, 0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef, 1, 2)
+		log3(32, 32, 0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef, 3, 4)
+		log1(0, 0, sload(0))
+		log0(0, 0)`)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+
+	var names []string
+	for _, event := range contract.Events {
+		names = append(names, event.Name)
+	}
+	if got := strings.Join(names, " "); got != "Event_ddf252ad Log1 Log0" {
+		t.Fatalf("Expected events Event_ddf252ad Log1 Log0, got %q", got)
+	}
+	transfer := contract.Events[0]
+	if transfer.Anonymous || transfer.Signature != "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef" {
+		t.Errorf("Expected the transfer event to carry its signature, got %+v", transfer)
+	}
+	if len(transfer.Parameters) != 4 || transfer.Parameters[3].Name != "data" || !transfer.Parameters[2].Indexed {
+		t.Errorf("Expected three indexed topics and data, got %+v", transfer.Parameters)
+	}
+	if !contract.Events[1].Anonymous || len(contract.Events[2].Parameters) != 1 {
+		t.Errorf("Expected anonymous LogN events, got %+v %+v", contract.Events[1], contract.Events[2])
+	}
+
+	// Each log packs its topics and data and notifies under the event name
+	var packs []string
+	var notified []string
+	code := contract.Runtime
+	for i, instr := range code {
+		switch {
+		case instr.Opcode == PACK:
+			packs = append(packs, strconv.Itoa(instr.StackPop-1))
+		case instr.Opcode == SYSCALL && string(instr.Operand) == "System.Runtime.Notify":
+			if instr.StackPop != 2 {
+				t.Errorf("Expected Notify to pop the name and the state")
+			}
+			notified = append(notified, string(code[i-1].Operand))
+		}
+	}
+	if strings.Join(packs, " ") != "4 4 2 1" {
+		t.Errorf("Expected arrays of 4, 4, 2 and 1 items, got %v", packs)
+	}
+	if got := strings.Join(notified, " "); got != "Event_ddf252ad Event_ddf252ad Log1 Log0" {
+		t.Errorf("Expected notifications under the event names, got %q", got)
+	}
+
+	for _, body := range []string{
+		`log2(0, 0, 0x01, 2) log1(0, 0, 0x01)`,
+		`log2(0, 0, 1)`,
+	} {
+		if _, err := generate(body); err == nil {
+			t.Errorf("Expected %s to fail", body)
+		}
+	}
+}
+
+// TestCodeGeneratorKeccak tests that keccak256 hashes a memory range with
+// the interop where the target has it and in software otherwise
+func TestCodeGeneratorKeccak(t *testing.T) {
+	generate := func(target SemanticVersion) (*CodeGenerator, *NeoContract) {
+		ast, err := NewYulParser().Parse(`object "Test" { code { sstore(0, keccak256(0, 64)) } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		generator := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable(), TargetVersion: target})
+		contract, err := generator.Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+		return generator, contract
+	}
+	syscalls := func(contract *NeoContract) int {
+		count := 0
+		for _, instr := range contract.Runtime {
+			if instr.Opcode == PUSHDATA1 && string(instr.Operand) == "keccak256" {
+				count++
+			}
+		}
+		return count
+	}
+
+	for _, target := range []SemanticVersion{{}, NativeKeccakVersion, {3, 8, 0}} {
+		generator, contract := generate(target)
+		if syscalls(contract) != 1 {
+			t.Errorf("Expected a CryptoLib.keccak256 call for target %v", target)
+		}
+		// The range is sliced out of memory before hashing
+		if generator.pendingLabels[0].Name != "memory_slice" {
+			t.Errorf("Expected keccak256 to slice memory first, got %s", generator.pendingLabels[0].Name)
+		}
+		if _, ok := contract.EntryPoints.Get("keccak256_software"); ok {
+			t.Errorf("Expected no software Keccak for target %v", target)
+		}
+	}
+
+	generator, contract := generate(SemanticVersion{3, 0, 0})
+	if syscalls(contract) != 0 {
+		t.Errorf("Expected no CryptoLib.keccak256 call on NeoVM 3.0")
+	}
+	calls := 0
+	for _, pending := range generator.pendingLabels {
+		if pending.Name == "keccak256_software" {
+			calls++
+		}
+	}
+	if _, ok := contract.EntryPoints.Get("keccak256_software"); !ok || calls != 1 {
+		t.Errorf("Expected a call to the software Keccak routine on NeoVM 3.0")
+	}
+
+	for value, want := range map[string]SemanticVersion{"": {}, "3.0": {3, 0, 0}, "3.7.1": {3, 7, 1}} {
+		got, err := TargetVersionFromConfig(CompilerConfig{TargetNeoVMVersion: value})
+		if err != nil || got != want {
+			t.Errorf("Expected target %q to parse as %v, got %v (%v)", value, want, got, err)
+		}
+	}
+	if _, err := TargetVersionFromConfig(CompilerConfig{TargetNeoVMVersion: "latest"}); err == nil {
+		t.Errorf("Expected an invalid target version to fail")
+	}
+	if _, err := NewYulToNeoCompiler(CompilerConfig{TargetNeoVMVersion: "latest"}).Compile(`object "T" { code { sstore(0, 1) } }`); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected an invalid target version to fail compilation, got %v", err)
+	}
+}
+
+// Helper functions for testing
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		Symbols: make(map[string]*Symbol),
+	}
+}
+
+func NewTypeTable() *TypeTable {
+	return &TypeTable{
+		Types: make(map[string]*TypeInfo),
+	}
+}
+
+func NewErrorCollector() *ErrorCollector {
+	return &ErrorCollector{
+		Errors:   []CompilerError{},
+		Warnings: []CompilerWarning{},
+	}
+}
+
+// Test types for code generation validation (defined in supporting_types.go)
+type SymbolTable struct {
+	Symbols map[string]*Symbol
+}
+
+type Symbol struct {
+	Name     string
+	Type     string
+	Scope    string
+	Location SourcePosition
+}
+
+type TypeTable struct {
+	Types map[string]*TypeInfo
+}
+
+type TypeInfo struct {
+	Name   string
+	Size   int
+	Signed bool
+}
+
+type ErrorCollector struct {
+	Errors   []CompilerError
+	Warnings []CompilerWarning
+}
+
+func TestCodeGeneratorExternalCalls(t *testing.T) {
+	var generator *CodeGenerator
+	generate := func(body string) (*CompilerContext, *NeoContract, error) {
+		ast, err := NewYulParser().Parse(`object "Test" { code { ` + body + ` } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		context := &CompilerContext{SymbolTable: NewSymbolTable(), ErrorCollector: NewErrorCollector()}
+		generator = NewCodeGenerator(context)
+		contract, err := generator.Generate(ast)
+		return context, contract, err
+	}
+	flags := func(contract *NeoContract) []NeoOpcode {
+		// The call flags are pushed right before calling contract_call
+		var pushed []NeoOpcode
+		for _, pending := range generator.pendingLabels {
+			if pending.Name == "contract_call" {
+				pushed = append(pushed, contract.Runtime[pending.InstructionIndex-1].Opcode)
+			}
+		}
+		return pushed
+	}
+
+	context, contract, err := generate(`
+		let ok := call(0, 0x1234, 0, 0, 68, 0, 32)
+		ok := staticcall(0, 0x1234, 0, 4, 0, 32)
+		sstore(0, returndatasize())
+		returndatacopy(0, 0, 32)`)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	if got := flags(contract); len(got) != 2 || got[0] != PUSH15 || got[1] != PUSH5 {
+		t.Errorf("Expected call flags All then ReadOnly, got %v", got)
+	}
+	if _, ok := contract.EntryPoints.Get("contract_call"); !ok {
+		t.Errorf("Expected the contract_call routine")
+	}
+	if _, ok := contract.EntryPoints.Get("returndata_copy"); !ok {
+		t.Errorf("Expected the returndata_copy routine")
+	}
+	syscalls := 0
+	try := false
+	for _, instr := range contract.Runtime {
+		if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Contract.Call" {
+			syscalls++
+		}
+		try = try || instr.Opcode == TRY || instr.Opcode == TRY_L
+	}
+	if syscalls != 1 || !try {
+		t.Errorf("Expected one System.Contract.Call guarded by TRY, got %d calls", syscalls)
+	}
+	if len(context.ErrorCollector.GetWarnings()) != 0 {
+		t.Errorf("Expected no warnings, got %v", context.ErrorCollector.GetWarnings())
+	}
+
+	// Value and delegatecall have no NeoVM equivalent
+	context, _, err = generate(`
+		let ok := call(0, 0x1234, 1, 0, 0, 0, 0)
+		ok := delegatecall(0, 0x1234, 0, 0, 0, 0)`)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	if warnings := context.ErrorCollector.GetWarnings(); len(warnings) != 2 {
+		t.Errorf("Expected warnings for the value and delegatecall, got %v", warnings)
+	}
+
+	if _, _, err := generate(`let ok := call(0, 0x1234, 0, 0, 0)`); err == nil {
+		t.Errorf("Expected call with 5 arguments to fail")
+	}
+}
+
+func TestCodeGeneratorMethodTokens(t *testing.T) {
+	libraries, errs := LibrariesFromConfig(CompilerConfig{Libraries: []string{
+		"Oracle=0xfe924b7cfe89ddd271abaf7210a80a7e11178758", "Bad=0x12", "NoHash",
+	}})
+	if len(libraries) != 1 || len(errs) != 2 {
+		t.Fatalf("Expected one library and two errors, got %v and %v", libraries, errs)
+	}
+	if _, err := NewYulToNeoCompiler(CompilerConfig{Libraries: []string{"Bad=0x12"}}).Compile(`object "T" { code { sstore(0, 1) } }`); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected an invalid library to fail compilation, got %v", err)
+	}
+	generate := func(body string) (*NeoContract, error) {
+		ast, err := NewYulParser().Parse(`object "Test" { code { ` + body + ` } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		context := &CompilerContext{SymbolTable: NewSymbolTable(), ErrorCollector: NewErrorCollector(), Libraries: libraries}
+		return NewCodeGenerator(context).Generate(ast)
+	}
+
+	contract, err := generate(`
+		let ok := call(0, linkersymbol("Oracle"), 0, 0, 68, 0, 32)
+		ok := staticcall(0, 0xfe924b7cfe89ddd271abaf7210a80a7e11178758, 0, 4, 0, 32)
+		ok := call(0, 0xfe924b7cfe89ddd271abaf7210a80a7e11178758, 0, 0, 4, 0, 32)
+		ok := call(0, 0x1234, 0, 0, 4, 0, 32)`)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	if len(contract.MethodTokens) != 2 {
+		t.Fatalf("Expected tokens for call and staticcall of the library, got %+v", contract.MethodTokens)
+	}
+	token := contract.MethodTokens[0]
+	if token.Method != ExternalCallMethod || token.ParametersCount != 2 || !token.HasReturnValue ||
+		token.CallFlags != 0x0F || contract.MethodTokens[1].CallFlags != 0x05 || token.Hash[0] != 0x58 || token.Hash[19] != 0xfe {
+		t.Errorf("Unexpected method token %+v", token)
+	}
+	var callt [][]byte
+	syscalls := 0
+	for _, instr := range contract.Runtime {
+		if instr.Opcode == CALLT {
+			callt = append(callt, instr.Operand)
+		}
+		if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Contract.Call" {
+			syscalls++
+		}
+	}
+	if len(callt) != 2 || callt[0][0] != 0 || callt[1][0] != 1 || len(callt[1]) != 2 || syscalls != 1 {
+		t.Errorf("Expected CALLT 0, CALLT 1 and a dynamic call, got %v and %d calls", callt, syscalls)
+	}
+	nef, err := EncodeNEF(contract)
+	if err != nil {
+		t.Fatalf("EncodeNEF failed: %v", err)
+	}
+	decoded, err := DecodeNEF(nef)
+	if err != nil || len(decoded.Tokens) != 2 || decoded.Tokens[1] != contract.MethodTokens[1] {
+		t.Errorf("Expected the tokens in the NEF, got %+v, %v", decoded, err)
+	}
+
+	// Without libraries every call is dynamic
+	contract, err = generate(`let ok := call(0, 0x1234, 0, 0, 4, 0, 32)`)
+	if err != nil || len(contract.MethodTokens) != 0 {
+		t.Errorf("Expected no method tokens, got %+v, %v", contract, err)
+	}
+	if contract, err := generate(`sstore(0, linkersymbol("Missing"))`); err != nil || !reflect.DeepEqual(contract.UnlinkedLibraries(), []string{"Missing"}) {
+		t.Errorf("Expected a placeholder for an unknown library, got %v", err)
+	}
+}
+
+func TestLinker(t *testing.T) {
+	ast, err := NewYulParser().Parse(`object "Test" { code {
+		sstore(0, linkersymbol("Math"))
+		sstore(1, linkersymbol("Strings"))
+		sstore(2, linkersymbol("Math"))
+	} }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{SymbolTable: NewSymbolTable(), ErrorCollector: NewErrorCollector()}
+	contract, err := NewCodeGenerator(context).Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	if got := contract.UnlinkedLibraries(); !reflect.DeepEqual(got, []string{"Math", "Strings"}) {
+		t.Fatalf("Expected Math and Strings unlinked, got %v", got)
+	}
+	if len(context.ErrorCollector.GetWarnings()) == 0 {
+		t.Errorf("Expected a warning for unconfigured libraries")
+	}
+	if _, err := EncodeNEF(contract); err == nil || !strings.Contains(err.Error(), "Math, Strings") {
+		t.Errorf("Expected encoding an unlinked contract to fail, got %v", err)
+	}
+	before, _ := contract.Script()
+
+	math, err := ParseUint160("0xfe924b7cfe89ddd271abaf7210a80a7e11178758")
+	if err != nil || math.String() != "0xfe924b7cfe89ddd271abaf7210a80a7e11178758" {
+		t.Fatalf("Expected the hash to round-trip, got %v, %v", math, err)
+	}
+	if _, err := ParseUint160("0x12"); err == nil {
+		t.Errorf("Expected a short hash to be rejected")
+	}
+
+	// Linking is all or nothing
+	if err := Link(contract, map[string]Uint160{"Math": math}); err == nil || !strings.Contains(err.Error(), "Strings") {
+		t.Fatalf("Expected Strings to be reported unresolved, got %v", err)
+	}
+	if len(contract.UnlinkedLibraries()) != 2 {
+		t.Fatalf("Expected a failed link to leave the contract as it was")
+	}
+
+	strs, _ := ParseUint160("00000000000000000000000000000000000000aa")
+	if err := Link(contract, map[string]Uint160{"Math": math, "Strings": strs}); err != nil {
+		t.Fatalf("Link failed: %v", err)
+	}
+	if len(contract.UnlinkedLibraries()) != 0 {
+		t.Errorf("Expected every placeholder resolved")
+	}
+	after, _ := contract.Script()
+	if len(after) != len(before) {
+		t.Errorf("Expected linking to keep the script size, got %d then %d", len(before), len(after))
+	}
+	if !bytes.Contains(after, math[:]) || !bytes.Contains(after, strs[:]) {
+		t.Errorf("Expected the hashes in the linked script")
+	}
+	if len(contract.Metadata.Libraries) != 2 || contract.Metadata.Libraries[0].Hash != math.String() {
+		t.Errorf("Expected the linked libraries recorded, got %+v", contract.Metadata.Libraries)
+	}
+	if _, err := EncodeNEF(contract); err != nil {
+		t.Errorf("Expected the linked contract to encode, got %v", err)
+	}
+}
+
+func TestCodeGeneratorCreate(t *testing.T) {
+	ast, err := NewYulParser().Parse(`object "Test" { code {
+		sstore(0, create(0, 0, 64))
+		sstore(1, create2(1, 0, 64, 0x2a))
+	} }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{SymbolTable: NewSymbolTable(), ErrorCollector: NewErrorCollector()}
+	generator := NewCodeGenerator(context)
+	contract, err := generator.Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+
+	calls := 0
+	for _, pending := range generator.pendingLabels {
+		if pending.Name == "contract_create" {
+			calls++
+		}
+	}
+	if _, ok := contract.EntryPoints.Get("contract_create"); !ok || calls != 2 {
+		t.Errorf("Expected both creations to call contract_create, got %d calls", calls)
+	}
+
+	// ContractManagement.deploy is called with the hash in little-endian order
+	hash := scriptHashBytes(ContractManagementHash)
+	if len(hash) != 20 || hash[0] != 0xfd || hash[19] != 0xff {
+		t.Errorf("Unexpected ContractManagement hash bytes %x", hash)
+	}
+	methods := map[string]bool{}
+	for i, instr := range contract.Runtime {
+		if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Contract.Call" {
+			methods[string(contract.Runtime[i-2].Operand)] = true
+		}
+	}
+	for _, method := range []string{"deserialize", "jsonDeserialize", "itoa", "jsonSerialize", "deploy"} {
+		if !methods[method] {
+			t.Errorf("Expected a call to %s, got %v", method, methods)
+		}
+	}
+
+	if warnings := context.ErrorCollector.GetWarnings(); len(warnings) != 1 {
+		t.Errorf("Expected a warning for the create2 value, got %v", warnings)
+	}
+}
+
+func TestCodeGeneratorExceptions(t *testing.T) {
+	generate := func(source string) *NeoContract {
+		ast, err := NewYulParser().Parse(source)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		contract, err := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()}).Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+		return contract
+	}
+
+	// revert throws its data, which callers can catch, instead of aborting
+	contract := generate(`object "Test" { code { if iszero(sload(0)) { revert(0, 4) } } }`)
+	throws := false
+	for _, instr := range contract.Runtime {
+		if instr.Opcode == ABORT {
+			t.Errorf("Expected revert not to abort")
+		}
+		throws = throws || instr.Opcode == THROW
+	}
+	if !throws {
+		t.Errorf("Expected revert to throw")
+	}
+	if len(contract.ExceptionHandlers) != 0 {
+		t.Errorf("Expected no handler frames without calls, got %v", contract.ExceptionHandlers)
+	}
+
+	// Every external call and creation runs in a handler frame
+	contract = generate(`object "Test" { code {
+		let ok := call(0, 0x1234, 0, 0, 0, 0, 0)
+		ok := staticcall(0, 0x1234, 0, 0, 0, 0)
+		sstore(0, create(0, 0, 0))
+	} }`)
+	if len(contract.ExceptionHandlers) != 2 {
+		t.Fatalf("Expected handler frames for contract_call and contract_create, got %d", len(contract.ExceptionHandlers))
+	}
+	size := 0
+	for _, instr := range contract.Runtime {
+		size += instr.Size
+	}
+	for _, handler := range contract.ExceptionHandlers {
+		if !(handler.TryOffset < handler.CatchOffset && handler.CatchOffset < handler.EndOffset && handler.EndOffset < size) {
+			t.Errorf("Expected try < catch < end within the script, got %+v", handler)
+		}
+		if handler.FinallyOffset != -1 {
+			t.Errorf("Expected no finally block, got %+v", handler)
+		}
+	}
+
+	// Frames of the constructor are frames of _deploy, after the runtime
+	contract = generate(`object "Token" {
+		code { sstore(0, create(0, 0, 0)) }
+		object "Token_deployed" { code { sstore(0, 1) } }
+	}`)
+	deploy, _ := contract.EntryPoints.Get(DeployMethod)
+	deployOffset := 0
+	for _, instr := range contract.Runtime[:deploy] {
+		deployOffset += instr.Size
+	}
+	if len(contract.ExceptionHandlers) != 1 || contract.ExceptionHandlers[0].TryOffset < deployOffset {
+		t.Errorf("Expected the constructor frame in _deploy, got %v", contract.ExceptionHandlers)
+	}
+}
+
+func TestCodeGeneratorRevertReason(t *testing.T) {
+	ast, err := NewYulParser().Parse(`object "Test" { code {
+		mstore(0, shl(224, 0x08c379a0))
+		revert(0, 100)
+	} }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	generator := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()})
+	contract, err := generator.Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	if _, ok := contract.EntryPoints.Get("revert_reason"); !ok {
+		t.Fatalf("Expected the revert_reason routine")
+	}
+
+	// The data is sliced, paired with its reason and thrown
+	var sequence []string
+	for _, pending := range generator.pendingLabels {
+		if pending.Name == "memory_slice" || pending.Name == "revert_reason" {
+			sequence = append(sequence, pending.Name)
+		}
+	}
+	if strings.Join(sequence, " ") != "memory_slice revert_reason" {
+		t.Errorf("Expected memory_slice then revert_reason, got %v", sequence)
+	}
+	for i, instr := range contract.Runtime {
+		if instr.Opcode == THROW {
+			if i == 0 || (contract.Runtime[i-1].Opcode != CALL && contract.Runtime[i-1].Opcode != CALL_L) {
+				t.Errorf("Expected THROW right after calling revert_reason")
+			}
+		}
+	}
+
+	// Both Solidity selectors and the fallback message are in the routine
+	pushed := map[string]bool{}
+	for _, instr := range contract.Runtime {
+		pushed[string(instr.Operand)] = true
+	}
+	for _, want := range []string{"\x08\xc3\x79\xa0", "\x4e\x48\x7b\x71", "Panic(0x", "execution reverted"} {
+		if !pushed[want] {
+			t.Errorf("Expected %q to be pushed", want)
+		}
+	}
+}
+
+func TestCodeGeneratorGasBuiltins(t *testing.T) {
+	generate := func(body string, stub bool) []NeoInstruction {
+		ast, err := NewYulParser().Parse(`object "Test" { code { ` + body + ` } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		contract, err := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable(), StubGasBuiltins: stub}).Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+		return contract.Runtime
+	}
+	// Syscalls other than those of the sstore the value goes to
+	syscalls := func(code []NeoInstruction) []string {
+		var names []string
+		for _, instr := range code {
+			if instr.Opcode == SYSCALL && !strings.HasPrefix(string(instr.Operand), "System.Storage.") {
+				names = append(names, string(instr.Operand))
+			}
+		}
+		return names
+	}
+
+	tests := []struct {
+		builtin  string
+		syscalls string
+	}{
+		{"gas", "System.Runtime.GasLeft"},
+		{"gaslimit", "System.Runtime.GetScriptContainer"},
+		{"gasprice", "System.Contract.Call"},
+		{"selfbalance", "System.Runtime.GetExecutingScriptHash System.Contract.Call"},
+	}
+	for _, test := range tests {
+		code := generate(`sstore(0, `+test.builtin+`())`, false)
+		if got := strings.Join(syscalls(code), " "); got != test.syscalls {
+			t.Errorf("%s: expected syscalls %s, got %s", test.builtin, test.syscalls, got)
+		}
+
+		// Stubbed, only the store is left
+		code = generate(`sstore(0, `+test.builtin+`())`, true)
+		if got := syscalls(code); len(got) != 0 {
+			t.Errorf("%s: expected a constant when stubbed, got syscalls %v", test.builtin, got)
+		}
+	}
+
+	// selfbalance asks the GAS token for the balance of the contract
+	code := generate(`sstore(0, selfbalance())`, false)
+	found := false
+	for i, instr := range code {
+		if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Contract.Call" {
+			found = string(code[i-2].Operand) == "balanceOf" && string(code[i-1].Operand) == string(scriptHashBytes(GASTokenHash))
+		}
+	}
+	if !found {
+		t.Errorf("Expected GAS.balanceOf for selfbalance")
+	}
+
+	if !StubGasBuiltinsRequested(CompilerConfig{CompilerFlags: []string{"--stub-gas-builtins"}}) {
+		t.Errorf("Expected --stub-gas-builtins to stub the gas built-ins")
+	}
+	if StubGasBuiltinsRequested(CompilerConfig{}) {
+		t.Errorf("Expected the gas built-ins to be queried by default")
+	}
+	if !NewYulToNeoCompiler(CompilerConfig{StubGasBuiltins: true}).context.StubGasBuiltins {
+		t.Errorf("Expected StubGasBuiltins to reach the compiler context")
+	}
+}
+
+func TestCodeGeneratorBlockContext(t *testing.T) {
+	generate := func(builtin string) (*CodeGenerator, []NeoInstruction) {
+		ast, err := NewYulParser().Parse(`object "Test" { code { pop(` + builtin + `) } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		generator := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()})
+		contract, err := generator.Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+		return generator, contract.Runtime
+	}
+	// nativeCall is the sequence calling a native method with n arguments
+	nativeCall := func(n NeoOpcode) []NeoOpcode {
+		return []NeoOpcode{PUSH0 + n, PACK, PUSH1, PUSHDATA1, PUSHDATA1, SYSCALL}
+	}
+	concat := func(parts ...[]NeoOpcode) []NeoOpcode {
+		var all []NeoOpcode
+		for _, part := range parts {
+			all = append(all, part...)
+		}
+		return all
+	}
+	littleEndian := []NeoOpcode{PUSHDATA1, CAT, CONVERT}
+
+	tests := []struct {
+		builtin  string
+		expected []NeoOpcode
+		operands []string // Syscalls and native methods, in order
+	}{
+		{"timestamp()", []NeoOpcode{SYSCALL, PUSHDATA1, DIV}, []string{"System.Runtime.GetTime"}},
+		{"number()", concat(nativeCall(0), []NeoOpcode{PUSH1, ADD}), []string{"currentIndex"}},
+		{"chainid()", []NeoOpcode{SYSCALL}, []string{"System.Runtime.GetNetwork"}},
+		{"coinbase()", concat(nativeCall(0), nativeCall(1), []NeoOpcode{PUSH8, PICKITEM}, littleEndian),
+			[]string{"currentIndex", "getBlock"}},
+	}
+	for _, test := range tests {
+		_, code := generate(test.builtin)
+		// pop leaves a trailing DROP
+		code = code[:len(code)-1]
+		if len(code) != len(test.expected) {
+			t.Errorf("%s: expected %d instructions, got %d", test.builtin, len(test.expected), len(code))
+			continue
+		}
+		var operands []string
+		for i, instr := range code {
+			if instr.Opcode != test.expected[i] {
+				t.Errorf("%s: instruction %d is %s, expected %s", test.builtin, i,
+					OpcodeMnemonic(instr.Opcode), OpcodeMnemonic(test.expected[i]))
+			}
+			if instr.Opcode == SYSCALL && string(instr.Operand) != "System.Contract.Call" {
+				operands = append(operands, string(instr.Operand))
+			}
+			if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Contract.Call" {
+				if string(code[i-1].Operand) != string(scriptHashBytes(LedgerHash)) {
+					t.Errorf("%s: expected a call to the Ledger contract", test.builtin)
+				}
+				operands = append(operands, string(code[i-2].Operand))
+			}
+		}
+		if strings.Join(operands, " ") != strings.Join(test.operands, " ") {
+			t.Errorf("%s: expected %v, got %v", test.builtin, test.operands, operands)
+		}
+	}
+
+	// blockhash(n) calls block_hash, which returns 0 outside the 256 blocks
+	// before the current one
+	generator, code := generate("blockhash(7)")
+	if generator.pendingLabels[0].Name != "block_hash" {
+		t.Errorf("Expected blockhash to call block_hash, got %s", generator.pendingLabels[0].Name)
+	}
+	start, ok := generator.labelMap.Get("block_hash")
+	if !ok {
+		t.Fatalf("Expected the block_hash routine")
+	}
+	routine := code[start:]
+	pushWindow := NewPushInstruction(CreateNeoVMInteger(256))
+	window, missing := false, false
+	for _, instr := range routine {
+		if instr.Opcode == pushWindow.Opcode && string(instr.Operand) == string(pushWindow.Operand) {
+			window = true
+		}
+		if instr.Opcode == ISNULL {
+			missing = true
+		}
+	}
+	if !window || !missing {
+		t.Errorf("Expected block_hash to check the window and unknown blocks")
+	}
+}
+
+// TestCodeGeneratorContractCode tests extcodesize and extcodehash, which
+// read the NEF file of a deployed contract, prevrandao and invalid
+func TestCodeGeneratorContractCode(t *testing.T) {
+	result, err := NewYulToNeoCompiler(CompilerConfig{}).Compile(`object "T" { code {
+		sstore(0, extcodesize(0))
+		sstore(1, extcodesize(0x1234))
+		sstore(2, extcodehash(0))
+		sstore(3, extcodehash(0x1234))
+		sstore(4, prevrandao())
+	} }`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	host := NewTestHost()
+	if err := host.Deploy(result.Contract); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	nef := []byte("NEF3 script")
+	host.Engine.InteropServices["System.Contract.Call"] = func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+		method, _ := bytesOf(args[1])
+		items, _ := itemsOf(args[3])
+		data, err := bytesOf(items[0])
+		if err != nil {
+			return nil, err
+		}
+		if string(method) == "sha256" {
+			digest := sha256.Sum256(data)
+			return &NeoVMByteString{Value: digest[:]}, nil
+		}
+		// Only the contract at 0x1234 is deployed
+		if data[0] != 0x34 || data[1] != 0x12 {
+			return NeoVMNull{}, nil
+		}
+		return &NeoVMArray{Items: []NeoVMStackItem{
+			CreateNeoVMInteger(big.NewInt(1)), CreateNeoVMInteger(big.NewInt(0)),
+			&NeoVMByteString{Value: data}, &NeoVMByteString{Value: nef},
+		}}, nil
+	}
+	host.Engine.InteropServices["System.Runtime.GetRandom"] = func([]NeoVMStackItem) (NeoVMStackItem, error) {
+		return CreateNeoVMInteger(big.NewInt(42)), nil
+	}
+	host.Invoke("main").ExpectHalt(t)
+	digest := sha256.Sum256(nef)
+	word := make([]byte, len(digest))
+	for i := range digest {
+		word[len(word)-1-i] = digest[i]
+	}
+	host.ExpectStorage(t, 0, 0)
+	host.ExpectStorage(t, 1, len(nef))
+	host.ExpectStorage(t, 2, 0)
+	host.ExpectStorage(t, 3, new(big.Int).SetBytes(word))
+	host.ExpectStorage(t, 4, 42)
+
+	// invalid() reverts without data
+	result, err = NewYulToNeoCompiler(CompilerConfig{}).Compile(`object "T" { code { sstore(0, 1) invalid() } }`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	host = NewTestHost()
+	if err := host.Deploy(result.Contract); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	host.Invoke("main").ExpectFault(t, "invalid instruction")
+	host.ExpectStorage(t, 0, 0)
+}
+
+func TestCodeGeneratorCallValue(t *testing.T) {
+	generate := func(body string, zero bool) (*CodeGenerator, []NeoInstruction) {
+		ast, err := NewYulParser().Parse(`object "Test" { code { ` + body + ` } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		generator := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable(), ZeroCallValue: zero})
+		contract, err := generator.Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+		return generator, contract.Runtime
+	}
+
+	// Invoked directly, the value is 0, stored after INITSSLOT
+	generator, code := generate(`sstore(0, callvalue())`, false)
+	if len(code) < 3 || code[0].Opcode != PUSH0 || code[1].Opcode != INITSSLOT || code[2].Opcode != STSFLD0 {
+		t.Fatalf("Expected the call value to start at 0 in a static field")
+	}
+	shim, ok := generator.labelMap.Get(PaymentMethod)
+	if !ok {
+		t.Fatalf("Expected an %s entry point", PaymentMethod)
+	}
+	paysGAS := false
+	for _, instr := range code[shim:] {
+		if instr.Opcode == PUSHDATA1 && string(instr.Operand) == string(scriptHashBytes(GASTokenHash)) {
+			paysGAS = true
+		}
+	}
+	if !paysGAS {
+		t.Errorf("Expected the payment shim to check for GAS")
+	}
+	// The shim continues at INITSSLOT
+	entry := generator.pendingLabels[len(generator.pendingLabels)-1]
+	if target, _ := generator.labelMap.Get(entry.Name); (code[len(code)-1].Opcode != JMP && code[len(code)-1].Opcode != JMP_L) || target != 1 {
+		t.Errorf("Expected the payment shim to jump to the entry")
+	}
+
+	// Forced to zero, there is neither a field nor a shim: the only field
+	// holds the storage context
+	generator, code = generate(`sstore(0, callvalue())`, true)
+	if code[0].Operand[0] != 1 || code[3].Opcode != PUSH0 {
+		t.Errorf("Expected callvalue to be 0")
+	}
+	if _, ok := generator.labelMap.Get(PaymentMethod); ok {
+		t.Errorf("Expected no payment shim")
+	}
+	if !ZeroCallValueRequested(CompilerConfig{CompilerFlags: []string{"--zero-callvalue"}}) {
+		t.Errorf("Expected --zero-callvalue to force callvalue to 0")
+	}
+	if !NewYulToNeoCompiler(CompilerConfig{ZeroCallValue: true}).context.ZeroCallValue {
+		t.Errorf("Expected ZeroCallValue to reach the compiler context")
+	}
+
+	// origin is the transaction sender, read as an address, after the
+	// storage context is cached
+	_, code = generate(`sstore(0, origin())`, false)
+	code = code[3:]
+	expected := []NeoOpcode{SYSCALL, PUSH3, PICKITEM, PUSHDATA1, CAT, CONVERT}
+	for i, op := range expected {
+		if i >= len(code) || code[i].Opcode != op {
+			t.Fatalf("Expected origin to read the transaction sender, got %v", code)
+		}
+	}
+	if string(code[0].Operand) != "System.Runtime.GetScriptContainer" {
+		t.Errorf("Expected the script container, got %s", code[0].Operand)
+	}
+}
+
+// TestCodeGeneratorCheckedArithmetic tests that bounds checking checks the
+// arithmetic of attacker-controlled values for overflow
+func TestCodeGeneratorCheckedArithmetic(t *testing.T) {
+	throws := func(body string, checking bool) int {
+		ast, err := NewYulParser().Parse(`object "Test" { code { ` + body + ` } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		generator := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable(), BoundsChecking: checking})
+		contract, err := generator.Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+		count := 0
+		for _, instr := range contract.Runtime {
+			if instr.Opcode == PUSHDATA1 && string(instr.Operand) == "Panic(0x11)" {
+				count++
+			}
+		}
+		return count
+	}
+
+	body := `let x := calldataload(4) sstore(0, add(x, 1)) sstore(1, sub(x, 1)) sstore(2, mul(x, 2))`
+	if got := throws(body, true); got != 3 {
+		t.Errorf("Expected add, sub and mul to be checked, got %d checks", got)
+	}
+	if got := throws(body, false); got != 0 {
+		t.Errorf("Expected no checks without bounds checking, got %d", got)
+	}
+	// A masked value cannot overflow, and constants are not attacker-controlled
+	if got := throws(`let x := and(calldataload(4), 0xff) sstore(0, add(x, 1)) sstore(1, add(sload(0), 1))`, true); got != 0 {
+		t.Errorf("Expected no checks of bounded arithmetic, got %d", got)
+	}
+	// A counter incremented from an attacker-controlled value is widened
+	if got := throws(`for { let i := calldataload(4) } 1 { i := add(i, 1) } { if gt(i, 10) { break } }`, true); got != 1 {
+		t.Errorf("Expected the increment to be checked, got %d checks", got)
+	}
+}
+
+// TestCodeGeneratorNeoBuiltins tests the builtins of the neo namespace and
+// verbatim code
+func TestCodeGeneratorNeoBuiltins(t *testing.T) {
+	neo, _ := DialectByName(DialectNeo)
+	cancun, _ := DialectByName(DialectCancun)
+	generate := func(body string) (*NeoContract, error) {
+		parser := NewYulParser()
+		parser.SetDialect(neo)
+		ast, err := parser.Parse(`object "Test" { code { ` + body + ` } }`)
+		if err != nil {
+			return nil, err
+		}
+		return NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()}).Generate(ast)
+	}
+	syscalls := func(code []NeoInstruction) string {
+		var names []string
+		for _, instr := range code {
+			if instr.Opcode == SYSCALL && string(instr.Operand) != "System.Storage.GetContext" {
+				names = append(names, string(instr.Operand))
+			}
+		}
+		return strings.Join(names, " ")
+	}
+
+	tests := []struct {
+		body     string
+		syscalls string
+	}{
+		{`pop(neo.syscall("System.Runtime.GetTrigger"))`, "System.Runtime.GetTrigger"},
+		{`neo.syscall("System.Runtime.BurnGas", 100)`, "System.Runtime.BurnGas"},
+		{`if neo.checkwitness(caller()) { stop() }`, "System.Runtime.GetCallingScriptHash System.Runtime.CheckWitness"},
+		{`let it := neo.storage_find("\x01", 0)
+		  for { } neo.iterator_next(it) { } { sstore(0, neo.iterator_value(it)) }`, "System.Storage.Find System.Iterator.Next System.Iterator.Value System.Storage.Put System.Storage.Delete"},
+		{`function neo.notify(x) { } neo.notify(1)`, ""}, // Replaced by the function
+	}
+	for _, test := range tests {
+		contract, err := generate(test.body)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.body, err)
+			continue
+		}
+		if got := syscalls(contract.Runtime); !strings.Contains(got, test.syscalls) {
+			t.Errorf("%s: expected syscalls %s, got %s", test.body, test.syscalls, got)
+		}
+	}
+
+	// A notification packs its values and is recorded for the manifest
+	contract, err := generate(`neo.notify("Paid", caller(), 5) neo.notify("Paid", 1, 2)`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(contract.Events) != 1 || contract.Events[0].Name != "Paid" || len(contract.Events[0].Parameters) != 2 || contract.Events[0].Parameters[1].Type != "Any" {
+		t.Errorf("Expected one Paid event with two values, got %+v", contract.Events)
+	}
+	for i, instr := range contract.Runtime {
+		if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Runtime.Notify" {
+			if string(contract.Runtime[i-1].Operand) != "Paid" || contract.Runtime[i-2].Opcode != PACK {
+				t.Errorf("Expected the packed values and the name before Notify, got %v", contract.Runtime[i-3:i+1])
+			}
+		}
+	}
+
+	errorTests := []struct {
+		body string
+		err  string
+	}{
+		{`pop(neo.syscall("System.Nope"))`, `unknown interop service "System.Nope"`},
+		{`pop(neo.syscall("System.Storage.Get", 1))`, "neo.syscall expects 3 arguments, got 2"},
+		{`pop(neo.syscall("System.Contract.CallNative", 1))`, "variable number of items"},
+		{`let s := "System.Runtime.GetTime" pop(neo.syscall(s))`, "expects a string literal"},
+		{`neo.notify(1, 2)`, "expects a string literal"},
+		{`pop(neo.checkwitness())`, "neo.checkwitness expects 1 arguments, got 0"},
+		{`pop(neo.balance())`, "unknown Neo builtin neo.balance"},
+	}
+	for _, test := range errorTests {
+		_, err := generate(test.body)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected a parse error containing %q, got %v", test.body, test.err, err)
+		}
+	}
+
+	// Outside the neo dialect the namespace is unavailable
+	parser := NewYulParser()
+	parser.SetDialect(cancun)
+	if _, err := parser.Parse(`object "Test" { code { pop(neo.checkwitness(0)) } }`); err == nil || !strings.Contains(err.Error(), "neo.checkwitness is not a builtin of the cancun dialect") {
+		t.Errorf("Expected neo.checkwitness to be rejected by the cancun dialect, got %v", err)
+	}
+
+	// Builtins that notify or write keep a function out of the Safe methods
+	for body, safe := range map[string]bool{
+		`function f() -> r { r := neo.syscall("System.Runtime.GetTime") }`: true,
+		`function f() -> r { neo.syscall("System.Runtime.Log", "hi") }`:    false,
+		`function f() -> r { neo.notify("Ping") }`:                         false,
+		`function f() -> r { r := verbatim_0i_1o(hex"10") }`:               false,
+	} {
+		ast, err := NewYulParser().Parse(`object "Test" { code { ` + body + ` } }`)
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", body, err)
+		}
+		_, err = NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable(), ViewFunctions: []string{"f"}}).Generate(ast)
+		if got := err == nil; got != safe {
+			t.Errorf("%s: expected read-only %v, got error %v", body, safe, err)
+		}
+	}
+}
+
+// TestCodeGeneratorVerbatim tests that verbatim code reaches the script as
+// given, with its declared stack effect
+func TestCodeGeneratorVerbatim(t *testing.T) {
+	generate := func(body string, optimize bool) ([]NeoInstruction, error) {
+		parser := NewYulParser()
+		cancun, _ := DialectByName(DialectCancun)
+		parser.SetDialect(cancun)
+		ast, err := parser.Parse(`object "Test" { code { ` + body + ` } }`)
+		if err != nil {
+			return nil, err
+		}
+		generator := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()})
+		if optimize {
+			generator.SetPeepholeOptimizer(NewOptimizationEngine(2))
+		}
+		contract, err := generator.Generate(ast)
+		if err != nil {
+			return nil, err
+		}
+		return contract.Runtime, nil
+	}
+	verbatim := func(code []NeoInstruction) []NeoOpcode {
+		var ops []NeoOpcode
+		for _, instr := range code {
+			if instr.Verbatim {
+				ops = append(ops, instr.Opcode)
+			}
+		}
+		return ops
+	}
+
+	// INC, then SWAP SUB, in any dialect
+	code, err := generate(`sstore(0, verbatim_1i_1o(hex"9c", 41)) sstore(1, verbatim_2i_1o("\x50\x9f", 1, 2))`, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := verbatim(code); !reflect.DeepEqual(got, []NeoOpcode{INC, SWAP, SUB}) {
+		t.Errorf("Expected INC SWAP SUB, got %v", got)
+	}
+
+	// The optimizer keeps verbatim code, which would otherwise lose PUSH1 DROP
+	code, err = generate(`verbatim_0i_0o(hex"1145")`, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := verbatim(code); !reflect.DeepEqual(got, []NeoOpcode{PUSH1, DROP}) {
+		t.Errorf("Expected PUSH1 DROP kept, got %v", got)
+	}
+
+	// Code with a variable stack effect carries the declared one at its end
+	code, err = generate(`sstore(0, verbatim_2i_1o(hex"12c0", 1, 2))`, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, instr := range code {
+		if instr.Verbatim && instr.Opcode == PACK && (instr.StackPop != 2 || instr.StackPush != 1) {
+			t.Errorf("Expected PACK to take 2 items and leave 1, got %d and %d", instr.StackPop, instr.StackPush)
+		}
+	}
+
+	errorTests := []struct {
+		body string
+		err  string
+	}{
+		{`pop(verbatim_0i_1o(hex"22fe"))`, "verbatim code must not use JMP"},
+		{`pop(verbatim_0i_1o(hex"40"))`, "verbatim code must not use RET"},
+		{`pop(verbatim_0i_1o(hex"ff"))`, "unknown opcode 0xFF"},
+		{`pop(verbatim_0i_1o(""))`, "verbatim_0i_1o has no code"},
+		{`let c := 1 pop(verbatim_0i_1o(c))`, "expects a string literal"},
+		{`pop(verbatim_1i_1o(hex"9c"))`, "verbatim_1i_1o expects 2 arguments, got 1"},
+		{`pop(verbatim_0i_1o(hex"9c"))`, "code takes more than its 0 arguments"},
+		{`pop(verbatim_0i_1o(hex"1112"))`, "code leaves 2 values, not 1"},
+	}
+	for _, test := range errorTests {
+		_, err := generate(test.body, false)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected a parse error containing %q, got %v", test.body, test.err, err)
+		}
+	}
+
+	// A function of the name replaces the builtin
+	if _, err := generate(`function verbatim_0i_1o(x) -> r { r := x } sstore(0, verbatim_0i_1o(5))`, false); err != nil {
+		t.Errorf("Expected a function to replace verbatim, got %v", err)
+	}
+}
+
+// TestCodeGeneratorTransientStorage tests that tload and tstore use a map
+// created by the top-level code and by every method stub
+func TestCodeGeneratorTransientStorage(t *testing.T) {
+	generate := func(body string, exports ...string) []NeoInstruction {
+		ast, err := NewYulParser().Parse(`object "Test" { code { ` + body + ` } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		contract, err := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable(), ExportFunctions: exports}).Generate(ast)
+		if err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+		return contract.Runtime
+	}
+	count := func(code []NeoInstruction, op NeoOpcode) int {
+		n := 0
+		for _, instr := range code {
+			if instr.Opcode == op {
+				n++
+			}
+		}
+		return n
+	}
+
+	code := generate(`tstore(1, 2) sstore(0, tload(1))`)
+	if count(code, NEWMAP) != 1 {
+		t.Errorf("Expected the transient storage map to be created once, got %d", count(code, NEWMAP))
+	}
+	found := false
+	for i := 1; i < len(code); i++ {
+		found = found || code[i].Opcode == SETITEM && code[i-1].Opcode == REVERSE3
+	}
+	if !found {
+		t.Errorf("Expected tstore to set the slot in the map, got %v", code)
+	}
+	if count(code, HASKEY) != 1 || count(code, PICKITEM) != 1 {
+		t.Errorf("Expected one tload routine reading the map, got %v", code)
+	}
+
+	// Every stub starts with empty transient storage
+	code = generate(`function f() { tstore(1, 2) } function g() -> r { r := tload(1) }`, "f", "g")
+	if count(code, NEWMAP) != 3 {
+		t.Errorf("Expected the map created by the top-level code and both stubs, got %d", count(code, NEWMAP))
+	}
+
+	if code := generate(`sstore(0, 1)`); count(code, NEWMAP) != 0 {
+		t.Errorf("Expected no map without transient storage")
+	}
+
+	// Each access warns that transient storage does not outlive the
+	// invocation
+	ast, err := NewYulParser().Parse(`object "Test" { code { tstore(1, 2)
+		sstore(0, tload(1)) } }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{SymbolTable: NewSymbolTable(), ErrorCollector: NewErrorCollector()}
+	if _, err := NewCodeGenerator(context).Generate(ast); err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	warnings := context.ErrorCollector.GetWarnings()
+	if len(warnings) != 2 || !strings.Contains(warnings[0].Message, "tstore at line 1") ||
+		!strings.Contains(warnings[1].Message, "tload at line 2") || !strings.Contains(warnings[1].Message, "reentrancy lock") {
+		t.Errorf("Expected a warning for tstore and tload, got %v", warnings)
+	}
+
+	// The interpreter keeps transient storage apart from storage
+	ast, err = NewYulParser().Parse(`object "Test" { code { tstore(1, 7) sstore(0, add(tload(1), tload(2))) } }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	interp := NewYulInterpreter(nil)
+	if err := interp.ExecuteBlock(ast.Objects[0].Code); err != nil {
+		t.Fatalf("Execution failed: %v", err)
+	}
+	if value := interp.Storage[storageKey(big.NewInt(0))]; value == nil || value.Int64() != 7 || len(interp.Storage) != 1 {
+		t.Errorf("Expected slot 0 to be 7 and transient slots kept out of storage, got %v", interp.Storage)
+	}
+}
+
+func TestCodeGeneratorImmutables(t *testing.T) {
+	generate := func(source string) (*NeoContract, error) {
+		ast, err := NewYulParser().Parse(source)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		return NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()}).Generate(ast)
+	}
+	hasKey := func(code []NeoInstruction, key []byte) bool {
+		for _, instr := range code {
+			if instr.Opcode == PUSHDATA1 && string(instr.Operand) == string(key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	contract, err := generate(`object "Token" {
+		code {
+			let owner := caller()
+			setimmutable(0, "owner", owner)
+			datacopy(0, dataoffset("Token_deployed"), datasize("Token_deployed"))
+			return(0, datasize("Token_deployed"))
+		}
+		object "Token_deployed" { code { sstore(0, loadimmutable("owner")) } }
+	}`)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	immutable, ok := contract.Immutables.Lookup("owner")
+	if !ok || !immutable.Set || contract.Immutables.Len() != 1 {
+		t.Fatalf("Expected owner recorded as set, got %+v", contract.Immutables.Immutables())
+	}
+	if string(immutable.Key) != "\xffimmutable/owner" {
+		t.Errorf("Expected owner under the reserved prefix, got %x", immutable.Key)
+	}
+
+	// The runtime reads the key, _deploy writes it
+	deploy, _ := contract.EntryPoints.Get(DeployMethod)
+	runtime, constructor := contract.Runtime[:deploy], contract.Runtime[deploy:]
+	if !hasKey(runtime, immutable.Key) || !hasKey(constructor, immutable.Key) {
+		t.Errorf("Expected the key in the runtime and in %s", DeployMethod)
+	}
+	puts := 0
+	for _, instr := range constructor {
+		if instr.Opcode == SYSCALL && string(instr.Operand) == "System.Storage.Put" {
+			puts++
+		}
+	}
+	if puts != 1 {
+		t.Errorf("Expected %s to store the immutable once, got %d puts", DeployMethod, puts)
+	}
+
+	if contract, err := generate(`object "Test" { code { sstore(0, 1) } }`); err != nil || contract.Immutables != nil {
+		t.Errorf("Expected no immutable table without immutables, got %v, %v", contract, err)
+	}
+	if _, err := generate(`object "Test" { code { setimmutable(0, "x", 1) } }`); err == nil || !strings.Contains(err.Error(), "outside constructor") {
+		t.Errorf("Expected setimmutable in runtime code to fail, got %v", err)
+	}
+	if _, err := generate(`object "Test" { code { let n := "x" sstore(0, loadimmutable(n)) } }`); err == nil {
+		t.Errorf("Expected loadimmutable of a variable to fail")
+	}
+}
+
+func TestCodeGeneratorScriptVerifies(t *testing.T) {
+	sources := []string{
+		// The loop exit is the end of the code
+		`object "Test" { code { for { let i := 0 } lt(i, 3) { i := add(i, 1) } { sstore(i, i) } } }`,
+		// The constructor is optimized away
+		`object "Test" {
+			code { pop(0) }
+			object "runtime" { code { sstore(0, 1) } }
+		}`,
+	}
+	for _, source := range sources {
+		result, err := NewYulToNeoCompiler(CompilerConfig{OptimizationLevel: 1}).Compile(source)
+		if err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		script, err := result.Contract.Script()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyScript(script); err != nil {
+			t.Errorf("Expected the script to verify, got %v\n%s", err, PrettyPrintInstructions(result.Contract.Runtime))
+		}
+	}
+
+	// DIV; JMP past the end; ISTYPE Any
+	for _, script := range [][]byte{{0xa1, 0x22, 0x03}, {0xd9, 0x00}, {0x0c, 0x05}} {
+		if err := VerifyScript(script); err == nil {
+			t.Errorf("Expected %x to fail verification", script)
+		}
+	}
+}
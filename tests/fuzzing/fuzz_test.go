@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"strings"
@@ -322,6 +323,107 @@ func TestFuzzStructuralTesting(t *testing.T) {
 	}
 }
 
+// fuzzSeeds returns the seed corpus of the fuzz targets: generated
+// programs and contracts exercising objects, data and exceptions
+func fuzzSeeds() []string {
+	seeds := []string{
+		`object "Simple" { code { let x := 1 } }`,
+		`object "Token" {
+			code {
+				datacopy(0, dataoffset("runtime"), datasize("runtime"))
+				return(0, datasize("runtime"))
+			}
+			object "runtime" {
+				code {
+					switch shr(224, calldataload(0))
+					case 0x70a08231 { mstore(0, sload(calldataload(4))) return(0, 32) }
+					default { revert(0, 0) }
+				}
+			}
+			data "meta" hex"c0ffee"
+		}`,
+	}
+	for seed := int64(0); seed < 64; seed++ {
+		seeds = append(seeds, NewYulProgramGenerator(seed).Program())
+	}
+	return seeds
+}
+
+// FuzzLexer checks that the lexer never panics
+func FuzzLexer(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, source string) {
+		lexer := NewYulLexer()
+		if err := lexer.Init(source); err == nil {
+			lexer.ScanTokens()
+		}
+	})
+}
+
+// FuzzParser checks that the parser never panics and that every AST it
+// returns survives the JSON round trip
+func FuzzParser(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, source string) {
+		ast, err := NewYulParser().Parse(source)
+		if err != nil {
+			return
+		}
+		var buf bytes.Buffer
+		if err := SaveYulAST(&buf, ast); err != nil {
+			t.Fatalf("Saving the AST failed: %v", err)
+		}
+		loaded, err := LoadYulAST(&buf)
+		if err != nil {
+			t.Fatalf("Loading the AST failed: %v\n%s", err, buf.String())
+		}
+		if want, got := PrintYul(ast), PrintYul(loaded); got != want {
+			t.Fatalf("AST changed in the JSON round trip:\n%s\nbecame\n%s", want, got)
+		}
+	})
+}
+
+// FuzzCompiler checks that the compiler never panics and that every
+// script it produces is one a node accepts
+func FuzzCompiler(f *testing.F) {
+	for i, seed := range fuzzSeeds() {
+		f.Add(seed, uint8(i%4))
+	}
+	f.Fuzz(func(t *testing.T, source string, level uint8) {
+		config := CompilerConfig{OptimizationLevel: int(level % 4)}
+		result, err := NewYulToNeoCompiler(config).Compile(source)
+		if err != nil || result.Contract == nil {
+			return
+		}
+		script, err := result.Contract.Script()
+		if err != nil {
+			t.Fatalf("Assembling the script failed: %v", err)
+		}
+		if err := VerifyScript(script); err != nil {
+			t.Fatalf("Script fails verification: %v\n%s", err, PrettyPrintInstructions(result.Contract.Runtime))
+		}
+	})
+}
+
+// TestFuzzGeneratedPrograms checks that generated programs compile at
+// every optimization level
+func TestFuzzGeneratedPrograms(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		source := NewYulProgramGenerator(seed).Program()
+		if source != NewYulProgramGenerator(seed).Program() {
+			t.Fatalf("Seed %d generated different programs", seed)
+		}
+		config := CompilerConfig{OptimizationLevel: int(seed % 4)}
+		if _, err := NewYulToNeoCompiler(config).Compile(source); err != nil {
+			t.Errorf("Seed %d: %v\n%s", seed, err, source)
+		}
+	}
+}
+
 // Supporting types and functions
 
 type FuzzConfig struct {
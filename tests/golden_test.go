@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Golden files record the disassembly and manifest each contract compiles
+// to. A change in instruction selection or optimization fails TestGolden
+// until the files are regenerated, so the change shows up in review:
+//
+//	go test ./tests -run TestGolden -update
+var update = flag.Bool("update", false, "rewrite the golden files of TestGolden")
+
+// goldenDir holds the golden files and the contracts compiled only for them
+const goldenDir = "testdata/golden"
+
+// goldenCase is a contract compiled with a configuration
+type goldenCase struct {
+	name   string // Golden file name, without extension
+	path   string // Yul source
+	config CompilerConfig
+}
+
+// goldenCases returns every example contract, at the default optimization
+// level, and the golden contracts at the levels they are recorded at
+func goldenCases(t *testing.T) []goldenCase {
+	examples, err := filepath.Glob("../examples/*/*.yul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []goldenCase
+	for _, path := range examples {
+		name := strings.TrimSuffix(filepath.Base(path), ".yul")
+		cases = append(cases, goldenCase{name, path, CompilerConfig{OptimizationLevel: 2}})
+	}
+
+	counter := []string{"increase", "get"}
+	for _, level := range []int{0, 1, 2} {
+		cases = append(cases, goldenCase{
+			fmt.Sprintf("Counter.O%d", level),
+			filepath.Join(goldenDir, "Counter.yul"),
+			CompilerConfig{OptimizationLevel: level, ExportFunctions: counter},
+		})
+	}
+	cases = append(cases, goldenCase{
+		"Registry",
+		filepath.Join(goldenDir, "Registry.yul"),
+		CompilerConfig{OptimizationLevel: 2, ExportFunctions: []string{"register", "lookup", "sum"}},
+	})
+	return cases
+}
+
+// goldenSnapshot compiles source and renders its disassembly and manifest.
+// Every golden contract must compile, so it fails on errors rather than
+// recording them.
+func goldenSnapshot(c goldenCase, source string) ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "; %s, optimization level %d\n", filepath.ToSlash(c.path), c.config.OptimizationLevel)
+	result, err := NewYulToNeoCompiler(c.config).Compile(source)
+	if err != nil {
+		return nil, fmt.Errorf("%s does not compile: %v", c.path, err)
+	}
+	if len(result.Errors) > 0 {
+		var messages []string
+		for _, e := range result.Errors {
+			messages = append(messages, fmt.Sprintf("%s error: %s", e.Phase, e.Message))
+		}
+		return nil, fmt.Errorf("%s does not compile: %s", c.path, strings.Join(messages, "; "))
+	}
+	WriteDisassembly(&out, result.Contract)
+	manifest, err := json.MarshalIndent(result.Contract.Manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	out.WriteString("\n; manifest\n")
+	out.Write(manifest)
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// goldenDifference describes the first line where got differs from want
+func goldenDifference(got, want []byte) string {
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			return fmt.Sprintf("line %d:\n\tgot:  %q\n\twant: %q", i+1, g, w)
+		}
+	}
+	return "no difference"
+}
+
+// TestGolden compares what each contract compiles to with its golden file
+func TestGolden(t *testing.T) {
+	for _, c := range goldenCases(t) {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			source, err := os.ReadFile(c.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := goldenSnapshot(c, string(source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The same source must compile to the same output every time
+			if again, _ := goldenSnapshot(c, string(source)); !bytes.Equal(got, again) {
+				t.Fatalf("Output is not deterministic, %s", goldenDifference(again, got))
+			}
+
+			golden := filepath.Join(goldenDir, c.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v; run with -update to create it", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s changed at %s\nRun with -update if the change is intended", golden, goldenDifference(got, want))
+			}
+		})
+	}
+}
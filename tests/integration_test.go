@@ -1,8 +1,25 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -82,15 +99,15 @@ func TestIntegrationSimpleContract(t *testing.T) {
 	}
 
 	// Verify function table is populated
-	generator := compiler.CodeGenerator.(*CodeGenerator)
-	if len(generator.functionTable) < 4 {
-		t.Errorf("Expected at least 4 functions, got %d", len(generator.functionTable))
+	functions := compiler.CodeGenerator.Functions()
+	if len(functions) < 4 {
+		t.Errorf("Expected at least 4 functions, got %d", len(functions))
 	}
 
 	// Check for essential functions
 	expectedFunctions := []string{"selector", "set", "get", "return_uint"}
 	for _, fn := range expectedFunctions {
-		if _, exists := generator.functionTable[fn]; !exists {
+		if _, exists := functions[fn]; !exists {
 			t.Errorf("Expected function '%s' not found", fn)
 		}
 	}
@@ -275,7 +292,8 @@ func TestIntegrationErrorHandling(t *testing.T) {
 				}
 			}
 			`,
-			expectError: false, // Should generate CALL instruction
+			expectError: true, // Calls must name a defined function
+			errorPhase:  "Code Generation",
 		},
 		{
 			name: "empty contract",
@@ -395,6 +413,11 @@ func TestIntegrationOptimizationLevels(t *testing.T) {
 		if len(curr.Contract.Runtime) == 0 {
 			t.Errorf("Optimization level %d produced no runtime code", optimizationLevels[i])
 		}
+
+		// Constant folding removes the identities of redundant from level 1
+		if i == 1 && len(curr.Contract.Runtime) >= len(prev.Contract.Runtime) {
+			t.Errorf("Expected level 1 to shrink %d instructions, got %d", len(prev.Contract.Runtime), len(curr.Contract.Runtime))
+		}
 		
 		// Higher optimization might not always reduce instruction count due to different strategies
 		// But compilation should always succeed
@@ -463,6 +486,10 @@ func TestIntegrationDebugInfo(t *testing.T) {
 		if funcInfo.ReturnCount != 1 {
 			t.Errorf("Expected 1 return value for testFunction, got %d", funcInfo.ReturnCount)
 		}
+		script, _ := result.Contract.Script()
+		if funcInfo.EndOffset <= funcInfo.StartOffset || funcInfo.EndOffset > len(script) || NeoOpcode(script[funcInfo.StartOffset]) != INITSLOT {
+			t.Errorf("Expected testFunction to span its code from INITSLOT, got %d..%d", funcInfo.StartOffset, funcInfo.EndOffset)
+		}
 	} else {
 		t.Error("testFunction not found in function map")
 	}
@@ -640,12 +667,12 @@ func TestIntegrationMetadataGeneration(t *testing.T) {
 	}
 
 	// Verify entry points exist
-	if len(result.Contract.EntryPoints) == 0 {
+	if result.Contract.EntryPoints.Len() == 0 {
 		t.Error("No entry points generated")
 	}
 
 	t.Logf("Metadata test passed: %d entry points, compiler %s", 
-		len(result.Contract.EntryPoints), metadata.Compiler.Version)
+		result.Contract.EntryPoints.Len(), metadata.Compiler.Version)
 }
 
 // TestIntegrationJSONSerialization tests JSON serialization of compilation results
@@ -797,4 +824,3071 @@ func BenchmarkIntegrationCompilation(b *testing.B) {
 			b.Fatal("No runtime code generated in benchmark")
 		}
 	}
-}
\ No newline at end of file
+}
+
+// TestIntegrationArtifactCompatibility tests compiler version and feature checks on artifacts
+func TestIntegrationArtifactCompatibility(t *testing.T) {
+	artifact := func(config CompilerConfig) *NeoContract {
+		compiler := NewYulToNeoCompiler(config)
+		contract := &NeoContract{Name: "Test", Metadata: &ContractMetadata{}}
+		contract, err := compiler.RuntimeManager.Finalize(contract)
+		if err != nil {
+			t.Fatalf("Finalize failed: %v", err)
+		}
+		return contract
+	}
+
+	release := artifact(CompilerConfig{})
+	if release.Metadata.Compiler.Version != CompilerVersion {
+		t.Errorf("Expected compiler version %s, got %s", CompilerVersion, release.Metadata.Compiler.Version)
+	}
+	if err := CheckArtifactCompatibility(release, UseDeploy); err != nil {
+		t.Errorf("Expected release artifact to be deployable: %v", err)
+	}
+
+	staging := artifact(CompilerConfig{BuildMode: "staging", CanaryMode: true})
+	if err := CheckArtifactCompatibility(staging, UseDeploy); err == nil || !strings.Contains(err.Error(), "--build-mode=release") {
+		t.Errorf("Expected canary artifact deployment to be refused with a remedy, got %v", err)
+	}
+	if err := CheckArtifactsCompatible(release, staging, UseLink); err == nil {
+		t.Errorf("Expected linking release and staging builds to fail")
+	}
+
+	size := artifact(CompilerConfig{OptimizeFor: "size"})
+	if err := CheckArtifactsCompatible(release, size, UseDiff); err == nil {
+		t.Errorf("Expected diffing gas and size builds to fail")
+	}
+
+	newer := artifact(CompilerConfig{})
+	newer.Metadata.Compiler.Version = "2.0.0"
+	if err := CheckArtifactCompatibility(newer, UseLink); err == nil {
+		t.Errorf("Expected major version mismatch to be rejected")
+	}
+
+	unknown := artifact(CompilerConfig{})
+	unknown.Metadata.Compiler.Features = append(unknown.Metadata.Compiler.Features, "quantum-jumps")
+	if err := CheckArtifactCompatibility(unknown, UseDiff); err == nil || !strings.Contains(err.Error(), "quantum-jumps") {
+		t.Errorf("Expected unknown feature to be reported, got %v", err)
+	}
+}
+
+// TestIntegrationStagedCompilation tests running the pipeline one stage at a time
+func TestIntegrationStagedCompilation(t *testing.T) {
+	source := `
+	object "Staged" {
+		code {
+			let x := add(1, 2)
+			function twice(a) -> r { r := mul(a, 2) }
+		}
+	}`
+
+	compiler := NewYulToNeoCompiler(CompilerConfig{OptimizationLevel: 1})
+
+	tokens, err := compiler.Lex(source)
+	if err != nil {
+		t.Fatalf("Lex failed: %v", err)
+	}
+	if len(tokens) == 0 || tokens[len(tokens)-1].Type != TokenEOF {
+		t.Errorf("Expected token stream ending in EOF")
+	}
+
+	ast, err := compiler.Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	annotated, err := compiler.Analyze(ast)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if annotated.Source != ast || annotated.Analysis == nil {
+		t.Errorf("Expected annotated AST to keep the parsed AST and analysis")
+	}
+
+	ir, err := compiler.Lower(annotated, &LowerOptions{SkipOptimization: true})
+	if err != nil {
+		t.Fatalf("Lower failed: %v", err)
+	}
+	if _, exists := ir.Functions["twice"]; !exists {
+		t.Errorf("Expected lowered IR to list function twice")
+	}
+	if len(ir.Contract.Runtime) == 0 {
+		t.Errorf("Expected lowered IR to contain instructions")
+	}
+
+	contract, err := compiler.Emit(ir)
+	if err != nil {
+		t.Fatalf("Emit failed: %v", err)
+	}
+	if contract.Metadata.Compiler.Version != CompilerVersion {
+		t.Errorf("Expected emitted contract to carry compiler metadata")
+	}
+
+	// Failures name the stage they happened in
+	_, err = compiler.Lex("")
+	stageErr, ok := err.(*StageError)
+	if !ok || stageErr.Phase != "Lexing" {
+		t.Errorf("Expected lexing stage error, got %v", err)
+	}
+}
+
+// TestIntegrationControlFlowGraph tests the graph the static analyzer
+// builds over branches, loops and functions, and its DOT rendering
+func TestIntegrationControlFlowGraph(t *testing.T) {
+	source := `
+	object "Flow" {
+		code {
+			let n := calldataload(0)
+			if iszero(n) { revert(0, 0) }
+			for { let i := 0 } lt(i, n) { i := add(i, 1) } {
+				if eq(i, 3) { continue }
+				if eq(i, 5) { break }
+				sstore(i, n)
+			}
+			switch n
+			case 1 { sstore(0, 1) }
+			default { sstore(0, 2) }
+			function f(a) -> r {
+				if a { leave }
+				r := 1
+			}
+		}
+	}`
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	analyzer := NewStaticAnalyzer(&CompilerContext{SymbolTable: NewSymbolTable(), ErrorCollector: NewErrorCollector()})
+	result, err := analyzer.Analyze(ast)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	cfg := result.ControlFlow
+	if len(cfg.Entries) != 2 || len(cfg.ExitNodes) != 2 || cfg.EntryNode != cfg.Entries[0] {
+		t.Fatalf("Expected entries and exits for the object code and f, got %d and %d", len(cfg.Entries), len(cfg.ExitNodes))
+	}
+
+	node := func(label string) *CFGNode {
+		for _, n := range cfg.Nodes {
+			if n.Label == label {
+				return n
+			}
+		}
+		t.Fatalf("No node %q", label)
+		return nil
+	}
+	successors := func(n *CFGNode) string {
+		var labels []string
+		for _, s := range n.Successors {
+			labels = append(labels, s.Label)
+		}
+		return strings.Join(labels, ", ")
+	}
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"revert(0, 0)", "exit object Flow"},
+		{"if iszero(n)", "revert(0, 0), let i := 0"},
+		{"for lt(i, n)", "if eq(i, 3), switch n"},
+		{"continue", "i := add(i, 1)"},
+		{"break", "switch n"},
+		{"i := add(i, 1)", "for lt(i, n)"},
+		{"switch n", "sstore(0, 1), sstore(0, 2)"},
+		{"leave", "exit function f"},
+		{"r := 1", "exit function f"},
+	}
+	for _, tc := range tests {
+		if got := successors(node(tc.label)); got != tc.want {
+			t.Errorf("Expected %q to lead to %s, got %s", tc.label, tc.want, got)
+		}
+	}
+
+	dot := cfg.DOT()
+	for _, want := range []string{"digraph cfg {", `[label="if iszero(n)", shape=diamond]`, `[label="eq(n, 1)"]`, `[label="iszero(lt(i, n))"]`} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("Expected %s in the DOT output:\n%s", want, dot)
+		}
+	}
+}
+
+// TestIntegrationDataFlowDiagnostics tests the def-use chains and the
+// warnings of the data flow analysis
+func TestIntegrationDataFlowDiagnostics(t *testing.T) {
+	source := `object "Flow" {
+	code {
+		let a
+		if calldataload(0) { a := 1 }
+		sstore(0, a)
+		let unused := 2
+		let b := 3
+		b := 4
+		sstore(1, b)
+		if calldataload(1) {
+			let b := 5
+			sstore(2, b)
+		}
+		function f(x) -> r {
+			r := x
+		}
+	}
+}`
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	context := &CompilerContext{SymbolTable: NewSymbolTable(), ErrorCollector: NewErrorCollector()}
+	result, err := NewStaticAnalyzer(context).Analyze(ast)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	// The use of a in sstore is reached by its declaration and the assignment
+	for _, use := range result.DataFlow.Uses {
+		if use.Variable.Name == "a" && len(use.Defs) != 2 {
+			t.Errorf("Expected 2 definitions of a to reach line %d, got %d", use.Location.Line, len(use.Defs))
+		}
+		if use.Variable.Name == "x" && (len(use.Defs) != 1 || use.Defs[0].Node.Type != CFGNodeEntry) {
+			t.Errorf("Expected the parameter x to reach its use")
+		}
+	}
+
+	want := []string{
+		"5: variable a may be read before it is assigned, reading zero",
+		"6: variable unused is never read",
+		"7: value assigned to b is never read",
+		"11: declaration of b shadows the one at line 7",
+	}
+	var got []string
+	for _, warning := range result.Warnings {
+		got = append(got, fmt.Sprintf("%d: %s", warning.Line, warning.Message))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected warnings\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	if len(context.ErrorCollector.GetWarnings()) != len(want) {
+		t.Errorf("Expected the warnings in the error collector, got %v", context.ErrorCollector.GetWarnings())
+	}
+}
+
+// TestIntegrationUnreachableCode tests the unreachable code warnings of
+// validation
+func TestIntegrationUnreachableCode(t *testing.T) {
+	source := `object "Dead" {
+	code {
+		let x := calldataload(0)
+		if x {
+			revert(0, 0)
+			sstore(0, 1)
+		}
+		if 0 {
+			sstore(1, x)
+		}
+		for {} 1 {} {
+			sstore(2, x)
+		}
+		sstore(3, x)
+		function f() {
+			leave
+			sstore(4, 4)
+		}
+	}
+}`
+	compiler := NewYulToNeoCompiler(CompilerConfig{OptimizationLevel: 0, MaxStackDepth: 1024})
+	result, err := compiler.Validate(source)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	var got []string
+	for _, warning := range result.Warnings {
+		if warning.Message == "unreachable code" {
+			got = append(got, fmt.Sprintf("%d:%d", warning.Line, warning.Column))
+		}
+	}
+	if want := []string{"6:4", "9:4", "14:3", "17:4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected unreachable code at %v, got %v", want, got)
+	}
+	if !result.IsValid {
+		t.Errorf("Expected unreachable code to be valid, got %v", result.Errors)
+	}
+}
+
+// TestIntegrationOverflowAnalysis tests the reports of arithmetic on
+// attacker-controlled values that may overflow
+func TestIntegrationOverflowAnalysis(t *testing.T) {
+	source := `object "Token" {
+	code {
+		let amount := calldataload(4)
+		let balance := sload(0)
+		sstore(0, add(balance, amount))
+		sstore(1, sub(balance, amount))
+		sstore(2, add(shr(248, amount), 1))
+		sstore(3, add(balance, 1))
+	}
+}`
+	analyze := func(checking bool) *AnalysisResult {
+		ast, err := NewYulParser().Parse(source)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		context := &CompilerContext{SymbolTable: NewSymbolTable(), ErrorCollector: NewErrorCollector(), BoundsChecking: checking}
+		result, err := NewStaticAnalyzer(context).Analyze(ast)
+		if err != nil {
+			t.Fatalf("Analyze failed: %v", err)
+		}
+		return result
+	}
+
+	result := analyze(false)
+	var got []string
+	for _, issue := range result.SecurityIssues {
+		got = append(got, fmt.Sprintf("%s %d:%d", issue.Type, issue.Location.Line, issue.Location.Column))
+	}
+	want := []string{"integer_overflow 5:13", "integer_underflow 6:13"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected issues %v, got %v", want, got)
+	}
+	warned := 0
+	for _, warning := range result.Warnings {
+		if strings.Contains(warning.Message, "attacker-controlled") {
+			warned++
+		}
+	}
+	if warned != 2 {
+		t.Errorf("Expected 2 overflow warnings, got %d: %v", warned, result.Warnings)
+	}
+
+	// Checked arithmetic cannot overflow
+	if result := analyze(true); len(result.SecurityIssues) != 0 {
+		t.Errorf("Expected no issues with bounds checking, got %v", result.SecurityIssues)
+	}
+}
+
+// TestIntegrationReentrancyAnalysis tests the reports of storage writes
+// after external calls
+func TestIntegrationReentrancyAnalysis(t *testing.T) {
+	source := `object "Bank" {
+	code {
+		function withdraw(to, amount) {
+			sstore(1, 0)
+			let ok := call(gas(), to, amount, 0, 0, 0, 0)
+			if iszero(ok) { revert(0, 0) }
+			setBalance(to, 0)
+		}
+		function setBalance(account, value) {
+			sstore(account, value)
+		}
+		function record(target) {
+			sstore(2, delegatecall(gas(), target, 0, 0, 0, 0))
+		}
+		function safe(to) {
+			setBalance(to, 0)
+			pop(call(gas(), to, 0, 0, 0, 0, 0))
+		}
+	}
+}`
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	result, err := NewStaticAnalyzer(&CompilerContext{SymbolTable: NewSymbolTable(), ErrorCollector: NewErrorCollector()}).Analyze(ast)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	var got []string
+	for _, issue := range result.SecurityIssues {
+		if issue.Type != SecurityIssueReentrancy {
+			continue
+		}
+		if len(issue.Related) != 1 {
+			t.Fatalf("Expected the call location, got %v", issue.Related)
+		}
+		got = append(got, fmt.Sprintf("%d:%d after %d:%d", issue.Location.Line, issue.Location.Column, issue.Related[0].Line, issue.Related[0].Column))
+	}
+	// The sstore before the call and the writes of safe are in order
+	want := []string{"7:4 after 5:14", "13:4 after 13:14"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected writes after calls %v, got %v", want, got)
+	}
+	for _, issue := range result.SecurityIssues {
+		if issue.Type == SecurityIssueReentrancy && issue.Location.Line == 7 && !strings.Contains(issue.Suggestion, "before the call at line 5") {
+			t.Errorf("Expected a suggested reorder, got %q", issue.Suggestion)
+		}
+	}
+}
+
+// TestIntegrationBulkCompile tests pattern expansion, the shared cache and
+// exit codes of the compile command
+func TestIntegrationBulkCompile(t *testing.T) {
+	dir := t.TempDir()
+	valid := `object "Ok" { code { let x := add(1, 2) } }`
+	write := func(name, source string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.yul", valid)
+	write("nested/deep/b.yul", valid)
+	write("nested/broken.yul", `object "Broken" { code { let := } }`)
+	write("nested/notes.txt", "not yul")
+
+	files, err := ExpandPatterns([]string{filepath.Join(dir, "**", "*.yul")})
+	if err != nil {
+		t.Fatalf("ExpandPatterns failed: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 .yul files, got %v", files)
+	}
+	if dirFiles, _ := ExpandPatterns([]string{dir}); len(dirFiles) != 3 {
+		t.Errorf("Expected a directory argument to expand to its .yul files, got %v", dirFiles)
+	}
+	if _, err := ExpandPatterns([]string{filepath.Join(dir, "*.sol")}); err == nil {
+		t.Errorf("Expected an error for a pattern without matches")
+	}
+
+	report := BulkCompile(files, BulkCompileOptions{Config: CompilerConfig{OptimizationLevel: 1}, Workers: 2})
+	if report.Count(BulkStatusError) != 1 {
+		t.Errorf("Expected one failed file, got %+v", report.Files)
+	}
+	cached := 0
+	for _, file := range report.Files {
+		if file.Cached {
+			cached++
+		}
+	}
+	if cached != 1 {
+		t.Errorf("Expected the duplicate source to come from the cache, got %d cached", cached)
+	}
+	if report.ExitCode([]string{BulkStatusError}) == 0 || report.ExitCode(nil) != 0 {
+		t.Errorf("Expected exit code to follow the configured severities")
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := RunCompileCommand([]string{"-j", "2", "-fail-on", "none", filepath.Join(dir, "**", "*.yul")}, &stdout, &stderr)
+	if code != 0 {
+		t.Errorf("Expected exit code 0 with -fail-on none, got %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "broken.yul") || !strings.Contains(stdout.String(), "3 files:") {
+		t.Errorf("Expected a status table, got:\n%s", stdout.String())
+	}
+	if code := RunCompileCommand([]string{"-fail-on", "fatal", dir}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected usage error for an unknown severity, got %d", code)
+	}
+}
+
+// TestIntegrationCompileArtifacts tests the NEF, manifest, debug and
+// disassembly files written by the compile command
+func TestIntegrationCompileArtifacts(t *testing.T) {
+	dir, out := t.TempDir(), t.TempDir()
+	source := filepath.Join(dir, "token.yul")
+	err := os.WriteFile(source, []byte(`object "Token" { code {
+		function balance(owner) -> amount { amount := sload(owner) }
+		sstore(0, calldataload(4))
+	} }`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-o", out, "-debug", "-export", "balance", "-supported-standard", "NEP-17", source}
+	if code := RunCompileCommand(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	for _, suffix := range []string{ArtifactNEF, ArtifactManifest, ArtifactDebug, ArtifactAsm, ArtifactContract} {
+		if _, err := os.Stat(filepath.Join(out, "token"+suffix)); err != nil {
+			t.Errorf("Expected the %s artifact: %v", suffix, err)
+		}
+	}
+
+	data, _ := os.ReadFile(filepath.Join(out, "token"+ArtifactNEF))
+	nef, err := DecodeNEF(data)
+	if err != nil || len(nef.Script) == 0 {
+		t.Errorf("Expected a valid NEF file, got %v", err)
+	}
+	var manifest ContractManifest
+	data, _ = os.ReadFile(filepath.Join(out, "token"+ArtifactManifest))
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("Expected a manifest: %v", err)
+	}
+	if !reflect.DeepEqual(manifest.SupportedStandards, []string{"NEP-17"}) {
+		t.Errorf("Expected the supported standard from its flag, got %v", manifest.SupportedStandards)
+	}
+	asm, _ := os.ReadFile(filepath.Join(out, "token"+ArtifactAsm))
+	if !strings.Contains(string(asm), "\nbalance:\n") || !strings.Contains(string(asm), "SYSCALL System.Storage.Put") {
+		t.Errorf("Expected the disassembly to label balance and name syscalls, got:\n%s", asm)
+	}
+
+	// Without -debug there is no debug information
+	out = t.TempDir()
+	if code := RunCompileCommand([]string{"-o", out, source}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(out, "token"+ArtifactDebug)); !os.IsNotExist(err) {
+		t.Errorf("Expected no debug artifact without -debug, got %v", err)
+	}
+}
+
+// TestIntegrationDebugArtifacts tests the solc source map and the NEP-19
+// debug information of a contract
+func TestIntegrationDebugArtifacts(t *testing.T) {
+	if got := ScriptHash(nil).String(); got != "0xcb9f3b7c6fb1cf2c13a40637c189bdd066a272b4" {
+		t.Errorf("Expected the script hash of the empty script, got %s", got)
+	}
+
+	source := `object "Token" {
+	code {
+		function balance(owner) -> amount {
+			amount := sload(owner)
+		}
+		sstore(0, balance(calldataload(4)))
+	}
+}`
+	result, err := NewYulToNeoCompiler(CompilerConfig{EnableDebugInfo: true, ExportFunctions: []string{"balance"}}).Compile(source)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	debug, runtime := result.DebugInfo, result.Contract.Runtime
+	if debug == nil || debug.Neo == nil || !reflect.DeepEqual(debug.Documents, []string{InlineSource}) {
+		t.Fatalf("Expected debug information of one document, got %+v", debug)
+	}
+
+	// Decompressing the source map gives the source references back
+	entries := strings.Split(debug.SrcMap, ";")
+	if len(entries) != len(runtime) {
+		t.Fatalf("Expected an entry per instruction, got %d for %d", len(entries), len(runtime))
+	}
+	fields := []string{"-1", "-1", "-1", "-"}
+	for i, entry := range entries {
+		for j, field := range strings.Split(entry, ":") {
+			if field != "" {
+				fields[j] = field
+			}
+		}
+		want := []string{"-1", "-1", "-1"}
+		if ref := runtime[i].SourceRef; ref != nil && ref.Line > 0 {
+			want = []string{strconv.Itoa(ref.Offset), strconv.Itoa(ref.Length), "0"}
+		}
+		if !reflect.DeepEqual(fields[:3], want) {
+			t.Fatalf("Expected entry %d to map to %v, got %v from %q", i, want, fields[:3], entry)
+		}
+		if runtime[i].Opcode == RET && fields[3] != "o" {
+			t.Errorf("Expected RET to return out of a function, got %q", entry)
+		}
+	}
+	if strings.Contains(debug.SrcMap, ";-1:-1:-1:-;-1:-1:-1:-;") {
+		t.Errorf("Expected repeated entries to be compressed, got %s", debug.SrcMap)
+	}
+
+	script, _ := result.Contract.Script()
+	neo := debug.Neo
+	if neo.Hash != ScriptHash(script).String() {
+		t.Errorf("Expected the script hash, got %s", neo.Hash)
+	}
+	methods := make(map[string]NeoDebugMethod)
+	for _, method := range neo.Methods {
+		methods[method.ID] = method
+	}
+	fn, ok := methods["func_balance"]
+	if !ok || fn.Name != result.Contract.Name+",balance" || !reflect.DeepEqual(fn.Params, []string{"owner,Integer,0"}) || fn.Return != "Integer" {
+		t.Fatalf("Expected the Yul function as a method, got %+v", neo.Methods)
+	}
+	if _, ok := methods["balance"]; !ok || !strings.HasPrefix(methods[ExternalCallMethod].Range, "0-") {
+		t.Errorf("Expected the contract methods, got %+v", neo.Methods)
+	}
+	var start, end int
+	fmt.Sscanf(fn.Range, "%d-%d", &start, &end)
+	lines := map[int]bool{}
+	for _, point := range fn.SequencePoints {
+		var address, document, line, column, endLine, endColumn int
+		if _, err := fmt.Sscanf(point, "%d[%d]%d:%d-%d:%d", &address, &document, &line, &column, &endLine, &endColumn); err != nil {
+			t.Fatalf("Expected a sequence point, got %q: %v", point, err)
+		}
+		if address < start || address > end || document != 0 {
+			t.Errorf("Expected sequence point %q in %s of document 0", point, fn.Range)
+		}
+		lines[line] = true
+	}
+	if !lines[4] || lines[6] {
+		t.Errorf("Expected sequence points of the function body only, got %v", fn.SequencePoints)
+	}
+
+	// The compile command names the source file as the document
+	dir, out := t.TempDir(), t.TempDir()
+	path := filepath.Join(dir, "token.yul")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := RunCompileCommand([]string{"-o", out, "-debug", "-export", "balance", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	var written NeoDebugInfo
+	data, _ := os.ReadFile(filepath.Join(out, "token"+ArtifactDebug))
+	if err := json.Unmarshal(data, &written); err != nil || !reflect.DeepEqual(written.Documents, []string{path}) || len(written.Methods) != len(neo.Methods) {
+		t.Errorf("Expected NEP-19 debug information of %s, got %v:\n%s", path, err, data)
+	}
+	if data, err := os.ReadFile(filepath.Join(out, "token"+ArtifactSrcMap)); err != nil || string(data) != debug.SrcMap {
+		t.Errorf("Expected the source map artifact, got %v", err)
+	}
+}
+
+// TestIntegrationDisassembler tests the annotated disassembly of scripts
+// and the disasm command
+func TestIntegrationDisassembler(t *testing.T) {
+	instructions, err := Disassemble([]byte{byte(TRY), 3, 0, byte(JMP), 0xFD, byte(RET)})
+	if err != nil || len(instructions) != 3 {
+		t.Fatalf("Expected three instructions, got %v: %v", instructions, err)
+	}
+	if instructions[0].Comment != "catch -> 1 (offset 3)" || instructions[1].Comment != "-> 0 (offset 0)" {
+		t.Errorf("Expected jump targets, got %q and %q", instructions[0].Comment, instructions[1].Comment)
+	}
+	if instructions, _ := Disassemble([]byte{byte(JMP), 1, byte(RET)}); !strings.Contains(instructions[0].Comment, "not an instruction") {
+		t.Errorf("Expected a target inside an instruction to be flagged, got %q", instructions[0].Comment)
+	}
+
+	source := `object "Token" {
+	code {
+		function balance(owner) -> amount {
+			amount := sload(owner)
+			if iszero(amount) { amount := 1 }
+		}
+		sstore(0, balance(calldataload(4)))
+	}
+}`
+	result, err := NewYulToNeoCompiler(CompilerConfig{EnableDebugInfo: true, ExportFunctions: []string{"balance"}}).Compile(source)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	script, _ := result.Contract.Script()
+	instructions, err = Disassemble(script)
+	if err != nil || len(instructions) != len(result.Contract.Runtime) {
+		t.Fatalf("Expected the runtime back, got %d instructions: %v", len(instructions), err)
+	}
+	if err := AttachDebugInfo(instructions, result.DebugInfo.Neo); err != nil {
+		t.Fatalf("AttachDebugInfo failed: %v", err)
+	}
+	jumps := 0
+	for i, instr := range instructions {
+		original := result.Contract.Runtime[i]
+		if instr.Opcode != original.Opcode || !bytes.Equal(instr.Operand, original.Operand) {
+			t.Fatalf("Instruction %d: expected %s, got %s", i, OpcodeMnemonic(original.Opcode), OpcodeMnemonic(instr.Opcode))
+		}
+		if isJump(instr.Opcode) {
+			jumps++
+			if !strings.HasPrefix(instr.Comment, "-> ") {
+				t.Errorf("Instruction %d: expected a jump target, got %q", i, instr.Comment)
+			}
+		}
+		if ref := original.SourceRef; ref != nil && ref.Line > 0 {
+			if instr.SourceRef == nil || instr.SourceRef.Line != ref.Line || instr.SourceRef.Column != ref.Column {
+				t.Errorf("Instruction %d: expected line %d:%d, got %+v", i, ref.Line, ref.Column, instr.SourceRef)
+			}
+		}
+	}
+	if jumps == 0 {
+		t.Errorf("Expected jumps in the script")
+	}
+
+	// The command finds the debug information next to the NEF
+	dir, out := t.TempDir(), t.TempDir()
+	path := filepath.Join(dir, "token.yul")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := RunCompileCommand([]string{"-o", out, "-debug", "-export", "balance", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	stdout.Reset()
+	nef := filepath.Join(out, "token"+ArtifactNEF)
+	if code := RunDisasmCommand([]string{nef}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	listing := stdout.String()
+	for _, want := range []string{"NeoVM Instructions:", "SYSCALL", "System.Storage.Put", "// -> ", " ; " + path + ":4"} {
+		if !strings.Contains(listing, want) {
+			t.Errorf("Expected %q in the listing:\n%s", want, listing)
+		}
+	}
+
+	// A hex script has no source lines; stale debug information fails
+	hexPath := filepath.Join(dir, "token.hex")
+	if err := os.WriteFile(hexPath, []byte(hex.EncodeToString(script)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if code := RunDisasmCommand([]string{hexPath}, &stdout, &stderr); code != 0 || strings.Contains(stdout.String(), path) {
+		t.Errorf("Expected a listing without source lines, got %d:\n%s", code, stdout.String())
+	}
+	debugPath := filepath.Join(out, "token"+ArtifactDebug)
+	if code := RunDisasmCommand([]string{"-debug", debugPath, hexPath}, &stdout, &stderr); code != 0 {
+		t.Errorf("Expected the debug information of the script to apply, got %d: %s", code, stderr.String())
+	}
+	if err := os.WriteFile(hexPath, []byte("40"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := RunDisasmCommand([]string{"-debug", debugPath, hexPath}, &stdout, &stderr); code != 1 {
+		t.Errorf("Expected debug information of another script to fail, got %d", code)
+	}
+	if code := RunDisasmCommand(nil, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected a usage error without a file, got %d", code)
+	}
+}
+
+// TestIntegrationDecompiler tests lifting scripts back into pseudo-Yul
+func TestIntegrationDecompiler(t *testing.T) {
+	ast, err := Decompile([]byte{byte(PUSH1), byte(PUSH2), byte(ADD), byte(RET)}, DecompileOptions{})
+	if err != nil {
+		t.Fatalf("Decompile failed: %v", err)
+	}
+	if text := PrintYul(ast); !strings.Contains(text, "function fn_0() -> r_0") || !strings.Contains(text, "r_0 := add(1, 2)") {
+		t.Errorf("Expected the sum to be returned, got:\n%s", text)
+	}
+
+	source := `object "Token" {
+	code {
+		function balance(owner) -> amount {
+			amount := sload(owner)
+			if iszero(amount) { amount := 1 }
+		}
+		function total(n) -> sum {
+			for { let i := 0 } lt(i, n) { i := add(i, 1) } {
+				if eq(i, 3) { continue }
+				if gt(i, 8) { break }
+				sum := add(sum, balance(i))
+			}
+		}
+		switch calldataload(0)
+		case 1 { sstore(1, total(10)) }
+		default { sstore(2, 0) }
+	}
+}`
+	result, err := NewYulToNeoCompiler(CompilerConfig{ExportFunctions: []string{"balance"}}).Compile(source)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	script, _ := result.Contract.Script()
+	methods := make(map[int]string)
+	for _, method := range result.Contract.Methods {
+		methods[method.Offset] = method.Name
+	}
+	ast, err = Decompile(script, DecompileOptions{Methods: methods})
+	if err != nil {
+		t.Fatalf("Decompile failed: %v", err)
+	}
+	text := PrintYul(ast)
+	for _, want := range []string{"function balance(", "for { } ", "continue", "break", "switch ", "if ", "System.Storage.Get(", "System.Storage.Put("} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in the decompiled code:\n%s", want, text)
+		}
+	}
+	for _, unwanted := range []string{"goto(", "opaque("} {
+		if strings.Contains(text, unwanted) {
+			t.Errorf("Expected the compiled control flow to be structured, got %q:\n%s", unwanted, text)
+		}
+	}
+	if _, err := NewYulParser().Parse(text); err != nil {
+		t.Errorf("Expected the decompiled code to parse: %v\n%s", err, text)
+	}
+
+	// The command names the methods after the manifest next to the NEF
+	dir, out := t.TempDir(), t.TempDir()
+	path := filepath.Join(dir, "token.yul")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := RunCompileCommand([]string{"-o", out, "-export", "balance", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	stdout.Reset()
+	if code := RunDecompileCommand([]string{filepath.Join(out, "token"+ArtifactNEF)}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "function balance(") {
+		t.Errorf("Expected the method names of the manifest:\n%s", stdout.String())
+	}
+	if code := RunDecompileCommand(nil, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected a usage error without a file, got %d", code)
+	}
+}
+
+// TestIntegrationStandardJSON tests the solc standard JSON interface
+func TestIntegrationStandardJSON(t *testing.T) {
+	input := `{
+		"language": "Yul",
+		"sources": {
+			"token.yul": {"content": "object \"Token\" { code {\n function balance(owner) -> amount { amount := sload(owner) }\n sstore(0, calldataload(4))\n } }"},
+			"broken.yul": {"content": "object \"Broken\" { code {\n let := 1\n } }"}
+		},
+		"settings": {
+			"optimizer": {"enabled": false},
+			"outputSelection": {"*": {"*": ["abi", "evm.bytecode.object", "evm.bytecode.sourceMap", "neo.nef"]}},
+			"neo": {"exportFunctions": ["balance"]}
+		}
+	}`
+	var stdout bytes.Buffer
+	if code := RunStandardJSON(strings.NewReader(input), &stdout); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	var output StandardJSONOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		t.Fatalf("Expected standard JSON output: %v\n%s", err, stdout.String())
+	}
+
+	if output.Sources["broken.yul"].ID != 0 || output.Sources["token.yul"].ID != 1 {
+		t.Errorf("Expected sources numbered in name order, got %+v", output.Sources)
+	}
+	var parserErrors int
+	for _, e := range output.Errors {
+		if e.Severity == "error" {
+			if e.Type != "ParserError" || e.SourceLocation == nil || e.SourceLocation.File != "broken.yul" || e.SourceLocation.Start == 0 {
+				t.Errorf("Expected a located parser error in broken.yul, got %+v", e)
+			}
+			parserErrors++
+		}
+	}
+	if parserErrors != 1 {
+		t.Errorf("Expected one error, got %+v", output.Errors)
+	}
+	if _, ok := output.Contracts["broken.yul"]; ok {
+		t.Errorf("Expected no contract for the broken source")
+	}
+
+	token := output.Contracts["token.yul"]["Token"]
+	if token == nil || token.EVM == nil || token.EVM.Bytecode == nil || token.Neo == nil {
+		t.Fatalf("Expected the selected outputs of Token, got %+v", output.Contracts)
+	}
+	script, err := hex.DecodeString(token.EVM.Bytecode.Object)
+	if err != nil || len(script) == 0 {
+		t.Errorf("Expected the script in hex, got %q", token.EVM.Bytecode.Object)
+	}
+	if !strings.Contains(token.EVM.Bytecode.SourceMap, ":1:") || token.EVM.Bytecode.Opcodes != "" || token.EVM.DeployedBytecode != nil {
+		t.Errorf("Expected only the selected bytecode outputs, got %+v", token.EVM.Bytecode)
+	}
+	if token.Neo.NEF == "" || token.Neo.Manifest != nil {
+		t.Errorf("Expected the NEF without the manifest, got %+v", token.Neo)
+	}
+	var balance *StandardJSONABIEntry
+	for i := range token.ABI {
+		if token.ABI[i].Name == "balance" {
+			balance = &token.ABI[i]
+		}
+	}
+	if balance == nil || balance.Type != "function" || len(balance.Inputs) != 1 || len(balance.Outputs) != 1 || balance.Outputs[0].Type != "uint256" {
+		t.Errorf("Expected balance in Ethereum ABI form, got %+v", token.ABI)
+	}
+
+	stdout.Reset()
+	RunStandardJSON(strings.NewReader(`{"language": "Solidity", "sources": {}}`), &stdout)
+	if !strings.Contains(stdout.String(), `"type": "JSONError"`) {
+		t.Errorf("Expected a JSONError for another language, got %s", stdout.String())
+	}
+}
+
+// TestIntegrationSolidityFrontend tests compiling the IR solc produces and
+// locating diagnostics in the Solidity source
+func TestIntegrationSolidityFrontend(t *testing.T) {
+	solidity := "contract Token {\n    function f() public { revert(); }\n}\ninterface IToken {}\n"
+	ir := `/// @use-src 0:"Token.sol"
+object "Token_10" {
+    code {
+        /// @src 0:0:62  "contract Token {..."
+        let usr$x := 1
+        sstore(0, usr$x)
+        /// @src 0:21:55  "function f() public { revert(); }"
+        revert(0, 0)
+        sstore(1, 2)
+    }
+}`
+	var request map[string]interface{}
+	frontend := &SolidityFrontend{
+		Config: CompilerConfig{OptimizationLevel: 0},
+		Run: func(input []byte) ([]byte, error) {
+			if err := json.Unmarshal(input, &request); err != nil {
+				return nil, err
+			}
+			return json.Marshal(map[string]interface{}{
+				"errors": []StandardJSONError{{Type: "Warning", Component: "general", Severity: "warning", Message: "from solc"}},
+				"contracts": map[string]interface{}{"Token.sol": map[string]interface{}{
+					"Token":  map[string]string{"ir": ir},
+					"IToken": map[string]string{"ir": ""},
+				}},
+			})
+		},
+	}
+	result, err := frontend.Compile(map[string]string{"Token.sol": solidity})
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if request["language"] != "Solidity" || !strings.Contains(fmt.Sprint(request["settings"]), "ir") {
+		t.Errorf("Expected solc to be asked for the IR, got %v", request)
+	}
+	if len(result.Contracts) != 1 || result.Contracts[0].Name != "Token" || result.Contracts[0].Result.Contract == nil {
+		t.Fatalf("Expected Token compiled and the interface skipped, got %+v", result.Contracts)
+	}
+	if result.HasErrors() || len(result.Diagnostics) < 2 || result.Diagnostics[0].Message != "from solc" {
+		t.Fatalf("Expected solc's warning first, got %+v", result.Diagnostics)
+	}
+	var unreachable *StandardJSONError
+	for i, d := range result.Diagnostics {
+		if strings.HasSuffix(d.Message, "unreachable code") {
+			unreachable = &result.Diagnostics[i]
+		}
+	}
+	if unreachable == nil || unreachable.SourceLocation == nil || *unreachable.SourceLocation != (StandardJSONLocation{File: "Token.sol", Start: 21, End: 55}) ||
+		!strings.HasPrefix(unreachable.FormattedMessage, "Token.sol:2:5: Warning:") {
+		t.Errorf("Expected the unreachable code located in function f, got %+v", unreachable)
+	}
+
+	frontend.Run = func([]byte) ([]byte, error) {
+		return []byte(`{"errors": [{"type": "ParserError", "severity": "error", "message": "Expected ';'"}]}`), nil
+	}
+	if result, err := frontend.Compile(map[string]string{"Token.sol": "contract"}); err != nil || !result.HasErrors() || len(result.Contracts) != 0 {
+		t.Errorf("Expected solc's error to stop compilation, got %+v, %v", result, err)
+	}
+}
+
+// TestIntegrationCompilationUnit tests linking objects across files
+func TestIntegrationCompilationUnit(t *testing.T) {
+	deployer := `object "Token" {
+	code {
+		datacopy(0, dataoffset("Token_deployed"), datasize("Token_deployed"))
+		return(0, datasize("Token_deployed"))
+	}
+}`
+	runtime := `object "Token_deployed" {
+	code {
+		let unused := calldataload(0)
+		sstore(0, calldataload(4))
+	}
+}`
+	compile := func(files ...string) (*CompilationResult, error) {
+		unit := NewCompilationUnit()
+		for i := 0; i < len(files); i += 2 {
+			if err := unit.AddFile(files[i], files[i+1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return NewYulToNeoCompiler(CompilerConfig{OptimizationLevel: 1}).CompileUnit(unit)
+	}
+
+	unit := NewCompilationUnit()
+	unit.AddFile("token/runtime.yul", runtime)
+	unit.AddFile("token/deployer.yul", deployer)
+	ast, err := unit.Link(NewYulParser())
+	if err != nil {
+		t.Fatalf("Link failed: %v", err)
+	}
+	if len(ast.Objects) != 1 || ast.Objects[0].Name != "Token" || ast.Objects[0].Objects.Keys()[0] != "Token_deployed" {
+		t.Fatalf("Expected the runtime nested in Token, got %+v", ast.Objects)
+	}
+	if file := ast.Objects[0].Objects.Values()[0].Location.File; file != "token/runtime.yul" {
+		t.Errorf("Expected positions to carry their file, got %q", file)
+	}
+
+	first, err := compile("runtime.yul", runtime, "deployer.yul", deployer)
+	if err != nil {
+		t.Fatalf("CompileUnit failed: %v", err)
+	}
+	second, err := compile("deployer.yul", deployer, "runtime.yul", runtime)
+	if err != nil {
+		t.Fatalf("CompileUnit failed: %v", err)
+	}
+	a, _ := first.Contract.Script()
+	b, _ := second.Contract.Script()
+	if !bytes.Equal(a, b) {
+		t.Errorf("Expected the same script whatever the order files are added in")
+	}
+	found := false
+	for _, warning := range first.Warnings {
+		found = found || (warning.File == "runtime.yul" && warning.Line == 3 && strings.Contains(warning.Message, "unused"))
+	}
+	if !found {
+		t.Errorf("Expected the unused variable reported in runtime.yul, got %+v", first.Warnings)
+	}
+
+	result, err := compile("a.yul", runtime, "b.yul", runtime)
+	var linkErr *LinkError
+	if !errors.As(err, &linkErr) || len(result.Errors) != 1 || result.Errors[0].Phase != "Linking" || result.Errors[0].File != "b.yul" ||
+		!strings.Contains(err.Error(), "already defined in a.yul") {
+		t.Errorf("Expected a duplicate object reported in b.yul, got %v, %+v", err, result.Errors)
+	}
+	cyclic := `object "A" { code { sstore(0, datasize("B")) } }`
+	if _, err := compile("a.yul", cyclic, "b.yul", `object "B" { code { sstore(0, datasize("A")) } }`); !errors.As(err, &linkErr) {
+		t.Errorf("Expected objects referring to each other to fail linking, got %v", err)
+	}
+	result, err = compile("broken.yul", `object "A" { code { let := 1 } }`)
+	if err == nil || len(result.Errors) != 1 || result.Errors[0].File != "broken.yul" || result.Errors[0].Line != 1 {
+		t.Errorf("Expected the parse error located in broken.yul, got %+v", result.Errors)
+	}
+}
+
+// TestIntegrationSolcIR tests a contract as solc --ir emits it: memory
+// reserved with memoryguard, the runtime copied with codecopy and every
+// external function ending the call with return
+func TestIntegrationSolcIR(t *testing.T) {
+	ir := `/// @use-src 0:"Counter.sol"
+object "Counter_21" {
+    code {
+        /// @src 0:25:171  "contract Counter {..."
+        mstore(64, memoryguard(128))
+        if callvalue() { revert_error_ca66f745a3ce8ff40e2ccaf1ad45db7774001b90d25810abd9040049be7bf4bb() }
+
+        constructor_Counter_21()
+
+        let _1 := allocate_unbounded()
+        codecopy(_1, dataoffset("Counter_21_deployed"), datasize("Counter_21_deployed"))
+
+        return(_1, datasize("Counter_21_deployed"))
+
+        function allocate_unbounded() -> memPtr {
+            memPtr := mload(64)
+        }
+
+        function revert_error_ca66f745a3ce8ff40e2ccaf1ad45db7774001b90d25810abd9040049be7bf4bb() {
+            revert(0, 0)
+        }
+
+        /// @src 0:25:171  "contract Counter {..."
+        function constructor_Counter_21() {
+            /// @src 0:25:171  "contract Counter {..."
+        }
+        /// @src 0:25:171  "contract Counter {..."
+    }
+    /// @use-src 0:"Counter.sol"
+    object "Counter_21_deployed" {
+        code {
+            /// @src 0:25:171  "contract Counter {..."
+            mstore(64, memoryguard(128))
+
+            if iszero(lt(calldatasize(), 4))
+            {
+                let selector := shift_right_224_unsigned(calldataload(0))
+                switch selector
+
+                case 0x06661abd
+                {
+                    // count()
+
+                    external_fun_count_4()
+                }
+
+                case 0xd09de08a
+                {
+                    // increment()
+
+                    external_fun_increment_20()
+                }
+
+                default {}
+            }
+
+            revert_error_42b3090547df1d2001c96683413b8cf91c1b902ef5e3cb8d9f6f304cf7446f74()
+
+            function shift_right_224_unsigned(value) -> newValue {
+                newValue :=
+
+                shr(224, value)
+
+            }
+
+            function allocate_unbounded() -> memPtr {
+                memPtr := mload(64)
+            }
+
+            function revert_error_ca66f745a3ce8ff40e2ccaf1ad45db7774001b90d25810abd9040049be7bf4bb() {
+                revert(0, 0)
+            }
+
+            function revert_error_dbdddcbe895c83990c08b3492a0e83918d802a52331272ac6fdb6a7c4aea3b1b() {
+                revert(0, 0)
+            }
+
+            function abi_decode_tuple_(headStart, dataEnd)   {
+                if slt(sub(dataEnd, headStart), 0) { revert_error_dbdddcbe895c83990c08b3492a0e83918d802a52331272ac6fdb6a7c4aea3b1b() }
+
+            }
+
+            function cleanup_from_storage_t_uint256(value) -> cleaned {
+                cleaned := value
+            }
+
+            function extract_from_storage_value_offset_0t_uint256(slot_value) -> value {
+                value := cleanup_from_storage_t_uint256(slot_value)
+            }
+
+            function read_from_storage_split_offset_0_t_uint256(slot) -> value {
+                value := extract_from_storage_value_offset_0t_uint256(sload(slot))
+
+            }
+
+            /// @ast-id 4
+            /// @src 0:50:70  "uint256 public count"
+            function getter_fun_count_4() -> ret {
+
+                let slot := 0
+                ret := read_from_storage_split_offset_0_t_uint256(slot)
+
+            }
+            /// @src 0:25:171  "contract Counter {..."
+
+            function cleanup_t_uint256(value) -> cleaned {
+                cleaned := value
+            }
+
+            function abi_encode_t_uint256_to_t_uint256_fromStack(value, pos) {
+                mstore(pos, cleanup_t_uint256(value))
+            }
+
+            function abi_encode_tuple_t_uint256__to_t_uint256__fromStack(headStart , value0) -> tail {
+                tail := add(headStart, 32)
+
+                abi_encode_t_uint256_to_t_uint256_fromStack(value0,  add(headStart, 0))
+
+            }
+
+            function external_fun_count_4() {
+
+                if callvalue() { revert_error_ca66f745a3ce8ff40e2ccaf1ad45db7774001b90d25810abd9040049be7bf4bb() }
+                abi_decode_tuple_(4, calldatasize())
+                let ret_0 :=  getter_fun_count_4()
+                let memPos := allocate_unbounded()
+                let memEnd := abi_encode_tuple_t_uint256__to_t_uint256__fromStack(memPos , ret_0)
+                return(memPos, sub(memEnd, memPos))
+
+            }
+
+            function abi_encode_tuple__to__fromStack(headStart ) -> tail {
+                tail := add(headStart, 0)
+
+            }
+
+            function external_fun_increment_20() {
+
+                if callvalue() { revert_error_ca66f745a3ce8ff40e2ccaf1ad45db7774001b90d25810abd9040049be7bf4bb() }
+                abi_decode_tuple_(4, calldatasize())
+                fun_increment_20()
+                let memPos := allocate_unbounded()
+                let memEnd := abi_encode_tuple__to__fromStack(memPos  )
+                return(memPos, sub(memEnd, memPos))
+
+            }
+
+            function revert_error_42b3090547df1d2001c96683413b8cf91c1b902ef5e3cb8d9f6f304cf7446f74() {
+                revert(0, 0)
+            }
+
+            function update_storage_value_offset_0t_uint256_to_t_uint256(slot, value_0) {
+                sstore(slot, cleanup_t_uint256(value_0))
+            }
+
+            function panic_error_0x11() {
+                mstore(0, 35408467139433450592217433187231851964531694900788300625387963629091585785856)
+                mstore(4, 0x11)
+                revert(0, 0x24)
+            }
+
+            function increment_t_uint256(value) -> ret {
+                value := cleanup_t_uint256(value)
+                if eq(value, 0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff) { panic_error_0x11() }
+                ret := add(value, 1)
+            }
+
+            /// @ast-id 20
+            /// @src 0:77:169  "function increment() public {..."
+            function fun_increment_20() {
+
+                /// @src 0:147:152  "count"
+                let _1 := read_from_storage_split_offset_0_t_uint256(0x00)
+                let _2 := increment_t_uint256(_1)
+                update_storage_value_offset_0t_uint256_to_t_uint256(0x00, _2)
+
+            }
+            /// @src 0:25:171  "contract Counter {..."
+
+        }
+
+        data ".metadata" hex"a2646970667358221220"
+    }
+
+}`
+	result, err := NewYulToNeoCompiler(CompilerConfig{}).Compile(ir)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	host := NewTestHost()
+	if err := host.Deploy(result.Contract); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+
+	count := []byte{0x06, 0x66, 0x1a, 0xbd}
+	increment := []byte{0xd0, 0x9d, 0xe0, 0x8a}
+	host.Invoke("main", increment, []interface{}{}).ExpectResult(t, []byte{})
+	host.Invoke("main", increment, []interface{}{}).ExpectResult(t, []byte{})
+	word := make([]byte, 32)
+	word[31] = 2
+	host.Invoke("main", count, []interface{}{}).ExpectResult(t, word)
+	host.ExpectStorage(t, 0, 2)
+	host.Invoke("main", []byte{1, 2, 3, 4}, []interface{}{}).ExpectFault(t, "execution reverted")
+}
+
+// TestIntegrationSolcIRExternalCall tests an external call as solc --ir
+// emits it, guarded by an extcodesize check of the callee and forwarding
+// its revert
+func TestIntegrationSolcIRExternalCall(t *testing.T) {
+	ir := `/// @use-src 0:"Poker.sol"
+object "Poker_18" {
+    code {
+        /// @src 0:93:193  "contract Poker {..."
+        mstore(64, memoryguard(128))
+        if callvalue() { revert_error_ca66f745a3ce8ff40e2ccaf1ad45db7774001b90d25810abd9040049be7bf4bb() }
+
+        let _1 := allocate_unbounded()
+        codecopy(_1, dataoffset("Poker_18_deployed"), datasize("Poker_18_deployed"))
+
+        return(_1, datasize("Poker_18_deployed"))
+
+        function allocate_unbounded() -> memPtr {
+            memPtr := mload(64)
+        }
+
+        function revert_error_ca66f745a3ce8ff40e2ccaf1ad45db7774001b90d25810abd9040049be7bf4bb() {
+            revert(0, 0)
+        }
+        /// @src 0:93:193  "contract Poker {..."
+    }
+    /// @use-src 0:"Poker.sol"
+    object "Poker_18_deployed" {
+        code {
+            /// @src 0:93:193  "contract Poker {..."
+            mstore(64, memoryguard(128))
+
+            if iszero(lt(calldatasize(), 4))
+            {
+                let selector := shift_right_224_unsigned(calldataload(0))
+                switch selector
+
+                case 0xb1a997ac
+                {
+                    // poke(address)
+
+                    external_fun_poke_17()
+                }
+
+                default {}
+            }
+
+            revert_error_42b3090547df1d2001c96683413b8cf91c1b902ef5e3cb8d9f6f304cf7446f74()
+
+            function shift_right_224_unsigned(value) -> newValue {
+                newValue :=
+
+                shr(224, value)
+
+            }
+
+            function allocate_unbounded() -> memPtr {
+                memPtr := mload(64)
+            }
+
+            function revert_error_ca66f745a3ce8ff40e2ccaf1ad45db7774001b90d25810abd9040049be7bf4bb() {
+                revert(0, 0)
+            }
+
+            function revert_error_dbdddcbe895c83990c08b3492a0e83918d802a52331272ac6fdb6a7c4aea3b1b() {
+                revert(0, 0)
+            }
+
+            function revert_error_c1322bf8034eace5e0b5c7295db60986aa89aae5e0ea0873e4689e076861a5db() {
+                revert(0, 0)
+            }
+
+            function cleanup_t_uint160(value) -> cleaned {
+                cleaned := and(value, 0xffffffffffffffffffffffffffffffffffffffff)
+            }
+
+            function cleanup_t_address(value) -> cleaned {
+                cleaned := cleanup_t_uint160(value)
+            }
+
+            function validator_revert_t_address(value) {
+                if iszero(eq(value, cleanup_t_address(value))) { revert(0, 0) }
+            }
+
+            function abi_decode_t_address(offset, end) -> value {
+                value := calldataload(offset)
+                validator_revert_t_address(value)
+            }
+
+            function abi_decode_tuple_t_address(headStart, dataEnd) -> value0 {
+                if slt(sub(dataEnd, headStart), 32) { revert_error_dbdddcbe895c83990c08b3492a0e83918d802a52331272ac6fdb6a7c4aea3b1b() }
+
+                {
+
+                    let offset := 0
+
+                    value0 := abi_decode_t_address(add(headStart, offset), dataEnd)
+                }
+
+            }
+
+            function abi_encode_tuple__to__fromStack(headStart ) -> tail {
+                tail := add(headStart, 0)
+
+            }
+
+            function external_fun_poke_17() {
+
+                if callvalue() { revert_error_ca66f745a3ce8ff40e2ccaf1ad45db7774001b90d25810abd9040049be7bf4bb() }
+                let param_0 :=  abi_decode_tuple_t_address(4, calldatasize())
+                fun_poke_17(param_0)
+                let memPos := allocate_unbounded()
+                let memEnd := abi_encode_tuple__to__fromStack(memPos  )
+                return(memPos, sub(memEnd, memPos))
+
+            }
+
+            function revert_error_42b3090547df1d2001c96683413b8cf91c1b902ef5e3cb8d9f6f304cf7446f74() {
+                revert(0, 0)
+            }
+
+            function identity(value) -> ret {
+                ret := value
+            }
+
+            function convert_t_uint160_to_t_uint160(value) -> converted {
+                converted := cleanup_t_uint160(identity(cleanup_t_uint160(value)))
+            }
+
+            function convert_t_uint160_to_t_contract$_ICounter_$6(value) -> converted {
+                converted := convert_t_uint160_to_t_uint160(value)
+            }
+
+            function convert_t_address_to_t_contract$_ICounter_$6(value) -> converted {
+                converted := convert_t_uint160_to_t_contract$_ICounter_$6(value)
+            }
+
+            function convert_t_uint160_to_t_address(value) -> converted {
+                converted := convert_t_uint160_to_t_uint160(value)
+            }
+
+            function convert_t_contract$_ICounter_$6_to_t_address(value) -> converted {
+                converted := convert_t_uint160_to_t_address(value)
+            }
+
+            function revert_error_0cc013b6b3b6beabea4e3a74a6d380f0df81852ca99887912475e1f66b2a2c20() {
+                revert(0, 0)
+            }
+
+            function round_up_to_mul_of_32(value) -> result {
+                result := and(add(value, 31), not(31))
+            }
+
+            function panic_error_0x41() {
+                mstore(0, 35408467139433450592217433187231851964531694900788300625387963629091585785856)
+                mstore(4, 0x41)
+                revert(0, 0x24)
+            }
+
+            function finalize_allocation(memPtr, size) {
+                let newFreePtr := add(memPtr, round_up_to_mul_of_32(size))
+                // protect against overflow
+                if or(gt(newFreePtr, 0xffffffffffffffff), lt(newFreePtr, memPtr)) { panic_error_0x41() }
+                mstore(64, newFreePtr)
+            }
+
+            function shift_left_224(value) -> newValue {
+                newValue :=
+
+                shl(224, value)
+
+            }
+
+            function revert_forward_1() {
+                let pos := allocate_unbounded()
+                returndatacopy(pos, 0, returndatasize())
+                revert(pos, returndatasize())
+            }
+
+            function abi_decode_tuple__fromMemory(headStart, dataEnd)   {
+                if slt(sub(dataEnd, headStart), 0) { revert_error_dbdddcbe895c83990c08b3492a0e83918d802a52331272ac6fdb6a7c4aea3b1b() }
+
+            }
+
+            /// @ast-id 17
+            /// @src 0:113:191  "function poke(address c) external {..."
+            function fun_poke_17(var_c_8) {
+
+                /// @src 0:157:168  "ICounter(c)"
+                let expr_13_address := convert_t_address_to_t_contract$_ICounter_$6(var_c_8)
+                /// @src 0:157:178  "ICounter(c).increment"
+                let expr_14_address := convert_t_contract$_ICounter_$6_to_t_address(expr_13_address)
+                let expr_14_functionSelector := 0xd09de08a
+                /// @src 0:157:180  "ICounter(c).increment()"
+
+                if iszero(extcodesize(expr_14_address)) { revert_error_0cc013b6b3b6beabea4e3a74a6d380f0df81852ca99887912475e1f66b2a2c20() }
+
+                // storage for arguments and returned data
+                let _1 := allocate_unbounded()
+                mstore(_1, shift_left_224(expr_14_functionSelector))
+                let _2 := abi_encode_tuple__to__fromStack(add(_1, 4) )
+
+                let _3 := call(gas(), expr_14_address,  0,  _1, sub(_2, _1), _1, 0)
+
+                if iszero(_3) { revert_forward_1() }
+
+                if _3 {
+
+                    let _4 := 0
+
+                    if gt(_4, returndatasize()) {
+                        _4 := returndatasize()
+                    }
+
+                    // update freeMemoryPointer according to dynamic return size
+                    finalize_allocation(_1, _4)
+
+                    // decode return parameters from external try-call into retVars
+                    abi_decode_tuple__fromMemory(_1, add(_1, _4))
+                }
+
+            }
+            /// @src 0:93:193  "contract Poker {..."
+
+        }
+
+        data ".metadata" hex"a2646970667358221220"
+    }
+
+}`
+	result, err := NewYulToNeoCompiler(CompilerConfig{}).Compile(ir)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	host := NewTestHost()
+	if err := host.Deploy(result.Contract); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+
+	// Only a counter at 0x1234 is deployed, and it reverts once poked twice
+	counter := make([]byte, 20)
+	counter[0], counter[1] = 0x34, 0x12
+	var calls []string
+	pokes := 0
+	host.Engine.InteropServices["System.Contract.Call"] = func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+		hash, _ := bytesOf(args[0])
+		method, _ := bytesOf(args[1])
+		calls = append(calls, string(method))
+		items, _ := itemsOf(args[3])
+		switch {
+		case string(method) == "getContract":
+			target, _ := bytesOf(items[0])
+			if string(target) != string(counter) {
+				return NeoVMNull{}, nil
+			}
+			return &NeoVMArray{Items: []NeoVMStackItem{
+				CreateNeoVMInteger(big.NewInt(1)), CreateNeoVMInteger(big.NewInt(0)),
+				&NeoVMByteString{Value: target}, &NeoVMByteString{Value: []byte("NEF3")},
+			}}, nil
+		case string(method) == ExternalCallMethod && string(hash) == string(counter):
+			selector, _ := bytesOf(items[0])
+			if string(selector) != "\xd0\x9d\xe0\x8a" {
+				return nil, fmt.Errorf("unexpected selector %x", selector)
+			}
+			if pokes++; pokes > 1 {
+				return nil, errors.New("counter stuck")
+			}
+			return &NeoVMByteString{Value: []byte{}}, nil
+		}
+		return nil, fmt.Errorf("unexpected call of %s", method)
+	}
+
+	poke := []byte{0xb1, 0xa9, 0x97, 0xac}
+	host.Invoke("main", poke, []interface{}{0x1234}).ExpectResult(t, []byte{})
+	if strings.Join(calls, " ") != "getContract main" {
+		t.Errorf("Expected the code check before the call, got %v", calls)
+	}
+
+	// The revert of the callee is forwarded
+	host.Invoke("main", poke, []interface{}{0x1234}).ExpectFault(t, "execution reverted")
+
+	// The check reverts before calling an account without a contract
+	calls = nil
+	host.Invoke("main", poke, []interface{}{0x5678}).ExpectFault(t, "execution reverted")
+	if strings.Join(calls, " ") != "getContract" {
+		t.Errorf("Expected no call to an account without a contract, got %v", calls)
+	}
+}
+
+// TestIntegrationGasReport tests the execution fees reported per function
+// and selector
+func TestIntegrationGasReport(t *testing.T) {
+	source := `object "Gas" {
+	code {
+		switch shr(224, calldataload(0))
+		case 0x01 { sstore(0, 1) }
+		case 0x02 { sstore(0, sum(calldataload(4))) sstore(1, 2) }
+		function sum(n) -> s {
+			for { let i := 0 } lt(i, n) { i := add(i, 1) } { s := add(s, i) }
+		}
+	}
+}`
+	result, err := NewYulToNeoCompiler(CompilerConfig{OptimizationLevel: 0, MaxStackDepth: 1024}).Compile(source)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	report := result.GasReport
+	if report == nil || len(report.Functions) != 1 || len(report.Cases) != 2 {
+		t.Fatalf("Expected sum and both cases in the gas report, got %+v", report)
+	}
+	sum := report.Functions[0]
+	if sum.Name != "sum" || !sum.Unbounded || sum.Min <= 0 || sum.Max < sum.Min {
+		t.Errorf("Expected the loop of sum to be unbounded, got %+v", sum)
+	}
+	first, second := report.Cases[0], report.Cases[1]
+	if first.Name != "case 0x01" || first.Line != 4 || first.Unbounded {
+		t.Errorf("Expected the first selector at line 4, got %+v", first)
+	}
+	// The second selector calls sum and writes twice
+	if !second.Unbounded || second.Min <= first.Max || second.Min < sum.Min {
+		t.Errorf("Expected the second selector to include sum, got %+v and %+v", first, second)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gas.yul")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := RunCompileCommand([]string{"-O", "0", "-fail-on", "none", "--gas-report", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	for _, want := range []string{"Gas report for " + path, "case 0x02", "(unbounded)"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("Expected %q in the output:\n%s", want, stdout.String())
+		}
+	}
+}
+
+// TestIntegrationNeoVMLimits tests that a contract beyond the NeoVM limits
+// fails compilation naming each limit
+func TestIntegrationNeoVMLimits(t *testing.T) {
+	source := fmt.Sprintf(`object "Big" {
+	code {
+		datacopy(0, dataoffset("blob"), datasize("blob"))
+	}
+	data "blob" hex"%s"
+}`, strings.Repeat("ab", NeoMaxItemSize+1))
+	result, err := NewYulToNeoCompiler(CompilerConfig{OptimizationLevel: 0}).Compile(source)
+	var limitsErr *LimitsError
+	if !errors.As(err, &limitsErr) {
+		t.Fatalf("Expected a limits error, got %v", err)
+	}
+	var limits []string
+	for _, violation := range limitsErr.Violations {
+		limits = append(limits, violation.Limit)
+		if violation.Suggestion == "" {
+			t.Errorf("Expected a suggestion for %s", violation.Limit)
+		}
+	}
+	if !reflect.DeepEqual(limits, []string{"item size", "script size"}) {
+		t.Errorf("Expected item and script size violations, got %v", limits)
+	}
+	if item := limitsErr.Violations[0]; item.Position.Line != 3 {
+		t.Errorf("Expected the oversized push at line 3, got %+v", item)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Phase != "Limit Validation" || result.Errors[0].Line != 3 {
+		t.Errorf("Expected one limit error at line 3, got %+v", result.Errors)
+	}
+
+	stack := StackUsage{MaxDepth: NeoVMMaxStackSize}
+	instructions := []NeoInstruction{NewInitSlotInstruction(2, 1), NewPushInstruction(CreateNeoVMInteger(1))}
+	err = CheckNeoVMLimits(instructions, stack, DefaultNeoVMLimits())
+	if !errors.As(err, &limitsErr) || limitsErr.Violations[0].Limit != "stack size" ||
+		!strings.Contains(err.Error(), "2051 stack items") {
+		t.Errorf("Expected the slots to count against the stack size, got %v", err)
+	}
+	if err := CheckNeoVMLimits(instructions, StackUsage{MaxDepth: 16}, DefaultNeoVMLimits()); err != nil {
+		t.Errorf("Expected a small script within the limits, got %v", err)
+	}
+}
+
+// TestIntegrationDialect tests compiling for a configured dialect
+func TestIntegrationDialect(t *testing.T) {
+	source := `object "T" {
+	code {
+		mcopy(0, 32, 32)
+	}
+}`
+	result, err := NewYulToNeoCompiler(CompilerConfig{Dialect: DialectShanghai}).Compile(source)
+	if err == nil || !strings.Contains(err.Error(), "mcopy is not a builtin of the shanghai dialect (added in cancun)") {
+		t.Fatalf("Expected mcopy to be rejected in the shanghai dialect, got %v", err)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Phase != "Parsing" || result.Errors[0].Line != 3 || result.Errors[0].Column != 3 {
+		t.Errorf("Expected a parse error at line 3, column 3, got %+v", result.Errors)
+	}
+	if _, err := NewYulToNeoCompiler(CompilerConfig{}).Compile(source); err != nil {
+		t.Errorf("Expected the neo dialect to accept mcopy, got %v", err)
+	}
+
+	result, err = NewYulToNeoCompiler(CompilerConfig{Dialect: "frontier2"}).Compile(source)
+	if err == nil || len(result.Errors) != 1 || result.Errors[0].Phase != "Configuration" || !strings.Contains(result.Errors[0].Message, "unknown dialect") {
+		t.Errorf("Expected an unknown dialect to fail compilation, got %v and %+v", err, result.Errors)
+	}
+}
+
+// TestIntegrationDiagnostics tests diagnostic codes, ranges, notes and
+// their JSON and SARIF output
+func TestIntegrationDiagnostics(t *testing.T) {
+	find := func(diagnostics []Diagnostic, code string) *Diagnostic {
+		for i := range diagnostics {
+			if diagnostics[i].Code == code {
+				return &diagnostics[i]
+			}
+		}
+		return nil
+	}
+
+	result, _ := NewYulToNeoCompiler(CompilerConfig{}).Compile(`object "T" { code { let := 1 } }`)
+	d := find(result.Diagnostics(), CodeSyntax)
+	if d == nil || d.Severity != SeverityError || d.Phase != "Parsing" || d.Range.Line != 1 || d.Range.Column == 0 {
+		t.Errorf("Expected a located syntax error, got %+v", result.Diagnostics())
+	}
+	result, _ = NewYulToNeoCompiler(CompilerConfig{Dialect: DialectShanghai}).Compile(`object "T" { code { mcopy(0, 32, 32) } }`)
+	if find(result.Diagnostics(), CodeUnavailableBuiltin) == nil {
+		t.Errorf("Expected a builtin unavailable in the dialect, got %+v", result.Diagnostics())
+	}
+
+	result, err := NewYulToNeoCompiler(CompilerConfig{}).Compile(`object "T" {
+	code {
+		let x := calldataload(0)
+		if x {
+			let x := 2
+			sstore(x, x)
+		}
+		sstore(0, linkersymbol("Lib"))
+	}
+}`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	d = find(result.Diagnostics(), CodeShadowing)
+	if d == nil || d.Severity != SeverityWarning || d.Range.Line != 5 || d.Range.EndColumn <= d.Range.Column {
+		t.Fatalf("Expected a shadowing warning at line 5, got %+v", result.Diagnostics())
+	}
+	if len(d.Related) != 1 || d.Related[0].Range.Line != 3 {
+		t.Errorf("Expected a note at the shadowed declaration, got %+v", d.Related)
+	}
+	if find(result.Diagnostics(), CodeCodeGeneration) == nil {
+		t.Errorf("Expected the code generation warning in the result, got %+v", result.Diagnostics())
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDiagnosticsJSON(&buf, result.Diagnostics()); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Diagnostic
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || !reflect.DeepEqual(decoded, result.Diagnostics()) {
+		t.Errorf("Expected diagnostics to round-trip through JSON, got %v", err)
+	}
+
+	// The compile command writes SARIF with files and related locations
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shadow.yul")
+	source := "object \"T\" { code {\n\tlet x := calldataload(0)\n\tif x { let x := 2 sstore(x, x) }\n} }"
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := RunCompileCommand([]string{"-format", "sarif", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	var sarif struct {
+		Version string
+		Runs    []struct {
+			Results []struct {
+				RuleID    string
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartLine int }
+					}
+				}
+				RelatedLocations []json.RawMessage
+			}
+		}
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &sarif); err != nil || sarif.Version != "2.1.0" || len(sarif.Runs) != 1 {
+		t.Fatalf("Expected a SARIF log, got %v:\n%s", err, stdout.String())
+	}
+	found := false
+	for _, r := range sarif.Runs[0].Results {
+		if r.RuleID == CodeShadowing && len(r.Locations) == 1 && len(r.RelatedLocations) == 1 {
+			location := r.Locations[0].PhysicalLocation
+			found = strings.HasSuffix(location.ArtifactLocation.URI, "shadow.yul") && location.Region.StartLine == 3
+		}
+	}
+	if !found {
+		t.Errorf("Expected the shadowing warning in the SARIF log, got:\n%s", stdout.String())
+	}
+	if code := RunCompileCommand([]string{"-format", "xml", path}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected usage error for an unknown format, got %d", code)
+	}
+}
+
+// TestIntegrationDiagnosticLevels tests suppression comments, levels of
+// diagnostic codes and warnings as errors
+func TestIntegrationDiagnosticLevels(t *testing.T) {
+	has := func(result *CompilationResult, code string, line int) bool {
+		for _, d := range result.Diagnostics() {
+			if d.Code == code && (line == 0 || d.Range.Line == line) {
+				return true
+			}
+		}
+		return false
+	}
+
+	source := `object "T" {
+	code {
+		let ok := call(gas(), 1, 0, 0, 0, 0, 0)
+		// yul-disable-next-line reentrancy
+		sstore(0, ok)
+		sstore(1, ok)
+		// yul-disable-next-line shadowing, unused-variable
+		let unused := 1
+		let other := 2
+	}
+}`
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(ast.Suppressions) != 2 || ast.Suppressions[0].Line != 5 || !reflect.DeepEqual(ast.Suppressions[1].Names, []string{"shadowing", "unused-variable"}) {
+		t.Fatalf("Expected two suppressions, got %+v", ast.Suppressions)
+	}
+	analysis, err := NewStaticAnalyzer(&CompilerContext{SymbolTable: NewSymbolTable(), ErrorCollector: NewErrorCollector()}).Analyze(ast)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	var lines []int
+	for _, issue := range analysis.SecurityIssues {
+		if issue.Type == SecurityIssueReentrancy {
+			lines = append(lines, issue.Location.Line)
+		}
+	}
+	if !reflect.DeepEqual(lines, []int{6}) {
+		t.Errorf("Expected the write at line 5 suppressed, got reentrancy at lines %v", lines)
+	}
+
+	result, err := NewYulToNeoCompiler(CompilerConfig{}).Compile(source)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if has(result, CodeUnusedVariable, 8) || !has(result, CodeUnusedVariable, 9) {
+		t.Errorf("Expected the unused variable at line 8 suppressed, got %+v", result.Diagnostics())
+	}
+
+	result, err = NewYulToNeoCompiler(CompilerConfig{DiagnosticLevels: []string{"unused-variable=error"}}).Compile(source)
+	if err == nil || result.Contract != nil || len(result.Errors) != 1 || result.Errors[0].Code != CodeUnusedVariable || result.Errors[0].Line != 9 {
+		t.Errorf("Expected the unused variable as an error, got %v and %+v", err, result.Errors)
+	}
+	result, err = NewYulToNeoCompiler(CompilerConfig{CompilerFlags: []string{"--diagnostic", "YUL3103=off"}}).Compile(source)
+	if err != nil || has(result, CodeUnusedVariable, 0) {
+		t.Errorf("Expected unused variables turned off, got %v and %+v", err, result.Diagnostics())
+	}
+
+	simple := `object "T" { code { let x := 1 } }`
+	for _, config := range []CompilerConfig{{WarningsAsErrors: true}, {CompilerFlags: []string{"--warn-as-error"}}} {
+		result, err = NewYulToNeoCompiler(config).Compile(simple)
+		if err == nil || !has(result, CodeUnusedVariable, 0) || len(result.Warnings) != 0 {
+			t.Errorf("Expected warnings as errors, got %v and %+v", err, result.Diagnostics())
+		}
+	}
+	result, err = NewYulToNeoCompiler(CompilerConfig{WarningsAsErrors: true, DiagnosticLevels: []string{"unused-variable=off"}}).Compile(simple)
+	if err != nil || len(result.Errors) != 0 {
+		t.Errorf("Expected warnings turned off not to fail, got %v and %+v", err, result.Errors)
+	}
+	result, err = NewYulToNeoCompiler(CompilerConfig{DiagnosticLevels: []string{"noise=off", "overflow=loud"}}).Compile(simple)
+	if err == nil || !has(result, CodeConfiguration, 0) || len(result.Errors) != 2 {
+		t.Errorf("Expected configuration errors for bad levels, got %v and %+v", err, result.Errors)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "unused.yul")
+	if err := os.WriteFile(path, []byte(simple), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := RunCompileCommand([]string{path}, &stdout, &stderr); code != 0 {
+		t.Errorf("Expected exit code 0 for warnings, got %d", code)
+	}
+	if code := RunCompileCommand([]string{"-warn-as-error", path}, &stdout, &stderr); code != 1 {
+		t.Errorf("Expected exit code 1 with -warn-as-error, got %d", code)
+	}
+	if code := RunCompileCommand([]string{"-warn-as-error", "-diagnostic", "unused-variable=off", path}, &stdout, &stderr); code != 0 {
+		t.Errorf("Expected exit code 0 with the warning turned off, got %d: %s", code, stdout.String())
+	}
+}
+
+func TestIntegrationExecutionEngine(t *testing.T) {
+	source := `object "Token" {
+	code {
+		function balance(owner) -> amount {
+			amount := sload(owner)
+			if iszero(amount) { amount := 1 }
+		}
+		function total(n) -> sum {
+			for { let i := 0 } lt(i, n) { i := add(i, 1) } {
+				if eq(i, 3) { continue }
+				if gt(i, 8) { break }
+				sum := add(sum, balance(i))
+			}
+		}
+		function store(k, v) { sstore(k, v) }
+		function hexed() -> r { r := add(0x1234, 1) }
+		function fail(x) { if x { revert(0, 0) } }
+		sstore(0, 0)
+	}
+}`
+	result, err := NewYulToNeoCompiler(CompilerConfig{ExportFunctions: []string{"balance", "total", "store", "hexed", "fail"}}).Compile(source)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	engine := NewNeoVMExecutionEngine(result.Contract.Runtime)
+	invoke := func(method string, args ...int64) int64 {
+		t.Helper()
+		var items []NeoVMStackItem
+		for _, arg := range args {
+			items = append(items, CreateNeoVMInteger(arg))
+		}
+		stack, err := engine.Invoke(result.Contract, method, items...)
+		if err != nil {
+			t.Fatalf("%s failed: %v", method, err)
+		}
+		if len(stack) != 1 {
+			return -1
+		}
+		value, err := integerOf(stack[0], neoVMMaxIntegerSize)
+		if err != nil {
+			t.Fatalf("%s returned %v: %v", method, stack[0], err)
+		}
+		return value.Int64()
+	}
+	if got := invoke("balance", 5); got != 1 {
+		t.Errorf("Expected balance 1, got %d", got)
+	}
+	invoke("store", 5, 7)
+	if got := invoke("balance", 5); got != 7 {
+		t.Errorf("Expected balance 7 after the store, got %d", got)
+	}
+	if got := invoke("total", 10); got != 14 {
+		t.Errorf("Expected total 14, got %d", got)
+	}
+	if got := invoke("hexed"); got != 0x1235 {
+		t.Errorf("Expected 0x1235, got %#x", got)
+	}
+	if engine.GasConsumed <= 0 || len(engine.Storage) != 1 {
+		t.Errorf("Expected gas and one storage entry, got %d and %x", engine.GasConsumed, engine.Storage)
+	}
+	_, err = engine.Invoke(result.Contract, "fail", CreateNeoVMInteger(1))
+	var fault *NeoVMFault
+	if !errors.As(err, &fault) || fault.Opcode != THROW || engine.State != VMStateFault {
+		t.Errorf("Expected revert to FAULT at THROW, got %v", err)
+	}
+
+	run := func(script string, gasLimit int64) ([]NeoVMStackItem, error) {
+		t.Helper()
+		code, err := hex.DecodeString(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		instructions, err := DisassembleScript(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine := NewNeoVMExecutionEngine(instructions)
+		engine.GasLimit = gasLimit
+		return engine.Execute(0)
+	}
+	// TRY; 1 / 0; catch: DROP, PUSH2
+	stack, err := run("3b08001110a13d0645123d0240", 0)
+	if err != nil || len(stack) != 1 || stack[0].String() != "2" {
+		t.Errorf("Expected the division fault caught, got %v and %v", stack, err)
+	}
+	// TRY; PUSH1; finally: PUSH2
+	stack, err = run("3b0006113d04123f40", 0)
+	if err != nil || len(stack) != 2 || stack[1].String() != "2" {
+		t.Errorf("Expected the finally block run, got %v and %v", stack, err)
+	}
+	// PUSH1; THROW
+	_, err = run("113a", 0)
+	if !errors.As(err, &fault) || fault.Offset != 1 || fault.Exception == nil {
+		t.Errorf("Expected an uncaught exception, got %v", err)
+	}
+	// JMP to itself
+	_, err = run("2200", 1000000)
+	if !errors.As(err, &fault) || !strings.Contains(fault.Message, "gas limit") {
+		t.Errorf("Expected the gas limit exceeded, got %v", err)
+	}
+}
+
+func TestIntegrationTestHost(t *testing.T) {
+	source := `object "Counter" {
+	code {
+		sstore(0, 10)
+		datacopy(0, dataoffset("runtime"), datasize("runtime"))
+		return(0, datasize("runtime"))
+	}
+	object "runtime" {
+		code {
+			function increase(n) -> total {
+				if gt(n, 100) { revert(0, 0) }
+				total := add(sload(0), n)
+				sstore(0, total)
+				log2(0, 0, 0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef, n)
+			}
+			function get() -> value { value := sload(0) }
+			sstore(1, 1)
+		}
+	}
+}`
+	result, err := NewYulToNeoCompiler(CompilerConfig{ExportFunctions: []string{"increase", "get"}}).Compile(source)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	host := NewTestHost()
+	if err := host.Deploy(result.Contract); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	host.ExpectStorage(t, 0, 10)
+	host.Invoke("get").ExpectResult(t, 10)
+
+	invocation := host.Invoke("increase", 5)
+	invocation.ExpectResult(t, 15)
+	topic, _ := new(big.Int).SetString("ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef", 16)
+	invocation.ExpectNotification(t, "Event_ddf252ad", topic, 5, []byte{})
+	invocation.ExpectGasAtMost(t, 10000000)
+	host.ExpectStorage(t, 0, 15)
+
+	invocation = host.Invoke("increase", 500)
+	invocation.ExpectFault(t, "reverted")
+	if len(invocation.Notifications) != 0 {
+		t.Errorf("Expected no notifications of a FAULT, got %v", invocation.Notifications)
+	}
+	host.ExpectStorage(t, 0, 15)
+
+	host.GasLimit = 1000
+	host.Invoke("increase", 1).ExpectFault(t, "gas limit")
+	host.ExpectStorage(t, 0, 15)
+	if host.Invoke("missing").Err == nil {
+		t.Error("Expected invoking a missing method to fail")
+	}
+}
+
+// TestIntegrationCodeBlock tests compiling a source that is a bare code
+// block
+func TestIntegrationCodeBlock(t *testing.T) {
+	result, err := NewYulToNeoCompiler(CompilerConfig{}).Compile("{ let x := 7 { sstore(0, x) } }")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	host := NewTestHost()
+	if err := host.Deploy(result.Contract); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	host.Invoke("main").ExpectHalt(t)
+	host.ExpectStorage(t, 0, 7)
+}
+
+// TestIntegrationGeneratedPrograms checks that generated programs compiled
+// and run by the execution engine return and store what the Yul
+// interpreter computes
+func TestIntegrationGeneratedPrograms(t *testing.T) {
+	programs := 2000
+	if testing.Short() {
+		programs = 200
+	}
+	for seed := int64(0); seed < int64(programs); seed++ {
+		c, err := NewYulProgramGenerator(seed).Case()
+		if err != nil {
+			t.Fatalf("Seed %d: %v", seed, err)
+		}
+		config := CompilerConfig{OptimizationLevel: int(seed % 4), ExportFunctions: []string{c.Entry}}
+		result, err := NewYulToNeoCompiler(config).Compile(c.Source)
+		if err != nil {
+			t.Fatalf("Seed %d: compile failed: %v\n%s", seed, err, c.Source)
+		}
+		host := NewTestHost()
+		if err := host.Deploy(result.Contract); err != nil {
+			t.Fatalf("Seed %d: deploy failed: %v", seed, err)
+		}
+		args := make([]interface{}, len(c.Args))
+		for i, arg := range c.Args {
+			args[i] = arg
+		}
+		if !host.Invoke(c.Entry, args...).ExpectResult(t, c.Results[0]) {
+			t.Fatalf("Seed %d at level %d, arguments %v:\n%s", seed, config.OptimizationLevel, c.Args, c.Source)
+		}
+		stored := 0
+		for key, value := range c.Storage {
+			slot, _ := new(big.Int).SetString(key, 16)
+			if value.Sign() != 0 {
+				stored++
+			}
+			if !host.ExpectStorage(t, slot, value) {
+				t.Fatalf("Seed %d at level %d:\n%s", seed, config.OptimizationLevel, c.Source)
+			}
+		}
+		if len(host.Engine.Storage) != stored {
+			t.Fatalf("Seed %d: expected %d stored slots, got %d", seed, stored, len(host.Engine.Storage))
+		}
+	}
+}
+
+// debugSource is the contract the debugger tests step through
+const debugSource = `object "Counter" {
+    code {
+        function double(x) -> y {
+            y := mul(x, 2)
+        }
+        function increase(n) -> total {
+            let d := double(n)
+            total := add(sload(0), d)
+            sstore(0, total)
+        }
+    }
+}`
+
+// TestIntegrationDebugSession tests breakpoints, stepping and inspection
+// by Yul line
+func TestIntegrationDebugSession(t *testing.T) {
+	result, err := NewYulToNeoCompiler(CompilerConfig{EnableDebugInfo: true, ExportFunctions: []string{"increase"}}).Compile(debugSource)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	session, err := NewDebugSession(result.Contract, result.DebugInfo.Neo)
+	if err != nil {
+		t.Fatalf("NewDebugSession failed: %v", err)
+	}
+	if lines := session.SetBreakpoints(InlineSource, []int{4, 5, 9, 11}); !reflect.DeepEqual(lines, []int{4, 6, 9, 0}) {
+		t.Errorf("Expected breakpoints on lines 4, 6, 9 and none, got %v", lines)
+	}
+	session.SetBreakpoints(InlineSource, []int{4, 9})
+	if err := session.Start("increase", 5); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	expectStop := func(stop DebugStop, reason string, line int) []DebugFrame {
+		t.Helper()
+		frames := session.Frames()
+		if stop.Reason != reason || frames[0].Source.Line != line {
+			t.Fatalf("Expected a %s stop on line %d, got %+v on line %d", reason, line, stop, frames[0].Source.Line)
+		}
+		return frames
+	}
+	frames := expectStop(session.Continue(), DebugStopBreakpoint, 4)
+	if len(frames) < 2 || frames[0].Name != "double" || frames[1].Name != "increase" {
+		t.Fatalf("Expected double called by increase, got %+v", frames)
+	}
+	if args := frames[0].Arguments; len(args) != 1 || args[0].Name != "x" || debugItemValue(args[0].Item) != "5" {
+		t.Errorf("Expected argument x = 5, got %+v", args)
+	}
+	expectStop(session.StepOut(), DebugStopStep, 7)
+	frames = expectStop(session.StepOver(), DebugStopStep, 8)
+	var d bool
+	for _, local := range frames[0].Locals {
+		d = d || debugItemValue(local.Item) == "10"
+	}
+	if !d {
+		t.Errorf("Expected a local holding d = 10, got %+v", frames[0].Locals)
+	}
+	expectStop(session.Continue(), DebugStopBreakpoint, 9)
+	if storage := session.Storage(); len(storage) != 0 {
+		t.Errorf("Expected empty storage before sstore, got %+v", storage)
+	}
+	if stop := session.Continue(); stop.Reason != DebugStopExit || session.Running() {
+		t.Fatalf("Expected the invocation to end, got %+v", stop)
+	}
+	if storage := session.Storage(); len(storage) != 1 || storage[0].Name != "slot 0" || debugItemValue(storage[0].Item) != "10" {
+		t.Errorf("Expected slot 0 = 10, got %+v", storage)
+	}
+	if stack := session.Stack(); len(stack) != 1 || debugItemValue(stack[0].Item) != "10" {
+		t.Errorf("Expected result 10, got %+v", stack)
+	}
+
+	// A FAULT stops as an exception and then ends the invocation
+	session.Host.GasLimit = 1000
+	if err := session.Start("increase", 5); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	session.SetBreakpoints(InlineSource, nil)
+	if stop := session.Continue(); stop.Reason != DebugStopException || stop.Err == nil {
+		t.Fatalf("Expected an exception, got %+v", stop)
+	}
+	if stop := session.Continue(); stop.Reason != DebugStopExit || stop.Err == nil {
+		t.Errorf("Expected the faulted invocation to end, got %+v", stop)
+	}
+}
+
+// TestIntegrationDebugAdapter tests a debug session over the Debug
+// Adapter Protocol
+func TestIntegrationDebugAdapter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter.yul")
+	if err := os.WriteFile(path, []byte(debugSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	go func() {
+		NewDebugAdapter(inReader, outWriter).Serve()
+		outWriter.Close()
+	}()
+	messages := make(chan map[string]interface{}, 100)
+	go func() {
+		reader := bufio.NewReader(outReader)
+		for {
+			content, err := ReadDAPMessage(reader)
+			if err != nil {
+				close(messages)
+				return
+			}
+			var message map[string]interface{}
+			json.Unmarshal(content, &message)
+			messages <- message
+		}
+	}()
+	next := func() map[string]interface{} {
+		t.Helper()
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				t.Fatal("Adapter closed its output")
+			}
+			return message
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timed out waiting for the adapter")
+		}
+		return nil
+	}
+	seq := 0
+	request := func(command string, arguments interface{}) map[string]interface{} {
+		t.Helper()
+		seq++
+		if err := WriteDAPMessage(inWriter, map[string]interface{}{"seq": seq, "type": "request", "command": command, "arguments": arguments}); err != nil {
+			t.Fatal(err)
+		}
+		response := next()
+		if response["type"] != "response" || response["request_seq"] != float64(seq) || response["success"] != true {
+			t.Fatalf("%s: unexpected response %v", command, response)
+		}
+		body, _ := response["body"].(map[string]interface{})
+		return body
+	}
+	event := func(name string) map[string]interface{} {
+		t.Helper()
+		message := next()
+		if message["type"] != "event" || message["event"] != name {
+			t.Fatalf("Expected event %s, got %v", name, message)
+		}
+		body, _ := message["body"].(map[string]interface{})
+		return body
+	}
+	list := func(body map[string]interface{}, key string) []map[string]interface{} {
+		var items []map[string]interface{}
+		for _, item := range body[key].([]interface{}) {
+			items = append(items, item.(map[string]interface{}))
+		}
+		return items
+	}
+
+	if body := request("initialize", map[string]interface{}{"adapterID": "neo-yul"}); body["supportsConfigurationDoneRequest"] != true {
+		t.Errorf("Unexpected capabilities %v", body)
+	}
+	request("launch", map[string]interface{}{"program": path, "method": "increase", "args": []interface{}{5}, "exports": []string{"increase"}})
+	event("initialized")
+	breakpoints := list(request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": path},
+		"breakpoints": []interface{}{map[string]interface{}{"line": 4}, map[string]interface{}{"line": 11}},
+	}), "breakpoints")
+	if breakpoints[0]["verified"] != true || breakpoints[0]["line"] != float64(4) || breakpoints[1]["verified"] != false {
+		t.Errorf("Unexpected breakpoints %v", breakpoints)
+	}
+	request("configurationDone", nil)
+	if body := event("stopped"); body["reason"] != "breakpoint" {
+		t.Fatalf("Expected a breakpoint stop, got %v", body)
+	}
+
+	frames := list(request("stackTrace", map[string]interface{}{"threadId": 1}), "stackFrames")
+	source, _ := frames[0]["source"].(map[string]interface{})
+	if frames[0]["name"] != "double" || frames[0]["line"] != float64(4) || source["path"] != path {
+		t.Fatalf("Unexpected top frame %v", frames[0])
+	}
+	scopes := list(request("scopes", map[string]interface{}{"frameId": 1}), "scopes")
+	if scopes[0]["name"] != "Arguments" {
+		t.Fatalf("Unexpected scopes %v", scopes)
+	}
+	variables := list(request("variables", map[string]interface{}{"variablesReference": scopes[0]["variablesReference"]}), "variables")
+	if len(variables) != 1 || variables[0]["name"] != "x" || variables[0]["value"] != "5" || variables[0]["type"] != "Integer" {
+		t.Errorf("Unexpected arguments %v", variables)
+	}
+
+	request("stepOut", map[string]interface{}{"threadId": 1})
+	event("stopped")
+	if frames := list(request("stackTrace", map[string]interface{}{"threadId": 1}), "stackFrames"); frames[0]["line"] != float64(7) {
+		t.Errorf("Expected to step out to line 7, got %v", frames[0])
+	}
+	request("continue", map[string]interface{}{"threadId": 1})
+	if output := event("output")["output"].(string); !strings.Contains(output, "increase: HALT [10]") {
+		t.Errorf("Unexpected output %q", output)
+	}
+	if body := event("exited"); body["exitCode"] != float64(0) {
+		t.Errorf("Unexpected exit %v", body)
+	}
+	event("terminated")
+	request("disconnect", nil)
+	inWriter.Close()
+}
+
+const lspSource = `object "Counter" {
+	code {
+		let total := sload(0)
+		function increase(n) -> result {
+			let total := add(sload(0), n)
+			result := total
+			sstore(0, double(total))
+		}
+		function double(x) -> y { y := add(x, x) }
+		sstore(1, increase(total))
+	}
+	data "meta" hex"0102"
+}`
+
+// lspAt returns the line and column of the first name in line of source
+func lspAt(source string, line int, name string) (int, int) {
+	text := strings.Split(source, "\n")[line-1]
+	return line, strings.Index(text, name) + 1
+}
+
+// TestIntegrationYulIndex tests name resolution and document symbols of
+// the language server index
+func TestIntegrationYulIndex(t *testing.T) {
+	index, err := IndexYul(lspSource, nil)
+	if err != nil {
+		t.Fatalf("IndexYul failed: %v", err)
+	}
+	declaredAt := func(line int, name string) int {
+		t.Helper()
+		r, ok := index.ReferenceAt(lspAt(lspSource, line, name))
+		if !ok || r.Name != name {
+			t.Fatalf("No reference to %s on line %d, got %+v", name, line, r)
+		}
+		if r.Symbol == nil {
+			return 0
+		}
+		return r.Symbol.Position.Line
+	}
+	for _, c := range []struct {
+		line     int
+		name     string
+		declared int
+	}{
+		{6, "total", 5},   // The local shadowing the outer variable
+		{10, "total", 3},  // The outer variable
+		{6, "result", 4},  // An assigned return variable
+		{7, "double", 9},  // A function defined after the call
+		{9, "x", 9},       // A parameter
+		{10, "sstore", 0}, // A builtin
+	} {
+		if declared := declaredAt(c.line, c.name); declared != c.declared {
+			t.Errorf("%s on line %d: expected the declaration on line %d, got %d", c.name, c.line, c.declared, declared)
+		}
+	}
+	if r, _ := index.ReferenceAt(lspAt(lspSource, 10, "sstore")); !r.Builtin {
+		t.Errorf("Expected sstore to be a builtin")
+	}
+	line, column := lspAt(lspSource, 7, "double")
+	if r, ok := index.Definition(line, column+len("double")); !ok || r.Line != 9 || r.Column != 12 || r.EndColumn != 18 {
+		t.Errorf("Expected double defined at 9:12-18, got %+v", r)
+	}
+
+	// Function bodies do not see the variables around them
+	outer := "object \"o\" {\n\tcode {\n\t\tlet a := 1\n\t\tfunction f() -> r { r := a }\n\t}\n}"
+	if index, err := IndexYul(outer, nil); err != nil {
+		t.Errorf("IndexYul failed: %v", err)
+	} else if r, ok := index.ReferenceAt(lspAt(outer, 4, "a }")); !ok || r.Symbol != nil {
+		t.Errorf("Expected a to be undefined in f, got %+v", r)
+	}
+
+	if len(index.Symbols) != 1 {
+		t.Fatalf("Expected one object, got %+v", index.Symbols)
+	}
+	counter := index.Symbols[0]
+	var names []string
+	for _, symbol := range counter.Children {
+		names = append(names, symbol.Kind+" "+symbol.Name+" "+symbol.Detail)
+	}
+	if want := []string{"variable total ", "function increase (n) -> result", "function double (x) -> y", "data meta 2 bytes"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected symbols %q, got %q", want, names)
+	}
+	if counter.Range.Line != 1 || counter.Range.EndLine != 13 || counter.Selection.Column != 8 {
+		t.Errorf("Unexpected object ranges %+v", counter)
+	}
+	if increase := counter.Children[1]; increase.Range.Line != 4 || increase.Range.EndLine != 8 || len(increase.Children) != 1 {
+		t.Errorf("Unexpected function symbol %+v", increase)
+	}
+}
+
+// TestIntegrationLanguageServer tests diagnostics, navigation and hovers
+// over the Language Server Protocol
+func TestIntegrationLanguageServer(t *testing.T) {
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- NewLanguageServer(inReader, outWriter).Serve()
+		outWriter.Close()
+	}()
+	messages := make(chan map[string]interface{}, 100)
+	go func() {
+		reader := bufio.NewReader(outReader)
+		for {
+			content, err := ReadDAPMessage(reader)
+			if err != nil {
+				close(messages)
+				return
+			}
+			var message map[string]interface{}
+			json.Unmarshal(content, &message)
+			messages <- message
+		}
+	}()
+	next := func() map[string]interface{} {
+		t.Helper()
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				t.Fatal("Server closed its output")
+			}
+			return message
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timed out waiting for the server")
+		}
+		return nil
+	}
+	send := func(message map[string]interface{}) {
+		t.Helper()
+		message["jsonrpc"] = "2.0"
+		if err := WriteDAPMessage(inWriter, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id := 0
+	request := func(method string, params interface{}) interface{} {
+		t.Helper()
+		id++
+		send(map[string]interface{}{"id": id, "method": method, "params": params})
+		response := next()
+		if response["id"] != float64(id) || response["error"] != nil {
+			t.Fatalf("%s: unexpected response %v", method, response)
+		}
+		return response["result"]
+	}
+	diagnostics := func() []interface{} {
+		t.Helper()
+		message := next()
+		if message["method"] != "textDocument/publishDiagnostics" {
+			t.Fatalf("Expected diagnostics, got %v", message)
+		}
+		return message["params"].(map[string]interface{})["diagnostics"].([]interface{})
+	}
+	const uri = "file:///counter.yul"
+	document := map[string]interface{}{"uri": uri}
+	position := func(line int, name string) interface{} {
+		line, column := lspAt(lspSource, line, name)
+		return map[string]interface{}{"textDocument": document, "position": map[string]int{"line": line - 1, "character": column - 1}}
+	}
+
+	result := request("initialize", map[string]interface{}{"initializationOptions": map[string]interface{}{"exports": []string{"increase"}}})
+	if capabilities := result.(map[string]interface{})["capabilities"].(map[string]interface{}); capabilities["hoverProvider"] != true {
+		t.Errorf("Unexpected capabilities %v", capabilities)
+	}
+	send(map[string]interface{}{"method": "initialized", "params": map[string]interface{}{}})
+	send(map[string]interface{}{"method": "textDocument/didOpen", "params": map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "yul", "version": 1, "text": lspSource},
+	}})
+	for _, d := range diagnostics() {
+		if d.(map[string]interface{})["severity"] == float64(1) {
+			t.Errorf("Unexpected error %v", d)
+		}
+	}
+
+	location := request("textDocument/definition", position(7, "double")).(map[string]interface{})
+	if start := location["range"].(map[string]interface{})["start"]; location["uri"] != uri || !reflect.DeepEqual(start, map[string]interface{}{"line": float64(8), "character": float64(11)}) {
+		t.Errorf("Unexpected definition %v", location)
+	}
+	hover := func(line int, name string) string {
+		t.Helper()
+		result, _ := request("textDocument/hover", position(line, name)).(map[string]interface{})
+		if result == nil {
+			t.Fatalf("No hover for %s on line %d", name, line)
+		}
+		return result["contents"].(map[string]interface{})["value"].(string)
+	}
+	if text := hover(10, "sstore"); !strings.Contains(text, "sstore(p, v)") || !strings.Contains(text, "Gas: ") {
+		t.Errorf("Unexpected sstore hover %q", text)
+	}
+	if text := hover(10, "increase"); !strings.Contains(text, "function increase(n) -> result") || !strings.Contains(text, "Gas: ") {
+		t.Errorf("Unexpected increase hover %q", text)
+	}
+	if text := hover(6, "total"); !strings.Contains(text, "let total") {
+		t.Errorf("Unexpected total hover %q", text)
+	}
+	// Builtin hovers describe what the builtin compiles to on Neo
+	if _, description, _ := BuiltinSignature("extcodesize"); !strings.Contains(description, "NEF file") {
+		t.Errorf("Unexpected extcodesize description %q", description)
+	}
+	if _, description, _ := BuiltinSignature("extcodecopy"); !strings.Contains(description, "Not supported on Neo") {
+		t.Errorf("Expected extcodecopy to be described as unsupported, got %q", description)
+	}
+	symbols := request("textDocument/documentSymbol", map[string]interface{}{"textDocument": document}).([]interface{})
+	if len(symbols) != 1 || symbols[0].(map[string]interface{})["name"] != "Counter" || symbols[0].(map[string]interface{})["kind"] != float64(2) {
+		t.Errorf("Unexpected symbols %v", symbols)
+	}
+
+	// A syntax error is published, and navigation keeps the last version
+	// that parsed
+	broken := strings.Replace(lspSource, "result := total", "result := := total", 1)
+	send(map[string]interface{}{"method": "textDocument/didChange", "params": map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []interface{}{map[string]interface{}{"text": broken}},
+	}})
+	errors := diagnostics()
+	if len(errors) == 0 {
+		t.Fatal("Expected a syntax error")
+	}
+	if e := errors[0].(map[string]interface{}); e["severity"] != float64(1) || e["code"] != CodeSyntax ||
+		e["range"].(map[string]interface{})["start"].(map[string]interface{})["line"] != float64(5) {
+		t.Errorf("Unexpected diagnostic %v", e)
+	}
+	if request("textDocument/definition", position(7, "double")) == nil {
+		t.Error("Expected the definition from the last version that parsed")
+	}
+
+	request("shutdown", nil)
+	send(map[string]interface{}{"method": "exit"})
+	if err := <-served; err != nil {
+		t.Errorf("Serve failed: %v", err)
+	}
+}
+
+// TestIntegrationFormatYul tests the canonical layout FormatYul writes
+func TestIntegrationFormatYul(t *testing.T) {
+	source := `// Counter
+object "Counter" {  // the contract
+  code {
+      /* the total
+         so far */
+      let total:=sload(0)  // cached
+
+
+    switch total case 0 { sstore(0,1) } case 1 {
+        // only once
+        sstore(0, 2)
+    }
+    default { }
+    for { let i := 0 } lt(i, 3) { i := add(i, 1) } { sstore(i, "a // b") }
+    function f(a, b) -> r {
+      r := a
+      // end of f
+    }
+  }
+  data "meta" hex"0102" // metadata
+  object "runtime" { code { sstore(0, 0) } }
+}
+`
+	want := `// Counter
+object "Counter" {
+    // the contract
+    code {
+        /* the total
+         so far */
+        let total := sload(0) // cached
+
+        switch total
+        case 0 {
+            sstore(0, 1)
+        }
+        case 1 {
+            // only once
+            sstore(0, 2)
+        }
+        default { }
+        for { let i := 0 } lt(i, 3) { i := add(i, 1) } {
+            sstore(i, "a // b")
+        }
+        function f(a, b) -> r {
+            r := a
+            // end of f
+        }
+    }
+    data "meta" hex"0102" // metadata
+    object "runtime" {
+        code {
+            sstore(0, 0)
+        }
+    }
+}
+`
+	got, err := FormatYul(source)
+	if err != nil {
+		t.Fatalf("FormatYul failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("Unexpected layout at %s", goldenDifference([]byte(got), []byte(want)))
+	}
+
+	// Nested blocks keep their statements, and a bare code block stays one
+	for source, want := range map[string]string{
+		"object \"a\" { code { let x := 1 { sstore(0, x) } } }": "object \"a\" {\n    code {\n        let x := 1\n        {\n            sstore(0, x)\n        }\n    }\n}\n",
+		"{ let x := 1 // one\n { } }":                              "{\n    let x := 1 // one\n    { }\n}\n",
+	} {
+		if got, err := FormatYul(source); err != nil || got != want {
+			t.Errorf("Expected %q to format as %q, got %q (%v)", source, want, got, err)
+		}
+	}
+	if _, err := FormatYul("object \"a\" { code { let x := } }"); err == nil {
+		t.Error("Expected a syntax error")
+	}
+}
+
+// TestIntegrationFormatYulIdempotent tests that formatted source formats
+// to itself and means what the source does
+func TestIntegrationFormatYulIdempotent(t *testing.T) {
+	paths, _ := filepath.Glob("../examples/*/*.yul")
+	golden, _ := filepath.Glob(filepath.Join(goldenDir, "*.yul"))
+	sources := make(map[string]string)
+	for _, path := range append(paths, golden...) {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources[path] = string(source)
+	}
+	for seed := int64(1); seed <= 20; seed++ {
+		sources[fmt.Sprintf("generated %d", seed)] = NewYulProgramGenerator(seed).Program()
+	}
+	if len(sources) == 20 {
+		t.Fatal("No example sources found")
+	}
+
+	for name, source := range sources {
+		formatted, err := FormatYul(source)
+		if err != nil {
+			t.Errorf("%s: FormatYul failed: %v", name, err)
+			continue
+		}
+		again, err := FormatYul(formatted)
+		if err != nil || again != formatted {
+			t.Errorf("%s: formatting is not idempotent (%v), %s", name, err, goldenDifference([]byte(again), []byte(formatted)))
+		}
+		original, _ := NewYulParser().Parse(source)
+		reformatted, _ := NewYulParser().Parse(formatted)
+		if PrintYul(original) != PrintYul(reformatted) {
+			t.Errorf("%s: formatting changed the program", name)
+		}
+		if strings.Count(source, "//") > strings.Count(formatted, "//") {
+			t.Errorf("%s: formatting dropped comments", name)
+		}
+	}
+}
+
+// TestIntegrationFmtCommand tests listing and rewriting unformatted files
+func TestIntegrationFmtCommand(t *testing.T) {
+	dir := t.TempDir()
+	messy := filepath.Join(dir, "messy.yul")
+	tidy := filepath.Join(dir, "tidy.yul")
+	os.WriteFile(messy, []byte("object \"a\" { code { sstore(0,1) } }"), 0644)
+	os.WriteFile(tidy, []byte("object \"a\" {\n    code {\n        sstore(0, 1)\n    }\n}\n"), 0644)
+
+	var stdout, stderr bytes.Buffer
+	if code := RunFmtCommand([]string{"-l", messy, tidy}, nil, &stdout, &stderr); code != 1 || stdout.String() != messy+"\n" {
+		t.Errorf("Expected only %s listed, got %d %q %q", messy, code, stdout.String(), stderr.String())
+	}
+	stdout.Reset()
+	if code := RunFmtCommand([]string{"-w", messy}, nil, &stdout, &stderr); code != 0 || stdout.Len() != 0 {
+		t.Errorf("Expected a silent rewrite, got %d %q", code, stdout.String())
+	}
+	if rewritten, _ := os.ReadFile(messy); string(rewritten) != "object \"a\" {\n    code {\n        sstore(0, 1)\n    }\n}\n" {
+		t.Errorf("Unexpected rewrite %q", rewritten)
+	}
+	if code := RunFmtCommand([]string{"-l", messy, tidy}, nil, &stdout, &stderr); code != 0 || stdout.Len() != 0 {
+		t.Errorf("Expected nothing to list, got %d %q", code, stdout.String())
+	}
+	if code := RunFmtCommand(nil, strings.NewReader("{ sstore(0, 1) "), &stdout, &stderr); code != 1 {
+		t.Errorf("Expected a syntax error on standard input, got %d", code)
+	}
+}
+
+// TestIntegrationWallet tests keys in WIF and NEP-6 wallets
+func TestIntegrationWallet(t *testing.T) {
+	account, err := ParseWIF("L1QqQJnpBwbsPGAuutuzPTac8piqvbR1HRjrY5qHup48TBCBFe4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := hex.EncodeToString(account.PublicKey()); key != "02028a99826edc0c97d18e22b6932373d908d323aa7f92656a77ec26e8861699ef" {
+		t.Errorf("Unexpected public key %s", key)
+	}
+	if address := account.Address(); address != "NPTmAHDxo6Pkyic8Nvu3kwyXoYJCvcCB6i" {
+		t.Errorf("Unexpected address %s", address)
+	}
+	if hash, err := ParseAddress(account.Address()); err != nil || hash != account.ScriptHash() {
+		t.Errorf("Address did not round trip: %v %v", hash, err)
+	}
+	if _, err := ParseWIF("L1QqQJnpBwbsPGAuutuzPTac8piqvbR1HRjrY5qHup48TBCBFe4h"); err == nil {
+		t.Error("Expected a checksum error")
+	}
+
+	// RFC 7914 test vector
+	key, err := scryptKey([]byte("password"), []byte("NaCl"), 1024, 8, 16, 64)
+	if err != nil || hex.EncodeToString(key) != "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640" {
+		t.Errorf("Unexpected scrypt key %x %v", key, err)
+	}
+
+	other, _ := NewAccount(bytes.Repeat([]byte{7}, 32))
+	params := ScryptParams{N: 16, R: 1, P: 1}
+	wallet := NEP6Wallet{Name: "test", Version: "1.0", Scrypt: params, Accounts: []NEP6Account{
+		{Address: other.Address(), Key: encryptNEP2(t, other, "other", params)},
+		{Address: account.Address(), Key: encryptNEP2(t, account, "secret", params), IsDefault: true},
+	}}
+	data, _ := json.Marshal(wallet)
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	os.WriteFile(path, data, 0600)
+	loaded, err := LoadNEP6Wallet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, err := loaded.Account("", "secret"); err != nil || decrypted.WIF() != account.WIF() {
+		t.Errorf("Expected the default account, got %v", err)
+	}
+	if _, err := loaded.Account(account.Address(), "wrong"); err == nil || !strings.Contains(err.Error(), "wrong password") {
+		t.Errorf("Expected a wrong password, got %v", err)
+	}
+	if decrypted, err := loaded.Account(other.Address(), "other"); err != nil || decrypted.Address() != other.Address() {
+		t.Errorf("Expected the other account, got %v", err)
+	}
+	if _, err := loaded.Account(AddressOf(Uint160{}), "secret"); err == nil {
+		t.Error("Expected a missing account")
+	}
+}
+
+// encryptNEP2 encrypts the key of account with password
+func encryptNEP2(t *testing.T, account *Account, password string, params ScryptParams) string {
+	check := sha256.Sum256([]byte(account.Address()))
+	check = sha256.Sum256(check[:])
+	derived, err := scryptKey([]byte(password), check[:4], params.N, params.R, params.P, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(derived[32:])
+	d := account.Key.D.FillBytes(make([]byte, 32))
+	for i := range d {
+		d[i] ^= derived[i]
+	}
+	data := append([]byte{0x01, 0x42, 0xE0}, check[:4]...)
+	encrypted := make([]byte, 32)
+	block.Encrypt(encrypted[:16], d[:16])
+	block.Encrypt(encrypted[16:], d[16:])
+	return base58CheckEncode(append(data, encrypted...))
+}
+
+// fakeNode serves the RPC methods deploying a contract, checking the
+// transaction it is sent
+type fakeNode struct {
+	t        *testing.T
+	account  *Account
+	network  uint32
+	pending  int // getapplicationlog calls failing before the log is found
+	raw      []byte
+	contract Uint160
+	fault    string
+	manifest *ContractManifest        // Of getcontractstate
+	nef      interface{}              // Of getcontractstate
+	stack    []interface{}            // Results of executions
+	params   []map[string]interface{} // Of the last invokefunction
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ID     int               `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	var result interface{}
+	var failure *RPCError
+	param := func(i int) []byte {
+		var text string
+		json.Unmarshal(request.Params[i], &text)
+		data, _ := base64.StdEncoding.DecodeString(text)
+		return data
+	}
+	switch request.Method {
+	case "getversion":
+		result = map[string]interface{}{"protocol": map[string]interface{}{"addressversion": 53, "network": n.network, "maxvaliduntilblockincrement": 100}}
+	case "getblockcount":
+		result = 1000
+	case "invokescript":
+		var signers []map[string]string
+		json.Unmarshal(request.Params[1], &signers)
+		if len(signers) != 1 || signers[0]["account"] != n.account.ScriptHash().String() || signers[0]["scopes"] != "CalledByEntry" {
+			n.t.Errorf("Unexpected signers %v", signers)
+		}
+		result = map[string]interface{}{"state": "HALT", "gasconsumed": "1000012345", "stack": []interface{}{}}
+	case "getcontractstate":
+		if n.manifest == nil {
+			failure = &RPCError{Code: -100, Message: "Unknown contract"}
+			break
+		}
+		result = map[string]interface{}{"id": 1, "hash": n.contract.String(), "nef": n.nef, "manifest": n.manifest}
+	case "invokefunction":
+		json.Unmarshal(request.Params[2], &n.params)
+		result = map[string]interface{}{"state": "HALT", "gasconsumed": "2048", "stack": n.stack}
+	case "calculatenetworkfee":
+		result = map[string]string{"networkfee": "1234567"}
+	case "sendrawtransaction":
+		n.raw = param(0)
+		// Unsigned part, one witness: invocation PUSHDATA1 64, verification
+		unsigned := n.raw[:len(n.raw)-1-67-41]
+		signature := n.raw[len(n.raw)-41-64 : len(n.raw)-41]
+		digest := sha256.Sum256(unsigned)
+		data := sha256.Sum256(append(binary.LittleEndian.AppendUint32(nil, n.network), digest[:]...))
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(&n.account.Key.PublicKey, data[:], r, s) {
+			n.t.Error("Invalid signature")
+		}
+		if !bytes.Equal(n.raw[len(n.raw)-40:], n.account.VerificationScript()) {
+			n.t.Error("Unexpected verification script")
+		}
+		reverseBytes(digest[:])
+		result = map[string]string{"hash": fmt.Sprintf("0x%x", digest)}
+	case "getapplicationlog":
+		if n.pending > 0 {
+			n.pending--
+			failure = &RPCError{Code: -100, Message: "Unknown transaction"}
+			break
+		}
+		state, exception := "HALT", ""
+		if n.fault != "" {
+			state, exception = "FAULT", n.fault
+		}
+		hash := base64.StdEncoding.EncodeToString(scriptOrder(n.contract))
+		result = map[string]interface{}{"executions": []interface{}{map[string]interface{}{
+			"trigger": "Application", "vmstate": state, "exception": exception, "gasconsumed": "1000012345", "stack": n.stack,
+			"notifications": []interface{}{map[string]interface{}{
+				"contract": ContractManagementHash, "eventname": "Deploy",
+				"state": map[string]interface{}{"type": "Array", "value": []interface{}{map[string]string{"type": "ByteString", "value": hash}}},
+			}},
+		}}}
+	default:
+		failure = &RPCError{Code: -32601, Message: "Method not found"}
+	}
+	reply := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "result": result}
+	if failure != nil {
+		reply = map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "error": failure}
+	}
+	json.NewEncoder(w).Encode(reply)
+}
+
+// TestIntegrationDeploy tests deploying artifacts through a node
+func TestIntegrationDeploy(t *testing.T) {
+	result, err := NewYulToNeoCompiler(CompilerConfig{ExportFunctions: []string{"get"}}).Compile(
+		`object "Stored" { code { function get() -> v { v := sload(0) } } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if _, err := WriteArtifacts(dir, "stored.yul", result); err != nil {
+		t.Fatal(err)
+	}
+	nef, _ := os.ReadFile(filepath.Join(dir, "stored.nef"))
+	manifest, _ := os.ReadFile(filepath.Join(dir, "stored.manifest.json"))
+	file, _ := DecodeNEF(nef)
+	var named struct{ Name string }
+	json.Unmarshal(manifest, &named)
+
+	account, _ := ParseWIF("L1QqQJnpBwbsPGAuutuzPTac8piqvbR1HRjrY5qHup48TBCBFe4g")
+	node := &fakeNode{t: t, account: account, network: 894710606, pending: 2}
+	node.contract = ContractHash(account.ScriptHash(), file.Checksum, named.Name)
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	deployed, err := NewRPCClient(server.URL).Deploy(account, nef, manifest, TransactOptions{PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployed.Contract != node.contract || deployed.SystemFee != 1000012345 || deployed.NetworkFee != 1234567 {
+		t.Errorf("Unexpected deployment %+v", deployed)
+	}
+	if deployed.SystemFee.String() != "10.00012345 GAS" {
+		t.Errorf("Unexpected fee %s", deployed.SystemFee)
+	}
+	script, _ := DeployScript(nef, manifest)
+	if !bytes.Contains(node.raw, script) || binary.LittleEndian.Uint32(node.raw[21:]) != 1099 {
+		t.Error("Expected the deploy script, valid until block 1099")
+	}
+	instructions, err := DisassembleScript(script)
+	if err != nil || len(instructions) != 8 || string(instructions[5].Operand) != "deploy" || string(instructions[7].Operand) != "System.Contract.Call" {
+		t.Errorf("Unexpected deploy script %v %v", instructions, err)
+	}
+
+	// The command reads the manifest next to the NEF
+	var stdout, stderr bytes.Buffer
+	code := RunDeployCommand([]string{"-rpc", server.URL, "-wif", account.WIF(), filepath.Join(dir, "stored.nef")}, &stdout, &stderr)
+	if code != 0 || !strings.Contains(stdout.String(), "Contract:    "+node.contract.String()) {
+		t.Errorf("Unexpected deploy output %d %q %q", code, stdout.String(), stderr.String())
+	}
+
+	node.fault = "contract already exists"
+	stdout.Reset()
+	code = RunDeployCommand([]string{"-rpc", server.URL, "-wif", account.WIF(), filepath.Join(dir, "stored.nef")}, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stdout.String(), "Transaction: 0x") || !strings.Contains(stderr.String(), "contract already exists") {
+		t.Errorf("Expected the faulting transaction reported, got %d %q %q", code, stdout.String(), stderr.String())
+	}
+	if code := RunDeployCommand([]string{"-wif", account.WIF(), "stored.nef"}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected a usage error without -rpc, got %d", code)
+	}
+}
+
+// TestIntegrationPushIntegerScript tests integers pushed as nodes push them
+func TestIntegrationPushIntegerScript(t *testing.T) {
+	for _, test := range []struct {
+		value  int64
+		script string
+	}{
+		{-1, "0f"}, {0, "10"}, {16, "20"}, {17, "0011"}, {-2, "00fe"},
+		{255, "01ff00"}, {-129, "017fff"}, {0xFFFFFFFF, "03ffffffff00000000"}, {1 << 40, "030000000000010000"},
+	} {
+		if script := hex.EncodeToString(pushIntegerScript(big.NewInt(test.value))); script != test.script {
+			t.Errorf("%d: expected %s, got %s", test.value, test.script, script)
+		}
+	}
+}
+
+// TestIntegrationContractParameters tests converting command line arguments
+// to ABI types
+func TestIntegrationContractParameters(t *testing.T) {
+	account, _ := ParseWIF("L1QqQJnpBwbsPGAuutuzPTac8piqvbR1HRjrY5qHup48TBCBFe4g")
+	hash := account.ScriptHash().String()
+	for _, test := range []struct {
+		kind, text, json string
+	}{
+		{"Boolean", "true", `{"type":"Boolean","value":true}`},
+		{"Boolean", "false", `{"type":"Boolean","value":false}`},
+		{"Integer", "-42", `{"type":"Integer","value":"-42"}`},
+		{"Integer", "0x10", `{"type":"Integer","value":"16"}`},
+		{"String", "", `{"type":"String","value":""}`},
+		{"ByteArray", "0x0102", `{"type":"ByteArray","value":"AQI="}`},
+		{"Hash160", account.Address(), `{"type":"Hash160","value":"` + hash + `"}`},
+		{"Hash160", hash, `{"type":"Hash160","value":"` + hash + `"}`},
+		{"PublicKey", hex.EncodeToString(account.PublicKey()), `{"type":"PublicKey","value":"` + hex.EncodeToString(account.PublicKey()) + `"}`},
+		{"Any", "null", `{"type":"Any"}`},
+		{"Any", "7", `{"type":"Integer","value":"7"}`},
+		{"Any", "Integer:0x10", `{"type":"Integer","value":"16"}`},
+		{"Any", account.Address(), `{"type":"Hash160","value":"` + hash + `"}`},
+		{"Any", "0xff", `{"type":"ByteArray","value":"/w=="}`},
+		{"Any", "hello", `{"type":"String","value":"hello"}`},
+		{"Array", `[1, "two", null, [true]]`, `{"type":"Array","value":[{"type":"Integer","value":"1"},{"type":"String","value":"two"},{"type":"Any"},{"type":"Array","value":[{"type":"Boolean","value":true}]}]}`},
+	} {
+		p, err := ParseContractParameter(test.kind, test.text)
+		if err != nil {
+			t.Errorf("%s %q: %v", test.kind, test.text, err)
+			continue
+		}
+		if data, _ := json.Marshal(p); string(data) != test.json {
+			t.Errorf("%s %q: expected %s, got %s", test.kind, test.text, test.json, data)
+		}
+	}
+	for _, test := range []struct{ kind, text string }{
+		{"Integer", "ten"}, {"Boolean", "yes"}, {"Hash160", "0x12"}, {"PublicKey", "04" + strings.Repeat("00", 32)},
+		{"Signature", "0x00"}, {"Array", "{}"}, {"Map", "{}"},
+	} {
+		if _, err := ParseContractParameter(test.kind, test.text); err == nil {
+			t.Errorf("%s %q: expected an error", test.kind, test.text)
+		}
+	}
+
+	p, _ := ParseContractParameter("Hash160", account.Address())
+	if item, ok := p.StackItem().(*NeoVMByteString); !ok || !bytes.Equal(item.Value, scriptOrder(account.ScriptHash())) {
+		t.Errorf("Expected the script-order hash, got %v", p.StackItem())
+	}
+	script, err := ContractCallScript(account.ScriptHash(), "transfer", []NeoVMStackItem{CreateNeoVMInteger(300), NeoVMNull{}, CreateNeoVMArray(nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Arguments in reverse: [] as PUSH0 PACK, PUSHNULL, PUSHINT16 300, then PUSH3 PACK
+	if want := "10c00b012c0113c01f0c087472616e736665720c14"; !strings.HasPrefix(hex.EncodeToString(script), want) {
+		t.Errorf("Unexpected call script %x", script)
+	}
+}
+
+// TestIntegrationStackItemResults tests decoding and formatting RPC stack
+// items
+func TestIntegrationStackItemResults(t *testing.T) {
+	var items []RPCStackItem
+	json.Unmarshal([]byte(`[
+		{"type":"Integer","value":"-5"},
+		{"type":"ByteString","value":"aGVsbG8="},
+		{"type":"ByteString","value":"AAEC"},
+		{"type":"Array","value":[{"type":"Boolean","value":true},{"type":"Any"}]},
+		{"type":"Map","value":[{"key":{"type":"ByteString","value":"YQ=="},"value":{"type":"Integer","value":"1"}}]},
+		{"type":"InteropInterface","interface":"IIterator","id":"x"}
+	]`), &items)
+	want := []string{`-5`, `"hello"`, `0x000102`, `[true, null]`, `{"a": 1}`, `InteropInterface IIterator`}
+	for i, item := range items {
+		decoded, err := DecodeRPCStackItem(item)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if text := FormatStackItem(decoded, "Any"); text != want[i] {
+			t.Errorf("%d: expected %s, got %s", i, want[i], text)
+		}
+	}
+	account, _ := ParseWIF("L1QqQJnpBwbsPGAuutuzPTac8piqvbR1HRjrY5qHup48TBCBFe4g")
+	hash := CreateNeoVMByteString(scriptOrder(account.ScriptHash()))
+	for _, test := range []struct {
+		item NeoVMStackItem
+		kind string
+		want string
+	}{
+		{hash, "Hash160", account.ScriptHash().String()},
+		{CreateNeoVMByteString([]byte{0x2c, 0x01}), "Integer", "300"},
+		{CreateNeoVMInteger(0), "Boolean", "false"},
+		{CreateNeoVMByteString("text"), "String", "text"},
+		{CreateNeoVMByteString("text"), "ByteArray", "0x74657874"},
+		{CreateNeoVMArray(nil), "Integer", "[]"},
+	} {
+		if text := FormatStackItem(test.item, test.kind); text != test.want {
+			t.Errorf("%s: expected %s, got %s", test.kind, test.want, text)
+		}
+	}
+	if _, err := DecodeRPCStackItem(RPCStackItem{Type: "Integer", Value: json.RawMessage(`"x"`)}); err == nil {
+		t.Error("Expected an invalid integer")
+	}
+}
+
+// TestIntegrationInvokeCommand tests invoking contract methods through a
+// node
+func TestIntegrationInvokeCommand(t *testing.T) {
+	account, _ := ParseWIF("L1QqQJnpBwbsPGAuutuzPTac8piqvbR1HRjrY5qHup48TBCBFe4g")
+	node := &fakeNode{t: t, account: account, network: 894710606, contract: Uint160{1, 2, 3}}
+	node.manifest = &ContractManifest{Name: "Token", ABI: ManifestABI{Methods: []ABIMethod{
+		{Name: "balanceOf", Parameters: []ABIParameter{{Name: "account", Type: "Hash160"}}, ReturnType: "Integer"},
+		{Name: "transfer", Parameters: []ABIParameter{{Name: "from", Type: "Hash160"}, {Name: "to", Type: "Hash160"}, {Name: "amount", Type: "Integer"}, {Name: "data", Type: "Any"}}, ReturnType: "Boolean"},
+	}}}
+	server := httptest.NewServer(node)
+	defer server.Close()
+	contract := node.contract.String()
+
+	var stdout, stderr bytes.Buffer
+	node.stack = []interface{}{map[string]string{"type": "ByteString", "value": "6AM="}}
+	code := RunInvokeCommand([]string{"-rpc", server.URL, contract, "balanceOf", account.Address()}, &stdout, &stderr)
+	if code != 0 || !strings.Contains(stdout.String(), "Result:      1000\n") || !strings.Contains(stdout.String(), "Gas:         0.00002048 GAS") {
+		t.Errorf("Unexpected test invocation %d %q %q", code, stdout.String(), stderr.String())
+	}
+	if len(node.params) != 1 || node.params[0]["type"] != "Hash160" || node.params[0]["value"] != account.ScriptHash().String() {
+		t.Errorf("Unexpected parameters %v", node.params)
+	}
+
+	stdout.Reset()
+	node.stack = []interface{}{map[string]interface{}{"type": "Boolean", "value": true}}
+	code = RunInvokeCommand([]string{"-rpc", server.URL, "-wif", account.WIF(), "-send", contract, "transfer", account.Address(), contract, "5", "null"}, &stdout, &stderr)
+	if code != 0 || !strings.Contains(stdout.String(), "Transaction: 0x") || !strings.Contains(stdout.String(), "Result:      true\n") {
+		t.Errorf("Unexpected sent invocation %d %q %q", code, stdout.String(), stderr.String())
+	}
+	script, _ := ContractCallScript(node.contract, "transfer", []NeoVMStackItem{
+		CreateNeoVMByteString(scriptOrder(account.ScriptHash())), CreateNeoVMByteString(scriptOrder(node.contract)), CreateNeoVMInteger(5), NeoVMNull{},
+	})
+	if !bytes.Contains(node.raw, script) {
+		t.Error("Expected the transfer script in the transaction")
+	}
+
+	stderr.Reset()
+	if code := RunInvokeCommand([]string{"-rpc", server.URL, contract, "transfer", "1"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "transfer takes 4 arguments, got 1") {
+		t.Errorf("Expected an argument count error, got %d %q", code, stderr.String())
+	}
+	stderr.Reset()
+	if code := RunInvokeCommand([]string{"-rpc", server.URL, contract, "balanceOf", "nobody"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "argument account") {
+		t.Errorf("Expected an argument error, got %d %q", code, stderr.String())
+	}
+	if code := RunInvokeCommand([]string{"-rpc", server.URL, contract}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected a usage error without a method, got %d", code)
+	}
+}
+
+// TestIntegrationVerifyCommand tests verifying sources against a deployed
+// contract
+func TestIntegrationVerifyCommand(t *testing.T) {
+	input := `{
+		"language": "Yul",
+		"sources": {"token.yul": {"content": "object \"Token\" { code {\n function balance(owner) -> amount { amount := sload(owner) }\n sstore(0, calldataload(4))\n } }"}},
+		"settings": {"optimizer": {"enabled": false}, "neo": {"exportFunctions": ["balance"]}}
+	}`
+	compiled, name, err := compileDeclared([]byte(input), "")
+	if err != nil || name != "token.yul:Token" {
+		t.Fatalf("Expected the only contract, got %q: %v", name, err)
+	}
+	data, _ := base64.StdEncoding.DecodeString(compiled.Neo.NEF)
+	file, err := DecodeNEF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deployed by another compiler build under another name, with groups
+	deployed := *compiled.Neo.Manifest
+	deployed.Name = "MyToken"
+	deployed.Groups = []ManifestGroup{{PublicKey: "02028a99826edc0c97d18e22b6932373d908d323aa7f92656a77ec26e8861699ef", Signature: "c2lnbmF0dXJl"}}
+	node := &fakeNode{t: t, contract: Uint160{1, 2, 3}, manifest: &deployed}
+	node.nef = map[string]interface{}{"compiler": "neo-yulc 0.9", "source": "https://example.com", "script": file.Script, "tokens": []interface{}{}, "checksum": 1}
+	server := httptest.NewServer(node)
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "input.json")
+	os.WriteFile(path, []byte(input), 0644)
+
+	var stdout, stderr bytes.Buffer
+	if code := RunVerifyCommand([]string{"-rpc", server.URL, "-input", path, node.contract.String()}, &stdout, &stderr); code != 0 || !strings.Contains(stdout.String(), "Verified") {
+		t.Errorf("Expected the contract to verify, got %d %q %q", code, stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	script := append([]byte{}, file.Script...)
+	script[len(script)-1] ^= 0xff
+	node.nef.(map[string]interface{})["script"] = script
+	deployed.ABI.Methods = deployed.ABI.Methods[:0]
+	code := RunVerifyCommand([]string{"-rpc", server.URL, "-input", path, "-contract", "token.yul:Token", node.contract.String()}, &stdout, &stderr)
+	offset := fmt.Sprintf("first differing at offset %d", len(script)-1)
+	if code != 1 || !strings.Contains(stdout.String(), "Not verified") || !strings.Contains(stdout.String(), offset) || !strings.Contains(stdout.String(), "manifest abi:") {
+		t.Errorf("Expected script and ABI differences, got %d %q %q", code, stdout.String(), stderr.String())
+	}
+
+	stderr.Reset()
+	if code := RunVerifyCommand([]string{"-rpc", server.URL, "-input", path, "-contract", "token.yul:Coin", node.contract.String()}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "no contract token.yul:Coin") {
+		t.Errorf("Expected an unknown contract error, got %d %q", code, stderr.String())
+	}
+	if code := RunVerifyCommand([]string{"-rpc", server.URL, node.contract.String()}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected a usage error without an input, got %d", code)
+	}
+
+	// Method tokens with call flags by name
+	var state ContractState
+	json.Unmarshal([]byte(`{"nef": {"tokens": [{"hash": "0xacce6fd80d44e1796aa0c2c625e9e4e0ce39efc0", "method": "itoa", "paramcount": 1, "hasreturnvalue": true, "callflags": "ReadStates, AllowCall"}]}}`), &state)
+	tokens, err := state.NEFFile()
+	if err != nil || len(tokens.Tokens) != 1 || tokens.Tokens[0].CallFlags != 5 || tokens.Tokens[0].Hash[0] != 0xc0 {
+		t.Errorf("Unexpected method tokens %+v: %v", tokens, err)
+	}
+}
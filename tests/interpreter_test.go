@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// TestTimeTravelDebugger tests forward and reverse stepping over a recorded run
+func TestTimeTravelDebugger(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			let x := 1
+			sstore(0, x)
+			x := double(x)
+			sstore(0, x)
+			function double(a) -> r { r := mul(a, 2) }
+		}
+	}`
+
+	parser := NewYulParser()
+	ast, err := parser.Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	interp := NewYulInterpreter(nil)
+	interp.Journal = NewExecutionJournal()
+	if err := interp.ExecuteBlock(ast.Objects[0].Code); err != nil {
+		t.Fatalf("Execution failed: %v", err)
+	}
+
+	debugger := NewTimeTravelDebugger(interp.Journal)
+	for debugger.StepForward() {
+	}
+	if value := debugger.Storage(big.NewInt(0)); value.Int64() != 2 {
+		t.Errorf("Expected final slot 0 to be 2, got %s", value)
+	}
+
+	// Step back to just after the first store
+	first := debugger.FindStorageWrite(big.NewInt(0))
+	if first < 0 {
+		t.Fatalf("Expected a write to slot 0")
+	}
+	debugger.Seek(first + 1)
+	if value := debugger.Storage(big.NewInt(0)); value.Int64() != 1 {
+		t.Errorf("Expected slot 0 to be 1 after the first store, got %s", value)
+	}
+	if x, ok := debugger.Lookup("x"); !ok || x.Int64() != 1 {
+		t.Errorf("Expected x to be 1 after the first store, got %v", x)
+	}
+
+	// Stepping into double enters a new frame
+	debugger.StepForward()
+	if debugger.CallDepth() != 2 {
+		t.Errorf("Expected to be inside double, call depth %d", debugger.CallDepth())
+	}
+	for debugger.StepBackward() {
+	}
+	if _, ok := debugger.Lookup("x"); ok || len(debugger.StorageKeys()) != 0 {
+		t.Errorf("Expected initial state after rewinding")
+	}
+}
+
+// TestInterpreterSandboxLimits tests that each Neo runtime limit stops execution
+func TestInterpreterSandboxLimits(t *testing.T) {
+	run := func(code string, limits *SandboxLimits) (*YulInterpreter, error) {
+		parser := NewYulParser()
+		ast, err := parser.Parse(`object "Test" { code { ` + code + ` } }`)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		interp := NewYulInterpreter(nil)
+		interp.Limits = limits
+		return interp, interp.ExecuteBlock(ast.Objects[0].Code)
+	}
+
+	tests := []struct {
+		name   string
+		code   string
+		limits *SandboxLimits
+		limit  LimitKind
+	}{
+		{"fuel", `for {} 1 {} { }`, &SandboxLimits{Fuel: 1000}, LimitFuel},
+		{"storage writes", `for { let i := 0 } lt(i, 10) { i := add(i, 1) } { sstore(i, i) }`,
+			&SandboxLimits{MaxStorageWrites: 5}, LimitStorageWrites},
+		{"notification count", `for { let i := 0 } lt(i, 600) { i := add(i, 1) } { log1(0, 0, i) }`,
+			NeoSandboxLimits(), LimitNotifications},
+		{"notification size", `log0(0, 2048)`, NeoSandboxLimits(), LimitNotificationSize},
+		{"item size", `mstore(1048576, 1)`, NeoSandboxLimits(), LimitItemSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := run(tt.code, tt.limits)
+			if !errors.Is(err, ErrSandboxLimitExceeded) {
+				t.Fatalf("Expected a sandbox limit error, got %v", err)
+			}
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+				t.Errorf("Expected %s limit, got %v", tt.limit, err)
+			}
+		})
+	}
+
+	// Execution within the limits succeeds and keeps its effects
+	interp, err := run(`mstore(0, 42) log2(0, 32, 1, 2) sstore(0, mload(0))`, NeoSandboxLimits())
+	if err != nil {
+		t.Fatalf("Execution failed: %v", err)
+	}
+	if len(interp.Notifications) != 1 || len(interp.Notifications[0].Topics) != 2 {
+		t.Fatalf("Expected one notification with two topics, got %v", interp.Notifications)
+	}
+	if data := new(big.Int).SetBytes(interp.Notifications[0].Data); data.Int64() != 42 {
+		t.Errorf("Expected notification data 42, got %s", data)
+	}
+	if value := interp.loadWord(big.NewInt(0)); value.Int64() != 42 {
+		t.Errorf("Expected slot 0 to be 42, got %s", value)
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"errors"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 // TestYulLexerBasicTokenization tests basic token recognition
@@ -492,6 +495,72 @@ func TestYulLexerPositioning(t *testing.T) {
 	}
 }
 
+// TestYulLexerMultiLinePositions tests positions of tokens that span or follow line breaks
+func TestYulLexerMultiLinePositions(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected []TokenPosition
+	}{
+		{
+			name:   "multiline string",
+			source: "let s := \"ab\ncd\" x",
+			expected: []TokenPosition{
+				{Line: 1, Column: 1, EndLine: 1, EndColumn: 4, Offset: 0, Length: 3},
+				{Line: 1, Column: 5, EndLine: 1, EndColumn: 6, Offset: 4, Length: 1},
+				{Line: 1, Column: 7, EndLine: 1, EndColumn: 9, Offset: 6, Length: 2},
+				{Line: 1, Column: 10, EndLine: 2, EndColumn: 4, Offset: 9, Length: 7},
+				{Line: 2, Column: 5, EndLine: 2, EndColumn: 6, Offset: 17, Length: 1},
+				{Line: 2, Column: 6, EndLine: 2, EndColumn: 6, Offset: 18, Length: 0},
+			},
+		},
+		{
+			name:   "nested multiline comment",
+			source: "a /* x\n/* y\n*/ z */ b",
+			expected: []TokenPosition{
+				{Line: 1, Column: 1, EndLine: 1, EndColumn: 2, Offset: 0, Length: 1},
+				{Line: 3, Column: 9, EndLine: 3, EndColumn: 10, Offset: 20, Length: 1},
+				{Line: 3, Column: 10, EndLine: 3, EndColumn: 10, Offset: 21, Length: 0},
+			},
+		},
+		{
+			name:   "token after blank lines",
+			source: "\n\n  foo",
+			expected: []TokenPosition{
+				{Line: 3, Column: 3, EndLine: 3, EndColumn: 6, Offset: 4, Length: 3},
+				{Line: 3, Column: 6, EndLine: 3, EndColumn: 6, Offset: 7, Length: 0},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lexer := NewYulLexer()
+			if err := lexer.Init(test.source); err != nil {
+				t.Fatalf("Failed to initialize lexer: %v", err)
+			}
+
+			tokens, err := lexer.ScanTokens()
+			if err != nil {
+				t.Fatalf("Failed to scan tokens: %v", err)
+			}
+
+			if len(tokens) != len(test.expected) {
+				t.Fatalf("Expected %d tokens, got %d", len(test.expected), len(tokens))
+			}
+
+			for i, token := range tokens {
+				if token.Position != test.expected[i] {
+					t.Errorf("Token %d (%q): expected %+v, got %+v", i, token.Lexeme, test.expected[i], token.Position)
+				}
+				if token.Line != token.Position.Line || token.Column != token.Position.Column {
+					t.Errorf("Token %d: Line/Column %d:%d disagree with Position", i, token.Line, token.Column)
+				}
+			}
+		})
+	}
+}
+
 // TestYulLexerErrorHandling tests various error conditions
 func TestYulLexerErrorHandling(t *testing.T) {
 	tests := []struct {
@@ -807,36 +876,38 @@ func TestYulLexerValidation(t *testing.T) {
 	}
 }
 
-// BenchmarkYulLexer benchmarks lexer performance
-func BenchmarkYulLexer(b *testing.B) {
-	// Large Yul program for benchmarking
-	source := strings.Repeat(`
-	object "Contract" {
+// lexerBenchmarkSource is a large Yul program for benchmarking
+var lexerBenchmarkSource = strings.Repeat(`
+object "Contract" {
+	code {
+		datacopy(0, dataoffset("runtime"), datasize("runtime"))
+		return(0, datasize("runtime"))
+	}
+	object "runtime" {
 		code {
-			datacopy(0, dataoffset("runtime"), datasize("runtime"))
-			return(0, datasize("runtime"))
-		}
-		object "runtime" {
-			code {
-				let selector := div(calldataload(0), 0x100000000000000000000000000000000000000000000000000000000)
-				
-				switch selector
-				case 0x60fe47b1 {
-					let value := calldataload(4)
-					sstore(0, value)
-				}
-				case 0x6d4ce63c {
-					let value := sload(0)
-					mstore(0, value)
-					return(0, 32)
-				}
-				default {
-					revert(0, 0)
-				}
+			let selector := div(calldataload(0), 0x100000000000000000000000000000000000000000000000000000000)
+			
+			switch selector
+			case 0x60fe47b1 {
+				let value := calldataload(4)
+				sstore(0, value)
+			}
+			case 0x6d4ce63c {
+				let value := sload(0)
+				mstore(0, value)
+				return(0, 32)
+			}
+			default {
+				revert(0, 0)
 			}
 		}
 	}
-	`, 10) // Repeat 10 times for a larger program
+}
+`, 10) // Repeat 10 times for a larger program
+
+// BenchmarkYulLexer benchmarks lexer performance
+func BenchmarkYulLexer(b *testing.B) {
+	source := lexerBenchmarkSource
 
 	b.ResetTimer()
 
@@ -854,6 +925,217 @@ func BenchmarkYulLexer(b *testing.B) {
 	}
 }
 
+// BenchmarkYulLexerStreaming benchmarks lexing the same program from a reader
+func BenchmarkYulLexerStreaming(b *testing.B) {
+	source := lexerBenchmarkSource
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		lexer := NewYulLexer()
+		if err := lexer.InitReader(strings.NewReader(source)); err != nil {
+			b.Fatalf("Failed to initialize lexer: %v", err)
+		}
+
+		for {
+			token, err := lexer.Next()
+			if err != nil {
+				b.Fatalf("Failed to scan tokens: %v", err)
+			}
+			if token.Type == TokenEOF {
+				break
+			}
+		}
+	}
+}
+
+// TestYulLexerEscapesAndUnicode tests escape sequences, hex strings and
+// Unicode identifiers
+func TestYulLexerEscapesAndUnicode(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		tokens []Token // Type, Lexeme, Line and Column of each token before EOF
+		err    string
+	}{
+		{
+			name:   "escapes",
+			source: `"a\nb\tc\r\\\"\'"`,
+			tokens: []Token{{Type: TokenString, Lexeme: "a\nb\tc\r\\\"'", Line: 1, Column: 1}},
+		},
+		{
+			name:   "byte and code point escapes",
+			source: `"\x41\xff\u00e9\u20AC"`,
+			tokens: []Token{{Type: TokenString, Lexeme: "A\xffé€", Line: 1, Column: 1}},
+		},
+		{
+			name:   "line continuation",
+			source: "\"ab\\\ncd\" x",
+			tokens: []Token{{Type: TokenString, Lexeme: "abcd", Line: 1, Column: 1}, {Type: TokenIdentifier, Lexeme: "x", Line: 2, Column: 5}},
+		},
+		{
+			name:   "empty string",
+			source: `""`,
+			tokens: []Token{{Type: TokenString, Lexeme: "", Line: 1, Column: 1}},
+		},
+		{
+			name:   "hex strings",
+			source: `hex"00ff" hex'DEAD_beef' hex""`,
+			tokens: []Token{
+				{Type: TokenHexString, Lexeme: "00ff", Line: 1, Column: 1},
+				{Type: TokenHexString, Lexeme: "DEADbeef", Line: 1, Column: 11},
+				{Type: TokenHexString, Lexeme: "", Line: 1, Column: 26},
+			},
+		},
+		{
+			name:   "hex is still an identifier",
+			source: `hex hex_value`,
+			tokens: []Token{{Type: TokenIdentifier, Lexeme: "hex", Line: 1, Column: 1}, {Type: TokenIdentifier, Lexeme: "hex_value", Line: 1, Column: 5}},
+		},
+		{
+			name:   "columns count characters",
+			source: `"héllo €" x`,
+			tokens: []Token{{Type: TokenString, Lexeme: "héllo €", Line: 1, Column: 1}, {Type: TokenIdentifier, Lexeme: "x", Line: 1, Column: 11}},
+		},
+		{
+			name:   "unicode identifiers",
+			source: `let größe := 1 ä2 := größe`,
+			tokens: []Token{
+				{Type: TokenLet, Lexeme: "let", Line: 1, Column: 1},
+				{Type: TokenIdentifier, Lexeme: "größe", Line: 1, Column: 5},
+				{Type: TokenColonEqual, Lexeme: ":=", Line: 1, Column: 11},
+				{Type: TokenNumber, Lexeme: "1", Line: 1, Column: 14},
+				{Type: TokenIdentifier, Lexeme: "ä2", Line: 1, Column: 16},
+				{Type: TokenColonEqual, Lexeme: ":=", Line: 1, Column: 19},
+				{Type: TokenIdentifier, Lexeme: "größe", Line: 1, Column: 22},
+			},
+		},
+		{name: "unknown escape", source: `"a\q"`, err: "invalid escape sequence '\\q' at line 1, column 3"},
+		{name: "short byte escape", source: `"\x4"`, err: "expected 2 hex digits"},
+		{name: "unterminated escape", source: `"abc\`, err: "unterminated string"},
+		{name: "odd hex string", source: `hex"abc"`, err: "odd number of digits"},
+		{name: "invalid hex digit", source: `hex"0g"`, err: "invalid character 'g' in hex string at line 1, column 6"},
+		{name: "misplaced underscore", source: `hex"0_0"`, err: "invalid character '_'"},
+		{name: "non-letter character", source: `let € := 1`, err: "unexpected character '€' at line 1, column 5"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lexer := NewYulLexer()
+			if err := lexer.Init(test.source); err != nil {
+				t.Fatalf("Failed to initialize lexer: %v", err)
+			}
+			tokens, err := lexer.ScanTokens()
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(tokens) != len(test.tokens)+1 {
+				t.Fatalf("Expected %d tokens, got %s", len(test.tokens)+1, PrettyPrintTokens(tokens))
+			}
+			for i, want := range test.tokens {
+				got := tokens[i]
+				if got.Type != want.Type || got.Lexeme != want.Lexeme || got.Line != want.Line || got.Column != want.Column {
+					t.Errorf("Token %d: expected %s %q at %d:%d, got %s %q at %d:%d", i,
+						want.Type, want.Lexeme, want.Line, want.Column, got.Type, got.Lexeme, got.Line, got.Column)
+				}
+			}
+		})
+	}
+}
+
+// TestYulLexerStreaming tests that lexing from a reader yields the tokens
+// of lexing the same source as a string
+func TestYulLexerStreaming(t *testing.T) {
+	source := strings.Repeat(`
+	object "Token" {
+		code {
+			/* a block comment
+			   spanning lines */
+			let s := "a string"
+			sstore(0x01, add(calldataload(4), 42)) // trailing comment
+		}
+	}
+	`, 200)
+
+	lexer := NewYulLexer()
+	if err := lexer.Init(source); err != nil {
+		t.Fatalf("Failed to initialize lexer: %v", err)
+	}
+	expected, err := lexer.ScanTokens()
+	if err != nil {
+		t.Fatalf("Failed to scan tokens: %v", err)
+	}
+
+	readers := map[string]func() io.Reader{
+		"whole":    func() io.Reader { return strings.NewReader(source) },
+		"one byte": func() io.Reader { return iotest.OneByteReader(strings.NewReader(source)) },
+		"half":     func() io.Reader { return iotest.HalfReader(strings.NewReader(source)) },
+	}
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			if err := lexer.InitReader(reader()); err != nil {
+				t.Fatalf("Failed to initialize lexer: %v", err)
+			}
+			tokens, err := lexer.ScanTokens()
+			if err != nil {
+				t.Fatalf("Failed to scan tokens: %v", err)
+			}
+			if !reflect.DeepEqual(tokens, expected) {
+				t.Fatalf("Streamed tokens differ from those of the string")
+			}
+			if len(lexer.window) > 2*streamChunk {
+				t.Errorf("Expected the window to stay bounded, holds %d bytes", len(lexer.window))
+			}
+		})
+	}
+
+	// NextToken produces the same tokens one at a time
+	if err := lexer.Init(source); err != nil {
+		t.Fatalf("Failed to initialize lexer: %v", err)
+	}
+	for i, want := range expected {
+		if got := lexer.NextToken(); got != want {
+			t.Fatalf("Token %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+	if got := lexer.NextToken(); got.Type != TokenEOF {
+		t.Errorf("Expected EOF after the last token, got %s", got.Type)
+	}
+
+	// Errors are the same for both
+	lexer.Init("let x := 1 ~")
+	_, stringErr := lexer.ScanTokens()
+	lexer.InitReader(strings.NewReader("let x := 1 ~"))
+	_, readerErr := lexer.ScanTokens()
+	if stringErr == nil || readerErr == nil || stringErr.Error() != readerErr.Error() {
+		t.Errorf("Expected the same error, got %v and %v", stringErr, readerErr)
+	}
+	lexer.Init("let x := 1 ~")
+	if got := lexer.NextToken(); got.Type != TokenLet {
+		t.Errorf("Expected let, got %s", got.Type)
+	}
+	for i := 0; i < 3; i++ {
+		lexer.NextToken()
+	}
+	if got := lexer.NextToken(); got.Type != TokenError || !strings.Contains(got.Lexeme, "unexpected character '~'") {
+		t.Errorf("Expected an error token, got %+v", got)
+	}
+	lexer.InitReader(strings.NewReader(""))
+	if _, err := lexer.Next(); err == nil {
+		t.Error("Expected an error for an empty reader")
+	}
+	lexer.InitReader(iotest.ErrReader(io.ErrUnexpectedEOF))
+	if _, err := lexer.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected the read error, got %v", err)
+	}
+}
+
 // TestYulLexerEdgeCases tests various edge cases and boundary conditions
 func TestYulLexerEdgeCases(t *testing.T) {
 	tests := []struct {
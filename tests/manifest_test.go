@@ -0,0 +1,962 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestManifestNameValidation tests method and event name checks
+func TestManifestNameValidation(t *testing.T) {
+	tests := []struct {
+		kind  ManifestNameKind
+		name  string
+		valid bool
+	}{
+		{ManifestMethod, "transfer", true},
+		{ManifestMethod, "_deploy", true},
+		{ManifestEvent, "_deploy", false},
+		{ManifestMethod, "_hidden", false},
+		{ManifestMethod, "balance.of", false},
+		{ManifestMethod, "1st", false},
+		{ManifestMethod, "", false},
+		{ManifestEvent, strings.Repeat("a", MaxManifestNameLength+1), false},
+	}
+
+	for _, test := range tests {
+		problem := CheckManifestName(test.kind, test.name)
+		if (problem == "") != test.valid {
+			t.Errorf("%s %q: expected valid=%v, got problem %q", test.kind, test.name, test.valid, problem)
+		}
+	}
+}
+
+// TestManifestNameRenaming tests deterministic renaming of unrepresentable names
+func TestManifestNameRenaming(t *testing.T) {
+	newContract := func() *NeoContract {
+		return &NeoContract{
+			Name: "Test",
+			Methods: []*ContractMethod{
+				{Name: "balance.of"},
+				{Name: "balance_of"},
+				{Name: "Transfer"},
+				{Name: "transfer"},
+			},
+			Events:   []*ContractEvent{{Name: "$Log"}},
+			Metadata: &ContractMetadata{},
+		}
+	}
+
+	contract := newContract()
+	issues := ValidateManifestNames(contract)
+	if len(issues) != 3 {
+		t.Fatalf("Expected 3 issues, got %v", issues)
+	}
+
+	// Without renaming, finalization fails with an actionable error
+	strict := NewYulToNeoCompiler(CompilerConfig{})
+	if _, err := strict.RuntimeManager.Finalize(newContract()); err == nil || !strings.Contains(err.Error(), "--rename-manifest-names") {
+		t.Errorf("Expected finalization to fail with a hint, got %v", err)
+	}
+
+	renaming := NewYulToNeoCompiler(CompilerConfig{RenameManifestNames: true})
+	renamed, err := renaming.RuntimeManager.Finalize(newContract())
+	if err != nil {
+		t.Fatalf("Finalize failed: %v", err)
+	}
+
+	expected := []string{"balance_of_2", "balance_of", "Transfer", "transfer_2"}
+	for i, method := range renamed.Methods {
+		if method.Name != expected[i] {
+			t.Errorf("Method %d: expected %s, got %s", i, expected[i], method.Name)
+		}
+	}
+	if renamed.Events[0].Name != "x_Log" {
+		t.Errorf("Unexpected event name %s", renamed.Events[0].Name)
+	}
+	if len(ValidateManifestNames(renamed)) != 0 {
+		t.Errorf("Expected renamed contract to be valid")
+	}
+
+	mappings := renamed.Metadata.NameMappings
+	if len(mappings) != 3 || mappings[0].Original != "balance.of" || mappings[0].Manifest != "balance_of_2" {
+		t.Errorf("Unexpected name mappings: %+v", mappings)
+	}
+}
+
+// TestABIChangelog tests classification of interface changes between builds
+func TestABIChangelog(t *testing.T) {
+	method := func(name string, safe bool, params ...string) *ContractMethod {
+		m := &ContractMethod{Name: name, Safe: safe, Returns: []MethodParameter{{Name: "r", Type: "Integer"}}}
+		for i, typ := range params {
+			m.Parameters = append(m.Parameters, MethodParameter{Name: string(rune('a' + i)), Type: typ})
+		}
+		return m
+	}
+	event := func(name string, types ...string) *ContractEvent {
+		e := &ContractEvent{Name: name}
+		for _, typ := range types {
+			e.Parameters = append(e.Parameters, EventParameter{Type: typ})
+		}
+		return e
+	}
+
+	old := &NeoContract{
+		Version: "1.2.0",
+		Methods: []*ContractMethod{
+			method("balanceOf", true, "Hash160"),
+			method("transfer", false, "Hash160", "Hash160", "Integer"),
+			method("mint", false, "Hash160", "Integer"),
+			method("burn", false, "Integer"),
+		},
+		Events: []*ContractEvent{event("Transfer", "Hash160", "Hash160", "Integer"), event("Paused")},
+	}
+	current := &NeoContract{
+		Version: "1.3.0",
+		Methods: []*ContractMethod{
+			method("balanceOf", true, "Hash160"),
+			method("transfer", false, "Hash160", "Hash160", "ByteArray"),
+			method("issue", false, "Hash160", "Integer"),
+			method("burn", true, "Integer"),
+			method("decimals", true),
+		},
+		Events: []*ContractEvent{event("Transfer", "Hash160", "Hash160", "ByteArray"), event("Unpaused")},
+	}
+
+	changelog := DiffContractABI(old, current)
+	expected := map[ABIChangeKind]bool{
+		ABIParametersChanged:     true,
+		ABIMethodRenamed:         true,
+		ABISafetyChanged:         false,
+		ABIMethodAdded:           false,
+		ABIEventSignatureChanged: true,
+		ABIEventRemoved:          true,
+		ABIEventAdded:            false,
+	}
+	if len(changelog.Changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got:\n%s", len(expected), changelog)
+	}
+	for _, change := range changelog.Changes {
+		breaking, ok := expected[change.Kind]
+		if !ok || breaking != change.Breaking {
+			t.Errorf("Unexpected change %+v", change)
+		}
+	}
+
+	// Breaking changes need a major version bump
+	if err := CheckABIVersionBump(changelog); err == nil || !strings.Contains(err.Error(), "2.0.0") {
+		t.Errorf("Expected a version bump error, got %v", err)
+	}
+	changelog.NewVersion = "2.0.0"
+	if err := CheckABIVersionBump(changelog); err != nil {
+		t.Errorf("Expected major bump to pass, got %v", err)
+	}
+
+	// Compatible changes need no bump
+	compatible := DiffContractABI(old, &NeoContract{Version: "1.2.0", Methods: append(old.Methods, method("decimals", true)), Events: old.Events})
+	if compatible.HasBreaking() || CheckABIVersionBump(compatible) != nil {
+		t.Errorf("Expected only compatible changes, got:\n%s", compatible)
+	}
+
+	// Baselines must be contract artifacts
+	dir, baselines := t.TempDir(), 0
+	baseline := func(content string) string {
+		baselines++
+		path := filepath.Join(dir, fmt.Sprintf("baseline%d.json", baselines))
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	for _, content := range []string{`{}`, `{"name": "T", "version": "1.0.0"}`, `{"methods": []}`, `{"methods": [{"parameters": []}]}`, `[1, 2]`} {
+		if _, err := LoadABIBaseline(baseline(content)); err == nil {
+			t.Errorf("Expected baseline %s to be rejected", content)
+		}
+	}
+	valid := baseline(`{"name": "T", "version": "1.0.0", "methods": [{"name": "main", "parameters": []}]}`)
+	if contract, err := LoadABIBaseline(valid); err != nil || contract.Version != "1.0.0" || len(contract.Methods) != 1 {
+		t.Errorf("Expected the artifact to load, got %+v, %v", contract, err)
+	}
+
+	// An unreadable baseline fails the build only with --fail-on-abi-break
+	source := `object "T" { code { sstore(0, 1) } }`
+	invalid := baseline(`{"unrelated": true}`)
+	result, err := NewYulToNeoCompiler(CompilerConfig{ABIBaseline: invalid}).Compile(source)
+	if err != nil || len(result.Warnings) == 0 {
+		t.Errorf("Expected a warning for an invalid baseline, got %v", err)
+	}
+	if _, err := NewYulToNeoCompiler(CompilerConfig{ABIBaseline: invalid, FailOnABIBreak: true}).Compile(source); err == nil || !strings.Contains(err.Error(), "not a contract artifact") {
+		t.Errorf("Expected an invalid baseline to fail with --fail-on-abi-break, got %v", err)
+	}
+
+	// Contract versions are semantic versions
+	if _, err := ContractVersionFromConfig(CompilerConfig{ContractVersion: "banana"}); err == nil {
+		t.Errorf("Expected an invalid contract version to fail")
+	}
+	if version, err := ContractVersionFromConfig(CompilerConfig{CompilerFlags: []string{"--contract-version", "v2.1.0-rc1"}}); err != nil || version != "v2.1.0-rc1" {
+		t.Errorf("Expected the flag version, got %q, %v", version, err)
+	}
+	if _, err := NewYulToNeoCompiler(CompilerConfig{ContractVersion: "1.x"}).Compile(source); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected an invalid contract version to fail compilation, got %v", err)
+	}
+}
+
+// TestNEFEncoding tests NEF3 serialization against the decoder
+func TestNEFEncoding(t *testing.T) {
+	ast, err := NewYulParser().Parse(`object "Test" { code { sstore(1, add(2, 3)) } }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	contract, err := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()}).Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	token := MethodToken{Method: "balanceOf", ParametersCount: 1, HasReturnValue: true, CallFlags: 0x0F}
+	copy(token.Hash[:], scriptHashBytes(GASTokenHash))
+	contract.MethodTokens = []MethodToken{token}
+
+	data, err := EncodeNEF(contract)
+	if err != nil {
+		t.Fatalf("EncodeNEF failed: %v", err)
+	}
+	if string(data[:4]) != "NEF3" {
+		t.Errorf("Expected the NEF3 magic, got %q", data[:4])
+	}
+	nef, err := DecodeNEF(data)
+	if err != nil {
+		t.Fatalf("DecodeNEF failed: %v", err)
+	}
+	if nef.Compiler != NEFCompilerName || nef.Source != "" {
+		t.Errorf("Unexpected compiler %q, source %q", nef.Compiler, nef.Source)
+	}
+	if len(nef.Tokens) != 1 || nef.Tokens[0] != token {
+		t.Errorf("Expected the method token back, got %+v", nef.Tokens)
+	}
+	size := 0
+	for _, instr := range contract.Runtime {
+		size += instr.Size
+	}
+	if len(nef.Script) != size || nef.Script[0] != byte(contract.Runtime[0].Opcode) {
+		t.Errorf("Expected a %d byte script, got %d", size, len(nef.Script))
+	}
+
+	// The checksum is the double SHA-256 of everything before it
+	first := sha256.Sum256(data[:len(data)-4])
+	second := sha256.Sum256(first[:])
+	if nef.Checksum != binary.LittleEndian.Uint32(second[:4]) {
+		t.Errorf("Unexpected checksum %08x", nef.Checksum)
+	}
+
+	// Corruption is detected
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-5] ^= 0xFF
+	if _, err := DecodeNEF(corrupt); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Expected a checksum error, got %v", err)
+	}
+	if _, err := DecodeNEF(data[:len(data)-1]); err == nil {
+		t.Errorf("Expected truncated files to fail")
+	}
+	if _, err := EncodeNEF(&NeoContract{}); err == nil {
+		t.Errorf("Expected an empty script to fail")
+	}
+	contract.MethodTokens[0].Method = "_private"
+	if _, err := EncodeNEF(contract); err == nil {
+		t.Errorf("Expected a method token starting with an underscore to fail")
+	}
+}
+
+// TestContractScript tests the byte encoding of the runtime
+func TestContractScript(t *testing.T) {
+	ast, err := NewYulParser().Parse(`object "Test" { code { sstore(1, add(sload(0), 0x123456)) } }`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	generator := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()})
+	contract, err := generator.Generate(ast)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	script, err := contract.Script()
+	if err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+	if size := generator.GetCompilationStats().CompiledSizeBytes; len(script) != size {
+		t.Errorf("Expected a %d byte script, got %d", size, len(script))
+	}
+
+	// Syscalls carry interop IDs, PUSHDATA operands their length
+	getContext := sha256.Sum256([]byte("System.Storage.GetContext"))
+	offset, syscalls := 0, 0
+	for _, instr := range contract.Runtime {
+		encoded := script[offset : offset+instr.Size]
+		if encoded[0] != byte(instr.Opcode) {
+			t.Fatalf("Expected %s at offset %d, got 0x%02X", OpcodeMnemonic(instr.Opcode), offset, encoded[0])
+		}
+		switch instr.Opcode {
+		case SYSCALL:
+			syscalls++
+			if string(instr.Operand) == "System.Storage.GetContext" && string(encoded[1:]) != string(getContext[:4]) {
+				t.Errorf("Expected the interop ID %x, got %x", getContext[:4], encoded[1:])
+			}
+		case PUSHDATA1:
+			if int(encoded[1]) != len(instr.Operand) || string(encoded[2:]) != string(instr.Operand) {
+				t.Errorf("Expected a length-prefixed operand, got %x", encoded)
+			}
+		}
+		offset += instr.Size
+	}
+	if syscalls == 0 {
+		t.Errorf("Expected syscalls in the script")
+	}
+
+	// Sizes that disagree with the encoding would misplace jump targets
+	contract.Runtime = append(contract.Runtime, NeoInstruction{Opcode: JMP, Size: 2})
+	if _, err := contract.Script(); err == nil || !strings.Contains(err.Error(), "operand") {
+		t.Errorf("Expected a missing operand to fail, got %v", err)
+	}
+	contract.Runtime[len(contract.Runtime)-1] = NeoInstruction{Opcode: 0xFF, Size: 1}
+	if _, err := contract.Script(); err == nil || !strings.Contains(err.Error(), "unknown opcode") {
+		t.Errorf("Expected an unknown opcode to fail, got %v", err)
+	}
+}
+
+// TestInteropRegistry tests interop IDs and disassembling syscalls
+func TestInteropRegistry(t *testing.T) {
+	registry := NewInteropRegistry()
+	service, ok := registry.Lookup("System.Storage.Get")
+	if !ok || service.ID != 0x31e85d92 || service.Price != 1<<15 {
+		t.Errorf("Expected System.Storage.Get as 0x31e85d92, got %+v", service)
+	}
+	if service.Pop != 2 || service.Push != 1 {
+		t.Errorf("Expected System.Storage.Get to take 2 items and push 1, got %+v", service)
+	}
+	if byID, ok := registry.LookupID(service.ID); !ok || byID.Name != service.Name {
+		t.Errorf("Expected the ID to name System.Storage.Get, got %+v", byID)
+	}
+	if err := registry.Register(InteropService{Name: "System.Storage.Get"}); err == nil {
+		t.Errorf("Expected a duplicate service to fail")
+	}
+	if err := registry.Register(InteropService{Name: "Private.Oracle.Read", Pop: 1, Push: 1, Price: 1 << 10}); err != nil {
+		t.Errorf("Expected a new service to register, got %v", err)
+	}
+
+	contract := &NeoContract{Runtime: []NeoInstruction{
+		NewSyscallInstruction("System.Runtime.GetTime"),
+		NewPushInstruction(CreateNeoVMByteString("key")),
+		NewSyscallInstruction("System.Storage.Get"),
+		NewControlFlowInstruction(RET, 0),
+	}}
+	script, err := contract.Script()
+	if err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+	if script[0] != byte(SYSCALL) || binary.LittleEndian.Uint32(script[1:5]) != InteropID("System.Runtime.GetTime") {
+		t.Errorf("Expected the GetTime interop ID, got %x", script[:5])
+	}
+	instructions, err := DisassembleScript(script)
+	if err != nil {
+		t.Fatalf("Disassembly failed: %v", err)
+	}
+	if len(instructions) != len(contract.Runtime) {
+		t.Fatalf("Expected %d instructions, got %d", len(contract.Runtime), len(instructions))
+	}
+	for i, instr := range instructions {
+		want := contract.Runtime[i]
+		if instr.Opcode != want.Opcode || string(instr.Operand) != string(want.Operand) || instr.Size != want.Size {
+			t.Errorf("Instruction %d: expected %s %q, got %s %q", i, OpcodeMnemonic(want.Opcode), want.Operand, OpcodeMnemonic(instr.Opcode), instr.Operand)
+		}
+	}
+
+	// Unknown services fail at compile time, unknown IDs when disassembling
+	contract.Runtime[0] = NewSyscallInstruction("Neo.Crypto.Keccak256")
+	if _, err := contract.Script(); err == nil || !strings.Contains(err.Error(), "unknown interop service") {
+		t.Errorf("Expected an unknown service to fail, got %v", err)
+	}
+	if _, err := DisassembleScript([]byte{byte(SYSCALL), 0, 0, 0, 0}); err == nil {
+		t.Errorf("Expected an unknown interop ID to fail")
+	}
+	if _, err := DisassembleScript([]byte{byte(PUSHDATA1), 4, 1}); err == nil {
+		t.Errorf("Expected a truncated operand to fail")
+	}
+}
+
+// TestManifestGeneration tests the manifest derived from the contract and
+// the configuration
+func TestManifestGeneration(t *testing.T) {
+	source := `object "Token" { code {
+		function balance(owner) -> amount { amount := sload(owner) }
+		sstore(0, add(callvalue(), number()))
+		sstore(1, calldataload(4))
+		log1(0, 0, 0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef)
+		pop(call(gas(), 0x1234, 0, 0, 0, 0, 0))
+	} }`
+	compiler := NewYulToNeoCompiler(CompilerConfig{
+		ExportFunctions:    []string{"balance"},
+		Permissions:        []string{GASTokenHash + ":transfer"},
+		Trusts:             []string{"*"},
+		SupportedStandards: []string{"NEP-17"},
+	})
+	result, err := compiler.Compile(source)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	manifest := result.Contract.Manifest
+	if manifest == nil {
+		t.Fatalf("Expected a manifest")
+	}
+
+	methods := make(map[string]ABIMethod)
+	for _, method := range manifest.ABI.Methods {
+		methods[method.Name] = method
+	}
+	if main := methods[ExternalCallMethod]; main.Offset != 0 || len(main.Parameters) != 2 || main.ReturnType != "Void" {
+		t.Errorf("Unexpected main method %+v", main)
+	}
+	if payment, ok := methods[PaymentMethod]; !ok || len(payment.Parameters) != 3 || payment.Parameters[0].Type != "Hash160" {
+		t.Errorf("Expected the payment method, got %+v", payment)
+	}
+	balance, ok := methods["balance"]
+	if !ok || balance.ReturnType != "Integer" || len(balance.Parameters) != 1 || balance.Parameters[0].Name != "owner" {
+		t.Errorf("Expected the exported function, got %+v", balance)
+	}
+	if offset, _ := compiler.CodeGenerator.labelMap.Get(exportLabel("balance")); compiler.CodeGenerator.byteOffset(offset) != balance.Offset {
+		t.Errorf("Expected balance at its entry stub")
+	}
+	if len(manifest.ABI.Events) != 1 || manifest.ABI.Events[0].Name != "Event_ddf252ad" {
+		t.Errorf("Unexpected events %+v", manifest.ABI.Events)
+	}
+
+	// Calls the script makes are permitted, plus the configured ones
+	permitted := make(map[string]string)
+	for _, permission := range manifest.Permissions {
+		data, _ := json.Marshal(permission.Methods)
+		permitted[permission.Contract] = string(data)
+	}
+	expected := map[string]string{
+		LedgerHash:   `["currentIndex"]`,
+		"*":          `["main"]`,
+		GASTokenHash: `["transfer"]`,
+	}
+	for contract, methods := range expected {
+		if permitted[contract] != methods {
+			t.Errorf("Expected %s to permit %s, got %q", contract, methods, permitted[contract])
+		}
+	}
+	if _, err := NewYulToNeoCompiler(CompilerConfig{Permissions: []string{"bad:1st"}}).Compile(source); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected an invalid permission to fail compilation, got %v", err)
+	}
+
+	// Contracts are "*", script hashes or compressed group public keys
+	group := "036b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296"
+	settings, errs := ManifestSettingsFromConfig(CompilerConfig{
+		Permissions:        []string{"*:main", strings.ToUpper(GASTokenHash[2:]) + ":transfer", group},
+		Trusts:             []string{GASTokenHash, group},
+		SupportedStandards: []string{" NEP-17 "},
+	})
+	if len(errs) != 0 {
+		t.Fatalf("Expected valid settings, got %v", errs)
+	}
+	if len(settings.Permissions) != 3 || settings.Permissions[1].Contract != GASTokenHash || settings.Permissions[2].Contract != group {
+		t.Errorf("Unexpected permissions %+v", settings.Permissions)
+	}
+	if len(settings.Trusts.Items) != 2 || len(settings.Standards) != 1 || settings.Standards[0] != "NEP-17" {
+		t.Errorf("Unexpected trusts %+v and standards %q", settings.Trusts, settings.Standards)
+	}
+	for _, config := range []CompilerConfig{
+		{Permissions: []string{"zzz:transfer"}},
+		{Permissions: []string{GASTokenHash + "00:transfer"}},
+		{Permissions: []string{"02" + strings.Repeat("ff", 32)}},
+		{Trusts: []string{"not-a-hash"}},
+		{Trusts: []string{""}},
+		{Trusts: []string{group[:64]}},
+		{SupportedStandards: []string{""}},
+		{SupportedStandards: []string{"  "}},
+	} {
+		if _, errs := ManifestSettingsFromConfig(config); len(errs) != 1 {
+			t.Errorf("Expected %+v to be rejected, got %v", config, errs)
+		}
+		if _, err := NewYulToNeoCompiler(config).Compile(source); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+			t.Errorf("Expected %+v to fail compilation, got %v", config, err)
+		}
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	for _, fragment := range []string{`"trusts":"*"`, `"supportedstandards":["NEP-17"]`, `"features":{}`, `"groups":[]`, `"extra":null`} {
+		if !strings.Contains(string(data), fragment) {
+			t.Errorf("Expected %s in %s", fragment, data)
+		}
+	}
+	var decoded ContractManifest
+	if err := json.Unmarshal(data, &decoded); err != nil || !decoded.Trusts.All {
+		t.Errorf("Expected the manifest to decode, got %v", err)
+	}
+
+	if _, err := NewYulToNeoCompiler(CompilerConfig{ExportFunctions: []string{"missing"}}).Compile(source); err == nil {
+		t.Errorf("Expected exporting an undefined function to fail")
+	}
+}
+
+// TestSafeMethods tests that exported functions that do not change state
+// are Safe and read storage through the read-only context
+func TestSafeMethods(t *testing.T) {
+	source := `object "Token" { code {
+		function balance(owner) -> amount { amount := sload(owner) }
+		function total() -> sum { sum := add(balance(0), balance(1)) }
+		function set(key, value) { sstore(key, value) }
+		function bump(key) {
+			set(key, add(balance(key), 1))
+		}
+		sstore(0, 1)
+	} }`
+	compile := func(views ...string) (*YulToNeoCompiler, *CompilationResult, error) {
+		compiler := NewYulToNeoCompiler(CompilerConfig{ExportFunctions: []string{"balance", "total", "bump"}, ViewFunctions: views})
+		result, err := compiler.Compile(source)
+		return compiler, result, err
+	}
+
+	compiler, result, err := compile("balance", "total")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	safe := make(map[string]bool)
+	for _, method := range result.Contract.Manifest.ABI.Methods {
+		safe[method.Name] = method.Safe
+	}
+	if !safe["balance"] || !safe["total"] || safe["bump"] || safe[ExternalCallMethod] {
+		t.Errorf("Expected balance and total to be the only safe methods, got %v", safe)
+	}
+
+	// Each stub caches the storage context it may use
+	context := func(name string) string {
+		code := compiler.CodeGenerator.instructions
+		start, _ := compiler.CodeGenerator.labelMap.Get(exportLabel(name))
+		for _, instr := range code[start:] {
+			if instr.Opcode == SYSCALL && strings.HasPrefix(string(instr.Operand), "System.Storage.Get") {
+				return string(instr.Operand)
+			}
+		}
+		return ""
+	}
+	if got := context("balance"); got != "System.Storage.GetReadOnlyContext" {
+		t.Errorf("Expected the read-only context for balance, got %s", got)
+	}
+	if got := context("bump"); got != "System.Storage.GetContext" {
+		t.Errorf("Expected the storage context for bump, got %s", got)
+	}
+
+	// A view that changes state, even through another function, is refused
+	if _, _, err := compile("bump"); err == nil || !strings.Contains(err.Error(), "sstore through set at line 6") {
+		t.Errorf("Expected bump to be refused as a view, got %v", err)
+	}
+	if _, _, err := compile("missing"); err == nil {
+		t.Errorf("Expected an undefined view function to fail")
+	}
+}
+
+// TestUpdateMethod tests the owner-checked update method and the lowering
+// of selfdestruct
+func TestUpdateMethod(t *testing.T) {
+	source := `object "Owned" { code {
+		function update(v) { sstore(1, v) }
+		sstore(0, caller())
+		if eq(sload(1), 7) { selfdestruct(caller()) }
+	} }`
+	compile := func(config CompilerConfig) (*YulToNeoCompiler, *CompilationResult, error) {
+		compiler := NewYulToNeoCompiler(config)
+		result, err := compiler.Compile(source)
+		return compiler, result, err
+	}
+
+	for _, owner := range []string{"0x1234567890abcdef1234567890abcdef12345678", "slot:0"} {
+		compiler, result, err := compile(CompilerConfig{UpdateOwner: owner})
+		if err != nil {
+			t.Fatalf("Compile with owner %s failed: %v", owner, err)
+		}
+		var update *ABIMethod
+		for i, method := range result.Contract.Manifest.ABI.Methods {
+			if method.Name == UpdateMethod {
+				update = &result.Contract.Manifest.ABI.Methods[i]
+			}
+		}
+		if update == nil || update.Safe || update.ReturnType != "Void" || len(update.Parameters) != 2 ||
+			update.Parameters[0].Type != "ByteArray" || update.Parameters[1].Type != "String" {
+			t.Fatalf("Expected update(nefFile, manifest) for owner %s, got %+v", owner, update)
+		}
+
+		// The owner's witness is checked before ContractManagement.update
+		code := compiler.CodeGenerator.instructions
+		start, _ := compiler.CodeGenerator.labelMap.Get(UpdateMethod)
+		var syscalls []string
+		for _, instr := range code[start:] {
+			if instr.Opcode == SYSCALL {
+				syscalls = append(syscalls, string(instr.Operand))
+			}
+			if instr.Opcode == RET {
+				break
+			}
+		}
+		if !strings.Contains(strings.Join(syscalls, " "), "System.Runtime.CheckWitness System.Contract.Call") {
+			t.Errorf("Expected the witness check before the update call for owner %s, got %v", owner, syscalls)
+		}
+		if owner == "slot:0" && syscalls[0] != "System.Storage.GetContext" {
+			t.Errorf("Expected the update stub to read the owner from storage, got %v", syscalls)
+		}
+	}
+
+	// selfdestruct destroys the contract and warns about the beneficiary
+	compiler, result, err := compile(CompilerConfig{})
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	warnings := compiler.context.ErrorCollector.GetWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Message, "selfdestruct does not transfer") {
+		t.Errorf("Expected a selfdestruct warning, got %+v", warnings)
+	}
+	permitted := ""
+	for _, permission := range result.Contract.Manifest.Permissions {
+		if permission.Contract == ContractManagementHash {
+			data, _ := json.Marshal(permission.Methods)
+			permitted = string(data)
+		}
+	}
+	if permitted != `["destroy"]` {
+		t.Errorf("Expected ContractManagement.destroy to be permitted, got %q", permitted)
+	}
+	for _, method := range result.Contract.Manifest.ABI.Methods {
+		if method.Name == UpdateMethod {
+			t.Errorf("Expected no update method without an owner")
+		}
+	}
+
+	// selfdestruct in a function ends the invocation after destroying
+	result, err = NewYulToNeoCompiler(CompilerConfig{}).Compile(`object "T" { code {
+		f()
+		sstore(1, 7)
+		function f() { selfdestruct(0) }
+	} }`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	host := NewTestHost()
+	if err := host.Deploy(result.Contract); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	var called []string
+	host.Engine.InteropServices["System.Contract.Call"] = func(args []NeoVMStackItem) (NeoVMStackItem, error) {
+		method, _ := bytesOf(args[1])
+		called = append(called, string(method))
+		return NeoVMNull{}, nil
+	}
+	host.Invoke("main").ExpectResult(t)
+	host.ExpectStorage(t, 1, 0)
+	if len(called) != 1 || called[0] != "destroy" {
+		t.Errorf("Expected ContractManagement.destroy to be called once, got %v", called)
+	}
+
+	if _, _, err := compile(CompilerConfig{UpdateOwner: "slot:0", ExportFunctions: []string{"update"}}); err == nil {
+		t.Errorf("Expected an exported update function to collide with the update method")
+	}
+	if _, err := ParseUpdateOwner("nobody"); err == nil {
+		t.Errorf("Expected an invalid owner to fail")
+	}
+	if _, _, err := compile(CompilerConfig{UpdateOwner: "nobody"}); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected an invalid owner to fail compilation, got %v", err)
+	}
+}
+
+func TestNEP17Mode(t *testing.T) {
+	source := `object "Token" { code {
+		function fun_symbol_1() -> p { p := mload(64) mstore(64, add(p, 64)) mstore(p, 3) }
+		function fun_decimals_2() -> d { d := 8 }
+		function getter_fun_totalSupply_3() -> s { s := sload(0) }
+		function getter_fun_balanceOf_4(owner) -> b { b := sload(owner) }
+		function fun_transfer_5(to, amount) -> ok {
+			let from := caller()
+			sstore(from, sub(sload(from), amount))
+			sstore(to, add(sload(to), amount))
+			mstore(0, amount)
+			log3(0, 32, 0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef, from, to)
+			ok := 1
+		}
+		sstore(0, 1000)
+	} }`
+	compiler := NewYulToNeoCompiler(CompilerConfig{
+		SupportedStandards: []string{"NEP-17"},
+		CompilerFlags:      []string{"--standard", "nep17"},
+	})
+	result, err := compiler.Compile(source)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	manifest := result.Contract.Manifest
+	if len(manifest.SupportedStandards) != 1 || manifest.SupportedStandards[0] != "NEP-17" {
+		t.Errorf("Expected NEP-17 declared once, got %v", manifest.SupportedStandards)
+	}
+
+	methods := make(map[string]ABIMethod)
+	for _, method := range manifest.ABI.Methods {
+		methods[method.Name] = method
+	}
+	expected := map[string]string{
+		"symbol": "String", "decimals": "Integer", "totalSupply": "Integer", "balanceOf": "Integer", "transfer": "Boolean",
+	}
+	for name, returns := range expected {
+		method, ok := methods[name]
+		if !ok || method.ReturnType != returns || method.Safe != (name != "transfer") {
+			t.Errorf("Unexpected %s method %+v", name, method)
+		}
+	}
+	if transfer := methods["transfer"]; len(transfer.Parameters) != 4 || transfer.Parameters[0].Type != "Hash160" || transfer.Parameters[3].Type != "Any" {
+		t.Errorf("Unexpected transfer parameters %+v", transfer.Parameters)
+	}
+	if balanceOf := methods["balanceOf"]; len(balanceOf.Parameters) != 1 || balanceOf.Parameters[0].Type != "Hash160" {
+		t.Errorf("Unexpected balanceOf parameters %+v", balanceOf.Parameters)
+	}
+
+	if len(manifest.ABI.Events) != 1 || manifest.ABI.Events[0].Name != "Transfer" || len(manifest.ABI.Events[0].Parameters) != 3 ||
+		manifest.ABI.Events[0].Parameters[0].Type != "Hash160" || manifest.ABI.Events[0].Parameters[2].Type != "Integer" {
+		t.Errorf("Expected the NEP-17 Transfer event, got %+v", manifest.ABI.Events)
+	}
+	permitted := make(map[string]string)
+	for _, permission := range manifest.Permissions {
+		data, _ := json.Marshal(permission.Methods)
+		permitted[permission.Contract] = string(data)
+	}
+	if permitted[ContractManagementHash] != `["getContract"]` || permitted["*"] != `["onNEP17Payment"]` {
+		t.Errorf("Expected getContract and onNEP17Payment permitted, got %v", permitted)
+	}
+
+	// The notification is Transfer with [from, to, amount]
+	notified := false
+	for i, instr := range result.Contract.Runtime {
+		if instr.Opcode == PUSHDATA1 && string(instr.Operand) == "Transfer" && i+1 < len(result.Contract.Runtime) {
+			next := result.Contract.Runtime[i+1]
+			notified = next.Opcode == SYSCALL && string(next.Operand) == "System.Runtime.Notify"
+		}
+	}
+	if !notified {
+		t.Errorf("Expected a Transfer notification")
+	}
+
+	// A reverting transfer faults, so that Neo discards what it wrote
+	reverting := strings.Replace(source, "ok := 1", "if gt(amount, 100) { revert(0, 0) } ok := 1", 1)
+	result, err = NewYulToNeoCompiler(CompilerConfig{Standard: "nep17"}).Compile(reverting)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	host := NewTestHost()
+	if err := host.Deploy(result.Contract); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	host.Engine.InteropServices["System.Contract.Call"] = func([]NeoVMStackItem) (NeoVMStackItem, error) {
+		return NeoVMNull{}, nil // No contract is deployed at the recipient
+	}
+	var from, to Uint160
+	from[0], to[0] = 1, 2
+	host.Signers = []Uint160{from}
+	host.Invoke("transfer", from, to, 50, nil).ExpectResult(t, true)
+	storage := make(map[string]string)
+	for key, value := range host.Engine.Storage {
+		storage[key] = string(value)
+	}
+	invocation := host.Invoke("transfer", from, to, 200, nil)
+	invocation.ExpectFault(t, "")
+	if len(host.Engine.Storage) != len(storage) {
+		t.Errorf("Expected %d storage entries after the revert, got %d", len(storage), len(host.Engine.Storage))
+	}
+	for key, value := range host.Engine.Storage {
+		if storage[key] != string(value) {
+			t.Errorf("Expected %x to hold %x after the revert, got %x", key, storage[key], value)
+		}
+	}
+	host.Invoke("balanceOf", to).ExpectResult(t, 50)
+
+	// Every NEP-17 method needs its function
+	missing := NewYulToNeoCompiler(CompilerConfig{Standard: "NEP-17"})
+	if _, err := missing.Compile(`object "T" { code { function fun_symbol_1() -> p { p := mload(64) } } }`); err == nil {
+		t.Errorf("Expected an error for a token without decimals")
+	}
+	if _, err := StandardFromConfig(CompilerConfig{CompilerFlags: []string{"--standard=nep99"}}); err == nil {
+		t.Errorf("Expected an error for an unknown standard")
+	}
+	if _, err := NewYulToNeoCompiler(CompilerConfig{Standard: "nep99"}).Compile(`object "T" { code { sstore(0, 1) } }`); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected an unknown standard to fail compilation, got %v", err)
+	}
+}
+
+func TestNEP11Mode(t *testing.T) {
+	source := `object "Token" { code {
+		function fun_name_1() -> p { p := mload(64) mstore(64, add(p, 64)) mstore(p, 4) }
+		function fun_symbol_2() -> p { p := mload(64) mstore(64, add(p, 64)) mstore(p, 3) }
+		function fun_ownerOf_3(id) -> o { o := sload(id) }
+		function fun_transferFrom_4(from, to, id) {
+			if iszero(eq(sload(id), from)) { revert(0, 0) }
+			sstore(id, to)
+			log4(0, 0, 0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef, from, to, id)
+		}
+		function fun_tokenURI_5(id) -> p { p := mload(64) mstore(64, add(p, 64)) mstore(p, 0) }
+	} }`
+	compiler := NewYulToNeoCompiler(CompilerConfig{CompilerFlags: []string{"--standard=nep11"}})
+	result, err := compiler.Compile(source)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	manifest := result.Contract.Manifest
+	if len(manifest.SupportedStandards) != 1 || manifest.SupportedStandards[0] != "NEP-11" {
+		t.Errorf("Expected NEP-11 declared, got %v", manifest.SupportedStandards)
+	}
+	methods := make(map[string]ABIMethod)
+	for _, method := range manifest.ABI.Methods {
+		methods[method.Name] = method
+	}
+	expected := map[string]string{
+		"symbol": "String", "decimals": "Integer", "totalSupply": "Integer", "balanceOf": "Integer",
+		"tokensOf": "InteropInterface", "ownerOf": "Hash160", "tokens": "InteropInterface",
+		"properties": "Map", "transfer": "Boolean",
+	}
+	for name, returns := range expected {
+		method, ok := methods[name]
+		if !ok || method.ReturnType != returns || method.Safe != (name != "transfer") {
+			t.Errorf("Unexpected %s method %+v", name, method)
+		}
+	}
+	if transfer := methods["transfer"]; len(transfer.Parameters) != 3 || transfer.Parameters[1].Type != "ByteArray" {
+		t.Errorf("Unexpected transfer parameters %+v", transfer.Parameters)
+	}
+	if len(manifest.ABI.Events) != 1 || len(manifest.ABI.Events[0].Parameters) != 4 || manifest.ABI.Events[0].Parameters[3].Type != "ByteArray" {
+		t.Errorf("Expected the NEP-11 Transfer event, got %+v", manifest.ABI.Events)
+	}
+
+	// Divisible tokens take the ERC-1155 functions
+	divisible := `object "Multi" { code {
+		function fun_symbol_1() -> p { p := mload(64) mstore(64, add(p, 64)) mstore(p, 3) }
+		function fun_decimals_2() -> d { d := 0 }
+		function fun_balanceOf_3(account, id) -> b { b := sload(add(account, id)) }
+		function fun_safeTransferFrom_4(from, to, id, amount, payload) {
+			mstore(0, id)
+			mstore(32, amount)
+			log4(0, 64, 0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62, caller(), from, to)
+		}
+	} }`
+	result, err = NewYulToNeoCompiler(CompilerConfig{Standard: "nep11-divisible"}).Compile(divisible)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	methods = make(map[string]ABIMethod)
+	for _, method := range result.Contract.Manifest.ABI.Methods {
+		if method.Name == "balanceOf" || method.Name == "transfer" || method.Name == "ownerOf" {
+			methods[fmt.Sprintf("%s/%d", method.Name, len(method.Parameters))] = method
+		}
+	}
+	if len(methods) != 4 || methods["transfer/5"].ReturnType != "Boolean" || methods["ownerOf/1"].ReturnType != "InteropInterface" ||
+		methods["balanceOf/1"].ReturnType != "Integer" || methods["balanceOf/2"].ReturnType != "Integer" {
+		t.Errorf("Unexpected divisible methods %v", methods)
+	}
+
+	// ERC-721 tokens need ownerOf
+	if _, err := NewYulToNeoCompiler(CompilerConfig{Standard: "nep11"}).Compile(strings.Replace(source, "fun_ownerOf_3", "owner_3", -1)); err == nil {
+		t.Errorf("Expected an error for a token without ownerOf")
+	}
+}
+
+// TestEthereumABIConversion tests converting between Ethereum and manifest
+// ABIs
+func TestEthereumABIConversion(t *testing.T) {
+	types := map[string]string{
+		"address": "Hash160", "uint256": "Integer", "uint8": "Integer", "int": "Integer", "bool": "Boolean",
+		"string": "String", "bytes": "ByteArray", "bytes4": "ByteArray", "bytes32": "Hash256",
+		"uint256[]": "Array", "address[2]": "Array", "tuple": "Array",
+		"uint7": "", "uint512": "", "uint08": "", "bytes33": "", "fixed128x18": "",
+	}
+	for kind, expected := range types {
+		if got, err := ManifestType(kind); got != expected || (err != nil) != (expected == "") {
+			t.Errorf("Expected %s to map to %q, got %q (%v)", kind, expected, got, err)
+		}
+	}
+
+	abi := `[
+		{"type": "constructor", "inputs": [{"name": "supply", "type": "uint256"}]},
+		{"type": "function", "name": "transfer", "inputs": [{"name": "to", "type": "address"}, {"name": "amount", "type": "uint256"}], "outputs": [{"name": "", "type": "bool"}], "stateMutability": "nonpayable"},
+		{"type": "function", "name": "balanceOf", "inputs": [{"name": "", "type": "address"}], "outputs": [{"name": "", "type": "uint256"}], "stateMutability": "view"},
+		{"type": "function", "name": "getReserves", "inputs": [], "outputs": [{"name": "a", "type": "uint112"}, {"name": "b", "type": "uint112"}], "stateMutability": "view"},
+		{"type": "function", "name": "swap", "inputs": [{"name": "legs", "type": "tuple[]", "components": [{"name": "pool", "type": "address"}, {"name": "amount", "type": "uint"}]}], "outputs": [], "stateMutability": "payable"},
+		{"type": "event", "name": "Transfer", "inputs": [{"name": "from", "type": "address", "indexed": true}, {"name": "to", "type": "address", "indexed": true}, {"name": "value", "type": "uint256", "indexed": false}], "anonymous": false},
+		{"type": "error", "name": "Insufficient", "inputs": []}
+	]`
+	entries, err := ParseEthereumABI([]byte(abi))
+	if err != nil {
+		t.Fatalf("ParseEthereumABI failed: %v", err)
+	}
+	methods, events, err := ContractInterfaceOfEthereumABI(entries)
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if len(methods) != 4 || len(events) != 1 {
+		t.Fatalf("Expected 4 methods and 1 event, got %d and %d", len(methods), len(events))
+	}
+	transfer, balanceOf, reserves, swap := methods[0], methods[1], methods[2], methods[3]
+	if fmt.Sprintf("%x", transfer.Selector) != "a9059cbb" || transfer.Parameters[0].Type != "Hash160" || transfer.Returns[0].Type != "Boolean" || transfer.Safe {
+		t.Errorf("Unexpected transfer %+v", transfer)
+	}
+	if !balanceOf.Safe || balanceOf.Parameters[0].Name != "arg0" || fmt.Sprintf("%x", balanceOf.Selector) != "70a08231" {
+		t.Errorf("Unexpected balanceOf %+v", balanceOf)
+	}
+	if len(reserves.Returns) != 1 || reserves.Returns[0].Type != "Array" {
+		t.Errorf("Expected several outputs returned as an Array, got %+v", reserves.Returns)
+	}
+	if !swap.Payable || ethereumSignature("swap", entries[4].Inputs) != "swap((address,uint256)[])" {
+		t.Errorf("Unexpected swap %+v", swap)
+	}
+	if event := events[0]; event.Signature != "Transfer(address,address,uint256)" || !event.Parameters[0].Indexed || event.Parameters[2].Indexed {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	// A manifest ABI survives the round trip through Ethereum form
+	manifest := ManifestABI{
+		Methods: []ABIMethod{
+			{Name: "verify", Parameters: []ABIParameter{{"key", "PublicKey"}, {"signature", "Signature"}, {"data", "Any"}}, ReturnType: "Boolean", Safe: true},
+			{Name: "main", Parameters: []ABIParameter{{"selector", "ByteArray"}, {"arguments", "Array"}}, ReturnType: "Void"},
+		},
+		Events: []ABIEvent{{Name: "Log1", Parameters: []ABIParameter{{"topic0", "Integer"}, {"data", "ByteArray"}}}},
+	}
+	converted, err := ConvertABI([]byte(`{"name": "Token", "abi": ` + mustJSON(t, manifest) + `}`))
+	if err != nil {
+		t.Fatalf("ConvertABI failed: %v", err)
+	}
+	ethereum := converted.([]StandardJSONABIEntry)
+	if ethereum[0].Inputs[0].Type != "bytes" || ethereum[0].StateMutability != "view" || len(ethereum[1].Outputs) != 0 {
+		t.Errorf("Unexpected Ethereum ABI %+v", ethereum)
+	}
+	back, err := ConvertABI([]byte(mustJSON(t, ethereum)))
+	if err != nil {
+		t.Fatalf("ConvertABI failed: %v", err)
+	}
+	if mustJSON(t, back) != mustJSON(t, manifest) {
+		t.Errorf("Expected %s after the round trip, got %s", mustJSON(t, manifest), mustJSON(t, back))
+	}
+
+	// The manifest generator accepts manifest types only
+	if _, err := manifestABI([]*ContractMethod{{Name: "f", Parameters: []MethodParameter{{Name: "x", Type: "uint256"}}}}, nil); err == nil {
+		t.Errorf("Expected an Ethereum type to be rejected")
+	}
+	if _, err := ConvertABI([]byte(`[{"type": "function", "name": "f", "inputs": [{"name": "x", "type": "fixed"}]}]`)); err == nil || !strings.Contains(err.Error(), "function f") {
+		t.Errorf("Expected an unsupported type error, got %v", err)
+	}
+}
+
+// mustJSON returns value encoded as JSON
+func mustJSON(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
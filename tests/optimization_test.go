@@ -0,0 +1,796 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestOptimizationProfileFromConfig tests goal selection from config and flags
+func TestOptimizationProfileFromConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   CompilerConfig
+		expected OptimizationGoal
+		hasError bool
+	}{
+		{
+			name:     "default",
+			config:   CompilerConfig{},
+			expected: OptimizeForGas,
+		},
+		{
+			name:     "config field",
+			config:   CompilerConfig{OptimizeFor: "size"},
+			expected: OptimizeForSize,
+		},
+		{
+			name:     "flag overrides field",
+			config:   CompilerConfig{OptimizeFor: "size", CompilerFlags: []string{"--optimize-for=gas"}},
+			expected: OptimizeForGas,
+		},
+		{
+			name:     "invalid goal",
+			config:   CompilerConfig{CompilerFlags: []string{"--optimize-for=speed"}},
+			hasError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profile, err := OptimizationProfileFromConfig(test.config)
+			if test.hasError {
+				if err == nil {
+					t.Fatalf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if profile.Goal != test.expected {
+				t.Errorf("Expected goal %s, got %s", test.expected, profile.Goal)
+			}
+		})
+	}
+
+	_, err := NewYulToNeoCompiler(CompilerConfig{OptimizeFor: "speed"}).Compile(`object "T" { code { sstore(0, 1) } }`)
+	if err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected an invalid goal to fail compilation, got %v", err)
+	}
+}
+
+// TestCompilerFlagErrors tests that malformed and unknown flags, and
+// optimization levels out of range, fail compilation
+func TestCompilerFlagErrors(t *testing.T) {
+	tests := []struct {
+		config CompilerConfig
+		err    string
+	}{
+		{CompilerConfig{OptimizationLevel: 3, CompilerFlags: []string{"--optimize-for", "size", "--canary", "--dialect=neo"}}, ""},
+		{CompilerConfig{CompilerFlags: []string{"--canary", "--optimize-for"}}, "compiler flag --optimize-for needs a value"},
+		{CompilerConfig{CompilerFlags: []string{"--optimise-for=size"}}, `unknown compiler flag "--optimise-for=size"`},
+		{CompilerConfig{CompilerFlags: []string{"--canary=yes"}}, "compiler flag --canary takes no value"},
+		{CompilerConfig{OptimizationLevel: -1}, "invalid optimization level -1 (expected 0 to 3)"},
+		{CompilerConfig{OptimizationLevel: 9}, "invalid optimization level 9 (expected 0 to 3)"},
+	}
+	for _, test := range tests {
+		errs := CompilerFlagErrors(test.config)
+		if test.err == "" {
+			if len(errs) != 0 {
+				t.Errorf("Unexpected errors for %+v: %v", test.config, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || errs[0].Error() != test.err {
+			t.Errorf("Expected %q for %+v, got %v", test.err, test.config, errs)
+		}
+	}
+
+	_, err := NewYulToNeoCompiler(CompilerConfig{CompilerFlags: []string{"--optimize-for"}}).Compile(`object "T" { code { sstore(0, 1) } }`)
+	if err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected a flag without its value to fail compilation, got %v", err)
+	}
+}
+
+// TestOptimizationProfileInliningDecisions tests the size/gas inlining cost model
+func TestOptimizationProfileInliningDecisions(t *testing.T) {
+	gas := NewOptimizationProfile(OptimizeForGas)
+	size := NewOptimizationProfile(OptimizeForSize)
+
+	// Single call site always shrinks code
+	if !size.EvaluateInlining(8, 1, 100).Inline {
+		t.Errorf("Expected size profile to inline a function called once")
+	}
+
+	// Many call sites of a medium body grow code
+	if size.EvaluateInlining(12, 10, 100).Inline {
+		t.Errorf("Expected size profile to reject inlining that grows code")
+	}
+	if !gas.EvaluateInlining(12, 10, 100).Inline {
+		t.Errorf("Expected gas profile to accept moderate growth for call savings")
+	}
+
+	// Nothing is inlined past the NEF script size limit
+	if gas.EvaluateInlining(12, 10, MaxNEFScriptSize).Inline {
+		t.Errorf("Expected inlining to be rejected at the script size limit")
+	}
+}
+
+// TestFunctionInliningPass tests inlining of single-expression functions
+func TestFunctionInliningPass(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			let x := 1
+			let y := safeAdd(x, 2)
+			function safeAdd(a, b) -> r { r := add(a, b) }
+		}
+	}`
+
+	parser := NewYulParser()
+	ast, err := parser.Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	pass := NewFunctionInliningPass(NewOptimizationProfile(OptimizeForSize))
+	ast, err = pass.Apply(ast)
+	if err != nil {
+		t.Fatalf("Inlining failed: %v", err)
+	}
+
+	if !pass.Decisions["safeAdd"].Inline {
+		t.Fatalf("Expected safeAdd to be inlined: %s", pass.Decisions["safeAdd"].Reason)
+	}
+
+	statements := ast.Objects[0].Code.Statements
+	if len(statements) != 2 {
+		t.Fatalf("Expected function definition to be removed, got %d statements", len(statements))
+	}
+
+	decl, ok := statements[1].(*YulVariableDeclaration)
+	if !ok {
+		t.Fatalf("Expected variable declaration, got %T", statements[1])
+	}
+	call, ok := decl.Value.(*YulFunctionCall)
+	if !ok || call.FunctionName.Name != "add" {
+		t.Fatalf("Expected inlined add call, got %#v", decl.Value)
+	}
+	if ident, ok := call.Arguments[0].(*YulIdentifier); !ok || ident.Name != "x" {
+		t.Errorf("Expected first argument x, got %#v", call.Arguments[0])
+	}
+}
+
+// TestDiffInstructionStreams tests the LCS-based instruction stream diff
+func TestDiffInstructionStreams(t *testing.T) {
+	a := []NeoInstruction{
+		NewPushInstruction(CreateNeoVMInteger(1)),
+		NewPushInstruction(CreateNeoVMInteger(2)),
+		NewArithmeticInstruction(ADD),
+		NewControlFlowInstruction(RET, 0),
+	}
+	b := []NeoInstruction{
+		NewPushInstruction(CreateNeoVMInteger(1)),
+		NewPushInstruction(CreateNeoVMInteger(2)),
+		NewArithmeticInstruction(SUB),
+		NewControlFlowInstruction(RET, 0),
+	}
+
+	if HasChanges(DiffInstructionStreams(a, a)) {
+		t.Errorf("Expected identical streams to have no changes")
+	}
+
+	diff := DiffInstructionStreams(a, b)
+	if !HasChanges(diff) {
+		t.Fatalf("Expected ADD/SUB difference to be reported")
+	}
+
+	kinds := ""
+	for _, d := range diff {
+		kinds += string(d.Kind)
+	}
+	if kinds != "==-+=" {
+		t.Errorf("Expected edit script ==-+=, got %s", kinds)
+	}
+
+	formatted := FormatInstructionDiff(diff, 0)
+	if !strings.Contains(formatted, "- ADD") || !strings.Contains(formatted, "+ SUB") {
+		t.Errorf("Unexpected formatted diff:\n%s", formatted)
+	}
+
+	equivalent, _, err := InstructionStreamOracle{}.Equivalent(&NeoContract{Runtime: a}, &NeoContract{Runtime: b})
+	if err != nil || equivalent {
+		t.Errorf("Expected oracle to report a difference, got equivalent=%v err=%v", equivalent, err)
+	}
+}
+
+// dropStatementsPass miscompiles by deleting every expression statement
+type dropStatementsPass struct{}
+
+func (dropStatementsPass) Name() string       { return "drop-statements" }
+func (dropStatementsPass) RequiredLevel() int { return 0 }
+
+func (dropStatementsPass) Apply(ast *YulAST) (*YulAST, error) {
+	for _, object := range ast.Objects {
+		walkBlock(object.Code, func(b *YulBlock) {
+			kept := b.Statements[:0]
+			for _, stmt := range b.Statements {
+				if _, ok := stmt.(*YulExpressionStatement); !ok {
+					kept = append(kept, stmt)
+				}
+			}
+			b.Statements = kept
+		})
+	}
+	return ast, nil
+}
+
+// TestPassBisector tests bisection of a pipeline with the execution and
+// instruction stream oracles
+func TestPassBisector(t *testing.T) {
+	source := `object "T" { code {
+		function put(a, b) -> r {
+			sstore(a, b)
+			r := add(mul(a, add(1, 1)), 3)
+		}
+	} }`
+	config := CompilerConfig{OptimizationLevel: 1, ExportFunctions: []string{"put"}}
+	passes := []OptimizationPass{NewConstantFoldingPass(), dropStatementsPass{}}
+
+	// Folding changes the code but not what it does
+	result, err := NewPassBisector(config, passes, nil).Bisect("put", source)
+	if err != nil {
+		t.Fatalf("Bisect failed: %v", err)
+	}
+	if result.Culprit != "drop-statements" || result.CulpritIndex != 1 {
+		t.Errorf("Expected drop-statements to be the culprit, got %q at %d", result.Culprit, result.CulpritIndex)
+	}
+	if !strings.Contains(result.Details, "put") {
+		t.Errorf("Expected the details to name the method, got %q", result.Details)
+	}
+
+	result, err = NewPassBisector(config, passes, InstructionStreamOracle{}).Bisect("put", source)
+	if err != nil {
+		t.Fatalf("Bisect failed: %v", err)
+	}
+	if result.CulpritIndex != 0 {
+		t.Errorf("Expected the instruction stream oracle to flag folding, got %q at %d", result.Culprit, result.CulpritIndex)
+	}
+
+	result, err = NewPassBisector(config, passes[:1], nil).Bisect("put", source)
+	if err != nil {
+		t.Fatalf("Bisect failed: %v", err)
+	}
+	if result.CulpritIndex != -1 {
+		t.Errorf("Expected no culprit for folding, got %q: %s", result.Culprit, result.Details)
+	}
+}
+
+// TestEvaluatePureBuiltin tests EVM word semantics of constant folding
+func TestEvaluatePureBuiltin(t *testing.T) {
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+	tests := []struct {
+		name     string
+		args     []*big.Int
+		expected *big.Int
+	}{
+		{"add", []*big.Int{max, big.NewInt(1)}, big.NewInt(0)},
+		{"sub", []*big.Int{big.NewInt(0), big.NewInt(1)}, max},
+		{"div", []*big.Int{big.NewInt(7), big.NewInt(0)}, big.NewInt(0)},
+		{"sdiv", []*big.Int{max, big.NewInt(1)}, max},
+		{"exp", []*big.Int{big.NewInt(2), big.NewInt(256)}, big.NewInt(0)},
+		{"slt", []*big.Int{max, big.NewInt(0)}, big.NewInt(1)},
+		{"byte", []*big.Int{big.NewInt(31), big.NewInt(0x1234)}, big.NewInt(0x34)},
+		{"shr", []*big.Int{big.NewInt(4), big.NewInt(0x100)}, big.NewInt(0x10)},
+		{"signextend", []*big.Int{big.NewInt(0), big.NewInt(0xff)}, max},
+	}
+
+	for _, test := range tests {
+		result, err := EvaluatePureBuiltin(test.name, test.args)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if result.Cmp(test.expected) != 0 {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, result)
+		}
+	}
+
+	if _, err := EvaluatePureBuiltin("sstore", []*big.Int{big.NewInt(0), big.NewInt(0)}); err == nil {
+		t.Errorf("Expected error for impure built-in")
+	}
+}
+
+// TestCompileTimeEvaluationPass tests folding of pure calls with literal arguments
+func TestCompileTimeEvaluationPass(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			let x := safeAdd(1, 2)
+			let y := spin(1)
+			function safeAdd(a, b) -> r { r := add(a, b) }
+			function spin(a) -> r {
+				for { } 1 { } { r := add(r, a) }
+			}
+		}
+	}`
+
+	parser := NewYulParser()
+	ast, err := parser.Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	pass := NewCompileTimeEvaluationPass()
+	pass.StepBudget = 500
+	ast, err = pass.Apply(ast)
+	if err != nil {
+		t.Fatalf("Evaluation failed: %v", err)
+	}
+
+	if pass.Folded != 1 {
+		t.Errorf("Expected 1 folded call, got %d", pass.Folded)
+	}
+
+	statements := ast.Objects[0].Code.Statements
+	folded, ok := statements[0].(*YulVariableDeclaration).Value.(*YulLiteral)
+	if !ok || folded.Value != "3" {
+		t.Errorf("Expected safeAdd(1, 2) to fold to 3, got %#v", statements[0].(*YulVariableDeclaration).Value)
+	}
+
+	// Non-terminating function exhausts the budget and is left alone
+	if _, ok := statements[1].(*YulVariableDeclaration).Value.(*YulFunctionCall); !ok {
+		t.Errorf("Expected spin(1) to remain a call")
+	}
+}
+
+// TestConstantFoldingPass tests folding, identities and propagation
+// through let bindings
+func TestConstantFoldingPass(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			let a := add(1, 2)
+			let b := mul(a, 4)
+			let c := calldataload(0)
+			sstore(add(mul(c, 1), 0), shl(0, b))
+			let d := 5
+			for { let i := 0 } lt(i, d) { i := add(i, 1) } { sstore(i, a) }
+			function f(a) -> r { r := sub(a, 0) }
+		}
+	}`
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	pass := NewConstantFoldingPass()
+	if _, err := pass.Apply(ast); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	statements := ast.Objects[0].Code.Statements
+	printer := NewYulPrinter("")
+	expected := []string{
+		"12",            // mul(3, 4)
+		"sstore(c, 12)", // Identities and propagation
+		"lt(i, 5)",      // The loop variable is assigned
+		"sstore(i, 3)",
+		"a", // The parameter is not the outer a
+	}
+	got := []string{
+		printer.PrintExpression(statements[1].(*YulVariableDeclaration).Value),
+		printer.PrintExpression(statements[3].(*YulExpressionStatement).Expression),
+		printer.PrintExpression(statements[5].(*YulFor).Condition),
+		printer.PrintExpression(statements[5].(*YulFor).Body.Statements[0].(*YulExpressionStatement).Expression),
+		printer.PrintExpression(statements[6].(*YulFunctionDef).Body.Statements[0].(*YulAssignment).Value),
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], got[i])
+		}
+	}
+	if pass.Folded == 0 {
+		t.Errorf("Expected folded expressions to be counted")
+	}
+}
+
+// TestUnreachableCodePass tests that statements after a terminator are
+// removed and functions defined after them are kept
+func TestUnreachableCodePass(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			sstore(0, 1)
+			return(0, 0)
+			sstore(1, 2)
+			function f(a) -> r {
+				for {} 1 {} {
+					if a { break }
+					continue
+					a := 0
+				}
+				r := a
+			}
+			sstore(2, 3)
+		}
+	}`
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	pass := NewUnreachableCodePass()
+	if _, err := pass.Apply(ast); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if pass.Removed != 3 {
+		t.Errorf("Expected 3 statements removed, got %d", pass.Removed)
+	}
+
+	statements := ast.Objects[0].Code.Statements
+	if len(statements) != 3 {
+		t.Fatalf("Expected sstore, return and f to remain, got %d statements", len(statements))
+	}
+	fn, ok := statements[2].(*YulFunctionDef)
+	if !ok {
+		t.Fatalf("Expected f to be kept, got %T", statements[2])
+	}
+	// The loop ends by its break, so r := a stays
+	if len(fn.Body.Statements) != 2 {
+		t.Errorf("Expected the loop and r := a, got %d statements", len(fn.Body.Statements))
+	}
+	if loop := fn.Body.Statements[0].(*YulFor); len(loop.Body.Statements) != 2 {
+		t.Errorf("Expected the statement after continue to be removed, got %d statements", len(loop.Body.Statements))
+	}
+}
+
+// TestCommonSubexpressionPass tests reuse of pure expressions, sloads and
+// keccak256 results until they may change
+func TestCommonSubexpressionPass(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			let key := calldataload(4)
+			let slot := keccak256(0, 64)
+			let balance := sload(slot)
+			sstore(keccak256(0, 64), add(sload(slot), 1))
+			let again := sload(slot)
+			let other := sload(7)
+			sstore(8, 1)
+			let kept := sload(7)
+			mstore(0, key)
+			let hash := keccak256(0, 64)
+			let sum := add(key, 1)
+			if iszero(key) { sstore(add(key, 1), 0) }
+			key := 2
+			let changed := add(key, 1)
+		}
+	}`
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	pass := NewCommonSubexpressionPass()
+	if _, err := pass.Apply(ast); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	printer := NewYulPrinter("")
+	statements := ast.Objects[0].Code.Statements
+	expected := map[int]string{
+		3:  "sstore(slot, add(balance, 1))", // Read before the store
+		4:  "sload(slot)",                   // Written by the sstore
+		7:  "other",                         // Another literal key
+		9:  "keccak256(0, 64)",              // Memory changed
+		11: "sstore(sum, 0)",
+		13: "add(key, 1)", // key was assigned
+	}
+	for index, want := range expected {
+		var got string
+		switch s := statements[index].(type) {
+		case *YulVariableDeclaration:
+			got = printer.PrintExpression(s.Value)
+		case *YulExpressionStatement:
+			got = printer.PrintExpression(s.Expression)
+		case *YulIf:
+			got = printer.PrintExpression(s.Body.Statements[0].(*YulExpressionStatement).Expression)
+		}
+		if got != want {
+			t.Errorf("Statement %d: expected %s, got %s", index, want, got)
+		}
+	}
+	if pass.Eliminated != 4 {
+		t.Errorf("Expected 4 eliminated expressions, got %d", pass.Eliminated)
+	}
+}
+
+// TestProfileGuidedOptimization tests feeding interpreter profiles back into the optimizer
+func TestProfileGuidedOptimization(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			for { let i := 0 } lt(i, 10) { i := add(i, 1) } {
+				switch dispatch(i)
+				case 1 { sstore(1, i) }
+				case 2 { sstore(2, i) }
+				case 3 { sstore(3, inc(i)) }
+				default { }
+			}
+			function dispatch(i) -> s { s := 3 if eq(i, 0) { s := 1 } }
+			function inc(a) -> r { r := add(a, 1) }
+		}
+	}`
+
+	parser := NewYulParser()
+	ast, err := parser.Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	interp := NewYulInterpreter(nil)
+	interp.Profile = NewExecutionProfile()
+	if err := interp.ExecuteBlock(ast.Objects[0].Code); err != nil {
+		t.Fatalf("Execution failed: %v", err)
+	}
+	if interp.Profile.Calls["inc"] != 9 {
+		t.Errorf("Expected inc to be called 9 times, got %d", interp.Profile.Calls["inc"])
+	}
+
+	// Profiles survive a JSON round trip
+	encoded, err := json.Marshal(interp.Profile)
+	if err != nil {
+		t.Fatalf("Failed to encode profile: %v", err)
+	}
+	feedback, err := ParseExecutionProfile(encoded)
+	if err != nil {
+		t.Fatalf("Failed to parse profile: %v", err)
+	}
+
+	var sw *YulSwitch
+	forBody := ast.Objects[0].Code.Statements[0].(*YulFor).Body
+	sw = forBody.Statements[0].(*YulSwitch)
+	before := ExpectedDispatchComparisons(sw, feedback)
+
+	profile := NewOptimizationProfile(OptimizeForGas)
+	profile.Feedback = feedback
+	pass := NewProfileGuidedDispatchPass(profile)
+	if _, err := pass.Apply(ast); err != nil {
+		t.Fatalf("Dispatch pass failed: %v", err)
+	}
+
+	if pass.Reordered != 1 || sw.Cases[0].Value.Value != "3" {
+		t.Errorf("Expected hottest case 3 to be moved first, got %s", sw.Cases[0].Value.Value)
+	}
+	if after := ExpectedDispatchComparisons(sw, feedback); after >= before {
+		t.Errorf("Expected fewer comparisons after reordering, %.2f -> %.2f", before, after)
+	}
+
+	// Functions that never ran are not worth growing the code for
+	static := profile.EvaluateInlining(20, 3, 100)
+	cold := profile.EvaluateFunctionInlining("unused", 20, 3, 100)
+	hot := profile.EvaluateFunctionInlining("inc", 20, 3, 100)
+	if !static.Inline || cold.Inline || !hot.Inline {
+		t.Errorf("Expected cold function to stay out of line: static=%s cold=%s hot=%s", static.Reason, cold.Reason, hot.Reason)
+	}
+
+	// A profile that cannot be read fails compilation
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	if _, err := NewYulToNeoCompiler(CompilerConfig{ProfileFeedback: missing}).Compile(source); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected a missing profile to fail compilation, got %v", err)
+	}
+}
+
+// TestFunctionSpecializationPass tests cloning functions for constant arguments
+func TestFunctionSpecializationPass(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			let x := sload(0)
+			sstore(4, checked(1, x))
+			sstore(5, checked(1, add(x, 1)))
+			sstore(1, pick(0, x, 7))
+			sstore(2, pick(0, x, 8))
+			sstore(3, pick(x, 5, 6))
+			function checked(enabled, v) -> r { r := v if iszero(enabled) { r := 0 } }
+			function pick(flag, a, b) -> r { switch flag case 0 { r := b } default { r := a } }
+		}
+	}`
+
+	parser := NewYulParser()
+	original, err := parser.Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	pass := NewFunctionSpecializationPass(nil)
+	ast, err = pass.Apply(ast)
+	if err != nil {
+		t.Fatalf("Specialization failed: %v", err)
+	}
+
+	if pass.Specialized != 4 {
+		t.Errorf("Expected 4 specialized calls, got %d", pass.Specialized)
+	}
+	if len(pass.Clones["checked"]) != 1 || len(pass.Clones["pick"]) != 2 {
+		t.Errorf("Unexpected clones %v", pass.Clones)
+	}
+
+	functions := make(map[string]*YulFunctionDef)
+	forEachFunctionDef(ast, func(fn *YulFunctionDef) { functions[fn.Name] = fn })
+	if _, ok := functions["checked"]; ok {
+		t.Errorf("Expected checked to be removed once all calls were specialized")
+	}
+	if _, ok := functions["pick"]; !ok {
+		t.Errorf("Expected pick to remain for its non-constant call")
+	}
+	if clone := functions["checked_spec1"]; clone == nil || len(clone.Parameters) != 1 || len(clone.Body.Statements) != 1 {
+		t.Errorf("Expected checked_spec1(v) without the branch, got %#v", clone)
+	}
+
+	// Specialization must not change behavior
+	run := func(ast *YulAST) *YulInterpreter {
+		interp := NewYulInterpreter(nil)
+		interp.Storage[storageKey(big.NewInt(0))] = big.NewInt(3)
+		if err := interp.ExecuteBlock(ast.Objects[0].Code); err != nil {
+			t.Fatalf("Execution failed: %v", err)
+		}
+		return interp
+	}
+	before, after := run(original), run(ast)
+	for slot := int64(1); slot <= 5; slot++ {
+		a, b := before.loadWord(big.NewInt(slot)), after.loadWord(big.NewInt(slot))
+		if a.Cmp(b) != 0 {
+			t.Errorf("Slot %d differs after specialization: %s != %s", slot, a, b)
+		}
+	}
+}
+
+func TestPriceTableOverrides(t *testing.T) {
+	prices, err := ParsePriceTable([]byte(`{
+		"execFeeFactor": 1,
+		"storagePrice": 10,
+		"opcodes": {"add": 3, "RET": 1},
+		"syscalls": {"System.Storage.Put": 100}
+	}`))
+	if err != nil {
+		t.Fatalf("ParsePriceTable failed: %v", err)
+	}
+	if prices.OpcodePrice(RET, 0) != 1 || prices.OpcodePrice(SUB, 8) != 8 {
+		t.Errorf("Expected RET overridden and SUB unchanged")
+	}
+
+	script := []NeoInstruction{
+		NewPushInstruction(CreateNeoVMByteString("value")),
+		NewPushInstruction(CreateNeoVMByteString("key")),
+		NewSyscallInstruction("System.Storage.Put"),
+		NewArithmeticInstruction(ADD),
+	}
+	estimate := prices.EstimateCost(script)
+	expectedExecution := script[0].GasCost + script[1].GasCost + 100 + 3
+	if estimate.ExecutionFee != expectedExecution {
+		t.Errorf("Expected execution fee %d, got %d", expectedExecution, estimate.ExecutionFee)
+	}
+	if estimate.StorageFee != 80 {
+		t.Errorf("Expected storage fee for 8 bytes at 10, got %d", estimate.StorageFee)
+	}
+	prices.Reprice(script)
+	if script[2].GasCost != 100 || script[3].GasCost != 3 {
+		t.Errorf("Expected repriced instructions, got %d and %d", script[2].GasCost, script[3].GasCost)
+	}
+	if price := prices.SyscallPrice("System.Storage.Get"); price != 1<<15 {
+		t.Errorf("Expected the mainnet price of System.Storage.Get, got %d", price)
+	}
+
+	// A cheap CALL makes the gas savings of inlining too small for the growth
+	profile := DefaultOptimizationProfile()
+	if decision := profile.EvaluateInlining(20, 4, 100); !decision.Inline {
+		t.Fatalf("Expected inlining at mainnet prices: %s", decision.Reason)
+	}
+	prices.Opcodes[CALL] = 2
+	profile.Prices = prices
+	if decision := profile.EvaluateInlining(20, 4, 100); decision.Inline {
+		t.Errorf("Expected no inlining with a cheap CALL: %s", decision.Reason)
+	}
+
+	for _, invalid := range []string{
+		`{"opcodes": {"NOPE": 1}}`,
+		`{"execFeeFactor": 0}`,
+		`{"syscalls": {"System.Runtime.Log": -1}}`,
+		`{"syscalls": {"Neo.Crypto.Keccak256": 1}}`,
+		`{"storagePrices": 1}`,
+	} {
+		if _, err := ParsePriceTable([]byte(invalid)); err == nil {
+			t.Errorf("Expected an error for %s", invalid)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(`{"execFeeFactor": 0}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewYulToNeoCompiler(CompilerConfig{PricingFile: path}).Compile(`object "T" { code { sstore(0, 1) } }`); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected an invalid pricing file to fail compilation, got %v", err)
+	}
+}
+
+// TestPeepholeOptimization tests operand patterns, jump targets and the
+// re-encoded jumps of optimized code
+func TestPeepholeOptimization(t *testing.T) {
+	engine := NewOptimizationEngine(2)
+	opcodes := func(instructions []NeoInstruction) []NeoOpcode {
+		ops := make([]NeoOpcode, len(instructions))
+		for i, instr := range instructions {
+			ops[i] = instr.Opcode
+		}
+		return ops
+	}
+
+	code := []NeoInstruction{
+		NewPushInstruction(CreateNeoVMInteger(1)),
+		NewPushInstruction(CreateNeoVMInteger(1000)),
+		NewStackInstruction(DROP),
+		NewStackInstruction(DUP),
+		NewStackInstruction(SWAP),
+		NewArithmeticInstruction(ADD),
+	}
+	optimized, moves := engine.OptimizeInstructions(code, nil)
+	if got := opcodes(optimized); !reflect.DeepEqual(got, []NeoOpcode{PUSH1, DUP, ADD}) {
+		t.Errorf("Expected PUSH1 DUP ADD, got %v", got)
+	}
+	if !reflect.DeepEqual(moves, []int{0, 1, 1, 1, 2, 2, 3}) {
+		t.Errorf("Unexpected moves %v", moves)
+	}
+
+	// A match cannot continue at a jump target
+	optimized, _ = engine.OptimizeInstructions(code, map[int]bool{2: true})
+	if got := opcodes(optimized); !reflect.DeepEqual(got, []NeoOpcode{PUSH1, code[1].Opcode, DROP, DUP, ADD}) {
+		t.Errorf("Expected the DROP at the target kept, got %v", got)
+	}
+
+	// The generator removes the jump to the next instruction and re-encodes
+	// the jump over it
+	g := NewCodeGenerator(&CompilerContext{SymbolTable: NewSymbolTable()})
+	g.SetPeepholeOptimizer(engine)
+	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(1)), SourcePosition{})
+	g.emitInstruction(NewControlFlowInstruction(JMPIF, 0), SourcePosition{})
+	g.addPendingLabel("end", len(g.instructions)-1)
+	g.emitInstruction(NewControlFlowInstruction(JMP, 0), SourcePosition{})
+	g.addPendingLabel("next", len(g.instructions)-1)
+	g.markLabel("next")
+	g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(7)), SourcePosition{})
+	g.emitInstruction(NewStackInstruction(DROP), SourcePosition{})
+	g.markLabel("end")
+	g.emitInstruction(NewControlFlowInstruction(RET, 0), SourcePosition{})
+	if err := g.resolveLabels(); err != nil {
+		t.Fatalf("resolveLabels failed: %v", err)
+	}
+	g.optimizeCode(0)
+	if got := opcodes(g.instructions); !reflect.DeepEqual(got, []NeoOpcode{PUSH1, JMPIF, RET}) {
+		t.Fatalf("Expected PUSH1 JMPIF RET, got %v", got)
+	}
+	if len(g.pendingLabels) != 1 || g.instructions[1].Operand[0] != 2 {
+		t.Errorf("Expected the JMPIF re-encoded to the RET, got %v", g.instructions[1].Operand)
+	}
+	if err := g.verifyStack(nil); err != nil {
+		t.Errorf("verifyStack failed: %v", err)
+	}
+
+	// Compiled contracts still assemble
+	compiler := NewYulToNeoCompiler(CompilerConfig{OptimizationLevel: 2})
+	result, err := compiler.Compile(`object "Test" { code { if calldataload(0) { sstore(0, 1) } sstore(1, 2) } }`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if _, err := result.Contract.Script(); err != nil {
+		t.Errorf("Script failed: %v", err)
+	}
+}
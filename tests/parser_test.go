@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 // TestYulParserBasicParsing tests basic parsing functionality
@@ -61,10 +65,10 @@ func TestYulParserBasicParsing(t *testing.T) {
 					t.Errorf("Expected 1 top-level object, got %d", len(ast.Objects))
 				}
 				obj := ast.Objects[0]
-				if len(obj.Objects) != 1 {
-					t.Errorf("Expected 1 nested object, got %d", len(obj.Objects))
+				if obj.Objects.Len() != 1 {
+					t.Errorf("Expected 1 nested object, got %d", obj.Objects.Len())
 				}
-				nested, exists := obj.Objects["runtime"]
+				nested, exists := obj.Objects.Get("runtime")
 				if !exists {
 					t.Errorf("Expected nested object 'runtime'")
 				}
@@ -527,6 +531,20 @@ func TestYulParserControlFlow(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name:   "block statement",
+			source: "{ let y := 1 sstore(0, y) }",
+			validate: func(stmt YulStatement) error {
+				block, ok := stmt.(*YulBlock)
+				if !ok {
+					t.Fatalf("Expected block statement, got %T", stmt)
+				}
+				if len(block.Statements) != 2 {
+					t.Errorf("Expected 2 statements in block, got %d", len(block.Statements))
+				}
+				return nil
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -748,11 +766,11 @@ func TestYulParserComplexProgram(t *testing.T) {
 	}
 
 	// Verify nested runtime object
-	if len(obj.Objects) != 1 {
-		t.Errorf("Expected 1 nested object, got %d", len(obj.Objects))
+	if obj.Objects.Len() != 1 {
+		t.Errorf("Expected 1 nested object, got %d", obj.Objects.Len())
 	}
 
-	runtime, exists := obj.Objects["runtime"]
+	runtime, exists := obj.Objects.Get("runtime")
 	if !exists {
 		t.Errorf("Expected nested object 'runtime'")
 	}
@@ -1193,4 +1211,605 @@ func TestYulParserRecovery(t *testing.T) {
 	if !strings.Contains(err.Error(), "unexpected token") {
 		t.Errorf("Expected meaningful error message, got: %s", err.Error())
 	}
-}
\ No newline at end of file
+}
+
+// TestYulParserCodeBlock tests sources that are a bare code block
+func TestYulParserCodeBlock(t *testing.T) {
+	ast, err := NewYulParser().Parse("{ let x := 1 sstore(0, x) }\nfunction g() { }")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(ast.Objects) != 1 || ast.Objects[0].Type != ObjectTypeCode || len(ast.Objects[0].Code.Statements) != 2 {
+		t.Fatalf("Expected one code object with 2 statements, got %+v", ast.Objects)
+	}
+	if len(ast.Functions) != 1 {
+		t.Errorf("Expected the top-level function, got %d", len(ast.Functions))
+	}
+	if printed := PrintYul(ast); printed != "{\n    let x := 1\n    sstore(0, x)\n}\nfunction g() { }\n" {
+		t.Errorf("Expected the code block printed bare, got %q", printed)
+	}
+
+	for _, invalid := range []string{"{ } { }", `object "a" { code { } } { }`} {
+		if _, err := NewYulParser().Parse(invalid); err == nil {
+			t.Errorf("Expected a second program to be rejected in %q", invalid)
+		}
+	}
+}
+
+// TestYulParserObjectOrder tests that nested objects keep source order
+func TestYulParserObjectOrder(t *testing.T) {
+	source := `
+	object "Outer" {
+		code { }
+		object "zeta" { code { } }
+		object "alpha" { code { } }
+		object "mid" { code { } }
+	}`
+
+	parser := NewYulParser()
+	ast, err := parser.Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	expected := []string{"zeta", "alpha", "mid"}
+	if keys := ast.Objects[0].Objects.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected nested objects %v, got %v", expected, keys)
+	}
+
+	encoded, err := json.Marshal(ast.Objects[0].Objects)
+	if err != nil {
+		t.Fatalf("Failed to encode objects: %v", err)
+	}
+	text := string(encoded)
+	if !(strings.Index(text, `"zeta"`) < strings.Index(text, `"alpha"`) &&
+		strings.Index(text, `"alpha"`) < strings.Index(text, `"mid"`)) {
+		t.Errorf("Expected JSON keys in source order, got %s", text)
+	}
+
+	decoded := NewOrderedMap[*YulObject]()
+	if err := json.Unmarshal(encoded, decoded); err != nil {
+		t.Fatalf("Failed to decode objects: %v", err)
+	}
+	if keys := decoded.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected decoded order %v, got %v", expected, keys)
+	}
+}
+
+// TestYulParserTypedIdentifiers tests type suffixes on variables, parameters, returns and literals
+func TestYulParserTypedIdentifiers(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			let x:u32, flag:bool := f(1:u32)
+			let y := 2
+			function f(a:u32) -> b:bool, c:s64 { }
+		}
+	}`
+
+	parser := NewYulParser()
+	ast, err := parser.Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	statements := ast.Objects[0].Code.Statements
+	decl := statements[0].(*YulVariableDeclaration)
+	if decl.Variables[0].Type != "uint32" || decl.Variables[1].Type != DataTypeBool {
+		t.Errorf("Expected u32 and bool variables, got %s and %s", decl.Variables[0].Type, decl.Variables[1].Type)
+	}
+	if lit := decl.Value.(*YulFunctionCall).Arguments[0].(*YulLiteral); lit.Type != "uint32" {
+		t.Errorf("Expected typed literal u32, got %s", lit.Type)
+	}
+	if untyped := statements[1].(*YulVariableDeclaration).Variables[0]; untyped.Type != DataTypeUint256 {
+		t.Errorf("Expected untyped variable to default to u256, got %s", untyped.Type)
+	}
+
+	fn := statements[2].(*YulFunctionDef)
+	if fn.Parameters[0].Type != "uint32" || fn.Returns[0].Type != DataTypeBool || fn.Returns[1].Type != "int64" {
+		t.Errorf("Unexpected function types: %s -> %s, %s", fn.Parameters[0].Type, fn.Returns[0].Type, fn.Returns[1].Type)
+	}
+	if !fn.Returns[1].Type.Signed() || fn.Returns[1].Type.BitWidth() != 64 {
+		t.Errorf("Expected s64 to be a signed 64-bit type")
+	}
+
+	if _, err := NewYulParser().Parse(`object "Test" { code { let x:u7 := 1 } }`); err == nil {
+		t.Errorf("Expected an error for unknown type u7")
+	}
+}
+
+func TestImportYulAST(t *testing.T) {
+	source := `{
+		"nodeType": "YulObject", "name": "Token",
+		"code": {"nodeType": "YulBlock", "src": "0:120:0", "statements": [
+			{"nodeType": "YulVariableDeclaration", "src": "4:16:0",
+			 "variables": [{"nodeType": "YulTypedName", "name": "x"}],
+			 "value": {"nodeType": "YulLiteral", "kind": "number", "value": "42"}},
+			{"nodeType": "YulSwitch",
+			 "expression": {"nodeType": "YulIdentifier", "name": "x"},
+			 "cases": [
+				{"nodeType": "YulCase", "value": {"nodeType": "YulLiteral", "kind": "number", "value": "1"},
+				 "body": {"nodeType": "YulBlock", "statements": []}},
+				{"nodeType": "YulCase", "value": "default",
+				 "body": {"nodeType": "YulBlock", "statements": [{"nodeType": "YulBlock", "statements": []}]}}]},
+			{"nodeType": "YulExpressionStatement", "expression": {"nodeType": "YulFunctionCall",
+			 "functionName": {"nodeType": "YulIdentifier", "name": "sstore"},
+			 "arguments": [{"nodeType": "YulLiteral", "kind": "number", "value": "0"},
+			               {"nodeType": "YulIdentifier", "name": "x"}]}}]}
+	}`
+
+	ast, err := ImportYulAST([]byte(source))
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	statements := ast.Objects[0].Code.Statements
+	decl := statements[0].(*YulVariableDeclaration)
+	if decl.Variables[0].Type != DataTypeUint256 || decl.Value.(*YulLiteral).Type != DataTypeUint256 {
+		t.Errorf("Expected u256 defaults, got %s and %s", decl.Variables[0].Type, decl.Value.(*YulLiteral).Type)
+	}
+	if decl.Location.Offset != 4 || decl.Location.Length != 16 {
+		t.Errorf("Expected location from src, got %+v", decl.Location)
+	}
+	sw := statements[1].(*YulSwitch)
+	if len(sw.Cases) != 1 || sw.Default == nil {
+		t.Errorf("Expected one case and a default, got %d cases", len(sw.Cases))
+	}
+	if _, ok := sw.Default.Statements[0].(*YulBlock); !ok {
+		t.Errorf("Expected nested block to stay a block, got %T", sw.Default.Statements[0])
+	}
+	if call := statements[2].(*YulExpressionStatement).Expression.(*YulFunctionCall); call.FunctionName.Name != "sstore" {
+		t.Errorf("Expected sstore call, got %s", call.FunctionName.Name)
+	}
+
+	malformed := `{"objects": [{"nodeType": "YulObject", "name": "T", "code": {"nodeType": "YulBlock", "statements": [
+		{"nodeType": "YulExpressionStatement", "expression": {"nodeType": "YulFunctionCall",
+		 "functionName": {"nodeType": "YulIdentifier", "name": "add"},
+		 "arguments": [{"nodeType": "YulLiteral", "value": "1"}, 7]}},
+		{"nodeType": "YulGoto"},
+		{"nodeType": "YulVariableDeclaration", "variables": [{"name": "y", "type": "u7"}]}]}}]}`
+
+	_, err = ImportYulAST([]byte(malformed))
+	importErr, ok := err.(*ASTImportError)
+	if !ok {
+		t.Fatalf("Expected ASTImportError, got %v", err)
+	}
+	expected := []string{
+		`/objects/0/code/statements/0/expression/arguments/0: missing field "kind"`,
+		`/objects/0/code/statements/0/expression/arguments/1: expected an object, got number`,
+		`/objects/0/code/statements/1/nodeType: unknown statement type "YulGoto"`,
+		`/objects/0/code/statements/2/variables/0/type:`,
+	}
+	if len(importErr.Issues) != len(expected) {
+		t.Fatalf("Expected %d issues, got %v", len(expected), importErr)
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(importErr.Issues[i].String(), prefix) {
+			t.Errorf("Issue %d: expected %q, got %q", i, prefix, importErr.Issues[i])
+		}
+	}
+
+	if _, err := ImportYulAST([]byte(`{"nodeType": "YulBlock"`)); err == nil {
+		t.Errorf("Expected an error for truncated JSON")
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(YulASTJSONSchema), &schema); err != nil {
+		t.Errorf("Published schema is not valid JSON: %v", err)
+	}
+}
+
+func TestYulParserSwitchLiteralCases(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			switch x
+			case 0x70a08231 { }
+			case "transfer" { }
+			case false { }
+			case 7:u8 { }
+		}
+	}`
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	cases := ast.Objects[0].Code.Statements[0].(*YulSwitch).Cases
+	expected := []YulLiteralKind{LiteralKindHex, LiteralKindString, LiteralKindBool, LiteralKindNumber}
+	if len(cases) != len(expected) {
+		t.Fatalf("Expected %d cases, got %d", len(expected), len(cases))
+	}
+	for i, kind := range expected {
+		if cases[i].Value.Kind != kind {
+			t.Errorf("Case %d: expected %s literal, got %s", i, kind, cases[i].Value.Kind)
+		}
+	}
+	if cases[1].Value.Value != "transfer" || cases[3].Value.Type != "uint8" {
+		t.Errorf("Unexpected case values: %q, %s", cases[1].Value.Value, cases[3].Value.Type)
+	}
+
+	if _, err := NewYulParser().Parse(`object "T" { code { switch x case 1 { } case 0x01 { } } }`); err == nil {
+		t.Errorf("Expected an error for duplicate case values")
+	}
+	if _, err := NewYulParser().Parse(`object "T" { code { switch x case y { } } }`); err == nil {
+		t.Errorf("Expected an error for a non-literal case value")
+	}
+}
+
+func TestYulParserParseError(t *testing.T) {
+	source := "object \"Test\" {\n\tcode {\n\t\tif 1 sstore(0, 1) }\n\t}\n}"
+
+	parser := NewYulParser()
+	_, err := parser.Parse(source)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected *ParseError, got %v", err)
+	}
+	if parseErr.Expected != TokenLeftBrace || parseErr.Got != TokenStorage || parseErr.Lexeme != "sstore" {
+		t.Errorf("Expected '{' and got sstore, got expected %q and %s %q", parseErr.Expected, parseErr.Got, parseErr.Lexeme)
+	}
+	if parseErr.Position.Line != 3 || parseErr.Position.Column != 8 {
+		t.Errorf("Expected line 3, column 8, got %d:%d", parseErr.Position.Line, parseErr.Position.Column)
+	}
+	if parseErr.Snippet != "\t\tif 1 sstore(0, 1) }\n\t\t     ^" {
+		t.Errorf("Unexpected snippet:\n%s", parseErr.Snippet)
+	}
+
+	// Invalid characters are unexpected tokens carrying the lexer's error
+	_, err = parser.Parse(`object "Test" { code { let x := ; } }`)
+	if !errors.As(err, &parseErr) || parseErr.Err == nil || parseErr.Code != CodeLexical {
+		t.Fatalf("Expected a lexical *ParseError, got %v", err)
+	}
+	if want := "unexpected token: unexpected character ';'"; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Expected %q, got %q", want, err.Error())
+	}
+
+	// The same parser can be reused after an error
+	if _, err := parser.Parse(`object "Test" { code { let x := 1 } }`); err != nil {
+		t.Errorf("Expected reused parser to succeed, got %v", err)
+	}
+
+	// Every truncation of a valid program fails with a syntax error, not a panic
+	valid := `object "Test" { code { function f(a, b) -> r { r := add(a, b) } switch f(1, 2) case 3 { sstore(0, 1) } default { } } }`
+	for i := 1; i < len(valid); i++ {
+		_, err := NewYulParser().Parse(valid[:i])
+		if err == nil {
+			continue
+		}
+		if strings.Contains(err.Error(), "internal parser error") {
+			t.Errorf("Parse panicked on %q: %v", valid[:i], err)
+		}
+	}
+}
+
+// TestYulParserStringLiterals tests escaped and hex string literals
+func TestYulParserStringLiterals(t *testing.T) {
+	source := "object \"T\" {\n\tcode {\n\t\tlet a := \"x\\ty\"\n\t\tlet b := hex\"00ff\"\n\t\tswitch a case hex\"41\" { } default { }\n\t}\n\tdata \"d\" \"\\u20ac\"\n}"
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	code := ast.Objects[0].Code.Statements
+	for i, want := range []string{"x\ty", "\x00\xff"} {
+		lit, ok := code[i].(*YulVariableDeclaration).Value.(*YulLiteral)
+		if !ok || lit.Kind != LiteralKindString || lit.Value != want {
+			t.Errorf("Statement %d: expected string literal %q, got %+v", i, want, code[i].(*YulVariableDeclaration).Value)
+		}
+	}
+	if value := code[2].(*YulSwitch).Cases[0].Value; value.Kind != LiteralKindString || value.Value != "A" {
+		t.Errorf("Expected case hex\"41\" to be the string \"A\", got %+v", value)
+	}
+	if data, _ := ast.Objects[0].Data.Get("d"); data == nil || data.Value != "€" {
+		t.Errorf("Expected data segment €, got %+v", data)
+	}
+
+	// Carets line up under characters, not bytes
+	_, err = NewYulParser().Parse("object \"T\" { code { let é := \"€\" := } }")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected *ParseError, got %v", err)
+	}
+	if parseErr.Position.Column != 34 || !strings.HasSuffix(parseErr.Snippet, "\n"+strings.Repeat(" ", 33)+"^") {
+		t.Errorf("Expected an error at column 34, got %d:\n%s", parseErr.Position.Column, parseErr.Snippet)
+	}
+}
+
+// TestYulParserParseReader tests parsing a source streamed from a reader
+func TestYulParserParseReader(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			function f(a, b) -> r { r := add(a, b) }
+			let x, y := f(1, 2)
+			x, y := f(y, x)
+			sstore(x, y)
+			pop(f(3, 4))
+		}
+	}`
+
+	parser := NewYulParser()
+	expected, err := parser.Parse(source)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	ast, err := parser.ParseReader(iotest.OneByteReader(strings.NewReader(source)))
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	if !reflect.DeepEqual(ast, expected) {
+		t.Error("Expected the AST of the streamed source to equal that of the string")
+	}
+
+	// Errors carry the same position and snippet
+	invalid := "object \"Test\" {\n\tcode {\n\t\tif 1 sstore(0, 1) }\n\t}\n}"
+	for _, source := range []string{invalid, "object \"Test\" {\n\tcode { let x := 1 ~ }\n}"} {
+		_, stringErr := parser.Parse(source)
+		_, readerErr := parser.ParseReader(strings.NewReader(source))
+		var want, got *ParseError
+		if !errors.As(stringErr, &want) || !errors.As(readerErr, &got) {
+			t.Fatalf("Expected *ParseError, got %v and %v", stringErr, readerErr)
+		}
+		if got.Error() != want.Error() || got.Position != want.Position || got.Snippet != want.Snippet {
+			t.Errorf("Expected %v with snippet\n%s\ngot %v with snippet\n%s", want, want.Snippet, got, got.Snippet)
+		}
+	}
+}
+
+func TestYulASTJSONRoundTrip(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			function f(a:u32, b) -> r:bool {
+				for { let i := 0 } lt(i, a) { i := add(i, 1) } {
+					if eq(i, b) { leave }
+					switch i
+					case 0x01 { continue }
+					case "two" { break }
+					default { }
+				}
+				r := true
+			}
+			let x, y
+			x, y := g()
+			sstore(0, f(1, 2))
+			{ let z := x }
+		}
+		object "Runtime" {
+			code { }
+		}
+	}`
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	var saved bytes.Buffer
+	if err := SaveYulAST(&saved, ast); err != nil {
+		t.Fatalf("SaveYulAST failed: %v", err)
+	}
+	loaded, err := LoadYulAST(bytes.NewReader(saved.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadYulAST failed: %v", err)
+	}
+
+	var resaved bytes.Buffer
+	if err := SaveYulAST(&resaved, loaded); err != nil {
+		t.Fatalf("SaveYulAST of loaded AST failed: %v", err)
+	}
+	if saved.String() != resaved.String() {
+		t.Errorf("Round trip changed the AST:\n%s\nvs\n%s", saved.String(), resaved.String())
+	}
+
+	statements := loaded.Objects[0].Code.Statements
+	fn, ok := statements[0].(*YulFunctionDef)
+	if !ok {
+		t.Fatalf("Expected function definition, got %T", statements[0])
+	}
+	loop := fn.Body.Statements[0].(*YulFor)
+	sw := loop.Body.Statements[1].(*YulSwitch)
+	if _, ok := sw.Cases[0].Body.Statements[0].(*YulContinue); !ok || sw.Cases[1].Value.Kind != LiteralKindString {
+		t.Errorf("Expected switch cases to survive the round trip")
+	}
+	if fn.Parameters[0].Type != "uint32" || fn.Returns[0].Type != DataTypeBool {
+		t.Errorf("Expected typed names to survive the round trip")
+	}
+	call := statements[3].(*YulExpressionStatement).Expression.(*YulFunctionCall)
+	if _, ok := call.Arguments[1].(*YulFunctionCall); !ok {
+		t.Errorf("Expected nested call argument, got %T", call.Arguments[1])
+	}
+	if block, ok := statements[4].(*YulBlock); !ok || len(block.Statements) != 1 {
+		t.Errorf("Expected nested block to survive the round trip, got %T", statements[4])
+	}
+	if decl := statements[1].(*YulVariableDeclaration); decl.Value != nil {
+		t.Errorf("Expected declaration without value to load a nil value")
+	}
+	if _, ok := loaded.Objects[0].Objects.Get("Runtime"); !ok {
+		t.Errorf("Expected nested object to survive the round trip")
+	}
+
+	if _, err := LoadYulAST(strings.NewReader(`{"objects": [{"name": "T", "code": {"statements": [{"node_type": "Goto"}]}}]}`)); err == nil {
+		t.Errorf("Expected an error for an unknown node type")
+	}
+	if _, err := LoadYulAST(strings.NewReader(`{"objects": [{"name": "T", "code": {"statements": [{"location": {}}]}}]}`)); err == nil {
+		t.Errorf("Expected an error for an untagged node")
+	}
+}
+
+func TestPrintYulRoundTrip(t *testing.T) {
+	source := `
+	object "Test" {
+		code {
+			function f(a:u32, b) -> r:bool {
+				for { let i := 0 } lt(i, a) { i := add(i, 1) } {
+					if eq(i, b) { leave }
+					switch i
+					case 0x01 { continue }
+					case "two" { break }
+					default { }
+				}
+				r := true
+			}
+			let x:s64, y := g()
+			x := 7:u8
+			{ }
+			sstore(0, f(1, 2))
+			{ let z := x }
+		}
+		object "Runtime" {
+			code { }
+			data "payload" "text"
+			data "table" hex"00ff"
+			data "escaped" "a\"b\\c\n\x00é"
+		}
+	}
+	function helper() { }`
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	printed := PrintYul(ast)
+
+	reparsed, err := NewYulParser().Parse(printed)
+	if err != nil {
+		t.Fatalf("Printed source does not parse: %v\n%s", err, printed)
+	}
+	if again := PrintYul(reparsed); again != printed {
+		t.Errorf("Printing is not stable:\n%s\nthen:\n%s", printed, again)
+	}
+
+	for _, want := range []string{
+		"function f(a:u32, b) -> r:bool {",
+		"for { let i := 0 } lt(i, a) { i := add(i, 1) } {",
+		"case \"two\" {",
+		`data "escaped" "a\"b\\c\n\x00é"`,
+		"let x:s64, y := g()",
+		"x := 7:u8",
+		"data \"payload\" \"text\"",
+		"data \"table\" hex\"00ff\"",
+		"function helper() { }",
+		"        { }\n        sstore(0, f(1, 2))",
+		"        {\n            let z := x\n        }",
+	} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, printed)
+		}
+	}
+
+	tabs := NewYulPrinter("\t").Print(ast)
+	if !strings.Contains(tabs, "\n\tcode {\n\t\tfunction f(") {
+		t.Errorf("Expected tab indentation, got:\n%s", tabs)
+	}
+}
+
+func TestYulParserDataSegments(t *testing.T) {
+	source := `object "Test" {
+		code { }
+		data "greeting" "hello"
+		data "table" hex"00ff"
+	}`
+
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	data := ast.Objects[0].Data
+	if data.Len() != 2 {
+		t.Fatalf("Expected 2 data segments, got %d", data.Len())
+	}
+	greeting, _ := data.Get("greeting")
+	if greeting.Kind != LiteralKindString || greeting.Value != "hello" {
+		t.Errorf("Expected string segment, got %+v", greeting)
+	}
+	table, _ := data.Get("table")
+	if payload, err := table.Bytes(); err != nil || table.Kind != LiteralKindHex || string(payload) != "\x00\xff" {
+		t.Errorf("Expected hex segment 00ff, got %+v (%v)", table, err)
+	}
+
+	for _, invalid := range []string{
+		`object "T" { data "a" hex"0g" }`,
+		`object "T" { data "a" hex"abc" }`,
+		`object "T" { data "a" "x" data "a" "y" }`,
+		`object "T" { data "a" }`,
+	} {
+		if _, err := NewYulParser().Parse(invalid); err == nil {
+			t.Errorf("Expected error for %s", invalid)
+		}
+	}
+}
+
+// TestYulParserDialects tests the builtins each dialect accepts
+func TestYulParserDialects(t *testing.T) {
+	dialect := func(name string) *Dialect {
+		d, err := DialectByName(name)
+		if err != nil {
+			t.Fatalf("Unexpected error for dialect %s: %v", name, err)
+		}
+		return d
+	}
+	tests := []struct {
+		dialect string
+		source  string
+		err     string
+	}{
+		{DialectCancun, `{ tstore(0, mcopy(0, 32, 32)) }`, ""},
+		{DialectShanghai, `{ let x := 1
+  tstore(0, x) }`, "tstore is not a builtin of the shanghai dialect (added in cancun) at line 2, column 3"},
+		{DialectShanghai, `{ function tload(k) -> v { } pop(tload(0)) }`, ""},
+		{DialectNeo, `{ pop(sha256(0)) }`, ""},
+		{DialectCancun, `{ pop(sha256(0)) }`, "sha256 is not a builtin of the cancun dialect (a Neo builtin of the neo dialect)"},
+		{"paris", `{ pop(difficulty()) }`, "difficulty is not a builtin of the paris dialect (removed in paris, use prevrandao)"},
+		{"london", `{ pop(difficulty()) }`, "difficulty is not supported on Neo (blocks have no difficulty)"},
+		{"istanbul", `{ pop(basefee()) }`, "(added in london)"},
+		{"homestead", `{ revert(0, 0) }`, "(added in byzantium)"},
+		{DialectShanghai, `{ pop(not_a_builtin()) }`, ""}, // Left to code generation
+		{DialectNeo, `{ pop(extcodesize(0))
+  pop(basefee()) }`, "basefee is not supported on Neo (blocks have no base fee) at line 2, column 7"},
+		{DialectNeo, `{ extcodecopy(0, 0, 0, 32) }`, "extcodecopy is not supported on Neo"},
+		{DialectNeo, `{ pop(codesize()) }`, "codesize is not supported on Neo"},
+		{DialectNeo, `{ pop(callcode(0, 0, 0, 0, 0, 0, 0)) }`, "callcode is not supported on Neo"},
+		{DialectNeo, `{ function codesize() -> s { } pop(codesize()) }`, ""},
+		{DialectNeo, `{ pop(extcodehash(0)) pop(prevrandao()) invalid() }`, ""},
+	}
+	for _, test := range tests {
+		parser := NewYulParser()
+		parser.SetDialect(dialect(test.dialect))
+		_, err := parser.Parse(`object "T" { code ` + test.source + ` }`)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error for %s: %v", test.dialect, test.source, err)
+			}
+			continue
+		}
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q for %s, got %v", test.dialect, test.err, test.source, err)
+		}
+	}
+
+	// The lexer only classifies builtins of the dialect
+	lexer := NewYulLexer()
+	for name, want := range map[string]TokenType{"london": TokenEnvironment, "istanbul": TokenIdentifier} {
+		lexer.dialect = dialect(name)
+		lexer.Init("basefee")
+		if tokens, err := lexer.ScanTokens(); err != nil || tokens[0].Type != want {
+			t.Errorf("%s: expected basefee to be %s, got %v (%v)", name, want, tokens, err)
+		}
+	}
+
+	if d := dialect(""); d.Name != DialectNeo || !d.IsBuiltin("tload") || !d.IsBuiltin("sha256") || d.IsBuiltin("difficulty") {
+		t.Errorf("Expected the default dialect to be cancun with Neo builtins, got %s", d.Name)
+	}
+	if d := dialect("Cancun"); d.Name != DialectCancun {
+		t.Errorf("Expected dialect names to ignore case, got %s", d.Name)
+	}
+	if _, err := DialectByName("frontier2"); err == nil {
+		t.Error("Expected an error for an unknown dialect")
+	}
+	d, err := DialectFromConfig(CompilerConfig{Dialect: DialectCancun, CompilerFlags: []string{"--dialect=shanghai"}})
+	if err != nil || d.Name != DialectShanghai {
+		t.Errorf("Expected --dialect to override the configured dialect, got %v (%v)", d, err)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// Time-travel debugging for the Yul interpreter.
+//
+// While a journal is attached the interpreter records every change it makes
+// to its state (call frames, scopes, variables and storage) as a delta that
+// knows how to undo itself. Statement boundaries are marked in the delta
+// stream, so a TimeTravelDebugger can replay the execution forwards and
+// backwards one statement at a time without re-running the program.
+
+// DeltaKind identifies the state change recorded by a StateDelta
+type DeltaKind int
+
+const (
+	DeltaFrameEnter DeltaKind = iota // New call frame with one empty scope
+	DeltaFrameExit                   // Call frame discarded
+	DeltaScopeEnter                  // New empty scope in the current frame
+	DeltaScopeExit                   // Innermost scope of the current frame discarded
+	DeltaVariable                    // Variable declared or assigned
+	DeltaStorage                     // Storage slot written
+)
+
+// StateDelta is a single reversible change to interpreter state
+type StateDelta struct {
+	Kind  DeltaKind
+	Scope int      // Scope index within the current frame (DeltaVariable)
+	Name  string   // Variable name or storage key
+	Old   *big.Int // Previous value, nil if the variable or slot did not exist
+	New   *big.Int
+
+	// Contents of the discarded frame or scope, needed to undo an exit
+	Saved []map[string]*big.Int
+}
+
+// TraceStep marks the start of a statement in the delta stream
+type TraceStep struct {
+	Location   SourcePosition
+	Statement  YulNodeType
+	Depth      int // Call depth at which the statement runs
+	FirstDelta int // Index of the first delta recorded by this statement
+}
+
+// ExecutionJournal is the recorded history of one interpreter run
+type ExecutionJournal struct {
+	Steps  []TraceStep
+	Deltas []StateDelta
+}
+
+// NewExecutionJournal creates an empty journal
+func NewExecutionJournal() *ExecutionJournal {
+	return &ExecutionJournal{}
+}
+
+// storageKey formats a storage slot as a fixed-width hex word
+func storageKey(slot *big.Int) string {
+	return fmt.Sprintf("%064x", slot)
+}
+
+func copyScopes(scopes []map[string]*big.Int) []map[string]*big.Int {
+	copied := make([]map[string]*big.Int, len(scopes))
+	for i, scope := range scopes {
+		copied[i] = make(map[string]*big.Int, len(scope))
+		for name, value := range scope {
+			copied[i][name] = value
+		}
+	}
+	return copied
+}
+
+// Journal hooks used by the interpreter; all are no-ops without a journal
+
+func (in *YulInterpreter) recordStep(stmt YulStatement) {
+	if in.Journal == nil {
+		return
+	}
+	in.Journal.Steps = append(in.Journal.Steps, TraceStep{
+		Location:   stmt.GetLocation(),
+		Statement:  stmt.GetType(),
+		Depth:      in.depth,
+		FirstDelta: len(in.Journal.Deltas),
+	})
+}
+
+func (in *YulInterpreter) recordDelta(delta StateDelta) {
+	if in.Journal != nil {
+		in.Journal.Deltas = append(in.Journal.Deltas, delta)
+	}
+}
+
+func (in *YulInterpreter) recordFrameExit() {
+	if in.Journal != nil {
+		in.recordDelta(StateDelta{Kind: DeltaFrameExit, Saved: copyScopes(in.scopes)})
+	}
+}
+
+func (in *YulInterpreter) recordScopeExit() {
+	if in.Journal != nil {
+		in.recordDelta(StateDelta{Kind: DeltaScopeExit, Saved: copyScopes(in.scopes[len(in.scopes)-1:])})
+	}
+}
+
+// TimeTravelDebugger navigates a recorded execution. Its position is the
+// index of the statement about to run; position len(Steps) is the state
+// after the program finished.
+type TimeTravelDebugger struct {
+	journal  *ExecutionJournal
+	position int
+	applied  int // Number of deltas applied to reach position
+	frames   [][]map[string]*big.Int
+	storage  map[string]*big.Int
+}
+
+// NewTimeTravelDebugger creates a debugger positioned before the first statement
+func NewTimeTravelDebugger(journal *ExecutionJournal) *TimeTravelDebugger {
+	d := &TimeTravelDebugger{
+		journal: journal,
+		storage: make(map[string]*big.Int),
+	}
+	d.moveTo(d.deltaIndex(0))
+	return d
+}
+
+// Position returns the index of the statement about to run
+func (d *TimeTravelDebugger) Position() int {
+	return d.position
+}
+
+// Len returns the number of recorded statements
+func (d *TimeTravelDebugger) Len() int {
+	return len(d.journal.Steps)
+}
+
+// Current returns the statement about to run, or false at the end of the run
+func (d *TimeTravelDebugger) Current() (TraceStep, bool) {
+	if d.position >= len(d.journal.Steps) {
+		return TraceStep{}, false
+	}
+	return d.journal.Steps[d.position], true
+}
+
+// StepForward executes one statement. It returns false at the end of the run.
+func (d *TimeTravelDebugger) StepForward() bool {
+	if d.position >= len(d.journal.Steps) {
+		return false
+	}
+	return d.Seek(d.position + 1)
+}
+
+// StepBackward undoes one statement. It returns false at the start of the run.
+func (d *TimeTravelDebugger) StepBackward() bool {
+	if d.position == 0 {
+		return false
+	}
+	return d.Seek(d.position - 1)
+}
+
+// Seek moves to the given statement index in either direction
+func (d *TimeTravelDebugger) Seek(position int) bool {
+	if position < 0 || position > len(d.journal.Steps) {
+		return false
+	}
+	d.moveTo(d.deltaIndex(position))
+	d.position = position
+	return true
+}
+
+// Lookup returns the value of a variable visible in the current frame
+func (d *TimeTravelDebugger) Lookup(name string) (*big.Int, bool) {
+	if len(d.frames) == 0 {
+		return nil, false
+	}
+	scopes := d.frames[len(d.frames)-1]
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if value, ok := scopes[i][name]; ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// Variables returns the variables visible in the current frame
+func (d *TimeTravelDebugger) Variables() map[string]*big.Int {
+	variables := make(map[string]*big.Int)
+	if len(d.frames) == 0 {
+		return variables
+	}
+	for _, scope := range d.frames[len(d.frames)-1] {
+		for name, value := range scope {
+			variables[name] = value
+		}
+	}
+	return variables
+}
+
+// Storage returns the value of a storage slot at the current position
+func (d *TimeTravelDebugger) Storage(slot *big.Int) *big.Int {
+	if value, ok := d.storage[storageKey(slot)]; ok {
+		return value
+	}
+	return big.NewInt(0)
+}
+
+// StorageKeys returns the written storage slots in key order
+func (d *TimeTravelDebugger) StorageKeys() []string {
+	keys := make([]string, 0, len(d.storage))
+	for key := range d.storage {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CallDepth returns the number of active call frames
+func (d *TimeTravelDebugger) CallDepth() int {
+	return len(d.frames)
+}
+
+// FindStorageWrite returns the index of the first statement that writes slot,
+// or -1 if it is never written. Seeking to the result and stepping forward
+// shows the write happening.
+func (d *TimeTravelDebugger) FindStorageWrite(slot *big.Int) int {
+	key := storageKey(slot)
+	for i, delta := range d.journal.Deltas {
+		if delta.Kind == DeltaStorage && delta.Name == key {
+			return d.stepOfDelta(i)
+		}
+	}
+	return -1
+}
+
+// deltaIndex returns the number of deltas recorded before statement position
+func (d *TimeTravelDebugger) deltaIndex(position int) int {
+	if position < len(d.journal.Steps) {
+		return d.journal.Steps[position].FirstDelta
+	}
+	return len(d.journal.Deltas)
+}
+
+// stepOfDelta returns the statement that recorded delta index
+func (d *TimeTravelDebugger) stepOfDelta(index int) int {
+	steps := d.journal.Steps
+	return sort.Search(len(steps), func(i int) bool { return steps[i].FirstDelta > index }) - 1
+}
+
+func (d *TimeTravelDebugger) moveTo(target int) {
+	for d.applied < target {
+		d.apply(d.journal.Deltas[d.applied])
+		d.applied++
+	}
+	for d.applied > target {
+		d.applied--
+		d.undo(d.journal.Deltas[d.applied])
+	}
+}
+
+func (d *TimeTravelDebugger) apply(delta StateDelta) {
+	switch delta.Kind {
+	case DeltaFrameEnter:
+		d.frames = append(d.frames, []map[string]*big.Int{make(map[string]*big.Int)})
+	case DeltaFrameExit:
+		d.frames = d.frames[:len(d.frames)-1]
+	case DeltaScopeEnter:
+		top := len(d.frames) - 1
+		d.frames[top] = append(d.frames[top], make(map[string]*big.Int))
+	case DeltaScopeExit:
+		top := len(d.frames) - 1
+		d.frames[top] = d.frames[top][:len(d.frames[top])-1]
+	case DeltaVariable:
+		d.frames[len(d.frames)-1][delta.Scope][delta.Name] = delta.New
+	case DeltaStorage:
+		d.storage[delta.Name] = delta.New
+	}
+}
+
+func (d *TimeTravelDebugger) undo(delta StateDelta) {
+	switch delta.Kind {
+	case DeltaFrameEnter:
+		d.frames = d.frames[:len(d.frames)-1]
+	case DeltaFrameExit:
+		d.frames = append(d.frames, copyScopes(delta.Saved))
+	case DeltaScopeEnter:
+		top := len(d.frames) - 1
+		d.frames[top] = d.frames[top][:len(d.frames[top])-1]
+	case DeltaScopeExit:
+		top := len(d.frames) - 1
+		d.frames[top] = append(d.frames[top], copyScopes(delta.Saved)[0])
+	case DeltaVariable:
+		scope := d.frames[len(d.frames)-1][delta.Scope]
+		if delta.Old == nil {
+			delete(scope, delta.Name)
+		} else {
+			scope[delta.Name] = delta.Old
+		}
+	case DeltaStorage:
+		if delta.Old == nil {
+			delete(d.storage, delta.Name)
+		} else {
+			d.storage[delta.Name] = delta.Old
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// Transactions.
+//
+// A Neo N3 transaction runs a script, paying the system fee for its
+// execution and the network fee for its size and witness checks, both in
+// datoshi (10^-8 GAS):
+//
+//	version         byte     0
+//	nonce           uint32
+//	systemFee       int64
+//	networkFee      int64
+//	validUntilBlock uint32   last block the transaction may be included in
+//	signers         vararray account and witness scope
+//	attributes      vararray
+//	script          varbytes
+//	witnesses       vararray invocation and verification script of each signer
+//
+// Its hash is the SHA-256 of everything before the witnesses, displayed
+// reversed. Each signer signs the network magic followed by the hash.
+
+// Witness scopes
+const (
+	WitnessNone          byte = 0x00
+	WitnessCalledByEntry byte = 0x01
+	WitnessGlobal        byte = 0x80
+)
+
+// witnessScopeNames are the names of the witness scopes in RPC requests
+var witnessScopeNames = map[byte]string{
+	WitnessNone:          "None",
+	WitnessCalledByEntry: "CalledByEntry",
+	WitnessGlobal:        "Global",
+}
+
+// TransactionSigner is an account whose witness the transaction carries
+type TransactionSigner struct {
+	Account Uint160
+	Scopes  byte
+}
+
+// TransactionWitness proves a signer: the invocation script pushes the
+// signature the verification script checks
+type TransactionWitness struct {
+	Invocation   []byte
+	Verification []byte
+}
+
+// Transaction is a Neo N3 transaction without attributes
+type Transaction struct {
+	Nonce           uint32
+	SystemFee       int64
+	NetworkFee      int64
+	ValidUntilBlock uint32
+	Signers         []TransactionSigner
+	Script          []byte
+	Witnesses       []TransactionWitness
+}
+
+// unsigned serializes the transaction without its witnesses
+func (tx *Transaction) unsigned() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(0) // Version
+	binary.Write(&buf, binary.LittleEndian, tx.Nonce)
+	binary.Write(&buf, binary.LittleEndian, tx.SystemFee)
+	binary.Write(&buf, binary.LittleEndian, tx.NetworkFee)
+	binary.Write(&buf, binary.LittleEndian, tx.ValidUntilBlock)
+	writeVarInt(&buf, uint64(len(tx.Signers)))
+	for _, signer := range tx.Signers {
+		buf.Write(scriptOrder(signer.Account))
+		buf.WriteByte(signer.Scopes)
+	}
+	writeVarInt(&buf, 0) // Attributes
+	writeVarBytes(&buf, tx.Script)
+	return buf.Bytes()
+}
+
+// Bytes serializes the transaction
+func (tx *Transaction) Bytes() []byte {
+	buf := bytes.NewBuffer(tx.unsigned())
+	writeVarInt(buf, uint64(len(tx.Witnesses)))
+	for _, witness := range tx.Witnesses {
+		writeVarBytes(buf, witness.Invocation)
+		writeVarBytes(buf, witness.Verification)
+	}
+	return buf.Bytes()
+}
+
+// Hash returns the displayed hash of the transaction
+func (tx *Transaction) Hash() string {
+	hash := sha256.Sum256(tx.unsigned())
+	reverseBytes(hash[:])
+	return fmt.Sprintf("0x%x", hash)
+}
+
+// Sign sets the witness of the signer account for network, leaving an
+// empty witness for every other signer
+func (tx *Transaction) Sign(account *Account, network uint32) error {
+	hash := sha256.Sum256(tx.unsigned())
+	data := binary.LittleEndian.AppendUint32(nil, network)
+	signature, err := account.Sign(append(data, hash[:]...))
+	if err != nil {
+		return err
+	}
+	invocation, err := assembleScript([]NeoInstruction{NewPushInstruction(CreateNeoVMByteString(signature))})
+	if err != nil {
+		return err
+	}
+	tx.setWitness(account, invocation)
+	return nil
+}
+
+// setWitness sets the witness of the signer account with invocation
+func (tx *Transaction) setWitness(account *Account, invocation []byte) {
+	if len(tx.Witnesses) != len(tx.Signers) {
+		tx.Witnesses = make([]TransactionWitness, len(tx.Signers))
+	}
+	for i, signer := range tx.Signers {
+		if signer.Account == account.ScriptHash() {
+			tx.Witnesses[i] = TransactionWitness{Invocation: invocation, Verification: account.VerificationScript()}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import "fmt"
+
+// Transient storage.
+//
+// Cancun's tload and tstore read and write storage that is discarded at
+// the end of the transaction. Neo has no such storage, so the words live in
+// a NeoVM Map in a static field, created empty when the script or a method
+// stub starts, and keyed by slot; tload of a slot never written is 0.
+//
+// Transient storage therefore lasts for one invocation of the contract
+// rather than for the transaction: NeoVM gives every call of a contract
+// its own static fields, so a contract called again, by another contract
+// or through a reentrant call, starts with empty transient storage. Code
+// relying on transient storage across calls, such as a reentrancy lock,
+// must keep the value in storage instead. A lock in transient storage
+// protects nothing, so every tload and tstore draws a warning.
+
+// transientBuiltins are the built-ins that access transient storage
+var transientBuiltins = map[string]bool{"tload": true, "tstore": true}
+
+// transientLoad is the routine behind tload
+const transientLoad = "transient_load"
+
+// usesTransientStorage reports whether block, including its functions,
+// calls a transient storage built-in
+func usesTransientStorage(block *YulBlock) bool {
+	used := false
+	walkBlock(block, func(b *YulBlock) {
+		for _, stmt := range b.Statements {
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(expr YulExpression) {
+					if call, ok := expr.(*YulFunctionCall); ok && transientBuiltins[call.FunctionName.Name] {
+						used = true
+					}
+				})
+			}
+		}
+	})
+	return used
+}
+
+// emitTransientInit creates the empty transient storage
+func (g *CodeGenerator) emitTransientInit(location SourcePosition) {
+	g.emitInstruction(NewArithmeticInstruction(NEWMAP), location)
+	g.emitInstruction(NewSlotInstruction(STSFLD, g.memory.transient), location)
+}
+
+// generateTransientBuiltin emits a transient storage built-in with its
+// arguments on the stack, first on top, and reports whether name is one
+func (g *CodeGenerator) generateTransientBuiltin(name string, location SourcePosition) bool {
+	c := memoryCode{g, location}
+	if transientBuiltins[name] {
+		g.warn(fmt.Sprintf("%s at line %d uses transient storage, which lasts for one invocation rather than the transaction and cannot hold a reentrancy lock", name, location.Line), location)
+	}
+	switch name {
+	case "tload":
+		g.emitMemoryCall(transientLoad, 1, 1, location)
+	case "tstore":
+		// value slot -> map slot value
+		c.op(NewSlotInstruction(LDSFLD, g.memory.transient))
+		c.op(NewStackInstruction(REVERSE3))
+		c.op(NewArithmeticInstruction(SETITEM))
+	default:
+		return false
+	}
+	return true
+}
+
+// emitTransientLoad returns the word in a transient slot, 0 when it was
+// never written. Argument: the slot.
+func (g *CodeGenerator) emitTransientLoad(location SourcePosition) {
+	c := memoryCode{g, location}
+	found := g.createUniqueLabel("transient_found")
+	c.op(NewSlotInstruction(LDSFLD, g.memory.transient))
+	c.arg(0)
+	c.arithmetic(HASKEY)
+	c.jump(JMPIF, found)
+	c.push(0)
+	c.op(NewControlFlowInstruction(RET, 0))
+	g.markLabel(found)
+	c.op(NewSlotInstruction(LDSFLD, g.memory.transient))
+	c.arg(0)
+	c.arithmetic(PICKITEM)
+}
@@ -0,0 +1,153 @@
+package main
+
+import "math/big"
+
+// Unreachable code.
+//
+// A statement is unreachable when no path of the control flow graph leads
+// from the entry of its body to it: it follows a revert, return, leave,
+// break or continue, or a loop whose condition is a nonzero constant and
+// that has no break. Edges whose condition is a constant zero are not
+// taken, so the body of if 0 is unreachable too. Functions defined after
+// such a statement are still callable and are not part of it.
+
+// unreachableCode is the first unreachable statement of a block; the
+// statements after it are unreachable as well
+type unreachableCode struct {
+	block *YulBlock
+	index int
+}
+
+// findUnreachableCode lists the unreachable code of every body of the AST
+func findUnreachableCode(ast *YulAST, cfg *ControlFlowGraph) []unreachableCode {
+	outgoing := make(map[*CFGNode][]*CFGEdge)
+	for _, edge := range cfg.Edges {
+		outgoing[edge.From] = append(outgoing[edge.From], edge)
+	}
+	nodes := make(map[YulStatement]*CFGNode)
+	for _, node := range cfg.Nodes {
+		if node.Statement != nil {
+			nodes[node.Statement] = node
+		}
+	}
+
+	var found []unreachableCode
+	for i, body := range controlFlowBodies(ast) {
+		reachable := map[*CFGNode]bool{cfg.Entries[i]: true}
+		queue := []*CFGNode{cfg.Entries[i]}
+		for len(queue) > 0 {
+			node := queue[0]
+			queue = queue[1:]
+			for _, edge := range outgoing[node] {
+				if value, ok := evaluateConstant(edge.Condition); ok && value.Sign() == 0 {
+					continue
+				}
+				if !reachable[edge.To] {
+					reachable[edge.To] = true
+					queue = append(queue, edge.To)
+				}
+			}
+		}
+
+		// entered reports whether execution may reach the start of stmt
+		var entered func(stmt YulStatement) bool
+		entered = func(stmt YulStatement) bool {
+			if loop, ok := stmt.(*YulFor); ok && loop.Init != nil {
+				for _, init := range loop.Init.Statements {
+					if _, ok := init.(*YulFunctionDef); !ok {
+						return entered(init)
+					}
+				}
+			}
+			node, ok := nodes[stmt]
+			return !ok || reachable[node]
+		}
+		var visit func(block *YulBlock)
+		visit = func(block *YulBlock) {
+			if block == nil {
+				return
+			}
+			for index, stmt := range block.Statements {
+				if _, ok := stmt.(*YulFunctionDef); ok {
+					continue
+				}
+				if !entered(stmt) {
+					found = append(found, unreachableCode{block: block, index: index})
+					return
+				}
+				for _, nested := range statementBlocks(stmt) {
+					visit(nested)
+				}
+			}
+		}
+		visit(body.block)
+	}
+	return found
+}
+
+// unreachableCodeWarnings reports the first statement of each unreachable
+// run of statements
+func (sa *StaticAnalyzer) unreachableCodeWarnings(ast *YulAST, cfg *ControlFlowGraph) []CompilerWarning {
+	var warnings []CompilerWarning
+	for _, code := range findUnreachableCode(ast, cfg) {
+		location := code.block.Statements[code.index].GetLocation()
+		warnings = append(warnings, dataFlowWarning(CodeUnreachableCode, location, "unreachable code"))
+	}
+	return warnings
+}
+
+// evaluateConstant evaluates expr when it is a literal or a pure built-in of
+// constants
+func evaluateConstant(expr YulExpression) (*big.Int, bool) {
+	switch e := expr.(type) {
+	case *YulLiteral:
+		value, err := ParseYulLiteralValue(e)
+		return value, err == nil
+	case *YulFunctionCall:
+		if !isPureBuiltin(e.FunctionName.Name) {
+			return nil, false
+		}
+		args := make([]*big.Int, len(e.Arguments))
+		for i, arg := range e.Arguments {
+			value, ok := evaluateConstant(arg)
+			if !ok {
+				return nil, false
+			}
+			args[i] = value
+		}
+		value, err := EvaluatePureBuiltin(e.FunctionName.Name, args)
+		return value, err == nil
+	}
+	return nil, false
+}
+
+// UnreachableCodePass removes the statements that cannot execute. Function
+// definitions among them are kept.
+type UnreachableCodePass struct {
+	Removed int // Statements removed by the last Apply
+}
+
+// NewUnreachableCodePass creates the pass
+func NewUnreachableCodePass() *UnreachableCodePass {
+	return &UnreachableCodePass{}
+}
+
+func (p *UnreachableCodePass) Name() string       { return "unreachable_code_elimination" }
+func (p *UnreachableCodePass) RequiredLevel() int { return 1 }
+
+// Apply removes the unreachable code of every object and function
+func (p *UnreachableCodePass) Apply(ast *YulAST) (*YulAST, error) {
+	p.Removed = 0
+	for _, code := range findUnreachableCode(ast, newControlFlowGraph(ast)) {
+		kept := code.block.Statements[:code.index:code.index]
+		for _, stmt := range code.block.Statements[code.index:] {
+			if _, ok := stmt.(*YulFunctionDef); ok {
+				kept = append(kept, stmt)
+			} else {
+				p.Removed++
+			}
+		}
+		code.block.Statements = kept
+	}
+	return ast, nil
+}
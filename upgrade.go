@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Contract upgrades and destruction.
+//
+// selfdestruct(beneficiary) destroys the contract through
+// ContractManagement.destroy, which removes its storage, and stops like
+// stop(). Neo moves no balance along with it: the beneficiary is dropped,
+// and assets still held are lost.
+//
+// A configured update owner adds the admin method update(nefFile,
+// manifest), which replaces the contract's script and manifest through
+// ContractManagement.update, keeping its hash and storage. Only the owner
+// may call it, a fixed account or, like an Ownable contract, the address
+// stored in a slot; anyone else makes it throw.
+
+// UpdateMethod is the admin method updating the contract
+const UpdateMethod = "update"
+
+// Compiler flag overriding the configured update owner
+const updateOwnerFlag = "--update-owner"
+
+// Prefix of an update owner stored in a slot
+const updateOwnerSlotPrefix = "slot:"
+
+// UpdateOwner is the account allowed to update the contract
+type UpdateOwner struct {
+	Hash string   // Script hash as displayed, "" when the owner is in Slot
+	Slot *big.Int // Slot holding the owner's address
+}
+
+// ParseUpdateOwner parses an update owner: a script hash, "0x" and 40 hex
+// digits, or "slot:N" for the address in slot N
+func ParseUpdateOwner(value string) (*UpdateOwner, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if strings.HasPrefix(value, updateOwnerSlotPrefix) {
+		text := strings.TrimPrefix(value, updateOwnerSlotPrefix)
+		slot, err := ParseYulLiteralValue(&YulLiteral{Kind: LiteralKindNumber, Value: text})
+		if err != nil || slot.Sign() < 0 || slot.Cmp(wordModulus) >= 0 {
+			return nil, fmt.Errorf("update owner slot %q is not a word", text)
+		}
+		return &UpdateOwner{Slot: slot}, nil
+	}
+	hash, ok := parseScriptHash(value)
+	if !ok {
+		return nil, fmt.Errorf("update owner %q is neither a script hash nor slot:N", value)
+	}
+	return &UpdateOwner{Hash: hash}, nil
+}
+
+// UpdateOwnerFromConfig returns the update owner of a configuration, nil
+// for contracts without an update method. An --update-owner flag in
+// CompilerFlags takes precedence over UpdateOwner.
+func UpdateOwnerFromConfig(config CompilerConfig) (*UpdateOwner, error) {
+	value := flagValue(config.CompilerFlags, updateOwnerFlag, config.UpdateOwner)
+	if value == "" {
+		return nil, nil
+	}
+	return ParseUpdateOwner(value)
+}
+
+// updateOwner returns the update owner of the contract, nil when it has
+// no update method
+func (g *CodeGenerator) updateOwner() *UpdateOwner {
+	if g.context == nil {
+		return nil
+	}
+	return g.context.UpdateOwner
+}
+
+// generateSelfDestruct emits selfdestruct with the beneficiary on the stack
+func (g *CodeGenerator) generateSelfDestruct(location SourcePosition) {
+	c := memoryCode{g, location}
+	g.warn(fmt.Sprintf("selfdestruct does not transfer the balance to the beneficiary at line %d", location.Line), location)
+	c.callNative(ContractManagementHash, "destroy", 0, callFlagsDeploy)
+	c.op(NewStackInstruction(DROP))
+	g.generateHalt("selfdestruct", location)
+}
+
+// emitUpdateStub emits update(nefFile, manifest) when the contract has an
+// update owner
+func (g *CodeGenerator) emitUpdateStub(fields int, location SourcePosition) error {
+	owner := g.updateOwner()
+	if owner == nil {
+		return nil
+	}
+	for _, name := range g.context.ExportFunctions {
+		if name == UpdateMethod {
+			return fmt.Errorf("exported function %s collides with the update method", name)
+		}
+	}
+	c := memoryCode{g, location}
+	depth := g.stackTracker.currentDepth
+	defer func() { g.stackTracker.currentDepth = depth }()
+	unauthorized := g.createUniqueLabel("update_unauthorized")
+
+	g.emitStubEntry(UpdateMethod, &ContractMethod{
+		Name:       UpdateMethod,
+		Parameters: []MethodParameter{{Name: "nefFile", Type: "ByteArray"}, {Name: "manifest", Type: "String"}},
+	}, fields, location)
+	c.op(NewInitSlotInstruction(0, 2))
+	g.stackTracker.currentDepth = 0
+
+	if owner.Slot != nil {
+		c.push(wordInteger(owner.Slot))
+		g.emitMemoryCall(storageLoad, 1, 1, location)
+		c.addressScriptHash()
+	} else {
+		c.op(NewPushInstruction(CreateNeoVMByteString(scriptHashBytes(owner.Hash))))
+	}
+	g.emitWitnessCheck(unauthorized, location)
+	c.arg(1)
+	c.arg(0)
+	c.callNative(ContractManagementHash, "update", 2, callFlagsDeploy)
+	c.op(NewStackInstruction(DROP))
+	c.op(NewControlFlowInstruction(RET, 0))
+
+	g.markLabel(unauthorized)
+	c.op(NewPushInstruction(CreateNeoVMByteString("unauthorized update")))
+	c.op(NewControlFlowInstruction(THROW, 0))
+	return nil
+}
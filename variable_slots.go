@@ -0,0 +1,369 @@
+package main
+
+import "fmt"
+
+// Variable slots.
+//
+// Every Yul variable lives in a NeoVM slot. Function parameters are argument
+// slots, filled by INITSLOT from the values the caller pushed; return
+// variables and let-bound variables are local slots. Variables of top-level
+// object code are static fields, allocated by INITSSLOT at the start of the
+// code. Names are resolved through the SymbolTable, with one scope per block,
+// so a variable declared in a block is only visible inside it.
+//
+// Slots are allocated before the code is generated, by a linear scan over
+// the statements of each block: a variable holds its slot from its
+// declaration to the last statement of its block that reads or assigns it,
+// after which later declarations reuse the slot. Variables of a for loop's
+// init block hold theirs until the loop ends. The slot count of a frame is
+// the most slots held at once.
+
+// Storage types recorded in SymbolLocation for variables
+const (
+	StorageArgument = "argument"
+	StorageLocal    = "local"
+	StorageStatic   = "static"
+)
+
+// slotFrame allocates the slots of one function or of top-level code
+type slotFrame struct {
+	storage string                // StorageLocal for functions, StorageStatic for top-level code
+	slots   map[*YulTypedName]int // Allocated slot of each declared variable
+	next    int                   // Next slot of the variables declared in order
+	count   int
+}
+
+// slotAllocator hands out the lowest free slot
+type slotAllocator struct {
+	used  []bool
+	slots map[*YulTypedName]int
+}
+
+// allocateSlots assigns slots to the variables declared in block after the
+// first reserved ones, excluding nested function definitions, which get
+// frames of their own. It returns the slots and the slot count.
+func allocateSlots(block *YulBlock, reserved int) (map[*YulTypedName]int, int) {
+	a := &slotAllocator{used: make([]bool, reserved), slots: make(map[*YulTypedName]int)}
+	for i := range a.used {
+		a.used[i] = true
+	}
+	a.allocateBlock(block, false)
+	return a.slots, len(a.used)
+}
+
+func (a *slotAllocator) take() int {
+	for i, used := range a.used {
+		if !used {
+			a.used[i] = true
+			return i
+		}
+	}
+	a.used = append(a.used, true)
+	return len(a.used) - 1
+}
+
+// allocateBlock allocates the slots of block and releases them after their
+// last use, or returns them held when keep is set
+func (a *slotAllocator) allocateBlock(block *YulBlock, keep bool) []int {
+	if block == nil {
+		return nil
+	}
+	type held struct {
+		slot int
+		last int // Index of the last statement using the variable
+	}
+	var live []held
+	for i, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *YulVariableDeclaration:
+			for _, variable := range s.Variables {
+				last := len(block.Statements)
+				if !keep {
+					last = lastUse(block, i, variable.Name)
+				}
+				a.slots[variable] = a.take()
+				live = append(live, held{slot: a.slots[variable], last: last})
+			}
+		case *YulFunctionDef:
+			continue
+		case *YulFor:
+			init := a.allocateBlock(s.Init, true)
+			a.allocateBlock(s.Body, false)
+			a.allocateBlock(s.Post, false)
+			for _, slot := range init {
+				a.used[slot] = false
+			}
+		}
+		if _, loop := stmt.(*YulFor); !loop {
+			for _, nested := range statementBlocks(stmt) {
+				a.allocateBlock(nested, false)
+			}
+		}
+
+		remaining := live[:0]
+		for _, variable := range live {
+			if variable.last <= i {
+				a.used[variable.slot] = false
+			} else {
+				remaining = append(remaining, variable)
+			}
+		}
+		live = remaining
+	}
+
+	var slots []int
+	for _, variable := range live {
+		if keep {
+			slots = append(slots, variable.slot)
+		} else {
+			a.used[variable.slot] = false
+		}
+	}
+	return slots
+}
+
+// lastUse returns the index of the last statement of block from index
+// first that reads or assigns the variable name
+func lastUse(block *YulBlock, first int, name string) int {
+	for j := len(block.Statements) - 1; j > first; j-- {
+		used := false
+		visit := func(stmt YulStatement) {
+			if assignment, ok := stmt.(*YulAssignment); ok {
+				for _, target := range assignment.VariableNames {
+					used = used || target == name
+				}
+			}
+			for _, slot := range statementExpressions(stmt) {
+				walkExpression(*slot, func(e YulExpression) {
+					if id, ok := e.(*YulIdentifier); ok && id.Name == name {
+						used = true
+					}
+				})
+			}
+		}
+		functionBody(&YulBlock{Statements: block.Statements[j : j+1]}, visit)
+		if used {
+			return j
+		}
+	}
+	return first
+}
+
+// generateEntryBlock generates top-level object code, whose variables are
+// static fields, followed by the memory, calldata, call and storage routines
+// it calls,
+// the payment shim and the stubs of exported functions
+func (g *CodeGenerator) generateEntryBlock(block *YulBlock) error {
+	slots, count := allocateSlots(block, 0)
+	fields := count
+	memory := &memoryState{slot: -1, calldata: -1, returnData: -1, callValue: -1, sender: -1, storage: -1, transient: -1, routines: make(map[string]bool)}
+	if usesMemory(block) {
+		memory.slot = fields
+		fields++
+	}
+	if usesCalldata(block) {
+		memory.calldata = fields
+		fields++
+	}
+	if usesReturnData(block) {
+		memory.returnData = fields
+		fields++
+	}
+	if g.usesCallValue(block) {
+		memory.callValue = fields
+		fields++
+	}
+	primary := g.entry == nil
+	if primary && g.standard() != "" {
+		memory.sender = fields
+		fields++
+	}
+	if g.usesStorage(block) {
+		memory.storage = fields
+		fields++
+	}
+	if usesTransientStorage(block) {
+		memory.transient = fields
+		fields++
+	}
+	if fields > MaxSlots {
+		return fmt.Errorf("too many variables in top-level code: %d (limit %d)", count, MaxSlots)
+	}
+
+	outer, outerSignatures, outerMemory, outerHalts := g.slots, g.signatures, g.memory, g.halts
+	g.slots = &slotFrame{storage: StorageStatic, slots: slots, count: count}
+	g.memory = memory
+	g.halts = functionsHalt(block)
+	defer func() { g.slots, g.signatures, g.memory, g.halts = outer, outerSignatures, outerMemory, outerHalts }()
+	if err := g.collectFunctions(block); err != nil {
+		return err
+	}
+	if primary {
+		if err := g.verifyViews(); err != nil {
+			return err
+		}
+		g.entry = &entryPoint{calldata: memory.calldata >= 0, returns: callsFunction(block, "return")}
+	}
+
+	// Invoked directly, the script has no call value; the payment shim
+	// continues at entry with its own
+	entry := ""
+	if memory.callValue >= 0 {
+		entry = g.createUniqueLabel("entry")
+		g.emitInstruction(NewPushInstruction(CreateNeoVMInteger(0)), block.Location)
+		g.markLabel(entry)
+	}
+	if fields > 0 {
+		g.emitInstruction(NewInitStaticSlotInstruction(fields), block.Location)
+	}
+	if memory.callValue >= 0 {
+		g.emitInstruction(NewSlotInstruction(STSFLD, memory.callValue), block.Location)
+	}
+	if memory.slot >= 0 {
+		g.emitMemoryInit(block.Location)
+	}
+	if memory.calldata >= 0 {
+		g.emitCalldataInit(block.Location)
+	}
+	if memory.returnData >= 0 {
+		g.emitReturnDataInit(block.Location)
+	}
+	if memory.storage >= 0 {
+		g.emitStorageContextInit(false, block.Location)
+	}
+	if memory.transient >= 0 {
+		g.emitTransientInit(block.Location)
+	}
+	halts := g.tryHalts(block.Location)
+	if err := g.generateBlock(block); err != nil {
+		return err
+	}
+	g.catchHalts(halts, g.haltResults(), block.Location)
+	// Running off the end stops
+	if g.haltResults() > 0 && g.reachable() {
+		g.emitInstruction(NewPushInstruction(CreateNeoVMByteString("")), block.Location)
+		g.emitInstruction(NewControlFlowInstruction(RET, 0), block.Location)
+	}
+	// Stubs call routines, which are emitted after them
+	if primary {
+		if err := g.emitExportStubs(fields, block.Location); err != nil {
+			return err
+		}
+		if err := g.emitNEP17Stubs(fields, block.Location); err != nil {
+			return err
+		}
+		if err := g.emitNEP11Stubs(fields, block.Location); err != nil {
+			return err
+		}
+		if err := g.emitUpdateStub(fields, block.Location); err != nil {
+			return err
+		}
+	}
+	g.emitMemoryRoutines(block.Location)
+	if memory.callValue >= 0 {
+		g.emitPaymentShim(entry, memory.calldata >= 0, block.Location)
+	}
+	return nil
+}
+
+// enterFunctionSlots gives a function its own symbol table and slot frame,
+// defines its parameters and return variables and emits INITSLOT. Return
+// variables start at zero. The returned function restores the enclosing
+// state.
+func (g *CodeGenerator) enterFunctionSlots(def *YulFunctionDef) (func(), error) {
+	slots, locals := allocateSlots(def.Body, len(def.Returns))
+	if locals > MaxSlots || len(def.Parameters) > MaxSlots {
+		return nil, fmt.Errorf("too many variables in function %s", def.Name)
+	}
+
+	outerSymbols, outerSlots := g.symbols, g.slots
+	restore := func() { g.symbols, g.slots = outerSymbols, outerSlots }
+	g.symbols = NewSymbolTable()
+	g.slots = &slotFrame{storage: StorageLocal, slots: slots, count: locals}
+
+	for i, param := range def.Parameters {
+		if err := g.defineVariable(param, StorageArgument, i); err != nil {
+			restore()
+			return nil, err
+		}
+	}
+	if locals > 0 || len(def.Parameters) > 0 {
+		g.emitInstruction(NewInitSlotInstruction(locals, len(def.Parameters)), def.Location)
+	}
+	for _, ret := range def.Returns {
+		symbol, err := g.declareVariable(ret)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+		g.emitInstruction(NewPushInstruction(zeroValue(ret.Type)), ret.Location)
+		g.emitStore(symbol, ret.Location)
+	}
+	return restore, nil
+}
+
+// declareVariable defines a variable in the innermost scope in its
+// allocated slot, or the next one for return variables
+func (g *CodeGenerator) declareVariable(variable *YulTypedName) (*Symbol, error) {
+	index, ok := g.slots.slots[variable]
+	if !ok {
+		if g.slots.next >= g.slots.count {
+			return nil, fmt.Errorf("no slot left for variable %s", variable.Name)
+		}
+		index = g.slots.next
+		g.slots.next++
+	}
+	if err := g.defineVariable(variable, g.slots.storage, index); err != nil {
+		return nil, err
+	}
+	symbol, _ := g.symbols.Lookup(variable.Name)
+	return symbol, nil
+}
+
+func (g *CodeGenerator) defineVariable(variable *YulTypedName, storage string, index int) error {
+	err := g.symbols.Define(variable.Name, &Symbol{
+		Name:     variable.Name,
+		Type:     variable.Type,
+		Kind:     SymbolVariable,
+		Location: SymbolLocation{StorageType: storage, Offset: index, Size: 1},
+		Position: variable.Location,
+	})
+	if err != nil {
+		return fmt.Errorf("line %d: %w", variable.Location.Line, err)
+	}
+	return nil
+}
+
+// lookupVariable resolves name in the enclosing scopes
+func (g *CodeGenerator) lookupVariable(name string, location SourcePosition) (*Symbol, error) {
+	symbol, ok := g.symbols.Lookup(name)
+	if !ok || symbol.Kind != SymbolVariable {
+		return nil, fmt.Errorf("undefined variable %s at line %d", name, location.Line)
+	}
+	return symbol, nil
+}
+
+// emitLoad pushes the value of a variable
+func (g *CodeGenerator) emitLoad(symbol *Symbol, location SourcePosition) {
+	symbol.Used = true
+	op := LDLOC
+	switch symbol.Location.StorageType {
+	case StorageArgument:
+		op = LDARG
+	case StorageStatic:
+		op = LDSFLD
+	}
+	g.emitInstruction(NewSlotInstruction(op, symbol.Location.Offset), location)
+}
+
+// emitStore pops the top of the stack into a variable
+func (g *CodeGenerator) emitStore(symbol *Symbol, location SourcePosition) {
+	op := STLOC
+	switch symbol.Location.StorageType {
+	case StorageArgument:
+		op = STARG
+	case StorageStatic:
+		op = STSFLD
+	}
+	g.emitInstruction(NewSlotInstruction(op, symbol.Location.Offset), location)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Verbatim code.
+//
+// verbatim_<n>i_<m>o("code", a1, ..., an), as in solc, inserts code, a
+// string or hex literal of NeoVM bytecode, into the script. The code takes
+// the n arguments, a1 on top, and leaves m values; solc's EVM bytecode
+// means nothing to NeoVM, so the builtin is available in every dialect and
+// always takes NeoVM bytecode.
+//
+// The bytes end up in the script as given: the code is decoded into
+// instructions the optimizer leaves alone, and must not jump, call or
+// return, so that nothing around it changes its offsets. When every
+// instruction has a fixed stack effect the code must take at most its n
+// arguments and leave m values, and the stack tracker follows it
+// instruction by instruction; otherwise the code is trusted to and its
+// last instruction carries the declared effect. Verbatim code is assumed
+// to change state.
+
+var verbatimPattern = regexp.MustCompile(`^verbatim_(\d+)i_(\d+)o$`)
+
+// isVerbatim reports whether name is a verbatim builtin
+func isVerbatim(name string) bool {
+	_, _, ok := verbatimArity(name)
+	return ok
+}
+
+// verbatimArity returns the arguments and results of a verbatim builtin
+func verbatimArity(name string) (int, int, bool) {
+	match := verbatimPattern.FindStringSubmatch(name)
+	if match == nil {
+		return 0, 0, false
+	}
+	in, err1 := strconv.Atoi(match[1])
+	out, err2 := strconv.Atoi(match[2])
+	return in, out, err1 == nil && err2 == nil
+}
+
+// checkVerbatim checks a verbatim call and returns its code
+func checkVerbatim(call *YulFunctionCall) ([]NeoInstruction, error) {
+	name := call.FunctionName.Name
+	in, out, _ := verbatimArity(name)
+	if len(call.Arguments) != in+1 {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", name, in+1, len(call.Arguments))
+	}
+	code, err := stringArgument(call)
+	if err != nil {
+		return nil, err
+	}
+	if code == "" {
+		return nil, fmt.Errorf("%s has no code", name)
+	}
+	instructions, err := DisassembleScript([]byte(code))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	depth, fixed := in, true
+	for _, instr := range instructions {
+		switch op := instr.Opcode; {
+		case isJump(op), op == RET, op == CALLA, op == CALLT, op == ENDFINALLY:
+			return nil, fmt.Errorf("%s: verbatim code must not use %s", name, OpcodeMnemonic(op))
+		}
+		effect := opcodeTable[instr.Opcode]
+		if instr.Opcode == SYSCALL {
+			service, _ := DefaultInteropRegistry().Lookup(string(instr.Operand))
+			effect.Pop, effect.Push = service.Pop, service.Push
+		}
+		fixed = fixed && effect.Pop != StackVariable && effect.Push != StackVariable
+		if !fixed {
+			continue
+		}
+		if depth < instr.StackPop {
+			return nil, fmt.Errorf("%s: code takes more than its %d arguments", name, in)
+		}
+		depth += instr.StackPush - instr.StackPop
+	}
+	if fixed && depth != out {
+		return nil, fmt.Errorf("%s: code leaves %d values, not %d", name, depth, out)
+	}
+
+	for i := range instructions {
+		instructions[i].Verbatim = true
+		if !fixed {
+			instructions[i].StackPop, instructions[i].StackPush = 0, 0
+		}
+	}
+	if !fixed {
+		last := &instructions[len(instructions)-1]
+		last.StackPop, last.StackPush = in, out
+	}
+	return instructions, nil
+}
+
+// generateVerbatim emits a verbatim call
+func (g *CodeGenerator) generateVerbatim(call *YulFunctionCall) error {
+	code, err := checkVerbatim(call)
+	if err != nil {
+		return fmt.Errorf("%v at line %d", err, call.Location.Line)
+	}
+	for i := len(call.Arguments) - 1; i >= 1; i-- {
+		if err := g.checkValueCount(call.Arguments[i], 1); err != nil {
+			return err
+		}
+		if err := g.generateExpression(call.Arguments[i]); err != nil {
+			return err
+		}
+	}
+	for _, instr := range code {
+		g.emitInstruction(instr, call.Location)
+	}
+	return nil
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"os"
+	"strings"
+)
+
+// Accounts and wallets.
+//
+// Transactions are signed with the secp256r1 key of a standard account,
+// whose verification script checks one signature against the compressed
+// public key:
+//
+//	PUSHDATA1 <33-byte public key>
+//	SYSCALL   System.Crypto.CheckSig
+//
+// The account is the script hash of that script, and its address the
+// Base58Check encoding of the address version and the hash. A key is given
+// in WIF, or as an account of a NEP-6 wallet, whose keys are NEP-2
+// encrypted: AES-256 under a key scrypt derives from the password, salted
+// with a checksum of the address.
+
+// AddressVersion is the address version of Neo N3
+const AddressVersion byte = 0x35
+
+// WIF version byte and compressed public key flag
+const (
+	wifVersion    byte = 0x80
+	wifCompressed byte = 0x01
+)
+
+// NEP-2 prefix and length of an encrypted key
+var nep2Prefix = []byte{0x01, 0x42, 0xE0}
+
+const nep2Length = 39
+
+// Account is a standard account with its private key
+type Account struct {
+	Key *ecdsa.PrivateKey
+}
+
+// NewAccount creates an account of the private key d, 32 big-endian bytes
+func NewAccount(d []byte) (*Account, error) {
+	curve := elliptic.P256()
+	k := new(big.Int).SetBytes(d)
+	if len(d) != 32 || k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("invalid private key")
+	}
+	key := &ecdsa.PrivateKey{D: k}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(d)
+	return &Account{Key: key}, nil
+}
+
+// ParseWIF parses a private key in Wallet Import Format
+func ParseWIF(wif string) (*Account, error) {
+	data, err := base58CheckDecode(strings.TrimSpace(wif))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WIF: %w", err)
+	}
+	if len(data) != 34 || data[0] != wifVersion || data[33] != wifCompressed {
+		return nil, errors.New("invalid WIF: not a compressed secp256r1 key")
+	}
+	return NewAccount(data[1:33])
+}
+
+// WIF returns the private key in Wallet Import Format
+func (a *Account) WIF() string {
+	data := append([]byte{wifVersion}, a.Key.D.FillBytes(make([]byte, 32))...)
+	return base58CheckEncode(append(data, wifCompressed))
+}
+
+// PublicKey returns the compressed public key
+func (a *Account) PublicKey() []byte {
+	return elliptic.MarshalCompressed(a.Key.Curve, a.Key.X, a.Key.Y)
+}
+
+// VerificationScript returns the verification script of the account
+func (a *Account) VerificationScript() []byte {
+	script, err := assembleScript([]NeoInstruction{
+		NewPushInstruction(CreateNeoVMByteString(a.PublicKey())),
+		NewSyscallInstruction("System.Crypto.CheckSig"),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return script
+}
+
+// ScriptHash returns the script hash of the account
+func (a *Account) ScriptHash() Uint160 {
+	return ScriptHash(a.VerificationScript())
+}
+
+// Address returns the address of the account
+func (a *Account) Address() string {
+	return AddressOf(a.ScriptHash())
+}
+
+// Sign signs data: the 64-byte r and s of the secp256r1 signature of its
+// SHA-256
+func (a *Account) Sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, a.Key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signature, nil
+}
+
+// AddressOf returns the address of a script hash
+func AddressOf(hash Uint160) string {
+	return base58CheckEncode(append([]byte{AddressVersion}, scriptOrder(hash)...))
+}
+
+// ParseAddress parses an address into its script hash
+func ParseAddress(address string) (Uint160, error) {
+	var hash Uint160
+	data, err := base58CheckDecode(address)
+	if err != nil || len(data) != 21 || data[0] != AddressVersion {
+		return hash, fmt.Errorf("%q is not a Neo N3 address", address)
+	}
+	copy(hash[:], scriptOrder(Uint160(data[1:])))
+	return hash, nil
+}
+
+// scriptOrder returns the little-endian bytes of a displayed script hash,
+// or the displayed bytes of little-endian ones
+func scriptOrder(hash Uint160) []byte {
+	bytes := make([]byte, len(hash))
+	for i := range hash {
+		bytes[len(hash)-1-i] = hash[i]
+	}
+	return bytes
+}
+
+// NEP6Wallet is a NEP-6 wallet file
+type NEP6Wallet struct {
+	Name     string          `json:"name"`
+	Version  string          `json:"version"`
+	Scrypt   ScryptParams    `json:"scrypt"`
+	Accounts []NEP6Account   `json:"accounts"`
+	Extra    json.RawMessage `json:"extra"`
+}
+
+// ScryptParams are the scrypt parameters of a wallet's keys
+type ScryptParams struct {
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+}
+
+// NEP6Account is an account of a NEP-6 wallet
+type NEP6Account struct {
+	Address   string          `json:"address"`
+	Label     string          `json:"label"`
+	IsDefault bool            `json:"isDefault"`
+	Lock      bool            `json:"lock"`
+	Key       string          `json:"key"` // NEP-2 encrypted private key
+	Contract  json.RawMessage `json:"contract"`
+	Extra     json.RawMessage `json:"extra"`
+}
+
+// LoadNEP6Wallet reads a NEP-6 wallet file
+func LoadNEP6Wallet(path string) (*NEP6Wallet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var wallet NEP6Wallet
+	if err := json.Unmarshal(data, &wallet); err != nil {
+		return nil, fmt.Errorf("%s: invalid wallet: %w", path, err)
+	}
+	return &wallet, nil
+}
+
+// Account decrypts the key of the account with address, or of the default
+// account, or the only one, when address is empty
+func (w *NEP6Wallet) Account(address, password string) (*Account, error) {
+	var chosen *NEP6Account
+	for i := range w.Accounts {
+		account := &w.Accounts[i]
+		if account.Address == address || (address == "" && (account.IsDefault || len(w.Accounts) == 1)) {
+			chosen = account
+			break
+		}
+	}
+	switch {
+	case chosen == nil && address != "":
+		return nil, fmt.Errorf("wallet has no account %s", address)
+	case chosen == nil:
+		return nil, errors.New("wallet has no default account; choose one")
+	case chosen.Key == "":
+		return nil, fmt.Errorf("account %s has no key", chosen.Address)
+	}
+	account, err := DecryptNEP2(chosen.Key, password, w.Scrypt)
+	if err != nil {
+		return nil, fmt.Errorf("account %s: %w", chosen.Address, err)
+	}
+	if account.Address() != chosen.Address {
+		return nil, fmt.Errorf("account %s: key is of %s", chosen.Address, account.Address())
+	}
+	return account, nil
+}
+
+// DecryptNEP2 decrypts a NEP-2 encrypted key with password
+func DecryptNEP2(key, password string, params ScryptParams) (*Account, error) {
+	data, err := base58CheckDecode(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NEP-2 key: %w", err)
+	}
+	if len(data) != nep2Length || !bytes.Equal(data[:3], nep2Prefix) {
+		return nil, errors.New("invalid NEP-2 key")
+	}
+	salt := data[3:7]
+	derived, err := scryptKey([]byte(password), salt, params.N, params.R, params.P, 64)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derived[32:])
+	if err != nil {
+		return nil, err
+	}
+	d := make([]byte, 32)
+	block.Decrypt(d[:16], data[7:23])
+	block.Decrypt(d[16:], data[23:39])
+	for i := range d {
+		d[i] ^= derived[i]
+	}
+	account, err := NewAccount(d)
+	if err != nil {
+		return nil, errors.New("wrong password")
+	}
+	check := sha256.Sum256([]byte(account.Address()))
+	check = sha256.Sum256(check[:])
+	if !bytes.Equal(check[:4], salt) {
+		return nil, errors.New("wrong password")
+	}
+	return account, nil
+}
+
+// scryptKey derives a key of length bytes from password and salt with
+// scrypt (RFC 7914)
+func scryptKey(password, salt []byte, n, r, p, length int) ([]byte, error) {
+	if n <= 1 || n&(n-1) != 0 || r <= 0 || p <= 0 || uint64(r)*uint64(p) >= 1<<30 || n > 1<<30/r {
+		return nil, fmt.Errorf("invalid scrypt parameters n=%d r=%d p=%d", n, r, p)
+	}
+	b := pbkdf2SHA256(password, salt, 1, p*128*r)
+	x := make([]uint32, 32*r)
+	v := make([]uint32, 32*r*n)
+	y := make([]uint32, 32*r)
+	for i := 0; i < p; i++ {
+		chunk := b[i*128*r : (i+1)*128*r]
+		for j := range x {
+			x[j] = binary.LittleEndian.Uint32(chunk[4*j:])
+		}
+		for j := 0; j < n; j++ {
+			copy(v[j*32*r:], x)
+			scryptBlockMix(x, y, r)
+		}
+		for j := 0; j < n; j++ {
+			k := int(x[(2*r-1)*16]) & (n - 1)
+			for l := range x {
+				x[l] ^= v[k*32*r+l]
+			}
+			scryptBlockMix(x, y, r)
+		}
+		for j := range x {
+			binary.LittleEndian.PutUint32(chunk[4*j:], x[j])
+		}
+	}
+	return pbkdf2SHA256(password, b, 1, length), nil
+}
+
+// scryptBlockMix mixes the 2r 64-byte blocks of b with Salsa20/8, using y
+// as scratch space
+func scryptBlockMix(b, y []uint32, r int) {
+	var x [16]uint32
+	copy(x[:], b[(2*r-1)*16:])
+	for i := 0; i < 2*r; i++ {
+		for j := range x {
+			x[j] ^= b[i*16+j]
+		}
+		salsa208(&x)
+		// Even blocks go to the first half, odd ones to the second
+		copy(y[(i/2+(i%2)*r)*16:], x[:])
+	}
+	copy(b, y)
+}
+
+// salsa208 applies the Salsa20/8 core to x
+func salsa208(x *[16]uint32) {
+	w := *x
+	quarter := func(a, b, c, d int) {
+		w[b] ^= bits.RotateLeft32(w[a]+w[d], 7)
+		w[c] ^= bits.RotateLeft32(w[b]+w[a], 9)
+		w[d] ^= bits.RotateLeft32(w[c]+w[b], 13)
+		w[a] ^= bits.RotateLeft32(w[d]+w[c], 18)
+	}
+	for i := 0; i < 8; i += 2 {
+		quarter(0, 4, 8, 12)
+		quarter(5, 9, 13, 1)
+		quarter(10, 14, 2, 6)
+		quarter(15, 3, 7, 11)
+		quarter(0, 1, 2, 3)
+		quarter(5, 6, 7, 4)
+		quarter(10, 11, 8, 9)
+		quarter(15, 12, 13, 14)
+	}
+	for i := range x {
+		x[i] += w[i]
+	}
+}
+
+// pbkdf2SHA256 derives a key of length bytes with PBKDF2-HMAC-SHA256
+func pbkdf2SHA256(password, salt []byte, iterations, length int) []byte {
+	mac := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < length; block++ {
+		mac.Reset()
+		mac.Write(salt)
+		mac.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := mac.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:length]
+}
+
+// base58Alphabet is the Bitcoin Base58 alphabet
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58CheckEncode encodes data and the first 4 bytes of its double
+// SHA-256 in Base58
+func base58CheckEncode(data []byte) string {
+	check := sha256.Sum256(data)
+	check = sha256.Sum256(check[:])
+	data = append(append([]byte(nil), data...), check[:4]...)
+
+	n := new(big.Int).SetBytes(data)
+	base, mod := big.NewInt(58), new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// base58CheckDecode decodes Base58 text and verifies its checksum
+func base58CheckDecode(text string) ([]byte, error) {
+	n := new(big.Int)
+	base := big.NewInt(58)
+	for _, c := range text {
+		digit := strings.IndexRune(base58Alphabet, c)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid Base58 character %q", c)
+		}
+		n.Mul(n, base)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+	data := n.Bytes()
+	for i := 0; i < len(text) && text[i] == base58Alphabet[0]; i++ {
+		data = append([]byte{0}, data...)
+	}
+	if len(data) < 4 {
+		return nil, errors.New("too short")
+	}
+	payload, sum := data[:len(data)-4], data[len(data)-4:]
+	check := sha256.Sum256(payload)
+	check = sha256.Sum256(check[:])
+	if !bytes.Equal(check[:4], sum) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return payload, nil
+}
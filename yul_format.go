@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Yul formatting.
+//
+// FormatYul rewrites Yul source in the canonical style of PrintYul: four
+// spaces of indentation per level, one statement per line, single spaces
+// around := and after commas, and each case label on a line of its own at
+// the depth of its switch. Unlike PrintYul it keeps the comments of the
+// source, each before the statement it preceded or after the one whose line
+// it ends, and single blank lines between statements. Formatting never
+// changes the program: the result is checked to parse to what the source
+// does, and formatting it again changes nothing.
+//
+// The fmt command formats files, or standard input, like gofmt:
+//
+//	neo-yulc fmt contract.yul        # print the formatted source
+//	neo-yulc fmt -w contracts/*.yul  # rewrite the files
+//	neo-yulc fmt -l contracts/*.yul  # list the files that are not formatted
+
+// yulComment is a comment of the source
+type yulComment struct {
+	line int
+	text string
+}
+
+// yulTokens are the tokens of a source with its blocks matched
+type yulTokens struct {
+	tokens  []Token
+	at      map[int]int // Token index by offset
+	closing map[int]int // Index of the "}" closing each "{"
+}
+
+// scanYulTokens lexes source in dialect, every builtin when nil
+func scanYulTokens(source string, dialect *Dialect) (*yulTokens, error) {
+	lexer := NewYulLexer()
+	lexer.dialect = dialect
+	if err := lexer.Init(source); err != nil {
+		return nil, err
+	}
+	tokens, err := lexer.ScanTokens()
+	if err != nil {
+		return nil, err
+	}
+	t := &yulTokens{tokens: tokens, at: make(map[int]int, len(tokens)), closing: make(map[int]int)}
+	var open []int
+	for i, token := range tokens {
+		t.at[token.Position.Offset] = i
+		switch token.Type {
+		case TokenLeftBrace:
+			open = append(open, i)
+		case TokenRightBrace:
+			if len(open) > 0 {
+				t.closing[open[len(open)-1]] = i
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	return t, nil
+}
+
+// blockBraces returns the indexes of the braces of a parsed block, whose
+// location is that of the token after its "{"
+func (t *yulTokens) blockBraces(block *YulBlock) (int, int, bool) {
+	i, ok := t.at[block.Location.Offset]
+	if !ok || i == 0 || t.tokens[i-1].Type != TokenLeftBrace {
+		return 0, 0, false
+	}
+	end, ok := t.closing[i-1]
+	return i - 1, end, ok
+}
+
+// yulLayout is what formatting keeps of the source besides its program
+type yulLayout struct {
+	*yulTokens
+	comments []yulComment // In source order
+	next     int          // First comment not yet written
+	last     int          // Line of the last statement or comment written
+	blank    map[int]bool // Lines holding only white space
+}
+
+func newYulLayout(source string) (*yulLayout, error) {
+	tokens, err := scanYulTokens(source, nil)
+	if err != nil {
+		return nil, err
+	}
+	layout := &yulLayout{yulTokens: tokens, comments: scanYulComments(source), blank: make(map[int]bool)}
+	for i, line := range strings.Split(source, "\n") {
+		if strings.TrimSpace(line) == "" {
+			layout.blank[i+1] = true
+		}
+	}
+	return layout, nil
+}
+
+// scanYulComments returns the comments of source, skipping string literals
+func scanYulComments(source string) []yulComment {
+	var comments []yulComment
+	line := 1
+	for i := 0; i < len(source); i++ {
+		switch {
+		case source[i] == '\n':
+			line++
+		case source[i] == '"':
+			for i++; i < len(source) && source[i] != '"' && source[i] != '\n'; i++ {
+				if source[i] == '\\' {
+					i++
+				}
+			}
+		case strings.HasPrefix(source[i:], "//"):
+			end := strings.IndexByte(source[i:], '\n')
+			if end < 0 {
+				end = len(source) - i
+			}
+			comments = append(comments, yulComment{line, strings.TrimRight(source[i:i+end], " \t\r")})
+			i += end - 1
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			if end < 0 {
+				end = len(source) - i
+			} else {
+				end += 4
+			}
+			text := source[i : i+end]
+			comments = append(comments, yulComment{line, text})
+			line += strings.Count(text, "\n")
+			i += end - 1
+		}
+	}
+	return comments
+}
+
+// before writes the comments preceding line, and the blank line of the
+// source before it unless it starts a block
+func (p *YulPrinter) before(line int) {
+	if p.layout == nil || line <= 0 {
+		return
+	}
+	for ; p.layout.next < len(p.layout.comments) && p.layout.comments[p.layout.next].line < line; p.layout.next++ {
+		comment := p.layout.comments[p.layout.next]
+		p.gap(comment.line)
+		p.line(comment.text)
+	}
+	p.gap(line)
+}
+
+// gap writes a blank line where the source has one before line, once
+// per line
+func (p *YulPrinter) gap(line int) {
+	if !p.fresh && line > p.layout.last && p.layout.blank[line-1] {
+		p.out.WriteByte('\n')
+	}
+	p.layout.last = line
+}
+
+// after returns the comments ending line, to write after its statement
+func (p *YulPrinter) after(line int) string {
+	if p.layout == nil {
+		return ""
+	}
+	var text string
+	for ; p.layout.next < len(p.layout.comments) && p.layout.comments[p.layout.next].line == line; p.layout.next++ {
+		text += " " + p.layout.comments[p.layout.next].text
+	}
+	return text
+}
+
+// openLine returns the line of the "{" of block, 0 without a layout
+func (p *YulPrinter) openLine(block *YulBlock) int {
+	if p.layout == nil {
+		return 0
+	}
+	if open, _, ok := p.layout.blockBraces(block); ok {
+		return p.layout.tokens[open].Position.Line
+	}
+	return block.Location.Line
+}
+
+// closeLine returns the line of the "}" of block, 0 without a layout
+func (p *YulPrinter) closeLine(block *YulBlock) int {
+	if p.layout == nil {
+		return 0
+	}
+	if _, end, ok := p.layout.blockBraces(block); ok {
+		return p.layout.tokens[end].Position.Line
+	}
+	return 0
+}
+
+// objectCloseLine returns the line of the "}" of obj, 0 without a layout
+func (p *YulPrinter) objectCloseLine(obj *YulObject) int {
+	if p.layout == nil {
+		return 0
+	}
+	for i := p.layout.at[obj.Location.Offset]; i < len(p.layout.tokens); i++ {
+		if p.layout.tokens[i].Type == TokenLeftBrace {
+			return p.layout.tokens[p.layout.closing[i]].Position.Line
+		}
+	}
+	return 0
+}
+
+// commented reports whether comments precede line
+func (p *YulPrinter) commented(line int) bool {
+	return p.layout != nil && p.layout.next < len(p.layout.comments) && p.layout.comments[p.layout.next].line < line
+}
+
+// rest writes the comments after the program
+func (p *YulPrinter) rest() {
+	if p.layout != nil {
+		p.before(int(^uint(0) >> 1))
+	}
+}
+
+// FormatYul formats Yul source in the canonical style, keeping comments
+func FormatYul(source string) (string, error) {
+	ast, err := NewYulParser().Parse(source)
+	if err != nil {
+		return "", err
+	}
+	layout, err := newYulLayout(source)
+	if err != nil {
+		return "", err
+	}
+
+	printer := NewYulPrinter(DefaultYulIndent)
+	printer.layout = layout
+	formatted := printer.Print(ast)
+	again, err := NewYulParser().Parse(formatted)
+	if err != nil || PrintYul(again) != PrintYul(ast) {
+		return "", errors.New("formatting would change the program")
+	}
+	return formatted, nil
+}
+
+// RunFmtCommand runs "fmt" with the given arguments and returns the
+// process exit code
+func RunFmtCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the formatted source to the files instead of standard output")
+	list := flags.Bool("l", false, "list the files that are not formatted, failing if there are any unless -w rewrites them")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: fmt [flags] [file.yul ...]")
+		fmt.Fprintln(stderr, "Formats standard input when no file is given.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "fmt: -w needs files")
+			return exitUsage
+		}
+		source, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailed
+		}
+		formatted, err := FormatYul(string(source))
+		if err != nil {
+			fmt.Fprintf(stderr, "<stdin>: %v\n", err)
+			return exitFailed
+		}
+		if *list {
+			if formatted != string(source) {
+				fmt.Fprintln(stdout, "<stdin>")
+				return exitFailed
+			}
+			return exitOK
+		}
+		fmt.Fprint(stdout, formatted)
+		return exitOK
+	}
+
+	status := exitOK
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			status = exitFailed
+			continue
+		}
+		formatted, err := FormatYul(string(source))
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			status = exitFailed
+			continue
+		}
+		changed := !bytes.Equal(source, []byte(formatted))
+		if *list && changed {
+			fmt.Fprintln(stdout, path)
+			if !*write {
+				status = exitFailed
+			}
+		}
+		if *write && changed {
+			if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+				fmt.Fprintln(stderr, err)
+				status = exitFailed
+			}
+		}
+		if !*list && !*write {
+			fmt.Fprint(stdout, formatted)
+		}
+	}
+	return status
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strings"
+)
+
+// Random Yul programs.
+//
+// YulProgramGenerator writes random programs that parse, pass analysis and
+// compile: every variable is declared once and before use, every call
+// passes the arguments and takes the results its callee has, loops count
+// to a bound with a counter their body leaves alone, break and continue
+// appear in loop bodies only and leave in functions only. A function calls
+// only the functions defined before it, so programs never recurse. The
+// same seed writes the same program. The fuzz targets seed their corpora
+// with generated programs.
+//
+// Case writes a program with an entry function and computes what calling
+// it returns and stores with the YulInterpreter, an oracle the compiled
+// program run by the execution engine must agree with.
+
+// Builtin arities of generated expressions
+var generatedBuiltins = []struct {
+	name  string
+	arity int
+}{
+	{"add", 2}, {"sub", 2}, {"mul", 2}, {"div", 2}, {"mod", 2},
+	{"lt", 2}, {"gt", 2}, {"eq", 2}, {"iszero", 1},
+	{"and", 2}, {"or", 2}, {"xor", 2}, {"not", 1},
+	{"shl", 2}, {"shr", 2}, {"byte", 2}, {"sload", 1},
+}
+
+// YulProgramCase is a generated program, the arguments to call its entry
+// function with and what the call computes, by the YulInterpreter
+type YulProgramCase struct {
+	Source  string
+	Entry   string
+	Args    []*big.Int
+	Results []*big.Int          // Values the entry function returns
+	Storage map[string]*big.Int // Slots written, by storageKey
+}
+
+// generatedFunction is a function of the program being generated
+type generatedFunction struct {
+	name            string
+	params, returns int
+}
+
+// YulProgramGenerator writes random well-formed Yul programs
+type YulProgramGenerator struct {
+	MaxDepth      int // Nesting of blocks and of expressions
+	MaxStatements int // Statements per block
+	MaxFunctions  int
+
+	rand      *rand.Rand
+	out       strings.Builder
+	indent    int
+	names     int
+	functions []generatedFunction // Functions callable from the code written
+	scopes    [][]string          // Assignable variables by block
+	constants []string            // Variables nothing assigns, loop counters
+	loop      bool                // Writing a loop body
+	function  bool                // Writing a function body
+}
+
+// NewYulProgramGenerator creates a generator writing the programs of seed
+func NewYulProgramGenerator(seed int64) *YulProgramGenerator {
+	return &YulProgramGenerator{MaxDepth: 3, MaxStatements: 5, MaxFunctions: 4, rand: rand.New(rand.NewSource(seed))}
+}
+
+// Program writes a random object
+func (g *YulProgramGenerator) Program() string {
+	g.begin()
+	g.scopes = [][]string{nil}
+	g.statements(g.MaxDepth)
+	return g.end()
+}
+
+// Case writes a random object whose entry function returns a word, picks
+// arguments for it and interprets the program to compute what calling
+// the entry function returns and stores
+func (g *YulProgramGenerator) Case() (*YulProgramCase, error) {
+	g.begin()
+	entry := generatedFunction{name: "run", params: g.rand.Intn(4), returns: 1}
+	g.functionDef(entry, g.MaxDepth)
+	c := &YulProgramCase{Source: g.end(), Entry: entry.name}
+	for i := 0; i < entry.params; i++ {
+		value, _ := new(big.Int).SetString(g.literal(), 0)
+		c.Args = append(c.Args, value)
+	}
+
+	ast, err := NewYulParser().Parse(c.Source)
+	if err != nil {
+		return nil, fmt.Errorf("generated program does not parse: %w", err)
+	}
+	var functions []*YulFunctionDef
+	forEachFunctionDef(ast, func(def *YulFunctionDef) {
+		functions = append(functions, def)
+	})
+	interpreter := NewYulInterpreter(functions)
+	if c.Results, err = interpreter.CallFunction(entry.name, c.Args); err != nil {
+		return nil, fmt.Errorf("interpreting the generated program: %w", err)
+	}
+	c.Storage = interpreter.Storage
+	return c, nil
+}
+
+// begin starts an object and writes its functions
+func (g *YulProgramGenerator) begin() {
+	g.out.Reset()
+	g.indent, g.names = 0, 0
+	g.functions, g.scopes, g.constants = nil, nil, nil
+	g.loop, g.function = false, false
+
+	g.line("object \"Fuzz\" {")
+	g.indent++
+	g.line("code {")
+	g.indent++
+	n := g.rand.Intn(g.MaxFunctions + 1)
+	for i := 0; i < n; i++ {
+		f := generatedFunction{name: g.name("f"), params: g.rand.Intn(4), returns: g.rand.Intn(3)}
+		g.functionDef(f, g.MaxDepth-1)
+	}
+}
+
+// end ends the object and returns its source
+func (g *YulProgramGenerator) end() string {
+	g.indent--
+	g.line("}")
+	g.indent--
+	g.line("}")
+	return g.out.String()
+}
+
+// line writes a line at the current indentation
+func (g *YulProgramGenerator) line(format string, args ...interface{}) {
+	g.out.WriteString(strings.Repeat("    ", g.indent))
+	fmt.Fprintf(&g.out, format, args...)
+	g.out.WriteByte('\n')
+}
+
+// name returns a fresh identifier
+func (g *YulProgramGenerator) name(prefix string) string {
+	g.names++
+	return fmt.Sprintf("%s%d", prefix, g.names)
+}
+
+// functionDef writes f, callable by the functions after it, with a body
+// nesting blocks depth deep
+func (g *YulProgramGenerator) functionDef(f generatedFunction, depth int) {
+	var params, returns []string
+	for i := 0; i < f.params; i++ {
+		params = append(params, g.name("p"))
+	}
+	for i := 0; i < f.returns; i++ {
+		returns = append(returns, g.name("r"))
+	}
+	header := fmt.Sprintf("function %s(%s)", f.name, strings.Join(params, ", "))
+	if len(returns) > 0 {
+		header += " -> " + strings.Join(returns, ", ")
+	}
+	g.line("%s {", header)
+	g.indent++
+	g.scopes = [][]string{append(params, returns...)}
+	g.function = true
+	g.statements(depth)
+	g.function = false
+	g.indent--
+	g.line("}")
+	g.functions = append(g.functions, f)
+}
+
+// statements writes the statements of a block
+func (g *YulProgramGenerator) statements(depth int) {
+	n := 1 + g.rand.Intn(g.MaxStatements)
+	for i := 0; i < n; i++ {
+		g.statement(depth)
+	}
+}
+
+// block writes a nested block, with a scope of its own
+func (g *YulProgramGenerator) block(header string, depth int) {
+	g.line("%s {", header)
+	g.indent++
+	g.scopes = append(g.scopes, nil)
+	g.statements(depth)
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	g.indent--
+	g.line("}")
+}
+
+// declare adds variables to the innermost scope
+func (g *YulProgramGenerator) declare(names ...string) {
+	last := len(g.scopes) - 1
+	g.scopes[last] = append(g.scopes[last], names...)
+}
+
+// variables returns the assignable variables in scope
+func (g *YulProgramGenerator) variables() []string {
+	var names []string
+	for _, scope := range g.scopes {
+		names = append(names, scope...)
+	}
+	return names
+}
+
+// statement writes a random statement
+func (g *YulProgramGenerator) statement(depth int) {
+	variables := g.variables()
+	switch choice := g.rand.Intn(12); {
+	case choice < 3 || (choice < 5 && len(variables) == 0):
+		name := g.name("v")
+		g.line("let %s := %s", name, g.expression(depth))
+		g.declare(name)
+	case choice < 5:
+		g.line("%s := %s", variables[g.rand.Intn(len(variables))], g.expression(depth))
+	case choice == 5 && depth > 0:
+		g.block("if "+g.expression(depth), depth-1)
+	case choice == 6 && depth > 0:
+		g.line("switch %s", g.expression(depth))
+		cases := 1 + g.rand.Intn(3)
+		for i := 0; i < cases; i++ {
+			g.block(fmt.Sprintf("case %d", i), depth-1)
+		}
+		if g.rand.Intn(2) == 0 {
+			g.block("default", depth-1)
+		}
+	case choice == 7 && depth > 0:
+		counter := g.name("i")
+		g.line("for { let %s := 0 } lt(%s, %d) { %s := add(%s, 1) } {", counter, counter, 1+g.rand.Intn(5), counter, counter)
+		g.indent++
+		g.constants = append(g.constants, counter)
+		g.scopes = append(g.scopes, nil)
+		loop := g.loop
+		g.loop = true
+		g.statements(depth - 1)
+		g.loop = loop
+		g.scopes = g.scopes[:len(g.scopes)-1]
+		g.constants = g.constants[:len(g.constants)-1]
+		g.indent--
+		g.line("}")
+	case choice == 8:
+		g.line("sstore(%s, %s)", g.expression(depth), g.expression(depth))
+	case choice == 9 && len(g.functions) > 0:
+		f := g.functions[g.rand.Intn(len(g.functions))]
+		call := g.call(f.name, f.params, depth)
+		switch {
+		case f.returns == 0:
+			g.line("%s", call)
+		case f.returns == 1 || g.rand.Intn(2) == 0:
+			var names []string
+			for i := 0; i < f.returns; i++ {
+				names = append(names, g.name("v"))
+			}
+			g.line("let %s := %s", strings.Join(names, ", "), call)
+			g.declare(names...)
+		case len(variables) > 0:
+			var names []string
+			for i := 0; i < f.returns; i++ {
+				names = append(names, variables[g.rand.Intn(len(variables))])
+			}
+			if names[0] != names[1] {
+				g.line("%s := %s", strings.Join(names, ", "), call)
+			}
+		}
+	case choice == 10 && g.loop:
+		if g.rand.Intn(2) == 0 {
+			g.line("if %s { break }", g.expression(depth))
+		} else {
+			g.line("if %s { continue }", g.expression(depth))
+		}
+	case choice == 11 && g.function && !g.loop:
+		g.line("if %s { leave }", g.expression(depth))
+	default:
+		g.line("mstore(%d, %s)", 32*g.rand.Intn(8), g.expression(depth))
+	}
+}
+
+// call returns a call of name with arity random arguments
+func (g *YulProgramGenerator) call(name string, arity, depth int) string {
+	args := make([]string, arity)
+	for i := range args {
+		args[i] = g.expression(depth - 1)
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+}
+
+// expression returns a random single-valued expression
+func (g *YulProgramGenerator) expression(depth int) string {
+	variables := append(g.variables(), g.constants...)
+	choice := g.rand.Intn(10)
+	if depth <= 0 {
+		choice %= 4
+	}
+	switch {
+	case choice < 2 && len(variables) > 0:
+		return variables[g.rand.Intn(len(variables))]
+	case choice < 4:
+		return g.literal()
+	case choice == 4:
+		var callable []generatedFunction
+		for _, f := range g.functions {
+			if f.returns == 1 {
+				callable = append(callable, f)
+			}
+		}
+		if len(callable) > 0 {
+			f := callable[g.rand.Intn(len(callable))]
+			return g.call(f.name, f.params, depth)
+		}
+	case choice == 5:
+		return fmt.Sprintf("mload(%d)", 32*g.rand.Intn(8))
+	}
+	builtin := generatedBuiltins[g.rand.Intn(len(generatedBuiltins))]
+	return g.call(builtin.name, builtin.arity, depth)
+}
+
+// literal returns a random number literal
+func (g *YulProgramGenerator) literal() string {
+	switch g.rand.Intn(6) {
+	case 0:
+		return "0"
+	case 1:
+		return fmt.Sprintf("0x%x", g.rand.Uint64())
+	case 2:
+		// Near the word boundary
+		return "0x" + strings.Repeat("f", 56+g.rand.Intn(9))
+	case 3:
+		return fmt.Sprint(g.rand.Intn(256))
+	}
+	return fmt.Sprint(g.rand.Intn(10))
+}
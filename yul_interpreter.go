@@ -0,0 +1,437 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// YulInterpreter executes Yul ASTs directly with EVM word semantics. It is
+// used by optimization passes to evaluate code at compile time and serves as
+// a reference implementation when checking generated NeoVM code.
+type YulInterpreter struct {
+	StepBudget int  // Maximum number of evaluation steps, 0 for unlimited
+	Restricted bool // Reject every built-in with side effects
+
+	Storage   map[string]*big.Int // Persistent storage keyed by storageKey, used by sload/sstore
+	Transient map[string]*big.Int // Transient storage keyed by storageKey, used by tload/tstore
+	Journal   *ExecutionJournal   // Records state deltas for time-travel debugging when set
+	Profile   *ExecutionProfile   // Collects call and switch case counts for profile-guided optimization when set
+	Limits    *SandboxLimits      // Runtime limits enforced during execution, nil for none
+
+	Memory        []byte            // Linear memory used by mload/mstore and logs
+	Notifications []YulNotification // Events emitted by log0..log4
+
+	functions     map[string]*YulFunctionDef
+	scopes        []map[string]*big.Int
+	steps         int
+	depth         int
+	storageWrites int
+}
+
+// Errors reported by the interpreter
+var (
+	ErrStepBudgetExceeded = errors.New("step budget exceeded")
+	ErrImpureOperation    = errors.New("operation not allowed in restricted mode")
+	ErrCallDepthExceeded  = errors.New("call depth exceeded")
+)
+
+// maxInterpreterCallDepth bounds recursion of user functions
+const maxInterpreterCallDepth = 1024
+
+// controlFlow signals how a statement finished
+type controlFlow int
+
+const (
+	flowNormal controlFlow = iota
+	flowBreak
+	flowContinue
+	flowLeave
+)
+
+// NewYulInterpreter creates an interpreter that can call the given functions
+func NewYulInterpreter(functions []*YulFunctionDef) *YulInterpreter {
+	interp := &YulInterpreter{
+		Storage:   make(map[string]*big.Int),
+		Transient: make(map[string]*big.Int),
+		functions: make(map[string]*YulFunctionDef),
+	}
+	for _, fn := range functions {
+		interp.functions[fn.Name] = fn
+	}
+	return interp
+}
+
+// NewRestrictedYulInterpreter creates an interpreter limited to pure code
+// and at most stepBudget evaluation steps, suitable for compile-time use.
+func NewRestrictedYulInterpreter(functions []*YulFunctionDef, stepBudget int) *YulInterpreter {
+	interp := NewYulInterpreter(functions)
+	interp.Restricted = true
+	interp.StepBudget = stepBudget
+	return interp
+}
+
+// Steps returns the number of steps consumed so far
+func (in *YulInterpreter) Steps() int {
+	return in.steps
+}
+
+// CallFunction runs the named user function with the given arguments and
+// returns the values of its return variables.
+func (in *YulInterpreter) CallFunction(name string, args []*big.Int) ([]*big.Int, error) {
+	fn, ok := in.functions[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined function: %s", name)
+	}
+	if len(args) != len(fn.Parameters) {
+		return nil, fmt.Errorf("function %s expects %d arguments, got %d", name, len(fn.Parameters), len(args))
+	}
+	if in.depth >= maxInterpreterCallDepth {
+		return nil, ErrCallDepthExceeded
+	}
+
+	// Functions only see their own parameters and return variables
+	if in.Profile != nil {
+		in.Profile.RecordCall(name)
+	}
+
+	saved := in.scopes
+	in.scopes = []map[string]*big.Int{make(map[string]*big.Int)}
+	in.recordDelta(StateDelta{Kind: DeltaFrameEnter})
+	in.depth++
+	defer func() {
+		in.recordFrameExit()
+		in.scopes = saved
+		in.depth--
+	}()
+
+	frame := in.scopes[0]
+	for i, param := range fn.Parameters {
+		in.declare(param.Name, toWord(args[i]))
+	}
+	for _, ret := range fn.Returns {
+		in.declare(ret.Name, big.NewInt(0))
+	}
+
+	if _, err := in.execBlock(fn.Body); err != nil {
+		return nil, err
+	}
+
+	results := make([]*big.Int, len(fn.Returns))
+	for i, ret := range fn.Returns {
+		results[i] = frame[ret.Name]
+	}
+	return results, nil
+}
+
+// ExecuteBlock runs a block in a fresh top-level scope
+func (in *YulInterpreter) ExecuteBlock(block *YulBlock) error {
+	if in.scopes != nil {
+		in.recordFrameExit()
+	}
+	in.scopes = []map[string]*big.Int{make(map[string]*big.Int)}
+	in.recordDelta(StateDelta{Kind: DeltaFrameEnter})
+	_, err := in.execBlock(block)
+	return err
+}
+
+// Lookup returns the current value of a visible variable
+func (in *YulInterpreter) Lookup(name string) (*big.Int, bool) {
+	for i := len(in.scopes) - 1; i >= 0; i-- {
+		if value, ok := in.scopes[i][name]; ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func (in *YulInterpreter) step() error {
+	in.steps++
+	if in.StepBudget > 0 && in.steps > in.StepBudget {
+		return ErrStepBudgetExceeded
+	}
+	return in.checkLimit(LimitFuel, in.steps)
+}
+
+func (in *YulInterpreter) execBlock(block *YulBlock) (controlFlow, error) {
+	if block == nil {
+		return flowNormal, nil
+	}
+
+	in.pushScope()
+	defer in.popScope()
+
+	// Functions are visible throughout the block they are defined in
+	for _, stmt := range block.Statements {
+		if fn, ok := stmt.(*YulFunctionDef); ok {
+			in.functions[fn.Name] = fn
+		}
+	}
+
+	for _, stmt := range block.Statements {
+		flow, err := in.execStatement(stmt)
+		if err != nil || flow != flowNormal {
+			return flow, err
+		}
+	}
+	return flowNormal, nil
+}
+
+func (in *YulInterpreter) execStatement(stmt YulStatement) (controlFlow, error) {
+	if err := in.step(); err != nil {
+		return flowNormal, err
+	}
+	in.recordStep(stmt)
+
+	switch s := stmt.(type) {
+	case *YulBlock:
+		return in.execBlock(s)
+
+	case *YulExpressionStatement:
+		if s.Expression != nil {
+			_, err := in.evalMulti(s.Expression)
+			return flowNormal, err
+		}
+		return flowNormal, nil
+
+	case *YulVariableDeclaration:
+		values := make([]*big.Int, len(s.Variables))
+		if s.Value != nil {
+			results, err := in.evalMulti(s.Value)
+			if err != nil {
+				return flowNormal, err
+			}
+			if len(results) != len(s.Variables) {
+				return flowNormal, fmt.Errorf("declaration of %d variables from %d values", len(s.Variables), len(results))
+			}
+			copy(values, results)
+		}
+		for i, v := range s.Variables {
+			if values[i] == nil {
+				values[i] = big.NewInt(0)
+			}
+			in.declare(v.Name, values[i])
+		}
+		return flowNormal, nil
+
+	case *YulAssignment:
+		results, err := in.evalMulti(s.Value)
+		if err != nil {
+			return flowNormal, err
+		}
+		if len(results) != len(s.VariableNames) {
+			return flowNormal, fmt.Errorf("assignment to %d variables from %d values", len(s.VariableNames), len(results))
+		}
+		for i, name := range s.VariableNames {
+			if err := in.assign(name, results[i]); err != nil {
+				return flowNormal, err
+			}
+		}
+		return flowNormal, nil
+
+	case *YulIf:
+		cond, err := in.eval(s.Condition)
+		if err != nil {
+			return flowNormal, err
+		}
+		if cond.Sign() != 0 {
+			return in.execBlock(s.Body)
+		}
+		return flowNormal, nil
+
+	case *YulSwitch:
+		value, err := in.eval(s.Expression)
+		if err != nil {
+			return flowNormal, err
+		}
+		for _, c := range s.Cases {
+			caseValue, err := ParseYulLiteralValue(&c.Value)
+			if err != nil {
+				return flowNormal, err
+			}
+			if caseValue.Cmp(value) == 0 {
+				if in.Profile != nil {
+					in.Profile.RecordCase(s.Location, caseValue)
+				}
+				return in.execBlock(c.Body)
+			}
+		}
+		if in.Profile != nil {
+			in.Profile.RecordCase(s.Location, nil)
+		}
+		return in.execBlock(s.Default)
+
+	case *YulFor:
+		return in.execFor(s)
+
+	case *YulFunctionDef:
+		return flowNormal, nil
+
+	case *YulBreak:
+		return flowBreak, nil
+	case *YulContinue:
+		return flowContinue, nil
+	case *YulLeave:
+		return flowLeave, nil
+	}
+
+	return flowNormal, fmt.Errorf("unsupported statement type: %T", stmt)
+}
+
+// execFor runs a for loop; variables declared in the init block stay
+// visible to the condition, post block and body
+func (in *YulInterpreter) execFor(loop *YulFor) (controlFlow, error) {
+	in.pushScope()
+	defer in.popScope()
+
+	if loop.Init != nil {
+		for _, stmt := range loop.Init.Statements {
+			flow, err := in.execStatement(stmt)
+			if err != nil || flow != flowNormal {
+				return flow, err
+			}
+		}
+	}
+
+	for {
+		if err := in.step(); err != nil {
+			return flowNormal, err
+		}
+		cond, err := in.eval(loop.Condition)
+		if err != nil {
+			return flowNormal, err
+		}
+		if cond.Sign() == 0 {
+			return flowNormal, nil
+		}
+
+		flow, err := in.execBlock(loop.Body)
+		if err != nil {
+			return flowNormal, err
+		}
+		switch flow {
+		case flowBreak:
+			return flowNormal, nil
+		case flowLeave:
+			return flowLeave, nil
+		}
+
+		if flow, err := in.execBlock(loop.Post); err != nil || flow == flowLeave {
+			return flow, err
+		}
+	}
+}
+
+func (in *YulInterpreter) pushScope() {
+	in.scopes = append(in.scopes, make(map[string]*big.Int))
+	in.recordDelta(StateDelta{Kind: DeltaScopeEnter})
+}
+
+func (in *YulInterpreter) popScope() {
+	in.recordScopeExit()
+	in.scopes = in.scopes[:len(in.scopes)-1]
+}
+
+// declare creates a variable in the innermost scope
+func (in *YulInterpreter) declare(name string, value *big.Int) {
+	top := len(in.scopes) - 1
+	old := in.scopes[top][name] // nil when newly declared
+	in.scopes[top][name] = value
+	in.recordDelta(StateDelta{Kind: DeltaVariable, Scope: top, Name: name, Old: old, New: value})
+}
+
+func (in *YulInterpreter) assign(name string, value *big.Int) error {
+	for i := len(in.scopes) - 1; i >= 0; i-- {
+		if old, ok := in.scopes[i][name]; ok {
+			in.scopes[i][name] = value
+			in.recordDelta(StateDelta{Kind: DeltaVariable, Scope: i, Name: name, Old: old, New: value})
+			return nil
+		}
+	}
+	return fmt.Errorf("assignment to undeclared variable: %s", name)
+}
+
+// storeWord writes a storage slot
+func (in *YulInterpreter) storeWord(slot, value *big.Int) error {
+	in.storageWrites++
+	if err := in.checkLimit(LimitStorageWrites, in.storageWrites); err != nil {
+		return err
+	}
+
+	key := storageKey(slot)
+	old := in.Storage[key] // nil when never written
+	in.Storage[key] = value
+	in.recordDelta(StateDelta{Kind: DeltaStorage, Name: key, Old: old, New: value})
+	return nil
+}
+
+// loadWord reads a storage slot; unwritten slots are zero
+func (in *YulInterpreter) loadWord(slot *big.Int) *big.Int {
+	if value, ok := in.Storage[storageKey(slot)]; ok {
+		return value
+	}
+	return big.NewInt(0)
+}
+
+// eval evaluates an expression that must produce exactly one value
+func (in *YulInterpreter) eval(expr YulExpression) (*big.Int, error) {
+	results, err := in.evalMulti(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != 1 {
+		return nil, fmt.Errorf("expression yields %d values where one is expected", len(results))
+	}
+	return results[0], nil
+}
+
+func (in *YulInterpreter) evalMulti(expr YulExpression) ([]*big.Int, error) {
+	if err := in.step(); err != nil {
+		return nil, err
+	}
+
+	switch e := expr.(type) {
+	case *YulLiteral:
+		value, err := ParseYulLiteralValue(e)
+		if err != nil {
+			return nil, err
+		}
+		return []*big.Int{value}, nil
+
+	case *YulIdentifier:
+		value, ok := in.Lookup(e.Name)
+		if !ok {
+			return nil, fmt.Errorf("undefined variable: %s", e.Name)
+		}
+		return []*big.Int{value}, nil
+
+	case *YulFunctionCall:
+		// Yul evaluates arguments right to left
+		args := make([]*big.Int, len(e.Arguments))
+		for i := len(e.Arguments) - 1; i >= 0; i-- {
+			value, err := in.eval(e.Arguments[i])
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+
+		name := e.FunctionName.Name
+		if _, ok := in.functions[name]; ok {
+			return in.CallFunction(name, args)
+		}
+		if isPureBuiltin(name) {
+			value, err := EvaluatePureBuiltin(name, args)
+			if err != nil {
+				return nil, err
+			}
+			return []*big.Int{value}, nil
+		}
+		if in.Restricted {
+			return nil, fmt.Errorf("%w: %s", ErrImpureOperation, name)
+		}
+		return in.evalEffectBuiltin(name, args)
+	}
+
+	return nil, fmt.Errorf("unsupported expression type: %T", expr)
+}
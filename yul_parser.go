@@ -1,8 +1,10 @@
 package main
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
@@ -11,6 +13,12 @@ import (
 // YulParser handles parsing of Yul intermediate representation into an AST
 type YulParser struct {
 	lexer    *YulLexer
+	file     string  // Name of the source in positions
+	tokens   []Token // Tokens read ahead of current, from the lexer
+	pos      int     // Index of the token after current
+	marks    int     // Open marks; tokens are kept while one may rewind
+	lexErr   *ParseError
+	dialect  *Dialect // Builtins calls may name, nil for all
 	current  Token
 	previous Token
 }
@@ -20,6 +28,7 @@ type YulAST struct {
 	Objects   []*YulObject         `json:"objects"`
 	Functions []*YulFunctionDef    `json:"functions"`
 	Metadata  *YulMetadata         `json:"metadata"`
+	Suppressions []Suppression     `json:"suppressions,omitempty"` // yul-disable-next-line comments
 }
 
 // YulObject represents a Yul object (contract or code block)
@@ -27,8 +36,8 @@ type YulObject struct {
 	Name     string              `json:"name"`
 	Type     YulObjectType       `json:"type"`
 	Code     *YulBlock           `json:"code,omitempty"`
-	Data     *YulData            `json:"data,omitempty"`
-	Objects  map[string]*YulObject `json:"objects,omitempty"`
+	Data     *OrderedMap[*YulData] `json:"data,omitempty"` // Named data segments in source order
+	Objects  *OrderedMap[*YulObject] `json:"objects,omitempty"` // Nested objects in source order
 	Location SourcePosition      `json:"location"`
 }
 
@@ -163,7 +172,11 @@ type (
 		Location SourcePosition `json:"location"`
 	}
 
+	// YulData is a named data segment. Hex payloads keep their digits
+	// without the hex"..." wrapper.
 	YulData struct {
+		Name     string         `json:"name"`
+		Kind     YulLiteralKind `json:"kind"` // LiteralKindString or LiteralKindHex
 		Value    string         `json:"value"`
 		Location SourcePosition `json:"location"`
 	}
@@ -175,8 +188,11 @@ type (
 	}
 
 	CompilerInfo struct {
-		Version string `json:"version"`
-		Target  string `json:"target"`
+		Version   string   `json:"version"`
+		Target    string   `json:"target"`
+		Profile   string   `json:"profile,omitempty"`    // Optimization goal of the build
+		BuildMode string   `json:"build_mode,omitempty"` // release or staging
+		Features  []string `json:"features,omitempty"`   // Artifact features tools must understand
 	}
 )
 
@@ -205,6 +221,7 @@ const (
 	ObjectTypeContract YulObjectType = "contract"
 	ObjectTypeLibrary  YulObjectType = "library"
 	ObjectTypeRuntime  YulObjectType = "runtime"
+	ObjectTypeCode     YulObjectType = "code" // A source that is a bare code block
 )
 
 type YulDataType string
@@ -216,6 +233,44 @@ const (
 	DataTypeString  YulDataType = "string"
 )
 
+// ParseYulType maps a Yul type name such as u256, s32 or bool to its data type
+func ParseYulType(name string) (YulDataType, error) {
+	switch name {
+	case "bool":
+		return DataTypeBool, nil
+	case "u256":
+		return DataTypeUint256, nil
+	}
+	if len(name) > 1 && (name[0] == 'u' || name[0] == 's') {
+		switch bits := name[1:]; bits {
+		case "8", "16", "32", "64", "128", "256":
+			if name[0] == 'u' {
+				return YulDataType("uint" + bits), nil
+			}
+			return YulDataType("int" + bits), nil
+		}
+	}
+	return "", fmt.Errorf("unknown type %q", name)
+}
+
+// BitWidth returns the width of an integer type, 0 for other types
+func (t YulDataType) BitWidth() int {
+	name := strings.TrimPrefix(strings.TrimPrefix(string(t), "u"), "int")
+	if name == string(t) {
+		return 0
+	}
+	bits, err := strconv.Atoi(name)
+	if err != nil {
+		return 0
+	}
+	return bits
+}
+
+// Signed reports whether t is a signed integer type
+func (t YulDataType) Signed() bool {
+	return strings.HasPrefix(string(t), "int") && t.BitWidth() > 0
+}
+
 type YulLiteralKind string
 const (
 	LiteralKindNumber YulLiteralKind = "number"
@@ -232,6 +287,67 @@ type SourcePosition struct {
 	Length int    `json:"length"`
 }
 
+// ParseError is a syntax error with the offending token and source line
+type ParseError struct {
+	Position SourcePosition
+	Expected TokenType // Token the parser required, "" when several would do
+	Got      TokenType
+	Lexeme   string
+	Message  string
+	Snippet  string // Offending source line and a caret under the column
+	Err      error  // Lexer error, if the source could not be tokenized
+	Code     string // Diagnostic code, CodeSyntax when empty
+}
+
+func (e *ParseError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	got := string(e.Got)
+	if e.Lexeme != "" && e.Lexeme != got {
+		got = fmt.Sprintf("%s %q", e.Got, e.Lexeme)
+	}
+	if got == "" {
+		return fmt.Sprintf("%s at line %d, column %d", e.Message, e.Position.Line, e.Position.Column)
+	}
+	return fmt.Sprintf("%s at line %d, column %d, got %s", e.Message, e.Position.Line, e.Position.Column, got)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// sourceSnippet returns the given line of source with a caret marking column
+func sourceSnippet(source string, line, column int) string {
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return markColumn(lines[line-1], column)
+}
+
+// markColumn returns a line of source with a caret marking column
+func markColumn(text string, column int) string {
+	text = strings.TrimRight(text, "\r")
+	if column < 1 {
+		column = 1
+	}
+	// Keep tabs so the caret lines up under the offending token; columns
+	// count characters
+	indent := []rune{}
+	for _, r := range text {
+		if len(indent) >= column-1 {
+			break
+		}
+		if r == '\t' {
+			indent = append(indent, '\t')
+		} else {
+			indent = append(indent, ' ')
+		}
+	}
+	return text + "\n" + string(indent) + "^"
+}
+
 // YulVisitor interface for AST traversal
 type YulVisitor interface {
 	VisitObject(*YulObject) error
@@ -258,24 +374,65 @@ func NewYulParser() *YulParser {
 	}
 }
 
-// Parse parses Yul source code into an AST
+// InlineSource names a source that does not come from a file
+const InlineSource = "inline"
+
+// ParseFile parses the Yul source of the named file, which its positions
+// carry
+func (p *YulParser) ParseFile(file, source string) (*YulAST, error) {
+	p.file = file
+	defer func() { p.file = "" }()
+	return p.Parse(source)
+}
+
+// fileName returns the name positions carry
+func (p *YulParser) fileName() string {
+	if p.file == "" {
+		return InlineSource
+	}
+	return p.file
+}
+
+// Parse parses Yul source code into an AST. It never panics: syntax errors
+// are returned as *ParseError.
 func (p *YulParser) Parse(source string) (*YulAST, error) {
+	return p.parse(func() error { return p.lexer.Init(source) })
+}
+
+// ParseReader parses the Yul source read from r. The source is tokenized
+// as the parser goes, so it is never held in memory as a whole.
+func (p *YulParser) ParseReader(r io.Reader) (*YulAST, error) {
+	return p.parse(func() error { return p.lexer.InitReader(r) })
+}
+
+// parse parses the source the lexer is initialized with by init. Tokens
+// are read from the lexer on demand; the parser looks one token past
+// current, and further only while a mark is open.
+func (p *YulParser) parse(init func() error) (ast *YulAST, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ast, err = nil, p.errorAt(p.current, fmt.Sprintf("internal parser error: %v", r))
+		}
+	}()
+
 	// Initialize lexer with source
-	err := p.lexer.Init(source)
+	err = init()
 	if err != nil {
 		return nil, fmt.Errorf("lexer initialization failed: %w", err)
 	}
 
 	// Start parsing
+	p.tokens, p.pos, p.marks, p.lexErr = p.tokens[:0], 0, 0, nil
+	p.current, p.previous = Token{}, Token{}
 	p.advance() // Load first token
 	
-	ast := &YulAST{
+	ast = &YulAST{
 		Objects:   []*YulObject{},
 		Functions: []*YulFunctionDef{},
 		Metadata: &YulMetadata{
-			SourceFile: "inline",
+			SourceFile: p.fileName(),
 			CompilerInfo: &CompilerInfo{
-				Version: "1.0.0",
+				Version: CompilerVersion,
 				Target:  "NeoVM",
 			},
 		},
@@ -295,29 +452,70 @@ func (p *YulParser) Parse(source string) (*YulAST, error) {
 				return nil, err
 			}
 			ast.Functions = append(ast.Functions, fn)
+		} else if p.check(TokenLeftBrace) && len(ast.Objects) == 0 {
+			obj, err := p.parseCodeObject()
+			if err != nil {
+				return nil, err
+			}
+			ast.Objects = append(ast.Objects, obj)
 		} else {
-			return nil, fmt.Errorf("unexpected token %v at line %d", p.current.Type, p.current.Line)
+			return nil, p.errorAt(p.current, "unexpected token")
 		}
 	}
 
+	for _, suppression := range p.lexer.suppressions {
+		suppression.File = diagnosticFile(SourcePosition{File: p.fileName()})
+		ast.Suppressions = append(ast.Suppressions, suppression)
+	}
+
+	if err := p.checkBuiltins(ast); err != nil {
+		return nil, err
+	}
 	return ast, nil
 }
 
+// parseCodeObject parses a source that is a bare code block, as the code
+// of an object named "object"
+func (p *YulParser) parseCodeObject() (*YulObject, error) {
+	startPos := p.current.Position
+	p.advance()
+	code, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	return &YulObject{
+		Name:     "object",
+		Type:     ObjectTypeCode,
+		Code:     code,
+		Data:     NewOrderedMap[*YulData](),
+		Objects:  NewOrderedMap[*YulObject](),
+		Location: p.makePosition(startPos),
+	}, nil
+}
+
 // parseObject parses a Yul object definition
 func (p *YulParser) parseObject() (*YulObject, error) {
 	startPos := p.current.Position
 	
-	p.consume(TokenObject, "Expected 'object'")
+	if _, err := p.consume(TokenObject, "Expected 'object'"); err != nil {
+		return nil, err
+	}
 	
-	name := p.consume(TokenString, "Expected object name").Lexeme
-	name = strings.Trim(name, `"`) // Remove quotes
+	nameToken, err := p.consume(TokenString, "Expected object name")
+	if err != nil {
+		return nil, err
+	}
+	name := strings.Trim(nameToken.Lexeme, `"`) // Remove quotes
 	
-	p.consume(TokenLeftBrace, "Expected '{'")
+	if _, err := p.consume(TokenLeftBrace, "Expected '{'"); err != nil {
+		return nil, err
+	}
 	
 	obj := &YulObject{
 		Name:     name,
 		Type:     ObjectTypeContract,
-		Objects:  make(map[string]*YulObject),
+		Objects:  NewOrderedMap[*YulObject](),
+		Data:     NewOrderedMap[*YulData](),
 		Location: p.makePosition(startPos),
 	}
 
@@ -325,7 +523,9 @@ func (p *YulParser) parseObject() (*YulObject, error) {
 	for !p.check(TokenRightBrace) && !p.isAtEnd() {
 		if p.check(TokenCode) {
 			p.advance() // consume 'code'
-			p.consume(TokenLeftBrace, "Expected '{'")
+			if _, err := p.consume(TokenLeftBrace, "Expected '{'"); err != nil {
+				return nil, err
+			}
 			
 			block, err := p.parseBlock()
 			if err != nil {
@@ -334,26 +534,31 @@ func (p *YulParser) parseObject() (*YulObject, error) {
 			obj.Code = block
 			
 		} else if p.check(TokenData) {
-			p.advance() // consume 'data'
+			nameToken := p.peek()
 			data, err := p.parseData()
 			if err != nil {
 				return nil, err
 			}
-			obj.Data = data
+			if _, exists := obj.Data.Get(data.Name); exists {
+				return nil, p.errorAt(nameToken, fmt.Sprintf("duplicate data segment %q", data.Name))
+			}
+			obj.Data.Set(data.Name, data)
 			
 		} else if p.check(TokenObject) {
 			nestedObj, err := p.parseObject()
 			if err != nil {
 				return nil, err
 			}
-			obj.Objects[nestedObj.Name] = nestedObj
+			obj.Objects.Set(nestedObj.Name, nestedObj)
 			
 		} else {
-			return nil, fmt.Errorf("unexpected token in object body: %v", p.current.Type)
+			return nil, p.errorAt(p.current, "unexpected token in object body")
 		}
 	}
 	
-	p.consume(TokenRightBrace, "Expected '}'")
+	if _, err := p.consume(TokenRightBrace, "Expected '}'"); err != nil {
+		return nil, err
+	}
 	return obj, nil
 }
 
@@ -376,7 +581,9 @@ func (p *YulParser) parseBlock() (*YulBlock, error) {
 		}
 	}
 
-	p.consume(TokenRightBrace, "Expected '}'")
+	if _, err := p.consume(TokenRightBrace, "Expected '}'"); err != nil {
+		return nil, err
+	}
 	return block, nil
 }
 
@@ -400,16 +607,13 @@ func (p *YulParser) parseStatement() (YulStatement, error) {
 	case TokenLeave:
 		return p.parseLeave()
 	case TokenLeftBrace:
-		// Block statement
+		// Block statement, a scope of its own
 		p.advance()
 		block, err := p.parseBlock()
 		if err != nil {
 			return nil, err
 		}
-		return &YulExpressionStatement{
-			Expression: nil, // Blocks don't have expressions
-			Location:   block.Location,
-		}, nil
+		return block, nil
 	default:
 		// Try to parse as expression statement or assignment
 		return p.parseExpressionOrAssignment()
@@ -419,19 +623,20 @@ func (p *YulParser) parseStatement() (YulStatement, error) {
 // parseVariableDeclaration parses variable declarations
 func (p *YulParser) parseVariableDeclaration() (*YulVariableDeclaration, error) {
 	startPos := p.current.Position
-	p.consume(TokenLet, "Expected 'let'")
+	if _, err := p.consume(TokenLet, "Expected 'let'"); err != nil {
+		return nil, err
+	}
 
 	var variables []*YulTypedName
 	
 	// Parse variable list
 	for {
-		name := p.consume(TokenIdentifier, "Expected variable name").Lexeme
-		variables = append(variables, &YulTypedName{
-			Name:     name,
-			Type:     DataTypeUint256, // Default type
-			Location: p.makePosition(p.previous.Position),
-		})
-		
+		variable, err := p.parseTypedName("Expected variable name")
+		if err != nil {
+			return nil, err
+		}
+		variables = append(variables, variable)
+
 		if !p.match(TokenComma) {
 			break
 		}
@@ -457,14 +662,18 @@ func (p *YulParser) parseVariableDeclaration() (*YulVariableDeclaration, error)
 // parseIf parses if statements
 func (p *YulParser) parseIf() (*YulIf, error) {
 	startPos := p.current.Position
-	p.consume(TokenIf, "Expected 'if'")
+	if _, err := p.consume(TokenIf, "Expected 'if'"); err != nil {
+		return nil, err
+	}
 
 	condition, err := p.parseExpression()
 	if err != nil {
 		return nil, err
 	}
 
-	p.consume(TokenLeftBrace, "Expected '{'")
+	if _, err := p.consume(TokenLeftBrace, "Expected '{'"); err != nil {
+		return nil, err
+	}
 	body, err := p.parseBlock()
 	if err != nil {
 		return nil, err
@@ -480,7 +689,9 @@ func (p *YulParser) parseIf() (*YulIf, error) {
 // parseSwitch parses switch statements
 func (p *YulParser) parseSwitch() (*YulSwitch, error) {
 	startPos := p.current.Position
-	p.consume(TokenSwitch, "Expected 'switch'")
+	if _, err := p.consume(TokenSwitch, "Expected 'switch'"); err != nil {
+		return nil, err
+	}
 
 	expr, err := p.parseExpression()
 	if err != nil {
@@ -489,11 +700,28 @@ func (p *YulParser) parseSwitch() (*YulSwitch, error) {
 
 	var cases []*YulCase
 	var defaultCase *YulBlock
+	seen := make(map[string]bool)
 
 	for p.check(TokenCase) || p.check(TokenDefault) {
 		if p.match(TokenCase) {
-			value := p.consume(TokenNumber, "Expected case value")
-			p.consume(TokenLeftBrace, "Expected '{'")
+			value, err := p.parseCaseValue()
+			if err != nil {
+				return nil, err
+			}
+
+			// Case values must be distinct as words, so 1 and 0x01 collide
+			word, err := ParseYulLiteralValue(value)
+			if err != nil {
+				return nil, err
+			}
+			if seen[word.String()] {
+				return nil, p.errorAt(p.previous, fmt.Sprintf("Duplicate case value %s", value.Value))
+			}
+			seen[word.String()] = true
+
+			if _, err := p.consume(TokenLeftBrace, "Expected '{'"); err != nil {
+				return nil, err
+			}
 			
 			body, err := p.parseBlock()
 			if err != nil {
@@ -501,17 +729,14 @@ func (p *YulParser) parseSwitch() (*YulSwitch, error) {
 			}
 
 			cases = append(cases, &YulCase{
-				Value: YulLiteral{
-					Kind:     LiteralKindNumber,
-					Value:    value.Lexeme,
-					Type:     DataTypeUint256,
-					Location: p.makePosition(value.Position),
-				},
+				Value:    *value,
 				Body:     body,
-				Location: p.makePosition(value.Position),
+				Location: value.Location,
 			})
 		} else if p.match(TokenDefault) {
-			p.consume(TokenLeftBrace, "Expected '{'")
+			if _, err := p.consume(TokenLeftBrace, "Expected '{'"); err != nil {
+				return nil, err
+			}
 			defaultCase, err = p.parseBlock()
 			if err != nil {
 				return nil, err
@@ -527,12 +752,39 @@ func (p *YulParser) parseSwitch() (*YulSwitch, error) {
 	}, nil
 }
 
+// parseCaseValue parses a case label: a number, hex, string or bool
+// literal with an optional type suffix
+func (p *YulParser) parseCaseValue() (*YulLiteral, error) {
+	switch p.current.Type {
+	case TokenNumber, TokenHex, TokenString, TokenHexString, TokenTrue, TokenFalse:
+	default:
+		return nil, p.errorAt(p.current, "Expected case value")
+	}
+
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	value := expr.(*YulLiteral)
+	if p.match(TokenColon) {
+		value.Type, err = p.parseTypeName()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
 // parseFor parses for loops
 func (p *YulParser) parseFor() (*YulFor, error) {
 	startPos := p.current.Position
-	p.consume(TokenFor, "Expected 'for'")
+	if _, err := p.consume(TokenFor, "Expected 'for'"); err != nil {
+		return nil, err
+	}
 
-	p.consume(TokenLeftBrace, "Expected '{'")
+	if _, err := p.consume(TokenLeftBrace, "Expected '{'"); err != nil {
+		return nil, err
+	}
 	init, err := p.parseBlock()
 	if err != nil {
 		return nil, err
@@ -543,13 +795,17 @@ func (p *YulParser) parseFor() (*YulFor, error) {
 		return nil, err
 	}
 
-	p.consume(TokenLeftBrace, "Expected '{'")
+	if _, err := p.consume(TokenLeftBrace, "Expected '{'"); err != nil {
+		return nil, err
+	}
 	post, err := p.parseBlock()
 	if err != nil {
 		return nil, err
 	}
 
-	p.consume(TokenLeftBrace, "Expected '{'")
+	if _, err := p.consume(TokenLeftBrace, "Expected '{'"); err != nil {
+		return nil, err
+	}
 	body, err := p.parseBlock()
 	if err != nil {
 		return nil, err
@@ -567,47 +823,57 @@ func (p *YulParser) parseFor() (*YulFor, error) {
 // parseFunction parses function definitions
 func (p *YulParser) parseFunction() (*YulFunctionDef, error) {
 	startPos := p.current.Position
-	p.consume(TokenFunction, "Expected 'function'")
+	if _, err := p.consume(TokenFunction, "Expected 'function'"); err != nil {
+		return nil, err
+	}
 
-	name := p.consume(TokenIdentifier, "Expected function name").Lexeme
+	nameToken, err := p.consumeName("Expected function name")
+	if err != nil {
+		return nil, err
+	}
+	name := nameToken.Lexeme
 
-	p.consume(TokenLeftParen, "Expected '('")
+	if _, err := p.consume(TokenLeftParen, "Expected '('"); err != nil {
+		return nil, err
+	}
 	
 	var parameters []*YulTypedName
 	if !p.check(TokenRightParen) {
 		for {
-			paramName := p.consume(TokenIdentifier, "Expected parameter name").Lexeme
-			parameters = append(parameters, &YulTypedName{
-				Name:     paramName,
-				Type:     DataTypeUint256,
-				Location: p.makePosition(p.previous.Position),
-			})
-			
+			param, err := p.parseTypedName("Expected parameter name")
+			if err != nil {
+				return nil, err
+			}
+			parameters = append(parameters, param)
+
 			if !p.match(TokenComma) {
 				break
 			}
 		}
 	}
 	
-	p.consume(TokenRightParen, "Expected ')'")
+	if _, err := p.consume(TokenRightParen, "Expected ')'"); err != nil {
+		return nil, err
+	}
 
 	var returns []*YulTypedName
 	if p.match(TokenArrow) {
 		for {
-			returnName := p.consume(TokenIdentifier, "Expected return variable name").Lexeme
-			returns = append(returns, &YulTypedName{
-				Name:     returnName,
-				Type:     DataTypeUint256,
-				Location: p.makePosition(p.previous.Position),
-			})
-			
+			ret, err := p.parseTypedName("Expected return variable name")
+			if err != nil {
+				return nil, err
+			}
+			returns = append(returns, ret)
+
 			if !p.match(TokenComma) {
 				break
 			}
 		}
 	}
 
-	p.consume(TokenLeftBrace, "Expected '{'")
+	if _, err := p.consume(TokenLeftBrace, "Expected '{'"); err != nil {
+		return nil, err
+	}
 	body, err := p.parseBlock()
 	if err != nil {
 		return nil, err
@@ -622,6 +888,41 @@ func (p *YulParser) parseFunction() (*YulFunctionDef, error) {
 	}, nil
 }
 
+// parseTypedName parses a name with an optional type suffix, e.g. "x:u32".
+// Untyped names default to u256.
+func (p *YulParser) parseTypedName(message string) (*YulTypedName, error) {
+	name, err := p.consumeName(message)
+	if err != nil {
+		return nil, err
+	}
+	typed := &YulTypedName{
+		Name:     name.Lexeme,
+		Type:     DataTypeUint256,
+		Location: p.makePosition(name.Position),
+	}
+	if p.match(TokenColon) {
+		dataType, err := p.parseTypeName()
+		if err != nil {
+			return nil, err
+		}
+		typed.Type = dataType
+	}
+	return typed, nil
+}
+
+// parseTypeName parses the type after a ':'
+func (p *YulParser) parseTypeName() (YulDataType, error) {
+	token, err := p.consume(TokenIdentifier, "Expected type name")
+	if err != nil {
+		return "", err
+	}
+	dataType, err := ParseYulType(token.Lexeme)
+	if err != nil {
+		return "", p.errorAt(token, err.Error())
+	}
+	return dataType, nil
+}
+
 // parseExpression parses expressions
 func (p *YulParser) parseExpression() (YulExpression, error) {
 	return p.parseCall()
@@ -629,7 +930,7 @@ func (p *YulParser) parseExpression() (YulExpression, error) {
 
 // parseCall parses function calls
 func (p *YulParser) parseCall() (YulExpression, error) {
-	if p.check(TokenIdentifier) {
+	if isCallableToken(p.current.Type) {
 		startPos := p.current.Position
 		name := p.advance().Lexeme
 		
@@ -651,7 +952,9 @@ func (p *YulParser) parseCall() (YulExpression, error) {
 				}
 			}
 			
-			p.consume(TokenRightParen, "Expected ')'")
+			if _, err := p.consume(TokenRightParen, "Expected ')'"); err != nil {
+				return nil, err
+			}
 			
 			return &YulFunctionCall{
 				FunctionName: YulIdentifier{
@@ -671,7 +974,31 @@ func (p *YulParser) parseCall() (YulExpression, error) {
 		}
 	}
 	
-	return p.parsePrimary()
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	// Typed literal, e.g. "1:u32"
+	if p.match(TokenColon) {
+		dataType, err := p.parseTypeName()
+		if err != nil {
+			return nil, err
+		}
+		expr.(*YulLiteral).Type = dataType
+	}
+	return expr, nil
+}
+
+// isCallableToken reports whether a token can name a function or variable.
+// The lexer classifies built-ins such as add or sstore by category.
+func isCallableToken(tokenType TokenType) bool {
+	switch tokenType {
+	case TokenIdentifier, TokenArithmetic, TokenComparison, TokenBitwise,
+		TokenMemory, TokenStorage, TokenEnvironment, TokenControl:
+		return true
+	}
+	return false
 }
 
 // parsePrimary parses primary expressions (literals)
@@ -715,6 +1042,20 @@ func (p *YulParser) parsePrimary() (YulExpression, error) {
 			Location: p.makePosition(startPos),
 		}, nil
 		
+	case TokenHexString:
+		// A string literal given by the hex of its bytes
+		token := p.advance()
+		value, err := hex.DecodeString(token.Lexeme)
+		if err != nil {
+			return nil, p.errorAt(token, "invalid hex string")
+		}
+		return &YulLiteral{
+			Kind:     LiteralKindString,
+			Value:    string(value),
+			Type:     DataTypeString,
+			Location: p.makePosition(startPos),
+		}, nil
+
 	case TokenHex:
 		value := p.advance().Lexeme
 		return &YulLiteral{
@@ -725,7 +1066,7 @@ func (p *YulParser) parsePrimary() (YulExpression, error) {
 		}, nil
 	}
 
-	return nil, fmt.Errorf("unexpected token: %v", p.current.Type)
+	return nil, p.errorAt(p.current, "unexpected token")
 }
 
 // parseExpressionOrAssignment parses expression statements or assignments
@@ -733,16 +1074,23 @@ func (p *YulParser) parseExpressionOrAssignment() (YulStatement, error) {
 	startPos := p.current.Position
 	
 	// Try to parse as assignment first
-	if p.check(TokenIdentifier) {
-		checkpoint := p.current
+	if isCallableToken(p.current.Type) {
+		mark := p.mark()
 		names := []string{p.advance().Lexeme}
 		
 		// Check for multiple assignment targets
 		for p.match(TokenComma) {
-			names = append(names, p.consume(TokenIdentifier, "Expected identifier").Lexeme)
+			name, err := p.consumeName("Expected identifier")
+			if err != nil {
+				p.release(mark, false)
+				return nil, err
+			}
+			names = append(names, name.Lexeme)
 		}
 		
-		if p.match(TokenColonEqual) {
+		assignment := p.match(TokenColonEqual)
+		p.release(mark, !assignment)
+		if assignment {
 			// This is an assignment
 			value, err := p.parseExpression()
 			if err != nil {
@@ -754,10 +1102,8 @@ func (p *YulParser) parseExpressionOrAssignment() (YulStatement, error) {
 				Value:         value,
 				Location:      p.makePosition(startPos),
 			}, nil
-		} else {
-			// Backtrack and parse as expression
-			p.current = checkpoint
 		}
+		// Not an assignment: the mark rewound to parse an expression
 	}
 
 	// Parse as expression statement
@@ -775,40 +1121,127 @@ func (p *YulParser) parseExpressionOrAssignment() (YulStatement, error) {
 // Helper parsing methods
 func (p *YulParser) parseBreak() (*YulBreak, error) {
 	pos := p.current.Position
-	p.consume(TokenBreak, "Expected 'break'")
+	if _, err := p.consume(TokenBreak, "Expected 'break'"); err != nil {
+		return nil, err
+	}
 	return &YulBreak{Location: p.makePosition(pos)}, nil
 }
 
 func (p *YulParser) parseContinue() (*YulContinue, error) {
 	pos := p.current.Position
-	p.consume(TokenContinue, "Expected 'continue'")
+	if _, err := p.consume(TokenContinue, "Expected 'continue'"); err != nil {
+		return nil, err
+	}
 	return &YulContinue{Location: p.makePosition(pos)}, nil
 }
 
 func (p *YulParser) parseLeave() (*YulLeave, error) {
 	pos := p.current.Position
-	p.consume(TokenLeave, "Expected 'leave'")
+	if _, err := p.consume(TokenLeave, "Expected 'leave'"); err != nil {
+		return nil, err
+	}
 	return &YulLeave{Location: p.makePosition(pos)}, nil
 }
 
+// parseData parses a data segment, e.g. data "table" hex"00ff"
 func (p *YulParser) parseData() (*YulData, error) {
 	pos := p.current.Position
-	value := p.consume(TokenString, "Expected data value").Lexeme
-	return &YulData{
-		Value:    value,
+	if _, err := p.consume(TokenData, "Expected 'data'"); err != nil {
+		return nil, err
+	}
+	name, err := p.consume(TokenString, "Expected data name")
+	if err != nil {
+		return nil, err
+	}
+	data := &YulData{
+		Name:     name.Lexeme,
+		Kind:     LiteralKindString,
 		Location: p.makePosition(pos),
-	}, nil
+	}
+
+	var value Token
+	if p.check(TokenHexString) {
+		value = p.advance()
+		data.Kind = LiteralKindHex
+	} else if value, err = p.consume(TokenString, "Expected data value"); err != nil {
+		return nil, err
+	}
+	data.Value = value.Lexeme
+	if _, err := data.Bytes(); err != nil {
+		return nil, p.errorAt(value, err.Error())
+	}
+	return data, nil
 }
 
 // Utility methods
 func (p *YulParser) advance() Token {
 	if !p.isAtEnd() {
 		p.previous = p.current
-		p.current = p.lexer.NextToken()
+		p.current = p.peek()
+		p.pos++
+		if p.marks == 0 {
+			// Nothing can rewind to the tokens before pos
+			n := copy(p.tokens, p.tokens[p.pos:])
+			p.tokens, p.pos = p.tokens[:n], 0
+		}
 	}
 	return p.previous
 }
 
+// peek returns the token after current without consuming it, reading it
+// from the lexer when needed
+func (p *YulParser) peek() Token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	if p.lexErr == nil {
+		token, err := p.lexer.Next()
+		if err == nil {
+			p.tokens = append(p.tokens, token)
+			return token
+		}
+		p.lexErr = &ParseError{
+			Position: SourcePosition{File: p.fileName(), Line: p.lexer.startLine, Column: p.lexer.startColumn, Offset: p.lexer.start},
+			Got:      TokenError,
+			Message:  "unexpected token",
+			Snippet:  p.lexer.Snippet(p.lexer.startLine, p.lexer.startColumn),
+			Err:      err,
+			Code:     CodeLexical,
+		}
+	}
+	// The lexer cannot go on past an invalid token
+	position := p.lexErr.Position
+	token := Token{
+		Type:     TokenError,
+		Line:     position.Line,
+		Column:   position.Column,
+		Position: TokenPosition{Line: position.Line, Column: position.Column, EndLine: position.Line, EndColumn: position.Column, Offset: position.Offset},
+	}
+	p.tokens = append(p.tokens, token)
+	return token
+}
+
+// parserMark is a point of the token stream the parser may rewind to
+type parserMark struct {
+	pos               int
+	current, previous Token
+}
+
+// mark opens a mark at current; tokens read ahead are kept until it is
+// released
+func (p *YulParser) mark() parserMark {
+	p.marks++
+	return parserMark{p.pos, p.current, p.previous}
+}
+
+// release closes mark, rewinding to it when rewind is set
+func (p *YulParser) release(mark parserMark, rewind bool) {
+	p.marks--
+	if rewind {
+		p.pos, p.current, p.previous = mark.pos, mark.current, mark.previous
+	}
+}
+
 func (p *YulParser) check(tokenType TokenType) bool {
 	if p.isAtEnd() {
 		return false
@@ -824,12 +1257,40 @@ func (p *YulParser) match(tokenType TokenType) bool {
 	return false
 }
 
-func (p *YulParser) consume(tokenType TokenType, message string) Token {
+func (p *YulParser) consume(tokenType TokenType, message string) (Token, error) {
 	if p.check(tokenType) {
-		return p.advance()
+		return p.advance(), nil
+	}
+	err := p.errorAt(p.current, message)
+	err.Expected = tokenType
+	return Token{}, err
+}
+
+// consumeName consumes an identifier. Names that the lexer classifies as
+// built-ins are accepted too, since Yul only reserves keywords.
+func (p *YulParser) consumeName(message string) (Token, error) {
+	if isCallableToken(p.current.Type) {
+		return p.advance(), nil
+	}
+	err := p.errorAt(p.current, message)
+	err.Expected = TokenIdentifier
+	return Token{}, err
+}
+
+// errorAt reports a syntax error at token. An invalid token read ahead is
+// reported instead, as it is what stopped the parser.
+func (p *YulParser) errorAt(token Token, message string) *ParseError {
+	if p.lexErr != nil {
+		err := *p.lexErr
+		return &err
+	}
+	return &ParseError{
+		Position: p.makePosition(token.Position),
+		Got:      token.Type,
+		Lexeme:   token.Lexeme,
+		Message:  message,
+		Snippet:  p.lexer.Snippet(token.Position.Line, token.Position.Column),
 	}
-	
-	panic(fmt.Sprintf("%s. Got %v at line %d", message, p.current.Type, p.current.Line))
 }
 
 func (p *YulParser) isAtEnd() bool {
@@ -838,7 +1299,7 @@ func (p *YulParser) isAtEnd() bool {
 
 func (p *YulParser) makePosition(pos TokenPosition) SourcePosition {
 	return SourcePosition{
-		File:   "inline",
+		File:   p.fileName(),
 		Line:   pos.Line,
 		Column: pos.Column,
 		Offset: pos.Offset,
@@ -847,6 +1308,10 @@ func (p *YulParser) makePosition(pos TokenPosition) SourcePosition {
 }
 
 // Implement YulStatement interface methods
+func (b *YulBlock) GetType() YulNodeType   { return NodeTypeBlock }
+func (b *YulBlock) GetLocation() SourcePosition { return b.Location }
+func (b *YulBlock) Accept(visitor YulVisitor) error { return visitor.VisitBlock(b) }
+
 func (s *YulExpressionStatement) GetType() YulNodeType   { return NodeTypeExpressionStatement }
 func (s *YulExpressionStatement) GetLocation() SourcePosition { return s.Location }
 func (s *YulExpressionStatement) Accept(visitor YulVisitor) error { return visitor.VisitExpressionStatement(s) }
@@ -901,4 +1366,16 @@ func (e *YulIdentifier) Accept(visitor YulVisitor) error { return visitor.VisitI
 func (e *YulLiteral) GetType() YulNodeType      { return NodeTypeLiteral }
 func (e *YulLiteral) GetLocation() SourcePosition    { return e.Location }
 func (e *YulLiteral) GetResultType() YulDataType     { return e.Type }
-func (e *YulLiteral) Accept(visitor YulVisitor) error { return visitor.VisitLiteral(e) }
\ No newline at end of file
+func (e *YulLiteral) Accept(visitor YulVisitor) error { return visitor.VisitLiteral(e) }
+
+// Bytes returns the payload of a data segment
+func (d *YulData) Bytes() ([]byte, error) {
+	if d.Kind != LiteralKindHex {
+		return []byte(d.Value), nil
+	}
+	payload, err := hex.DecodeString(d.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex data %q", d.Value)
+	}
+	return payload, nil
+}
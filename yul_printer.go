@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Yul source regeneration.
+//
+// PrintYul turns an AST back into canonical Yul text, so the output of the
+// normalizer and the optimization passes can be read and diffed as source.
+// The output parses back to the same AST, apart from source locations.
+
+// DefaultYulIndent is the indentation PrintYul uses per nesting level
+const DefaultYulIndent = "    "
+
+// YulPrinter renders ASTs as Yul source
+type YulPrinter struct {
+	Indent string // Indentation per nesting level
+
+	out    *strings.Builder
+	depth  int
+	layout *yulLayout // Comments and blank lines to keep, when formatting
+	fresh  bool       // Nothing written since the last "{"
+}
+
+// NewYulPrinter creates a printer indenting with indent
+func NewYulPrinter(indent string) *YulPrinter {
+	return &YulPrinter{Indent: indent}
+}
+
+// PrintYul renders ast as Yul source with the default indentation
+func PrintYul(ast *YulAST) string {
+	return NewYulPrinter(DefaultYulIndent).Print(ast)
+}
+
+// Print renders every object and top-level function of ast
+func (p *YulPrinter) Print(ast *YulAST) string {
+	p.reset()
+	if ast == nil {
+		return ""
+	}
+	for _, obj := range ast.Objects {
+		p.printObject(obj)
+	}
+	for _, fn := range ast.Functions {
+		p.before(fn.Location.Line)
+		p.line(p.functionHeader(fn) + " " + p.block(fn.Body))
+	}
+	p.rest()
+	return p.out.String()
+}
+
+// PrintBlock renders a single block, e.g. a function body
+func (p *YulPrinter) PrintBlock(block *YulBlock) string {
+	p.reset()
+	return p.block(block)
+}
+
+// PrintExpression renders a single expression
+func (p *YulPrinter) PrintExpression(expr YulExpression) string {
+	return yulExpressionText(expr)
+}
+
+func (p *YulPrinter) reset() {
+	p.out = &strings.Builder{}
+	p.depth = 0
+	p.fresh = true
+}
+
+// line writes text on its own line at the current depth
+func (p *YulPrinter) line(text string) {
+	p.out.WriteString(strings.Repeat(p.Indent, p.depth))
+	p.out.WriteString(text)
+	p.out.WriteByte('\n')
+	p.fresh = false
+}
+
+func (p *YulPrinter) printObject(obj *YulObject) {
+	p.before(obj.Location.Line)
+	if obj.Type == ObjectTypeCode {
+		p.line(p.block(obj.Code))
+		return
+	}
+	p.line("object " + quoteYulString(obj.Name) + " {")
+	p.depth++
+	p.fresh = true
+	if obj.Code != nil {
+		p.before(p.openLine(obj.Code))
+		p.line("code " + p.block(obj.Code))
+	}
+	// Nested objects and data in source order, objects first without one
+	objects, data := obj.Objects.Values(), obj.Data.Values()
+	for len(objects) > 0 || len(data) > 0 {
+		if len(data) == 0 || len(objects) > 0 && objects[0].Location.Offset <= data[0].Location.Offset {
+			p.printObject(objects[0])
+			objects = objects[1:]
+			continue
+		}
+		payload := quoteYulString(data[0].Value)
+		if data[0].Kind == LiteralKindHex {
+			payload = "hex" + payload
+		}
+		p.before(data[0].Location.Line)
+		p.line("data " + quoteYulString(data[0].Name) + " " + payload + p.after(data[0].Location.Line))
+		data = data[1:]
+	}
+	p.before(p.objectCloseLine(obj))
+	p.depth--
+	p.line("}")
+}
+
+// block renders a block starting at the current position; its statements
+// are written one level deeper and the closing brace at the current depth
+func (p *YulPrinter) block(block *YulBlock) string {
+	if block == nil || len(block.Statements) == 0 && !p.commented(p.closeLine(block)) {
+		return "{ }"
+	}
+
+	outer := p.out
+	p.out = &strings.Builder{}
+	p.depth++
+	p.fresh = true
+	for _, stmt := range block.Statements {
+		p.statement(stmt)
+	}
+	p.before(p.closeLine(block))
+	p.depth--
+	body := p.out.String()
+	p.out = outer
+
+	return "{\n" + body + strings.Repeat(p.Indent, p.depth) + "}"
+}
+
+// inlineBlock renders a for-loop header block on one line when it holds at
+// most one statement without nested blocks
+func (p *YulPrinter) inlineBlock(block *YulBlock) string {
+	if block == nil || len(block.Statements) == 0 {
+		return "{ }"
+	}
+	if len(block.Statements) == 1 {
+		switch stmt := block.Statements[0].(type) {
+		case *YulVariableDeclaration, *YulAssignment:
+			return "{ " + p.simpleStatement(stmt) + " }"
+		case *YulExpressionStatement:
+			if stmt.Expression != nil {
+				return "{ " + p.simpleStatement(stmt) + " }"
+			}
+		}
+	}
+	return p.block(block)
+}
+
+func (p *YulPrinter) statement(stmt YulStatement) {
+	line := stmt.GetLocation().Line
+	if block, ok := stmt.(*YulBlock); ok {
+		// A block's location is that of its first token inside
+		line = p.openLine(block)
+	}
+	p.before(line)
+	switch s := stmt.(type) {
+	case *YulIf:
+		p.line("if " + yulExpressionText(s.Condition) + " " + p.block(s.Body))
+	case *YulSwitch:
+		p.line("switch " + yulExpressionText(s.Expression))
+		for _, c := range s.Cases {
+			p.before(c.Location.Line)
+			p.line("case " + yulLiteralText(&c.Value) + " " + p.block(c.Body))
+		}
+		if s.Default != nil {
+			p.before(p.openLine(s.Default))
+			p.line("default " + p.block(s.Default))
+		}
+	case *YulFor:
+		p.line("for " + p.inlineBlock(s.Init) + " " + yulExpressionText(s.Condition) + " " +
+			p.inlineBlock(s.Post) + " " + p.block(s.Body))
+	case *YulFunctionDef:
+		p.line(p.functionHeader(s) + " " + p.block(s.Body))
+	case *YulBlock:
+		p.line(p.block(s))
+	default:
+		p.line(p.simpleStatement(stmt) + p.after(line))
+	}
+}
+
+// simpleStatement renders statements that fit on one line
+func (p *YulPrinter) simpleStatement(stmt YulStatement) string {
+	switch s := stmt.(type) {
+	case *YulVariableDeclaration:
+		names := make([]string, len(s.Variables))
+		for i, v := range s.Variables {
+			names[i] = yulTypedNameText(v)
+		}
+		text := "let " + strings.Join(names, ", ")
+		if s.Value != nil {
+			text += " := " + yulExpressionText(s.Value)
+		}
+		return text
+	case *YulAssignment:
+		return strings.Join(s.VariableNames, ", ") + " := " + yulExpressionText(s.Value)
+	case *YulExpressionStatement:
+		return yulExpressionText(s.Expression)
+	case *YulBreak:
+		return "break"
+	case *YulContinue:
+		return "continue"
+	case *YulLeave:
+		return "leave"
+	}
+	return "/* unsupported statement " + string(stmt.GetType()) + " */"
+}
+
+func (p *YulPrinter) functionHeader(fn *YulFunctionDef) string {
+	params := make([]string, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		params[i] = yulTypedNameText(param)
+	}
+	header := "function " + fn.Name + "(" + strings.Join(params, ", ") + ")"
+	if len(fn.Returns) > 0 {
+		returns := make([]string, len(fn.Returns))
+		for i, ret := range fn.Returns {
+			returns[i] = yulTypedNameText(ret)
+		}
+		header += " -> " + strings.Join(returns, ", ")
+	}
+	return header
+}
+
+func yulExpressionText(expr YulExpression) string {
+	switch e := expr.(type) {
+	case *YulFunctionCall:
+		args := make([]string, len(e.Arguments))
+		for i, arg := range e.Arguments {
+			args[i] = yulExpressionText(arg)
+		}
+		return e.FunctionName.Name + "(" + strings.Join(args, ", ") + ")"
+	case *YulIdentifier:
+		return e.Name
+	case *YulLiteral:
+		return yulLiteralText(e)
+	case nil:
+		return "/* missing expression */"
+	}
+	return "/* unsupported expression " + string(expr.GetType()) + " */"
+}
+
+// literalDefaultTypes is the type a literal of each kind has without a suffix
+var literalDefaultTypes = map[YulLiteralKind]YulDataType{
+	LiteralKindNumber: DataTypeUint256,
+	LiteralKindString: DataTypeString,
+	LiteralKindBool:   DataTypeBool,
+	LiteralKindHex:    DataTypeBytes32,
+}
+
+func yulLiteralText(lit *YulLiteral) string {
+	text := lit.Value
+	if lit.Kind == LiteralKindString {
+		text = quoteYulString(lit.Value)
+	}
+	if lit.Type != "" && lit.Type != literalDefaultTypes[lit.Kind] {
+		if name, ok := yulTypeName(lit.Type); ok {
+			text += ":" + name
+		}
+	}
+	return text
+}
+
+func yulTypedNameText(name *YulTypedName) string {
+	if name.Type == "" || name.Type == DataTypeUint256 {
+		return name.Name
+	}
+	if typeName, ok := yulTypeName(name.Type); ok {
+		return name.Name + ":" + typeName
+	}
+	return name.Name
+}
+
+// yulTypeName is the inverse of ParseYulType. Types without a Yul spelling,
+// such as address, report false.
+func yulTypeName(t YulDataType) (string, bool) {
+	if t == DataTypeBool {
+		return "bool", true
+	}
+	if bits := t.BitWidth(); bits > 0 {
+		prefix := "u"
+		if t.Signed() {
+			prefix = "s"
+		}
+		name := prefix + strings.TrimPrefix(strings.TrimPrefix(string(t), "uint"), "int")
+		if _, err := ParseYulType(name); err == nil {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// quoteYulString quotes s, escaping what the lexer decodes: quotes,
+// backslashes, control characters and bytes that are not UTF-8
+func quoteYulString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == utf8.RuneError && size == 1, !unicode.IsPrint(r):
+			for _, c := range []byte(s[i : i+size]) {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			}
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
+}